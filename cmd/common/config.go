@@ -13,6 +13,7 @@ import (
 	yaml "gopkg.in/yaml.v3"
 
 	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/fs"
 	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/logging"
 	"github.com/auriora/onemount/internal/metadata"
@@ -22,25 +23,63 @@ import (
 const (
 	// DefaultLogOutput is the default log output destination
 	DefaultLogOutput = "STDOUT"
+
+	// EphemeralMaxCacheSize caps the content cache of an ephemeral mount,
+	// which is removed when the mount stops.
+	EphemeralMaxCacheSize = 1 << 30
 )
 
 type Config struct {
-	CacheDir             string              `yaml:"cacheDir"`
-	LogLevel             string              `yaml:"log"`
-	LogOutput            string              `yaml:"logOutput"`
-	SyncTree             bool                `yaml:"syncTree"`
-	DeltaInterval        int                 `yaml:"deltaInterval"`
-	ActiveDeltaInterval  int                 `yaml:"activeDeltaInterval"`
-	ActiveDeltaWindow    int                 `yaml:"activeDeltaWindow"`
-	CacheExpiration      int                 `yaml:"cacheExpiration"`
-	CacheCleanupInterval int                 `yaml:"cacheCleanupInterval"` // Cache cleanup interval in hours
-	MaxCacheSize         int64               `yaml:"maxCacheSize"`         // Maximum cache size in bytes (0 = unlimited)
-	MaxBandwidthMbps     int                 `yaml:"maxBandwidthMbps"`     // Maximum bandwidth in Mbps (0 = unlimited)
-	MountTimeout         int                 `yaml:"mountTimeout"`
-	Realtime             RealtimeConfig      `yaml:"realtime"`
-	Overlay              OverlayConfig       `yaml:"overlay"`
-	Hydration            HydrationConfig     `yaml:"hydration"`
-	MetadataQueue        MetadataQueueConfig `yaml:"metadataQueue"`
+	CacheDir             string                 `yaml:"cacheDir"`
+	NetworkCache         string                 `yaml:"networkCache"` // memory, warn or refuse: what to do when cacheDir is on a network filesystem
+	LogLevel             string                 `yaml:"log"`
+	LogOutput            string                 `yaml:"logOutput"`
+	SyncTree             bool                   `yaml:"syncTree"`
+	SyncTreeScope        SyncTreeScopeConfig    `yaml:"syncTreeScope"`
+	DeltaInterval        int                    `yaml:"deltaInterval"`
+	ActiveDeltaInterval  int                    `yaml:"activeDeltaInterval"`
+	ActiveDeltaWindow    int                    `yaml:"activeDeltaWindow"`
+	CacheExpiration      int                    `yaml:"cacheExpiration"`
+	CacheCleanupInterval int                    `yaml:"cacheCleanupInterval"` // Cache cleanup interval in hours
+	MaxCacheSize         int64                  `yaml:"maxCacheSize"`         // Maximum cache size in bytes (0 = unlimited)
+	CacheQuota           bool                   `yaml:"-"`                    // MaxCacheSize is the mount's own, not shared with other mounts
+	MaxBandwidthMbps     int                    `yaml:"maxBandwidthMbps"`     // Maximum bandwidth in Mbps (0 = unlimited)
+	DailyTransferCapMB   int                    `yaml:"dailyTransferCapMB"`   // Daily upload+download budget for background hydration (0 = unlimited)
+	MeteredUploadLimitMB int                    `yaml:"meteredUploadLimitMB"` // Larger uploads wait for an unmetered connection (0 = never defer)
+	EvictionExemptions   []string               `yaml:"evictionExemptions"`   // Path globs never evicted from the content cache
+	AccessTimeMinutes    int                    `yaml:"accessTimeMinutes"`    // Minutes before opening a file records a new access time (0 = never)
+	ThumbnailCacheMB     int                    `yaml:"thumbnailCacheMB"`     // Size the thumbnail and preview cache is kept under (0 = unlimited)
+	IndexerHydration     bool                   `yaml:"indexerHydration"`     // Let desktop search indexers download files that are not cached
+	IndexerProcesses     []string               `yaml:"indexerProcesses"`     // Process names treated as search indexers besides fs.DefaultIndexerProcesses
+	StrictPOSIX          bool                   `yaml:"strictPosix"`          // Confirm metadata changes and fsync remotely, use stable inode numbers
+	ReviewOfflineReplay  bool                   `yaml:"reviewOfflineReplay"`  // Keep changes made offline until onemount replay --apply
+	OnedriverCompat      bool                   `yaml:"onedriverCompat"`      // Also expose onedriver's xattr names and D-Bus interface
+	ConflictNameTemplate string                 `yaml:"conflictNameTemplate"` // Name of conflict copies, see fs.DefaultConflictNameTemplate
+	NameNormalization    string                 `yaml:"nameNormalization"`    // nfc converts names entering the mount to NFC, none keeps them as spelled
+	FolderItemWarning    int                    `yaml:"folderItemWarning"`    // Warn when a folder grows past this many items (negative = never)
+	UploadAuditInterval  int                    `yaml:"uploadAuditInterval"`  // Hours between audits of recent uploads (0 = never)
+	NotificationDigest   int                    `yaml:"notificationDigest"`   // Minutes between summaries of sync activity (0 = never)
+	DesktopNotifications bool                   `yaml:"desktopNotifications"` // Show sync summaries as desktop notifications
+	WorkerStallMinutes   int                    `yaml:"workerStallMinutes"`   // Minutes without progress before a worker pool is reported stalled (negative = never)
+	RestartStalledPools  bool                   `yaml:"restartStalledPools"`  // Replace the stuck workers of a stalled pool
+	MetricsAddress       string                 `yaml:"metricsAddress"`       // Serve Prometheus metrics on localhost host:port or unix:<path> ("" = off)
+	MountTimeout         int                    `yaml:"mountTimeout"`
+	Fusermount           string                 `yaml:"fusermount"`      // Mount helper used instead of fusermount3
+	RemountAttempts      int                    `yaml:"remountAttempts"` // Times to mount again after the kernel aborted the FUSE connection (0 = never)
+	RemountDelay         int                    `yaml:"remountDelay"`    // Seconds before the first attempt to mount again, doubled for each further attempt
+	FuseFD               int                    `yaml:"-"`               // Pre-opened /dev/fuse descriptor from --fuse-fd or socket activation
+	ShareURL             string                 `yaml:"-"`               // Sharing link of a folder mounted read-only from --share-url
+	Frozen               bool                   `yaml:"-"`               // Serve the existing cache read-only and offline, from --frozen
+	Ephemeral            bool                   `yaml:"-"`               // Keep metadata in memory and remove the cache on exit, from --ephemeral
+	MultiMount           bool                   `yaml:"-"`               // Serve every mountpoint of Mounts in this process, from --multi-mount
+	Account              string                 `yaml:"-"`               // Account the mount signs in with, from its section of Mounts
+	Realtime             RealtimeConfig         `yaml:"realtime"`
+	Overlay              OverlayConfig          `yaml:"overlay"`
+	Hydration            HydrationConfig        `yaml:"hydration"`
+	MetadataQueue        MetadataQueueConfig    `yaml:"metadataQueue"`
+	Features             map[string]bool        `yaml:"features,omitempty"` // Feature flags of subsystems shipped switched off, see fs.FeatureNames
+	Mounts               map[string]MountConfig `yaml:"mounts,omitempty"`   // Settings of individual mounts by mountpoint
+	ConfigFile           string                 `yaml:"-"`                  // Path the configuration was loaded from
 	graph.AuthConfig     `yaml:"auth"`
 }
 
@@ -70,6 +109,24 @@ type RealtimeConfig struct {
 	// Must be between 30 and 7200 seconds (2 hours). Default is 1800 seconds (30 minutes).
 	// When Socket.IO is healthy, polling occurs much less frequently (every 30+ minutes).
 	FallbackInterval int `yaml:"fallbackIntervalSeconds"`
+
+	// LatencySLO is how many seconds a remote change may take to appear in the
+	// mount. When changes arrive later for LatencySLOPeriod minutes, a latency
+	// event warns about it. 0 measures latency without checking it.
+	LatencySLO       int `yaml:"latencySloSeconds"`
+	LatencySLOPeriod int `yaml:"latencySloPeriodMinutes"`
+}
+
+// SyncTreeScopeConfig limits which parts of the drive the background tree sync
+// enumerates. Directories outside the scope are discovered lazily on access,
+// which keeps deep archival hierarchies from being walked at every mount.
+type SyncTreeScopeConfig struct {
+	// MaxDepth is the number of directory levels below the root to enumerate.
+	MaxDepth int `yaml:"maxDepth"`
+	// Include lists mount-relative path globs to enumerate; empty means all.
+	Include []string `yaml:"include"`
+	// Exclude lists path globs never enumerated, even when included.
+	Exclude []string `yaml:"exclude"`
 }
 
 // OverlayConfig controls default overlay policies for new metadata entries.
@@ -77,6 +134,21 @@ type OverlayConfig struct {
 	DefaultPolicy string `yaml:"defaultPolicy"`
 }
 
+// MountConfig overrides settings for one mountpoint. Unset settings keep the
+// value of the top-level setting. The launcher edits these sections and asks
+// the running mount to reload them.
+type MountConfig struct {
+	DeltaInterval    *int            `yaml:"deltaInterval,omitempty"`
+	SyncTree         *bool           `yaml:"syncTree,omitempty"`
+	CacheExpiration  *int            `yaml:"cacheExpiration,omitempty"`
+	MaxBandwidthMbps *int            `yaml:"maxBandwidthMbps,omitempty"`
+	OverlayPolicy    *string         `yaml:"overlayPolicy,omitempty"`
+	MaxCacheSize     *int64          `yaml:"maxCacheSize,omitempty"`   // Quota of this mount's cache, not shared with other mounts
+	MetricsAddress   *string         `yaml:"metricsAddress,omitempty"` // Where this mount serves its metrics, each mount needs its own
+	Features         map[string]bool `yaml:"features,omitempty"`       // Feature flags set over the top-level ones
+	Account          string          `yaml:"account,omitempty"`        // Account whose tokens the mount uses, shared with its other mounts
+}
+
 // HydrationConfig controls download/hydration worker counts and queue sizing.
 type HydrationConfig struct {
 	Workers   int `yaml:"workers"`
@@ -104,6 +176,7 @@ func createDefaultConfig() Config {
 	xdgCacheDir, _ := os.UserCacheDir()
 	return Config{
 		CacheDir:             filepath.Join(xdgCacheDir, "onemount"),
+		NetworkCache:         string(fs.NetworkCacheMemory),
 		LogLevel:             "debug",
 		LogOutput:            DefaultLogOutput,                 // Default to standard output
 		SyncTree:             true,                             // Enable tree sync by default for better performance
@@ -114,13 +187,30 @@ func createDefaultConfig() Config {
 		CacheCleanupInterval: 24,                               // Default to 24 hours
 		MaxCacheSize:         0,                                // Default to unlimited (0 = no limit)
 		MaxBandwidthMbps:     0,                                // Default to unlimited (0 = no limit)
+		DailyTransferCapMB:   0,                                // Default to unlimited (0 = no cap)
+		MeteredUploadLimitMB: 0,                                // Default to never deferring uploads
 		MountTimeout:         60,                               // Default to 60 seconds
+		RemountAttempts:      3,
+		RemountDelay:         2,
+		ConflictNameTemplate: fs.DefaultConflictNameTemplate,
+		NameNormalization:    fs.NameNormalizationNFC,
+		FolderItemWarning:    fs.DefaultFolderItemWarning,
+		ThumbnailCacheMB:     fs.DefaultThumbnailCacheMB,
+		AccessTimeMinutes:    int(fs.DefaultAccessTimeInterval / time.Minute),
+		UploadAuditInterval:  0, // Default to auditing uploads only on demand
+		NotificationDigest:   0, // Default to no sync summaries
+		WorkerStallMinutes:   int(fs.DefaultWorkerStallTimeout / time.Minute),
+		SyncTreeScope: SyncTreeScopeConfig{
+			MaxDepth: 20,
+		},
 		Realtime: RealtimeConfig{
 			Enabled:          false,
 			PollingOnly:      false,
 			ClientState:      "",
 			Resource:         "/me/drive/root",
 			FallbackInterval: int((30 * time.Minute).Seconds()),
+			LatencySLO:       int(fs.DefaultRealtimeLatencySLO / time.Second),
+			LatencySLOPeriod: int(fs.DefaultRealtimeLatencySLOPeriod / time.Minute),
 		},
 		Overlay: OverlayConfig{
 			DefaultPolicy: string(metadata.OverlayPolicyRemoteWins),
@@ -244,6 +334,50 @@ func validateConfig(config *Config) error {
 		config.MountTimeout = 60
 	}
 
+	if config.DailyTransferCapMB < 0 {
+		return fmt.Errorf("dailyTransferCapMB must not be negative, got %d", config.DailyTransferCapMB)
+	}
+	if config.MeteredUploadLimitMB < 0 {
+		return fmt.Errorf("meteredUploadLimitMB must not be negative, got %d", config.MeteredUploadLimitMB)
+	}
+	if config.ThumbnailCacheMB < 0 {
+		return fmt.Errorf("thumbnailCacheMB must not be negative, got %d", config.ThumbnailCacheMB)
+	}
+	if config.AccessTimeMinutes < 0 {
+		return fmt.Errorf("accessTimeMinutes must not be negative, got %d", config.AccessTimeMinutes)
+	}
+	if config.RemountAttempts < 0 {
+		return fmt.Errorf("remountAttempts must not be negative, got %d", config.RemountAttempts)
+	}
+	if config.RemountDelay < 0 {
+		return fmt.Errorf("remountDelay must not be negative, got %d", config.RemountDelay)
+	}
+	if config.UploadAuditInterval < 0 {
+		return fmt.Errorf("uploadAuditInterval must not be negative, got %d", config.UploadAuditInterval)
+	}
+	if config.NotificationDigest < 0 {
+		return fmt.Errorf("notificationDigest must not be negative, got %d", config.NotificationDigest)
+	}
+
+	if config.ConflictNameTemplate == "" {
+		config.ConflictNameTemplate = fs.DefaultConflictNameTemplate
+	}
+	if err := fs.ValidateConflictNameTemplate(config.ConflictNameTemplate); err != nil {
+		return fmt.Errorf("conflictNameTemplate: %w", err)
+	}
+	if config.NameNormalization == "" {
+		config.NameNormalization = fs.NameNormalizationNFC
+	}
+	config.NameNormalization = strings.ToLower(config.NameNormalization)
+	if err := fs.ValidateNameNormalization(config.NameNormalization); err != nil {
+		return fmt.Errorf("nameNormalization: %w", err)
+	}
+	if config.MetricsAddress != "" {
+		if _, _, err := fs.ParseMetricsAddress(config.MetricsAddress); err != nil {
+			return fmt.Errorf("metricsAddress: %w", err)
+		}
+	}
+
 	// Validate CacheDir
 	if config.CacheDir == "" {
 		logging.Warn().Msg("Cache directory cannot be empty, using default.")
@@ -252,6 +386,20 @@ func validateConfig(config *Config) error {
 	}
 	config.CacheDir = expandUserPath(config.CacheDir)
 
+	if err := validatePathGlobs("evictionExemptions", config.EvictionExemptions); err != nil {
+		return err
+	}
+	if err := validateSyncTreeScope(&config.SyncTreeScope); err != nil {
+		return err
+	}
+
+	switch fs.NetworkCachePolicy(strings.ToLower(config.NetworkCache)) {
+	case fs.NetworkCacheRefuse, fs.NetworkCacheWarn, fs.NetworkCacheMemory:
+		config.NetworkCache = strings.ToLower(config.NetworkCache)
+	default:
+		return fmt.Errorf("networkCache must be refuse, warn, or memory; got %s", config.NetworkCache)
+	}
+
 	switch strings.ToUpper(config.Overlay.DefaultPolicy) {
 	case string(metadata.OverlayPolicyRemoteWins), string(metadata.OverlayPolicyLocalWins), string(metadata.OverlayPolicyMerged):
 		config.Overlay.DefaultPolicy = strings.ToUpper(config.Overlay.DefaultPolicy)
@@ -276,10 +424,121 @@ func validateConfig(config *Config) error {
 	if err := validateMetadataQueueConfig(&config.MetadataQueue); err != nil {
 		return err
 	}
+	config.Features = validateFeatures("features", config.Features)
+	if err := validateMountConfigs(config); err != nil {
+		return err
+	}
+
+	return nil
+}
 
+// validateMountConfigs checks the per-mount settings and keys them by the
+// expanded, cleaned mountpoint path.
+func validateMountConfigs(config *Config) error {
+	if len(config.Mounts) == 0 {
+		return nil
+	}
+	mounts := make(map[string]MountConfig, len(config.Mounts))
+	for mountpoint, mount := range config.Mounts {
+		if mount.DeltaInterval != nil && *mount.DeltaInterval <= 0 {
+			return fmt.Errorf("mounts.%s.deltaInterval must be positive, got %d", mountpoint, *mount.DeltaInterval)
+		}
+		if mount.CacheExpiration != nil && *mount.CacheExpiration < 0 {
+			return fmt.Errorf("mounts.%s.cacheExpiration must not be negative, got %d", mountpoint, *mount.CacheExpiration)
+		}
+		if mount.MaxBandwidthMbps != nil && *mount.MaxBandwidthMbps < 0 {
+			return fmt.Errorf("mounts.%s.maxBandwidthMbps must not be negative, got %d", mountpoint, *mount.MaxBandwidthMbps)
+		}
+		if mount.MaxCacheSize != nil && *mount.MaxCacheSize < 0 {
+			return fmt.Errorf("mounts.%s.maxCacheSize must not be negative, got %d", mountpoint, *mount.MaxCacheSize)
+		}
+		if mount.MetricsAddress != nil && *mount.MetricsAddress != "" {
+			if _, _, err := fs.ParseMetricsAddress(*mount.MetricsAddress); err != nil {
+				return fmt.Errorf("mounts.%s.metricsAddress: %w", mountpoint, err)
+			}
+		}
+		if mount.OverlayPolicy != nil {
+			policy := strings.ToUpper(*mount.OverlayPolicy)
+			if err := metadata.OverlayPolicy(policy).Validate(); err != nil {
+				return fmt.Errorf("mounts.%s.overlayPolicy must be REMOTE_WINS, LOCAL_WINS, or MERGED; got %s", mountpoint, *mount.OverlayPolicy)
+			}
+			mount.OverlayPolicy = &policy
+		}
+		mount.Features = validateFeatures("mounts."+mountpoint+".features", mount.Features)
+		mount.Account = strings.TrimSpace(mount.Account)
+		mounts[filepath.Clean(expandUserPath(mountpoint))] = mount
+	}
+	config.Mounts = mounts
 	return nil
 }
 
+// ForMount returns the configuration of the mount at mountpoint, with its
+// section of Mounts applied over the top-level settings.
+func (c *Config) ForMount(mountpoint string) *Config {
+	mounted := *c
+	mount, ok := c.Mounts[filepath.Clean(mountpoint)]
+	if !ok {
+		return &mounted
+	}
+	if mount.DeltaInterval != nil {
+		mounted.DeltaInterval = *mount.DeltaInterval
+	}
+	if mount.SyncTree != nil {
+		mounted.SyncTree = *mount.SyncTree
+	}
+	if mount.CacheExpiration != nil {
+		mounted.CacheExpiration = *mount.CacheExpiration
+	}
+	if mount.MaxBandwidthMbps != nil {
+		mounted.MaxBandwidthMbps = *mount.MaxBandwidthMbps
+	}
+	if mount.OverlayPolicy != nil {
+		mounted.Overlay.DefaultPolicy = *mount.OverlayPolicy
+	}
+	if mount.MaxCacheSize != nil {
+		mounted.MaxCacheSize = *mount.MaxCacheSize
+		mounted.CacheQuota = true
+	}
+	if mount.MetricsAddress != nil {
+		mounted.MetricsAddress = *mount.MetricsAddress
+	}
+	mounted.Account = mount.Account
+	if len(mount.Features) > 0 {
+		mounted.Features = make(map[string]bool, len(c.Features)+len(mount.Features))
+		for name, on := range c.Features {
+			mounted.Features[name] = on
+		}
+		for name, on := range mount.Features {
+			mounted.Features[name] = on
+		}
+	}
+	return &mounted
+}
+
+// validateFeatures returns the feature flags under the given config key with
+// their names spelled as fs.FeatureNames does. Unknown flags, such as those
+// of features that are now always on, are dropped with a warning rather than
+// refused, so that older configuration files keep working.
+func validateFeatures(key string, features map[string]bool) map[string]bool {
+	if len(features) == 0 {
+		return features
+	}
+	valid := make(map[string]bool, len(features))
+	for name, on := range features {
+		feature, ok := fs.LookupFeature(name)
+		if !ok {
+			logging.Warn().
+				Str("key", key).
+				Str("feature", name).
+				Strs("known", fs.FeatureNames()).
+				Msg("Unknown feature flag, ignoring it.")
+			continue
+		}
+		valid[string(feature)] = on
+	}
+	return valid
+}
+
 // validateRealtimeConfig validates and applies defaults to realtime configuration.
 // This ensures that all realtime settings are within acceptable ranges and that
 // required fields have appropriate default values when not specified.
@@ -296,12 +555,43 @@ func validateRealtimeConfig(cfg *RealtimeConfig) error {
 	if cfg.FallbackInterval < 30 || cfg.FallbackInterval > int((2*time.Hour).Seconds()) {
 		return fmt.Errorf("realtime fallback interval must be between 30 and 7200 seconds, got %d", cfg.FallbackInterval)
 	}
+	if cfg.LatencySLO < 0 {
+		return fmt.Errorf("realtime latency SLO must not be negative, got %d", cfg.LatencySLO)
+	}
+	if cfg.LatencySLOPeriod <= 0 {
+		cfg.LatencySLOPeriod = int(fs.DefaultRealtimeLatencySLOPeriod / time.Minute)
+	}
 	if cfg.Enabled && cfg.ClientState == "" {
 		cfg.ClientState = generateClientState()
 	}
 	return nil
 }
 
+// validatePathGlobs checks that every pattern under the given config key is a
+// usable mount-relative glob.
+func validatePathGlobs(key string, patterns []string) error {
+	for _, pattern := range patterns {
+		if err := fs.ValidatePathGlob(pattern); err != nil {
+			return fmt.Errorf("%s pattern %q is invalid: %w", key, pattern, err)
+		}
+	}
+	return nil
+}
+
+// validateSyncTreeScope validates the tree sync depth limit and path filters.
+func validateSyncTreeScope(cfg *SyncTreeScopeConfig) error {
+	if cfg.MaxDepth < 0 {
+		return fmt.Errorf("syncTreeScope.maxDepth must not be negative, got %d", cfg.MaxDepth)
+	}
+	if cfg.MaxDepth == 0 {
+		cfg.MaxDepth = 20
+	}
+	if err := validatePathGlobs("syncTreeScope.include", cfg.Include); err != nil {
+		return err
+	}
+	return validatePathGlobs("syncTreeScope.exclude", cfg.Exclude)
+}
+
 func validateHydrationConfig(cfg *HydrationConfig) error {
 	if cfg == nil {
 		return nil
@@ -383,6 +673,16 @@ func LoadConfig(path string) *Config {
 		}
 	}
 
+	// Report misconfiguration the parser and validateConfig let through
+	for _, issue := range ValidateConfigData(conf) {
+		logging.Warn().
+			Str("path", path).
+			Int("line", issue.Line).
+			Int("column", issue.Column).
+			Str("key", issue.Key).
+			Msg("Configuration problem: " + issue.Message)
+	}
+
 	// Parse configuration
 	config, err := parseConfig(conf)
 	if err != nil {
@@ -0,0 +1,370 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/auriora/onemount/internal/fs"
+)
+
+// The configuration schema is derived from the Config struct and the ranges
+// and choices below, so it cannot drift from what LoadConfig accepts. The
+// published copy is configs/config.schema.json. ValidateConfigData checks a
+// configuration file against it and reports each unknown key, wrong type and
+// out-of-range value with its line and column, which the YAML decoder alone
+// silently ignores or reports one at a time.
+
+// ConfigSchemaID identifies the published configuration schema.
+const ConfigSchemaID = "https://github.com/auriora/onemount/configs/config.schema.json"
+
+// configRange bounds an integer setting. Max 0 means unbounded.
+type configRange struct {
+	Min, Max int64
+}
+
+// configRanges are the ranges validateConfig enforces, by dotted key.
+var configRanges = map[string]configRange{
+	"deltaInterval":                    {Min: 1},
+	"activeDeltaInterval":              {Min: 1},
+	"activeDeltaWindow":                {Min: 1},
+	"cacheExpiration":                  {Min: 0},
+	"cacheCleanupInterval":             {Min: 1, Max: 720},
+	"maxCacheSize":                     {Min: 0},
+	"maxBandwidthMbps":                 {Min: 0},
+	"dailyTransferCapMB":               {Min: 0},
+	"meteredUploadLimitMB":             {Min: 0},
+	"thumbnailCacheMB":                 {Min: 0},
+	"accessTimeMinutes":                {Min: 0},
+	"remountAttempts":                  {Min: 0},
+	"remountDelay":                     {Min: 0},
+	"uploadAuditInterval":              {Min: 0},
+	"notificationDigest":               {Min: 0},
+	"mountTimeout":                     {Min: 1},
+	"syncTreeScope.maxDepth":           {Min: 0},
+	"realtime.fallbackIntervalSeconds": {Min: 30, Max: 7200},
+	"realtime.latencySloSeconds":       {Min: 0},
+	"realtime.latencySloPeriodMinutes": {Min: 1},
+	"hydration.workers":                {Min: 1, Max: 64},
+	"hydration.queueSize":              {Min: 1, Max: 100000},
+	"metadataQueue.workers":            {Min: 1, Max: 64},
+	"metadataQueue.highPrioritySize":   {Min: 1, Max: 100000},
+	"metadataQueue.lowPrioritySize":    {Min: 1, Max: 100000},
+	"mounts.*.deltaInterval":           {Min: 1},
+	"mounts.*.cacheExpiration":         {Min: 0},
+	"mounts.*.maxBandwidthMbps":        {Min: 0},
+	"mounts.*.maxCacheSize":            {Min: 0},
+}
+
+// configChoices are the accepted values of string settings, compared without
+// case.
+var configChoices = map[string][]string{
+	"log":                    LogLevels(),
+	"nameNormalization":      {fs.NameNormalizationNFC, fs.NameNormalizationNone},
+	"networkCache":           {"refuse", "warn", "memory"},
+	"overlay.defaultPolicy":  {"REMOTE_WINS", "LOCAL_WINS", "MERGED"},
+	"mounts.*.overlayPolicy": {"REMOTE_WINS", "LOCAL_WINS", "MERGED"},
+}
+
+// configKeys are the accepted keys of map settings, compared without case.
+var configKeys = map[string]func() []string{
+	"features":          fs.FeatureNames,
+	"mounts.*.features": fs.FeatureNames,
+}
+
+// ConfigIssue is a problem found in a configuration file.
+type ConfigIssue struct {
+	Line, Column int
+	Key          string // dotted key, empty for the document itself
+	Message      string
+}
+
+func (i ConfigIssue) String() string {
+	if i.Key == "" {
+		return fmt.Sprintf("%d:%d: %s", i.Line, i.Column, i.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", i.Line, i.Column, i.Key, i.Message)
+}
+
+// ConfigSchema returns the JSON Schema of the configuration file.
+func ConfigSchema() ([]byte, error) {
+	schema := configTypeSchema(reflect.TypeOf(Config{}), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = ConfigSchemaID
+	schema["title"] = "OneMount configuration"
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func configTypeSchema(t reflect.Type, key string) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for _, field := range configFields(t) {
+			properties[field.name] = configTypeSchema(field.typ, joinConfigKey(key, field.name))
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	case reflect.Map:
+		schema := map[string]interface{}{"type": "object", "additionalProperties": configTypeSchema(t.Elem(), joinConfigKey(key, "*"))}
+		if keys, ok := configKeys[key]; ok {
+			schema["propertyNames"] = map[string]interface{}{"enum": keys()}
+		}
+		return schema
+	case reflect.Ptr:
+		return configTypeSchema(t.Elem(), key)
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": configTypeSchema(t.Elem(), key)}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		schema := map[string]interface{}{"type": "integer"}
+		if r, ok := configRanges[key]; ok {
+			schema["minimum"] = r.Min
+			if r.Max != 0 {
+				schema["maximum"] = r.Max
+			}
+		}
+		return schema
+	default:
+		schema := map[string]interface{}{"type": "string"}
+		if choices, ok := configChoices[key]; ok {
+			schema["enum"] = choices
+		}
+		return schema
+	}
+}
+
+// configField is a setting of a configuration struct.
+type configField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// configFields lists the YAML settings of a configuration struct in
+// declaration order.
+func configFields(t reflect.Type) []configField {
+	var fields []configField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields = append(fields, configField{name: name, index: f.Index, typ: f.Type})
+	}
+	return fields
+}
+
+func joinConfigKey(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// ValidateConfigData checks a YAML configuration file against the schema. A
+// value of 0 for a setting with another default is accepted, since LoadConfig
+// replaces it with the default.
+func ValidateConfigData(data []byte) []ConfigIssue {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []ConfigIssue{yamlSyntaxIssue(err)}
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	defaults := createDefaultConfig()
+	var issues []ConfigIssue
+	validateConfigNode(doc.Content[0], reflect.ValueOf(defaults), "", &issues)
+	return issues
+}
+
+// ValidateConfigFile checks the configuration file at path against the schema.
+func ValidateConfigFile(path string) ([]ConfigIssue, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateConfigData(data), nil
+}
+
+// yamlSyntaxIssue turns a YAML parse error ("yaml: line 3: ...") into an
+// issue.
+func yamlSyntaxIssue(err error) ConfigIssue {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	var line int
+	if n, _ := fmt.Sscanf(msg, "line %d:", &line); n == 1 {
+		msg = strings.TrimSpace(msg[strings.Index(msg, ":")+1:])
+	}
+	return ConfigIssue{Line: line, Message: msg}
+}
+
+func validateConfigNode(node *yaml.Node, def reflect.Value, key string, issues *[]ConfigIssue) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	add := func(format string, args ...interface{}) {
+		*issues = append(*issues, ConfigIssue{Line: node.Line, Column: node.Column, Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	t := def.Type()
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			add("expected a mapping")
+			return
+		}
+		fields := make(map[string]configField)
+		var names []string
+		for _, field := range configFields(t) {
+			fields[field.name] = field
+			names = append(names, field.name)
+		}
+		sort.Strings(names)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			field, ok := fields[k.Value]
+			if !ok {
+				*issues = append(*issues, ConfigIssue{Line: k.Line, Column: k.Column, Key: joinConfigKey(key, k.Value),
+					Message: "unknown setting" + configSuggestion(k.Value, names)})
+				continue
+			}
+			validateConfigNode(v, def.FieldByIndex(field.index), joinConfigKey(key, field.name), issues)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			add("expected a mapping")
+			return
+		}
+		keys, checkKeys := configKeys[key]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k := node.Content[i]
+			if checkKeys && !configKeyKnown(k.Value, keys()) {
+				*issues = append(*issues, ConfigIssue{Line: k.Line, Column: k.Column, Key: joinConfigKey(key, k.Value),
+					Message: "unknown name" + configSuggestion(k.Value, keys())})
+				continue
+			}
+			validateConfigNode(node.Content[i+1], reflect.Zero(t.Elem()), joinConfigKey(key, "*"), issues)
+		}
+	case reflect.Ptr:
+		validateConfigNode(node, reflect.Zero(t.Elem()), key, issues)
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			add("expected a list")
+			return
+		}
+		for _, item := range node.Content {
+			validateConfigNode(item, reflect.Zero(t.Elem()), key, issues)
+		}
+	case reflect.Bool:
+		var b bool
+		if node.Kind != yaml.ScalarNode || node.Decode(&b) != nil {
+			add("expected true or false, got %s", describeConfigNode(node))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" || node.Decode(&n) != nil {
+			add("expected a whole number, got %s", describeConfigNode(node))
+			return
+		}
+		r, ok := configRanges[key]
+		if !ok || (n == 0 && def.Int() != 0) {
+			return
+		}
+		switch {
+		case r.Max != 0 && (n < r.Min || n > r.Max):
+			add("must be between %d and %d, got %d", r.Min, r.Max, n)
+		case n < r.Min:
+			add("must be at least %d, got %d", r.Min, n)
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			add("expected a string, got %s", describeConfigNode(node))
+			return
+		}
+		choices, ok := configChoices[key]
+		if !ok {
+			return
+		}
+		for _, choice := range choices {
+			if strings.EqualFold(node.Value, choice) {
+				return
+			}
+		}
+		add("must be one of %s, got %q", strings.Join(choices, ", "), node.Value)
+	}
+}
+
+// configKeyKnown reports whether name is one of known, ignoring case.
+func configKeyKnown(name string, known []string) bool {
+	for _, candidate := range known {
+		if strings.EqualFold(name, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeConfigNode names what a YAML node holds for error messages.
+func describeConfigNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return fmt.Sprintf("%q", node.Value)
+}
+
+// configSuggestion proposes the known setting closest to an unknown one.
+func configSuggestion(name string, known []string) string {
+	best, bestDistance := "", len(name)/2+1
+	for _, candidate := range known {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
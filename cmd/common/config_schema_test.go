@@ -0,0 +1,84 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUT_CMD_Config_ValidateConfigDataReportsLocations(t *testing.T) {
+	data := []byte(`log: chatty
+cacheCleanupInterval: 1000
+deltaInteval: 60
+strictPosix: maybe
+hydration:
+  workers: two
+  queueSize: 0
+evictionExemptions: "*.pst"
+mounts:
+  /home/user/OneDrive:
+    deltaInterval: 0
+    overlayPolicy: mine
+    features:
+      mapedReads: true
+`)
+	issues := ValidateConfigData(data)
+
+	want := []string{
+		"1:6: log: must be one of trace, debug, info, warn, error, fatal, got \"chatty\"",
+		"2:23: cacheCleanupInterval: must be between 1 and 720, got 1000",
+		"3:1: deltaInteval: unknown setting (did you mean \"deltaInterval\"?)",
+		"4:14: strictPosix: expected true or false, got \"maybe\"",
+		"6:12: hydration.workers: expected a whole number, got \"two\"",
+		"8:21: evictionExemptions: expected a list",
+		"11:20: mounts.*.deltaInterval: must be at least 1, got 0",
+		"12:20: mounts.*.overlayPolicy: must be one of REMOTE_WINS, LOCAL_WINS, MERGED, got \"mine\"",
+		"14:7: mounts.*.features.mapedReads: unknown name (did you mean \"mappedReads\"?)",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %v", len(want), issues)
+	}
+	for i, issue := range issues {
+		if issue.String() != want[i] {
+			t.Fatalf("issue %d: expected %q, got %q", i, want[i], issue.String())
+		}
+	}
+}
+
+func TestUT_CMD_Config_ValidateConfigDataSyntaxError(t *testing.T) {
+	issues := ValidateConfigData([]byte("log: debug\n  cacheDir: [\n"))
+	if len(issues) != 1 || issues[0].Line == 0 {
+		t.Fatalf("expected one syntax issue with a line, got %v", issues)
+	}
+}
+
+func TestUT_CMD_Config_DefaultConfigFileIsValid(t *testing.T) {
+	issues, err := ValidateConfigFile(filepath.Join("..", "..", "configs", "default-config.yml"))
+	if err != nil {
+		t.Fatalf("could not read default config: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("default config has problems: %v", issues)
+	}
+}
+
+func TestUT_CMD_Config_PublishedSchemaIsCurrent(t *testing.T) {
+	schema, err := ConfigSchema()
+	if err != nil {
+		t.Fatalf("ConfigSchema failed: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(schema, &decoded); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	published, err := os.ReadFile(filepath.Join("..", "..", "configs", "config.schema.json"))
+	if err != nil {
+		t.Fatalf("could not read published schema: %v", err)
+	}
+	if !bytes.Equal(schema, published) {
+		t.Fatalf("configs/config.schema.json is out of date, regenerate it with: onemount config schema > configs/config.schema.json")
+	}
+}
@@ -217,6 +217,44 @@ func TestUT_CMD_Config_ValidateConfigOverlayPolicy(t *testing.T) {
 	}
 }
 
+func TestUT_CMD_Config_ValidateNetworkCachePolicy(t *testing.T) {
+	cfg := createDefaultConfig()
+	if cfg.NetworkCache != "memory" {
+		t.Fatalf("expected metadata of network caches to be kept in memory by default, got %s", cfg.NetworkCache)
+	}
+	cfg.NetworkCache = "Refuse"
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatalf("validateConfig returned error: %v", err)
+	}
+	if cfg.NetworkCache != "refuse" {
+		t.Fatalf("expected network cache policy normalized to refuse, got %s", cfg.NetworkCache)
+	}
+
+	cfg.NetworkCache = "sometimes"
+	if err := validateConfig(&cfg); err == nil {
+		t.Fatalf("expected error for invalid network cache policy")
+	}
+}
+
+func TestUT_CMD_Config_ValidateNameNormalization(t *testing.T) {
+	cfg := createDefaultConfig()
+	if cfg.NameNormalization != "nfc" {
+		t.Fatalf("expected names normalized to NFC by default, got %s", cfg.NameNormalization)
+	}
+	cfg.NameNormalization = "None"
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatalf("validateConfig returned error: %v", err)
+	}
+	if cfg.NameNormalization != "none" {
+		t.Fatalf("expected name normalization normalized to none, got %s", cfg.NameNormalization)
+	}
+
+	cfg.NameNormalization = "nfd"
+	if err := validateConfig(&cfg); err == nil {
+		t.Fatalf("expected error for invalid name normalization")
+	}
+}
+
 func TestUT_CMD_Config_ValidateRealtimeConfigDefaults(t *testing.T) {
 	cfg := &RealtimeConfig{
 		Enabled:          true,
@@ -307,3 +345,139 @@ func TestUT_CMD_Config_RealtimeFallbackValidationBounds(t *testing.T) {
 		t.Fatalf("validateConfig returned error for valid fallback interval: %v", err)
 	}
 }
+
+func TestUT_CMD_Config_ValidateEvictionExemptions(t *testing.T) {
+	cfg := createDefaultConfig()
+	cfg.EvictionExemptions = []string{"Documents/Projects/**", "*.pst"}
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatalf("validateConfig returned error: %v", err)
+	}
+
+	cfg.EvictionExemptions = []string{"Documents/["}
+	if err := validateConfig(&cfg); err == nil {
+		t.Fatalf("expected error for malformed eviction exemption")
+	}
+}
+
+func TestUT_CMD_Config_ValidateSyncTreeScope(t *testing.T) {
+	cfg := createDefaultConfig()
+	cfg.SyncTreeScope = SyncTreeScopeConfig{Include: []string{"Documents/**"}, Exclude: []string{"**/Archive"}}
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatalf("validateConfig returned error: %v", err)
+	}
+	if cfg.SyncTreeScope.MaxDepth != 20 {
+		t.Fatalf("expected default max depth 20, got %d", cfg.SyncTreeScope.MaxDepth)
+	}
+
+	cfg.SyncTreeScope.MaxDepth = -1
+	if err := validateConfig(&cfg); err == nil {
+		t.Fatalf("expected error for negative max depth")
+	}
+
+	cfg.SyncTreeScope.MaxDepth = 3
+	cfg.SyncTreeScope.Exclude = []string{"Photos/["}
+	if err := validateConfig(&cfg); err == nil {
+		t.Fatalf("expected error for malformed exclude pattern")
+	}
+}
+
+func TestUT_CMD_Config_MountSectionOverridesTopLevelSettings(t *testing.T) {
+	cfg := createDefaultConfig()
+	interval, expiration, policy := 120, 0, "local_wins"
+	syncTree := false
+	cfg.Mounts = map[string]MountConfig{
+		"/home/user/OneDrive/": {DeltaInterval: &interval, SyncTree: &syncTree, CacheExpiration: &expiration, OverlayPolicy: &policy,
+			Account: " user@example.com "},
+	}
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatalf("validateConfig returned error: %v", err)
+	}
+
+	mounted := cfg.ForMount("/home/user/OneDrive")
+	if mounted.DeltaInterval != 120 || mounted.SyncTree || mounted.CacheExpiration != 0 || mounted.Overlay.DefaultPolicy != "LOCAL_WINS" {
+		t.Fatalf("mount section not applied: %+v", mounted)
+	}
+	if mounted.Account != "user@example.com" {
+		t.Fatalf("expected the mount's account, got %q", mounted.Account)
+	}
+	if mounted.MaxBandwidthMbps != cfg.MaxBandwidthMbps {
+		t.Fatalf("unset settings should keep the top-level value")
+	}
+	if other := cfg.ForMount("/home/user/Work"); other.DeltaInterval != cfg.DeltaInterval || !other.SyncTree || other.Account != "" {
+		t.Fatalf("other mounts should use the top-level settings: %+v", other)
+	}
+
+	interval = 0
+	if err := validateConfig(&cfg); err == nil {
+		t.Fatalf("expected error for a zero per-mount delta interval")
+	}
+}
+
+func TestUT_CMD_Config_MountFeatureFlags(t *testing.T) {
+	cfg := createDefaultConfig()
+	cfg.Features = map[string]bool{"MappedReads": true, "retiredFeature": true}
+	cfg.Mounts = map[string]MountConfig{
+		"/home/user/Work": {Features: map[string]bool{"mappedReads": false}},
+	}
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatalf("unknown feature flags should be ignored, got %v", err)
+	}
+	if len(cfg.Features) != 1 || !cfg.Features["mappedReads"] {
+		t.Fatalf("expected only the known flag, spelled as its feature: %v", cfg.Features)
+	}
+
+	if work := cfg.ForMount("/home/user/Work").Features; work["mappedReads"] {
+		t.Fatalf("mount flags should override the top-level ones: %v", work)
+	}
+	if other := cfg.ForMount("/home/user/OneDrive").Features; !other["mappedReads"] {
+		t.Fatalf("other mounts should use the top-level flags: %v", other)
+	}
+	if !cfg.Features["mappedReads"] {
+		t.Fatalf("ForMount should not change the top-level flags")
+	}
+}
+
+func TestUT_CMD_Config_MountCacheQuota(t *testing.T) {
+	cfg := createDefaultConfig()
+	cfg.MaxCacheSize = 10 << 30
+	quota := int64(2 << 30)
+	cfg.Mounts = map[string]MountConfig{"/home/user/Work": {MaxCacheSize: &quota}}
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatalf("validateConfig returned error: %v", err)
+	}
+
+	if mounted := cfg.ForMount("/home/user/Work"); mounted.MaxCacheSize != quota || !mounted.CacheQuota {
+		t.Fatalf("expected the mount's own quota, got %d (quota %v)", mounted.MaxCacheSize, mounted.CacheQuota)
+	}
+	if other := cfg.ForMount("/home/user/OneDrive"); other.MaxCacheSize != cfg.MaxCacheSize || other.CacheQuota {
+		t.Fatalf("other mounts should share the top-level limit, got %d (quota %v)", other.MaxCacheSize, other.CacheQuota)
+	}
+
+	quota = -1
+	if err := validateConfig(&cfg); err == nil {
+		t.Fatalf("expected error for a negative per-mount cache size")
+	}
+}
+
+func TestUT_CMD_Config_MetricsAddress(t *testing.T) {
+	cfg := createDefaultConfig()
+	cfg.MetricsAddress = "localhost:9464"
+	work := "unix:/run/user/1000/onemount-work.sock"
+	cfg.Mounts = map[string]MountConfig{"/home/user/Work": {MetricsAddress: &work}}
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatalf("validateConfig returned error: %v", err)
+	}
+	if mounted := cfg.ForMount("/home/user/Work"); mounted.MetricsAddress != work {
+		t.Fatalf("expected the mount's own metrics address, got %q", mounted.MetricsAddress)
+	}
+
+	cfg.MetricsAddress = "0.0.0.0:9464"
+	if err := validateConfig(&cfg); err == nil {
+		t.Fatalf("expected error for metrics served on every interface")
+	}
+	cfg.MetricsAddress = ""
+	work = "9464"
+	if err := validateConfig(&cfg); err == nil {
+		t.Fatalf("expected error for a per-mount metrics address without a host")
+	}
+}
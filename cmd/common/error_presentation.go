@@ -131,7 +131,7 @@ func CategorizeError(err error) UserFriendlyError {
 		result.Suggestion = "This might be due to slow internet or OneDrive being temporarily unavailable. Please try again later."
 	}
 
-	if strings.Contains(errStr, "quota") || strings.Contains(errStr, "storage") {
+	if errors.Is(err, errors.ErrQuotaExceeded) || strings.Contains(errStr, "quota") || strings.Contains(errStr, "storage") {
 		result.Category = ErrorCategoryOperation
 		result.Title = "Storage Quota Exceeded"
 		result.Message = "You have reached your OneDrive storage limit."
@@ -0,0 +1,125 @@
+package common
+
+import (
+	"os"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	bolt "go.etcd.io/bbolt"
+)
+
+// FailureReason names why onemount exited, for the final log line and the
+// exit code. Values are stable so systemd OnFailure= handlers and scripts can
+// match on them.
+type FailureReason string
+
+const (
+	// FailureGeneral is any failure without a more specific reason
+	FailureGeneral FailureReason = "error"
+	// FailureUsage means the command line was wrong, including a missing or
+	// unusable mountpoint
+	FailureUsage FailureReason = "usage"
+	// FailureConfigInvalid means the configuration file has problems
+	FailureConfigInvalid FailureReason = "config_invalid"
+	// FailureAuth means signing in to OneDrive failed
+	FailureAuth FailureReason = "auth_failed"
+	// FailureMountpointBusy means the mountpoint or its cache is used by
+	// another mount
+	FailureMountpointBusy FailureReason = "mountpoint_busy"
+	// FailureDBCorrupted means the metadata database could not be read
+	FailureDBCorrupted FailureReason = "db_corrupted"
+	// FailureNetwork means OneDrive could not be reached
+	FailureNetwork FailureReason = "network_unreachable"
+	// FailureFuseUnavailable means FUSE cannot be used: no fusermount3
+	// helper or an unusable fuse descriptor
+	FailureFuseUnavailable FailureReason = "fuse_unavailable"
+)
+
+// Exit codes for each failure reason, taken from sysexits.h where one fits.
+const (
+	ExitGeneral         = 1
+	ExitUsage           = 64 // EX_USAGE
+	ExitDBCorrupted     = 65 // EX_DATAERR
+	ExitNetwork         = 68 // EX_NOHOST
+	ExitFuseUnavailable = 69 // EX_UNAVAILABLE
+	ExitMountpointBusy  = 75 // EX_TEMPFAIL
+	ExitAuth            = 77 // EX_NOPERM
+	ExitConfigInvalid   = 78 // EX_CONFIG
+)
+
+// ExitCode returns the process exit code for the reason.
+func (r FailureReason) ExitCode() int {
+	switch r {
+	case FailureUsage:
+		return ExitUsage
+	case FailureConfigInvalid:
+		return ExitConfigInvalid
+	case FailureAuth:
+		return ExitAuth
+	case FailureMountpointBusy:
+		return ExitMountpointBusy
+	case FailureDBCorrupted:
+		return ExitDBCorrupted
+	case FailureNetwork:
+		return ExitNetwork
+	case FailureFuseUnavailable:
+		return ExitFuseUnavailable
+	default:
+		return ExitGeneral
+	}
+}
+
+// reasonError attaches a failure reason to an error.
+type reasonError struct {
+	err    error
+	reason FailureReason
+}
+
+func (e *reasonError) Error() string { return e.err.Error() }
+
+func (e *reasonError) Unwrap() error { return e.err }
+
+// WithFailureReason marks err as failing for reason. It returns nil for a nil
+// error.
+func WithFailureReason(err error, reason FailureReason) error {
+	if err == nil {
+		return nil
+	}
+	return &reasonError{err: err, reason: reason}
+}
+
+// FailureReasonOf returns the reason err was marked with, or one derived from
+// the errors it wraps.
+func FailureReasonOf(err error) FailureReason {
+	var marked *reasonError
+	switch {
+	case err == nil:
+		return FailureGeneral
+	case errors.As(err, &marked):
+		return marked.reason
+	case errors.IsAuthError(err):
+		return FailureAuth
+	case errors.Is(err, bolt.ErrInvalid), errors.Is(err, bolt.ErrChecksum), errors.Is(err, bolt.ErrVersionMismatch):
+		return FailureDBCorrupted
+	case errors.Is(err, bolt.ErrTimeout):
+		// Another mount holds the database lock
+		return FailureMountpointBusy
+	case errors.IsNetworkError(err):
+		return FailureNetwork
+	default:
+		return FailureGeneral
+	}
+}
+
+// ExitWithFailure prints err for the user, logs a final line with the failure
+// reason and exit code, and exits with that code.
+func ExitWithFailure(err error) {
+	reason := FailureReasonOf(err)
+	PrintUserFriendlyError(err)
+	logging.Error().
+		Err(err).
+		Str("reason", string(reason)).
+		Int("exitCode", reason.ExitCode()).
+		Msg("onemount exiting")
+	os.Exit(reason.ExitCode())
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/auriora/onemount/internal/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestUT_CMD_ExitCodes_ReasonFromError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want FailureReason
+	}{
+		{fmt.Errorf("boom"), FailureGeneral},
+		{WithFailureReason(fmt.Errorf("no fusermount3"), FailureFuseUnavailable), FailureFuseUnavailable},
+		{errors.Wrap(WithFailureReason(fmt.Errorf("in use"), FailureMountpointBusy), "mount failed"), FailureMountpointBusy},
+		{errors.NewAuthError("token rejected", nil), FailureAuth},
+		{errors.NewNetworkError("no route", nil), FailureNetwork},
+		{errors.Wrap(bolt.ErrInvalid, "could not open DB"), FailureDBCorrupted},
+		{errors.Wrap(bolt.ErrChecksum, "could not open DB"), FailureDBCorrupted},
+		{errors.Wrap(bolt.ErrTimeout, "could not open DB"), FailureMountpointBusy},
+	}
+	for _, test := range tests {
+		if got := FailureReasonOf(test.err); got != test.want {
+			t.Errorf("FailureReasonOf(%q) = %s, want %s", test.err, got, test.want)
+		}
+	}
+}
+
+func TestUT_CMD_ExitCodes_DistinctPerReason(t *testing.T) {
+	reasons := []FailureReason{FailureGeneral, FailureUsage, FailureConfigInvalid, FailureAuth,
+		FailureMountpointBusy, FailureDBCorrupted, FailureNetwork, FailureFuseUnavailable}
+	seen := make(map[int]FailureReason)
+	for _, reason := range reasons {
+		code := reason.ExitCode()
+		if other, ok := seen[code]; ok {
+			t.Errorf("%s and %s share exit code %d", reason, other, code)
+		}
+		seen[code] = reason
+	}
+	if WithFailureReason(nil, FailureAuth) != nil {
+		t.Errorf("expected a nil error to stay nil")
+	}
+}
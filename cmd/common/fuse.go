@@ -0,0 +1,102 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Rootless containers and Flatpak do not allow running the setuid fusermount3
+// helper. There, the process that sets up the sandbox opens /dev/fuse, mounts
+// it and hands us the descriptor, either with --fuse-fd or through systemd
+// socket activation; go-fuse serves such a descriptor when given the magic
+// mountpoint /dev/fd/N. Where a helper can run but is not fusermount3 (for
+// example a flatpak-spawn wrapper), it is configured with fusermount.
+
+// sdListenFDsStart is the first descriptor passed by systemd socket activation.
+const sdListenFDsStart = 3
+
+// FuseFDMountpoint returns the mountpoint go-fuse serves the pre-opened
+// /dev/fuse descriptor fd on.
+func FuseFDMountpoint(fd int) string {
+	return "/dev/fd/" + strconv.Itoa(fd)
+}
+
+// ActivatedFuseFD returns the /dev/fuse descriptor passed by systemd socket
+// activation, or 0. Of several descriptors, the one named "fuse" in
+// LISTEN_FDNAMES is used, or else the first. getenv is os.Getenv outside of
+// tests.
+func ActivatedFuseFD(getenv func(string) string, pid int) int {
+	if listenPID, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || listenPID != pid {
+		return 0
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return 0
+	}
+	for i, name := range strings.Split(getenv("LISTEN_FDNAMES"), ":") {
+		if name == "fuse" && i < count {
+			return sdListenFDsStart + i
+		}
+	}
+	return sdListenFDsStart
+}
+
+// CheckFuseFD reports whether fd is an open character device, as a /dev/fuse
+// descriptor must be.
+func CheckFuseFD(fd int) error {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("fuse descriptor %d is not open: %w", fd, err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFCHR {
+		return fmt.Errorf("fuse descriptor %d is not a device", fd)
+	}
+	return nil
+}
+
+// UseFusermount makes go-fuse mount and unmount with helper instead of
+// fusermount3. go-fuse looks the helper up in PATH, so dir is filled with
+// links to helper under the names go-fuse looks for and put in front of PATH.
+func UseFusermount(helper, dir string) error {
+	bin, err := exec.LookPath(helper)
+	if err != nil {
+		return fmt.Errorf("fusermount helper %q not found: %w", helper, err)
+	}
+	if bin, err = filepath.Abs(bin); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		link := filepath.Join(dir, name)
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Symlink(bin, link); err != nil {
+			return err
+		}
+	}
+	logging.Info().Str("helper", bin).Msg("Using alternative fusermount helper")
+	return os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// HasFusermount reports whether a fusermount helper can be found.
+func HasFusermount() bool {
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return true
+		}
+		if _, err := exec.LookPath(filepath.Join("/bin", name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
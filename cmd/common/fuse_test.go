@@ -0,0 +1,40 @@
+package common
+
+import (
+	"os"
+	"testing"
+)
+
+func TestUT_CMD_Fuse_ActivatedFuseFD(t *testing.T) {
+	cases := []struct {
+		name string
+		env  map[string]string
+		want int
+	}{
+		{"not activated", map[string]string{}, 0},
+		{"other process", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}, 0},
+		{"single descriptor", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "1"}, 3},
+		{"named descriptor", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "control:fuse"}, 4},
+		{"no descriptors", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "0"}, 0},
+	}
+	for _, tc := range cases {
+		getenv := func(key string) string { return tc.env[key] }
+		if got := ActivatedFuseFD(getenv, 42); got != tc.want {
+			t.Errorf("%s: ActivatedFuseFD() = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUT_CMD_Fuse_CheckFuseFDRejectsRegularFiles(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "not-fuse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := CheckFuseFD(int(file.Fd())); err == nil {
+		t.Fatalf("expected a regular file to be rejected")
+	}
+	if err := CheckFuseFD(1 << 20); err == nil {
+		t.Fatalf("expected a closed descriptor to be rejected")
+	}
+}
@@ -0,0 +1,130 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A mount whose cache lives inside the mountpoint, or the other way around,
+// reads and writes its own cache through FUSE: every download lands in the
+// mount, which changes the mount and makes it download again, until the cache
+// is corrupted. A mountpoint inside another OneMount mount or a cache inside
+// one feeds one mount through the other in the same way. Both the CLI and the
+// launcher refuse such layouts before anything is created.
+
+// MountsFile lists the mounts of the process.
+const MountsFile = "/proc/self/mounts"
+
+// ReadMounts returns the content of MountsFile, or "" when it cannot be read.
+func ReadMounts() string {
+	data, err := os.ReadFile(MountsFile)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// OneMountMountFor returns the OneMount mountpoint in the /proc/self/mounts
+// content mounts that contains path, or "" if there is none.
+func OneMountMountFor(mounts, path string) string {
+	best := ""
+	for _, line := range strings.Split(mounts, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[2] != "fuse.onemount" {
+			continue
+		}
+		mountpoint := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\134`, `\`).Replace(fields[1])
+		if !pathWithin(path, mountpoint) {
+			continue
+		}
+		if len(mountpoint) > len(best) {
+			best = mountpoint
+		}
+	}
+	return best
+}
+
+// CheckMountLayout returns an error when mounting mountpoint with its cache
+// in cacheDir would feed the mount into itself: the cache directory inside
+// the mountpoint or the mountpoint inside the cache directory, or either of
+// them inside a OneMount mount listed in mounts, the content of
+// /proc/self/mounts. The mountpoint itself may already be mounted.
+func CheckMountLayout(mountpoint, cacheDir, mounts string) error {
+	mountpoint, cacheDir = absPath(mountpoint), absPath(cacheDir)
+	if err := checkMountLayout(mountpoint, cacheDir, mounts); err != nil {
+		return err
+	}
+	// Symbolic links can hide the same problems. The mountpoint itself is
+	// left alone: looking at a mount nobody serves yet would hang.
+	resolvedMountpoint := filepath.Join(resolvePath(filepath.Dir(mountpoint)), filepath.Base(mountpoint))
+	return checkMountLayout(resolvedMountpoint, resolvePath(cacheDir), mounts)
+}
+
+// CheckCacheLocation returns an error when cacheDir is inside a OneMount
+// mount listed in mounts.
+func CheckCacheLocation(cacheDir, mounts string) error {
+	cacheDir = absPath(cacheDir)
+	if err := checkCacheLocation(cacheDir, mounts); err != nil {
+		return err
+	}
+	return checkCacheLocation(resolvePath(cacheDir), mounts)
+}
+
+func checkMountLayout(mountpoint, cacheDir, mounts string) error {
+	switch {
+	case pathWithin(cacheDir, mountpoint):
+		return fmt.Errorf("the cache directory %s is inside the mountpoint %s, "+
+			"choose a cache directory outside of it", cacheDir, mountpoint)
+	case pathWithin(mountpoint, cacheDir):
+		return fmt.Errorf("the mountpoint %s is inside the cache directory %s, "+
+			"choose a mountpoint outside of it", mountpoint, cacheDir)
+	}
+	if err := checkCacheLocation(cacheDir, mounts); err != nil {
+		return err
+	}
+	if other := OneMountMountFor(mounts, filepath.Dir(mountpoint)); other != "" && mountpoint != "/" {
+		return fmt.Errorf("the mountpoint %s is inside the OneMount mount %s, "+
+			"choose a mountpoint outside of it", mountpoint, other)
+	}
+	return nil
+}
+
+func checkCacheLocation(cacheDir, mounts string) error {
+	if other := OneMountMountFor(mounts, cacheDir); other != "" {
+		return fmt.Errorf("the cache directory %s is inside the OneMount mount %s, "+
+			"choose a cache directory outside of it", cacheDir, other)
+	}
+	return nil
+}
+
+// pathWithin reports whether path is dir or below it. Both are clean and
+// absolute.
+func pathWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// absPath returns path absolute and clean, or clean when the working
+// directory is unknown.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// resolvePath resolves the symbolic links in the part of the absolute path
+// that exists and keeps the rest as it is.
+func resolvePath(path string) string {
+	rest := ""
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if dir == filepath.Dir(dir) {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUT_CMD_MountLayout_OneMountMountForPicksContainingMount(t *testing.T) {
+	mounts := strings.Join([]string{
+		"/dev/sda1 / ext4 rw 0 0",
+		"onemount /home/u/OneDrive fuse.onemount rw 0 0",
+		"onemount /home/u/OneDrive\\040Work fuse.onemount rw 0 0",
+		"tmpfs /home/u/OneDrive/tmp tmpfs rw 0 0",
+	}, "\n")
+
+	cases := map[string]string{
+		"/home/u/OneDrive":              "/home/u/OneDrive",
+		"/home/u/OneDrive/Documents":    "/home/u/OneDrive",
+		"/home/u/OneDrive Work/Reports": "/home/u/OneDrive Work",
+		"/home/u/OneDriveX":             "",
+		"/home/u":                       "",
+	}
+	for path, want := range cases {
+		if got := OneMountMountFor(mounts, path); got != want {
+			t.Errorf("OneMountMountFor(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestUT_CMD_MountLayout_RefusesLayoutsFeedingTheMountIntoItself(t *testing.T) {
+	mounts := "onemount /home/u/OneDrive fuse.onemount rw 0 0\n"
+
+	refused := map[string][2]string{
+		"cache inside the mountpoint":         {"/home/u/Work", "/home/u/Work/.cache"},
+		"cache is the mountpoint":             {"/home/u/Work", "/home/u/Work"},
+		"mountpoint inside the cache":         {"/home/u/.cache/onemount/Work", "/home/u/.cache/onemount"},
+		"mountpoint inside another mount":     {"/home/u/OneDrive/Work", "/home/u/.cache/onemount"},
+		"cache inside another mount":          {"/home/u/Work", "/home/u/OneDrive/.cache"},
+		"relative path inside the mountpoint": {"/home/u/Work", "/home/u/Work/../Work/cache"},
+	}
+	for name, layout := range refused {
+		if err := CheckMountLayout(layout[0], layout[1], mounts); err == nil {
+			t.Errorf("%s: expected mountpoint %s with cache %s to be refused", name, layout[0], layout[1])
+		}
+	}
+
+	allowed := [][2]string{
+		{"/home/u/Work", "/home/u/.cache/onemount"},
+		{"/home/u/WorkDrive", "/home/u/Work"},
+		// Remounting the mountpoint itself, e.g. with a FUSE descriptor
+		{"/home/u/OneDrive", "/home/u/.cache/onemount"},
+	}
+	for _, layout := range allowed {
+		if err := CheckMountLayout(layout[0], layout[1], mounts); err != nil {
+			t.Errorf("mountpoint %s with cache %s refused: %v", layout[0], layout[1], err)
+		}
+	}
+}
+
+func TestUT_CMD_MountLayout_FollowsSymbolicLinks(t *testing.T) {
+	dir := t.TempDir()
+	mountpoint := filepath.Join(dir, "OneDrive")
+	if err := os.Mkdir(mountpoint, 0700); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "cache")
+	if err := os.Symlink(mountpoint, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckMountLayout(mountpoint, filepath.Join(link, "onemount"), ""); err == nil {
+		t.Fatalf("expected a cache linked into the mountpoint to be refused")
+	}
+	if err := CheckCacheLocation(filepath.Join(link, "onemount"), "onemount "+mountpoint+" fuse.onemount rw 0 0"); err == nil {
+		t.Fatalf("expected a cache linked into a mount to be refused")
+	}
+}
@@ -0,0 +1,85 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/auriora/onemount/internal/fs"
+)
+
+// A folder shared from another user's drive can be mounted read-only with
+// --share-url. Its cache lives in the mountpoint's cache directory like any
+// other mount, and share.json in that directory records which shared folder
+// the cache holds, so a mountpoint that held one drive is never reused for
+// another: the cached metadata and content would belong to the wrong items.
+
+// shareMarkerName is the file recording the shared folder a cache holds.
+const shareMarkerName = "share.json"
+
+// SharedFolder identifies the shared folder a mount serves.
+type SharedFolder struct {
+	URL     string `json:"url"`
+	DriveID string `json:"driveId"`
+	ItemID  string `json:"itemId"`
+	Name    string `json:"name"`
+}
+
+// ReadSharedFolder returns the shared folder the cache in cacheDir holds, or
+// nil when it holds the user's own drive or nothing yet.
+func ReadSharedFolder(cacheDir string) (*SharedFolder, error) {
+	data, err := os.ReadFile(filepath.Join(cacheDir, shareMarkerName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	share := &SharedFolder{}
+	if err := json.Unmarshal(data, share); err != nil {
+		return nil, fmt.Errorf("unreadable %s in %s: %w", shareMarkerName, cacheDir, err)
+	}
+	return share, nil
+}
+
+// CacheExists reports whether cacheDir holds the metadata of an earlier mount.
+func CacheExists(cacheDir string) bool {
+	for _, name := range []string{"onemount.db", fs.MetadataSnapshotName} {
+		if _, err := os.Stat(filepath.Join(cacheDir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimCacheNamespace checks that the cache in cacheDir may serve share, or
+// the user's own drive when share is nil, and records a shared folder for
+// later mounts. A cache that held another drive or shared folder is refused.
+func ClaimCacheNamespace(cacheDir string, share *SharedFolder) error {
+	held, err := ReadSharedFolder(cacheDir)
+	if err != nil {
+		return err
+	}
+	ownDriveCached := held == nil && CacheExists(cacheDir)
+
+	switch {
+	case share == nil && held != nil:
+		return fmt.Errorf("the cache in %s holds the shared folder %q; "+
+			"mount your drive at another mountpoint or remove the cache with --wipe-cache", cacheDir, held.Name)
+	case share == nil:
+		return nil
+	case ownDriveCached:
+		return fmt.Errorf("the cache in %s holds your own drive; "+
+			"mount the shared folder at another mountpoint", cacheDir)
+	case held != nil && (held.DriveID != share.DriveID || held.ItemID != share.ItemID):
+		return fmt.Errorf("the cache in %s holds the shared folder %q; "+
+			"mount %q at another mountpoint", cacheDir, held.Name, share.Name)
+	}
+
+	data, err := json.MarshalIndent(share, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cacheDir, shareMarkerName), data, 0600)
+}
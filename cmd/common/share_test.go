@@ -0,0 +1,73 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUT_CMD_Share_CacheNamespaceIsClaimedOnce(t *testing.T) {
+	dir := t.TempDir()
+	datasets := &SharedFolder{URL: "https://1drv.ms/f/s!a", DriveID: "drive-a", ItemID: "folder-1", Name: "Datasets"}
+
+	if err := ClaimCacheNamespace(dir, datasets); err != nil {
+		t.Fatalf("claiming an empty cache failed: %v", err)
+	}
+	if err := ClaimCacheNamespace(dir, datasets); err != nil {
+		t.Fatalf("remounting the same share failed: %v", err)
+	}
+	held, err := ReadSharedFolder(dir)
+	if err != nil || held == nil || *held != *datasets {
+		t.Fatalf("expected the cache to record %v, got %v (%v)", datasets, held, err)
+	}
+
+	other := &SharedFolder{DriveID: "drive-b", ItemID: "folder-2", Name: "Photos"}
+	if err := ClaimCacheNamespace(dir, other); err == nil {
+		t.Fatalf("expected another share to be refused")
+	}
+	if err := ClaimCacheNamespace(dir, nil); err == nil {
+		t.Fatalf("expected the own drive to be refused in a share's cache")
+	}
+}
+
+func TestUT_CMD_Share_OwnDriveCacheIsNotReused(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "onemount.db"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ClaimCacheNamespace(dir, nil); err != nil {
+		t.Fatalf("own drive refused in its own cache: %v", err)
+	}
+	share := &SharedFolder{DriveID: "drive-a", ItemID: "folder-1", Name: "Datasets"}
+	if err := ClaimCacheNamespace(dir, share); err == nil {
+		t.Fatalf("expected a share to be refused in the own drive's cache")
+	}
+	if held, _ := ReadSharedFolder(dir); held != nil {
+		t.Fatalf("refused share was recorded: %v", held)
+	}
+}
+
+func TestUT_CMD_Share_InMemoryOwnDriveCacheIsNotReused(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "metadata-snapshot.json"), []byte("[]"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	share := &SharedFolder{DriveID: "drive-a", ItemID: "folder-1", Name: "Datasets"}
+	if err := ClaimCacheNamespace(dir, share); err == nil {
+		t.Fatalf("expected a share to be refused in a cache whose metadata is kept in memory")
+	}
+}
+
+func TestUT_CMD_Share_CacheExists(t *testing.T) {
+	dir := t.TempDir()
+	if CacheExists(dir) {
+		t.Fatalf("empty directory reported as a cache")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "onemount.db"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !CacheExists(dir) {
+		t.Fatalf("cache with a metadata database not found")
+	}
+}
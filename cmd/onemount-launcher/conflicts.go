@@ -0,0 +1,257 @@
+//go:build linux && cgo
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/fs"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/ui"
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// maxConflictPreviewRead bounds how much of each version is read for the diff
+// preview; larger files are not previewed anyway.
+const maxConflictPreviewRead = 1 << 20
+
+// Dialog responses for the conflict choices.
+const (
+	responseKeepLocal  gtk.ResponseType = 1
+	responseKeepRemote gtk.ResponseType = 2
+	responseKeepBoth   gtk.ResponseType = 3
+)
+
+// conflictView holds everything shown in a conflict dialog. It is loaded off
+// the GTK main thread because fetching the remote version downloads it.
+type conflictView struct {
+	sender          string // unique D-Bus name of the reporting mount
+	path            string
+	message         string
+	localSize       uint64
+	localModTime    int64
+	remoteSize      uint64
+	remoteModTime   int64
+	remoteAvailable bool
+	remoteAuthor    string
+	peerPath        string // conflict copy paired with the item
+	preview         string
+	hasPreview      bool
+}
+
+// watchConflicts shows a conflict dialog whenever a mounted filesystem emits
+// the ConflictDetected D-Bus signal.
+func watchConflicts(parent gtk.IWindow) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		logging.Warn().Err(err).Msg("Could not connect to the session bus, conflicts will not be shown.")
+		return
+	}
+	err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(fs.DBusObjectPath),
+		dbus.WithMatchInterface(fs.DBusInterface),
+		dbus.WithMatchMember("ConflictDetected"),
+	)
+	if err != nil {
+		logging.Warn().Err(err).Msg("Could not subscribe to conflict signals.")
+		conn.Close()
+		return
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	go func() {
+		// Only one dialog per conflict; repeated signals for an open dialog are dropped.
+		var mu sync.Mutex
+		open := make(map[string]bool)
+		for sig := range signals {
+			if sig.Name != fs.DBusInterface+".ConflictDetected" || len(sig.Body) < 2 {
+				continue
+			}
+			path, _ := sig.Body[0].(string)
+			message, _ := sig.Body[1].(string)
+			key := sig.Sender + path
+			mu.Lock()
+			shown := open[key]
+			open[key] = true
+			mu.Unlock()
+			if shown {
+				continue
+			}
+			view, err := loadConflict(conn, sig.Sender, path, message)
+			if err != nil {
+				logging.Warn().Err(err).Str("path", path).Msg("Could not load conflict details.")
+				mu.Lock()
+				delete(open, key)
+				mu.Unlock()
+				continue
+			}
+			glib.IdleAdd(func() bool {
+				showConflictDialog(conn, view, parent)
+				mu.Lock()
+				delete(open, key)
+				mu.Unlock()
+				return false
+			})
+		}
+	}()
+}
+
+// loadConflict reads the details and both versions of a conflicted file from
+// the mount that reported it.
+func loadConflict(conn *dbus.Conn, sender, path, message string) (*conflictView, error) {
+	obj := conn.Object(sender, fs.DBusObjectPath)
+	view := &conflictView{sender: sender, path: path}
+	err := obj.Call(fs.DBusInterface+".GetConflictDetails", 0, path).Store(
+		&view.message, &view.localSize, &view.localModTime,
+		&view.remoteSize, &view.remoteModTime, &view.remoteAvailable)
+	if err != nil {
+		return nil, err
+	}
+	if view.message == "" {
+		view.message = message
+	}
+	if err := obj.Call(fs.DBusInterface+".GetConflictPeer", 0, path).Store(&view.peerPath, &view.remoteAuthor); err != nil {
+		logging.Debug().Err(err).Str("path", path).Msg("Conflict pairing unavailable.")
+	}
+
+	var localPath, remotePath string
+	if err := obj.Call(fs.DBusInterface+".GetConflictContent", 0, path).Store(&localPath, &remotePath); err != nil {
+		logging.Debug().Err(err).Str("path", path).Msg("Conflict content unavailable, showing no preview.")
+		return view, nil
+	}
+	if localPath != "" && remotePath != "" {
+		local, localErr := readPreview(localPath)
+		remote, remoteErr := readPreview(remotePath)
+		if localErr == nil && remoteErr == nil {
+			view.preview, view.hasPreview = ui.ConflictPreview(local, remote)
+		}
+	}
+	return view, nil
+}
+
+func readPreview(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, maxConflictPreviewRead))
+}
+
+// describeVersion formats the size and modification time of one version.
+func describeVersion(size uint64, modTime int64) string {
+	if modTime == 0 {
+		return fs.FormatSize(int64(size))
+	}
+	return fmt.Sprintf("%s, modified %s", fs.FormatSize(int64(size)),
+		time.Unix(modTime, 0).Format("2006-01-02 15:04:05"))
+}
+
+// showConflictDialog asks the user how to resolve a conflict and reports the
+// choice to the mount. It must run on the GTK main thread.
+func showConflictDialog(conn *dbus.Conn, view *conflictView, parent gtk.IWindow) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		logging.Error().Err(err).Msg("Could not create conflict dialog.")
+		return
+	}
+	defer dialog.Destroy()
+	dialog.SetTitle("Sync Conflict")
+	dialog.SetTransientFor(parent)
+	dialog.SetDefaultSize(640, 480)
+	dialog.AddButton("Decide Later", gtk.RESPONSE_CANCEL)
+	dialog.AddButton("Keep Both", responseKeepBoth)
+	dialog.AddButton("Keep Remote", responseKeepRemote)
+	dialog.AddButton("Keep Local", responseKeepLocal)
+	if !view.remoteAvailable {
+		dialog.SetResponseSensitive(responseKeepRemote, false)
+		dialog.SetResponseSensitive(responseKeepBoth, false)
+	}
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(8)
+	content.SetBorderWidth(12)
+
+	title, _ := gtk.LabelNew("")
+	title.SetMarkup(fmt.Sprintf("<b>%s</b>\n%s",
+		html.EscapeString(view.path), html.EscapeString(view.message)))
+	title.SetXAlign(0)
+	title.SetLineWrap(true)
+	content.PackStart(title, false, false, 0)
+
+	versions, _ := gtk.GridNew()
+	versions.SetColumnSpacing(12)
+	versions.SetRowSpacing(4)
+	remote := "unavailable"
+	if view.remoteAvailable {
+		remote = describeVersion(view.remoteSize, view.remoteModTime)
+		if view.remoteAuthor != "" {
+			remote += " by " + view.remoteAuthor
+		}
+	}
+	rows := [][2]string{
+		{"Local version:", describeVersion(view.localSize, view.localModTime)},
+		{"Remote version:", remote},
+	}
+	if view.peerPath != "" {
+		rows = append(rows, [2]string{"Conflict copy:", view.peerPath})
+	}
+	for row, version := range rows {
+		name, _ := gtk.LabelNew(version[0])
+		name.SetXAlign(0)
+		value, _ := gtk.LabelNew(version[1])
+		value.SetXAlign(0)
+		versions.Attach(name, 0, row, 1, 1)
+		versions.Attach(value, 1, row, 1, 1)
+	}
+	content.PackStart(versions, false, false, 0)
+
+	if view.hasPreview {
+		legend, _ := gtk.LabelNew("Differences (- local, + remote):")
+		legend.SetXAlign(0)
+		content.PackStart(legend, false, false, 0)
+
+		text, _ := gtk.TextViewNew()
+		text.SetEditable(false)
+		text.SetMonospace(true)
+		buffer, _ := text.GetBuffer()
+		buffer.SetText(view.preview)
+		scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+		scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+		scroll.Add(text)
+		content.PackStart(scroll, true, true, 0)
+	} else {
+		none, _ := gtk.LabelNew("No preview is available for this file.")
+		none.SetXAlign(0)
+		content.PackStart(none, false, false, 0)
+	}
+
+	dialog.ShowAll()
+	var choice string
+	switch dialog.Run() {
+	case responseKeepLocal:
+		choice = fs.ConflictKeepLocal
+	case responseKeepRemote:
+		choice = fs.ConflictKeepRemote
+	case responseKeepBoth:
+		choice = fs.ConflictKeepBoth
+	default:
+		return
+	}
+
+	call := conn.Object(view.sender, fs.DBusObjectPath).Call(fs.DBusInterface+".ResolveConflict", 0, view.path, choice)
+	if call.Err != nil {
+		logging.Error().Err(call.Err).Str("path", view.path).Str("choice", choice).Msg("Could not resolve conflict.")
+		ui.Dialog("Could not resolve the conflict: "+call.Err.Error(), gtk.MESSAGE_ERROR, parent)
+		return
+	}
+	logging.Info().Str("path", view.path).Str("choice", choice).Msg("Resolved conflict.")
+}
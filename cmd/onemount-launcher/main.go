@@ -15,6 +15,7 @@ import (
 	"unsafe"
 
 	"github.com/auriora/onemount/cmd/common"
+	"github.com/auriora/onemount/internal/fs"
 	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/logging"
 	"github.com/auriora/onemount/internal/ui"
@@ -203,6 +204,11 @@ func activateCallback(app *gtk.Application, config *common.Config, configPath st
 			}
 			return
 		}
+		if err := common.CheckMountLayout(mount, config.CacheDir, common.ReadMounts()); err != nil {
+			logging.Error().Err(err).Str("mountpoint", mount).Msg("Mountpoint would feed the mount into itself.")
+			ui.Dialog("Mountpoint was not valid, "+err.Error()+".", gtk.MESSAGE_ERROR, window)
+			return
+		}
 
 		escapedMount := unit.UnitNamePathEscape(mount)
 		systemdUnit := systemd.TemplateUnit(systemd.OneMountServiceTemplate, escapedMount)
@@ -216,7 +222,7 @@ func activateCallback(app *gtk.Application, config *common.Config, configPath st
 			return
 		}
 
-		row, sw := newMountRow(*config, mount)
+		row, sw := newMountRow(config, configPath, mount)
 		switches[mount] = sw
 		listbox.Insert(row, -1)
 
@@ -241,6 +247,14 @@ func activateCallback(app *gtk.Application, config *common.Config, configPath st
 	})
 	popoverBox.PackStart(settings, false, true, 0)
 
+	// combined health of all mounts
+	status, _ := gtk.ModelButtonNew()
+	status.SetLabel("Status")
+	status.Connect("clicked", func(button *gtk.ModelButton) {
+		newStatusWindow(config.CacheDir, window)
+	})
+	popoverBox.PackStart(status, false, true, 0)
+
 	// print version and link to repo
 	about, _ := gtk.ModelButtonNew()
 	about.SetLabel("About")
@@ -279,7 +293,7 @@ func activateCallback(app *gtk.Application, config *common.Config, configPath st
 
 		logging.Info().Str("mount", mount).Msg("Found existing mount.")
 
-		row, sw := newMountRow(*config, mount)
+		row, sw := newMountRow(config, configPath, mount)
 		switches[mount] = sw
 		listbox.Insert(row, -1)
 	}
@@ -312,6 +326,8 @@ func activateCallback(app *gtk.Application, config *common.Config, configPath st
 		go xdgOpenDir(mount)
 	})
 
+	watchConflicts(window)
+
 	window.ShowAll()
 }
 
@@ -332,7 +348,7 @@ func xdgOpenDir(mount string) {
 
 // newMountRow constructs a new ListBoxRow with the controls for an individual mountpoint.
 // mount is the path to the new mountpoint.
-func newMountRow(config common.Config, mount string) (*gtk.ListBoxRow, *gtk.Switch) {
+func newMountRow(config *common.Config, configPath, mount string) (*gtk.ListBoxRow, *gtk.Switch) {
 	row, _ := gtk.ListBoxRowNew()
 	row.SetSelectable(true)
 	box, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
@@ -485,6 +501,10 @@ func newMountRow(config common.Config, mount string) (*gtk.ListBoxRow, *gtk.Swit
 	separator, _ := gtk.SeparatorMenuItemNew()
 	popoverBox.Add(separator)
 
+	popoverBox.Add(newMountSettingsBox(config, configPath, mount, unitName))
+	settingsSeparator, _ := gtk.SeparatorMenuItemNew()
+	popoverBox.Add(settingsSeparator)
+
 	// create a button to enable/disable the mountpoint
 	unitEnabledBtn, _ := gtk.CheckButtonNewWithLabel("Start Drive on Login")
 	unitEnabledBtn.SetTooltipText("Start this drive automatically when you login")
@@ -648,6 +668,21 @@ func newSettingsDialog(config *common.Config, configPath string, parent gtk.IWin
 		oldPath, _ := button.GetLabel()
 		oldPath = ui.UnescapeHome(oldPath)
 		path := ui.DirChooser("Select an empty directory to use for storage")
+		if path == "" {
+			return
+		}
+		mounts := common.ReadMounts()
+		layoutErr := common.CheckCacheLocation(path, mounts)
+		for _, mount := range ui.GetKnownMounts(oldPath) {
+			if layoutErr == nil {
+				layoutErr = common.CheckMountLayout(unit.UnitNamePathUnescape(mount), path, mounts)
+			}
+		}
+		if layoutErr != nil {
+			logging.Error().Err(layoutErr).Str("newPath", path).Msg("Cache directory would feed a mount into itself.")
+			ui.Dialog("Cache directory was not valid, "+layoutErr.Error()+".", gtk.MESSAGE_ERROR, settingsDialog)
+			return
+		}
 		if !ui.CancelDialog(settingsDialog, "Remount all drives?", "") {
 			return
 		}
@@ -680,7 +715,8 @@ func newSettingsDialog(config *common.Config, configPath string, parent gtk.IWin
 				return
 			}
 
-			err = os.Rename(filepath.Join(oldPath, mount), filepath.Join(path, mount))
+			// Moves the directory and fixes its database up for the new location
+			report, err := fs.RelocateCache(filepath.Join(oldPath, mount), filepath.Join(path, mount))
 			if err != nil {
 				ui.Dialog("Could not move cache for mount: "+err.Error(),
 					gtk.MESSAGE_ERROR, settingsDialog)
@@ -691,8 +727,27 @@ func newSettingsDialog(config *common.Config, configPath string, parent gtk.IWin
 					Msg("Could not move cache for mount.")
 				return
 			}
+			if len(report.LostChanges) > 0 {
+				ui.Dialog(fmt.Sprintf("%d file(s) with changes not uploaded yet were missing from the cache of %s "+
+					"and could not be moved.", len(report.LostChanges), unit.UnitNamePathUnescape(mount)),
+					gtk.MESSAGE_WARNING, settingsDialog)
+			}
+		}
+		if _, err := os.Stat(fs.SharedContentRoot(oldPath)); err == nil {
+			if _, err := fs.RelocateCache(fs.SharedContentRoot(oldPath), fs.SharedContentRoot(path)); err != nil {
+				logging.Error().Err(err).Msg("Could not move shared file content, it is downloaded again.")
+			}
 		}
 
+		// Drives must find the new location when they start again
+		config.CacheDir = path
+		err := config.WriteConfig(configPath)
+		if err != nil {
+			logging.Error().Err(err).Msg("Failed to write config.")
+			return
+		}
+		button.SetLabel(path)
+
 		// remount drives that were mounted before
 		for _, unitName := range isMounted {
 			err := systemd.UnitSetActive(unitName, true)
@@ -703,15 +758,6 @@ func newSettingsDialog(config *common.Config, configPath string, parent gtk.IWin
 					Msg("Failed to restart unit.")
 			}
 		}
-
-		// all done
-		config.CacheDir = path
-		err := config.WriteConfig(configPath)
-		if err != nil {
-			logging.Error().Err(err).Msg("Failed to write config.")
-			return
-		}
-		button.SetLabel(path)
 	})
 	settingsRowCacheDir.PackEnd(cacheDirPicker, false, false, 0)
 
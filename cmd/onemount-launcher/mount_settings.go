@@ -0,0 +1,129 @@
+//go:build linux && cgo
+
+package main
+
+import (
+	"github.com/auriora/onemount/cmd/common"
+	"github.com/auriora/onemount/internal/fs"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/ui/systemd"
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// overlayPolicyLabels are the overlay policies offered per mount.
+var overlayPolicyLabels = []struct{ policy, label string }{
+	{"REMOTE_WINS", "OneDrive changes win"},
+	{"LOCAL_WINS", "Local changes win"},
+	{"MERGED", "Merge changes"},
+}
+
+// newMountSettingsBox constructs the advanced settings of a mountpoint for its
+// settings popover. Changes are written to the mountpoint's section of the
+// configuration file, and a running mount is asked to reload them.
+func newMountSettingsBox(config *common.Config, configPath, mount, unitName string) *gtk.Box {
+	settings := config.ForMount(mount)
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 5)
+
+	save := func(setting string, change func(*common.MountConfig)) {
+		if config.Mounts == nil {
+			config.Mounts = make(map[string]common.MountConfig)
+		}
+		mountConfig := config.Mounts[mount]
+		change(&mountConfig)
+		config.Mounts[mount] = mountConfig
+		ctx := logging.DefaultLogger.With().
+			Str("mount", mount).
+			Str("setting", setting).
+			Logger()
+		if err := config.WriteConfig(configPath); err != nil {
+			ctx.Error().Err(err).Msg("Could not write config.")
+			return
+		}
+		ctx.Info().Msg("Mount setting changed.")
+		go reloadMountSettings(mount, unitName)
+	}
+
+	deltaInterval := newSettingsSpinButton(box, "Check for changes (minutes)",
+		"How often OneDrive is asked for changes when realtime notifications are off",
+		1, 1440, float64(settings.DeltaInterval)/60)
+	deltaInterval.Connect("value-changed", func(spin *gtk.SpinButton) {
+		seconds := spin.GetValueAsInt() * 60
+		save("deltaInterval", func(m *common.MountConfig) { m.DeltaInterval = &seconds })
+	})
+
+	cacheExpiration := newSettingsSpinButton(box, "Keep unused files (days)",
+		"Downloaded files not used for this many days are removed from the cache, 0 keeps them",
+		0, 3650, float64(settings.CacheExpiration))
+	cacheExpiration.Connect("value-changed", func(spin *gtk.SpinButton) {
+		days := spin.GetValueAsInt()
+		save("cacheExpiration", func(m *common.MountConfig) { m.CacheExpiration = &days })
+	})
+
+	bandwidth := newSettingsSpinButton(box, "Bandwidth limit (Mbps)",
+		"Uploads and downloads together stay below this rate, 0 for no limit",
+		0, 10000, float64(settings.MaxBandwidthMbps))
+	bandwidth.Connect("value-changed", func(spin *gtk.SpinButton) {
+		mbps := spin.GetValueAsInt()
+		save("maxBandwidthMbps", func(m *common.MountConfig) { m.MaxBandwidthMbps = &mbps })
+	})
+
+	overlayRow, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	overlayLabel, _ := gtk.LabelNew("Conflicting changes")
+	overlayRow.PackStart(overlayLabel, false, false, 0)
+	overlaySelector, _ := gtk.ComboBoxTextNew()
+	overlaySelector.SetTooltipText("Which version new files keep when they change on both sides")
+	for _, entry := range overlayPolicyLabels {
+		overlaySelector.Append(entry.policy, entry.label)
+	}
+	overlaySelector.SetActiveID(settings.Overlay.DefaultPolicy)
+	overlaySelector.Connect("changed", func(selector *gtk.ComboBoxText) {
+		policy := selector.GetActiveID()
+		save("overlayPolicy", func(m *common.MountConfig) { m.OverlayPolicy = &policy })
+	})
+	overlayRow.PackEnd(overlaySelector, false, false, 0)
+	box.PackStart(overlayRow, false, true, 0)
+
+	syncTree, _ := gtk.CheckButtonNewWithLabel("Sync Folder Tree")
+	syncTree.SetTooltipText("List all folders in the background when the drive starts, so browsing is fast offline")
+	syncTree.SetActive(settings.SyncTree)
+	syncTree.Connect("toggled", func(button *gtk.CheckButton) {
+		enabled := button.GetActive()
+		save("syncTree", func(m *common.MountConfig) { m.SyncTree = &enabled })
+	})
+	box.PackStart(syncTree, false, true, 0)
+
+	return box
+}
+
+// newSettingsSpinButton adds a labelled number setting to box.
+func newSettingsSpinButton(box *gtk.Box, label, tooltip string, min, max, value float64) *gtk.SpinButton {
+	row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	rowLabel, _ := gtk.LabelNew(label)
+	row.PackStart(rowLabel, false, false, 0)
+	spin, _ := gtk.SpinButtonNewWithRange(min, max, 1)
+	spin.SetValue(value)
+	spin.SetTooltipText(tooltip)
+	row.PackEnd(spin, false, false, 0)
+	box.PackStart(row, false, true, 0)
+	return spin
+}
+
+// reloadMountSettings asks a running mount to reload its settings from the
+// configuration file. Stopped mounts read them when they start.
+func reloadMountSettings(mount, unitName string) {
+	if active, _ := systemd.UnitIsActive(unitName); !active {
+		return
+	}
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		logging.Warn().Err(err).Str("mount", mount).Msg("Could not connect to the session bus to reload mount settings.")
+		return
+	}
+	defer conn.Close()
+	err = conn.Object(fs.DBusServiceNameForMount(mount), fs.DBusObjectPath).
+		Call(fs.DBusInterface+".ReloadSettings", 0).Err
+	if err != nil {
+		logging.Warn().Err(err).Str("mount", mount).Msg("Mount did not reload its settings, they apply when it restarts.")
+	}
+}
@@ -0,0 +1,191 @@
+//go:build linux && cgo
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/auriora/onemount/internal/fs"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/ui"
+	"github.com/auriora/onemount/internal/ui/systemd"
+	"github.com/coreos/go-systemd/v22/unit"
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// statusRefreshInterval is how often the status window reloads the mounts.
+const statusRefreshInterval = 5
+
+// loadMountStatuses gathers the status of every known mount. It talks to the
+// mounts over D-Bus, so it runs off the GTK main thread.
+func loadMountStatuses(conn *dbus.Conn, cacheDir string) []ui.MountStatus {
+	var statuses []ui.MountStatus
+	for _, escaped := range ui.GetKnownMounts(cacheDir) {
+		mount := unit.UnitNamePathUnescape(escaped)
+		status := ui.MountStatus{Mountpoint: mount}
+		status.Account, _ = graph.GetAccountName(cacheDir, escaped)
+		unitName := systemd.TemplateUnit(systemd.OneMountServiceTemplate, escaped)
+		status.Running, _ = systemd.UnitIsActive(unitName)
+		if status.Running {
+			if conn != nil {
+				status.Stats, status.Err = ui.LoadMountStats(conn, mount)
+			}
+			status.QuotaTotal, status.QuotaUsed, _ = ui.MountQuota(mount)
+		}
+		if status.Err != nil {
+			logging.Debug().Err(status.Err).Str("mount", mount).Msg("Could not read mount statistics.")
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// describeQuota formats how much of a drive is used.
+func describeQuota(usage ui.AccountUsage) string {
+	if usage.QuotaTotal == 0 {
+		return "unknown (no mount running)"
+	}
+	return fmt.Sprintf("%s of %s (%.0f%%)",
+		fs.FormatSize(int64(usage.QuotaUsed)), fs.FormatSize(int64(usage.QuotaTotal)),
+		100*float64(usage.QuotaUsed)/float64(usage.QuotaTotal))
+}
+
+// newStatusWindow shows the combined status of all mounts and keeps it up to
+// date while the window is open.
+func newStatusWindow(cacheDir string, parent gtk.IWindow) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		logging.Error().Err(err).Msg("Could not create status window.")
+		return
+	}
+	dialog.SetTitle("Status")
+	dialog.SetTransientFor(parent)
+	dialog.SetDefaultSize(420, 0)
+	dialog.AddButton("Close", gtk.RESPONSE_CLOSE)
+	dialog.Connect("response", dialog.Destroy)
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(8)
+	content.SetBorderWidth(12)
+
+	newGrid := func() *gtk.Grid {
+		grid, _ := gtk.GridNew()
+		grid.SetColumnSpacing(12)
+		grid.SetRowSpacing(4)
+		return grid
+	}
+	heading := func(text string) {
+		label, _ := gtk.LabelNew("")
+		label.SetMarkup("<b>" + text + "</b>")
+		label.SetXAlign(0)
+		content.PackStart(label, false, false, 0)
+	}
+
+	heading("All Mounts")
+	totals := newGrid()
+	totalNames := []string{"Mounts:", "Offline:", "Cached:", "Pending uploads:", "Conflicts:", "OneDrive service:"}
+	totalValues := make([]*gtk.Label, len(totalNames))
+	for row, name := range totalNames {
+		nameLabel, _ := gtk.LabelNew(name)
+		nameLabel.SetXAlign(0)
+		totalValues[row], _ = gtk.LabelNew("…")
+		totalValues[row].SetXAlign(0)
+		totals.Attach(nameLabel, 0, row, 1, 1)
+		totals.Attach(totalValues[row], 1, row, 1, 1)
+	}
+	content.PackStart(totals, false, false, 0)
+
+	heading("Storage by Account")
+	accounts := newGrid()
+	accountRows := 0
+	content.PackStart(accounts, false, false, 0)
+
+	show := func(summary ui.StatusSummary) {
+		mounts := fmt.Sprintf("%d, %d running", summary.Mounts, summary.Running)
+		if summary.Unreachable > 0 {
+			mounts += fmt.Sprintf(", %d not responding", summary.Unreachable)
+		}
+		service := "no problems detected"
+		switch {
+		case summary.Degraded == 1:
+			service = fs.ServiceDegradedMessage
+		case summary.Degraded > 1:
+			service = fmt.Sprintf("%s (%d accounts)", fs.ServiceDegradedMessage, summary.Degraded)
+		}
+		values := []string{
+			mounts,
+			fmt.Sprint(summary.Offline),
+			fs.FormatSize(summary.CachedBytes),
+			fmt.Sprint(summary.PendingUploads),
+			fmt.Sprint(summary.Conflicts),
+			service,
+		}
+		for row, value := range values {
+			totalValues[row].SetText(value)
+		}
+
+		for ; accountRows > 0; accountRows-- {
+			accounts.RemoveRow(0)
+		}
+		for _, usage := range summary.Accounts {
+			account := usage.Account
+			if account == "" {
+				account = "Unknown account"
+			}
+			nameLabel, _ := gtk.LabelNew(account + ":")
+			nameLabel.SetXAlign(0)
+			quota := describeQuota(usage)
+			if usage.ServiceDegraded {
+				quota += ", " + fs.ServiceDegradedMessage
+			}
+			valueLabel, _ := gtk.LabelNew(quota)
+			valueLabel.SetXAlign(0)
+			accounts.Attach(nameLabel, 0, accountRows, 1, 1)
+			accounts.Attach(valueLabel, 1, accountRows, 1, 1)
+			accountRows++
+		}
+		accounts.ShowAll()
+	}
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		logging.Warn().Err(err).Msg("Could not connect to the session bus, mount statistics will not be shown.")
+		conn = nil
+	}
+
+	// The state below is only touched on the GTK main thread.
+	closed, loading := false, false
+	refresh := func() bool {
+		if closed {
+			return false
+		}
+		if !loading {
+			loading = true
+			go func() {
+				summary := ui.SummarizeMounts(loadMountStatuses(conn, cacheDir))
+				glib.IdleAdd(func() bool {
+					loading = false
+					if !closed {
+						show(summary)
+					}
+					return false
+				})
+			}()
+		}
+		return true
+	}
+	timer := glib.TimeoutSecondsAdd(statusRefreshInterval, refresh)
+	dialog.Connect("destroy", func() {
+		closed = true
+		glib.SourceRemove(timer)
+		if conn != nil {
+			conn.Close()
+		}
+	})
+
+	refresh()
+	dialog.ShowAll()
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+)
+
+func testFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet("onemount", flag.ContinueOnError)
+	flags.StringP("cache-dir", "c", "", "Change the default cache directory used by onemount. More text.")
+	flags.String("log", "", "Set logging level [fatal..trace].")
+	flags.Bool("stats", false, "Display statistics: cache, uploads.")
+	flags.String("bundle", "", "Write a support bundle.")
+	flags.Lookup("bundle").NoOptDefVal = "bundle.tar.gz"
+	return flags
+}
+
+func TestUT_CMD_CLI_UsageListsEveryCommand(t *testing.T) {
+	lines := UsageLines()
+	if len(lines) != len(Commands) {
+		t.Fatalf("expected a usage line per command, got %d for %d", len(lines), len(Commands))
+	}
+	if lines[0] != "onemount doctor [--bundle[=<file>]] <mountpoint>" {
+		t.Fatalf("unexpected first usage line %q", lines[0])
+	}
+	for _, line := range lines {
+		if strings.HasSuffix(line, " ") {
+			t.Fatalf("usage line %q has trailing space", line)
+		}
+	}
+}
+
+func TestUT_CMD_CLI_CompletionCoversCommandsAndFlags(t *testing.T) {
+	var bash bytes.Buffer
+	if err := Completion(&bash, "bash", testFlags()); err != nil {
+		t.Fatal(err)
+	}
+	script := bash.String()
+	for _, want := range []string{
+		"--cache-dir|-c) COMPREPLY=($(compgen -f",
+		`--log) COMPREPLY=($(compgen -W "fatal error warn info debug trace"`,
+		`"doctor status events offline pin unpin replay jobs cache reset policy reconcile verify-file download-url sync move folders audit-uploads config help completion"`,
+		`policy) COMPREPLY=($(compgen -W "export import"`,
+		`help) COMPREPLY=($(compgen -W "caching conflicts offline"`,
+		"complete -o filenames -F _onemount onemount",
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("bash completion lacks %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "--bundle|") || strings.Contains(script, "--stats)") {
+		t.Fatalf("flags without a separate value must not consume the next word:\n%s", script)
+	}
+
+	var zsh bytes.Buffer
+	if err := Completion(&zsh, "zsh", testFlags()); err != nil {
+		t.Fatal(err)
+	}
+	script = zsh.String()
+	for _, want := range []string{
+		"#compdef onemount",
+		`'(-c --cache-dir)'{-c,--cache-dir=}'[Change the default cache directory used by onemount]:path:_files'`,
+		`'--log=[Set logging level \[fatal..trace\]]:value:(fatal error warn info debug trace)'`,
+		`'--stats[Display statistics\: cache, uploads]'`,
+		`'cache:Cache commands'`,
+		"config) (( CURRENT == 2 )) && _values config validate schema && return ;;",
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("zsh completion lacks %q:\n%s", want, script)
+		}
+	}
+
+	if err := Completion(&bytes.Buffer{}, "fish", testFlags()); err == nil {
+		t.Fatalf("expected an error for an unsupported shell")
+	}
+}
+
+func TestUT_CMD_CLI_HelpTopicsRenderAsText(t *testing.T) {
+	names := TopicNames()
+	if strings.Join(names, ",") != "caching,conflicts,offline" {
+		t.Fatalf("unexpected topics %v", names)
+	}
+	if title := TopicTitle("offline"); title != "Offline mode" {
+		t.Fatalf("unexpected title %q", title)
+	}
+	text, ok := Topic("offline")
+	if !ok {
+		t.Fatalf("expected the offline topic")
+	}
+	if !strings.HasPrefix(text, "Offline mode\n============\n") {
+		t.Fatalf("expected an underlined title, got:\n%s", text)
+	}
+	if !strings.Contains(text, "\n    onemount offline ~/OneDrive ~/OneDrive/Documents\n") || strings.Contains(text, "```") {
+		t.Fatalf("expected indented code blocks, got:\n%s", text)
+	}
+	for _, name := range []string{"", "nope", "../commands", "offline.md"} {
+		if _, ok := Topic(name); ok {
+			t.Fatalf("expected no topic %q", name)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Package cli describes the onemount command line: its subcommands, the shell
+// completions generated from them and the help topics of "onemount help".
+package cli
+
+import "strings"
+
+// Command is a subcommand of onemount.
+type Command struct {
+	Name    string // words naming the command, such as "cache plan"
+	Args    string // arguments after the name, as shown in the usage
+	Summary string
+}
+
+// Commands lists the subcommands in the order of the usage.
+var Commands = []Command{
+	{"doctor", "[--bundle[=<file>]] <mountpoint>", "Report crashes and save a support bundle for bug reports"},
+	{"status", "<mountpoint>", "List conflicts, files that cannot upload and failed transfers"},
+	{"events", "[--count=<n>] <mountpoint>", "Show what the mount did recently"},
+	{"offline", "<mountpoint> <folder>", "Pin a folder and download it now"},
+	{"pin", "<path>...", "Keep files or folders downloaded, downloading them in the background"},
+	{"unpin", "<path>...", "Stop keeping files or folders downloaded"},
+	{"replay", "--plan|--apply <mountpoint>", "Review or replay the changes made while offline"},
+	{"jobs", "[--cancel=<id>] <mountpoint>", "List or cancel long-running operations"},
+	{"cache plan", "<mountpoint>", "Show what a cache cleanup would evict"},
+	{"reset", "[--force] <mountpoint>", "Start the cache of a stopped mount over from OneDrive"},
+	{"policy export", "<mountpoint> [<file>]", "Save pins, overlay policies and ignore rules to YAML"},
+	{"policy import", "<mountpoint> <file>", "Apply a saved policy file"},
+	{"reconcile", "<folder>", "Re-read a folder tree from OneDrive and repair what disagrees"},
+	{"verify-file", "<file>", "Download a file again and compare it with the cached copy"},
+	{"download-url", "<file>", "Print a URL that downloads a file from OneDrive for about an hour"},
+	{"sync", "<file>", "Upload or download a file now, ahead of queued transfers"},
+	{"move", "<source> <destination>", "Move an item to another mount without downloading it first"},
+	{"folders", "<mountpoint>", "List folders with more items than OneDrive handles well"},
+	{"audit-uploads", "[--sample=<n>] <mountpoint>", "Check recent uploads against OneDrive"},
+	{"config validate", "[--file=<path>]", "Check the configuration file for mistakes"},
+	{"config schema", "", "Print the JSON schema of the configuration file"},
+	{"help", "[<topic>]", "Read about a topic, such as offline mode"},
+	{"completion", "bash|zsh", "Print a shell completion script"},
+}
+
+// UsageLines returns the usage line of every subcommand.
+func UsageLines() []string {
+	lines := make([]string, 0, len(Commands))
+	for _, cmd := range Commands {
+		lines = append(lines, strings.TrimSpace("onemount "+cmd.Name+" "+cmd.Args))
+	}
+	return lines
+}
+
+// topLevel returns the first words of the subcommands with a summary each,
+// and the second words of the commands that have them.
+func topLevel() ([]Command, map[string][]string) {
+	var first []Command
+	second := map[string][]string{}
+	seen := map[string]bool{}
+	for _, cmd := range Commands {
+		words := strings.Fields(cmd.Name)
+		if len(words) > 1 {
+			second[words[0]] = append(second[words[0]], words[1])
+		}
+		if seen[words[0]] {
+			continue
+		}
+		seen[words[0]] = true
+		summary := cmd.Summary
+		if len(words) > 1 {
+			summary = strings.ToUpper(words[0][:1]) + words[0][1:] + " commands"
+		}
+		first = append(first, Command{Name: words[0], Summary: summary})
+	}
+	return first, second
+}
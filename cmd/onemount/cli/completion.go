@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Shells lists the shells Completion writes scripts for.
+var Shells = []string{"bash", "zsh"}
+
+// flagValues lists the values offered for flags that take one of a few.
+var flagValues = map[string][]string{
+	"log":            {"fatal", "error", "warn", "info", "debug", "trace"},
+	"overlay-policy": {"REMOTE_WINS", "LOCAL_WINS", "MERGED"},
+}
+
+// pathFlags lists the flags taking a file or directory.
+var pathFlags = map[string]bool{
+	"config-file": true,
+	"log-output":  true,
+	"cache-dir":   true,
+	"freeze":      true,
+	"unfreeze":    true,
+	"bundle":      true,
+	"file":        true,
+	"fusermount":  true,
+}
+
+// Completion writes the completion script of shell for the subcommands and
+// the flags in flags.
+func Completion(w io.Writer, shell string, flags *flag.FlagSet) error {
+	switch shell {
+	case "bash":
+		return bashCompletion(w, flags)
+	case "zsh":
+		return zshCompletion(w, flags)
+	default:
+		return fmt.Errorf("no completion for shell %q, use one of: %s", shell, strings.Join(Shells, ", "))
+	}
+}
+
+// subcommandValues returns the words completed after the first word of a
+// subcommand, keyed by that word.
+func subcommandValues() map[string][]string {
+	_, second := topLevel()
+	second["help"] = TopicNames()
+	second["completion"] = Shells
+	return second
+}
+
+// takesValue reports whether f needs a value, so the next word is not a flag
+// or an argument.
+func takesValue(f *flag.Flag) bool {
+	return f.Value.Type() != "bool" && f.NoOptDefVal == ""
+}
+
+func bashCompletion(w io.Writer, flags *flag.FlagSet) error {
+	var names, valued, paths, takers []string
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Hidden {
+			return
+		}
+		names = append(names, "--"+f.Name)
+		forms := []string{"--" + f.Name}
+		if f.Shorthand != "" {
+			names = append(names, "-"+f.Shorthand)
+			forms = append(forms, "-"+f.Shorthand)
+		}
+		if !takesValue(f) {
+			return
+		}
+		takers = append(takers, forms...)
+		if pathFlags[f.Name] {
+			paths = append(paths, forms...)
+		} else if values, ok := flagValues[f.Name]; ok {
+			valued = append(valued, fmt.Sprintf("        %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;",
+				strings.Join(forms, "|"), strings.Join(values, " ")))
+		} else {
+			valued = append(valued, fmt.Sprintf("        %s) return ;;", strings.Join(forms, "|")))
+		}
+	})
+	first, _ := topLevel()
+	var commands []string
+	for _, cmd := range first {
+		commands = append(commands, cmd.Name)
+	}
+	var subcommands []string
+	values := subcommandValues()
+	for _, word := range sortedKeys(values) {
+		subcommands = append(subcommands, fmt.Sprintf("        %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;",
+			word, strings.Join(values[word], " ")))
+	}
+
+	_, err := fmt.Fprintf(w, `# bash completion for onemount, generated by "onemount completion bash"
+_onemount() {
+    local cur prev word command i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    case "$prev" in
+%s
+        %s) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+    esac
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W %q -- "$cur"))
+        return
+    fi
+
+    # the first word that is not a flag names the command
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        word="${COMP_WORDS[i]}"
+        case "${COMP_WORDS[i-1]}" in
+            %s) continue ;;
+        esac
+        if [[ "$word" != -* ]]; then
+            if [[ -z "$command" ]]; then
+                command="$word"
+            elif [[ "$i" -eq $((COMP_CWORD - 1)) ]]; then
+                command="$command/$word"
+            fi
+        fi
+    done
+    if [[ -z "$command" ]]; then
+        COMPREPLY=($(compgen -W %q -- "$cur") $(compgen -d -- "$cur"))
+        return
+    fi
+    if [[ "$command" != */* && "$prev" == "$command" ]]; then
+        case "$command" in
+%s
+        esac
+    fi
+    COMPREPLY=($(compgen -f -- "$cur"))
+}
+complete -o filenames -F _onemount onemount
+`, strings.Join(valued, "\n"), strings.Join(paths, "|"), strings.Join(names, " "),
+		strings.Join(takers, "|"), strings.Join(commands, " "), strings.Join(subcommands, "\n"))
+	return err
+}
+
+func zshCompletion(w io.Writer, flags *flag.FlagSet) error {
+	var specs []string
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Hidden {
+			return
+		}
+		action := ""
+		if takesValue(f) {
+			switch values, ok := flagValues[f.Name]; {
+			case pathFlags[f.Name]:
+				action = ":path:_files"
+			case ok:
+				action = ":value:(" + strings.Join(values, " ") + ")"
+			default:
+				action = ":value: "
+			}
+		}
+		desc := zshQuote(firstSentence(f.Usage))
+		name := "--" + f.Name
+		if action != "" {
+			name += "="
+		}
+		if f.Shorthand != "" {
+			specs = append(specs, fmt.Sprintf("'(-%s --%s)'{-%s,%s}'[%s]%s'",
+				f.Shorthand, f.Name, f.Shorthand, name, desc, action))
+		} else {
+			specs = append(specs, fmt.Sprintf("'%s[%s]%s'", name, desc, action))
+		}
+	})
+	first, _ := topLevel()
+	var commands []string
+	for _, cmd := range first {
+		commands = append(commands, fmt.Sprintf("        '%s:%s'", cmd.Name, zshQuote(cmd.Summary)))
+	}
+	var subcommands []string
+	values := subcommandValues()
+	for _, word := range sortedKeys(values) {
+		subcommands = append(subcommands, fmt.Sprintf("                %s) (( CURRENT == 2 )) && _values %s %s && return ;;",
+			word, word, strings.Join(values[word], " ")))
+	}
+
+	_, err := fmt.Fprintf(w, `#compdef onemount
+# zsh completion for onemount, generated by "onemount completion zsh"
+
+_onemount() {
+    local -a commands
+    commands=(
+%s
+    )
+    local state
+    _arguments -s \
+        %s \
+        '1: :->command' \
+        '*:: :->args'
+    case $state in
+        command)
+            _describe -t commands 'onemount command' commands
+            _files -/
+            ;;
+        args)
+            case $words[1] in
+%s
+            esac
+            _files
+            ;;
+    esac
+}
+
+_onemount "$@"
+`, strings.Join(commands, "\n"), strings.Join(specs, " \\\n        "), strings.Join(subcommands, "\n"))
+	return err
+}
+
+// firstSentence returns the first sentence of a flag's usage.
+func firstSentence(usage string) string {
+	if i := strings.Index(usage, ". "); i >= 0 {
+		return usage[:i]
+	}
+	return strings.TrimSuffix(usage, ".")
+}
+
+// zshQuote escapes s for a single-quoted _arguments description.
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
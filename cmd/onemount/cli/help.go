@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"embed"
+	"path"
+	"sort"
+	"strings"
+)
+
+// The topics of "onemount help <topic>" are the Markdown files in topics/,
+// rendered as plain text for the terminal. The first line of a topic is its
+// title.
+
+//go:embed topics/*.md
+var topics embed.FS
+
+// TopicNames returns the names of the help topics, sorted.
+func TopicNames() []string {
+	entries, _ := topics.ReadDir("topics")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".md"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TopicTitle returns the title of the topic, or "" when there is none.
+func TopicTitle(name string) string {
+	text, ok := topicSource(name)
+	if !ok {
+		return ""
+	}
+	title, _, _ := strings.Cut(text, "\n")
+	return strings.TrimSpace(strings.TrimLeft(title, "#"))
+}
+
+// Topic returns the topic rendered for the terminal, and false when there is
+// no topic of that name.
+func Topic(name string) (string, bool) {
+	text, ok := topicSource(name)
+	if !ok {
+		return "", false
+	}
+	return render(text), true
+}
+
+func topicSource(name string) (string, bool) {
+	if name == "" || strings.ContainsAny(name, "/.") {
+		return "", false
+	}
+	data, err := topics.ReadFile(path.Join("topics", name+".md"))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// render turns Markdown into plain text: headings are underlined, code blocks
+// indented, and the markup of inline code and emphasis is dropped.
+func render(markdown string) string {
+	var out strings.Builder
+	code := false
+	for _, line := range strings.Split(strings.TrimRight(markdown, "\n"), "\n") {
+		if strings.HasPrefix(line, "```") {
+			code = !code
+			continue
+		}
+		if code {
+			out.WriteString("    " + line + "\n")
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			level := len(line) - len(strings.TrimLeft(line, "#"))
+			title := strings.TrimSpace(line[level:])
+			underline := "-"
+			if level == 1 {
+				underline = "="
+			}
+			out.WriteString(title + "\n" + strings.Repeat(underline, len(title)) + "\n")
+			continue
+		}
+		out.WriteString(strings.NewReplacer("`", "", "**", "").Replace(line) + "\n")
+	}
+	return out.String()
+}
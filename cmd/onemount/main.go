@@ -24,28 +24,33 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/auriora/onemount/cmd/common"
+	"github.com/auriora/onemount/cmd/onemount/cli"
 	"github.com/auriora/onemount/internal/errors"
 	"github.com/auriora/onemount/internal/fs"
 	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/logging"
 	"github.com/auriora/onemount/internal/metadata"
+	"github.com/auriora/onemount/internal/ui/systemd"
 	"github.com/coreos/go-systemd/v22/unit"
+	dbus "github.com/godbus/dbus/v5"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	flag "github.com/spf13/pflag"
 	bolt "go.etcd.io/bbolt"
+	"gopkg.in/yaml.v3"
 )
 
 func usage() {
@@ -58,14 +63,17 @@ downloaded. While offline, the filesystem will be read-only until
 connectivity is re-established.
 
 Usage: onemount [options] <mountpoint>
-
+       onemount --multi-mount [options]
+       onemount --share-url=<link> [options] <mountpoint>
+       onemount --frozen [options] <mountpoint>
+%s
 Valid options:
-`)
+`, "       "+strings.Join(cli.UsageLines(), "\n       ")+"\n")
 	flag.PrintDefaults()
 }
 
 // setupFlags initializes and parses command-line flags, returning the configuration and other flag values
-func setupFlags() (config *common.Config, authOnly, headless, debugOn, stats, daemon bool, mountpoint string) {
+func setupFlags() (config *common.Config, authOnly, headless, debugOn, stats, daemon bool, statsFormat, mountpoint string) {
 	// setup cli parsing
 	authOnlyFlag := flag.BoolP("auth-only", "a", false,
 		"Authenticate to OneDrive and then exit.")
@@ -117,12 +125,43 @@ func setupFlags() (config *common.Config, authOnly, headless, debugOn, stats, da
 	realtimeFallback := flag.Int("realtime-fallback-seconds", 0, "Override realtime fallback polling interval in seconds (default 1800).")
 	overlayPolicy := flag.String("overlay-policy", "", "Default overlay policy (REMOTE_WINS, LOCAL_WINS, MERGED).")
 	statsFlag := flag.BoolP("stats", "", false, "Display statistics about the metadata, content caches, "+
-		"outstanding changes for upload, etc. Does not start a mount point.")
+		"outstanding changes for upload, etc. Does not start a mount point. A running mount is queried over D-Bus.")
+	statsFormatFlag := flag.String("stats-format", statsFormatText, "With --stats, how to print the statistics: "+
+		"text, or json for scripts and monitoring.")
 	pollingOnlyFlag := flag.Bool("polling-only", false, "Force delta polling even if realtime subscriptions are configured (disables the Socket.IO transport).")
+	strictPOSIXFlag := flag.Bool("strict-posix", false, "Wait for OneDrive to confirm directory changes, deletes, renames and fsync "+
+		"before returning, and use inode numbers that are stable across mounts. Slower, but needed by applications such as git.")
+	onedriverCompatFlag := flag.Bool("onedriver-compat", false, "Also expose the user.onedriver.* extended attributes and onedriver's "+
+		"D-Bus interface, for file manager extensions and scripts written for onedriver.")
+	fuseFD := flag.Int("fuse-fd", 0, "Serve an already mounted /dev/fuse file descriptor passed by the parent process "+
+		"instead of mounting with fusermount3, for rootless containers and Flatpak. Descriptors passed by systemd "+
+		"socket activation are used automatically.")
+	fusermountFlag := flag.String("fusermount", "", "Mount helper to use instead of fusermount3, for example a wrapper "+
+		"that runs fusermount3 outside a sandbox.")
+	shareURL := flag.String("share-url", "", "Mount the folder a sharing link points to, read-only, instead of your own drive. "+
+		"The link can point into another user's drive.")
+	frozenFlag := flag.Bool("frozen", false, "Mount the existing cache read-only and offline, without signing in: "+
+		"nothing is synced, uploaded or downloaded, and files that were never cached cannot be opened.")
+	multiMountFlag := flag.Bool("multi-mount", false, "Serve every mountpoint listed under mounts in the configuration file "+
+		"from this one process instead of a single <mountpoint>. Mounts of the same account share their sign-in.")
+	ephemeralFlag := flag.Bool("ephemeral", false, "Keep nothing once the mount stops, for CI jobs and containers: metadata is kept "+
+		"in memory, the content cache is limited to 1 GiB in a temporary directory removed on exit, and changes made offline are not kept for later.")
 	daemonFlag := flag.BoolP("daemon", "", false, "Run onemount in daemon mode (detached from terminal).")
 	help := flag.BoolP("help", "h", false, "Displays this help message.")
 	metadataValidate := flag.Bool("metadata-validate", false, "Validate metadata_v2 in the cache and exit (no mount started).")
 	metadataMigrate := flag.Bool("metadata-migrate-legacy", false, "Migrate legacy metadata bucket into metadata_v2 and exit (no mount started).")
+	freezePath := flag.String("freeze", "", "Freeze a file in a mounted OneMount filesystem so local edits are kept and never uploaded, then exit.")
+	unfreezePath := flag.String("unfreeze", "", "Unfreeze a file in a mounted OneMount filesystem, reconciling and uploading its local edits, then exit.")
+	bundlePath := flag.String("bundle", "", "With the doctor command, write a support bundle of the mount at <mountpoint> "+
+		"(queues, recent errors, redacted config, log tail and stats) to this tar.gz file, then exit.")
+	flag.Lookup("bundle").NoOptDefVal = defaultBundleName
+	eventCount := flag.Int("count", defaultEventCount, "With the events command, the number of recent events to show (0 for all).")
+	cancelJob := flag.String("cancel", "", "With the jobs command, cancel the job with this ID instead of listing jobs.")
+	validateFile := flag.String("file", "", "With the config validate command, the configuration file to check instead of --config-file.")
+	auditSample := flag.Int("sample", fs.DefaultUploadAuditSample, "With the audit-uploads command, the number of recently uploaded files to check.")
+	replayPlan := flag.Bool("plan", false, "With the replay command, predict what replaying the changes made offline would do without changing anything.")
+	replayApply := flag.Bool("apply", false, "With the replay command, replay the changes made offline and follow the job.")
+	forceReset := flag.Bool("force", false, "With the reset command, reset the cache even though local changes not uploaded yet are lost.")
 	flag.Usage = usage
 	flag.Parse()
 
@@ -135,7 +174,211 @@ func setupFlags() (config *common.Config, authOnly, headless, debugOn, stats, da
 		os.Exit(0)
 	}
 
+	if *statsFormatFlag != statsFormatText && *statsFormatFlag != statsFormatJSON {
+		fmt.Fprintf(os.Stderr, "unknown --stats-format %q, use %s or %s\n", *statsFormatFlag, statsFormatText, statsFormatJSON)
+		os.Exit(1)
+	}
+
+	if *freezePath != "" || *unfreezePath != "" {
+		if err := runFreeze(*freezePath, *unfreezePath); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "help" && flag.NArg() <= 2 {
+		if err := runHelp(flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "completion" && flag.NArg() == 2 {
+		if err := cli.Completion(os.Stdout, flag.Arg(1), flag.CommandLine); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "config" && flag.NArg() == 2 && (flag.Arg(1) == "validate" || flag.Arg(1) == "schema") {
+		path := *validateFile
+		if path == "" {
+			path = *configPath
+		}
+		if err := runConfigCommand(flag.Arg(1), path); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(common.FailureReasonOf(err).ExitCode())
+		}
+		os.Exit(0)
+	}
+
 	config = common.LoadConfig(*configPath)
+	config.ConfigFile = *configPath
+	// The mountpoint's section of the configuration replaces the top-level
+	// settings; command-line flags replace both.
+	if flag.NArg() > 0 {
+		if absMountPath, err := filepath.Abs(flag.Arg(0)); err == nil {
+			config = config.ForMount(absMountPath)
+		}
+	}
+
+	// "doctor" is only a command when used as one, so a mountpoint named
+	// doctor still mounts.
+	if flag.Arg(0) == "doctor" && (flag.NArg() == 2 || *bundlePath != "") {
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "usage: onemount doctor [--bundle[=<file>]] <mountpoint>")
+			os.Exit(1)
+		}
+		if *cacheDir != "" {
+			config.CacheDir = *cacheDir
+		}
+		if err := reportCrashes(config, flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if *bundlePath != "" {
+			if err := runDoctor(config, flag.Arg(1), *bundlePath); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "reset" && flag.NArg() == 2 {
+		if *cacheDir != "" {
+			config.CacheDir = *cacheDir
+		}
+		if err := runReset(config, flag.Arg(1), *forceReset); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "status" && flag.NArg() == 2 {
+		if err := runStatus(flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "events" && flag.NArg() == 2 {
+		if err := runEvents(flag.Arg(1), *eventCount); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "jobs" && flag.NArg() == 2 {
+		if err := runJobs(flag.Arg(1), *cancelJob); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "policy" && (flag.Arg(1) == "export" && (flag.NArg() == 3 || flag.NArg() == 4) ||
+		flag.Arg(1) == "import" && flag.NArg() == 4) {
+		if err := runPolicy(flag.Arg(1), flag.Arg(2), flag.Arg(3)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "cache" && flag.Arg(1) == "plan" && flag.NArg() == 3 {
+		if err := runCachePlan(flag.Arg(2)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "reconcile" && flag.NArg() == 2 {
+		if err := runReconcile(flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "verify-file" && flag.NArg() == 2 {
+		if err := runVerifyFile(flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "download-url" && flag.NArg() == 2 {
+		if err := runDownloadURL(flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "sync" && flag.NArg() == 2 {
+		if err := runSyncNow(flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if (flag.Arg(0) == "pin" || flag.Arg(0) == "unpin") && flag.NArg() >= 2 {
+		if err := runPin(flag.Arg(0), flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "move" && flag.NArg() == 3 {
+		if err := runMove(flag.Arg(1), flag.Arg(2)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "folders" && flag.NArg() == 2 {
+		if err := runFolders(flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "audit-uploads" && flag.NArg() == 2 {
+		if err := runAuditUploads(flag.Arg(1), *auditSample); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "replay" && flag.NArg() == 2 {
+		if err := runReplay(flag.Arg(1), *replayPlan, *replayApply); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "offline" && flag.NArg() == 3 {
+		if err := runOffline(flag.Arg(1), flag.Arg(2)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
 	if *wipeCache {
 		if *cacheDir != "" {
@@ -184,12 +427,21 @@ func setupFlags() (config *common.Config, authOnly, headless, debugOn, stats, da
 	}
 
 	// determine and validate mountpoint
-	if len(flag.Args()) == 0 {
+	config.MultiMount = *multiMountFlag
+	if config.MultiMount && flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "--multi-mount serves the mountpoints of the configuration file, not %s\n", flag.Arg(0))
+		os.Exit(common.ExitUsage)
+	}
+	if config.MultiMount && (*authOnlyFlag || *statsFlag) {
+		fmt.Fprintln(os.Stderr, "--auth-only and --stats work on one <mountpoint>, not with --multi-mount")
+		os.Exit(common.ExitUsage)
+	}
+	if len(flag.Args()) == 0 && !config.MultiMount {
 		flag.Usage()
 		if _, err := fmt.Fprintf(os.Stderr, "\nNo mountpoint provided, exiting.\n"); err != nil {
 			logging.Error().Err(err).Msg("Failed to write to stderr")
 		}
-		os.Exit(1)
+		os.Exit(common.ExitUsage)
 	}
 	mountpoint = flag.Arg(0)
 	if *mountTimeout > 0 {
@@ -219,51 +471,66 @@ func setupFlags() (config *common.Config, authOnly, headless, debugOn, stats, da
 	if *pollingOnlyFlag {
 		config.Realtime.PollingOnly = true
 	}
+	if *strictPOSIXFlag {
+		config.StrictPOSIX = true
+	}
+	if *onedriverCompatFlag {
+		config.OnedriverCompat = true
+	}
+	if *fusermountFlag != "" {
+		config.Fusermount = *fusermountFlag
+	}
+	config.ShareURL = *shareURL
+	config.Frozen = *frozenFlag
+	config.Ephemeral = *ephemeralFlag
+	config.FuseFD = *fuseFD
+	if config.FuseFD == 0 {
+		if config.FuseFD = common.ActivatedFuseFD(os.Getenv, os.Getpid()); config.FuseFD > 0 {
+			// Like sd_listen_fds(1): child processes must not take the descriptors for theirs.
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+			os.Unsetenv("LISTEN_FDNAMES")
+		}
+	}
 
 	logging.SetGlobalLevel(common.StringToLevel(config.LogLevel))
 
-	return config, *authOnlyFlag, *headlessFlag, *debugOnFlag, *statsFlag, *daemonFlag, mountpoint
+	return config, *authOnlyFlag, *headlessFlag, *debugOnFlag, *statsFlag, *daemonFlag, *statsFormatFlag, mountpoint
 }
 
-// checkConnectivity performs a pre-mount connectivity check to ensure network access
+// checkConnectivity performs a pre-mount connectivity check to ensure network access.
+// It probes several Microsoft endpoints over IPv6 and IPv4 in parallel, so
+// IPv6-only or split-DNS networks are not reported as offline. The result is
+// also recorded for the filesystem's network state monitor.
 func checkConnectivity(ctx context.Context, timeout time.Duration) error {
 	logging.Info().Msg("Performing pre-mount connectivity check...")
 
-	// Create a context with timeout
-	checkCtx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-
-	// Create a simple HTTP client with timeout
-	client := &http.Client{
-		Timeout: timeout,
-	}
-
-	// Try to reach the Graph API endpoint
-	req, err := http.NewRequestWithContext(checkCtx, "GET", "https://graph.microsoft.com/v1.0/", nil)
-	if err != nil {
-		return errors.Wrap(err, "failed to create connectivity check request")
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		// Check if it's a timeout or network error
-		if checkCtx.Err() == context.DeadlineExceeded {
+	result := graph.NewConnectivityProber(timeout).Probe(ctx)
+	if !result.Reachable {
+		switch result.Failure {
+		case graph.ConnectivityDNS:
+			return errors.Wrap(result.Err, "connectivity check failed - DNS cannot resolve Microsoft endpoints")
+		case graph.ConnectivityTimeout:
 			return errors.New("connectivity check timed out - network may be slow or unavailable")
+		case graph.ConnectivityTLS:
+			return errors.Wrap(result.Err, "connectivity check failed - TLS handshake rejected (proxy or captive portal?)")
 		}
-		return errors.Wrap(err, "connectivity check failed - cannot reach Microsoft Graph API")
+		return errors.Wrap(result.Err, "connectivity check failed - cannot reach Microsoft Graph API")
 	}
-	defer resp.Body.Close()
 
 	// Any response (even 401) means we can reach the API
 	logging.Info().
-		Int("statusCode", resp.StatusCode).
+		Str("endpoint", result.Endpoint).
+		Int("statusCode", result.StatusCode).
+		Bool("ipv6", result.IPv6()).
+		Dur("latency", result.Latency).
 		Msg("Connectivity check successful")
 
 	return nil
 }
 
-// initializeFilesystem sets up the filesystem and returns the filesystem, auth, server, and paths
-func initializeFilesystem(ctx context.Context, config *common.Config, mountpoint string, authOnly, headless, debugOn bool) (*fs.Filesystem, *graph.Auth, *fuse.Server, string, string, error) {
+// initializeFilesystem sets up the filesystem and returns the filesystem, auth, mount, and paths
+func initializeFilesystem(ctx context.Context, config *common.Config, mountpoint string, authOnly, headless, debugOn bool) (*fs.Filesystem, *graph.Auth, *servedMount, string, string, error) {
 	// compute cache name as systemd would
 	absMountPath, err := filepath.Abs(mountpoint)
 	if err != nil {
@@ -288,6 +555,14 @@ func initializeFilesystem(ctx context.Context, config *common.Config, mountpoint
 	//   2. Independent authentication tokens per mount
 	//   3. Separate cache and metadata per mount
 	cachePath := filepath.Join(config.CacheDir, unit.UnitNamePathEscape(absMountPath))
+	if config.Ephemeral {
+		// Tokens stay in the cache directory so the next run signs in
+		// without a browser; everything else goes with the mount.
+		if cachePath, err = os.MkdirTemp("", "onemount-ephemeral-"); err != nil {
+			return nil, nil, nil, "", "", errors.Wrap(err, "failed to create ephemeral cache directory")
+		}
+		logging.Info().Str("cachePath", cachePath).Msg("Ephemeral mount, the cache is removed when the mount stops")
+	}
 
 	// Configure D-Bus service name deterministically for this mountpoint before the filesystem starts
 	fs.SetDBusServiceNameForMount(absMountPath)
@@ -337,7 +612,7 @@ func initializeFilesystem(ctx context.Context, config *common.Config, mountpoint
 		if err != nil {
 			logging.LogError(err, "Authentication failed",
 				logging.FieldOperation, "initializeFilesystem")
-			return nil, nil, nil, "", "", errors.Wrap(err, "authentication failed")
+			return nil, nil, nil, "", "", authFailure(err)
 		}
 
 		logging.Info().
@@ -350,20 +625,48 @@ func initializeFilesystem(ctx context.Context, config *common.Config, mountpoint
 	// create the filesystem
 	logging.Info().Msgf("onemount %s", common.Version())
 
-	// Use account-based storage for authentication
-	auth, err := graph.AuthenticateWithAccountStorage(context.Background(), config.AuthConfig, config.CacheDir, instance, headless)
-	if err != nil {
-		logging.LogError(err, "Authentication failed",
-			logging.FieldOperation, "initializeFilesystem")
-		return nil, nil, nil, "", "", errors.Wrap(err, "authentication failed")
+	var auth *graph.Auth
+	if config.Frozen {
+		if !common.CacheExists(cachePath) {
+			return nil, nil, nil, "", "", fmt.Errorf("mount failed: --frozen needs an existing cache, but nothing was cached for %s in %s",
+				mountpoint, cachePath)
+		}
+		// Archive mounts never talk to OneDrive, so they work after the
+		// account is gone.
+		graph.SetOperationalOffline(true)
+		auth = &graph.Auth{}
+		if account, err := graph.GetAccountName(config.CacheDir, instance); err == nil {
+			auth.Account = account
+		}
+		logging.Info().Str("account", auth.Account).Msg("Mounting the cache read-only without connecting to OneDrive")
+	} else {
+		auth, err = authenticate(config, instance, headless)
+		if err != nil {
+			logging.LogError(err, "Authentication failed",
+				logging.FieldOperation, "initializeFilesystem")
+			return nil, nil, nil, "", "", authFailure(err)
+		}
+
+		logging.Info().
+			Str("account", auth.Account).
+			Str("tokenPath", auth.Path).
+			Msg("Authentication successful")
 	}
 
-	logging.Info().
-		Str("account", auth.Account).
-		Str("tokenPath", auth.Path).
-		Msg("Authentication successful")
+	var share *common.SharedFolder
+	if config.ShareURL != "" {
+		if share, err = resolveSharedFolder(ctx, config.ShareURL, cachePath, auth); err != nil {
+			return nil, nil, nil, "", "", err
+		}
+		logging.Info().Str("name", share.Name).Str("driveID", share.DriveID).Str("itemID", share.ItemID).
+			Msg("Mounting shared folder read-only")
+		auth.SetDriveScope(share.DriveID, share.ItemID)
+	}
+	if err := common.ClaimCacheNamespace(cachePath, share); err != nil {
+		return nil, nil, nil, "", "", errors.Wrap(err, "mount failed")
+	}
 
-	filesystem, err := fs.NewFilesystemWithContext(ctx, auth, cachePath, config.CacheExpiration, config.CacheCleanupInterval, config.MaxCacheSize)
+	filesystem, err := fs.NewFilesystemWithOptions(ctx, auth, cachePath, filesystemOptions(config))
 	if err != nil {
 		logging.LogError(err, "Failed to initialize filesystem",
 			logging.FieldOperation, "initializeFilesystem",
@@ -371,22 +674,51 @@ func initializeFilesystem(ctx context.Context, config *common.Config, mountpoint
 		return nil, nil, nil, "", "", errors.Wrap(err, "failed to initialize filesystem")
 	}
 
+	if config.Frozen {
+		filesystem.SetArchiveMode(true)
+	}
 	realtimeOpts := toRealtimeOptions(config.Realtime)
-	if realtimeOpts.Enabled {
+	if realtimeOpts.Enabled && !config.Frozen {
 		filesystem.ConfigureRealtime(realtimeOpts)
 	}
 	filesystem.SetDefaultOverlayPolicy(metadata.OverlayPolicy(strings.ToUpper(config.Overlay.DefaultPolicy)))
+	if err := filesystem.SetEvictionExemptions(config.EvictionExemptions); err != nil {
+		logging.Warn().Err(err).Msg("Ignoring invalid cache eviction exemptions")
+	}
+	if err := filesystem.ConfigureSyncTree(fs.SyncTreeScope{
+		MaxDepth: config.SyncTreeScope.MaxDepth,
+		Include:  config.SyncTreeScope.Include,
+		Exclude:  config.SyncTreeScope.Exclude,
+	}); err != nil {
+		logging.Warn().Err(err).Msg("Ignoring invalid sync tree scope")
+	}
+
+	filesystem.SetFeatures(config.Features)
+	if err := filesystem.SetNameNormalization(config.NameNormalization); err != nil {
+		logging.Warn().Err(err).Msg("Invalid name normalization, converting names to NFC")
+		_ = filesystem.SetNameNormalization(fs.NameNormalizationNFC)
+	}
+	if _, err := filesystem.MigrateNameNormalization(); err != nil {
+		logging.Warn().Err(err).Msg("Could not convert cached names to NFC")
+	}
+	if config.MaxBandwidthMbps > 0 {
+		logging.Info().Msgf("Limiting transfers to %d Mbps", config.MaxBandwidthMbps)
+		filesystem.SetBandwidthLimit(mountSettings(config).BandwidthLimit)
+	}
 
 	filesystem.ConfigureDeltaTuning(fs.DeltaTuning{
 		ActiveInterval: time.Duration(config.ActiveDeltaInterval) * time.Second,
 		ActiveWindow:   time.Duration(config.ActiveDeltaWindow) * time.Second,
 	})
 
-	logging.Info().Msgf("Setting base delta query interval to %d second(s)", config.DeltaInterval)
-	go filesystem.DeltaLoop(time.Duration(config.DeltaInterval) * time.Second)
+	// An archive mount keeps the cache as it is: no delta, no cleanup
+	if !config.Frozen {
+		logging.Info().Msgf("Setting base delta query interval to %d second(s)", config.DeltaInterval)
+		go filesystem.DeltaLoop(time.Duration(config.DeltaInterval) * time.Second)
+	}
 
 	// Start the content cache cleanup routine
-	if config.CacheExpiration > 0 {
+	if config.CacheExpiration > 0 && !config.Frozen {
 		logging.Info().Msgf("Setting content cache expiration to %d day(s)", config.CacheExpiration)
 		filesystem.StartCacheCleanup()
 	}
@@ -394,36 +726,102 @@ func initializeFilesystem(ctx context.Context, config *common.Config, mountpoint
 	// Start the status cache cleanup routine
 	filesystem.StartStatusCacheCleanup()
 
-	common.CreateXDGVolumeInfo(filesystem, auth)
+	if config.DailyTransferCapMB > 0 {
+		logging.Info().Msgf("Pausing background hydration after %d MB transferred per day", config.DailyTransferCapMB)
+		filesystem.SetDailyTransferCap(uint64(config.DailyTransferCapMB) * 1024 * 1024)
+	}
+	filesystem.StartUsageAccounting()
+	if !config.Frozen {
+		filesystem.StartAccessTimes(time.Duration(config.AccessTimeMinutes) * time.Minute)
+	}
+	filesystem.StartEventLog()
+	filesystem.StartServiceHealthChecks()
+	if !config.Frozen {
+		filesystem.StartTokenPreRefresh()
+	}
+	filesystem.StartSuspendMonitor()
+	if config.MeteredUploadLimitMB > 0 {
+		logging.Info().Msgf("Deferring uploads over %d MB while the connection is metered", config.MeteredUploadLimitMB)
+		filesystem.SetMeteredUploadThreshold(uint64(config.MeteredUploadLimitMB) * 1024 * 1024)
+		filesystem.StartMeteredUploadMonitor()
+	}
 
-	// Sync the full directory tree if requested
-	if config.SyncTree {
-		logging.Info().Msg("Starting full directory tree synchronization in background...")
-		filesystem.Wg.Add(1)
-		go func(ctx context.Context) {
-			defer filesystem.Wg.Done()
+	filesystem.SetSupportBundleSources(fs.SupportBundleSources{
+		Config:  redactedConfig(config),
+		LogPath: logFilePath(config),
+	})
+	filesystem.StartSupportSnapshots(0)
+	filesystem.StartCrashReporting()
 
-			// Check if context is already cancelled
-			select {
-			case <-ctx.Done():
-				logging.Debug().Msg("Directory tree synchronization cancelled due to context cancellation")
-				return
-			default:
-				// Continue with normal operation
-			}
+	if config.StrictPOSIX {
+		logging.Info().Msg("Strict POSIX mode enabled, changes are confirmed by OneDrive before returning")
+		filesystem.SetStrictPOSIX(true)
+	}
+	if config.ReviewOfflineReplay {
+		logging.Info().Msg("Changes made offline wait for onemount replay --apply")
+		filesystem.SetReviewOfflineReplay(true)
+	}
+	if err := filesystem.SetConflictNameTemplate(config.ConflictNameTemplate); err != nil {
+		logging.Warn().Err(err).Msg("Invalid conflict name template, using the default")
+	}
+	filesystem.SetFolderItemWarning(config.FolderItemWarning)
+	filesystem.SetThumbnailCacheLimit(int64(config.ThumbnailCacheMB) << 20)
+	filesystem.SetIndexerAccess(config.IndexerHydration, config.IndexerProcesses)
+	if config.UploadAuditInterval > 0 && !config.Frozen {
+		logging.Info().Msgf("Auditing recent uploads every %d hour(s)", config.UploadAuditInterval)
+		filesystem.StartUploadAudits(time.Duration(config.UploadAuditInterval)*time.Hour, fs.DefaultUploadAuditSample)
+	}
+	if !config.Frozen {
+		filesystem.StartErrorRecovery(fs.DefaultErrorRecoveryInterval)
+	}
+	if config.NotificationDigest > 0 && !config.Frozen {
+		logging.Info().Msgf("Summarizing sync activity every %d minute(s)", config.NotificationDigest)
+		filesystem.StartSyncDigest(time.Duration(config.NotificationDigest)*time.Minute, config.DesktopNotifications)
+	}
+	if config.MetricsAddress != "" {
+		if err := filesystem.StartMetricsServer(config.MetricsAddress); err != nil {
+			logging.Warn().Err(err).Msg("Not serving metrics")
+		}
+	}
+	if config.WorkerStallMinutes > 0 {
+		filesystem.StartWorkerWatchdog(time.Duration(config.WorkerStallMinutes)*time.Minute, config.RestartStalledPools)
+	}
+	if config.OnedriverCompat {
+		logging.Info().Msg("onedriver compatibility enabled, exposing user.onedriver.* attributes and onedriver's D-Bus interface")
+		filesystem.SetOnedriverCompat(true)
+	}
 
-			if err := filesystem.SyncDirectoryTreeWithContext(ctx, auth); err != nil {
-				// Check if the error is due to context cancellation
-				if ctx.Err() != nil {
-					logging.Debug().Msg("Directory tree synchronization cancelled due to context cancellation")
-					return
-				}
-				logging.LogError(err, "Error syncing directory tree",
-					logging.FieldOperation, "SyncDirectoryTreeWithContext")
-			} else {
-				logging.Info().Msg("Directory tree sync completed successfully")
+	// Shared content outlives the mount, which an ephemeral one must not
+	if auth.Account != "" && share == nil && !config.Frozen && !config.Ephemeral {
+		if err := filesystem.EnableSharedContent(fs.SharedContentDir(config.CacheDir, auth.Account)); err != nil {
+			logging.Warn().Err(err).Msg("Content will not be shared with other mounts of this account")
+		}
+	}
+
+	common.CreateXDGVolumeInfo(filesystem, auth)
+	filesystem.CreateActivityFeed()
+	filesystem.CreatePreviewDir()
+
+	// Sync the full directory tree if requested
+	if config.SyncTree && !config.Frozen {
+		startTreeSync(ctx, filesystem, auth)
+	}
+	if config.ConfigFile != "" && !config.Frozen && !config.Ephemeral {
+		syncTree := config.SyncTree
+		var reloadM sync.Mutex
+		filesystem.SetSettingsReloader(func() error {
+			reloadM.Lock()
+			defer reloadM.Unlock()
+			notifyService(systemd.NotifyReloading())
+			defer func() { notifyService(systemd.NotifyReady(filesystem.SyncState().String())) }()
+			reloaded := common.LoadConfig(config.ConfigFile).ForMount(absMountPath)
+			filesystem.ApplySettings(mountSettings(reloaded))
+			if reloaded.SyncTree && !syncTree {
+				startTreeSync(ctx, filesystem, auth)
 			}
-		}(ctx)
+			syncTree = reloaded.SyncTree
+			return nil
+		})
 	}
 
 	// Create mount options
@@ -432,6 +830,8 @@ func initializeFilesystem(ctx context.Context, config *common.Config, mountpoint
 		FsName:        "onemount",
 		DisableXAttrs: false,
 		MaxBackground: 1024,
+		MaxWrite:      fs.DefaultMaxIOSize, // allow 1MB IOs instead of the 128KB default
+		MaxReadAhead:  fs.DefaultMaxIOSize,
 		Debug:         debugOn,
 	}
 
@@ -442,17 +842,159 @@ func initializeFilesystem(ctx context.Context, config *common.Config, mountpoint
 	} else {
 		logging.Info().Msg("Not setting AllowOther mount option (user_allow_other is not enabled in /etc/fuse.conf)")
 	}
+	if share != nil || config.Frozen {
+		mountOptions.Options = append(mountOptions.Options, "ro")
+		if config.FuseFD > 0 {
+			logging.Warn().Msg("Serving a pre-opened fuse descriptor, the mount is only read-only if it was mounted with ro")
+		}
+	}
+
+	// Without a pre-opened descriptor, go-fuse mounts with fusermount3 or the
+	// configured helper.
+	fuseMount := mountpoint
+	if config.FuseFD > 0 {
+		fuseMount = common.FuseFDMountpoint(config.FuseFD)
+		logging.Info().Int("fd", config.FuseFD).Msg("Serving pre-opened fuse descriptor")
+	} else {
+		if config.Fusermount != "" {
+			if err := common.UseFusermount(config.Fusermount, filepath.Join(cachePath, "fusermount")); err != nil {
+				filesystem.Stop()
+				return nil, nil, nil, "", "", common.WithFailureReason(errors.Wrap(err, "mount failed"), common.FailureFuseUnavailable)
+			}
+		}
+		if !common.HasFusermount() {
+			filesystem.Stop()
+			return nil, nil, nil, "", "", common.WithFailureReason(errors.New("mount failed: fusermount3 not found. "+
+				"Inside a container or sandbox, pass a mounted /dev/fuse descriptor with --fuse-fd or set a helper with --fusermount"),
+				common.FailureFuseUnavailable)
+		}
+	}
 
 	// Create the FUSE server
-	server, err := fuse.NewServer(filesystem, mountpoint, mountOptions)
+	server, err := fuse.NewServer(filesystem, fuseMount, mountOptions)
 	if err != nil {
 		logging.LogError(err, fmt.Sprintf("Mount failed. Is the mountpoint already in use? (Try running \"fusermount3 -uz %s\")", mountpoint),
 			logging.FieldOperation, "NewServer",
 			logging.FieldPath, mountpoint)
-		return nil, nil, nil, "", "", errors.Wrap(err, "mount failed (is the mountpoint already in use?)")
+		filesystem.Stop()
+		return nil, nil, nil, "", "", common.WithFailureReason(
+			errors.Wrap(err, "mount failed (is the mountpoint already in use?)"), common.FailureMountpointBusy)
+	}
+
+	mount := &servedMount{
+		server:      server,
+		filesystem:  filesystem,
+		mountpoint:  absMountPath,
+		target:      fuseMount,
+		options:     mountOptions,
+		remountable: config.FuseFD == 0,
+	}
+	return filesystem, auth, mount, cachePath, absMountPath, nil
+}
+
+// authFailure marks a failed sign-in, which is reported as a network failure
+// when OneDrive could not be reached.
+func authFailure(err error) error {
+	err = errors.Wrap(err, "authentication failed")
+	if graph.IsOffline(err) {
+		return common.WithFailureReason(err, common.FailureNetwork)
+	}
+	return common.WithFailureReason(err, common.FailureAuth)
+}
+
+// resolveSharedFolder resolves a sharing link to the folder it points to.
+// Offline, the folder recorded in the cache for the same link is used.
+func resolveSharedFolder(ctx context.Context, link, cachePath string, auth *graph.Auth) (*common.SharedFolder, error) {
+	shared, err := graph.ResolveShareURL(ctx, link, auth)
+	if err != nil {
+		if graph.IsOffline(err) {
+			if held, _ := common.ReadSharedFolder(cachePath); held != nil && held.URL == link {
+				logging.Warn().Err(err).Msg("Offline, mounting the shared folder from the cache")
+				return held, nil
+			}
+		}
+		err = errors.Wrap(err, "could not resolve --share-url")
+		if graph.IsOffline(err) {
+			return nil, common.WithFailureReason(err, common.FailureNetwork)
+		}
+		return nil, err
+	}
+	if !shared.Item.IsDir() {
+		return nil, errors.New("--share-url points to a file, only shared folders can be mounted")
+	}
+	return &common.SharedFolder{
+		URL:     link,
+		DriveID: shared.DriveID,
+		ItemID:  shared.Item.ID,
+		Name:    shared.Item.Name,
+	}, nil
+}
+
+// startTreeSync syncs the full directory tree in the background.
+func startTreeSync(ctx context.Context, filesystem *fs.Filesystem, auth *graph.Auth) {
+	logging.Info().Msg("Starting full directory tree synchronization in background...")
+	filesystem.Wg.Add(1)
+	go func(ctx context.Context) {
+		defer filesystem.Wg.Done()
+
+		// Check if context is already cancelled
+		select {
+		case <-ctx.Done():
+			logging.Debug().Msg("Directory tree synchronization cancelled due to context cancellation")
+			return
+		default:
+			// Continue with normal operation
+		}
+
+		if err := filesystem.SyncDirectoryTreeWithContext(ctx, auth); err != nil {
+			// Check if the error is due to context cancellation
+			if ctx.Err() != nil {
+				logging.Debug().Msg("Directory tree synchronization cancelled due to context cancellation")
+				return
+			}
+			logging.LogError(err, "Error syncing directory tree",
+				logging.FieldOperation, "SyncDirectoryTreeWithContext")
+		} else {
+			logging.Info().Msg("Directory tree sync completed successfully")
+		}
+	}(ctx)
+}
+
+// mountSettings converts the configuration settings a running mount applies
+// when it reloads.
+func mountSettings(config *common.Config) fs.MountSettings {
+	return fs.MountSettings{
+		DeltaInterval:       time.Duration(config.DeltaInterval) * time.Second,
+		CacheExpirationDays: config.CacheExpiration,
+		BandwidthLimit:      int64(config.MaxBandwidthMbps) * 1000 * 1000 / 8,
+		OverlayPolicy:       metadata.OverlayPolicy(strings.ToUpper(config.Overlay.DefaultPolicy)),
+		MaxCacheSize:        config.MaxCacheSize,
+		CacheQuota:          config.CacheQuota,
+		Features:            config.Features,
 	}
+}
 
-	return filesystem, auth, server, cachePath, absMountPath, nil
+// filesystemOptions converts the configuration settings a filesystem is
+// created with.
+func filesystemOptions(config *common.Config) fs.FilesystemOptions {
+	opts := fs.FilesystemOptions{
+		CacheExpirationDays:       config.CacheExpiration,
+		CacheCleanupIntervalHours: config.CacheCleanupInterval,
+		MaxCacheSize:              config.MaxCacheSize,
+		CacheQuota:                config.CacheQuota,
+		CacheLedgerDir:            fs.DefaultCacheLedgerDir(),
+		NetworkCache:              fs.NetworkCachePolicy(config.NetworkCache),
+		Ephemeral:                 config.Ephemeral,
+		DeltaScheduler:            sharedDeltaScheduler,
+	}
+	if config.Ephemeral && (opts.MaxCacheSize <= 0 || opts.MaxCacheSize > common.EphemeralMaxCacheSize) {
+		opts.MaxCacheSize = common.EphemeralMaxCacheSize
+	}
+	if config.Ephemeral {
+		// the cache is gone on exit, it takes no share of a limit set for the others
+		opts.CacheQuota = true
+	}
+	return opts
 }
 
 // toRealtimeOptions converts configuration RealtimeConfig to filesystem RealtimeOptions.
@@ -465,32 +1007,46 @@ func toRealtimeOptions(cfg common.RealtimeConfig) fs.RealtimeOptions {
 		ClientState:      cfg.ClientState,
 		Resource:         cfg.Resource,
 		FallbackInterval: time.Duration(cfg.FallbackInterval) * time.Second,
+		LatencySLO:       time.Duration(cfg.LatencySLO) * time.Second,
+		LatencySLOPeriod: time.Duration(cfg.LatencySLOPeriod) * time.Minute,
 	}
 }
 
-// displayStats gathers and displays statistics about the filesystem
-func displayStats(ctx context.Context, config *common.Config, mountpoint string) {
-	// Determine the cache directory
-	if mountpoint == "" {
-		logging.Fatal().Msg("No mountpoint specified. Please provide a mountpoint.")
+// liveStats asks the mount whose D-Bus service name is set for its
+// statistics.
+func liveStats() (*fs.Stats, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
 	}
-	absMountPath, _ := filepath.Abs(mountpoint)
+	defer conn.Close()
+	var data string
+	err = conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".GetStats", 0).Store(&data)
+	if err != nil {
+		return nil, err
+	}
+	var stats fs.Stats
+	if err := json.Unmarshal([]byte(data), &stats); err != nil {
+		return nil, fmt.Errorf("decoding statistics: %w", err)
+	}
+	return &stats, nil
+}
 
+// cachedStats opens the cache of the unmounted drive at absMountPath and
+// computes its statistics.
+func cachedStats(ctx context.Context, config *common.Config, absMountPath string) (*fs.Stats, error) {
 	// Create instance-specific cache directory using systemd unit name escaping.
 	// See initializeFilesystem() for detailed explanation of the escaping logic.
 	cachePath := filepath.Join(config.CacheDir, unit.UnitNamePathEscape(absMountPath))
 
-	// Ensure deterministic D-Bus name for stats mode as well (even though the service won't be awaited).
-	fs.SetDBusServiceNameForMount(absMountPath)
-
 	// Extract instance name for account-based token storage
 	instance := unit.UnitNamePathEscape(absMountPath)
 
 	// Authenticate using account-based storage
 	auth, err := graph.AuthenticateWithAccountStorage(ctx, config.AuthConfig, config.CacheDir, instance, true)
 	if err != nil {
-		logging.Error().Err(err).Msg("Authentication failed")
-		os.Exit(1)
+		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 
 	logging.Info().
@@ -499,41 +1055,114 @@ func displayStats(ctx context.Context, config *common.Config, mountpoint string)
 		Msg("Authentication successful for stats display")
 
 	// Initialize the filesystem without mounting
-	filesystem, err := fs.NewFilesystemWithContext(ctx, auth, cachePath, config.CacheExpiration, config.CacheCleanupInterval, config.MaxCacheSize)
+	filesystem, err := fs.NewFilesystemWithOptions(ctx, auth, cachePath, filesystemOptions(config))
 	if err != nil {
-		logging.Error().Err(err).Msg("Failed to initialize filesystem")
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to initialize filesystem: %w", err)
 	}
-
-	// Get statistics
-	stats, err := filesystem.GetStats()
-	if err != nil {
-		logging.Error().Err(err).Msg("Failed to get statistics")
-		os.Exit(1)
+	if err := filesystem.SetEvictionExemptions(config.EvictionExemptions); err != nil {
+		logging.Warn().Err(err).Msg("Ignoring invalid cache eviction exemptions")
 	}
+	filesystem.SetThumbnailCacheLimit(int64(config.ThumbnailCacheMB) << 20)
+	filesystem.SetDailyTransferCap(uint64(config.DailyTransferCapMB) * 1024 * 1024)
+	defer filesystem.StopBackground()
+	return filesystem.GetStats()
+}
 
-	// Display statistics header
-	fmt.Println("onemount Statistics")
-	fmt.Println("===================")
+// Output formats of --stats.
+const (
+	statsFormatText = "text"
+	statsFormatJSON = "json"
+)
 
-	// Metadata statistics
-	fmt.Printf("\nMetadata Cache:\n")
-	fmt.Printf("  Items in memory: %d\n", stats.MetadataCount)
+// writeStatsJSON writes the statistics as one JSON object, with Mounted
+// telling whether a running mount reported them.
+func writeStatsJSON(w io.Writer, stats *fs.Stats, mounted bool) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Mounted bool
+		*fs.Stats
+	}{mounted, stats})
+}
 
-	// Content cache statistics
-	fmt.Printf("\nContent Cache:\n")
-	fmt.Printf("  Files: %d\n", stats.ContentCount)
-	fmt.Printf("  Total size: %s\n", fs.FormatSize(stats.ContentSize))
-	fmt.Printf("  Cache directory: %s\n", stats.ContentDir)
+// displayStats gathers and displays statistics about the filesystem in the
+// given format. A running mount is asked for them over D-Bus; only an
+// unmounted drive has its database opened here, since a mount holds the
+// database lock.
+func displayStats(ctx context.Context, config *common.Config, mountpoint, format string) {
+	if mountpoint == "" {
+		logging.Fatal().Msg("No mountpoint specified. Please provide a mountpoint.")
+	}
+	absMountPath, _ := filepath.Abs(mountpoint)
+	fs.SetDBusServiceNameForMount(absMountPath)
+
+	stats, err := liveStats()
+	mounted := err == nil
+	if !mounted {
+		if isMountpointMounted(absMountPath) {
+			logging.Error().Err(err).Str("mountpoint", absMountPath).
+				Msg("The mount did not answer over D-Bus; not opening the database of a running mount")
+			os.Exit(1)
+		}
+		logging.Debug().Err(err).Msg("No running mount to query, reading the cache directly")
+		stats, err = cachedStats(ctx, config, absMountPath)
+		if err != nil {
+			logging.Error().Err(err).Msg("Failed to get statistics")
+			os.Exit(1)
+		}
+	}
+	if format == statsFormatJSON {
+		if err := writeStatsJSON(os.Stdout, stats, mounted); err != nil {
+			logging.Error().Err(err).Msg("Failed to write statistics")
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Display statistics header
+	fmt.Println("onemount Statistics")
+	fmt.Println("===================")
+	if mounted {
+		fmt.Println("Source: running mount")
+	} else {
+		fmt.Println("Source: cache, not mounted")
+	}
+
+	// Metadata statistics
+	fmt.Printf("\nMetadata Cache:\n")
+	fmt.Printf("  Items in memory: %d\n", stats.MetadataCount)
+
+	// Content cache statistics
+	fmt.Printf("\nContent Cache:\n")
+	fmt.Printf("  Files: %d\n", stats.ContentCount)
+	fmt.Printf("  Total size: %s\n", fs.FormatSize(stats.ContentSize))
+	fmt.Printf("  Cache directory: %s\n", stats.ContentDir)
 	fmt.Printf("  Expiration: %d days\n", stats.Expiration)
+	fmt.Printf("  Exempted from eviction: %d files (%s)\n", stats.ExemptedCount, fs.FormatSize(stats.ExemptedBytes))
+
+	// Thumbnail cache statistics
+	fmt.Printf("\nThumbnail Cache:\n")
+	fmt.Printf("  Files: %d\n", stats.ThumbnailCount)
+	if stats.ThumbnailLimit > 0 {
+		fmt.Printf("  Total size: %s of %s\n", fs.FormatSize(stats.ThumbnailSize), fs.FormatSize(stats.ThumbnailLimit))
+	} else {
+		fmt.Printf("  Total size: %s (unlimited)\n", fs.FormatSize(stats.ThumbnailSize))
+	}
 
 	// Upload queue statistics
 	fmt.Printf("\nUpload Queue:\n")
 	fmt.Printf("  Total uploads: %d\n", stats.UploadCount)
 	fmt.Printf("  Not started: %d\n", stats.UploadsNotStarted)
 	fmt.Printf("  In progress: %d\n", stats.UploadsInProgress)
+	fmt.Printf("  Verifying: %d\n", stats.UploadsVerifying)
 	fmt.Printf("  Completed: %d\n", stats.UploadsCompleted)
 	fmt.Printf("  Errors: %d\n", stats.UploadsErrored)
+	for reason, count := range stats.UploadsDeferred {
+		fmt.Printf("  Deferred (%s): %d\n", reason, count)
+	}
+	if count := stats.UploadsDeferred[fs.DeferredTooLarge]; count > 0 {
+		fmt.Printf("  %d file(s) exceed OneDrive's 250 GB limit and will not upload until reduced\n", count)
+	}
 
 	// Hydration/download queue statistics
 	fmt.Printf("\nHydration Queue:\n")
@@ -551,12 +1180,76 @@ func displayStats(ctx context.Context, config *common.Config, mountpoint string)
 	fmt.Printf("  Low-priority depth: %d\n", stats.MetadataQueueLowDepth)
 	fmt.Printf("  Avg wait (ms): %.2f\n", stats.MetadataQueueAvgWaitMs)
 
+	// Kernel attribute cache statistics
+	fmt.Printf("\nAttribute Cache:\n")
+	fmt.Printf("  Hits: %d\n", stats.AttrCacheHits)
+	fmt.Printf("  Misses: %d\n", stats.AttrCacheMisses)
+
+	// Read-ahead statistics
+	fmt.Printf("\nRead-ahead:\n")
+	fmt.Printf("  Sequential reads: %d\n", stats.ReadAheadSequentialReads)
+	fmt.Printf("  Random reads: %d\n", stats.ReadAheadRandomReads)
+	fmt.Printf("  Prefetches: %d (%s)\n", stats.ReadAheadPrefetches, fs.FormatSize(int64(stats.ReadAheadPrefetchedBytes)))
+
+	// Write coalescing statistics
+	fmt.Printf("\nWrite Coalescing:\n")
+	fmt.Printf("  Buffered writes: %d\n", stats.CoalescedWrites)
+	fmt.Printf("  Cache writes: %d\n", stats.CoalescedFlushes)
+	fmt.Printf("  Appended file uploads: %d (%d fsyncs coalesced)\n", stats.AppendUploads, stats.AppendCoalescedFsyncs)
+
+	// Search indexer statistics
+	fmt.Printf("\nSearch Indexers:\n")
+	fmt.Printf("  Files opened: %d\n", stats.IndexerOpens)
+	fmt.Printf("  Downloads refused: %d\n", stats.IndexerHydrationsRefused)
+
+	// Transfer chunk sizes
+	fmt.Printf("\nTransfer Chunks (network %q):\n", stats.Chunks.Network)
+	for _, dir := range []struct {
+		name  string
+		stats fs.ChunkStats
+	}{{"Upload", stats.Chunks.Upload}, {"Download", stats.Chunks.Download}} {
+		fmt.Printf("  %s: %s chunks", dir.name, fs.FormatSize(int64(dir.stats.ChunkSize)))
+		if dir.stats.Chunks > 0 {
+			fmt.Printf(", %s/s, %.1fs per chunk", fs.FormatSize(int64(dir.stats.Throughput)), dir.stats.ChunkTime.Seconds())
+		}
+		fmt.Printf(" (%d measured, %d failed)\n", dir.stats.Chunks, dir.stats.Failures)
+	}
+
+	// Resource usage accounting
+	usage := stats.Usage
+	fmt.Printf("\nResource Usage:\n")
+	fmt.Printf("  Today: %s up, %s down, %d API calls, %.1fs CPU\n",
+		fs.FormatSize(int64(usage.Today.UploadedBytes)), fs.FormatSize(int64(usage.Today.DownloadedBytes)),
+		usage.Today.TotalAPICalls(), usage.Today.CPUSeconds)
+	fmt.Printf("  Last 7 days: %s up, %s down, %d API calls, %.1fs CPU\n",
+		fs.FormatSize(int64(usage.Week.UploadedBytes)), fs.FormatSize(int64(usage.Week.DownloadedBytes)),
+		usage.Week.TotalAPICalls(), usage.Week.CPUSeconds)
+	fmt.Printf("  Cache disk usage: %s\n", fs.FormatSize(usage.CacheBytes))
+	if usage.DailyTransferCap > 0 {
+		fmt.Printf("  Daily transfer cap: %s (exceeded: %v, paused hydrations: %d)\n",
+			fs.FormatSize(int64(usage.DailyTransferCap)), usage.CapExceeded, usage.DeferredItems)
+	}
+	endpoints := make([]string, 0, len(usage.Week.APICalls))
+	for endpoint := range usage.Week.APICalls {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return usage.Week.APICalls[endpoints[i]] > usage.Week.APICalls[endpoints[j]]
+	})
+	if len(endpoints) > 0 {
+		fmt.Printf("  API calls by endpoint (last 7 days):\n")
+	}
+	for _, endpoint := range endpoints {
+		fmt.Printf("    %s: %d\n", endpoint, usage.Week.APICalls[endpoint])
+	}
+
 	// File status statistics
 	fmt.Printf("\nFile Statuses:\n")
 	fmt.Printf("  Cloud: %d\n", stats.StatusCloud)
 	fmt.Printf("  Local: %d\n", stats.StatusLocal)
 	fmt.Printf("  LocalModified: %d\n", stats.StatusLocalModified)
 	fmt.Printf("  Syncing: %d\n", stats.StatusSyncing)
+	fmt.Printf("  Verifying: %d\n", stats.StatusVerifying)
 	fmt.Printf("  Downloading: %d\n", stats.StatusDownloading)
 	fmt.Printf("  OutofSync: %d\n", stats.StatusOutofSync)
 	fmt.Printf("  Error: %d\n", stats.StatusError)
@@ -569,6 +1262,29 @@ func displayStats(ctx context.Context, config *common.Config, mountpoint string)
 	// Offline status
 	fmt.Printf("\nOffline Status: %v\n", stats.IsOffline)
 
+	// OneDrive service health, checked after repeated server errors
+	if health := stats.ServiceHealth; !health.CheckedAt.IsZero() {
+		fmt.Printf("\nOneDrive Service:\n")
+		if health.Degraded {
+			fmt.Printf("  %s\n", fs.ServiceDegradedMessage)
+		} else {
+			fmt.Printf("  No degradation detected\n")
+		}
+		fmt.Printf("  Checked: %s (%s)\n", health.CheckedAt.Format(time.RFC3339), health.Source)
+		fmt.Printf("  Detail: %s\n", health.Detail)
+		for _, incident := range health.Incidents {
+			fmt.Printf("  %s %s (%s, %s): %s\n", incident.Classification, incident.ID, incident.Service, incident.Status, incident.Title)
+		}
+	}
+
+	// Cached names shadowed by a sibling spelled in another Unicode form
+	if len(stats.NameCollisions) > 0 {
+		fmt.Printf("\nName Collisions (rename on OneDrive or set nameNormalization: none):\n")
+		for _, path := range stats.NameCollisions {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+
 	// Realtime transport status
 	fmt.Printf("\nRealtime Notifications:\n")
 	fmt.Printf("  Mode: %s\n", stats.RealtimeMode)
@@ -582,6 +1298,13 @@ func displayStats(ctx context.Context, config *common.Config, mountpoint string)
 	if stats.RealtimeLastError != "" {
 		fmt.Printf("  Last error: %s\n", stats.RealtimeLastError)
 	}
+	if latency := stats.RealtimeLatency; latency.Samples > 0 {
+		fmt.Printf("  Change latency (last hour, %d changes): median %s, 95th percentile %s, max %s\n",
+			latency.Samples, latency.P50.Round(time.Second), latency.P95.Round(time.Second), latency.Max.Round(time.Second))
+		if latency.SLOBreached {
+			fmt.Printf("  Changes arrive later than the %s objective\n", latency.SLO)
+		}
+	}
 
 	// BBolt database statistics
 	fmt.Printf("\nBBolt Database:\n")
@@ -611,102 +1334,1167 @@ func displayStats(ctx context.Context, config *common.Config, mountpoint string)
 		for ext := range stats.FileExtensions {
 			extensions = append(extensions, ext)
 		}
-		sort.Strings(extensions)
+		sort.Strings(extensions)
+
+		for _, ext := range extensions {
+			fmt.Printf("  %s: %d\n", ext, stats.FileExtensions[ext])
+		}
+	}
+
+	// File size statistics
+	if len(stats.FileSizeRanges) > 0 {
+		fmt.Printf("\nFile Size Distribution:\n")
+		// Define order for size ranges
+		sizeRangeOrder := []string{
+			"Empty (0 bytes)",
+			"< 1 KB",
+			"1 KB - 1 MB",
+			"1 MB - 10 MB",
+			"10 MB - 100 MB",
+			"100 MB - 1 GB",
+			"> 1 GB",
+		}
+
+		for _, sizeRange := range sizeRangeOrder {
+			if count, exists := stats.FileSizeRanges[sizeRange]; exists {
+				fmt.Printf("  %s: %d\n", sizeRange, count)
+			}
+		}
+	}
+
+	// File age statistics
+	if len(stats.FileAgeRanges) > 0 {
+		fmt.Printf("\nFile Age Distribution:\n")
+		// Define order for age ranges
+		ageRangeOrder := []string{
+			"Today",
+			"This week",
+			"This month",
+			"Last 3 months",
+			"This year",
+			"Older than a year",
+		}
+
+		for _, ageRange := range ageRangeOrder {
+			if count, exists := stats.FileAgeRanges[ageRange]; exists {
+				fmt.Printf("  %s: %d\n", ageRange, count)
+			}
+		}
+	}
+}
+
+// setupLogging configures the logger based on the configuration
+func runMetadataMaintenance(cacheDir string, migrate bool) error {
+	if cacheDir == "" {
+		return fmt.Errorf("cache directory is required for metadata maintenance")
+	}
+	dbPath := filepath.Join(cacheDir, "onemount.db")
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return errors.Wrap(err, "open metadata db")
+	}
+	defer db.Close()
+
+	if migrate {
+		report, err := fs.MigrateLegacyMetadata(db)
+		if err != nil {
+			return err
+		}
+		logging.Info().Int("migrated", report.Migrated).Int("legacy_keys", report.LegacyKeys).Bool("dropped_legacy", report.DroppedLegacy).Msg("metadata migration complete")
+		for _, detail := range report.ErrorDetails {
+			logging.Warn().Msg(detail)
+		}
+		return nil
+	}
+
+	report, err := fs.ValidateMetadataBucket(db)
+	if err != nil {
+		return err
+	}
+	logging.Info().Int("checked", report.Checked).Int("invalid", report.Invalid).Int("legacy_keys", report.LegacyKeys).Msg("metadata validation complete")
+	for _, detail := range report.ErrorDetails {
+		logging.Warn().Msg(detail)
+	}
+	if report.MissingV2 {
+		return fmt.Errorf("metadata_v2 bucket missing")
+	}
+	if report.Invalid > 0 {
+		return fmt.Errorf("metadata validation found %d invalid entries", report.Invalid)
+	}
+	return nil
+}
+
+// frozenXAttr is the extended attribute the filesystem uses to freeze files.
+const frozenXAttr = "user.onemount.frozen"
+
+// runFreeze toggles the frozen flag on files inside a running mount. The
+// mounted filesystem does the actual work when the attribute changes.
+func runFreeze(freezePath, unfreezePath string) error {
+	if freezePath != "" {
+		if err := syscall.Setxattr(freezePath, frozenXAttr, []byte("1"), 0); err != nil {
+			return fmt.Errorf("freeze %s: %w", freezePath, err)
+		}
+		fmt.Printf("Frozen: %s\n", freezePath)
+	}
+	if unfreezePath != "" {
+		if err := syscall.Removexattr(unfreezePath, frozenXAttr); err != nil {
+			if err == syscall.ENODATA {
+				return fmt.Errorf("unfreeze %s: file is not frozen", unfreezePath)
+			}
+			return fmt.Errorf("unfreeze %s: %w", unfreezePath, err)
+		}
+		fmt.Printf("Unfrozen: %s\n", unfreezePath)
+	}
+	return nil
+}
+
+// Policy attributes understood by the mounted filesystem.
+const (
+	pinXAttr     = "user.onemount.pin"
+	overlayXAttr = "user.onemount.overlay"
+	ignoreXAttr  = "user.onemount.ignore"
+)
+
+// runPolicy exports or imports the offline-availability policy of a running
+// mount. Export copies the mount's .onemount/policy.yml to file, or to stdout
+// when file is empty or "-"; import sets the policy attributes path by path,
+// so applying the same file twice changes nothing. Paths missing from the
+// mount are reported and skipped.
+func runPolicy(action, mountpoint, file string) error {
+	if action == "export" {
+		data, err := os.ReadFile(filepath.Join(mountpoint, ".onemount", "policy.yml"))
+		if err != nil {
+			return fmt.Errorf("export policy: %w", err)
+		}
+		if file == "" || file == "-" {
+			_, err = os.Stdout.Write(data)
+		} else {
+			err = os.WriteFile(file, data, 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("export policy: %w", err)
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("import policy: %w", err)
+	}
+	var doc fs.PolicyDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("import policy: %w", err)
+	}
+
+	type setting struct{ path, name, value string }
+	var settings []setting
+	for _, p := range doc.Pinned {
+		settings = append(settings, setting{p, pinXAttr, "always"})
+	}
+	for _, p := range doc.OnlineOnly {
+		settings = append(settings, setting{p, pinXAttr, "never"})
+	}
+	overlayPaths := make([]string, 0, len(doc.Overlay))
+	for p := range doc.Overlay {
+		overlayPaths = append(overlayPaths, p)
+	}
+	sort.Strings(overlayPaths)
+	for _, p := range overlayPaths {
+		settings = append(settings, setting{p, overlayXAttr, doc.Overlay[p]})
+	}
+	if len(doc.Ignore) > 0 {
+		settings = append(settings, setting{"/", ignoreXAttr, strings.Join(doc.Ignore, "\n")})
+	}
+
+	applied, skipped := 0, 0
+	for _, s := range settings {
+		target := filepath.Join(mountpoint, filepath.FromSlash(s.path))
+		if err := syscall.Setxattr(target, s.name, []byte(s.value), 0); err != nil {
+			if err == syscall.ENOENT {
+				fmt.Printf("Skipped %s: not found\n", s.path)
+				skipped++
+				continue
+			}
+			return fmt.Errorf("import policy: %s: %w", s.path, err)
+		}
+		applied++
+	}
+	fmt.Printf("Applied %d policy settings (%d skipped)\n", applied, skipped)
+	return nil
+}
+
+// reportCrashes prints how often the mount at mountpoint crashed and where
+// its crash reports are. It only reads files, so the mount may be running.
+func reportCrashes(config *common.Config, mountpoint string) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("crash reports: %w", err)
+	}
+	cachePath := filepath.Join(config.CacheDir, unit.UnitNamePathEscape(absMountPath))
+	summary, err := fs.ReadCrashSummary(cachePath)
+	if err != nil {
+		return fmt.Errorf("crash reports: %w", err)
+	}
+	reports, err := fs.CrashReports(cachePath)
+	if err != nil {
+		return fmt.Errorf("crash reports: %w", err)
+	}
+	fmt.Print(formatCrashes(summary, reports))
+	return nil
+}
+
+// formatCrashes describes the crash counter and the crash reports kept.
+func formatCrashes(summary fs.CrashSummary, reports []string) string {
+	if summary.Count == 0 {
+		return "Crashes: none\n"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Crashes: %d, last %s\n", summary.Count, summary.Last.Format(time.RFC3339))
+	fmt.Fprintf(&b, "  %s\n", summary.LastReason)
+	if len(reports) > 0 {
+		fmt.Fprintf(&b, "Crash reports (attach them to bug reports):\n")
+		for _, report := range reports {
+			fmt.Fprintf(&b, "  %s\n", report)
+		}
+	}
+	return b.String()
+}
+
+// runReset soft-deletes the cache of the stopped mount at mountpoint so it
+// starts over from OneDrive, refusing while local changes would be lost
+// unless forced. The other mounts and the saved sign-in are kept.
+func runReset(config *common.Config, mountpoint string, force bool) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("reset: %w", err)
+	}
+	if isMountpointMounted(absMountPath) {
+		return fmt.Errorf("reset: %s is mounted, unmount it first", absMountPath)
+	}
+	cachePath := filepath.Join(config.CacheDir, unit.UnitNamePathEscape(absMountPath))
+	report, err := fs.ResetCache(config.CacheDir, cachePath, force)
+	if report != nil {
+		fmt.Print(formatReset(report, err == nil))
+	}
+	if errors.Is(err, fs.ErrUnsyncedChanges) {
+		return fmt.Errorf("reset: not resetting the cache of %s, run it again with --force to lose these changes", absMountPath)
+	}
+	if err != nil {
+		return fmt.Errorf("reset: %w", err)
+	}
+	return nil
+}
+
+// formatReset describes a cache reset, or the local changes that kept it
+// from happening.
+func formatReset(report *fs.CacheResetReport, done bool) string {
+	var b strings.Builder
+	if len(report.Unsynced) > 0 {
+		if done {
+			fmt.Fprintf(&b, "Lost %d local changes not uploaded yet:\n", len(report.Unsynced))
+		} else {
+			fmt.Fprintf(&b, "%d local changes are not uploaded yet and would be lost:\n", len(report.Unsynced))
+		}
+		for _, change := range report.Unsynced {
+			fmt.Fprintf(&b, "  %s (%s)\n", change.Path, change.Reason)
+		}
+	}
+	if done {
+		if report.Trash == "" {
+			b.WriteString("Nothing to reset: the mount has no cache\n")
+		} else {
+			fmt.Fprintf(&b, "Cache reset; the old cache is in %s until the next reset\n", report.Trash)
+		}
+	}
+	return b.String()
+}
+
+// defaultBundleName is the support bundle written by "onemount doctor --bundle"
+// when no file name is given.
+const defaultBundleName = "onemount-support.tar.gz"
+
+// runDoctor writes a support bundle for the mount at mountpoint. A running
+// mount writes a fresh bundle over D-Bus; otherwise the last bundle it saved
+// in its cache directory is copied.
+func runDoctor(config *common.Config, mountpoint, target string) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("support bundle: %w", err)
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return fmt.Errorf("support bundle: %w", err)
+	}
+
+	fs.SetDBusServiceNameForMount(absMountPath)
+	if conn, err := dbus.ConnectSessionBus(); err == nil {
+		call := conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+			Call(fs.DBusInterface+".WriteSupportBundle", 0, absTarget)
+		conn.Close()
+		if call.Err == nil {
+			fmt.Printf("Support bundle written to %s\n", absTarget)
+			return nil
+		}
+		logging.Debug().Err(call.Err).Msg("Mount did not write a support bundle, using its last snapshot")
+	}
+
+	snapshot := filepath.Join(config.CacheDir, unit.UnitNamePathEscape(absMountPath), fs.SupportSnapshotName)
+	info, err := os.Stat(snapshot)
+	if err != nil {
+		return fmt.Errorf("support bundle: %s is not mounted and has no saved snapshot: %w", mountpoint, err)
+	}
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		return fmt.Errorf("support bundle: %w", err)
+	}
+	if err := os.WriteFile(absTarget, data, 0600); err != nil {
+		return fmt.Errorf("support bundle: %w", err)
+	}
+	fmt.Printf("%s is not mounted, copied its last support bundle (saved %s) to %s\n",
+		mountpoint, info.ModTime().Format(time.RFC3339), absTarget)
+	return nil
+}
+
+// defaultEventCount is the number of events shown by "onemount events".
+const defaultEventCount = 50
+
+// runEvents prints the most recent notable events of the mount at mountpoint.
+func runEvents(mountpoint string, count int) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("events: %w", err)
+	}
+	fs.SetDBusServiceNameForMount(absMountPath)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("events: %w", err)
+	}
+	defer conn.Close()
+
+	var events []fs.DBusRecentEvent
+	err = conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".GetRecentEvents", 0, int32(count)).Store(&events)
+	if err != nil {
+		return fmt.Errorf("events: %s is not mounted or does not answer: %w", mountpoint, err)
+	}
+	if len(events) == 0 {
+		fmt.Println("No events recorded yet")
+		return nil
+	}
+	for _, event := range events {
+		fmt.Println(formatEvent(event))
+	}
+	return nil
+}
+
+// formatEvent renders an event as a single line for "onemount events".
+func formatEvent(event fs.DBusRecentEvent) string {
+	var line strings.Builder
+	line.WriteString(time.Unix(event.Time, 0).Format(time.RFC3339))
+	fmt.Fprintf(&line, "  %-8s", event.Kind)
+	if event.Path != "" {
+		line.WriteString("  " + event.Path)
+	}
+	if event.Message != "" {
+		line.WriteString("  " + event.Message)
+	}
+	if event.Suppressed > 0 {
+		fmt.Fprintf(&line, "  (+%d similar events suppressed)", event.Suppressed)
+	}
+	return line.String()
+}
+
+// jobPollInterval is how often commands following a job refresh its progress.
+const jobPollInterval = 500 * time.Millisecond
+
+// runOffline makes folder, inside the mount at mountpoint, available offline
+// and follows the job until it finishes. Interrupting the command cancels the
+// job; the folder stays pinned.
+func runOffline(mountpoint, folder string) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("offline: %w", err)
+	}
+	absFolder, err := filepath.Abs(folder)
+	if err != nil {
+		return fmt.Errorf("offline: %w", err)
+	}
+	rel, err := filepath.Rel(absMountPath, absFolder)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return fmt.Errorf("offline: %s is not inside %s", folder, mountpoint)
+	}
+	itemPath := "/"
+	if rel != "." {
+		itemPath += filepath.ToSlash(rel)
+	}
+
+	fs.SetDBusServiceNameForMount(absMountPath)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("offline: %w", err)
+	}
+	defer conn.Close()
+	obj := conn.Object(fs.DBusServiceName, fs.DBusObjectPath)
+
+	var jobID string
+	if err := obj.Call(fs.DBusInterface+".MakeAvailableOffline", 0, itemPath).Store(&jobID); err != nil {
+		return fmt.Errorf("offline: %s is not mounted or does not answer: %w", mountpoint, err)
+	}
+
+	return followJob(obj, "offline", jobID, "Cancelled; the folder stays pinned and is downloaded on demand")
+}
+
+// followJob prints the progress of the job jobID of the mount obj until the
+// job finishes. Interrupting the command cancels the job and prints
+// cancelled.
+func followJob(obj dbus.BusObject, command, jobID, cancelled string) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		var job fs.DBusJob
+		if err := obj.Call(fs.DBusInterface+".GetJob", 0, jobID).Store(&job); err != nil {
+			return fmt.Errorf("%s: %w", command, err)
+		}
+		fmt.Printf("\r%-72s", formatJob(job))
+		if job.State != fs.JobRunning {
+			fmt.Println()
+			if job.State == fs.JobFailed {
+				return fmt.Errorf("%s: %s", command, job.Message)
+			}
+			return nil
+		}
+		select {
+		case <-interrupt:
+			fmt.Println()
+			if err := obj.Call(fs.DBusInterface+".CancelJob", 0, jobID).Err; err != nil {
+				return fmt.Errorf("%s: %w", command, err)
+			}
+			fmt.Println(cancelled)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJobs lists the running and recently finished jobs of the mount at
+// mountpoint, or cancels the job cancelID.
+func runJobs(mountpoint, cancelID string) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("jobs: %w", err)
+	}
+	fs.SetDBusServiceNameForMount(absMountPath)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("jobs: %w", err)
+	}
+	defer conn.Close()
+	obj := conn.Object(fs.DBusServiceName, fs.DBusObjectPath)
+
+	if cancelID != "" {
+		if err := obj.Call(fs.DBusInterface+".CancelJob", 0, cancelID).Err; err != nil {
+			return fmt.Errorf("jobs: %w", err)
+		}
+		fmt.Printf("Cancelled %s\n", cancelID)
+		return nil
+	}
+
+	var jobs []fs.DBusJob
+	if err := obj.Call(fs.DBusInterface+".ListJobs", 0).Store(&jobs); err != nil {
+		return fmt.Errorf("jobs: %s is not mounted or does not answer: %w", mountpoint, err)
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No jobs")
+		return nil
+	}
+	for _, job := range jobs {
+		fmt.Printf("%-16s %s\n", job.ID, formatJob(job))
+	}
+	return nil
+}
+
+// formatJob renders the progress of a job on one line.
+func formatJob(job fs.DBusJob) string {
+	var line strings.Builder
+	line.WriteString(job.State)
+	if job.Phase != "" {
+		line.WriteString(" (" + job.Phase + ")")
+	}
+	if job.Path != "" {
+		line.WriteString(" " + job.Path)
+	}
+	if job.Total > 0 {
+		fmt.Fprintf(&line, ": %d/%d", job.Done, job.Total)
+	}
+	if job.BytesTotal > 0 {
+		fmt.Fprintf(&line, ", %s of %s",
+			fs.FormatSize(int64(job.BytesDone)), fs.FormatSize(int64(job.BytesTotal)))
+	}
+	if job.Failed > 0 {
+		fmt.Fprintf(&line, ", %d failed", job.Failed)
+	}
+	if job.Message != "" && job.State == fs.JobFailed {
+		line.WriteString(" - " + job.Message)
+	}
+	return line.String()
+}
+
+// runCachePlan implements "onemount cache plan": it asks the mount at
+// mountpoint which cached files a cleanup would evict under the current
+// settings, without evicting anything.
+func runCachePlan(mountpoint string) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("cache plan: %w", err)
+	}
+	fs.SetDBusServiceNameForMount(absMountPath)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("cache plan: %w", err)
+	}
+	defer conn.Close()
+
+	var (
+		expirationDays                     int32
+		maxCacheSize, cacheSize, reclaimed int64
+		files                              []fs.DBusCachePlanFile
+	)
+	err = conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".PlanCacheCleanup", 0).
+		Store(&expirationDays, &maxCacheSize, &cacheSize, &reclaimed, &files)
+	if err != nil {
+		return fmt.Errorf("cache plan: %s is not mounted or does not answer: %w", mountpoint, err)
+	}
+
+	limit := "no size limit"
+	if maxCacheSize > 0 {
+		limit = fs.FormatSize(maxCacheSize) + " limit"
+	}
+	expiration := "files never expire"
+	if expirationDays > 0 {
+		expiration = fmt.Sprintf("files expire after %d days", expirationDays)
+	}
+	fmt.Printf("Cache: %s (%s), %s\n", fs.FormatSize(cacheSize), limit, expiration)
+	if len(files) == 0 {
+		fmt.Println("Nothing would be evicted")
+		return nil
+	}
+	fmt.Printf("Would evict %d files, reclaiming %s:\n", len(files), fs.FormatSize(reclaimed))
+	for _, file := range files {
+		fmt.Println("  " + formatCachePlanFile(file))
+	}
+	return nil
+}
+
+// formatCachePlanFile renders a file of a cache cleanup plan on one line.
+func formatCachePlanFile(file fs.DBusCachePlanFile) string {
+	name := file.Path
+	if name == "" {
+		name = file.ID
+	}
+	return fmt.Sprintf("%-10s %10s  %s  %s", file.Reason, fs.FormatSize(file.Size),
+		time.Unix(file.LastAccessed, 0).Format("2006-01-02"), name)
+}
+
+// runReconcile implements "onemount reconcile": it asks the mount containing
+// folder to enumerate the folder again from OneDrive, repair what disagrees
+// and prints the fixes.
+func runReconcile(folder string) error {
+	absFolder, err := filepath.Abs(folder)
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+	mounts, err := os.ReadFile(common.MountsFile)
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+	mountpoint := common.OneMountMountFor(string(mounts), absFolder)
+	if mountpoint == "" {
+		return fmt.Errorf("reconcile: %s is not inside a OneMount mount", folder)
+	}
+	itemPath := "/"
+	if rel, _ := filepath.Rel(mountpoint, absFolder); rel != "." {
+		itemPath += filepath.ToSlash(rel)
+	}
+
+	fs.SetDBusServiceNameForMount(mountpoint)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+	defer conn.Close()
+
+	var (
+		folders int32
+		fixes   []fs.DBusReconcileFix
+		errs    []string
+	)
+	err = conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".ReconcileSubtree", 0, itemPath).
+		Store(&folders, &fixes, &errs)
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+
+	for _, fix := range fixes {
+		fmt.Printf("  %-9s %s\n", fix.Kind, fix.Path)
+	}
+	for _, msg := range errs {
+		fmt.Printf("  %-9s %s\n", "failed", msg)
+	}
+	fmt.Printf("Reconciled %d folders: %d fixes, %d failed\n", folders, len(fixes), len(errs))
+	if len(errs) > 0 {
+		return fmt.Errorf("reconcile: %d folders could not be enumerated", len(errs))
+	}
+	return nil
+}
+
+// runFolders implements "onemount folders": it lists the folders of the mount
+// at mountpoint holding more items than its folder item warning.
+func runFolders(mountpoint string) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("folders: %w", err)
+	}
+	fs.SetDBusServiceNameForMount(absMountPath)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("folders: %w", err)
+	}
+	defer conn.Close()
+
+	var folders []fs.DBusFolderItemCount
+	err = conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".ListOversizedFolders", 0, int32(0)).
+		Store(&folders)
+	if err != nil {
+		return fmt.Errorf("folders: %s is not mounted or does not answer: %w", mountpoint, err)
+	}
+
+	if len(folders) == 0 {
+		fmt.Println("No folder is past the folder item warning")
+		return nil
+	}
+	fmt.Printf("%d folders hold more items than OneDrive handles well:\n", len(folders))
+	for _, folder := range folders {
+		fmt.Printf("  %7d  %s\n", folder.Items, folder.Path)
+	}
+	return nil
+}
+
+// runVerifyFile implements "onemount verify-file": it asks the mount holding
+// file to download it again and compare it with the cached copy, which is
+// replaced when they differ.
+func runVerifyFile(file string) error {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return fmt.Errorf("verify-file: %w", err)
+	}
+	mounts, err := os.ReadFile(common.MountsFile)
+	if err != nil {
+		return fmt.Errorf("verify-file: %w", err)
+	}
+	mountpoint := common.OneMountMountFor(string(mounts), absFile)
+	if mountpoint == "" {
+		return fmt.Errorf("verify-file: %s is not inside a OneMount mount", file)
+	}
+	rel, _ := filepath.Rel(mountpoint, absFile)
+	itemPath := "/" + filepath.ToSlash(rel)
+
+	fs.SetDBusServiceNameForMount(mountpoint)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("verify-file: %w", err)
+	}
+	defer conn.Close()
+
+	var (
+		match, repaired bool
+		problem         string
+	)
+	err = conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".VerifyFile", 0, itemPath).
+		Store(&match, &repaired, &problem)
+	if err != nil {
+		return fmt.Errorf("verify-file: %w", err)
+	}
+	if match {
+		fmt.Printf("%s: the cached copy matches OneDrive\n", file)
+		return nil
+	}
+	if repaired {
+		return fmt.Errorf("verify-file: %s: %s; the cached copy was replaced", file, problem)
+	}
+	return fmt.Errorf("verify-file: %s: %s", file, problem)
+}
+
+// runDownloadURL prints a URL from which the file can be downloaded directly
+// from OneDrive for about an hour, without a token.
+func runDownloadURL(file string) error {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return fmt.Errorf("download-url: %w", err)
+	}
+	mounts, err := os.ReadFile(common.MountsFile)
+	if err != nil {
+		return fmt.Errorf("download-url: %w", err)
+	}
+	mountpoint := common.OneMountMountFor(string(mounts), absFile)
+	if mountpoint == "" {
+		return fmt.Errorf("download-url: %s is not inside a OneMount mount", file)
+	}
+	rel, _ := filepath.Rel(mountpoint, absFile)
+	itemPath := "/" + filepath.ToSlash(rel)
+
+	fs.SetDBusServiceNameForMount(mountpoint)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("download-url: %w", err)
+	}
+	defer conn.Close()
+
+	var url string
+	err = conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".GetTemporaryDownloadURL", 0, itemPath).
+		Store(&url)
+	if err != nil {
+		return fmt.Errorf("download-url: %w", err)
+	}
+	fmt.Println(url)
+	return nil
+}
+
+// runSyncNow uploads or downloads the file right away, ahead of all queued
+// transfers, and waits until it is done.
+func runSyncNow(file string) error {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+	mounts, err := os.ReadFile(common.MountsFile)
+	if err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+	mountpoint := common.OneMountMountFor(string(mounts), absFile)
+	if mountpoint == "" {
+		return fmt.Errorf("sync: %s is not inside a OneMount mount", file)
+	}
+	rel, _ := filepath.Rel(mountpoint, absFile)
+	itemPath := "/" + filepath.ToSlash(rel)
+
+	fs.SetDBusServiceNameForMount(mountpoint)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+	defer conn.Close()
+
+	var result string
+	err = conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".SyncNow", 0, itemPath).
+		Store(&result)
+	if err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+	switch fs.FileSyncResult(result) {
+	case fs.SyncUploaded:
+		fmt.Printf("%s: uploaded to OneDrive\n", file)
+	case fs.SyncDownloaded:
+		fmt.Printf("%s: downloaded from OneDrive\n", file)
+	default:
+		fmt.Printf("%s: already up to date\n", file)
+	}
+	return nil
+}
+
+// runPin implements "onemount pin" and "onemount unpin" (command) for paths
+// inside running mounts. Pinning starts a job in the background downloading
+// the item and everything below it, like "onemount offline" without waiting
+// for it; unpinning removes the pins of the item and everything below it.
+func runPin(command string, paths []string) error {
+	mounts, err := os.ReadFile(common.MountsFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", command, err)
+	}
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("%s: %w", command, err)
+	}
+	defer conn.Close()
+
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", command, err)
+		}
+		mountpoint := common.OneMountMountFor(string(mounts), absPath)
+		if mountpoint == "" {
+			return fmt.Errorf("%s: %s is not inside a OneMount mount", command, path)
+		}
+		obj := conn.Object(fs.DBusServiceNameForMount(mountpoint), fs.DBusObjectPath)
+		itemPath := mountItemPath(mountpoint, absPath)
+		if command == "unpin" {
+			if err := obj.Call(fs.DBusInterface+".Unpin", 0, itemPath).Err; err != nil {
+				return fmt.Errorf("unpin: %s: %w", path, err)
+			}
+			fmt.Printf("Unpinned %s\n", path)
+			continue
+		}
+		var jobID string
+		if err := obj.Call(fs.DBusInterface+".MakeAvailableOffline", 0, itemPath).Store(&jobID); err != nil {
+			return fmt.Errorf("pin: %s: %w", path, err)
+		}
+		fmt.Printf("Pinned %s, downloading in the background as job %s\n", path, jobID)
+	}
+	return nil
+}
+
+// runMove implements "onemount move": it moves source to destination, into
+// destination when that is a folder. Within one mount this is a rename.
+// Between two mounts, found through their D-Bus services, the mount holding
+// source copies the item into the other one, on OneDrive when both are signed
+// in to the same account, and then deletes the original once the other mount
+// has it on OneDrive. The command follows
+// that job until it finishes.
+func runMove(source, destination string) error {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return fmt.Errorf("move: %w", err)
+	}
+	absDest, err := filepath.Abs(destination)
+	if err != nil {
+		return fmt.Errorf("move: %w", err)
+	}
+	if info, err := os.Stat(absDest); err == nil && info.IsDir() {
+		absDest = filepath.Join(absDest, filepath.Base(absSource))
+	}
+	if _, err := os.Lstat(absDest); err == nil {
+		return fmt.Errorf("move: %s already exists", absDest)
+	}
+	mounts, err := os.ReadFile(common.MountsFile)
+	if err != nil {
+		return fmt.Errorf("move: %w", err)
+	}
+	sourceMount := common.OneMountMountFor(string(mounts), absSource)
+	if sourceMount == "" || sourceMount == absSource {
+		return fmt.Errorf("move: %s is not inside a OneMount mount", source)
+	}
+	destMount := common.OneMountMountFor(string(mounts), filepath.Dir(absDest))
+	if destMount == "" {
+		return fmt.Errorf("move: %s is not inside a OneMount mount", destination)
+	}
+	if destMount == sourceMount {
+		if err := os.Rename(absSource, absDest); err != nil {
+			return fmt.Errorf("move: %w", err)
+		}
+		return nil
+	}
 
-		for _, ext := range extensions {
-			fmt.Printf("  %s: %d\n", ext, stats.FileExtensions[ext])
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("move: %w", err)
+	}
+	defer conn.Close()
+	sourceService := fs.DBusServiceNameForMount(sourceMount)
+	destService := fs.DBusServiceNameForMount(destMount)
+	for _, mount := range []string{sourceMount, destMount} {
+		var running bool
+		err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, fs.DBusServiceNameForMount(mount)).
+			Store(&running)
+		if err != nil || !running {
+			return fmt.Errorf("move: %s does not answer on D-Bus", mount)
 		}
 	}
 
-	// File size statistics
-	if len(stats.FileSizeRanges) > 0 {
-		fmt.Printf("\nFile Size Distribution:\n")
-		// Define order for size ranges
-		sizeRangeOrder := []string{
-			"Empty (0 bytes)",
-			"< 1 KB",
-			"1 KB - 1 MB",
-			"1 MB - 10 MB",
-			"10 MB - 100 MB",
-			"100 MB - 1 GB",
-			"> 1 GB",
+	var account, driveID, folderID string
+	err = conn.Object(destService, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".GetMoveTarget", 0, mountItemPath(destMount, filepath.Dir(absDest))).
+		Store(&account, &driveID, &folderID)
+	if err != nil {
+		return fmt.Errorf("move: %w", err)
+	}
+	obj := conn.Object(sourceService, fs.DBusObjectPath)
+	var jobID string
+	err = obj.Call(fs.DBusInterface+".MoveToMount", 0, mountItemPath(sourceMount, absSource),
+		account, driveID, folderID, destMount, filepath.Base(absDest), absDest).Store(&jobID)
+	if err != nil {
+		return fmt.Errorf("move: %w", err)
+	}
+	return followJob(obj, "move", jobID, "Cancelled; the original was kept")
+}
+
+// mountItemPath returns the path of path inside the mount at mountpoint, as
+// the D-Bus methods of the mount take it.
+func mountItemPath(mountpoint, path string) string {
+	rel, _ := filepath.Rel(mountpoint, path)
+	if rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+// runStatus lists what needs the user's attention on the mount at
+// mountpoint: unresolved conflicts and local changes that will not upload.
+func runStatus(mountpoint string) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+	fs.SetDBusServiceNameForMount(absMountPath)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+	defer conn.Close()
+
+	obj := conn.Object(fs.DBusServiceName, fs.DBusObjectPath)
+	var conflicts []string
+	if err := obj.Call(fs.DBusInterface+".ListConflicts", 0).Store(&conflicts); err != nil {
+		return fmt.Errorf("status: %s is not mounted or does not answer: %w", mountpoint, err)
+	}
+	for i, path := range conflicts {
+		var peer, author string
+		if err := obj.Call(fs.DBusInterface+".GetConflictPeer", 0, path).Store(&peer, &author); err == nil {
+			conflicts[i] = describeConflict(path, peer)
 		}
+	}
+	var blocked []fs.DBusBlockedUpload
+	if err := obj.Call(fs.DBusInterface+".ListBlockedUploads", 0).Store(&blocked); err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+	var errored []fs.DBusErroredItem
+	if err := obj.Call(fs.DBusInterface+".ListErroredItems", 0).Store(&errored); err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+	fmt.Print(formatStatus(conflicts, blocked, errored))
+	return nil
+}
 
-		for _, sizeRange := range sizeRangeOrder {
-			if count, exists := stats.FileSizeRanges[sizeRange]; exists {
-				fmt.Printf("  %s: %d\n", sizeRange, count)
+// describeConflict names a conflicted file and the conflict copy paired
+// with it, if any.
+func describeConflict(path, peer string) string {
+	if peer == "" {
+		return path
+	}
+	return path + "  (conflict copy: " + peer + ")"
+}
+
+// formatStatus renders the output of "onemount status".
+func formatStatus(conflicts []string, blocked []fs.DBusBlockedUpload, errored []fs.DBusErroredItem) string {
+	if len(conflicts) == 0 && len(blocked) == 0 && len(errored) == 0 {
+		return "Everything is in sync or uploading\n"
+	}
+	var out strings.Builder
+	if len(conflicts) > 0 {
+		fmt.Fprintf(&out, "%d conflict(s) to resolve:\n", len(conflicts))
+		for _, path := range conflicts {
+			fmt.Fprintf(&out, "  %s\n", path)
+		}
+	}
+	if len(blocked) > 0 {
+		fmt.Fprintf(&out, "%d file(s) blocked from uploading:\n", len(blocked))
+		for _, upload := range blocked {
+			reason := upload.Reason
+			if reason == fs.DeferredTooLarge {
+				reason = "larger than OneDrive's 250 GB limit, reduce it to upload"
 			}
+			fmt.Fprintf(&out, "  %s  (%s, %s)\n", upload.Path, fs.FormatSize(int64(upload.Size)), reason)
 		}
 	}
-
-	// File age statistics
-	if len(stats.FileAgeRanges) > 0 {
-		fmt.Printf("\nFile Age Distribution:\n")
-		// Define order for age ranges
-		ageRangeOrder := []string{
-			"Today",
-			"This week",
-			"This month",
-			"Last 3 months",
-			"This year",
-			"Older than a year",
+	if len(errored) > 0 {
+		fmt.Fprintf(&out, "%d file(s) failed to sync:\n", len(errored))
+		for _, item := range errored {
+			retry := "not retried automatically"
+			if item.NextRetry > 0 {
+				retry = "retrying at " + time.Unix(item.NextRetry, 0).Format("15:04")
+			}
+			fmt.Fprintf(&out, "  %s  (%s %s error, %d attempt(s), %s): %s\n",
+				item.Path, item.Operation, item.Class, item.Attempts, retry, item.Message)
+			if len(item.History) > 1 {
+				fmt.Fprintf(&out, "    recent errors: %s\n", strings.Join(item.History, ", "))
+			}
 		}
+	}
+	return out.String()
+}
 
-		for _, ageRange := range ageRangeOrder {
-			if count, exists := stats.FileAgeRanges[ageRange]; exists {
-				fmt.Printf("  %s: %d\n", ageRange, count)
-			}
+// runHelp implements "onemount help": it prints the help topic, or the list
+// of topics when topic is empty.
+func runHelp(topic string) error {
+	if topic == "" {
+		fmt.Print(helpTopics())
+		return nil
+	}
+	text, ok := cli.Topic(topic)
+	if !ok {
+		return fmt.Errorf("help: no topic %q\n\n%s", topic, strings.TrimRight(helpTopics(), "\n"))
+	}
+	fmt.Print(text)
+	return nil
+}
+
+// helpTopics lists the help topics with their titles.
+func helpTopics() string {
+	var out strings.Builder
+	out.WriteString("Help topics, read one with \"onemount help <topic>\":\n")
+	for _, name := range cli.TopicNames() {
+		fmt.Fprintf(&out, "  %-12s %s\n", name, cli.TopicTitle(name))
+	}
+	return out.String()
+}
+
+// runConfigCommand implements "onemount config schema", which prints the JSON
+// Schema of the configuration file, and "onemount config validate", which
+// checks the file at path against it.
+func runConfigCommand(command, path string) error {
+	if command == "schema" {
+		schema, err := common.ConfigSchema()
+		if err != nil {
+			return fmt.Errorf("config schema: %w", err)
 		}
+		_, err = os.Stdout.Write(schema)
+		return err
 	}
 
-	// Clean up
-	filesystem.StopCacheCleanup()
-	filesystem.StopDeltaLoop()
-	filesystem.StopDownloadManager()
-	filesystem.StopUploadManager()
+	issues, err := common.ValidateConfigFile(path)
+	if err != nil {
+		return fmt.Errorf("config validate: %w", err)
+	}
+	for _, issue := range issues {
+		fmt.Printf("%s:%s\n", path, issue)
+	}
+	if len(issues) > 0 {
+		return common.WithFailureReason(fmt.Errorf("config validate: %d problems in %s", len(issues), path), common.FailureConfigInvalid)
+	}
+	fmt.Printf("%s: OK\n", path)
+	return nil
 }
 
-// setupLogging configures the logger based on the configuration
-func runMetadataMaintenance(cacheDir string, migrate bool) error {
-	if cacheDir == "" {
-		return fmt.Errorf("cache directory is required for metadata maintenance")
+// runAuditUploads implements "onemount audit-uploads": it asks the mount at
+// mountpoint to compare sample recently uploaded files with OneDrive and
+// prints the files that differ.
+func runAuditUploads(mountpoint string, sample int) error {
+	absMountPath, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return fmt.Errorf("audit-uploads: %w", err)
 	}
-	dbPath := filepath.Join(cacheDir, "onemount.db")
-	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	fs.SetDBusServiceNameForMount(absMountPath)
+	conn, err := dbus.ConnectSessionBus()
 	if err != nil {
-		return errors.Wrap(err, "open metadata db")
+		return fmt.Errorf("audit-uploads: %w", err)
+	}
+	defer conn.Close()
+
+	var (
+		checked, skipped int32
+		mismatches       []fs.DBusUploadMismatch
+		errs             []string
+	)
+	err = conn.Object(fs.DBusServiceName, fs.DBusObjectPath).
+		Call(fs.DBusInterface+".AuditUploads", 0, int32(sample)).
+		Store(&checked, &skipped, &mismatches, &errs)
+	if err != nil {
+		return fmt.Errorf("audit-uploads: %s is not mounted or does not answer: %w", mountpoint, err)
 	}
-	defer db.Close()
 
-	if migrate {
-		report, err := fs.MigrateLegacyMetadata(db)
-		if err != nil {
-			return err
-		}
-		logging.Info().Int("migrated", report.Migrated).Int("legacy_keys", report.LegacyKeys).Bool("dropped_legacy", report.DroppedLegacy).Msg("metadata migration complete")
-		for _, detail := range report.ErrorDetails {
-			logging.Warn().Msg(detail)
+	for _, m := range mismatches {
+		name := m.Path
+		if name == "" {
+			name = m.ID
 		}
-		return nil
+		fmt.Printf("  %-9s %s: %s\n", "differs", name, m.Problem)
+	}
+	for _, msg := range errs {
+		fmt.Printf("  %-9s %s\n", "failed", msg)
 	}
+	fmt.Printf("Checked %d uploaded files (%d skipped): %d differ from OneDrive\n", checked, skipped, len(mismatches))
+	if len(mismatches) > 0 {
+		return fmt.Errorf("audit-uploads: %d uploaded files differ from the local content", len(mismatches))
+	}
+	return nil
+}
 
-	report, err := fs.ValidateMetadataBucket(db)
+// runReplay implements "onemount replay": with plan it prints what replaying
+// the changes made offline in the mount at mountpoint would do, with apply it
+// replays them and follows the job.
+func runReplay(mountpoint string, plan, apply bool) error {
+	if plan == apply {
+		return fmt.Errorf("replay: pass either --plan or --apply")
+	}
+	absMountPath, err := filepath.Abs(mountpoint)
 	if err != nil {
-		return err
+		return fmt.Errorf("replay: %w", err)
 	}
-	logging.Info().Int("checked", report.Checked).Int("invalid", report.Invalid).Int("legacy_keys", report.LegacyKeys).Msg("metadata validation complete")
-	for _, detail := range report.ErrorDetails {
-		logging.Warn().Msg(detail)
+	fs.SetDBusServiceNameForMount(absMountPath)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("replay: %w", err)
 	}
-	if report.MissingV2 {
-		return fmt.Errorf("metadata_v2 bucket missing")
+	defer conn.Close()
+	obj := conn.Object(fs.DBusServiceName, fs.DBusObjectPath)
+
+	if apply {
+		var jobID string
+		if err := obj.Call(fs.DBusInterface+".ApplyOfflineReplay", 0).Store(&jobID); err != nil {
+			return fmt.Errorf("replay: %w", err)
+		}
+		return followJob(obj, "replay", jobID, "Cancelled; the changes not replayed yet are kept")
 	}
-	if report.Invalid > 0 {
-		return fmt.Errorf("metadata validation found %d invalid entries", report.Invalid)
+
+	var items []fs.DBusReplayPlanItem
+	if err := obj.Call(fs.DBusInterface+".PlanOfflineReplay", 0).Store(&items); err != nil {
+		return fmt.Errorf("replay: %w", err)
+	}
+	if len(items) == 0 {
+		fmt.Println("No changes made offline wait to be replayed")
+		return nil
+	}
+	counts := map[string]int{}
+	for _, item := range items {
+		path := item.Path
+		if item.OldPath != "" && item.OldPath != item.Path {
+			path = item.OldPath + " -> " + item.Path
+		}
+		fmt.Printf("  %-8s %-6s %s: %s\n", item.Outcome, item.Type, path, item.Reason)
+		counts[item.Outcome]++
 	}
+	fmt.Printf("%d changes: %d apply, %d conflict, %d fail, %d skip\n", len(items),
+		counts[fs.ReplayApplies], counts[fs.ReplayConflicts], counts[fs.ReplayFails], counts[fs.ReplaySkipped])
 	return nil
 }
 
+// redactedConfig returns the configuration as YAML for support bundles, with
+// identifiers removed and the home directory shortened to "~".
+func redactedConfig(config *common.Config) []byte {
+	redacted := *config
+	if redacted.ClientID != "" {
+		redacted.ClientID = "[REDACTED]"
+	}
+	if redacted.Realtime.ClientState != "" {
+		redacted.Realtime.ClientState = "[REDACTED]"
+	}
+	data, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return []byte("unavailable: " + err.Error() + "\n")
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" && home != "/" {
+		data = []byte(strings.ReplaceAll(string(data), home, "~"))
+	}
+	return data
+}
+
+// logFilePath returns the log file in use, or "" when logging to a stream.
+func logFilePath(config *common.Config) string {
+	switch config.LogOutput {
+	case "STDOUT", "STDERR", "":
+		return ""
+	}
+	return config.LogOutput
+}
+
 func setupLogging(config *common.Config, daemon bool) error {
 	// Set the global log level
 	logging.SetGlobalLevel(common.StringToLevel(config.LogLevel))
@@ -762,22 +2550,35 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	config, authOnly, headless, debugOn, stats, daemon, mountpoint := setupFlags()
+	config, authOnly, headless, debugOn, stats, daemon, statsFormat, mountpoint := setupFlags()
+	if stats && statsFormat == statsFormatJSON && config.LogOutput == "STDOUT" {
+		// keep the JSON on standard output parseable
+		config.LogOutput = "STDERR"
+	}
 
 	// Configure logging based on the configuration
 	if err := setupLogging(config, daemon); err != nil {
 		logging.Error().Err(err).Msg("Failed to set up logging")
 	}
 
+	if config.Frozen && config.Ephemeral {
+		common.ExitWithFailure(common.WithFailureReason(
+			fmt.Errorf("--frozen serves an existing cache, which --ephemeral does not keep"), common.FailureUsage))
+	}
+
 	// If daemon flag is set, daemonize the process
 	if daemon {
+		if config.FuseFD > 0 {
+			common.ExitWithFailure(common.WithFailureReason(
+				fmt.Errorf("--daemon cannot be used with a pre-opened fuse descriptor"), common.FailureUsage))
+		}
 		logging.Info().Msg("Starting onemount in daemon mode...")
 		daemonize()
 	}
 
 	// If stats flag is set, display statistics and exit
 	if stats {
-		displayStats(ctx, config, mountpoint)
+		displayStats(ctx, config, mountpoint, statsFormat)
 		os.Exit(0)
 	}
 
@@ -788,40 +2589,314 @@ func main() {
 			Msg("Mountpoint looks like a flag without the hyphen prefix. Did you mean '-" + mountpoint + "'? Use '--help' for usage information.")
 	}
 
-	st, err := os.Stat(mountpoint)
-	if err != nil || !st.IsDir() {
-		common.HandleErrorAndExit(
-			fmt.Errorf("mountpoint '%s' did not exist or was not a directory", mountpoint),
-			1)
-	}
-	if res, _ := os.ReadDir(mountpoint); len(res) > 0 {
-		common.HandleErrorAndExit(
-			fmt.Errorf("mountpoint '%s' must be empty", mountpoint),
-			1)
+	if config.MultiMount {
+		if err := runMultiMount(ctx, cancel, config, headless, debugOn); err != nil {
+			common.ExitWithFailure(err)
+		}
+		return
 	}
 
-	// Check if the mountpoint is already mounted
-	if isMounted := checkIfMounted(mountpoint); isMounted {
-		common.HandleErrorAndExit(
-			fmt.Errorf("mountpoint '%s' is already mounted. Unmount it first or choose a different mountpoint", mountpoint),
-			1)
+	if err := checkMountpoint(config, mountpoint); err != nil {
+		common.ExitWithFailure(err)
 	}
 
 	// Initialize the filesystem
-	filesystem, _, server, cachePath, absMountPath, err := initializeFilesystem(ctx, config, mountpoint, authOnly, headless, debugOn)
+	filesystem, _, mount, cachePath, absMountPath, err := initializeFilesystem(ctx, config, mountpoint, authOnly, headless, debugOn)
 	if err != nil {
-		common.HandleErrorAndExit(err, 1)
+		common.ExitWithFailure(err)
 	}
 
 	// setup signal handler for graceful unmount on signals like sigint
-	setupSignalHandler(filesystem, server, absMountPath, cancel)
+	setupSignalHandler(filesystem, mount, absMountPath, config.FuseFD == 0, cancel)
+	setupReloadHandler(filesystem)
+	go reportServiceStatus(ctx, []*servedMount{mount}, !config.Frozen)
 
 	// serve filesystem
 	logging.Info().
 		Str("cachePath", cachePath).
 		Str("mountpoint", absMountPath).
 		Msg("Serving filesystem.")
-	server.Serve()
+	policy := remountPolicy{
+		attempts: config.RemountAttempts,
+		delay:    time.Duration(config.RemountDelay) * time.Second,
+	}
+	err = serveWithRecovery(filesystem, mount, absMountPath, policy, config.DesktopNotifications)
+
+	// Unmounted by someone else, e.g. with fusermount3 -u, or the kernel
+	// aborted the connection for good
+	filesystem.Stop()
+	if err != nil {
+		common.ExitWithFailure(common.WithFailureReason(err, common.FailureFuseUnavailable))
+	}
+}
+
+// checkMountpoint checks that the filesystem can be mounted at mountpoint.
+func checkMountpoint(config *common.Config, mountpoint string) error {
+	if config.FuseFD > 0 {
+		// The parent already mounted the descriptor there; looking at the
+		// mountpoint would hang until we serve it.
+		if err := common.CheckFuseFD(config.FuseFD); err != nil {
+			return common.WithFailureReason(err, common.FailureFuseUnavailable)
+		}
+	} else {
+		st, err := os.Stat(mountpoint)
+		if err != nil || !st.IsDir() {
+			return common.WithFailureReason(
+				fmt.Errorf("mountpoint '%s' did not exist or was not a directory", mountpoint),
+				common.FailureUsage)
+		}
+		if res, _ := os.ReadDir(mountpoint); len(res) > 0 {
+			return common.WithFailureReason(
+				fmt.Errorf("mountpoint '%s' must be empty", mountpoint),
+				common.FailureMountpointBusy)
+		}
+
+		// Check if the mountpoint is already mounted
+		if isMounted := checkIfMounted(mountpoint); isMounted {
+			return common.WithFailureReason(
+				fmt.Errorf("mountpoint '%s' is already mounted. Unmount it first or choose a different mountpoint", mountpoint),
+				common.FailureMountpointBusy)
+		}
+	}
+
+	// A cache inside the mount, or a mount inside the cache or another mount,
+	// would feed the mount into itself
+	if err := common.CheckMountLayout(mountpoint, config.CacheDir, common.ReadMounts()); err != nil {
+		return common.WithFailureReason(err, common.FailureConfigInvalid)
+	}
+	return nil
+}
+
+// servedMount is the FUSE server of the mount, replaced when the mount is
+// mounted again after the kernel aborted the connection.
+type servedMount struct {
+	mu          sync.Mutex
+	server      *fuse.Server
+	filesystem  *fs.Filesystem
+	mountpoint  string
+	target      string // what go-fuse mounts, /dev/fd/N for a pre-opened descriptor
+	options     *fuse.MountOptions
+	remountable bool // false for a pre-opened descriptor, which dies with the connection
+	aborted     bool // the kernel aborted the connection and the mount is not served again yet
+}
+
+// current returns the server serving the mount.
+func (m *servedMount) current() *fuse.Server {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.server
+}
+
+// remount detaches the aborted mount and mounts the filesystem again at the
+// same mountpoint.
+func (m *servedMount) remount() error {
+	// The dead mount stays until it is unmounted; lazily, as processes may
+	// still have files open on it
+	if output, err := exec.Command("fusermount3", "-u", "-z", m.target).CombinedOutput(); err != nil {
+		logging.Debug().Err(err).Str("output", strings.TrimSpace(string(output))).
+			Msg("Could not detach the aborted mount")
+	}
+	server, err := fuse.NewServer(m.filesystem, m.target, m.options)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.server = server
+	m.aborted = false
+	m.mu.Unlock()
+	return nil
+}
+
+// markAborted records that the kernel aborted the connection of the mount.
+func (m *servedMount) markAborted() {
+	m.mu.Lock()
+	m.aborted = true
+	m.mu.Unlock()
+}
+
+// waitMount waits until the mount serves requests, following it when it is
+// mounted again in the meantime.
+func (m *servedMount) waitMount() error {
+	for {
+		server := m.current()
+		err := server.WaitMount()
+		if err == nil || m.current() == server {
+			return err
+		}
+	}
+}
+
+// state returns the sync state of the mount for the service status, or that
+// it is being mounted again.
+func (m *servedMount) state() string {
+	m.mu.Lock()
+	aborted := m.aborted
+	m.mu.Unlock()
+	if aborted {
+		return "Mounting again"
+	}
+	return m.filesystem.SyncState().String()
+}
+
+// remountPolicy says how often and when a mount whose connection the kernel
+// aborted is mounted again.
+type remountPolicy struct {
+	attempts int           // attempts in a row before giving up, 0 never mounts again
+	delay    time.Duration // before the first attempt, doubled for each further one
+}
+
+// remountStableAfter is how long a mount must serve after being mounted
+// again before a later abort gets the full number of attempts again.
+const remountStableAfter = 10 * time.Minute
+
+// maxRemountDelay caps the wait between two attempts to mount again.
+const maxRemountDelay = time.Minute
+
+// wait returns how long to wait before the attempt-th attempt, counting
+// from 0.
+func (p remountPolicy) wait(attempt int) time.Duration {
+	wait := p.delay
+	for i := 0; i < attempt && wait < maxRemountDelay; i++ {
+		wait *= 2
+	}
+	if wait > maxRemountDelay {
+		return maxRemountDelay
+	}
+	return wait
+}
+
+// fuseConnectionAborted reports whether stat of the mountpoint failed the
+// way it does while the mount stays but the kernel aborted its connection.
+func fuseConnectionAborted(statErr error) bool {
+	return errors.Is(statErr, syscall.ENOTCONN) || errors.Is(statErr, syscall.ECONNABORTED)
+}
+
+// serveWithRecovery serves the mount until it is unmounted. When the kernel
+// aborts the FUSE connection instead, it saves the state of the filesystem
+// and mounts it again at mountpoint as the policy allows, reporting each step
+// as a "mount" activity event. It returns an error when the connection was
+// aborted and the mount could not be mounted again.
+func serveWithRecovery(filesystem *fs.Filesystem, mount *servedMount, mountpoint string, policy remountPolicy, desktop bool) error {
+	attempt := 0
+	for {
+		started := time.Now()
+		mount.current().Serve()
+		_, statErr := os.Stat(mountpoint)
+		if !fuseConnectionAborted(statErr) {
+			return nil
+		}
+		if time.Since(started) >= remountStableAfter {
+			attempt = 0
+		}
+
+		logging.Error().Str("mountpoint", mountpoint).Msg("The kernel aborted the FUSE connection")
+		mount.markAborted()
+		filesystem.SaveState()
+		if !mount.remountable || policy.attempts == 0 {
+			filesystem.ReportMountEvent(fmt.Sprintf("The kernel aborted the connection to %s, stopping", mountpoint), desktop)
+			return fmt.Errorf("the kernel aborted the FUSE connection to %s", mountpoint)
+		}
+		filesystem.ReportMountEvent(fmt.Sprintf("The kernel aborted the connection to %s, mounting it again", mountpoint), desktop)
+
+		var err error
+		for {
+			if attempt >= policy.attempts {
+				filesystem.ReportMountEvent(fmt.Sprintf("Could not mount %s again: %v", mountpoint, err), desktop)
+				return fmt.Errorf("could not mount %s again after the kernel aborted the FUSE connection: %w", mountpoint, err)
+			}
+			time.Sleep(policy.wait(attempt))
+			attempt++
+			if err = mount.remount(); err == nil {
+				break
+			}
+			logging.Warn().Err(err).Int("attempt", attempt).Str("mountpoint", mountpoint).Msg("Could not mount again")
+		}
+		logging.Info().Int("attempt", attempt).Str("mountpoint", mountpoint).Msg("Mounted again after the kernel aborted the FUSE connection")
+		filesystem.ReportMountEvent(fmt.Sprintf("Mounted %s again", mountpoint), desktop)
+	}
+}
+
+// serviceStatusInterval is how often the status line shown by "systemctl
+// status" is updated.
+const serviceStatusInterval = 5 * time.Second
+
+// notifyService logs a failed notification of the service manager.
+func notifyService(_ bool, err error) {
+	if err != nil {
+		logging.Debug().Err(err).Msg("Could not notify systemd")
+	}
+}
+
+// reportServiceStatus tells systemd that the mounts started once their FUSE
+// servers answer requests and, unless waitForDelta is false, their first
+// delta cycles finished. It then keeps the service's status line up to date
+// until ctx ends, reading the mounts as they are served at each update so
+// that one mounted again after an abort is followed.
+func reportServiceStatus(ctx context.Context, mounts []*servedMount, waitForDelta bool) {
+	for _, mount := range mounts {
+		if err := mount.waitMount(); err != nil {
+			logging.Error().Err(err).Str("mountpoint", mount.mountpoint).Msg("The filesystem did not start serving requests")
+			return
+		}
+	}
+	if waitForDelta {
+		for _, mount := range mounts {
+			select {
+			case <-mount.filesystem.DeltaBootstrapped():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	status := serviceStatus(mounts)
+	sent, err := systemd.NotifyReady(status)
+	notifyService(sent, err)
+	if !sent {
+		return // not run by systemd
+	}
+	logging.Info().Str("status", status).Msg("Reported the mount ready to systemd")
+
+	ticker := time.NewTicker(serviceStatusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if current := serviceStatus(mounts); current != status {
+				status = current
+				notifyService(systemd.NotifyStatus(status))
+			}
+		}
+	}
+}
+
+// serviceStatus returns the status line of the mounts: the sync state of a
+// single mount, or that of each mount after its folder name.
+func serviceStatus(mounts []*servedMount) string {
+	if len(mounts) == 1 {
+		return mounts[0].state()
+	}
+	states := make([]string, 0, len(mounts))
+	for _, mount := range mounts {
+		states = append(states, filepath.Base(mount.mountpoint)+": "+mount.state())
+	}
+	return strings.Join(states, ", ")
+}
+
+// setupReloadHandler reloads the mount's settings on SIGHUP, which
+// "systemctl reload" sends.
+func setupReloadHandler(filesystem *fs.Filesystem) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			logging.Info().Msg("SIGHUP received, reloading settings")
+			if err := filesystem.ReloadSettings(); err != nil {
+				logging.Warn().Err(err).Msg("Could not reload settings")
+			}
+		}
+	}()
 }
 
 // isMountpointMounted checks if a filesystem is mounted at the given mountpoint
@@ -903,8 +2978,9 @@ func daemonize() {
 	os.Exit(0)
 }
 
-// setupSignalHandler sets up a handler for SIGINT and SIGTERM signals to gracefully unmount the filesystem
-func setupSignalHandler(filesystem *fs.Filesystem, server *fuse.Server, mountpoint string, cancel context.CancelFunc) {
+// setupSignalHandler sets up a handler for SIGINT and SIGTERM signals to gracefully unmount the filesystem.
+// Without ownsMount the mount belongs to the process that passed the fuse descriptor, which unmounts it.
+func setupSignalHandler(filesystem *fs.Filesystem, mount *servedMount, mountpoint string, ownsMount bool, cancel context.CancelFunc) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
@@ -913,57 +2989,13 @@ func setupSignalHandler(filesystem *fs.Filesystem, server *fuse.Server, mountpoi
 		sig := <-sigChan // block until signal
 		logging.Info().Str("signal", strings.ToUpper(sig.String())).
 			Msg("Signal received, cleaning up and unmounting filesystem.")
+		notifyService(systemd.NotifyStopping())
 
 		// Cancel the context to notify all goroutines to stop
 		logging.Info().Msg("Canceling context to notify all goroutines to stop...")
 		cancel()
 
-		// Stop the cache cleanup routine
-		filesystem.StopCacheCleanup()
-
-		// Stop the delta loop
-		filesystem.StopDeltaLoop()
-
-		// Stop the download manager
-		filesystem.StopDownloadManager()
-
-		// Stop the upload manager
-		filesystem.StopUploadManager()
-
-		// Stop the metadata request manager
-		filesystem.StopMetadataRequestManager()
-
-		// Give the system a moment to release all resources
-		logging.Info().Msg("Waiting for all resources to be released before unmounting...")
-		time.Sleep(500 * time.Millisecond)
-
-		// Unmount the filesystem with retries
-		maxRetries := 3
-		retryDelay := 500 * time.Millisecond
-		var err error
-
-		// Check if the filesystem is actually mounted before attempting to unmount
-		if !isMountpointMounted(mountpoint) {
-			logging.Warn().Str("mountpoint", mountpoint).Msg("Filesystem does not appear to be mounted, skipping unmount operation")
-		} else {
-			for i := 0; i < maxRetries; i++ {
-				err = server.Unmount()
-				if err == nil {
-					break
-				}
-
-				if i < maxRetries-1 {
-					logging.Warn().Err(err).
-						Int("retry", i+1).
-						Dur("delay", retryDelay).
-						Msg("Failed to unmount filesystem, retrying after delay...")
-					time.Sleep(retryDelay)
-					retryDelay *= 2 // Exponential backoff
-				}
-			}
-		}
-
-		if err != nil {
+		if err := unmountFilesystem(filesystem, mount, mountpoint, ownsMount); err != nil {
 			logging.Error().Err(err).Msg("Failed to unmount filesystem cleanly after multiple attempts! " +
 				"Run \"fusermount3 -uz /MOUNTPOINT/GOES/HERE\" to unmount.")
 			os.Exit(1) // Exit with error code 1 to indicate failure
@@ -973,3 +3005,42 @@ func setupSignalHandler(filesystem *fs.Filesystem, server *fuse.Server, mountpoi
 		}
 	}()
 }
+
+// unmountFilesystem stops the background processes of the filesystem,
+// unmounts it and saves what is left.
+func unmountFilesystem(filesystem *fs.Filesystem, mount *servedMount, mountpoint string, ownsMount bool) error {
+	// Stop all background processes in order before unmounting
+	filesystem.StopBackground()
+
+	// Unmount the filesystem with retries
+	maxRetries := 3
+	retryDelay := 500 * time.Millisecond
+	var err error
+
+	// Check if the filesystem is actually mounted before attempting to unmount
+	if !ownsMount {
+		logging.Info().Str("mountpoint", mountpoint).Msg("Mount is owned by the process that passed the fuse descriptor, not unmounting")
+	} else if !isMountpointMounted(mountpoint) {
+		logging.Warn().Str("mountpoint", mountpoint).Msg("Filesystem does not appear to be mounted, skipping unmount operation")
+	} else {
+		for i := 0; i < maxRetries; i++ {
+			err = mount.current().Unmount()
+			if err == nil {
+				break
+			}
+
+			if i < maxRetries-1 {
+				logging.Warn().Err(err).
+					Int("retry", i+1).
+					Dur("delay", retryDelay).
+					Msg("Failed to unmount filesystem, retrying after delay...")
+				time.Sleep(retryDelay)
+				retryDelay *= 2 // Exponential backoff
+			}
+		}
+	}
+
+	// Save what is left and close the database
+	filesystem.Stop()
+	return err
+}
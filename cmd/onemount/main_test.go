@@ -1,9 +1,17 @@
 package main
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/auriora/onemount/cmd/common"
+	"github.com/auriora/onemount/internal/fs"
+	"github.com/auriora/onemount/internal/graph"
 )
 
 func TestUT_CMD_Main_ToRealtimeOptionsCopiesPollingOnly(t *testing.T) {
@@ -17,3 +25,227 @@ func TestUT_CMD_Main_ToRealtimeOptionsCopiesPollingOnly(t *testing.T) {
 		t.Fatalf("expected pollingOnly to propagate to fs options")
 	}
 }
+
+func TestUT_CMD_Main_RedactedConfigHidesIdentifiers(t *testing.T) {
+	cfg := common.Config{LogLevel: "debug"}
+	cfg.ClientID = "3470c3fa-bc10-45ab-a0a9-2d30836485d1"
+	cfg.Realtime.ClientState = "c1ient-state"
+
+	data := string(redactedConfig(&cfg))
+	if strings.Contains(data, cfg.ClientID) || strings.Contains(data, cfg.Realtime.ClientState) {
+		t.Fatalf("expected identifiers to be redacted, got:\n%s", data)
+	}
+	if !strings.Contains(data, "log: debug") {
+		t.Fatalf("expected other settings to be kept, got:\n%s", data)
+	}
+	if cfg.ClientID == "[REDACTED]" {
+		t.Fatalf("redaction must not modify the running configuration")
+	}
+}
+
+func TestUT_CMD_Main_FormatStatusListsBlockedUploads(t *testing.T) {
+	if got := formatStatus(nil, nil, nil); got != "Everything is in sync or uploading\n" {
+		t.Fatalf("unexpected clean status %q", got)
+	}
+
+	got := formatStatus([]string{
+		"/Documents/report.docx",
+		describeConflict("/Documents/plan.xlsx", "/Documents/plan-DESKTOP-AB12CD.xlsx"),
+	}, []fs.DBusBlockedUpload{
+		{Path: "/Backups/disk.img", Reason: fs.DeferredTooLarge, Size: 300 << 30},
+	}, nil)
+	want := "2 conflict(s) to resolve:\n" +
+		"  /Documents/report.docx\n" +
+		"  /Documents/plan.xlsx  (conflict copy: /Documents/plan-DESKTOP-AB12CD.xlsx)\n" +
+		"1 file(s) blocked from uploading:\n" +
+		"  /Backups/disk.img  (300.0 GiB, larger than OneDrive's 250 GB limit, reduce it to upload)\n"
+	if got != want {
+		t.Fatalf("formatStatus() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUT_CMD_Main_FormatStatusListsErroredItems(t *testing.T) {
+	retry := time.Date(2026, 3, 4, 10, 30, 0, 0, time.Local)
+	got := formatStatus(nil, nil, []fs.DBusErroredItem{
+		{Path: "/Photos/beach.jpg", Operation: "upload", Class: "throttle", Message: "activityLimitReached",
+			Attempts: 3, NextRetry: retry.Unix(), History: []string{"network", "throttle", "throttle"}},
+		{Path: "/Shared/plan.xlsx", Operation: "download", Class: "permission", Message: "accessDenied",
+			Attempts: 1, History: []string{"permission"}},
+	})
+	want := "2 file(s) failed to sync:\n" +
+		"  /Photos/beach.jpg  (upload throttle error, 3 attempt(s), retrying at 10:30): activityLimitReached\n" +
+		"    recent errors: network, throttle, throttle\n" +
+		"  /Shared/plan.xlsx  (download permission error, 1 attempt(s), not retried automatically): accessDenied\n"
+	if got != want {
+		t.Fatalf("formatStatus() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUT_CMD_Main_FormatCrashesListsReports(t *testing.T) {
+	if got := formatCrashes(fs.CrashSummary{}, nil); got != "Crashes: none\n" {
+		t.Fatalf("unexpected summary without crashes %q", got)
+	}
+
+	got := formatCrashes(fs.CrashSummary{
+		Count:      2,
+		Last:       time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+		LastReason: "panic in delta loop: boom",
+	}, []string{"/cache/crashes/crash-1.tar.gz", "/cache/crashes/crash-2.tar.gz"})
+	want := "Crashes: 2, last 2026-03-04T05:06:07Z\n" +
+		"  panic in delta loop: boom\n" +
+		"Crash reports (attach them to bug reports):\n" +
+		"  /cache/crashes/crash-1.tar.gz\n" +
+		"  /cache/crashes/crash-2.tar.gz\n"
+	if got != want {
+		t.Fatalf("formatCrashes() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUT_CMD_Main_FormatResetListsLostChanges(t *testing.T) {
+	report := &fs.CacheResetReport{Unsynced: []fs.UnsyncedChange{
+		{ID: "a", Path: "/Documents/notes.txt", Reason: "modified locally"},
+		{ID: "b", Path: "/draft.md", Reason: "created locally"},
+	}}
+	want := "2 local changes are not uploaded yet and would be lost:\n" +
+		"  /Documents/notes.txt (modified locally)\n" +
+		"  /draft.md (created locally)\n"
+	if got := formatReset(report, false); got != want {
+		t.Fatalf("formatReset() =\n%s\nwant\n%s", got, want)
+	}
+
+	report.Trash = "/cache/.reset/home-user-OneDrive"
+	want = "Lost 2 local changes not uploaded yet:\n" +
+		"  /Documents/notes.txt (modified locally)\n" +
+		"  /draft.md (created locally)\n" +
+		"Cache reset; the old cache is in /cache/.reset/home-user-OneDrive until the next reset\n"
+	if got := formatReset(report, true); got != want {
+		t.Fatalf("formatReset() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUT_CMD_Main_RemountPolicyBacksOff(t *testing.T) {
+	policy := remountPolicy{attempts: 8, delay: 2 * time.Second}
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute}
+	for attempt, delay := range want {
+		if got := policy.wait(attempt); got != delay {
+			t.Errorf("wait(%d) = %s, want %s", attempt, got, delay)
+		}
+	}
+	if got := (remountPolicy{}).wait(3); got != 0 {
+		t.Errorf("wait without delay = %s, want 0", got)
+	}
+}
+
+func TestUT_CMD_Main_FuseConnectionAbortedFromStat(t *testing.T) {
+	aborted := &os.PathError{Op: "stat", Path: "/home/u/OneDrive", Err: syscall.ENOTCONN}
+	if !fuseConnectionAborted(aborted) {
+		t.Errorf("expected %v to mean an aborted connection", aborted)
+	}
+	for _, err := range []error{nil, &os.PathError{Op: "stat", Path: "/home/u/OneDrive", Err: syscall.ENOENT}} {
+		if fuseConnectionAborted(err) {
+			t.Errorf("expected %v not to mean an aborted connection", err)
+		}
+	}
+}
+
+func TestUT_CMD_Main_WriteStatsJSONIncludesAllFields(t *testing.T) {
+	var out strings.Builder
+	stats := &fs.Stats{
+		ContentCount:    3,
+		UploadsDeferred: map[string]int{fs.DeferredTooLarge: 1},
+		FileExtensions:  map[string]int{".txt": 2},
+	}
+	if err := writeStatsJSON(&out, stats, true); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+		t.Fatalf("not JSON: %v\n%s", err, out.String())
+	}
+	if got["Mounted"] != true || got["ContentCount"] != 3.0 {
+		t.Fatalf("unexpected statistics %v", got)
+	}
+	if _, ok := got["DBPath"]; !ok {
+		t.Fatal("fields that are zero are left out")
+	}
+	if deferred := got["UploadsDeferred"].(map[string]interface{}); deferred[fs.DeferredTooLarge] != 1.0 {
+		t.Fatalf("unexpected deferred uploads %v", deferred)
+	}
+}
+
+func TestUT_CMD_Main_FilesystemOptionsCapEphemeralCache(t *testing.T) {
+	config := &common.Config{Ephemeral: true, MaxCacheSize: 10 << 30}
+	opts := filesystemOptions(config)
+	if !opts.Ephemeral || opts.MaxCacheSize != common.EphemeralMaxCacheSize || !opts.CacheQuota {
+		t.Fatalf("unexpected options for an ephemeral mount: %+v", opts)
+	}
+	config.MaxCacheSize = 100 << 20
+	if opts := filesystemOptions(config); opts.MaxCacheSize != 100<<20 {
+		t.Fatalf("a smaller limit is kept, got %d", opts.MaxCacheSize)
+	}
+	if opts := filesystemOptions(&common.Config{}); opts.Ephemeral || opts.MaxCacheSize != 0 ||
+		opts.CacheLedgerDir != fs.DefaultCacheLedgerDir() {
+		t.Fatalf("unexpected options for a normal mount: %+v", opts)
+	}
+}
+
+func TestUT_CMD_Main_AuthenticateSharesAccountTokens(t *testing.T) {
+	t.Cleanup(func() {
+		accountAuths.Lock()
+		accountAuths.byAccount = make(map[string]*graph.Auth)
+		accountAuths.Unlock()
+	})
+	cacheDir := t.TempDir()
+	tokens := func(path string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		auth := &graph.Auth{Account: "user@example.com", AccessToken: "token", RefreshToken: "refresh",
+			ExpiresAt: time.Now().Add(time.Hour).Unix()}
+		if err := auth.ToFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tokens(graph.GetAuthTokensPathByAccount(cacheDir, "user@example.com"))
+	tokens(graph.GetAuthTokensPath(cacheDir, "mnt-personal"))
+
+	config := &common.Config{CacheDir: cacheDir, Account: "User@Example.com"}
+	work, err := authenticate(config, "mnt-work", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Account = "user@example.com"
+	photos, err := authenticate(config, "mnt-photos", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work != photos {
+		t.Fatalf("expected the mounts of an account to share its tokens")
+	}
+
+	// A mount without an account shares the tokens once signed in
+	config.Account = ""
+	personal, err := authenticate(config, "mnt-personal", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if personal != work {
+		t.Fatalf("expected a mount signed in to the same account to share its tokens")
+	}
+}
+
+func TestUT_CMD_Main_ServiceStatusNamesMounts(t *testing.T) {
+	mounts := []*servedMount{
+		{filesystem: &fs.Filesystem{}, mountpoint: "/home/user/OneDrive"},
+		{filesystem: &fs.Filesystem{}, mountpoint: "/home/user/Work"},
+	}
+	single := serviceStatus(mounts[:1])
+	if got := serviceStatus(mounts); got != "OneDrive: "+single+", Work: "+single {
+		t.Fatalf("unexpected status line %q", got)
+	}
+
+	mounts[1].markAborted()
+	if got := serviceStatus(mounts); got != "OneDrive: "+single+", Work: Mounting again" {
+		t.Fatalf("unexpected status line while mounting again %q", got)
+	}
+}
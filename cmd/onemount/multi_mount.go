@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/auriora/onemount/cmd/common"
+	"github.com/auriora/onemount/internal/fs"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/ui/systemd"
+)
+
+// A multi-mount process, started with --multi-mount, serves every mountpoint
+// of the mounts section of the configuration file instead of a single one.
+// The mounts keep their own caches, settings and D-Bus names, but share what
+// one process needs only once: the HTTP client and its connections, the
+// tokens of each account with their background refresh, and a scheduler
+// spreading their delta cycles. Four drives then cost one process, not four.
+
+// multiMountDeltaCycles is how many mounts of a multi-mount process may run a
+// delta cycle at once.
+const multiMountDeltaCycles = 2
+
+// sharedDeltaScheduler spreads the delta cycles of the mounts of a
+// multi-mount process; nil while serving a single mount.
+var sharedDeltaScheduler *fs.DeltaScheduler
+
+// accountAuths holds the tokens of the accounts the process signed in to, by
+// lower-case account name, so that the mounts of one account share them.
+var accountAuths = struct {
+	sync.Mutex
+	byAccount map[string]*graph.Auth
+}{byAccount: make(map[string]*graph.Auth)}
+
+// authenticate signs in the mount whose tokens are stored under instance.
+// A mount whose section of the configuration names an account uses the
+// tokens of that account. The mounts of an account the process already
+// signed in to share its tokens and their background refresh.
+func authenticate(config *common.Config, instance string, headless bool) (*graph.Auth, error) {
+	accountAuths.Lock()
+	defer accountAuths.Unlock()
+
+	account := strings.ToLower(config.Account)
+	if auth, ok := accountAuths.byAccount[account]; ok && account != "" {
+		return auth, nil
+	}
+	var auth *graph.Auth
+	if account != "" {
+		if loaded, err := graph.LoadAuthTokens(graph.GetAuthTokensPathByAccount(config.CacheDir, config.Account)); err == nil {
+			auth = loaded
+			if err := auth.Refresh(context.Background()); err != nil {
+				logging.Warn().Err(err).Msg("Failed to refresh auth tokens, continuing with existing tokens")
+			}
+		}
+	}
+	if auth == nil {
+		var err error
+		auth, err = graph.AuthenticateWithAccountStorage(context.Background(), config.AuthConfig, config.CacheDir, instance, headless)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if account != "" && !strings.EqualFold(auth.Account, config.Account) {
+		logging.Warn().Str("account", auth.Account).Str("configured", config.Account).
+			Msg("Signed in to another account than the one configured for the mount")
+	}
+
+	if auth.Account == "" {
+		return auth, nil
+	}
+	if shared, ok := accountAuths.byAccount[strings.ToLower(auth.Account)]; ok {
+		return shared, nil
+	}
+	accountAuths.byAccount[strings.ToLower(auth.Account)] = auth
+	return auth, nil
+}
+
+// runMultiMount serves every mountpoint of the mounts section of config until
+// they are unmounted or the process is told to stop. A mount that cannot be
+// started is logged and left out; the process only fails when none starts.
+func runMultiMount(ctx context.Context, cancel context.CancelFunc, config *common.Config, headless, debugOn bool) error {
+	switch {
+	case config.FuseFD > 0 || config.ShareURL != "" || config.Frozen:
+		return common.WithFailureReason(
+			fmt.Errorf("--multi-mount cannot serve a pre-opened fuse descriptor, a shared folder or a frozen cache"),
+			common.FailureUsage)
+	case len(config.Mounts) == 0:
+		return common.WithFailureReason(
+			fmt.Errorf("--multi-mount serves the mountpoints listed under mounts in %s, but there are none", config.ConfigFile),
+			common.FailureConfigInvalid)
+	}
+	mountpoints := make([]string, 0, len(config.Mounts))
+	for mountpoint := range config.Mounts {
+		mountpoints = append(mountpoints, mountpoint)
+	}
+	sort.Strings(mountpoints)
+
+	// Mounts start one after the other, as each sets the D-Bus name of the
+	// next filesystem and may ask to sign in
+	sharedDeltaScheduler = fs.NewDeltaScheduler(multiMountDeltaCycles)
+	var mounts []*servedMount
+	var mountConfigs []*common.Config
+	var lastErr error
+	for _, mountpoint := range mountpoints {
+		mountConfig := config.ForMount(mountpoint)
+		if err := checkMountpoint(mountConfig, mountpoint); err != nil {
+			logging.Error().Err(err).Str("mountpoint", mountpoint).Msg("Not serving mount")
+			lastErr = err
+			continue
+		}
+		filesystem, _, mount, cachePath, absMountPath, err := initializeFilesystem(ctx, mountConfig, mountpoint, false, headless, debugOn)
+		if err != nil {
+			logging.Error().Err(err).Str("mountpoint", mountpoint).Msg("Not serving mount")
+			lastErr = err
+			continue
+		}
+		setupReloadHandler(filesystem)
+		logging.Info().
+			Str("cachePath", cachePath).
+			Str("mountpoint", absMountPath).
+			Msg("Serving filesystem.")
+		mounts = append(mounts, mount)
+		mountConfigs = append(mountConfigs, mountConfig)
+	}
+	if len(mounts) == 0 {
+		return fmt.Errorf("none of the %d mounts could be started: %w", len(mountpoints), lastErr)
+	}
+
+	setupMultiSignalHandler(mounts, cancel)
+	go reportServiceStatus(ctx, mounts, true)
+
+	// Each mount is served until it is unmounted, by someone else or after
+	// the kernel aborted its connection for good; the others keep serving
+	errs := make(chan error, len(mounts))
+	for i, mount := range mounts {
+		mountConfig := mountConfigs[i]
+		policy := remountPolicy{
+			attempts: mountConfig.RemountAttempts,
+			delay:    time.Duration(mountConfig.RemountDelay) * time.Second,
+		}
+		go func(mount *servedMount) {
+			err := serveWithRecovery(mount.filesystem, mount, mount.mountpoint, policy, mountConfig.DesktopNotifications)
+			mount.filesystem.Stop()
+			logging.Info().Str("mountpoint", mount.mountpoint).Msg("Mount stopped")
+			errs <- err
+		}(mount)
+	}
+	var failed error
+	for range mounts {
+		if err := <-errs; err != nil && failed == nil {
+			failed = common.WithFailureReason(err, common.FailureFuseUnavailable)
+		}
+	}
+	return failed
+}
+
+// setupMultiSignalHandler unmounts all mounts of a multi-mount process on
+// SIGINT and SIGTERM, like setupSignalHandler does for a single mount.
+func setupMultiSignalHandler(mounts []*servedMount, cancel context.CancelFunc) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigChan
+		logging.Info().Str("signal", strings.ToUpper(sig.String())).Int("mounts", len(mounts)).
+			Msg("Signal received, cleaning up and unmounting filesystems.")
+		notifyService(systemd.NotifyStopping())
+		cancel()
+
+		var wg sync.WaitGroup
+		var failed atomic.Bool
+		for _, mount := range mounts {
+			wg.Add(1)
+			go func(mount *servedMount) {
+				defer wg.Done()
+				if err := unmountFilesystem(mount.filesystem, mount, mount.mountpoint, true); err != nil {
+					logging.Error().Err(err).Str("mountpoint", mount.mountpoint).
+						Msg("Failed to unmount filesystem cleanly after multiple attempts! " +
+							"Run \"fusermount3 -uz " + mount.mountpoint + "\" to unmount.")
+					failed.Store(true)
+				}
+			}(mount)
+		}
+		wg.Wait()
+
+		if failed.Load() {
+			os.Exit(1)
+		}
+		logging.Info().Msg("Filesystems unmounted successfully.")
+		os.Exit(0)
+	}()
+}
@@ -35,6 +35,31 @@ const (
 
 	// ErrorTypeResourceBusy represents a resource busy error.
 	ErrorTypeResourceBusy
+
+	// ErrorTypeConflict represents a change that conflicts with the current
+	// state of the resource, such as a name already in use.
+	ErrorTypeConflict
+
+	// ErrorTypeQuotaExceeded represents a storage quota that is used up.
+	ErrorTypeQuotaExceeded
+)
+
+// Sentinel errors that callers test with errors.Is, whatever package the
+// error comes from. Typed errors match the sentinel of their type, and
+// packages derive their own sentinels from these with NewKind.
+var (
+	// ErrNotFound reports that the item or entry does not exist.
+	ErrNotFound = New("not found")
+	// ErrConflict reports a change that conflicts with the current state.
+	ErrConflict = New("conflict")
+	// ErrOffline reports that OneDrive cannot be reached.
+	ErrOffline = New("offline")
+	// ErrQuotaExceeded reports that the OneDrive storage quota is used up.
+	ErrQuotaExceeded = New("quota exceeded")
+	// ErrInvalidTransition reports a state change that is not allowed.
+	ErrInvalidTransition = New("invalid state transition")
+	// ErrIntegrity reports content that does not match its checksum.
+	ErrIntegrity = New("integrity check failed")
 )
 
 // String returns the string representation of the error type.
@@ -54,6 +79,10 @@ func (et ErrorType) String() string {
 		return "TimeoutError"
 	case ErrorTypeResourceBusy:
 		return "ResourceBusyError"
+	case ErrorTypeConflict:
+		return "ConflictError"
+	case ErrorTypeQuotaExceeded:
+		return "QuotaExceededError"
 	default:
 		return "UnknownError"
 	}
@@ -64,6 +93,7 @@ type TypedError struct {
 	Type       ErrorType
 	Message    string
 	StatusCode int
+	Code       string // error code of the service, e.g. "nameAlreadyExists"
 	Err        error
 }
 
@@ -80,6 +110,37 @@ func (e *TypedError) Unwrap() error {
 	return e.Err
 }
 
+// Is reports whether target is the sentinel error of the error's type.
+func (e *TypedError) Is(target error) bool {
+	switch e.Type {
+	case ErrorTypeNotFound:
+		return target == ErrNotFound
+	case ErrorTypeConflict:
+		return target == ErrConflict
+	case ErrorTypeQuotaExceeded:
+		return target == ErrQuotaExceeded
+	case ErrorTypeNetwork:
+		return target == ErrOffline
+	}
+	return false
+}
+
+// kindError is a sentinel error that also matches a more general one.
+type kindError struct {
+	message string
+	kind    error
+}
+
+func (e *kindError) Error() string { return e.message }
+
+func (e *kindError) Unwrap() error { return e.kind }
+
+// NewKind returns a sentinel error with the given message that errors.Is
+// also matches against kind, one of the sentinels above.
+func NewKind(message string, kind error) error {
+	return &kindError{message: message, kind: kind}
+}
+
 // NewNetworkError creates a new network error.
 func NewNetworkError(message string, err error) error {
 	return &TypedError{
@@ -150,6 +211,26 @@ func NewResourceBusyError(message string, err error) error {
 	}
 }
 
+// NewConflictError creates a new conflict error.
+func NewConflictError(message string, err error) error {
+	return &TypedError{
+		Type:       ErrorTypeConflict,
+		Message:    message,
+		StatusCode: http.StatusConflict,
+		Err:        err,
+	}
+}
+
+// NewQuotaExceededError creates a new quota exceeded error.
+func NewQuotaExceededError(message string, err error) error {
+	return &TypedError{
+		Type:       ErrorTypeQuotaExceeded,
+		Message:    message,
+		StatusCode: http.StatusInsufficientStorage,
+		Err:        err,
+	}
+}
+
 // IsNetworkError checks if the error is a network error.
 func IsNetworkError(err error) bool {
 	var typedErr *TypedError
@@ -212,3 +293,31 @@ func IsResourceBusyError(err error) bool {
 	}
 	return false
 }
+
+// IsConflictError checks if the error is a conflict error.
+func IsConflictError(err error) bool {
+	var typedErr *TypedError
+	if As(err, &typedErr) {
+		return typedErr.Type == ErrorTypeConflict
+	}
+	return false
+}
+
+// IsQuotaExceededError checks if the error is a quota exceeded error.
+func IsQuotaExceededError(err error) bool {
+	var typedErr *TypedError
+	if As(err, &typedErr) {
+		return typedErr.Type == ErrorTypeQuotaExceeded
+	}
+	return false
+}
+
+// Code returns the service error code carried by err, or "" if it carries
+// none.
+func Code(err error) string {
+	var typedErr *TypedError
+	if As(err, &typedErr) {
+		return typedErr.Code
+	}
+	return ""
+}
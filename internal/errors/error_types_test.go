@@ -21,6 +21,8 @@ func TestUT_ET_01_01_ErrorType_String_ReturnsCorrectString(t *testing.T) {
 		{ErrorTypeOperation, "OperationError"},
 		{ErrorTypeTimeout, "TimeoutError"},
 		{ErrorTypeResourceBusy, "ResourceBusyError"},
+		{ErrorTypeConflict, "ConflictError"},
+		{ErrorTypeQuotaExceeded, "QuotaExceededError"},
 	}
 
 	for _, test := range tests {
@@ -103,6 +105,8 @@ func TestUT_ET_04_01_NewErrorFunctions_CreateCorrectErrorTypes(t *testing.T) {
 		{"NewOperationError", NewOperationError, ErrorTypeOperation, 500},
 		{"NewTimeoutError", NewTimeoutError, ErrorTypeTimeout, 408},
 		{"NewResourceBusyError", NewResourceBusyError, ErrorTypeResourceBusy, 409},
+		{"NewConflictError", NewConflictError, ErrorTypeConflict, 409},
+		{"NewQuotaExceededError", NewQuotaExceededError, ErrorTypeQuotaExceeded, 507},
 	}
 
 	for _, test := range tests {
@@ -209,3 +213,37 @@ func TestUT_ET_06_02_ErrorChain_PreservesAllTypes(t *testing.T) {
 	assert.True(t, Is(wrappedErr, notFoundErr))
 	assert.True(t, Is(wrappedErr, baseErr))
 }
+
+// TestUT_ET_07_01_Sentinels_MatchTypedAndDerivedErrors tests that typed errors
+// and sentinels derived with NewKind match the shared sentinels.
+func TestUT_ET_07_01_Sentinels_MatchTypedAndDerivedErrors(t *testing.T) {
+	tests := []struct {
+		err      error
+		sentinel error
+	}{
+		{NewNotFoundError("item not found", nil), ErrNotFound},
+		{NewConflictError("name in use", nil), ErrConflict},
+		{NewQuotaExceededError("drive is full", nil), ErrQuotaExceeded},
+		{NewNetworkError("no route to host", nil), ErrOffline},
+	}
+	sentinels := []error{ErrNotFound, ErrConflict, ErrOffline, ErrQuotaExceeded, ErrInvalidTransition}
+
+	for _, test := range tests {
+		wrapped := Wrap(test.err, "wrapped error")
+		for _, sentinel := range sentinels {
+			assert.Equal(t, sentinel == test.sentinel, Is(wrapped, sentinel), "%v against %v", test.err, sentinel)
+		}
+	}
+	assert.False(t, Is(NewOperationError("server error", nil), ErrOffline))
+
+	derived := NewKind("store: entry not found", ErrNotFound)
+	assert.Equal(t, "store: entry not found", derived.Error())
+	assert.True(t, Is(fmt.Errorf("loading: %w", derived), ErrNotFound))
+	assert.True(t, Is(fmt.Errorf("loading: %w", derived), derived))
+	assert.False(t, Is(ErrNotFound, derived))
+
+	typed := NewConflictError("nameAlreadyExists: name in use", nil).(*TypedError)
+	typed.Code = "nameAlreadyExists"
+	assert.Equal(t, "nameAlreadyExists", Code(Wrap(typed, "upload failed")))
+	assert.Equal(t, "", Code(fmt.Errorf("plain error")))
+}
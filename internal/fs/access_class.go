@@ -0,0 +1,139 @@
+package fs
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Desktop search indexers open every file they find to extract its text.
+// On a drive whose files are mostly in the cloud, that downloads the whole
+// drive. Opens are classified by the process making them: the opens of a
+// known indexer do not hydrate files unless configured to, fail with ENODATA
+// instead, and reading cached content does not keep it from being evicted.
+// File managers listing folders and stat()ing files only send metadata
+// requests, which never hydrate and are not classified.
+//
+// Indexers are recognized by their process name only. O_NOATIME, which some
+// indexers open files with, is also used by backup tools that mean to read
+// everything.
+
+// AccessClass is what the process opening a file is likely doing with it.
+type AccessClass int
+
+const (
+	// AccessRead is an application reading the file for the user
+	AccessRead AccessClass = iota
+
+	// AccessIndexer is a desktop search indexer scanning the drive
+	AccessIndexer
+)
+
+// String returns the name of the access class.
+func (c AccessClass) String() string {
+	switch c {
+	case AccessIndexer:
+		return "indexer"
+	default:
+		return "read"
+	}
+}
+
+// DefaultIndexerProcesses are the process names of the desktop search
+// indexers of GNOME (Tracker, LocalSearch), KDE (Baloo) and Recoll.
+var DefaultIndexerProcesses = []string{
+	"tracker-miner-fs-3", "tracker-extract-3", "tracker-miner-fs", "tracker-extract",
+	"localsearch-3", "localsearch-extractor-3",
+	"baloo_file", "baloo_file_extractor",
+	"recollindex",
+}
+
+// commNameLength is the length the kernel truncates process names to in
+// /proc/<pid>/comm.
+const commNameLength = 15
+
+// accessClasses classifies opens. The zero value treats every open as
+// AccessRead.
+type accessClasses struct {
+	mu       sync.RWMutex
+	indexers map[string]struct{} // process names, truncated as in /proc/<pid>/comm
+	hydrate  bool                // indexer opens may hydrate files
+
+	indexerOpens   atomic.Uint64
+	indexerRefused atomic.Uint64
+}
+
+// SetIndexerAccess configures how opens by desktop search indexers are
+// handled. hydrate lets them download files that are not cached; processes
+// are recognized as indexers in addition to DefaultIndexerProcesses.
+func (f *Filesystem) SetIndexerAccess(hydrate bool, processes []string) {
+	indexers := make(map[string]struct{}, len(DefaultIndexerProcesses)+len(processes))
+	for _, name := range append(append([]string{}, DefaultIndexerProcesses...), processes...) {
+		if name = strings.TrimSpace(name); name != "" {
+			indexers[commName(name)] = struct{}{}
+		}
+	}
+	f.access.mu.Lock()
+	f.access.indexers = indexers
+	f.access.hydrate = hydrate
+	f.access.mu.Unlock()
+}
+
+// commName truncates a process name as the kernel does.
+func commName(name string) string {
+	if len(name) > commNameLength {
+		return name[:commNameLength]
+	}
+	return name
+}
+
+// classifyAccess returns the access class of an open by the process pid.
+func (f *Filesystem) classifyAccess(pid uint32) AccessClass {
+	f.access.mu.RLock()
+	empty := len(f.access.indexers) == 0
+	f.access.mu.RUnlock()
+	if pid == 0 || empty {
+		return AccessRead
+	}
+	comm, err := os.ReadFile("/proc/" + strconv.FormatUint(uint64(pid), 10) + "/comm")
+	if err != nil {
+		// The process may have exited already
+		return AccessRead
+	}
+	name := strings.TrimSpace(string(comm))
+	f.access.mu.RLock()
+	_, indexer := f.access.indexers[name]
+	f.access.mu.RUnlock()
+	if !indexer {
+		return AccessRead
+	}
+	f.access.indexerOpens.Add(1)
+	return AccessIndexer
+}
+
+// mayHydrate reports whether an open of the given class may download the
+// file.
+func (f *Filesystem) mayHydrate(class AccessClass) bool {
+	if class != AccessIndexer {
+		return true
+	}
+	f.access.mu.RLock()
+	defer f.access.mu.RUnlock()
+	return f.access.hydrate
+}
+
+// refuseHydration records that an indexer was not allowed to download id.
+func (f *Filesystem) refuseHydration(id, path string, pid uint32) {
+	f.access.indexerRefused.Add(1)
+	if logging.IsDebugEnabled() {
+		logging.Debug().
+			Str(logging.FieldID, id).
+			Str(logging.FieldPath, path).
+			Uint32("pid", pid).
+			Msg("Not downloading a file for a search indexer")
+	}
+}
@@ -0,0 +1,76 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// indexerCaller returns the header of a request made by this process, after
+// configuring the filesystem to treat it as a search indexer.
+func indexerCaller(t *testing.T, fs *Filesystem, hydrate bool, nodeID uint64) *fuse.OpenIn {
+	t.Helper()
+	comm, err := os.ReadFile("/proc/self/comm")
+	if err != nil {
+		t.Skip("process names are not available")
+	}
+	fs.SetIndexerAccess(hydrate, []string{strings.TrimSpace(string(comm))})
+	in := &fuse.OpenIn{InHeader: fuse.InHeader{NodeId: nodeID}}
+	in.Caller.Pid = uint32(os.Getpid())
+	return in
+}
+
+func TestUT_FS_AccessClass_IndexerDoesNotHydrate(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	ghost := NewInodeDriveItem(&graph.DriveItem{ID: "ghost", Name: "ghost.txt", Size: 6, File: &graph.File{}})
+	registerHydratedEntry(t, fs, ghost)
+
+	in := indexerCaller(t, fs, false, ghost.NodeID())
+	require.Equal(t, fuse.ENODATA, fs.Open(nil, in, &fuse.OpenOut{}))
+	require.False(t, fs.content.HasContent("ghost"), "no empty content may be left for a ghost file")
+
+	stats := &Stats{}
+	fs.augmentAttrCacheStats(stats)
+	require.Equal(t, uint64(1), stats.IndexerOpens)
+	require.Equal(t, uint64(1), stats.IndexerHydrationsRefused)
+}
+
+func TestUT_FS_AccessClass_IndexerReadDoesNotWarmCache(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.SetOfflineMode(OfflineModeReadWrite)
+	cached := NewInodeDriveItem(&graph.DriveItem{ID: "cached", Name: "cached.txt", Size: 6, File: &graph.File{}})
+	registerHydratedEntry(t, fs, cached)
+	require.NoError(t, fs.content.Insert("cached", []byte("123456")))
+	lastAccess := func() time.Time {
+		fs.content.entriesM.RLock()
+		defer fs.content.entriesM.RUnlock()
+		return fs.content.entries["cached"].lastAccessed
+	}
+	before := lastAccess()
+
+	in := indexerCaller(t, fs, false, cached.NodeID())
+	require.Equal(t, fuse.OK, fs.Open(nil, in, &fuse.OpenOut{}))
+	require.Equal(t, before, lastAccess(), "an indexer reading a file does not keep it cached")
+	require.NoError(t, fs.content.Close("cached"))
+
+	fs.SetIndexerAccess(false, nil)
+	require.Equal(t, AccessRead, fs.classifyAccess(in.Caller.Pid))
+	require.Equal(t, fuse.OK, fs.Open(nil, in, &fuse.OpenOut{}))
+	require.True(t, lastAccess().After(before))
+}
+
+func TestUT_FS_AccessClass_MatchesTruncatedProcessNames(t *testing.T) {
+	require.Equal(t, "baloo_file_extr", commName("baloo_file_extractor"))
+	require.Equal(t, "recollindex", commName("recollindex"))
+
+	fs := &Filesystem{}
+	require.Equal(t, AccessRead, fs.classifyAccess(uint32(os.Getpid())), "nothing is an indexer unless configured")
+	require.True(t, fs.mayHydrate(AccessRead))
+	fs.SetIndexerAccess(true, nil)
+	require.True(t, fs.mayHydrate(AccessIndexer))
+}
@@ -0,0 +1,182 @@
+package fs
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Access times are recorded like the relatime mount option: opening a file
+// records when it was accessed only if the recorded time is older than the
+// access time interval, so a file read all day is written at most once per
+// interval. Recorded times wait in memory and are written in one database
+// transaction per minute and when the mount stops. They survive remounts as
+// LastAccessed of the metadata entry and order the content cache's least
+// recently used eviction, which otherwise only knows when files were
+// modified. Opens by search indexers do not count as accesses.
+
+// DefaultAccessTimeInterval is how old a recorded access time must be before
+// an access records a new one.
+const DefaultAccessTimeInterval = time.Hour
+
+// accessTimeFlushInterval is how often recorded access times are written.
+const accessTimeFlushInterval = time.Minute
+
+// accessTimes holds the access times recorded since they were last written.
+// The zero value records nothing.
+type accessTimes struct {
+	mu       sync.Mutex
+	interval time.Duration        // 0 records nothing
+	recorded map[string]time.Time // last access time recorded per item
+	pending  map[string]time.Time // recorded but not written yet
+}
+
+// record notes that id was accessed at now, unless an access within the
+// interval was recorded already.
+func (a *accessTimes) record(id string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.interval <= 0 {
+		return
+	}
+	if last, ok := a.recorded[id]; ok && now.Sub(last) < a.interval {
+		return
+	}
+	a.recorded[id] = now
+	a.pending[id] = now
+}
+
+// take returns the access times waiting to be written.
+func (a *accessTimes) take() map[string]time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.pending) == 0 {
+		return nil
+	}
+	pending := a.pending
+	a.pending = make(map[string]time.Time)
+	return pending
+}
+
+// StartAccessTimes records access times at most once per interval per item,
+// loads the recorded ones into the content cache and writes new ones
+// periodically until the filesystem stops. An interval of zero or less
+// records none.
+func (f *Filesystem) StartAccessTimes(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	f.accessTimes.mu.Lock()
+	f.accessTimes.interval = interval
+	f.accessTimes.recorded = make(map[string]time.Time)
+	f.accessTimes.pending = make(map[string]time.Time)
+	f.accessTimes.mu.Unlock()
+	f.loadAccessTimes()
+
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+
+		ticker := time.NewTicker(accessTimeFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				f.flushAccessTimes()
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// recordAccess notes that the user accessed the item id.
+func (f *Filesystem) recordAccess(id string) {
+	f.accessTimes.record(id, time.Now())
+}
+
+// loadAccessTimes hands the recorded access times of cached files to the
+// content cache, so eviction starts from them instead of modification times.
+func (f *Filesystem) loadAccessTimes() {
+	if f.db == nil || f.content == nil {
+		return
+	}
+	loaded := make(map[string]time.Time)
+	err := f.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMetadataV2)
+		if bucket == nil {
+			return nil
+		}
+		for _, id := range f.content.cachedIDs() {
+			raw := bucket.Get([]byte(id))
+			if raw == nil {
+				continue
+			}
+			var entry metadata.Entry
+			if err := json.Unmarshal(raw, &entry); err == nil && entry.LastAccessed != nil {
+				loaded[id] = *entry.LastAccessed
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Warn().Err(err).Msg("Failed to load access times")
+		return
+	}
+
+	f.accessTimes.mu.Lock()
+	for id, at := range loaded {
+		f.accessTimes.recorded[id] = at
+	}
+	f.accessTimes.mu.Unlock()
+	for id, at := range loaded {
+		f.content.noteAccessed(id, at)
+	}
+	logging.Debug().Int("items", len(loaded)).Msg("Loaded access times")
+}
+
+// flushAccessTimes writes the access times recorded since the last flush in
+// one transaction.
+func (f *Filesystem) flushAccessTimes() {
+	pending := f.accessTimes.take()
+	if len(pending) == 0 || f.db == nil {
+		return
+	}
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMetadataV2)
+		if bucket == nil {
+			return nil
+		}
+		for id, at := range pending {
+			raw := bucket.Get([]byte(id))
+			if raw == nil {
+				continue
+			}
+			var entry metadata.Entry
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				continue
+			}
+			// An access time is not a change of the item, UpdatedAt stays
+			at := at.UTC()
+			entry.LastAccessed = &at
+			data, err := json.Marshal(&entry)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Warn().Err(err).Int("items", len(pending)).Msg("Failed to write access times")
+		return
+	}
+	logging.Debug().Int("items", len(pending)).Msg("Wrote access times")
+}
@@ -0,0 +1,69 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_AccessTimes_RecordsOncePerInterval(t *testing.T) {
+	times := accessTimes{
+		interval: time.Hour,
+		recorded: make(map[string]time.Time),
+		pending:  make(map[string]time.Time),
+	}
+	start := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	times.record("a", start)
+	times.record("a", start.Add(59*time.Minute))
+	require.Equal(t, map[string]time.Time{"a": start}, times.take())
+	require.Nil(t, times.take(), "nothing new to write")
+
+	times.record("a", start.Add(61*time.Minute))
+	require.Equal(t, map[string]time.Time{"a": start.Add(61 * time.Minute)}, times.take())
+
+	var off accessTimes
+	off.record("a", start)
+	require.Nil(t, off.take(), "without an interval nothing is recorded")
+}
+
+func TestUT_FS_AccessTimes_PersistAndOrderEviction(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	for _, id := range []string{"read-yesterday", "read-last-week"} {
+		file := NewInodeDriveItem(&graph.DriveItem{ID: id, Name: id, File: &graph.File{}, Size: 100})
+		registerHydratedEntry(t, fs, file)
+		require.NoError(t, fs.content.Insert(id, make([]byte, 100)))
+	}
+	fs.accessTimes = accessTimes{
+		interval: time.Hour,
+		recorded: make(map[string]time.Time),
+		pending:  make(map[string]time.Time),
+	}
+	now := time.Now()
+	fs.accessTimes.record("read-yesterday", now.Add(-24*time.Hour))
+	fs.accessTimes.record("read-last-week", now.Add(-7*24*time.Hour))
+	fs.flushAccessTimes()
+
+	entry, err := fs.GetMetadataEntry("read-last-week")
+	require.NoError(t, err)
+	require.NotNil(t, entry.LastAccessed)
+	require.WithinDuration(t, now.Add(-7*24*time.Hour), *entry.LastAccessed, time.Second)
+	fs.persistMetadataEntry("read-last-week", fs.GetID("read-last-week"))
+	entry, err = fs.GetMetadataEntry("read-last-week")
+	require.NoError(t, err)
+	require.NotNil(t, entry.LastAccessed, "rewriting the entry from the inode keeps the access time")
+
+	// After a restart the cache only knows when the files were written
+	fs.content.entries["read-yesterday"].lastAccessed = now.Add(-30 * 24 * time.Hour)
+	fs.content.entries["read-last-week"].lastAccessed = now.Add(-30 * 24 * time.Hour)
+	fs.accessTimes.recorded = make(map[string]time.Time)
+	fs.loadAccessTimes()
+	fs.content.maxCacheSize = 100
+	plan := fs.content.PlanCleanup(0)
+	require.Len(t, plan, 1)
+	require.Equal(t, "read-last-week", plan[0].ID, "the file opened longest ago is evicted first")
+
+	fs.accessTimes.record("read-yesterday", now.Add(-23*time.Hour-30*time.Minute))
+	require.Empty(t, fs.accessTimes.take(), "loaded access times count towards the interval")
+}
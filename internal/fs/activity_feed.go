@@ -0,0 +1,162 @@
+package fs
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// The activity feed is a read-only virtual file at <mount>/.onemount/events
+// holding one JSON object per line for every sync event, so scripts can follow
+// activity with `tail -f` instead of talking to D-Bus. The file behaves like an
+// append-only log: its size grows as events arrive and offsets never move.
+// Only the most recent activityFeedMaxBytes are retained; reads below the
+// retained window resume at the oldest event still held.
+const (
+	activityDirName      = ".onemount"
+	activityFileName     = "events"
+	activityFeedMaxBytes = 1 << 20
+)
+
+// Activity event types. Every event goes to the feed and, subject to the rate
+// limit, to the event log (see event_log.go).
+const (
+	ActivityHydrated    = "hydrated"
+	ActivityUploaded    = "uploaded"
+	ActivityConflict    = "conflict"
+	ActivityOffline     = "offline"
+	ActivityOnline      = "online"
+	ActivityStateChange = "state"
+	ActivityError       = "error"
+	ActivityThrottle    = "throttle"
+	ActivityJob         = "job"
+	ActivityStall       = "stall"
+	ActivityLatency     = "latency"
+	ActivityMount       = "mount"
+)
+
+// ActivityEvent is one line of the activity feed and one entry of the event
+// log.
+type ActivityEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	ID      string    `json:"id,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Message string    `json:"message,omitempty"`
+	// Events of the same type the event log dropped just before this one;
+	// always zero in the feed
+	Suppressed uint32 `json:"suppressed,omitempty"`
+}
+
+// activityFeed buffers recent events. The zero value is ready to use.
+type activityFeed struct {
+	mu     sync.Mutex
+	inode  *Inode // the events file once it has been created
+	buf    []byte // retained events, newline terminated
+	offset uint64 // stream offset of buf[0]
+}
+
+// append adds a serialized event, trimming the oldest whole lines once the
+// buffer exceeds its limit.
+func (a *activityFeed) append(line []byte, now time.Time) {
+	a.mu.Lock()
+	a.buf = append(a.buf, line...)
+	if excess := len(a.buf) - activityFeedMaxBytes; excess > 0 {
+		cut := excess
+		for cut < len(a.buf) && a.buf[cut-1] != '\n' {
+			cut++
+		}
+		a.buf = append([]byte(nil), a.buf[cut:]...)
+		a.offset += uint64(cut)
+	}
+	size := a.offset + uint64(len(a.buf))
+	inode := a.inode
+	a.mu.Unlock()
+
+	if inode != nil {
+		inode.mu.Lock()
+		inode.DriveItem.Size = size
+		inode.DriveItem.ModTime = &now
+		inode.mu.Unlock()
+	}
+}
+
+// readAt returns up to size bytes of the stream starting at off.
+func (a *activityFeed) readAt(off uint64, size int) []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if off < a.offset {
+		off = a.offset
+	}
+	start := off - a.offset
+	if start >= uint64(len(a.buf)) || size <= 0 {
+		return nil
+	}
+	end := start + uint64(size)
+	if end > uint64(len(a.buf)) {
+		end = uint64(len(a.buf))
+	}
+	return append([]byte(nil), a.buf[start:end]...)
+}
+
+// isFeed reports whether id is the events file.
+func (a *activityFeed) isFeed(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.inode != nil && a.inode.ID() == id
+}
+
+// emitActivity appends an event for the item to the activity feed and records
+// it in the event log.
+func (f *Filesystem) emitActivity(eventType, id, message string) {
+	now := time.Now()
+	event := ActivityEvent{
+		Time:    now.UTC(),
+		Type:    eventType,
+		ID:      id,
+		Message: message,
+	}
+	if id != "" {
+		if inode := f.GetID(id); inode != nil {
+			event.Path = inode.Path()
+		}
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		logging.Debug().Err(err).Str("type", eventType).Msg("Failed to encode activity event")
+		return
+	}
+	f.activity.append(append(line, '\n'), now)
+	f.events.add(event)
+	f.digest.record(eventType)
+	f.metrics.recordActivity(eventType)
+}
+
+// CreateActivityFeed exposes the activity feed as .onemount/events at the
+// mount root, next to the policy.yml export. All entries are local-only
+// virtual files.
+func (f *Filesystem) CreateActivityFeed() {
+	root := f.GetID(f.root)
+	if root == nil {
+		logging.Warn().Msg("Root not available, activity feed not created")
+		return
+	}
+
+	dir := NewInode(activityDirName, fuse.S_IFDIR|0555, root)
+	dir.SetVirtualContent(nil)
+	f.RegisterVirtualFile(dir)
+
+	events := NewInode(activityFileName, fuse.S_IFREG|0444, dir)
+	events.SetVirtualContent(nil)
+	f.activity.mu.Lock()
+	f.activity.inode = events
+	events.DriveItem.Size = f.activity.offset + uint64(len(f.activity.buf))
+	f.activity.mu.Unlock()
+	f.RegisterVirtualFile(events)
+	f.createPolicyFile(dir)
+
+	logging.Debug().Str("id", events.ID()).Msg("Created activity feed")
+}
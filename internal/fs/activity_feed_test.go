@@ -0,0 +1,107 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func setupActivityFeedFS(t *testing.T) (*Filesystem, *Inode) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+
+	root := NewInode("root", fuse.S_IFDIR|0755, nil)
+	root.DriveItem.ID = "root"
+	root.children = []string{}
+	registerHydratedEntry(t, fs, root)
+	fs.root = root.ID()
+
+	fs.CreateActivityFeed()
+	dir := childNamed(fs, root.ID(), activityDirName)
+	require.NotNil(t, dir, "activity directory should be registered under the root")
+	events := childNamed(fs, dir.ID(), activityFileName)
+	require.NotNil(t, events, "events file should be registered")
+	return fs, events
+}
+
+func readFeedEvents(t *testing.T, fs *Filesystem, events *Inode, offset uint64) []ActivityEvent {
+	t.Helper()
+	buf := make([]byte, 64*1024)
+	res, status := fs.Read(nil, &fuse.ReadIn{
+		InHeader: fuse.InHeader{NodeId: events.NodeID()},
+		Offset:   offset,
+		Size:     uint32(len(buf)),
+	}, buf)
+	require.Equal(t, fuse.OK, status)
+	data, status := res.Bytes(buf)
+	require.Equal(t, fuse.OK, status)
+
+	var out []ActivityEvent
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event ActivityEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		out = append(out, event)
+	}
+	return out
+}
+
+func TestUT_FS_ActivityFeed_StreamsEventsAsLines(t *testing.T) {
+	fs, events := setupActivityFeedFS(t)
+
+	openOut := &fuse.OpenOut{}
+	require.Equal(t, fuse.OK, fs.Open(nil, &fuse.OpenIn{InHeader: fuse.InHeader{NodeId: events.NodeID()}}, openOut))
+	require.NotZero(t, openOut.OpenFlags&fuse.FOPEN_DIRECT_IO, "feed must bypass the page cache")
+
+	// Setting up the root already recorded its state transition.
+	start := events.Size()
+	fs.SetOfflineMode(OfflineModeReadWrite)
+	fs.MarkFileConflict("root", "diverged")
+	size := events.Size()
+	require.Greater(t, size, start, "file size should grow with each event")
+
+	got := readFeedEvents(t, fs, events, start)
+	require.Len(t, got, 2)
+	require.Equal(t, ActivityOffline, got[0].Type)
+	require.Equal(t, ActivityConflict, got[1].Type)
+	require.Equal(t, "root", got[1].ID)
+	require.Equal(t, "diverged", got[1].Message)
+
+	// A follower reading from its previous end of file only sees new events.
+	fs.SetOfflineMode(OfflineModeDisabled)
+	got = readFeedEvents(t, fs, events, size)
+	require.Len(t, got, 1)
+	require.Equal(t, ActivityOnline, got[0].Type)
+
+	status := func() fuse.Status {
+		_, status := fs.Write(nil, &fuse.WriteIn{InHeader: fuse.InHeader{NodeId: events.NodeID()}}, []byte("x"))
+		return status
+	}()
+	require.Equal(t, fuse.EPERM, status)
+}
+
+func TestUT_FS_ActivityFeed_TrimsWholeLinesKeepingOffsets(t *testing.T) {
+	var feed activityFeed
+	now := time.Now()
+	line := []byte(fmt.Sprintf("%0*d\n", 1023, 0)) // 1 KiB per line
+	total := 0
+	for total <= activityFeedMaxBytes+4*len(line) {
+		feed.append(line, now)
+		total += len(line)
+	}
+
+	require.LessOrEqual(t, len(feed.buf), activityFeedMaxBytes)
+	require.Equal(t, uint64(total), feed.offset+uint64(len(feed.buf)), "stream size must count trimmed bytes")
+	require.Zero(t, feed.offset%uint64(len(line)), "trimming should drop whole lines")
+
+	// Reads below the retained window resume at the oldest retained line.
+	chunk := feed.readAt(0, len(line))
+	require.Equal(t, line, chunk)
+	require.Nil(t, feed.readAt(uint64(total), 10), "reads at the end of the stream return nothing")
+}
@@ -0,0 +1,211 @@
+package fs
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Logs and notes files grow by appends and are flushed often, and uploading
+// on every fsync sends the whole file again each time. OneDrive cannot append
+// to a file or replace part of it: every upload, simple or through an upload
+// session, carries the complete new content, so what can be saved is the
+// number of uploads. A file whose writes since it was last in sync all land
+// at or past its synced size is an append run. Fsyncs of an append run do not
+// upload at once; the upload waits until appendUploadDelay passes without
+// another fsync, and at most appendUploadMaxDelay after the first one. Before
+// uploading, the QuickXorHash OneDrive reports for the item is compared with
+// the one of the synced content the run appended to. If OneDrive has another
+// version by then, the remote item is applied like a delta, which marks the
+// file conflicted, instead of the upload overwriting it. A write before the
+// synced size, a truncation below it or strict POSIX mode end the run and
+// upload as usual.
+const (
+	appendUploadDelay    = 30 * time.Second
+	appendUploadMaxDelay = 5 * time.Minute
+)
+
+// appendRun follows the writes to a file since it was last in sync.
+type appendRun struct {
+	base     uint64 // synced size the run appends to
+	baseHash string // QuickXorHash of the synced content
+	appended bool   // every write so far was at or past base
+	first    time.Time
+	timer    *time.Timer
+}
+
+// appendUploads tracks append runs by item ID. The zero value is ready to
+// use.
+type appendUploads struct {
+	mu   sync.Mutex
+	runs map[string]*appendRun
+
+	coalesced atomic.Uint64
+	uploads   atomic.Uint64
+}
+
+// AppendUploadStats reports how many fsyncs of append runs were folded into
+// a later upload and how many uploads append runs made.
+type AppendUploadStats struct {
+	CoalescedFsyncs uint64
+	Uploads         uint64
+}
+
+// AppendUploadStats returns the append upload counters.
+func (f *Filesystem) AppendUploadStats() AppendUploadStats {
+	return AppendUploadStats{
+		CoalescedFsyncs: f.appendUploads.coalesced.Load(),
+		Uploads:         f.appendUploads.uploads.Load(),
+	}
+}
+
+// noteAppendWriteLocked follows a write at offset to a file that was size
+// bytes long before it; wasClean reports that the file had no local changes
+// until this write. Callers hold i.mu.
+func (f *Filesystem) noteAppendWriteLocked(i *Inode, offset, size uint64, wasClean bool) {
+	id := i.DriveItem.ID
+	a := &f.appendUploads
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if wasClean {
+		a.endRunLocked(id)
+		if isLocalID(id) || size == 0 || i.DriveItem.File == nil || i.DriveItem.File.Hashes.QuickXorHash == "" {
+			return
+		}
+		if a.runs == nil {
+			a.runs = make(map[string]*appendRun)
+		}
+		a.runs[id] = &appendRun{base: size, baseHash: i.DriveItem.File.Hashes.QuickXorHash, appended: true}
+	}
+	if run := a.runs[id]; run != nil && offset < run.base {
+		run.appended = false
+	}
+}
+
+// noteAppendTruncateLocked follows a truncation of the file to size. Callers
+// hold i.mu.
+func (f *Filesystem) noteAppendTruncateLocked(i *Inode, size uint64) {
+	a := &f.appendUploads
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if run := a.runs[i.DriveItem.ID]; run != nil && size < run.base {
+		run.appended = false
+	}
+}
+
+// endRunLocked forgets the run of id. Callers hold a.mu.
+func (a *appendUploads) endRunLocked(id string) *appendRun {
+	run := a.runs[id]
+	if run == nil {
+		return nil
+	}
+	if run.timer != nil {
+		run.timer.Stop()
+	}
+	delete(a.runs, id)
+	return run
+}
+
+// deferAppendUpload is checked by Fsync before queueing an upload. It reports
+// true when the file is an append run whose upload is scheduled for later.
+func (f *Filesystem) deferAppendUpload(inode *Inode) bool {
+	id := inode.ID()
+	a := &f.appendUploads
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	run := a.runs[id]
+	if run == nil {
+		return false
+	}
+	if !run.appended {
+		a.endRunLocked(id)
+		return false
+	}
+
+	now := time.Now()
+	if run.first.IsZero() {
+		run.first = now
+	}
+	delay := appendUploadDelay
+	if left := run.first.Add(appendUploadMaxDelay).Sub(now); left < delay {
+		delay = left
+	}
+	if run.timer != nil && run.timer.Stop() {
+		a.coalesced.Add(1)
+	}
+	if delay <= 0 {
+		// Waited long enough; upload now and start a new run once it is in sync.
+		a.endRunLocked(id)
+		a.uploads.Add(1)
+		return false
+	}
+	run.timer = time.AfterFunc(delay, func() {
+		f.uploadAppendRun(id)
+	})
+	return true
+}
+
+// uploadAppendRun uploads the file of an append run once its delay passed.
+func (f *Filesystem) uploadAppendRun(id string) {
+	a := &f.appendUploads
+	a.mu.Lock()
+	run := a.runs[id]
+	delete(a.runs, id)
+	a.mu.Unlock()
+	if run == nil {
+		return
+	}
+	f.uploadAppendRunWith(id, run, graphItemRemote{ctx: f.mountContext(), auth: f.auth})
+}
+
+// uploadAppendRunWith checks that OneDrive still has the content run appended
+// to and queues the upload.
+func (f *Filesystem) uploadAppendRunWith(id string, run *appendRun, remote itemRemote) {
+	inode := f.GetID(id)
+	if inode == nil || !inode.HasChanges() {
+		return
+	}
+	if !f.IsOffline() {
+		item, err := remote.GetItem(id)
+		switch {
+		case err != nil:
+			logging.Debug().Err(err).Str("id", id).Msg("Could not check remote version before append upload")
+		case item.File != nil && item.File.Hashes.QuickXorHash != "" && item.File.Hashes.QuickXorHash != run.baseHash:
+			logging.Info().Str("id", id).Str("name", inode.Name()).
+				Msg("File changed on OneDrive while appending to it, not overwriting")
+			if item.Parent == nil {
+				return
+			}
+			if err := f.applyDelta(item); err != nil {
+				logging.Warn().Err(err).Str("id", id).Msg("Failed to apply remote version of appended file")
+			}
+			return
+		}
+	}
+	if f.holdUpload(inode) {
+		return
+	}
+	f.appendUploads.uploads.Add(1)
+	if _, err := f.uploads.QueueUploadWithPriority(inode, PriorityLow); err != nil {
+		logging.Error().Err(err).Str("id", id).Msg("Failed to queue append upload")
+	}
+}
+
+// flushAppendUploads queues the uploads of all append runs at once, before
+// the upload manager stops.
+func (f *Filesystem) flushAppendUploads() {
+	a := &f.appendUploads
+	a.mu.Lock()
+	var ids []string
+	for id, run := range a.runs {
+		if run.timer != nil && run.timer.Stop() {
+			ids = append(ids, id)
+		}
+	}
+	a.mu.Unlock()
+	for _, id := range ids {
+		f.uploadAppendRun(id)
+	}
+}
@@ -0,0 +1,83 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/stretchr/testify/require"
+)
+
+func newAppendTestFile(t *testing.T) (*Filesystem, *Inode) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+	parent := NewInodeDriveItem(&graph.DriveItem{ID: "parent", Name: "logs", Folder: &graph.Folder{}})
+	registerHydratedEntry(t, fs, parent)
+	file := NewInodeDriveItem(&graph.DriveItem{
+		ID:     "log",
+		Name:   "app.log",
+		ETag:   "etag-1",
+		Size:   6,
+		Parent: &graph.DriveItemParent{ID: "parent"},
+		File:   &graph.File{Hashes: graph.Hashes{QuickXorHash: "synced"}},
+	})
+	registerHydratedEntry(t, fs, file)
+	require.NoError(t, fs.content.Insert(file.ID(), []byte("start\n")))
+	t.Cleanup(func() {
+		fs.appendUploads.mu.Lock()
+		fs.appendUploads.endRunLocked(file.ID())
+		fs.appendUploads.mu.Unlock()
+	})
+	return fs, file
+}
+
+func TestUT_FS_AppendUploads_CoalescesFsyncsOfAppends(t *testing.T) {
+	fs, file := newAppendTestFile(t)
+
+	writeAt(t, fs, file, 0, 6, "one\n")
+	require.True(t, fs.deferAppendUpload(file), "appends should wait for more")
+	writeAt(t, fs, file, 0, 10, "two\n")
+	require.True(t, fs.deferAppendUpload(file))
+
+	require.Equal(t, uint64(1), fs.AppendUploadStats().CoalescedFsyncs)
+	fs.appendUploads.mu.Lock()
+	run := fs.appendUploads.runs[file.ID()]
+	fs.appendUploads.mu.Unlock()
+	require.NotNil(t, run)
+	require.Equal(t, uint64(6), run.base)
+	require.Equal(t, "synced", run.baseHash)
+}
+
+func TestUT_FS_AppendUploads_OverwriteUploadsAtOnce(t *testing.T) {
+	fs, file := newAppendTestFile(t)
+
+	writeAt(t, fs, file, 0, 6, "one\n")
+	writeAt(t, fs, file, 0, 0, "S")
+	require.False(t, fs.deferAppendUpload(file), "a write before the synced size ends the run")
+
+	fs.appendUploads.mu.Lock()
+	require.Empty(t, fs.appendUploads.runs)
+	fs.appendUploads.mu.Unlock()
+}
+
+func TestUT_FS_AppendUploads_RemoteChangeIsNotOverwritten(t *testing.T) {
+	fs, file := newAppendTestFile(t)
+	writeAt(t, fs, file, 0, 6, "one\n")
+	fs.markDirtyLocalState(file.ID())
+
+	remote := &fakeRemote{item: &graph.DriveItem{
+		ID:     file.ID(),
+		Name:   "app.log",
+		ETag:   "etag-2",
+		Size:   20,
+		Parent: &graph.DriveItemParent{ID: "parent"},
+		File:   &graph.File{Hashes: graph.Hashes{QuickXorHash: "edited elsewhere"}},
+	}}
+	run := &appendRun{base: 6, baseHash: "synced", appended: true}
+	fs.uploadAppendRunWith(file.ID(), run, remote)
+
+	require.Zero(t, fs.AppendUploadStats().Uploads, "the local version must not replace the remote edit")
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateConflict, entry.State)
+}
@@ -0,0 +1,30 @@
+package fs
+
+import (
+	"github.com/auriora/onemount/internal/errors"
+)
+
+// An archive mount (onemount --frozen) serves the cache as it was left, for
+// example to browse the cache of a closed account or to back it up. It is
+// mounted read-only and offline: nothing is fetched from or sent to OneDrive,
+// no delta or cleanup runs, and files whose content was never cached fail to
+// open with ENODATA instead of being downloaded. Archive mounts are unrelated
+// to frozen files, which are local overrides in a normal mount.
+
+// ErrArchiveMount is returned for downloads requested in an archive mount.
+var ErrArchiveMount = errors.New("archive mounts only serve cached content")
+
+// SetArchiveMode serves the mount from the cache only. It must be set before
+// the filesystem is mounted.
+func (f *Filesystem) SetArchiveMode(enabled bool) {
+	f.Lock()
+	f.archive = enabled
+	f.Unlock()
+}
+
+// ArchiveMode reports whether the mount serves the cache only.
+func (f *Filesystem) ArchiveMode() bool {
+	f.RLock()
+	defer f.RUnlock()
+	return f.archive
+}
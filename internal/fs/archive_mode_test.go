@@ -0,0 +1,35 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_ArchiveMode_ServesOnlyCachedContent(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.SetArchiveMode(true)
+	cached := NewInodeDriveItem(&graph.DriveItem{ID: "cached", Name: "cached.txt", Size: 6, File: &graph.File{}})
+	registerHydratedEntry(t, fs, cached)
+	require.NoError(t, fs.content.Insert(cached.ID(), []byte("123456")))
+	ghost := NewInodeDriveItem(&graph.DriveItem{ID: "ghost", Name: "ghost.txt", Size: 6, File: &graph.File{}})
+	registerHydratedEntry(t, fs, ghost)
+
+	out := &fuse.OpenOut{}
+	require.Equal(t, fuse.OK, fs.Open(nil, &fuse.OpenIn{InHeader: fuse.InHeader{NodeId: cached.NodeID()}}, out))
+	require.Equal(t, fuse.ENODATA, fs.Open(nil, &fuse.OpenIn{InHeader: fuse.InHeader{NodeId: ghost.NodeID()}}, out))
+	require.False(t, fs.content.HasContent("ghost"), "no empty content may be left for a ghost file")
+	require.Equal(t, uint64(6), ghost.Size())
+}
+
+func TestUT_FS_ArchiveMode_RefusesDownloads(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.SetArchiveMode(true)
+	dm := &DownloadManager{fs: fs, sessions: make(map[string]*DownloadSession), queue: make(chan string, 1)}
+
+	_, err := dm.QueueDownload("ghost")
+	require.ErrorIs(t, err, ErrArchiveMount)
+	require.Empty(t, dm.queue)
+}
@@ -0,0 +1,61 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+func newAttrTestInode(id string, modTime time.Time) *Inode {
+	return NewInodeDriveItem(&graph.DriveItem{ID: id, Name: id + ".txt", ModTime: &modTime, File: &graph.File{}})
+}
+
+func TestUT_FS_AttrCache_TimeoutByVolatility(t *testing.T) {
+	f := &Filesystem{}
+	now := time.Now()
+
+	stable := newAttrTestInode("stable", now.Add(-48*time.Hour))
+	require.Equal(t, maxAttrTimeout, f.attrTimeoutAt(stable, now))
+
+	fresh := newAttrTestInode("fresh", now.Add(-time.Second))
+	require.Less(t, f.attrTimeoutAt(fresh, now), 2*time.Second)
+
+	halfway := newAttrTestInode("halfway", now.Add(-attrStableAge/2))
+	ttl := f.attrTimeoutAt(halfway, now)
+	require.Greater(t, ttl, timeout)
+	require.Less(t, ttl, maxAttrTimeout)
+
+	dirty := newAttrTestInode("dirty", now.Add(-48*time.Hour))
+	dirty.hasChanges = true
+	require.Equal(t, timeout, f.attrTimeoutAt(dirty, now))
+
+	local := NewInode("local.txt", 0644, nil)
+	require.Equal(t, timeout, f.attrTimeoutAt(local, now))
+}
+
+func TestUT_FS_AttrCache_RemoteChangeShortensTimeout(t *testing.T) {
+	f := &Filesystem{}
+	now := time.Now()
+	inode := newAttrTestInode("changed", now.Add(-48*time.Hour))
+
+	f.attrCache.noteRemoteChange("changed", now.Add(-time.Minute))
+	require.Equal(t, timeout, f.attrTimeoutAt(inode, now))
+
+	// Once the volatile window passes the item is considered stable again.
+	require.Equal(t, maxAttrTimeout, f.attrTimeoutAt(inode, now.Add(attrVolatileWindow)))
+	_, tracked := f.attrCache.remoteChanges.Load("changed")
+	require.False(t, tracked)
+}
+
+func TestUT_FS_AttrCache_StatsCounters(t *testing.T) {
+	f := &Filesystem{}
+	f.attrCache.hits.Add(3)
+	f.attrCache.misses.Add(1)
+
+	stats := &Stats{}
+	f.augmentAttrCacheStats(stats)
+	require.Equal(t, uint64(3), stats.AttrCacheHits)
+	require.Equal(t, uint64(1), stats.AttrCacheMisses)
+}
@@ -122,3 +122,16 @@ func (w *SafeAuthWrapper) ValidateConnection() error {
 	_, err := w.SafeAPICall("/me")
 	return err
 }
+
+// StartTokenPreRefresh renews the auth tokens in the background shortly
+// before they expire, so no file operation has to wait for a token refresh.
+func (f *Filesystem) StartTokenPreRefresh() {
+	if f.auth == nil {
+		return
+	}
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+		graph.RunTokenPreRefresh(f.ctx, f.auth)
+	}()
+}
@@ -0,0 +1,374 @@
+package fs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// Deleting a folder tree with "rm -r" unlinks every file and then removes
+// every folder, bottom up. Sending each of those to OneDrive on its own takes
+// thousands of requests, and a failure midway leaves OneDrive half deleted
+// while the mount shows nothing. Remote deletes are therefore planned rather
+// than sent right away: once deletes stop for deletePlanQuiet (or after
+// deletePlanMaxDelay at the latest) the plan is carried out. Removing a
+// folder takes the planned deletes of its children into its own, so a tree
+// removed locally becomes a single delete of its top folder. Creating an
+// item under the name of a planned delete sends that delete first.
+//
+// A folder is deleted in one request only when listing it, and each folder
+// below it, shows nothing but planned deletes; OneDrive would otherwise take
+// items along that the mount never showed. Otherwise its children are
+// deleted one by one, with retries, and the folder is deleted once it is
+// empty. Items that could not be deleted, and the folders holding them, are
+// restored in the mount so it shows what is still on OneDrive.
+
+const (
+	deletePlanQuiet    = time.Second
+	deletePlanMaxDelay = 10 * time.Second
+	deleteAttempts     = 5
+	deleteRetryDelay   = 200 * time.Millisecond
+	// deletePlanShutdown bounds carrying out the plan while unmounting
+	deletePlanShutdown = 10 * time.Second
+)
+
+// deleteRemote is the subset of the Graph API used to carry out planned
+// deletes. Tests substitute a fake.
+type deleteRemote interface {
+	Remove(ctx context.Context, id string) error
+	Children(ctx context.Context, id string) ([]*graph.DriveItem, error)
+}
+
+// graphDeleteRemote forwards deletes to the Graph API.
+type graphDeleteRemote struct {
+	auth *graph.Auth
+}
+
+func (c graphDeleteRemote) Remove(ctx context.Context, id string) error {
+	return graph.RemoveWithContext(ctx, id, c.auth)
+}
+
+func (c graphDeleteRemote) Children(ctx context.Context, id string) ([]*graph.DriveItem, error) {
+	return graph.GetItemChildrenWithContext(ctx, id, c.auth)
+}
+
+// plannedDelete is an item deleted locally and not yet on OneDrive.
+type plannedDelete struct {
+	item     graph.DriveItem // as it was when deleted, to restore it
+	parentID string
+	children []*plannedDelete // planned deletes inside this folder
+}
+
+// count returns the number of items the delete covers.
+func (d *plannedDelete) count() int {
+	n := 1
+	for _, child := range d.children {
+		n += child.count()
+	}
+	return n
+}
+
+// deletePlan holds the remote deletes not carried out yet. The zero value is
+// ready to use.
+type deletePlan struct {
+	mu      sync.Mutex
+	pending map[string]*plannedDelete // by ID, only the top of each tree
+	first   time.Time                 // when the oldest pending delete was planned
+	timer   *time.Timer
+}
+
+// DeleteOutcome reports how a plan of remote deletes went.
+type DeleteOutcome struct {
+	Requests int // delete requests sent
+	Deleted  int // items gone from OneDrive
+	Restored int // items that could not be deleted and are shown again
+}
+
+// planRemoteDelete plans the remote delete of the locally deleted inode.
+func (f *Filesystem) planRemoteDelete(inode *Inode) {
+	d := newPlannedDelete(inode)
+	if d.item.ID == "" || isLocalID(d.item.ID) || f.auth == nil {
+		return
+	}
+	f.deletePlan.add(d, f.runDeletePlan)
+}
+
+// newPlannedDelete records the inode as it is before it is deleted.
+func newPlannedDelete(inode *Inode) *plannedDelete {
+	parentID := inode.ParentID()
+	inode.mu.RLock()
+	defer inode.mu.RUnlock()
+	return &plannedDelete{item: inode.DriveItem, parentID: parentID}
+}
+
+// sendPlannedDelete carries out a planned delete of the item called name in
+// the folder right away, before an item of the same name is created there.
+// OneDrive would otherwise put the new item in place of the old one and the
+// planned delete would remove it.
+func (f *Filesystem) sendPlannedDelete(parentID, name string) {
+	if planned := f.deletePlan.takeNamed(parentID, name); len(planned) > 0 {
+		f.carryOutDeletes(f.mountContext(), planned, graphDeleteRemote{auth: f.auth})
+	}
+}
+
+// add plans d, taking in the planned deletes of its children, and arranges
+// for run to be called once deletes stop.
+func (p *deletePlan) add(d *plannedDelete, run func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = make(map[string]*plannedDelete)
+	}
+	id := d.item.ID
+	if d.item.IsDir() {
+		for childID, child := range p.pending {
+			if child.parentID == id {
+				d.children = append(d.children, child)
+				delete(p.pending, childID)
+			}
+		}
+	}
+	p.pending[id] = d
+
+	now := time.Now()
+	if p.first.IsZero() {
+		p.first = now
+	}
+	delay := deletePlanQuiet
+	if left := p.first.Add(deletePlanMaxDelay).Sub(now); left < delay {
+		delay = max(left, 0)
+	}
+	if p.timer == nil {
+		p.timer = time.AfterFunc(delay, run)
+	} else {
+		p.timer.Reset(delay)
+	}
+}
+
+// take removes and returns the pending deletes.
+func (p *deletePlan) take() []*plannedDelete {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	planned := make([]*plannedDelete, 0, len(p.pending))
+	for _, d := range p.pending {
+		planned = append(planned, d)
+	}
+	p.pending = nil
+	p.first = time.Time{}
+	return planned
+}
+
+// takeNamed removes and returns the pending deletes of items called name in
+// the folder.
+func (p *deletePlan) takeNamed(parentID, name string) []*plannedDelete {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var planned []*plannedDelete
+	for id, d := range p.pending {
+		if d.parentID == parentID && strings.EqualFold(d.item.Name, name) {
+			planned = append(planned, d)
+			delete(p.pending, id)
+		}
+	}
+	return planned
+}
+
+// runDeletePlan carries out the pending deletes in the background.
+func (f *Filesystem) runDeletePlan() {
+	if f.mountContext().Err() != nil {
+		// Stop sends them
+		return
+	}
+	f.Wg.Add(1)
+	defer f.Wg.Done()
+	f.carryOutDeletes(f.mountContext(), f.deletePlan.take(), graphDeleteRemote{auth: f.auth})
+}
+
+// flushDeletePlan carries out the pending deletes before unmounting.
+func (f *Filesystem) flushDeletePlan() {
+	planned := f.deletePlan.take()
+	if len(planned) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deletePlanShutdown)
+	defer cancel()
+	f.carryOutDeletes(ctx, planned, graphDeleteRemote{auth: f.auth})
+}
+
+// carryOutDeletes deletes the planned items on OneDrive and restores those
+// that could not be deleted.
+func (f *Filesystem) carryOutDeletes(ctx context.Context, planned []*plannedDelete, remote deleteRemote) DeleteOutcome {
+	var outcome DeleteOutcome
+	for _, d := range planned {
+		kept := f.carryOutDelete(ctx, d, remote, &outcome)
+		for _, k := range kept {
+			f.restoreUndeleted(k)
+			outcome.Restored++
+		}
+		if len(d.children) > 0 || len(kept) > 0 {
+			logging.Info().
+				Str("id", d.item.ID).
+				Str("name", d.item.Name).
+				Int("items", d.count()).
+				Int("requests", outcome.Requests).
+				Int("restored", len(kept)).
+				Msg("Deleted folder tree on OneDrive")
+		}
+	}
+	return outcome
+}
+
+// carryOutDelete deletes d on OneDrive. It returns the items of d that are
+// still there, each folder before its contents.
+func (f *Filesystem) carryOutDelete(ctx context.Context, d *plannedDelete, remote deleteRemote, outcome *DeleteOutcome) []*plannedDelete {
+	id := d.item.ID
+	if !d.item.IsDir() {
+		if f.removeRemote(ctx, id, remote, outcome) {
+			f.confirmRemoteDelete(d, outcome)
+			return nil
+		}
+		return []*plannedDelete{d}
+	}
+
+	whole, gone, err := f.deletableAsWhole(ctx, d, remote)
+	if gone {
+		f.confirmRemoteDelete(d, outcome)
+		return nil
+	}
+	if err == nil && whole {
+		if f.removeRemote(ctx, id, remote, outcome) {
+			f.confirmRemoteDelete(d, outcome)
+			return nil
+		}
+	}
+
+	// Delete the contents one by one, then the folder once it is empty
+	var kept []*plannedDelete
+	for _, child := range d.children {
+		kept = append(kept, f.carryOutDelete(ctx, child, remote, outcome)...)
+	}
+	if len(kept) == 0 && ctx.Err() == nil {
+		if left, err := remote.Children(ctx, id); err == nil && len(left) == 0 {
+			if f.removeRemote(ctx, id, remote, outcome) {
+				outcome.Deleted++
+				f.clearChildPendingRemote(id)
+				f.transitionItemState(id, metadata.ItemStateDeleted)
+				return nil
+			}
+		} else if isNotFoundError(err) {
+			outcome.Deleted++
+			return nil
+		}
+	}
+	return append([]*plannedDelete{d}, kept...)
+}
+
+// deletableAsWhole reports whether the folder of d and every folder below it
+// hold nothing on OneDrive but planned deletes, and whether the folder is
+// gone already.
+func (f *Filesystem) deletableAsWhole(ctx context.Context, d *plannedDelete, remote deleteRemote) (whole, gone bool, err error) {
+	children, err := remote.Children(ctx, d.item.ID)
+	if err != nil {
+		return false, isNotFoundError(err), err
+	}
+	planned := make(map[string]*plannedDelete, len(d.children))
+	for _, child := range d.children {
+		planned[child.item.ID] = child
+	}
+	for _, child := range children {
+		sub, ok := planned[child.ID]
+		if !ok {
+			return false, false, nil
+		}
+		if sub.item.IsDir() {
+			if whole, gone, err := f.deletableAsWhole(ctx, sub, remote); err != nil || !(whole || gone) {
+				return false, false, err
+			}
+		}
+	}
+	return true, false, nil
+}
+
+// removeRemote deletes the item with retries. An item that is already gone
+// counts as deleted.
+func (f *Filesystem) removeRemote(ctx context.Context, id string, remote deleteRemote, outcome *DeleteOutcome) bool {
+	for attempt := 1; attempt <= deleteAttempts; attempt++ {
+		if ctx.Err() != nil {
+			return false
+		}
+		outcome.Requests++
+		err := remote.Remove(ctx, id)
+		if err == nil || isNotFoundError(err) {
+			return true
+		}
+		logging.Warn().Str("id", id).Int("attempt", attempt).Err(err).Msg("Remote delete failed")
+		if attempt < deleteAttempts {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(deleteRetryDelay * time.Duration(attempt)):
+			}
+		}
+	}
+	return false
+}
+
+// confirmRemoteDelete records that d and everything planned below it are
+// gone from OneDrive.
+func (f *Filesystem) confirmRemoteDelete(d *plannedDelete, outcome *DeleteOutcome) {
+	outcome.Deleted++
+	f.clearChildPendingRemote(d.item.ID)
+	f.transitionItemState(d.item.ID, metadata.ItemStateDeleted)
+	for _, child := range d.children {
+		f.confirmRemoteDelete(child, outcome)
+	}
+}
+
+// restoreUndeleted shows an item again that could not be deleted on
+// OneDrive. Its parent is restored first.
+func (f *Filesystem) restoreUndeleted(d *plannedDelete) {
+	item := d.item
+	parent := graph.DriveItemParent{ID: d.parentID}
+	if d.item.Parent != nil {
+		parent.DriveID = d.item.Parent.DriveID
+	}
+	item.Parent = &parent
+
+	// DELETED_LOCAL is final for the state machine, so the entry is reset
+	// before the item is applied again
+	state := metadata.ItemStateGhost
+	if item.IsDir() {
+		state = metadata.ItemStateHydrated
+	}
+	if f.metadataStore != nil {
+		_, _ = f.metadataStore.Update(context.Background(), item.ID, func(entry *metadata.Entry) error {
+			if entry == nil {
+				return metadata.ErrNotFound
+			}
+			entry.State = state
+			return nil
+		})
+	}
+	if err := f.applyDelta(&item); err != nil {
+		logging.Warn().Str("id", item.ID).Err(err).Msg("Failed to restore item that was not deleted on OneDrive")
+		return
+	}
+	if item.IsDir() {
+		// it may hold items the mount never listed
+		f.refreshChildrenAsync(item.ID, nil)
+	} else {
+		// the cached content was deleted with the item
+		f.markContentEvicted(item.ID)
+	}
+	logging.Warn().Str("id", item.ID).Str("name", item.Name).
+		Msg("Could not delete item on OneDrive, showing it again")
+	f.emitActivity(ActivityError, item.ID, "could not be deleted on OneDrive and was restored")
+}
@@ -0,0 +1,151 @@
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeleteRemote keeps the folder listings of OneDrive in memory.
+type fakeDeleteRemote struct {
+	listings map[string][]string // folder ID to child IDs
+	fail     map[string]bool     // items whose delete fails
+	removed  []string
+}
+
+func (r *fakeDeleteRemote) Remove(_ context.Context, id string) error {
+	if r.fail[id] {
+		return graphAPIError(423, "resourceLocked")
+	}
+	r.removed = append(r.removed, id)
+	delete(r.listings, id)
+	for folder, children := range r.listings {
+		for i, child := range children {
+			if child == id {
+				r.listings[folder] = append(children[:i:i], children[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (r *fakeDeleteRemote) Children(_ context.Context, id string) ([]*graph.DriveItem, error) {
+	children, ok := r.listings[id]
+	if !ok {
+		return nil, graphAPIError(404, "itemNotFound")
+	}
+	items := make([]*graph.DriveItem, 0, len(children))
+	for _, child := range children {
+		items = append(items, &graph.DriveItem{ID: child})
+	}
+	return items, nil
+}
+
+// newDeleteTestTree returns a filesystem with the folder "docs" holding the
+// folder "photos" with the files "a" and "b", and the plan that "rm -r
+// photos" makes.
+func newDeleteTestTree(t *testing.T) (*Filesystem, []*plannedDelete) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+	fs.uploads.deletionQueue = make(chan string, 8)
+	docs := NewInodeDriveItem(&graph.DriveItem{ID: "docs", Name: "docs", Folder: &graph.Folder{}})
+	registerHydratedEntry(t, fs, docs)
+	photos := NewInodeDriveItem(&graph.DriveItem{
+		ID: "photos", Name: "photos", Folder: &graph.Folder{},
+		Parent: &graph.DriveItemParent{ID: "docs"},
+	})
+	registerHydratedEntry(t, fs, photos)
+	fs.InsertChild("docs", photos)
+	for _, id := range []string{"a", "b"} {
+		file := NewInodeDriveItem(&graph.DriveItem{
+			ID: id, Name: id + ".jpg", File: &graph.File{},
+			Parent: &graph.DriveItemParent{ID: "photos"},
+		})
+		registerHydratedEntry(t, fs, file)
+		fs.InsertChild("photos", file)
+	}
+
+	for _, id := range []string{"a", "b", "photos"} {
+		fs.deletePlan.add(newPlannedDelete(fs.GetID(id)), func() {})
+		fs.DeleteID(id)
+	}
+	planned := fs.deletePlan.take()
+	require.Len(t, planned, 1, "the folder takes in the deletes of its files")
+	require.Len(t, planned[0].children, 2)
+	return fs, planned
+}
+
+func TestUT_FS_BulkDelete_RemovesTreeInOneRequest(t *testing.T) {
+	fs, planned := newDeleteTestTree(t)
+	remote := &fakeDeleteRemote{listings: map[string][]string{
+		"docs":   {"photos"},
+		"photos": {"a", "b"},
+	}}
+
+	outcome := fs.carryOutDeletes(context.Background(), planned, remote)
+	require.Equal(t, []string{"photos"}, remote.removed)
+	require.Equal(t, DeleteOutcome{Requests: 1, Deleted: 3}, outcome)
+	for _, id := range []string{"a", "b", "photos"} {
+		entry, err := fs.GetMetadataEntry(id)
+		require.NoError(t, err)
+		require.Equal(t, metadata.ItemStateDeleted, entry.State)
+	}
+}
+
+func TestUT_FS_BulkDelete_KeepsFolderWithUnlistedItems(t *testing.T) {
+	fs, planned := newDeleteTestTree(t)
+	remote := &fakeDeleteRemote{listings: map[string][]string{
+		"docs":   {"photos"},
+		"photos": {"a", "b", "c"}, // "c" arrived after the mount last listed the folder
+	}}
+
+	outcome := fs.carryOutDeletes(context.Background(), planned, remote)
+	require.ElementsMatch(t, []string{"a", "b"}, remote.removed, "only what was deleted locally goes")
+	require.Equal(t, DeleteOutcome{Requests: 2, Deleted: 2, Restored: 1}, outcome)
+
+	photos, _ := fs.GetChild("docs", "photos", nil)
+	require.NotNil(t, photos, "the folder still on OneDrive is shown again")
+	require.Empty(t, photos.GetChildren())
+}
+
+func TestUT_FS_BulkDelete_RestoresItemsThatFailed(t *testing.T) {
+	fs, planned := newDeleteTestTree(t)
+	remote := &fakeDeleteRemote{
+		listings: map[string][]string{
+			"docs":   {"photos"},
+			"photos": {"a", "b"},
+		},
+		fail: map[string]bool{"photos": true, "b": true},
+	}
+
+	outcome := fs.carryOutDeletes(context.Background(), planned, remote)
+	require.Equal(t, []string{"a"}, remote.removed)
+	require.Equal(t, 2, outcome.Restored)
+
+	photos, _ := fs.GetChild("docs", "photos", nil)
+	require.NotNil(t, photos)
+	b, _ := fs.GetChild("photos", "b.jpg", nil)
+	require.NotNil(t, b, "the file that could not be deleted is shown again")
+	entry, err := fs.GetMetadataEntry("b")
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateGhost, entry.State, "its content was deleted locally")
+	a, _ := fs.GetChild("photos", "a.jpg", nil)
+	require.Nil(t, a)
+}
+
+func TestUT_FS_BulkDelete_RecreatingNameTakesPlannedDelete(t *testing.T) {
+	var plan deletePlan
+	file := NewInodeDriveItem(&graph.DriveItem{
+		ID: "a", Name: "Report.txt", File: &graph.File{},
+		Parent: &graph.DriveItemParent{ID: "docs"},
+	})
+	plan.add(newPlannedDelete(file), func() {})
+
+	require.Empty(t, plan.takeNamed("other", "report.txt"))
+	require.Len(t, plan.takeNamed("docs", "report.txt"), 1, "names match as on OneDrive, ignoring case")
+	require.Empty(t, plan.take())
+}
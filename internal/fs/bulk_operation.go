@@ -0,0 +1,174 @@
+package fs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// While the user copies or moves thousands of files into the mount, applying
+// deltas and refreshing directories in the background only churns metadata
+// that is about to change again and can race the local changes. A bulk
+// operation pauses both: it is started explicitly with BeginBulkOperation
+// (e.g. by a file manager before a large paste) or detected automatically
+// when more than bulkAutoThreshold creates, deletes and renames happen within
+// bulkAutoWindow. The pause ends with EndBulkOperation, after bulkQuietPeriod
+// without local changes for detected operations, or after bulkMaxDuration for
+// explicit ones whose client went away. The delta loop then runs a single
+// reconcile with OneDrive.
+const (
+	bulkAutoThreshold  = 200
+	bulkAutoWindow     = 10 * time.Second
+	bulkQuietPeriod    = 5 * time.Second
+	bulkMaxDuration    = 30 * time.Minute
+	bulkPauseCheckTime = time.Second
+)
+
+// bulkOperation is an explicitly started bulk operation.
+type bulkOperation struct {
+	reason  string
+	started time.Time
+}
+
+// bulkOperations tracks bulk local operations. The zero value is ready to use.
+type bulkOperations struct {
+	mu          sync.Mutex
+	next        int
+	explicit    map[string]bulkOperation
+	windowStart time.Time
+	windowCount int
+	autoUntil   time.Time
+	resume      chan struct{}
+}
+
+// begin registers an explicit bulk operation and returns its token.
+func (b *bulkOperations) begin(reason string, now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next++
+	token := fmt.Sprintf("bulk-%d", b.next)
+	if b.explicit == nil {
+		b.explicit = make(map[string]bulkOperation)
+	}
+	b.explicit[token] = bulkOperation{reason: reason, started: now}
+	return token
+}
+
+// end finishes the explicit bulk operation with the given token.
+func (b *bulkOperations) end(token string, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.explicit[token]; !ok {
+		return errors.NewNotFoundError("bulk operation not found", nil)
+	}
+	delete(b.explicit, token)
+	if !b.activeLocked(now) {
+		b.signalResumeLocked()
+	}
+	return nil
+}
+
+// noteChange records a local namespace change for auto-detection and returns
+// whether it started a detected bulk operation.
+func (b *bulkOperations) noteChange(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.autoUntil) {
+		b.autoUntil = now.Add(bulkQuietPeriod)
+		return false
+	}
+	if now.Sub(b.windowStart) > bulkAutoWindow {
+		b.windowStart = now
+		b.windowCount = 0
+	}
+	b.windowCount++
+	if b.windowCount < bulkAutoThreshold {
+		return false
+	}
+	b.windowCount = 0
+	b.autoUntil = now.Add(bulkQuietPeriod)
+	return true
+}
+
+// active reports whether a bulk operation is in progress, forgetting explicit
+// operations older than bulkMaxDuration.
+func (b *bulkOperations) active(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.activeLocked(now)
+}
+
+// activeLocked is active for callers holding b.mu.
+func (b *bulkOperations) activeLocked(now time.Time) bool {
+	for token, op := range b.explicit {
+		if now.Sub(op.started) > bulkMaxDuration {
+			logging.Warn().
+				Str("token", token).
+				Str("reason", op.reason).
+				Dur("maxDuration", bulkMaxDuration).
+				Msg("Bulk operation was never ended; resuming delta processing")
+			delete(b.explicit, token)
+		}
+	}
+	return len(b.explicit) > 0 || now.Before(b.autoUntil)
+}
+
+// resumed returns a channel receiving a value when the last explicit bulk
+// operation ends.
+func (b *bulkOperations) resumed() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.resume == nil {
+		b.resume = make(chan struct{}, 1)
+	}
+	return b.resume
+}
+
+// signalResumeLocked wakes the delta loop. Callers hold b.mu.
+func (b *bulkOperations) signalResumeLocked() {
+	if b.resume == nil {
+		b.resume = make(chan struct{}, 1)
+	}
+	select {
+	case b.resume <- struct{}{}:
+	default:
+	}
+}
+
+// BeginBulkOperation pauses delta processing and background directory
+// refreshes until EndBulkOperation is called with the returned token.
+func (f *Filesystem) BeginBulkOperation(reason string) string {
+	token := f.bulk.begin(reason, time.Now())
+	logging.Info().Str("token", token).Str("reason", reason).Msg("Bulk operation started; pausing delta processing")
+	return token
+}
+
+// EndBulkOperation ends the bulk operation with the given token. Delta
+// processing resumes with a reconcile once no bulk operation is left.
+func (f *Filesystem) EndBulkOperation(token string) error {
+	if err := f.bulk.end(token, time.Now()); err != nil {
+		return err
+	}
+	logging.Info().Str("token", token).Msg("Bulk operation ended")
+	return nil
+}
+
+// BulkOperationActive reports whether delta processing is paused for a bulk
+// local operation.
+func (f *Filesystem) BulkOperationActive() bool {
+	return f.bulk.active(time.Now())
+}
+
+// noteLocalChange feeds bulk operation auto-detection with a local create,
+// delete or rename.
+func (f *Filesystem) noteLocalChange() {
+	if f.bulk.noteChange(time.Now()) {
+		logging.Info().
+			Int("changes", bulkAutoThreshold).
+			Dur("window", bulkAutoWindow).
+			Msg("Bulk local operation detected; pausing delta processing")
+	}
+}
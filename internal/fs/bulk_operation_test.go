@@ -0,0 +1,77 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_BulkOperation_ExplicitPauseAndResume(t *testing.T) {
+	var bulk bulkOperations
+	now := time.Now()
+	require.False(t, bulk.active(now))
+
+	first := bulk.begin("paste", now)
+	second := bulk.begin("move", now)
+	require.NotEqual(t, first, second)
+	require.True(t, bulk.active(now))
+
+	require.NoError(t, bulk.end(first, now))
+	require.True(t, bulk.active(now), "another operation is still running")
+	select {
+	case <-bulk.resumed():
+		t.Fatal("resumed while an operation is still running")
+	default:
+	}
+
+	require.NoError(t, bulk.end(second, now))
+	require.False(t, bulk.active(now))
+	select {
+	case <-bulk.resumed():
+	default:
+		t.Fatal("ending the last operation must wake the delta loop")
+	}
+	require.Error(t, bulk.end(second, now))
+
+	bulk.begin("abandoned", now)
+	require.True(t, bulk.active(now.Add(bulkMaxDuration)))
+	require.False(t, bulk.active(now.Add(bulkMaxDuration+time.Second)), "abandoned operations expire")
+}
+
+func TestUT_FS_BulkOperation_AutoDetection(t *testing.T) {
+	var bulk bulkOperations
+	now := time.Now()
+
+	for i := 0; i < bulkAutoThreshold-1; i++ {
+		require.False(t, bulk.noteChange(now.Add(bulkAutoWindow+time.Duration(i)*time.Second)), "slow changes never trigger")
+	}
+	require.False(t, bulk.active(now.Add(bulkAutoWindow*2)))
+
+	start := now.Add(time.Hour)
+	detected := false
+	for i := 0; i < bulkAutoThreshold; i++ {
+		detected = bulk.noteChange(start) || detected
+	}
+	require.True(t, detected)
+	require.True(t, bulk.active(start))
+
+	later := start.Add(bulkQuietPeriod - time.Millisecond)
+	require.False(t, bulk.noteChange(later), "ongoing changes extend the detected operation")
+	require.True(t, bulk.active(later.Add(bulkQuietPeriod-time.Millisecond)))
+	require.False(t, bulk.active(later.Add(bulkQuietPeriod)), "quiet period ends it")
+}
+
+func TestUT_FS_BulkOperation_SkipsBackgroundRefresh(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	token := fs.BeginBulkOperation("test")
+	require.True(t, fs.BulkOperationActive())
+
+	fs.refreshChildrenAsync("dir", &graph.Auth{})
+	_, refreshing := fs.metadataRefresh.Load("dir")
+	require.False(t, refreshing)
+
+	require.NoError(t, fs.EndBulkOperation(token))
+	require.False(t, fs.BulkOperationActive())
+}
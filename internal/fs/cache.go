@@ -6,13 +6,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/auriora/onemount/internal/logging"
 	"github.com/pkg/errors"
 
+	"github.com/auriora/onemount/internal/fs/offline"
 	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/metadata"
 	bolt "go.etcd.io/bbolt"
@@ -66,6 +67,9 @@ const fsVersion = "1"
 
 const (
 	defaultDeltaLink = "/me/drive/root/delta?token=latest"
+	// fullDeltaLink enumerates the whole drive, for accounts whose delta
+	// endpoint rejects token=latest.
+	fullDeltaLink = "/me/drive/root/delta"
 )
 
 const (
@@ -88,15 +92,9 @@ func logLockHoldDuration(lockName, context string, start time.Time) {
 		Msg("Long lock hold detected")
 }
 
-// OfflineChange represents a change made while offline
-type OfflineChange struct {
-	ID        string    `json:"id"`
-	Type      string    `json:"type"` // "create", "modify", "delete", "rename", etc.
-	Timestamp time.Time `json:"timestamp"`
-	Path      string    `json:"path,omitempty"`
-	OldPath   string    `json:"old_path,omitempty"` // For rename operations
-	NewPath   string    `json:"new_path,omitempty"` // For rename operations
-}
+// OfflineChange represents a change made while offline. Changes are recorded in
+// the offline journal and replayed through its state machine.
+type OfflineChange = offline.Change
 
 // NewFilesystemWithContext creates a new filesystem instance for onemount with a context.
 // It initializes the filesystem with the provided authentication, cache directory,
@@ -115,6 +113,46 @@ type OfflineChange struct {
 //   - A new Filesystem instance and nil error on success
 //   - nil and an error if initialization fails
 func NewFilesystemWithContext(ctx context.Context, auth *graph.Auth, cacheDir string, cacheExpirationDays int, cacheCleanupIntervalHours int, maxCacheSize int64) (*Filesystem, error) {
+	return NewFilesystemWithOptions(ctx, auth, cacheDir, FilesystemOptions{
+		CacheExpirationDays:       cacheExpirationDays,
+		CacheCleanupIntervalHours: cacheCleanupIntervalHours,
+		MaxCacheSize:              maxCacheSize,
+	})
+}
+
+// FilesystemOptions holds the settings a Filesystem is created with.
+type FilesystemOptions struct {
+	CacheExpirationDays       int   // days after which cached files expire
+	CacheCleanupIntervalHours int   // hours between cache cleanup runs (1-720)
+	MaxCacheSize              int64 // maximum content cache size in bytes (0 = unlimited)
+	CacheQuota                bool  // MaxCacheSize is this mount's own, not shared with other mounts
+
+	// CacheLedgerDir is the ledger through which caches without a quota
+	// share MaxCacheSize, usually DefaultCacheLedgerDir; empty shares it
+	// with no other cache.
+	CacheLedgerDir string
+
+	// NetworkCache decides what happens when cacheDir is on a network
+	// filesystem; empty keeps the metadata database in memory.
+	NetworkCache NetworkCachePolicy
+
+	// Ephemeral keeps the metadata database in memory, journals no offline
+	// changes and removes cacheDir when the filesystem stops, see
+	// ephemeral.go.
+	Ephemeral bool
+
+	// DeltaScheduler is shared with the other mounts of the process to spread
+	// their delta cycles; nil runs the cycles of this mount on its own.
+	DeltaScheduler *DeltaScheduler
+}
+
+// NewFilesystemWithOptions creates a new filesystem like
+// NewFilesystemWithContext, with all settings taken from opts.
+func NewFilesystemWithOptions(ctx context.Context, auth *graph.Auth, cacheDir string, opts FilesystemOptions) (*Filesystem, error) {
+	cacheExpirationDays := opts.CacheExpirationDays
+	cacheCleanupIntervalHours := opts.CacheCleanupIntervalHours
+	maxCacheSize := opts.MaxCacheSize
+
 	// prepare cache directory
 	if _, err := os.Stat(cacheDir); err != nil {
 		if err = os.Mkdir(cacheDir, 0700); err != nil {
@@ -126,8 +164,18 @@ func NewFilesystemWithContext(ctx context.Context, auth *graph.Auth, cacheDir st
 	}
 	// Try to open the database with retries and exponential backoff
 	var db *bolt.DB
+	var dbPath string
+	var snapshot *metadataSnapshot
+	var ephemeral *ephemeralCache
 	var err error
-	dbPath := filepath.Join(cacheDir, "onemount.db")
+	if opts.Ephemeral {
+		dbPath, ephemeral, err = ephemeralDBPath(cacheDir)
+	} else {
+		dbPath, snapshot, err = metadataDBPath(cacheDir, opts.NetworkCache)
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	// Check if the database file exists
 	if _, statErr := os.Stat(dbPath); statErr == nil {
@@ -232,7 +280,8 @@ func NewFilesystemWithContext(ctx context.Context, auth *graph.Auth, cacheDir st
 		return nil, errors.Wrap(err, "could not create thumbnail cache directory")
 	}
 
-	content := NewLoopbackCacheWithSize(contentDir, maxCacheSize)
+	content := NewLoopbackCacheWithSize(contentDir, 0)
+	content.SetCacheLimit(maxCacheSize, opts.CacheQuota, opts.CacheLedgerDir)
 	thumbnails := NewThumbnailCache(thumbnailDir)
 	err = db.Update(func(tx *bolt.Tx) error {
 		if _, err := tx.CreateBucketIfNotExists(bucketMetadataV2); err != nil {
@@ -298,22 +347,30 @@ func NewFilesystemWithContext(ctx context.Context, auth *graph.Auth, cacheDir st
 		thumbnails:           thumbnails,
 		db:                   db,
 		auth:                 auth,
-		opendirs:             make(map[uint64][]*Inode),
+		opendirs:             make(map[uint64]*dirStream),
 		nodeIndex:            make(map[uint64]*Inode),
 		statuses:             make(map[string]FileStatusInfo),
 		statusCache:          newStatusCache(5 * time.Second), // 5 second TTL for status determination cache
 		statusCacheTTL:       5 * time.Second,
+		transferProgress:     newProgressTracker(progressEmitInterval),
 		ctx:                  fsCtx,
 		cancel:               fsCancel,
 		cacheExpirationDays:  cacheExpirationDays,
 		cacheCleanupInterval: cleanupInterval,
+		cacheLedgerDir:       opts.CacheLedgerDir,
 		cacheCleanupStop:     make(chan struct{}),
 		deltaLoopStop:        make(chan struct{}),
 		deltaLoopCtx:         deltaCtx,
 		deltaLoopCancel:      deltaCancel,
+		deltaBootstrap:       make(chan struct{}),
+		deltaScheduler:       opts.DeltaScheduler,
 		timeoutConfig:        DefaultTimeoutConfig(), // Initialize with default timeout values
 		virtualFiles:         make(map[string]*Inode),
+		metadataSnapshot:     snapshot,
+		ephemeral:            ephemeral,
 	}
+	fs.thumbnailLimit.Store(DefaultThumbnailCacheMB << 20)
+	fs.SetIndexerAccess(false, nil)
 
 	// Initialize with our custom RawFileSystem implementation
 	fs.RawFileSystem = NewCustomRawFileSystem(fs)
@@ -321,6 +378,9 @@ func NewFilesystemWithContext(ctx context.Context, auth *graph.Auth, cacheDir st
 	// Start mutation queue workers to keep FUSE hot paths non-blocking
 	fs.startMutationQueue()
 
+	// Keep saving metadata held in memory for a cache on a network filesystem
+	fs.startMetadataSnapshots()
+
 	// Initialize metadata request manager with 3 workers
 	fs.metadataRequestManager = NewMetadataRequestManager(fs, defaultMetadataWorkers, defaultMetadataHighQueue, defaultMetadataLowQueue)
 	fs.metadataRequestManager.Start()
@@ -406,47 +466,14 @@ func NewFilesystemWithContext(ctx context.Context, auth *graph.Auth, cacheDir st
 	// Initialize download manager with configurable worker threads and queue size
 	fs.downloads = NewDownloadManager(fs, auth, defaultHydrationWorkers, defaultHydrationQueueSize, db)
 
-	if !fs.IsOffline() {
-		// .Trash-UID is used by "gio trash" for user trash, create it if it
-		// does not exist
-		trash := fmt.Sprintf(".Trash-%d", os.Getuid())
-		if child, _ := fs.GetChild(fs.root, trash, auth); child == nil {
-			item, err := graph.Mkdir(trash, fs.root, auth)
-			if err != nil {
-				logging.Error().Err(err).
-					Msg("Could not create the trash folder. " +
-						"Trashing items through the file browser may result in errors.")
-			} else {
-				trashInode := NewInodeDriveItem(item)
-				fs.InsertID(item.ID, trashInode)
-
-				// Create the required subdirectories for GIO trash
-				infoDir := "info"
-				filesDir := "files"
-
-				// Create info directory
-				if infoChild, _ := fs.GetChild(item.ID, infoDir, auth); infoChild == nil {
-					infoItem, err := graph.Mkdir(infoDir, item.ID, auth)
-					if err != nil {
-						logging.Error().Err(err).Str("dir", infoDir).
-							Msg("Could not create trash info directory")
-					} else {
-						fs.InsertID(infoItem.ID, NewInodeDriveItem(infoItem))
-					}
-				}
+	if !fs.IsOffline() && !auth.DriveScoped() {
+		fs.createTrashFolder(fsCtx, auth)
 
-				// Create files directory
-				if filesChild, _ := fs.GetChild(item.ID, filesDir, auth); filesChild == nil {
-					filesItem, err := graph.Mkdir(filesDir, item.ID, auth)
-					if err != nil {
-						logging.Error().Err(err).Str("dir", filesDir).
-							Msg("Could not create trash files directory")
-					} else {
-						fs.InsertID(filesItem.ID, NewInodeDriveItem(filesItem))
-					}
-				}
-			}
+		caps, capsErr := graph.DetectCapabilities(ctx, auth)
+		if capsErr != nil {
+			logging.Warn().Err(capsErr).Msg("Could not detect Graph capabilities, using defaults")
 		}
+		fs.setCapabilities(caps)
 
 		// Initialize delta link for online operation
 		storedLink, loadErr := fs.loadDeltaLinkFromDB()
@@ -456,7 +483,7 @@ func NewFilesystemWithContext(ctx context.Context, auth *graph.Auth, cacheDir st
 				logging.FieldPath, dbPath)
 		}
 		if storedLink == "" {
-			storedLink = defaultDeltaLink
+			storedLink = fs.initialDeltaLink()
 			if persistErr := fs.persistDeltaLink(storedLink); persistErr != nil {
 				logging.LogError(persistErr, "Failed to persist default delta link",
 					logging.FieldOperation, "NewFilesystem")
@@ -478,6 +505,37 @@ func NewFilesystemWithContext(ctx context.Context, auth *graph.Auth, cacheDir st
 	return fs, nil
 }
 
+// createTrashFolder creates the .Trash-UID folder "gio trash" uses for the
+// user's trash, with its info and files subfolders, when it does not exist.
+// Shared folders are mounted read-only and have none.
+func (f *Filesystem) createTrashFolder(ctx context.Context, auth *graph.Auth) {
+	trash := fmt.Sprintf(".Trash-%d", os.Getuid())
+	if child, _ := f.GetChild(f.root, trash, auth); child != nil {
+		return
+	}
+	item, err := graph.MkdirWithContext(ctx, trash, f.root, auth)
+	if err != nil {
+		logging.Error().Err(err).
+			Msg("Could not create the trash folder. " +
+				"Trashing items through the file browser may result in errors.")
+		return
+	}
+	f.InsertID(item.ID, NewInodeDriveItem(item))
+
+	for _, dir := range []string{"info", "files"} {
+		if child, _ := f.GetChild(item.ID, dir, auth); child != nil {
+			continue
+		}
+		dirItem, err := graph.MkdirWithContext(ctx, dir, item.ID, auth)
+		if err != nil {
+			logging.Error().Err(err).Str("dir", dir).
+				Msg("Could not create trash " + dir + " directory")
+			continue
+		}
+		f.InsertID(dirItem.ID, NewInodeDriveItem(dirItem))
+	}
+}
+
 func (f *Filesystem) loadDeltaLinkFromDB() (string, error) {
 	var storedLink string
 	if err := f.db.View(func(tx *bolt.Tx) error {
@@ -535,23 +593,17 @@ func (f *Filesystem) TrackOfflineChange(change *OfflineChange) error {
 	if !f.IsOffline() {
 		return nil // No need to track if we're online
 	}
+	if f.ephemeral != nil {
+		logging.Debug().Str("id", change.ID).Str("type", change.Type).
+			Msg("Not journaling an offline change of an ephemeral mount")
+		return nil
+	}
 
-	return f.db.Batch(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(bucketOfflineChanges)
-		if err != nil {
-			return err
-		}
-
-		// Generate a unique key for this change
-		key := []byte(fmt.Sprintf("%s-%d", change.ID, change.Timestamp.UnixNano()))
-
-		data, err := json.Marshal(change)
-		if err != nil {
-			return err
-		}
-
-		return b.Put(key, data)
-	})
+	journal, err := f.offlineJournal()
+	if err != nil {
+		return err
+	}
+	return journal.Record(change)
 }
 
 // ProcessOfflineChanges processes all changes made while offline
@@ -567,52 +619,13 @@ func (f *Filesystem) ProcessOfflineChangesWithSyncManager(ctx context.Context) (
 	return syncManager.ProcessOfflineChangesWithRetry(ctx)
 }
 
-// getOfflineChanges retrieves all offline changes from the database
+// getOfflineChanges retrieves the offline changes awaiting replay, oldest first
 func (f *Filesystem) getOfflineChanges(ctx context.Context) ([]*OfflineChange, error) {
-	changes := make([]*OfflineChange, 0)
-
-	err := f.db.View(func(tx *bolt.Tx) error {
-		// Check for context cancellation
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			// Continue with normal operation
-		}
-
-		b := tx.Bucket(bucketOfflineChanges)
-		if b == nil {
-			return nil
-		}
-
-		return b.ForEach(func(k, v []byte) error {
-			// Check for context cancellation periodically
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-				// Continue with normal operation
-			}
-
-			change := &OfflineChange{}
-			if err := json.Unmarshal(v, change); err != nil {
-				return err
-			}
-			changes = append(changes, change)
-			return nil
-		})
-	})
-
+	journal, err := f.offlineJournal()
 	if err != nil {
 		return nil, err
 	}
-
-	// Sort changes by timestamp
-	sort.Slice(changes, func(i, j int) bool {
-		return changes[i].Timestamp.Before(changes[j].Timestamp)
-	})
-
-	return changes, nil
+	return journal.Replayable(ctx)
 }
 
 // ProcessOfflineChangesWithContext processes all changes made while offline with context support
@@ -629,39 +642,9 @@ func (f *Filesystem) ProcessOfflineChangesWithContext(goCtx context.Context) {
 
 	logger.Info().Msg("Processing offline changes...")
 
-	// Get all offline changes
-	changes := make([]*OfflineChange, 0)
-	if err := f.db.View(func(tx *bolt.Tx) error {
-		// Check for context cancellation
-		select {
-		case <-goCtx.Done():
-			return goCtx.Err()
-		default:
-			// Continue with normal operation
-		}
-
-		b := tx.Bucket(bucketOfflineChanges)
-		if b == nil {
-			return nil
-		}
-
-		return b.ForEach(func(k, v []byte) error {
-			// Check for context cancellation periodically
-			select {
-			case <-goCtx.Done():
-				return goCtx.Err()
-			default:
-				// Continue with normal operation
-			}
-
-			change := &OfflineChange{}
-			if err := json.Unmarshal(v, change); err != nil {
-				return err
-			}
-			changes = append(changes, change)
-			return nil
-		})
-	}); err != nil {
+	// Get all offline changes awaiting replay
+	changes, err := f.getOfflineChanges(goCtx)
+	if err != nil {
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			logger.Debug().Msg("Processing offline changes cancelled due to context cancellation")
 			return
@@ -669,11 +652,7 @@ func (f *Filesystem) ProcessOfflineChangesWithContext(goCtx context.Context) {
 		logging.LogErrorWithContext(err, ctx, "Failed to read offline changes from database")
 		return
 	}
-
-	// Sort changes by timestamp
-	sort.Slice(changes, func(i, j int) bool {
-		return changes[i].Timestamp.Before(changes[j].Timestamp)
-	})
+	changes = f.preflightOfflineDeletes(goCtx, changes)
 
 	// Process each change
 	for _, change := range changes {
@@ -690,83 +669,50 @@ func (f *Filesystem) ProcessOfflineChangesWithContext(goCtx context.Context) {
 			Str("id", change.ID).
 			Str("type", change.Type).
 			Str("path", change.Path).
+			Str("state", string(change.CurrentState())).
 			Msg("Processing offline change")
 
-		switch change.Type {
-		case "create", "modify":
-			// Queue upload with low priority since it's a background task
-			if inode := f.GetIDWithContext(change.ID, ctx); inode != nil {
-				f.markDirtyLocalState(change.ID)
-				_, err := f.uploads.QueueUploadWithPriority(inode, PriorityLow)
-				if err != nil {
-					logging.LogErrorWithContext(err, ctx, "Failed to queue upload for offline change",
-						logging.FieldID, change.ID)
-				}
-			}
-		case "delete":
-			// Handle deletion
-			if !isLocalID(change.ID) {
-				if err := graph.Remove(change.ID, f.auth); err != nil {
-					logging.LogErrorWithContext(err, ctx, "Failed to remove item during offline change processing",
-						logging.FieldID, change.ID)
-				}
-			}
-			f.transitionItemState(change.ID, metadata.ItemStateDeleted)
-		case "rename":
-			// Handle rename
-			if inode := f.GetIDWithContext(change.ID, ctx); inode != nil {
-				// Implementation depends on how renames are tracked
-				if change.OldPath != "" && change.NewPath != "" {
-					oldDir := filepath.Dir(change.OldPath)
-					newDir := filepath.Dir(change.NewPath)
-					oldName := filepath.Base(change.OldPath)
-					newName := filepath.Base(change.NewPath)
-
-					// Get parent IDs
-					oldParent, _ := f.GetPath(oldDir, f.auth)
-					newParent, _ := f.GetPath(newDir, f.auth)
-
-					if oldParent != nil && newParent != nil {
-						if err := f.MovePath(oldParent.ID(), newParent.ID(), oldName, newName, f.auth); err != nil {
-							logging.LogErrorWithContext(err, ctx, "Failed to move item during offline change processing",
-								logging.FieldID, change.ID,
-								"oldPath", change.OldPath,
-								"newPath", change.NewPath)
-						}
-					}
-				}
-			}
-			f.markDirtyLocalState(change.ID)
+		if err := f.replayOfflineChange(goCtx, change, f.applyOfflineChange); err != nil {
+			logging.LogErrorWithContext(err, ctx, "Failed to replay offline change",
+				logging.FieldID, change.ID,
+				"type", change.Type,
+				"path", change.Path)
 		}
+	}
 
-		// Remove the processed change
-		if err := f.db.Batch(func(tx *bolt.Tx) error {
-			// Check for context cancellation
-			select {
-			case <-goCtx.Done():
-				return goCtx.Err()
-			default:
-				// Continue with normal operation
-			}
+	logger.Info().Msg("Finished processing offline changes.")
+}
 
-			b := tx.Bucket(bucketOfflineChanges)
-			if b == nil {
-				return nil
-			}
-			key := []byte(fmt.Sprintf("%s-%d", change.ID, change.Timestamp.UnixNano()))
-			return b.Delete(key)
-		}); err != nil {
-			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-				logger.Debug().Msg("Removing processed offline change cancelled due to context cancellation")
-				return
+// applyOfflineChange replays a single journal entry against the server.
+func (f *Filesystem) applyOfflineChange(ctx context.Context, change *OfflineChange) error {
+	switch change.Type {
+	case "create", "modify":
+		// Queue upload with low priority since it's a background task
+		inode := f.GetID(change.ID)
+		if inode == nil {
+			return nil // removed locally since; nothing left to upload
+		}
+		f.markDirtyLocalState(change.ID)
+		if f.holdUpload(inode) {
+			return nil // queued again when the item is unfrozen or the hold ends
+		}
+		if _, err := f.uploads.QueueUploadWithPriority(inode, PriorityLow); err != nil {
+			return errors.Wrap(err, "failed to queue upload for offline change")
+		}
+	case "delete":
+		if !isLocalID(change.ID) {
+			if err := graph.RemoveWithContext(ctx, change.ID, f.auth); err != nil && !isNotFoundError(err) {
+				return errors.Wrap(err, "failed to remove item during offline change processing")
 			}
-			logging.LogErrorWithContext(err, ctx, "Failed to remove processed offline change from database",
-				logging.FieldID, change.ID,
-				"timestamp", change.Timestamp)
 		}
+		f.transitionItemState(change.ID, metadata.ItemStateDeleted)
+	case "rename":
+		// The local tree already reflects the rename; replay it remotely
+		return f.replayOfflineRename(ctx, change)
+	default:
+		return errors.Errorf("unknown change type: %s", change.Type)
 	}
-
-	logger.Info().Msg("Finished processing offline changes.")
+	return nil
 }
 
 // TranslateID returns the DriveItemID for a given NodeID
@@ -826,6 +772,7 @@ func (f *Filesystem) InsertNodeID(inode *Inode) uint64 {
 
 	nodeID := inode.NodeID()
 	if nodeID == 0 {
+		generation := f.itemGeneration(inode.ID())
 		// Lock ordering: inode.mu -> filesystem.RWMutex
 		// This violates the standard hierarchy (filesystem before inode) but is safe here
 		// because we're only modifying the inode's nodeID field and the filesystem's
@@ -838,6 +785,12 @@ func (f *Filesystem) InsertNodeID(inode *Inode) uint64 {
 		f.inodes = append(f.inodes, inode.DriveItem.ID)
 		nodeID = f.lastNodeID
 		inode.nodeID = nodeID
+		inode.generation = generation
+		if !f.strictPOSIX {
+			inode.ino = 0
+		} else if inode.ino == 0 {
+			inode.ino = stableIno(inode.DriveItem.ID)
+		}
 
 		f.Unlock()
 		inode.mu.Unlock()
@@ -1197,6 +1150,10 @@ func (f *Filesystem) shouldEvictContent(id string) bool {
 		logging.Debug().Str("id", id).Msg("Skipping eviction for pinned item")
 		return false
 	}
+	if f.isEvictionExempt(id) {
+		logging.Debug().Str("id", id).Msg("Skipping eviction for item matching an exemption pattern")
+		return false
+	}
 	if entry.State == metadata.ItemStateDirtyLocal {
 		logging.Debug().Str("id", id).Msg("Skipping eviction for dirty-local item")
 		return false
@@ -1210,19 +1167,29 @@ func (f *Filesystem) SetDefaultOverlayPolicy(policy metadata.OverlayPolicy) {
 		logging.Warn().Err(err).Msg("Ignoring invalid overlay policy; keeping previous default")
 		return
 	}
+	f.settingsM.Lock()
 	f.defaultOverlayPolicy = policy
+	f.settingsM.Unlock()
 }
 
 func (f *Filesystem) handleContentEvicted(id string) {
+	if f.markContentEvicted(id) {
+		f.autoHydratePinned(id)
+	}
+}
+
+// markContentEvicted moves a hydrated item back to GHOST after its content
+// was removed. It reports whether the item was hydrated.
+func (f *Filesystem) markContentEvicted(id string) bool {
 	if id == "" {
-		return
+		return false
 	}
 	entry, err := f.GetMetadataEntry(id)
 	if err != nil || entry == nil {
-		return
+		return false
 	}
 	if entry.State != metadata.ItemStateHydrated {
-		return
+		return false
 	}
 	logging.Debug().Str("id", id).Msg("Content evicted; transitioning to GHOST")
 	f.transitionItemState(id, metadata.ItemStateGhost)
@@ -1230,11 +1197,11 @@ func (f *Filesystem) handleContentEvicted(id string) {
 		e.LastHydrated = nil
 		return nil
 	})
-	f.autoHydratePinned(id)
+	return true
 }
 
 func (f *Filesystem) autoHydratePinned(id string) {
-	if id == "" {
+	if id == "" || f.mountContext().Err() != nil {
 		return
 	}
 	entry, err := f.GetMetadataEntry(id)
@@ -1267,6 +1234,9 @@ func (f *Filesystem) autoHydratePinned(id string) {
 		logging.Debug().Str("id", id).Msg("Auto hydration skipped; download manager unavailable")
 		return
 	}
+	if f.deferHydrationForCap(id) {
+		return
+	}
 	if _, err := f.downloads.QueueDownload(id); err != nil {
 		logging.Debug().Err(err).Str("id", id).Msg("Auto hydration queue failed")
 	}
@@ -1278,6 +1248,7 @@ func (f *Filesystem) DeleteID(id string) {
 	if inode := f.GetID(id); inode != nil {
 		nodeID := inode.NodeID()
 		isDir := inode.IsDir()
+		f.writeBuffers.discard(nodeID)
 		// If this is a directory, recursively delete all its children first
 		if isDir && inode.HasChildren() {
 			// Make a copy of the children slice to avoid concurrent modification issues
@@ -1329,7 +1300,10 @@ func (f *Filesystem) DeleteID(id string) {
 	}
 	f.metadata.Delete(id)
 	f.markEntryDeleted(id)
-	f.uploads.CancelUpload(id)
+	f.bumpGeneration(id)
+	if f.uploads != nil {
+		f.uploads.CancelUpload(id)
+	}
 }
 
 func (f *Filesystem) storeNodeIndex(nodeID uint64, inode *Inode) {
@@ -1429,6 +1403,12 @@ func (f *Filesystem) getChildrenID(id string, auth *graph.Auth, forceRefresh boo
 			logging.LogMethodExit(methodName, time.Since(startTime), children, nil)
 		}()
 		return children, nil
+	} else if inode.IsPackage() {
+		// Packages are opaque; their parts are never listed or fetched.
+		defer func() {
+			logging.LogMethodExit(methodName, time.Since(startTime), children, nil)
+		}()
+		return children, nil
 	}
 
 	// Get the path before acquiring any locks to avoid potential deadlocks
@@ -1528,6 +1508,7 @@ func (f *Filesystem) getChildrenID(id string, auth *graph.Auth, forceRefresh boo
 	// Use prioritized metadata request for foreground operations
 	var fetched []*graph.DriveItem
 	var err error
+	mountCtx := f.mountContext()
 
 	priority := PriorityForeground
 	if forceRefresh {
@@ -1557,20 +1538,22 @@ func (f *Filesystem) getChildrenID(id string, auth *graph.Auth, forceRefresh boo
 					Str(logging.FieldPath, pathForLogs).
 					Msg("Metadata queue full, falling back to direct call")
 			}
-			fetched, err = graph.GetItemChildren(id, auth)
+			fetched, err = graph.GetItemChildrenWithContext(mountCtx, id, auth)
 		} else {
 			// Wait for the result with timeout
 			select {
 			case result := <-resultChan:
 				fetched = result.items
 				err = result.err
+			case <-mountCtx.Done():
+				err = mountCtx.Err()
 			case <-time.After(30 * time.Second):
 				err = context.DeadlineExceeded
 				logger.Warn().
 					Str(logging.FieldID, id).
 					Str(logging.FieldPath, pathForLogs).
 					Msg("Foreground metadata request timed out, falling back to direct call")
-				fetched, err = graph.GetItemChildren(id, auth)
+				fetched, err = graph.GetItemChildrenWithContext(mountCtx, id, auth)
 			}
 		}
 	} else {
@@ -1581,7 +1564,7 @@ func (f *Filesystem) getChildrenID(id string, auth *graph.Auth, forceRefresh boo
 				Str(logging.FieldPath, pathForLogs).
 				Msg("About to call graph.GetItemChildren (no metadata manager)")
 		}
-		fetched, err = graph.GetItemChildren(id, auth)
+		fetched, err = graph.GetItemChildrenWithContext(mountCtx, id, auth)
 	}
 
 	if logging.IsDebugEnabled() {
@@ -1604,6 +1587,13 @@ func (f *Filesystem) getChildrenID(id string, auth *graph.Auth, forceRefresh boo
 			}()
 			return children, nil
 		}
+		if mountCtx.Err() != nil {
+			// unmounting, nothing to report
+			defer func() {
+				logging.LogMethodExit(methodName, time.Since(startTime), nil, err)
+			}()
+			return nil, err
+		}
 		// something else happened besides being offline
 		logging.LogErrorWithContext(err, ctx, "Error fetching children from server",
 			logging.FieldID, id,
@@ -1634,6 +1624,7 @@ func (f *Filesystem) getChildrenID(id string, auth *graph.Auth, forceRefresh boo
 			continue
 		}
 		// we will always have an id after fetching from the server
+		item.Name = f.normalizeName(item.Name)
 		child := NewInodeDriveItem(item)
 		f.InsertNodeID(child)
 		f.metadata.Store(child.DriveItem.ID, child)
@@ -1741,11 +1732,21 @@ func (f *Filesystem) refreshChildrenAsync(id string, auth *graph.Auth) {
 	if auth == nil {
 		return
 	}
+	if f.BulkOperationActive() {
+		// the delta reconcile after the bulk operation refreshes it
+		return
+	}
+	if f.mountContext().Err() != nil {
+		// unmounting
+		return
+	}
 	if _, loaded := f.metadataRefresh.LoadOrStore(id, struct{}{}); loaded {
 		return
 	}
 
+	f.Wg.Add(1)
 	go func() {
+		defer f.Wg.Done()
 		defer f.metadataRefresh.Delete(id)
 		if _, err := f.getChildrenID(id, auth, true); err != nil {
 			logging.Debug().
@@ -1926,7 +1927,7 @@ func (f *Filesystem) GetPath(path string, auth *graph.Auth) (*Inode, error) {
 
 	logger := logging.WithLogContext(ctx)
 
-	trimmedPath := strings.TrimSpace(path)
+	trimmedPath := f.normalizeName(strings.TrimSpace(path))
 	if trimmedPath == "" {
 		err := errors.New("path cannot be empty")
 		logging.LogErrorWithContext(err, ctx, "Empty path provided to GetPath",
@@ -2091,6 +2092,11 @@ func (f *Filesystem) MoveID(oldID string, newID string) error {
 		}
 	}
 
+	// A concurrent move must not relink the item between reading its parent
+	// and replacing the ID there
+	release := f.fenceItem(inode)
+	defer release()
+
 	// need to rename the child under the parent
 	// Lock ordering: parent inode only (child not locked here)
 	// See docs/guides/developer/concurrency-guidelines.md
@@ -2113,10 +2119,11 @@ func (f *Filesystem) MoveID(oldID string, newID string) error {
 	inode.DriveItem.ID = newID
 	inode.mu.Unlock()
 
-	// Refresh in-memory indices
-	f.metadata.Delete(oldID)
+	// Refresh in-memory indices. The stored entry of the old ID is marked
+	// deleted first, so a lookup of it in between does not load it back.
 	f.metadata.Store(newID, inode)
 	f.markEntryDeleted(oldID)
+	f.metadata.Delete(oldID)
 
 	if nodeID := inode.NodeID(); nodeID != 0 {
 		f.Lock()
@@ -2143,18 +2150,17 @@ func (f *Filesystem) MoveID(oldID string, newID string) error {
 	return nil
 }
 
-// MovePath moves an item to a new position.
+// MovePath moves an item to a new position. The item is moved where it is, so
+// it keeps its node ID, cached content and uploads in progress, and so do the
+// items below a directory. Work in flight below it follows it to its new path.
 func (f *Filesystem) MovePath(oldParent, newParent, oldName, newName string, auth *graph.Auth) error {
 	inode, err := f.GetChild(oldParent, oldName, auth)
 	if err != nil {
 		return err
 	}
-
-	id := inode.ID()
-	f.DeleteID(id)
-
-	// this is the actual move op
-	inode.SetName(newName)
+	if inode == nil {
+		return errors.New("item not found: " + oldName)
+	}
 	parent := f.GetID(newParent)
 	if parent == nil {
 		parent = f.ensureInodeFromMetadataStore(newParent)
@@ -2162,23 +2168,96 @@ func (f *Filesystem) MovePath(oldParent, newParent, oldName, newName string, aut
 	if parent == nil {
 		return errors.New("new parent not found in cache or metadata store")
 	}
+
+	id := inode.ID()
+	isDir := inode.IsDir()
+	dirID := ""
+	if isDir {
+		dirID = id
+	}
+	release := f.fenceMove(oldParent, newParent, dirID)
+	defer release()
+	if current := inode.ParentID(); current != "" && current != oldParent {
+		return errors.New("item was moved concurrently: " + oldName)
+	}
+	oldPath := inode.Path()
+
+	// this is the actual move op
+	// Lock ordering: one parent inode at a time, then the child
+	if oldParent != newParent {
+		if old := f.GetID(oldParent); old != nil {
+			old.mu.Lock()
+			if i := slices.Index(old.children, id); i >= 0 {
+				old.children = slices.Delete(old.children, i, i+1)
+				if isDir && old.subdir > 0 {
+					old.subdir--
+				}
+			}
+			old.mu.Unlock()
+			f.persistMetadataEntry(old.ID(), old)
+		}
+		parent.mu.Lock()
+		if !slices.Contains(parent.children, id) {
+			parent.children = append(parent.children, id)
+			if isDir {
+				parent.subdir++
+			}
+		}
+		parent.mu.Unlock()
+		f.persistMetadataEntry(parent.ID(), parent)
+	}
+	parentPath := parent.Path()
+	inode.mu.Lock()
+	inode.DriveItem.Name = newName
+	if inode.DriveItem.Parent == nil {
+		inode.DriveItem.Parent = &graph.DriveItemParent{}
+	}
 	inode.DriveItem.Parent.ID = parent.DriveItem.ID
-	f.InsertID(id, inode)
+	inode.DriveItem.Parent.Path = parentPath
+	inode.mu.Unlock()
+	f.persistMetadataEntry(id, inode)
+	if isDir {
+		f.repathChildren(inode)
+	}
+
+	f.repathInFlight(oldPath, inode.Path())
 	return nil
 }
 
+// cleanupContentCache removes expired content from the cache as a JobEviction
+// job and returns the number of files removed.
+func (f *Filesystem) cleanupContentCache() (int, error) {
+	days := f.cacheExpiration()
+	if days <= 0 {
+		return 0, nil
+	}
+	var count int
+	err := f.runJob(f.jobContext(), JobEviction, "", func(ctx context.Context, job *Job) error {
+		var err error
+		count, err = f.content.CleanupCache(days)
+		job.AddTotal(uint64(count), 0)
+		job.Advance(uint64(count), 0)
+		return err
+	})
+	return count, err
+}
+
 // StartCacheCleanup starts a background goroutine that periodically cleans up
 // the content cache by removing files that haven't been modified for the specified
-// number of days. The cleanup runs at the configured interval.
+// number of days, and the thumbnail cache (see collectThumbnails). The cleanup
+// runs at the configured interval.
 func (f *Filesystem) StartCacheCleanup() {
 	// Don't start cleanup if expiration days is 0 or negative
-	if f.cacheExpirationDays <= 0 {
+	if f.cacheExpiration() <= 0 {
 		logging.Info().Msg("Cache cleanup disabled (expiration days <= 0)")
 		return
 	}
+	if !f.cacheCleanupStarted.CompareAndSwap(false, true) {
+		return
+	}
 
 	logging.Info().
-		Int("expirationDays", f.cacheExpirationDays).
+		Int("expirationDays", f.cacheExpiration()).
 		Dur("cleanupInterval", f.cacheCleanupInterval).
 		Msg("Starting content cache cleanup routine")
 
@@ -2192,12 +2271,16 @@ func (f *Filesystem) StartCacheCleanup() {
 		defer f.Wg.Done()
 
 		// Run cleanup immediately on startup
-		count, err := f.content.CleanupCache(f.cacheExpirationDays)
+		count, err := f.cleanupContentCache()
 		if err != nil {
 			logging.Error().Err(err).Msg("Error during initial content cache cleanup")
 		} else {
 			logging.Info().Int("removedFiles", count).Msg("Initial content cache cleanup completed")
 		}
+		f.collectSharedContent()
+		if _, err := f.collectThumbnails(); err != nil {
+			logging.Error().Err(err).Msg("Error during thumbnail cache cleanup")
+		}
 
 		// Set up ticker for periodic cleanup using configured interval
 		ticker := time.NewTicker(f.cacheCleanupInterval)
@@ -2207,12 +2290,16 @@ func (f *Filesystem) StartCacheCleanup() {
 			select {
 			case <-ticker.C:
 				// Run cleanup
-				count, err := f.content.CleanupCache(f.cacheExpirationDays)
+				count, err := f.cleanupContentCache()
 				if err != nil {
 					logging.Error().Err(err).Msg("Error during content cache cleanup")
 				} else {
 					logging.Info().Int("removedFiles", count).Msg("Content cache cleanup completed")
 				}
+				f.collectSharedContent()
+				if _, err := f.collectThumbnails(); err != nil {
+					logging.Error().Err(err).Msg("Error during thumbnail cache cleanup")
+				}
 			case <-f.cacheCleanupStop:
 				// Stop the cleanup routine
 				logging.Info().Msg("Stopping content cache cleanup routine via stop channel")
@@ -2226,11 +2313,17 @@ func (f *Filesystem) StartCacheCleanup() {
 	}()
 }
 
-// StopCacheCleanup stops the background cache cleanup routine.
+// StopCacheCleanup stops the background cache cleanup routine, after the
+// shutdown stages it depends on, see shutdown.go.
 func (f *Filesystem) StopCacheCleanup() {
+	f.runShutdown(shutdownCacheCleanup)
+}
+
+// stopCacheCleanup stops the background cache cleanup routine.
+func (f *Filesystem) stopCacheCleanup() {
 	logging.Info().Msg("Stopping cache cleanup routine...")
-	// Only send stop signal if expiration days is positive (cleanup is running)
-	if f.cacheExpirationDays > 0 {
+	// Only send stop signal if the cleanup routine was started
+	if f.cacheCleanupStarted.Load() {
 		f.cacheCleanupStopOnce.Do(func() {
 			close(f.cacheCleanupStop)
 		})
@@ -2239,106 +2332,60 @@ func (f *Filesystem) StopCacheCleanup() {
 	}
 }
 
-// StopDeltaLoop stops the delta loop goroutine and waits for it to finish.
+// StopDeltaLoop stops the delta loop and realtime notifications, after the
+// shutdown stages they depend on.
 func (f *Filesystem) StopDeltaLoop() {
+	f.runShutdown(shutdownDelta)
+}
+
+// stopDeltaLoop stops the delta loop goroutine and waits for it to finish.
+func (f *Filesystem) stopDeltaLoop() {
 	logging.Info().Msg("Stopping delta loop...")
 
 	// Cancel the context to interrupt any in-progress network requests
-	f.deltaLoopCancel()
+	if f.deltaLoopCancel != nil {
+		f.deltaLoopCancel()
+	}
 	logging.Debug().Msg("Cancelled delta loop context to interrupt network operations")
 
 	// Close the stop channel to signal the delta loop to stop
 	f.deltaLoopStopOnce.Do(func() {
-		close(f.deltaLoopStop)
+		if f.deltaLoopStop != nil {
+			close(f.deltaLoopStop)
+		}
 	})
 	logging.Debug().Msg("Closed delta loop stop channel")
 
-	// Wait for delta loop to finish with a timeout
-	done := make(chan struct{})
-	go func() {
-		f.deltaLoopWg.Wait()
-		close(done)
-	}()
-
-	// Wait for delta loop to finish or timeout after 10 seconds
-	select {
-	case <-done:
-		logging.Info().Msg("Delta loop stopped successfully")
-	case <-time.After(10 * time.Second):
-		logging.Warn().Msg("Timed out waiting for delta loop to stop - continuing shutdown anyway")
-		// Log additional debug information
-		logging.Debug().Msg("Delta loop may be stuck in a network operation or processing a large batch of changes")
-		logging.Debug().Msg("This is not a critical error, but may indicate a potential issue with network operations")
-	}
+	f.deltaLoopWg.Wait()
+	logging.Info().Msg("Delta loop stopped successfully")
 }
 
-// StopDownloadManager stops the download manager and waits for all workers to finish.
+// StopDownloadManager stops the download manager, after the delta loop and
+// the metadata queue that feed it.
 func (f *Filesystem) StopDownloadManager() {
-	logging.Info().Msg("Stopping download manager...")
-	if f.downloads != nil {
-		// Create a channel to signal when the download manager has stopped
-		done := make(chan struct{})
-
-		// Start a goroutine to call Stop and signal when done
-		go func() {
-			f.downloads.Stop()
-			close(done)
-		}()
-
-		// Wait for download manager to stop or timeout after 5 seconds
-		select {
-		case <-done:
-			logging.Info().Msg("Download manager stopped successfully")
-		case <-time.After(5 * time.Second):
-			logging.Warn().Msg("Timed out waiting for download manager to stop")
-		}
-	}
+	f.runShutdown(shutdownHydration)
 }
 
-// StopUploadManager stops the upload manager and waits for all uploads to finish.
+// StopUploadManager lets active uploads finish and stops the upload manager,
+// after downloads and queued mutations stopped.
 func (f *Filesystem) StopUploadManager() {
-	logging.Info().Msg("Stopping upload manager...")
-	if f.uploads != nil {
-		// Create a channel to signal when the upload manager has stopped
-		done := make(chan struct{})
-
-		// Start a goroutine to call Stop and signal when done
-		go func() {
-			f.uploads.Stop()
-			close(done)
-		}()
-
-		// Wait for upload manager to stop or timeout after 5 seconds
-		select {
-		case <-done:
-			logging.Info().Msg("Upload manager stopped successfully")
-		case <-time.After(5 * time.Second):
-			logging.Warn().Msg("Timed out waiting for upload manager to stop")
-		}
-	}
+	f.runShutdown(shutdownUploads)
 }
 
-// StopMetadataRequestManager stops the metadata request manager and waits for all workers to finish.
+// StopMetadataRequestManager stops the metadata request manager, after the
+// delta loop that feeds it.
 func (f *Filesystem) StopMetadataRequestManager() {
-	logging.Info().Msg("Stopping metadata request manager...")
-	if f.metadataRequestManager != nil {
-		// Create a channel to signal when the metadata request manager has stopped
-		done := make(chan struct{})
-
-		// Start a goroutine to call Stop and signal when done
-		go func() {
-			f.metadataRequestManager.Stop()
-			close(done)
-		}()
+	f.runShutdown(shutdownMetadataQueue)
+}
 
-		// Wait for metadata request manager to stop or timeout after 5 seconds
-		select {
-		case <-done:
-			logging.Info().Msg("Metadata request manager stopped successfully")
-		case <-time.After(5 * time.Second):
-			logging.Warn().Msg("Timed out waiting for metadata request manager to stop")
-		}
+// mountContext returns the context of the mount, which is cancelled when it
+// stops. Background work and the Graph requests it makes derive from it, so
+// they end promptly on unmount.
+func (f *Filesystem) mountContext() context.Context {
+	if f.ctx == nil {
+		return context.Background()
 	}
+	return f.ctx
 }
 
 // Stop stops all background processes and cleans up the filesystem.
@@ -2348,56 +2395,11 @@ func (f *Filesystem) Stop() {
 	// Use a sync.Once to ensure Stop is only called once
 	f.stopOnce.Do(func() {
 		logging.Info().Msg("Stopping filesystem and all background processes...")
-
-		// Cancel the root context to signal all operations to stop
-		if f.cancel != nil {
-			f.cancel()
-		}
-		f.stopMutationQueue()
-
-		// Stop all background processes in the correct order
-		f.StopCacheCleanup()
-		f.StopDeltaLoop()
-		f.stopRealtimeManager()
-		f.StopDownloadManager()
-		f.StopUploadManager()
-		f.StopMetadataRequestManager()
-
-		// Stop the D-Bus server if it exists
-		if f.dbusServer != nil {
-			f.dbusServer.Stop()
-		}
-
-		// Wait for all goroutines to finish with a timeout
-		done := make(chan struct{})
-		go func() {
-			f.Wg.Wait()
-			close(done)
-		}()
-
-		// Get timeout from configuration
-		timeout := 10 * time.Second // Default fallback
-		if f.timeoutConfig != nil {
-			timeout = f.timeoutConfig.FilesystemShutdown
-		}
-
-		// Wait for all goroutines to finish or timeout
-		select {
-		case <-done:
-			logging.Info().Msg("All filesystem goroutines stopped successfully")
-		case <-time.After(timeout):
-			logging.Warn().
-				Dur("timeout", timeout).
-				Msg("Timed out waiting for filesystem goroutines to stop")
-		}
-
-		// Close the database connection
-		if f.db != nil {
-			if err := f.db.Close(); err != nil {
-				logging.Warn().Err(err).Msg("Failed to close database connection")
-			}
+		f.runShutdown(shutdownDatabase)
+		if abandoned := f.shutdown.abandoned(); len(abandoned) > 0 {
+			logging.Warn().Strs("stages", abandoned).Msg("Filesystem stopped without waiting for all of its work")
+			return
 		}
-
 		logging.Info().Msg("Filesystem stopped successfully")
 	})
 }
@@ -2452,8 +2454,13 @@ func (f *Filesystem) SerializeAll() {
 		if v2 == nil {
 			return errors.New("metadata_v2 bucket not initialized")
 		}
+		put := func(k string, blob []byte) error { return v2.Put([]byte(k), blob) }
+		if store, ok := f.metadataStore.(*metadata.BoltStore); ok {
+			// keep the children index current
+			put = func(k string, blob []byte) error { return store.PutTx(tx, k, blob) }
+		}
 		for k, blob := range entries {
-			if err := v2.Put([]byte(k), blob); err != nil {
+			if err := put(k, blob); err != nil {
 				return errors.Wrap(err, fmt.Sprintf("failed to persist metadata_v2 entry %s", k))
 			}
 			if k == f.root {
@@ -0,0 +1,48 @@
+package fs
+
+import "time"
+
+// CachePlan is the outcome of a simulated content cache cleanup under the
+// current expiration and size settings, used to tune them before anything is
+// evicted.
+type CachePlan struct {
+	ExpirationDays int
+	MaxCacheSize   int64
+	CacheSize      int64
+	Files          []CachePlanFile
+	ReclaimedBytes int64
+}
+
+// CachePlanFile is a cached file the cleanup would evict.
+type CachePlanFile struct {
+	ID           string
+	Path         string
+	Size         int64
+	LastAccessed time.Time
+	Reason       string
+}
+
+// PlanCacheCleanup runs the cache cleanup policy in dry-run mode and reports
+// which files it would evict and how much space that would reclaim.
+func (f *Filesystem) PlanCacheCleanup() CachePlan {
+	plan := CachePlan{ExpirationDays: f.cacheExpiration()}
+	if f.content == nil {
+		return plan
+	}
+	plan.MaxCacheSize = f.content.GetMaxCacheSize()
+	plan.CacheSize = f.content.GetCacheSize()
+	for _, candidate := range f.content.PlanCleanup(f.cacheExpiration()) {
+		file := CachePlanFile{
+			ID:           candidate.ID,
+			Size:         candidate.Size,
+			LastAccessed: candidate.LastAccessed,
+			Reason:       candidate.Reason,
+		}
+		if inode := f.GetID(candidate.ID); inode != nil {
+			file.Path = inode.Path()
+		}
+		plan.Files = append(plan.Files, file)
+		plan.ReclaimedBytes += candidate.Size
+	}
+	return plan
+}
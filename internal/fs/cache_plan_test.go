@@ -0,0 +1,42 @@
+package fs
+
+import (
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_CachePlan_MatchesCleanupWithoutEvicting(t *testing.T) {
+	cache := NewLoopbackCacheWithSize(t.TempDir(), 0)
+	now := time.Now()
+	for i, id := range []string{"old", "lru-1", "lru-2", "pinned", "recent"} {
+		require.NoError(t, cache.Insert(id, make([]byte, 100)))
+		cache.entries[id].lastAccessed = now.Add(time.Duration(i) * time.Minute)
+	}
+	expired := now.AddDate(0, 0, -40)
+	require.NoError(t, os.Chtimes(cache.contentPath("old"), expired, expired))
+	cache.maxCacheSize = 250
+	cache.SetEvictionGuard(func(id string) bool { return id != "pinned" })
+
+	plan := cache.PlanCleanup(30)
+	reasons := map[string]string{}
+	for _, candidate := range plan {
+		reasons[candidate.ID] = candidate.Reason
+	}
+	require.Equal(t, map[string]string{"old": CleanupExpired, "lru-1": CleanupSizeLimit, "lru-2": CleanupSizeLimit}, reasons)
+	require.Equal(t, 5, cache.GetCacheEntryCount(), "planning evicts nothing")
+	require.Len(t, cache.PlanCleanup(0), 3, "without expiration the size limit alone picks files")
+
+	_, err := cache.CleanupCache(30)
+	require.NoError(t, err)
+	var kept []string
+	for id := range cache.GetCacheEntrySizes() {
+		kept = append(kept, id)
+	}
+	sort.Strings(kept)
+	require.Equal(t, []string{"pinned", "recent"}, kept, "the cleanup evicts what was planned")
+	require.Empty(t, cache.PlanCleanup(30))
+}
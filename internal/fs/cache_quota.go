@@ -0,0 +1,218 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// A mount with its own cache quota (mounts.<mountpoint>.maxCacheSize) only
+// counts its own content against it. The top-level maxCacheSize is instead
+// shared by the mounts without a quota whose caches are on the same disk:
+// every such cache publishes its size in a ledger in the runtime directory and
+// reads the sizes of the others. A cache only ever evicts its own files. It
+// may grow into the part of the limit the others do not use, but never has to
+// shrink below an equal share, so a huge drive cannot push out the working set
+// of a smaller one.
+
+// cacheLedgerDir is the directory of the ledger in the runtime directory.
+const cacheLedgerDir = "onemount-cache-usage"
+
+// cacheLedgerRefresh is how long the sizes read from the ledger are used
+// before reading them again.
+const cacheLedgerRefresh = 5 * time.Second
+
+// cacheUsageRecord is the entry of one cache in the ledger.
+type cacheUsageRecord struct {
+	PID       int    `json:"pid"`
+	Device    uint64 `json:"device"`
+	Directory string `json:"directory"`
+	Size      int64  `json:"size"`
+}
+
+// cacheUsageLedger accounts the caches sharing a size limit on one disk.
+type cacheUsageLedger struct {
+	dir    string // the ledger, shared by the mounts of the user
+	name   string // file name of this cache's record
+	record cacheUsageRecord
+
+	mu          sync.Mutex
+	others      int64 // size of the other caches sharing the limit
+	sharing     int   // caches sharing the limit, this one included
+	published   int64
+	publishedAt time.Time
+	checked     time.Time
+}
+
+// newCacheUsageLedger returns the ledger entry of the content cache in
+// contentDir, or nil when the disk of the cache cannot be determined.
+func newCacheUsageLedger(ledgerDir, contentDir string) *cacheUsageLedger {
+	var st syscall.Stat_t
+	if err := syscall.Stat(contentDir, &st); err != nil {
+		logging.Warn().Err(err).Str("path", contentDir).Msg("Cannot account the cache size across mounts")
+		return nil
+	}
+	sum := sha256.Sum256([]byte(contentDir))
+	return &cacheUsageLedger{
+		dir:  ledgerDir,
+		name: hex.EncodeToString(sum[:8]) + ".json",
+		record: cacheUsageRecord{
+			PID:       os.Getpid(),
+			Device:    uint64(st.Dev),
+			Directory: contentDir,
+		},
+		published: -1,
+		sharing:   1,
+	}
+}
+
+// allowance returns how much of limit the cache of size own may use.
+func (u *cacheUsageLedger) allowance(limit, own int64) int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if own != u.published || time.Since(u.checked) >= cacheLedgerRefresh {
+		u.publish(own)
+		u.read()
+	}
+	allowance := limit - u.others
+	if share := limit / int64(u.sharing); allowance < share {
+		allowance = share
+	}
+	return allowance
+}
+
+// note publishes a changed size of the cache, at most once per refresh so
+// that writing many small files does not rewrite the ledger for each.
+func (u *cacheUsageLedger) note(size int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if size != u.published && time.Since(u.publishedAt) >= cacheLedgerRefresh {
+		u.publish(size)
+	}
+}
+
+// publish writes the size of this cache to the ledger.
+func (u *cacheUsageLedger) publish(size int64) {
+	if err := os.MkdirAll(u.dir, 0700); err != nil {
+		return
+	}
+	u.record.Size = size
+	data, err := json.Marshal(u.record)
+	if err != nil {
+		return
+	}
+	tmp := filepath.Join(u.dir, "."+u.name)
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, filepath.Join(u.dir, u.name)); err != nil {
+		return
+	}
+	u.published = size
+	u.publishedAt = time.Now()
+}
+
+// read sums up the sizes of the other running caches on the same disk.
+func (u *cacheUsageLedger) read() {
+	u.checked = time.Now()
+	u.others, u.sharing = 0, 1
+	entries, err := os.ReadDir(u.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() == u.name || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(u.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var other cacheUsageRecord
+		if json.Unmarshal(data, &other) != nil || other.Device != u.record.Device {
+			continue
+		}
+		if _, err := os.Stat(other.Directory); !processAlive(other.PID) || os.IsNotExist(err) {
+			// Left behind by a mount that did not stop cleanly, or whose
+			// cache was removed without stopping it
+			_ = os.Remove(filepath.Join(u.dir, entry.Name()))
+			continue
+		}
+		u.others += other.Size
+		u.sharing++
+	}
+}
+
+// remove takes the cache out of the ledger.
+func (u *cacheUsageLedger) remove() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	_ = os.Remove(filepath.Join(u.dir, u.name))
+	u.published = -1
+}
+
+// processAlive reports whether a process with the given PID is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// SetCacheLimit sets the size limit of the cache. A quota is the cache's own;
+// otherwise the limit is shared with the other caches without a quota on the
+// same disk, accounted through the ledger in ledgerDir.
+func (l *LoopbackCache) SetCacheLimit(maxSize int64, quota bool, ledgerDir string) {
+	l.entriesM.Lock()
+	if l.ledger != nil && (quota || maxSize <= 0) {
+		l.ledger.remove()
+		l.ledger = nil
+	}
+	if l.ledger == nil && !quota && maxSize > 0 && ledgerDir != "" {
+		l.ledger = newCacheUsageLedger(ledgerDir, l.directory)
+	}
+	l.entriesM.Unlock()
+	l.SetMaxCacheSize(maxSize)
+}
+
+// leaveLedger stops sharing the size limit, so the other caches may use it
+// all.
+func (l *LoopbackCache) leaveLedger() {
+	l.entriesM.Lock()
+	defer l.entriesM.Unlock()
+	if l.ledger != nil {
+		l.ledger.remove()
+		l.ledger = nil
+	}
+}
+
+// cacheLimitLocked returns the size the cache may currently use, 0 for no
+// limit. The caller holds entriesM.
+func (l *LoopbackCache) cacheLimitLocked() int64 {
+	if l.maxCacheSize <= 0 || l.ledger == nil {
+		return l.maxCacheSize
+	}
+	return l.ledger.allowance(l.maxCacheSize, l.totalSize)
+}
+
+// cacheLimit returns the size the cache may currently use, 0 for no limit.
+func (l *LoopbackCache) cacheLimit() int64 {
+	l.entriesM.Lock()
+	defer l.entriesM.Unlock()
+	return l.cacheLimitLocked()
+}
+
+// DefaultCacheLedgerDir returns the ledger in the runtime directory, shared
+// by the mounts of the user.
+func DefaultCacheLedgerDir() string {
+	return filepath.Join(memoryTempDir(), cacheLedgerDir)
+}
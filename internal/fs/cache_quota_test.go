@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// refreshLedger publishes the size of the cache and reads the others, as the
+// cache does once the refresh interval has passed.
+func refreshLedger(l *LoopbackCache) {
+	l.ledger.publishedAt = time.Time{}
+	l.ledger.checked = time.Time{}
+	l.cacheLimit()
+}
+
+func TestUT_FS_CacheQuota_SharedLimitKeepsEqualShare(t *testing.T) {
+	dir := t.TempDir()
+	ledger := filepath.Join(dir, "ledger")
+	big := NewLoopbackCache(filepath.Join(dir, "big"))
+	small := NewLoopbackCache(filepath.Join(dir, "small"))
+	big.SetCacheLimit(1000, false, ledger)
+	small.SetCacheLimit(1000, false, ledger)
+
+	require.NoError(t, small.Insert("s1", bytes.Repeat([]byte("s"), 300)))
+	refreshLedger(small)
+	for _, id := range []string{"b1", "b2", "b3"} {
+		refreshLedger(big)
+		require.NoError(t, big.Insert(id, bytes.Repeat([]byte("b"), 300)))
+	}
+	require.Equal(t, int64(600), big.GetCacheSize(), "the big drive only uses what the small one leaves")
+	require.Equal(t, int64(300), small.GetCacheSize(), "the big drive never evicts the small one's files")
+	require.True(t, small.HasContent("s1"))
+
+	// The small drive may still grow to its equal share
+	require.NoError(t, small.Insert("s2", bytes.Repeat([]byte("s"), 200)))
+	require.Equal(t, int64(500), small.GetCacheSize())
+
+	// Once the big drive stops, the small one has the whole limit
+	big.leaveLedger()
+	refreshLedger(small)
+	require.Equal(t, int64(1000), small.cacheLimit())
+}
+
+func TestUT_FS_CacheQuota_OwnQuotaIsNotShared(t *testing.T) {
+	dir := t.TempDir()
+	ledger := filepath.Join(dir, "ledger")
+	shared := NewLoopbackCache(filepath.Join(dir, "shared"))
+	shared.SetCacheLimit(1000, false, ledger)
+	require.NoError(t, shared.Insert("a", bytes.Repeat([]byte("a"), 900)))
+
+	quota := NewLoopbackCache(filepath.Join(dir, "quota"))
+	quota.SetCacheLimit(400, true, ledger)
+	require.Nil(t, quota.ledger)
+	require.Equal(t, int64(400), quota.cacheLimit())
+	require.NoError(t, quota.Insert("q1", bytes.Repeat([]byte("q"), 300)))
+	require.NoError(t, quota.Insert("q2", bytes.Repeat([]byte("q"), 300)))
+	require.Equal(t, int64(300), quota.GetCacheSize(), "the quota evicts the mount's own files")
+	require.True(t, quota.HasContent("q2"))
+
+	refreshLedger(shared)
+	require.Equal(t, int64(1000), shared.cacheLimit(), "a mount with its own quota does not count against the shared limit")
+}
+
+func TestUT_FS_CacheQuota_RemovedCacheLeavesTheLedger(t *testing.T) {
+	dir := t.TempDir()
+	ledger := filepath.Join(dir, "ledger")
+	kept := NewLoopbackCache(filepath.Join(dir, "kept"))
+	gone := NewLoopbackCache(filepath.Join(dir, "gone"))
+	kept.SetCacheLimit(1000, false, ledger)
+	gone.SetCacheLimit(1000, false, ledger)
+	require.NoError(t, gone.Insert("g1", bytes.Repeat([]byte("g"), 600)))
+	refreshLedger(gone)
+	refreshLedger(kept)
+	require.Equal(t, int64(500), kept.cacheLimit())
+
+	// Removed without stopping, e.g. by a test cleaning up its directory
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "gone")))
+	refreshLedger(kept)
+	require.Equal(t, int64(1000), kept.cacheLimit())
+	entries, err := os.ReadDir(ledger)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "the record of the removed cache is pruned")
+}
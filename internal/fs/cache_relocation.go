@@ -0,0 +1,272 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Moving a mount's cache directory (the launcher's "Cache Directory" setting)
+// must leave a database that matches the new location. Upload sessions of
+// large files store the absolute path of their content, and content that did
+// not survive the move must not stay marked as downloaded. RelocateCache moves
+// the directory, renaming it when possible and otherwise copying every file
+// and checking its SHA-256 before the original is removed, then fixes the
+// database up. The mount must be stopped.
+
+// CacheRelocationReport describes a cache relocation.
+type CacheRelocationReport struct {
+	Copied       bool     // moved across filesystems by copying
+	Files        int      // content files in the new location
+	Bytes        int64    // size of those content files
+	UploadPaths  int      // upload sessions whose content path was rewritten
+	Dehydrated   int      // downloaded files whose content was missing, now online-only
+	LostChanges  []string // IDs of local changes whose content was missing
+	DatabaseSeen bool     // whether the directory held a metadata database
+}
+
+// ErrCacheDestinationNotEmpty is returned when relocating a cache into a
+// directory that already holds files.
+var ErrCacheDestinationNotEmpty = errors.New("the new cache directory is not empty")
+
+// RelocateCache moves the cache directory of a stopped mount from oldDir to
+// newDir and updates its metadata database for the new location.
+func RelocateCache(oldDir, newDir string) (*CacheRelocationReport, error) {
+	oldDir, newDir = filepath.Clean(oldDir), filepath.Clean(newDir)
+	report := &CacheRelocationReport{}
+	if oldDir == newDir {
+		return report, nil
+	}
+	if entries, err := os.ReadDir(newDir); err == nil && len(entries) > 0 {
+		return nil, ErrCacheDestinationNotEmpty
+	}
+	if err := os.MkdirAll(filepath.Dir(newDir), 0700); err != nil {
+		return nil, errors.Wrap(err, "create parent of new cache directory")
+	}
+	// An empty destination, such as one picked in a file chooser, is replaced
+	_ = os.Remove(newDir)
+
+	if err := os.Rename(oldDir, newDir); err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return nil, errors.Wrap(err, "move cache directory")
+		}
+		if err := copyCacheTree(oldDir, newDir); err != nil {
+			_ = os.RemoveAll(newDir)
+			return nil, errors.Wrap(err, "copy cache directory")
+		}
+		if err := os.RemoveAll(oldDir); err != nil {
+			logging.Warn().Err(err).Str("path", oldDir).Msg("Could not remove the old cache directory after copying it")
+		}
+		report.Copied = true
+	}
+
+	dbPath := filepath.Join(newDir, "onemount.db")
+	if _, err := os.Stat(dbPath); err == nil {
+		report.DatabaseSeen = true
+		db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return report, errors.Wrap(err, "open metadata db")
+		}
+		defer db.Close()
+		if err := fixupRelocatedCache(db, oldDir, newDir, report); err != nil {
+			return report, err
+		}
+	}
+
+	if err := countContentFiles(filepath.Join(newDir, "content"), report); err != nil {
+		return report, err
+	}
+	logging.Info().
+		Str("from", oldDir).
+		Str("to", newDir).
+		Bool("copied", report.Copied).
+		Int("files", report.Files).
+		Int64("bytes", report.Bytes).
+		Int("uploadPaths", report.UploadPaths).
+		Int("dehydrated", report.Dehydrated).
+		Int("lostChanges", len(report.LostChanges)).
+		Msg("Relocated cache directory")
+	return report, nil
+}
+
+// fixupRelocatedCache rewrites the upload content paths under oldDir to
+// newDir and marks downloaded items whose content is missing as online-only.
+func fixupRelocatedCache(db *bolt.DB, oldDir, newDir string, report *CacheRelocationReport) error {
+	contentDir := filepath.Join(newDir, "content")
+	oldPrefix := oldDir + string(filepath.Separator)
+	now := time.Now().UTC()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if uploads := tx.Bucket(bucketUploads); uploads != nil {
+			rewritten := map[string][]byte{}
+			err := uploads.ForEach(func(k, v []byte) error {
+				var fields map[string]json.RawMessage
+				if err := json.Unmarshal(v, &fields); err != nil {
+					return nil
+				}
+				var path string
+				if raw, ok := fields["contentPath"]; !ok || json.Unmarshal(raw, &path) != nil ||
+					!strings.HasPrefix(path, oldPrefix) {
+					return nil
+				}
+				fields["contentPath"], _ = json.Marshal(filepath.Join(newDir, strings.TrimPrefix(path, oldPrefix)))
+				updated, err := json.Marshal(fields)
+				if err != nil {
+					return err
+				}
+				rewritten[string(k)] = updated
+				return nil
+			})
+			if err != nil {
+				return errors.Wrap(err, "rewrite upload sessions")
+			}
+			for k, v := range rewritten {
+				if err := uploads.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+			report.UploadPaths = len(rewritten)
+		}
+
+		v2 := tx.Bucket(bucketMetadataV2)
+		if v2 == nil {
+			return nil
+		}
+		updated := map[string]*metadata.Entry{}
+		err := v2.ForEach(func(k, v []byte) error {
+			var entry metadata.Entry
+			if err := json.Unmarshal(v, &entry); err != nil || entry.ItemType != metadata.ItemKindFile || entry.Virtual {
+				return nil
+			}
+			if entry.State != metadata.ItemStateHydrated && entry.State != metadata.ItemStateDirtyLocal {
+				return nil
+			}
+			if _, err := os.Stat(filepath.Join(contentDir, entry.ID)); !os.IsNotExist(err) {
+				return nil
+			}
+			if entry.State == metadata.ItemStateDirtyLocal {
+				report.LostChanges = append(report.LostChanges, entry.ID)
+				return nil
+			}
+			entry.State = metadata.ItemStateGhost
+			entry.LastHydrated = nil
+			entry.UpdatedAt = now
+			updated[string(k)] = &entry
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "revalidate cached content")
+		}
+		for k, entry := range updated {
+			if err := entry.Validate(); err != nil {
+				return err
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := v2.Put([]byte(k), data); err != nil {
+				return err
+			}
+		}
+		report.Dehydrated = len(updated)
+		return nil
+	})
+}
+
+// countContentFiles adds the number and size of the content files to the
+// report.
+func countContentFiles(contentDir string, report *CacheRelocationReport) error {
+	entries, err := os.ReadDir(contentDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "read content directory")
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		report.Files++
+		report.Bytes += info.Size()
+	}
+	return nil
+}
+
+// copyCacheTree copies the directory tree at src to dst, verifying the
+// SHA-256 of every copied file.
+func copyCacheTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode().IsRegular():
+			return copyVerifiedFile(path, target, info.Mode().Perm())
+		default:
+			// Sockets and links are recreated by the mount
+			return nil
+		}
+	})
+}
+
+// copyVerifiedFile copies src to dst and reads dst back to compare its
+// SHA-256 with the one of the data read from src.
+func copyVerifiedFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	want := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, want), in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	written, err := os.Open(dst)
+	if err != nil {
+		return err
+	}
+	defer written.Close()
+	got := sha256.New()
+	if _, err := io.Copy(got, written); err != nil {
+		return err
+	}
+	if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+		return fmt.Errorf("%s: copy does not match the original", src)
+	}
+	return nil
+}
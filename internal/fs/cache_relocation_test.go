@@ -0,0 +1,131 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// newRelocationCache builds a stopped mount's cache directory with a
+// downloaded file, a downloaded file whose content is gone, a local change
+// whose content is gone and a large upload session.
+func newRelocationCache(t *testing.T, dir string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "content"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "content", "kept"), []byte("hello"), 0600))
+
+	db, err := bolt.Open(filepath.Join(dir, "onemount.db"), 0600, &bolt.Options{Timeout: time.Second})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketMetadataV2)
+		return err
+	}))
+	store, err := metadata.NewBoltStore(db, bucketMetadataV2)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	for id, state := range map[string]metadata.ItemState{
+		"kept":   metadata.ItemStateHydrated,
+		"gone":   metadata.ItemStateHydrated,
+		"edited": metadata.ItemStateDirtyLocal,
+	} {
+		require.NoError(t, store.Save(context.Background(), &metadata.Entry{
+			ID:            id,
+			Name:          id + ".txt",
+			ParentID:      "root",
+			ItemType:      metadata.ItemKindFile,
+			State:         state,
+			OverlayPolicy: metadata.OverlayPolicyRemoteWins,
+			LastHydrated:  &now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}))
+	}
+
+	session, err := json.Marshal(map[string]any{
+		"id":          "big",
+		"name":        "big.iso",
+		"contentPath": filepath.Join(dir, "content", "big"),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketUploads)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("big"), session)
+	}))
+}
+
+func TestUT_FS_CacheRelocation_FixesDatabaseForNewLocation(t *testing.T) {
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old", "mnt")
+	newDir := filepath.Join(root, "new", "mnt")
+	newRelocationCache(t, oldDir)
+
+	report, err := RelocateCache(oldDir, newDir)
+	require.NoError(t, err)
+	require.True(t, report.DatabaseSeen)
+	require.NoDirExists(t, oldDir)
+	require.Equal(t, 1, report.Files)
+	require.Equal(t, int64(5), report.Bytes)
+	require.Equal(t, 1, report.UploadPaths)
+	require.Equal(t, 1, report.Dehydrated)
+	require.Equal(t, []string{"edited"}, report.LostChanges)
+
+	db, err := bolt.Open(filepath.Join(newDir, "onemount.db"), 0600, &bolt.Options{Timeout: time.Second})
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := metadata.NewBoltStore(db, bucketMetadataV2)
+	require.NoError(t, err)
+	for id, state := range map[string]metadata.ItemState{
+		"kept":   metadata.ItemStateHydrated,
+		"gone":   metadata.ItemStateGhost,
+		"edited": metadata.ItemStateDirtyLocal,
+	} {
+		entry, err := store.Get(context.Background(), id)
+		require.NoError(t, err)
+		require.Equal(t, state, entry.State, id)
+	}
+
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		var session map[string]any
+		require.NoError(t, json.Unmarshal(tx.Bucket(bucketUploads).Get([]byte("big")), &session))
+		require.Equal(t, filepath.Join(newDir, "content", "big"), session["contentPath"])
+		require.Equal(t, "big.iso", session["name"], "other fields are kept")
+		return nil
+	}))
+}
+
+func TestUT_FS_CacheRelocation_RefusesNonEmptyDestination(t *testing.T) {
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "old")
+	newDir := filepath.Join(root, "new")
+	newRelocationCache(t, oldDir)
+	require.NoError(t, os.MkdirAll(newDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(newDir, "other"), nil, 0600))
+
+	_, err := RelocateCache(oldDir, newDir)
+	require.ErrorIs(t, err, ErrCacheDestinationNotEmpty)
+	require.FileExists(t, filepath.Join(oldDir, "onemount.db"), "the cache is left in place")
+}
+
+func TestUT_FS_CacheRelocation_CopyVerifiesContent(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	dst := filepath.Join(root, "dst")
+	newRelocationCache(t, src)
+
+	require.NoError(t, copyCacheTree(src, dst))
+	data, err := os.ReadFile(filepath.Join(dst, "content", "kept"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	require.FileExists(t, filepath.Join(dst, "onemount.db"))
+}
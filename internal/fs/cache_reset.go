@@ -0,0 +1,250 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/fs/offline"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Resetting a mount's cache ("onemount reset") makes it start over from
+// OneDrive without touching the other mounts sharing the cache root or the
+// saved sign-in, unlike --wipe-cache. Local changes that are not uploaded yet
+// would be lost, so ResetCache refuses while any remain unless forced. The
+// cache is soft-deleted: it is moved to ResetDirName in the cache root,
+// replacing the mount's previous reset, and can be recovered by hand until
+// then. The mount must be stopped.
+
+// ResetDirName is the directory in the cache root holding the caches set
+// aside by ResetCache.
+const ResetDirName = ".reset"
+
+// UnsyncedChange is a local change that resetting a cache would lose.
+type UnsyncedChange struct {
+	ID     string
+	Path   string // path in the drive, or the name when its folder is unknown
+	Reason string
+}
+
+// ErrUnsyncedChanges is returned by ResetCache when the cache holds local
+// changes that are not uploaded yet.
+var ErrUnsyncedChanges = errors.New("the cache holds local changes that are not uploaded yet")
+
+// CacheResetReport describes a cache reset.
+type CacheResetReport struct {
+	Unsynced []UnsyncedChange // local changes lost, or that prevented the reset
+	Trash    string           // where the old cache was moved
+}
+
+// ResetCache soft-deletes the cache directory dir of a stopped mount, whose
+// cache root is root, keeping its saved sign-in. Unless force is set, it
+// fails with ErrUnsyncedChanges when local changes would be lost, and fails
+// when the metadata snapshot of an in-memory database cannot be read.
+func ResetCache(root, dir string, force bool) (*CacheResetReport, error) {
+	root, dir = filepath.Clean(root), filepath.Clean(dir)
+	report := &CacheResetReport{}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return report, nil
+	}
+
+	unsynced, err := UnsyncedChanges(dir)
+	switch {
+	case errors.Is(err, errUnreadableSnapshot) && force:
+		logging.Warn().Err(err).Str("cacheDir", dir).
+			Msg("Resetting cache without knowing which local changes are lost")
+	case errors.Is(err, errUnreadableSnapshot):
+		return nil, errors.Wrap(err, "cannot tell which local changes would be lost, force the reset to lose them")
+	case err != nil:
+		return nil, err
+	}
+	report.Unsynced = unsynced
+	if len(unsynced) > 0 && !force {
+		return report, ErrUnsyncedChanges
+	}
+
+	trashRoot := filepath.Join(root, ResetDirName)
+	if err := os.MkdirAll(trashRoot, 0700); err != nil {
+		return nil, errors.Wrap(err, "create reset directory")
+	}
+	trash := filepath.Join(trashRoot, filepath.Base(dir))
+	if err := os.RemoveAll(trash); err != nil {
+		return nil, errors.Wrap(err, "remove the previous reset")
+	}
+	if err := os.Rename(dir, trash); err != nil {
+		return nil, errors.Wrap(err, "move cache directory")
+	}
+	report.Trash = trash
+
+	tokens := filepath.Join(trash, graph.AuthTokensFileName)
+	if _, err := os.Stat(tokens); err == nil {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return report, errors.Wrap(err, "recreate cache directory")
+		}
+		if err := os.Rename(tokens, filepath.Join(dir, graph.AuthTokensFileName)); err != nil {
+			return report, errors.Wrap(err, "keep sign-in")
+		}
+	}
+	logging.Info().
+		Str("cacheDir", dir).
+		Str("trash", trash).
+		Int("lostChanges", len(unsynced)).
+		Msg("Reset cache directory")
+	return report, nil
+}
+
+// UnsyncedChanges lists the local changes recorded in the cache directory
+// dir of a stopped mount that are not uploaded yet, sorted by path. A cache
+// whose database was kept in memory is read from its metadata snapshot.
+func UnsyncedChanges(dir string) ([]UnsyncedChange, error) {
+	dbPath := filepath.Join(dir, "onemount.db")
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return snapshotUnsyncedChanges(dir)
+	}
+	return dbUnsyncedChanges(dbPath)
+}
+
+// snapshotUnsyncedChanges lists the unsynced changes in the metadata snapshot
+// of dir by loading it into a temporary database. A snapshot that cannot be
+// read fails the check rather than passing for a clean cache.
+func snapshotUnsyncedChanges(dir string) ([]UnsyncedChange, error) {
+	buckets, err := readMetadataSnapshot(filepath.Join(dir, MetadataSnapshotName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "onemount-reset-")
+	if err != nil {
+		return nil, errors.Wrap(err, "create temporary metadata directory")
+	}
+	defer os.RemoveAll(tmp)
+	dbPath := filepath.Join(tmp, "onemount.db")
+	if err := loadMetadataSnapshot(dbPath, buckets); err != nil {
+		return nil, errors.Wrap(err, "load metadata snapshot")
+	}
+	return dbUnsyncedChanges(dbPath)
+}
+
+// dbUnsyncedChanges lists the unsynced changes in the database at dbPath.
+func dbUnsyncedChanges(dbPath string) ([]UnsyncedChange, error) {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("the metadata database is in use, stop the mount first")
+		}
+		return nil, errors.Wrap(err, "open metadata db")
+	}
+	defer db.Close()
+
+	entries := map[string]*metadata.Entry{}
+	changes := map[string]*UnsyncedChange{}
+	add := func(id, reason string) {
+		if _, ok := changes[id]; !ok {
+			changes[id] = &UnsyncedChange{ID: id, Reason: reason}
+		}
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		if v2 := tx.Bucket(bucketMetadataV2); v2 != nil {
+			if err := v2.ForEach(func(_, v []byte) error {
+				var entry metadata.Entry
+				if err := json.Unmarshal(v, &entry); err != nil {
+					return nil
+				}
+				entries[entry.ID] = &entry
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		if uploads := tx.Bucket(bucketUploads); uploads != nil {
+			return uploads.ForEach(func(k, _ []byte) error {
+				add(string(k), "upload not finished")
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "read metadata db")
+	}
+
+	for id, entry := range entries {
+		if entry.State != metadata.ItemStateDirtyLocal {
+			continue
+		}
+		switch {
+		case entry.Upload.DeferredReason != "":
+			add(id, "upload deferred: "+entry.Upload.DeferredReason)
+		case isLocalID(id):
+			add(id, "created locally")
+		default:
+			add(id, "modified locally")
+		}
+	}
+
+	journal, err := offline.NewJournal(db, bucketOfflineChanges)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := journal.List(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "read offline changes")
+	}
+	for _, change := range pending {
+		if change.CurrentState() == offline.StateConfirmed {
+			continue
+		}
+		add(change.ID, "offline "+change.Type)
+		if change.Path != "" && changes[change.ID].Path == "" {
+			changes[change.ID].Path = change.Path
+		}
+	}
+
+	unsynced := make([]UnsyncedChange, 0, len(changes))
+	for id, change := range changes {
+		if change.Path == "" {
+			change.Path = entryPath(entries, id)
+		}
+		unsynced = append(unsynced, *change)
+	}
+	sort.Slice(unsynced, func(i, j int) bool {
+		if unsynced[i].Path != unsynced[j].Path {
+			return unsynced[i].Path < unsynced[j].Path
+		}
+		return unsynced[i].ID < unsynced[j].ID
+	})
+	return unsynced, nil
+}
+
+// entryPath builds the path of id from the names of its ancestors in entries.
+func entryPath(entries map[string]*metadata.Entry, id string) string {
+	var names []string
+	for depth := 0; depth < 256; depth++ {
+		entry, ok := entries[id]
+		if !ok {
+			break
+		}
+		if entry.ParentID == "" {
+			// the root
+			return "/" + path.Join(names...)
+		}
+		names = append([]string{entry.Name}, names...)
+		id = entry.ParentID
+	}
+	if len(names) == 0 {
+		return id
+	}
+	return path.Join(names...)
+}
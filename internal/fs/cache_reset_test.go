@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/fs/offline"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestUT_FS_CacheReset_RefusesUnsyncedChangesUnlessForced(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "home-user-OneDrive")
+	newRelocationCache(t, dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, graph.AuthTokensFileName), []byte("{}"), 0600))
+
+	db, err := bolt.Open(filepath.Join(dir, "onemount.db"), 0600, &bolt.Options{Timeout: time.Second})
+	require.NoError(t, err)
+	journal, err := offline.NewJournal(db, bucketOfflineChanges)
+	require.NoError(t, err)
+	require.NoError(t, journal.Record(&offline.Change{ID: "removed", Type: "delete", Path: "/old.txt", Timestamp: time.Now()}))
+	require.NoError(t, journal.Record(&offline.Change{ID: "done", Type: "modify", Path: "/done.txt", Timestamp: time.Now(),
+		State: offline.StateConfirmed}))
+	require.NoError(t, db.Close())
+
+	report, err := ResetCache(root, dir, false)
+	require.ErrorIs(t, err, ErrUnsyncedChanges)
+	require.Equal(t, []UnsyncedChange{
+		{ID: "removed", Path: "/old.txt", Reason: "offline delete"},
+		{ID: "big", Path: "big", Reason: "upload not finished"},
+		{ID: "edited", Path: "edited.txt", Reason: "modified locally"},
+	}, report.Unsynced)
+	require.FileExists(t, filepath.Join(dir, "onemount.db"), "nothing is removed without --force")
+
+	report, err = ResetCache(root, dir, true)
+	require.NoError(t, err)
+	require.Len(t, report.Unsynced, 3)
+	require.Equal(t, filepath.Join(root, ResetDirName, "home-user-OneDrive"), report.Trash)
+	require.FileExists(t, filepath.Join(report.Trash, "onemount.db"))
+	require.NoFileExists(t, filepath.Join(dir, "onemount.db"))
+	require.FileExists(t, filepath.Join(dir, graph.AuthTokensFileName), "the sign-in is kept")
+}
+
+func TestUT_FS_CacheReset_KeepsOtherMounts(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "home-user-OneDrive")
+	other := filepath.Join(root, "home-user-Work")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "content"), 0700))
+	require.NoError(t, os.MkdirAll(other, 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ResetDirName, "home-user-OneDrive", "stale"), 0700))
+
+	report, err := ResetCache(root, dir, false)
+	require.NoError(t, err)
+	require.Empty(t, report.Unsynced)
+	require.DirExists(t, other)
+	require.NoDirExists(t, dir, "without a sign-in there is nothing to keep")
+	require.DirExists(t, filepath.Join(report.Trash, "content"))
+	require.NoDirExists(t, filepath.Join(report.Trash, "stale"), "the previous reset is replaced")
+}
+
+func TestUT_FS_CacheReset_ReadsMetadataSnapshot(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "home-user-OneDrive")
+	newRelocationCache(t, dir)
+
+	// A cache on a network filesystem only keeps the snapshot of its database.
+	dbPath := filepath.Join(dir, "onemount.db")
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	require.NoError(t, err)
+	snapshot := &metadataSnapshot{path: filepath.Join(dir, MetadataSnapshotName)}
+	require.NoError(t, snapshot.save(db))
+	require.NoError(t, db.Close())
+	require.NoError(t, os.Remove(dbPath))
+
+	report, err := ResetCache(root, dir, false)
+	require.ErrorIs(t, err, ErrUnsyncedChanges)
+	require.Equal(t, []UnsyncedChange{
+		{ID: "big", Path: "big", Reason: "upload not finished"},
+		{ID: "edited", Path: "edited.txt", Reason: "modified locally"},
+	}, report.Unsynced)
+	require.FileExists(t, snapshot.path, "nothing is removed without --force")
+
+	require.NoError(t, os.WriteFile(snapshot.path, []byte("{not json"), 0600))
+	_, err = ResetCache(root, dir, false)
+	require.ErrorIs(t, err, errUnreadableSnapshot, "an unreadable snapshot is not a clean cache")
+	require.FileExists(t, snapshot.path)
+
+	report, err = ResetCache(root, dir, true)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(report.Trash, MetadataSnapshotName))
+}
@@ -0,0 +1,33 @@
+package fs
+
+import (
+	"github.com/auriora/onemount/internal/graph"
+)
+
+// Capabilities returns the Graph features detected for the mounted account.
+// Until detection has run (or when mounting offline) the defaults for an
+// unknown drive type are returned.
+func (f *Filesystem) Capabilities() graph.Capabilities {
+	f.capabilitiesM.RLock()
+	defer f.capabilitiesM.RUnlock()
+	if f.capabilities.HashTypes == nil {
+		return graph.DefaultCapabilities(f.capabilities.DriveType)
+	}
+	return f.capabilities
+}
+
+func (f *Filesystem) setCapabilities(caps graph.Capabilities) {
+	f.capabilitiesM.Lock()
+	f.capabilities = caps
+	f.capabilitiesM.Unlock()
+}
+
+// initialDeltaLink is the delta link used when none has been stored. Accounts
+// that support token=latest skip enumerating the drive, since the tree is
+// fetched on demand anyway.
+func (f *Filesystem) initialDeltaLink() string {
+	if f.Capabilities().DeltaLatestToken {
+		return defaultDeltaLink
+	}
+	return fullDeltaLink
+}
@@ -0,0 +1,256 @@
+package fs
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/godbus/dbus/v5"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Large files are uploaded through upload sessions and downloaded with ranged
+// requests, one chunk per request. Small chunks waste fast links on round
+// trips; large chunks lose more work whenever a request fails on a flaky one.
+// The chunk tuner times every chunk, keeps a moving average of the throughput
+// and sizes the next chunk to take about chunkTargetDuration at that rate,
+// between minTransferChunk and maxTransferChunk and in multiples of the 320
+// KiB upload sessions require. A chunk grows to at most twice the previous
+// size, and a failed chunk halves it. Uploads and downloads are tuned
+// separately, and what was learned is kept per network (NetworkManager's
+// primary connection) in the chunk_profiles bucket, so the next mount on the
+// same network starts from it.
+
+var bucketChunkProfiles = []byte("chunk_profiles")
+
+const (
+	minTransferChunk     uint64 = 5 * 1024 * 1024  // 16 x 320 KiB
+	maxTransferChunk     uint64 = 191 * 320 * 1024 // upload session ranges must stay under 60 MiB
+	transferChunkAlign   uint64 = 320 * 1024
+	defaultTransferChunk uint64 = 10 * 1024 * 1024 // what uploads used before tuning
+	chunkTargetDuration         = 10 * time.Second
+	chunkAverageWeight          = 0.3 // weight of the newest chunk in the moving averages
+	chunkNetworkRecheck         = time.Minute
+	defaultChunkNetwork         = "default"
+)
+
+// Transfer directions tuned separately.
+const (
+	chunkUpload   = "upload"
+	chunkDownload = "download"
+)
+
+// ChunkStats is what the chunk tuner learned about one transfer direction.
+type ChunkStats struct {
+	ChunkSize  uint64        `json:"chunkSize"`  // size of the next chunk
+	Throughput float64       `json:"throughput"` // moving average, bytes per second
+	ChunkTime  time.Duration `json:"chunkTime"`  // moving average time per chunk
+	Chunks     uint64        `json:"chunks"`
+	Failures   uint64        `json:"failures"`
+}
+
+// ChunkProfile is what the chunk tuner learned about a network.
+type ChunkProfile struct {
+	Network   string     `json:"network"`
+	Upload    ChunkStats `json:"upload"`
+	Download  ChunkStats `json:"download"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// chunkTuner holds the profile of the current network. The zero value is
+// ready to use.
+type chunkTuner struct {
+	mu      sync.Mutex
+	network func() string // identifies the network; networkManagerConnection when nil
+	checked time.Time     // when the network was last identified
+	profile *ChunkProfile
+}
+
+// networkManagerConnection returns the name of NetworkManager's primary
+// connection, or defaultChunkNetwork when it cannot be read.
+func networkManagerConnection() string {
+	conn, err := dbus.SystemBus()
+	if err != nil || conn == nil {
+		return defaultChunkNetwork
+	}
+	v, err := conn.Object(nmBusName, nmObjectPath).GetProperty(nmBusName + ".PrimaryConnection")
+	if err != nil {
+		return defaultChunkNetwork
+	}
+	path, ok := v.Value().(dbus.ObjectPath)
+	if !ok || path == "/" {
+		return defaultChunkNetwork
+	}
+	id, err := conn.Object(nmBusName, path).GetProperty(nmBusName + ".Connection.Active.Id")
+	if err != nil {
+		return defaultChunkNetwork
+	}
+	if name, ok := id.Value().(string); ok && name != "" {
+		return name
+	}
+	return defaultChunkNetwork
+}
+
+// chunkProfileLocked returns the profile of the current network, loading it
+// when the network changed. Callers hold t.mu.
+func (f *Filesystem) chunkProfileLocked(now time.Time) *ChunkProfile {
+	t := &f.chunkTuner
+	if t.profile != nil && now.Sub(t.checked) < chunkNetworkRecheck {
+		return t.profile
+	}
+	identify := t.network
+	if identify == nil {
+		identify = networkManagerConnection
+	}
+	network := identify()
+	t.checked = now
+	if t.profile != nil && t.profile.Network == network {
+		return t.profile
+	}
+	t.profile = f.loadChunkProfile(network)
+	return t.profile
+}
+
+func (f *Filesystem) loadChunkProfile(network string) *ChunkProfile {
+	profile := &ChunkProfile{Network: network}
+	if f.db != nil {
+		_ = f.db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket(bucketChunkProfiles)
+			if b == nil {
+				return nil
+			}
+			if data := b.Get([]byte(network)); data != nil {
+				if err := json.Unmarshal(data, profile); err != nil {
+					logging.Debug().Err(err).Str("network", network).Msg("Discarding unreadable chunk profile")
+					*profile = ChunkProfile{Network: network}
+				}
+			}
+			return nil
+		})
+	}
+	for _, stats := range []*ChunkStats{&profile.Upload, &profile.Download} {
+		if stats.ChunkSize == 0 {
+			stats.ChunkSize = defaultTransferChunk
+		}
+		stats.ChunkSize = clampTransferChunk(stats.ChunkSize)
+	}
+	return profile
+}
+
+func (f *Filesystem) persistChunkProfile(profile ChunkProfile) {
+	if f.db == nil {
+		return
+	}
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return
+	}
+	err = f.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketChunkProfiles)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(profile.Network), data)
+	})
+	if err != nil {
+		logging.Debug().Err(err).Str("network", profile.Network).Msg("Failed to persist chunk profile")
+	}
+}
+
+// clampTransferChunk keeps size within the chunk limits, in multiples of
+// transferChunkAlign.
+func clampTransferChunk(size uint64) uint64 {
+	size -= size % transferChunkAlign
+	if size < minTransferChunk {
+		return minTransferChunk
+	}
+	if size > maxTransferChunk {
+		return maxTransferChunk
+	}
+	return size
+}
+
+// observeChunk updates the chunk size of a direction after a chunk of size
+// bytes took elapsed, or failed.
+func (s *ChunkStats) observeChunk(size uint64, elapsed time.Duration, err error) {
+	if err != nil {
+		s.Failures++
+		s.ChunkSize = clampTransferChunk(s.ChunkSize / 2)
+		return
+	}
+	if size < minTransferChunk || elapsed <= 0 {
+		// The short last chunk of a transfer mostly measures latency.
+		return
+	}
+	s.Chunks++
+	throughput := float64(size) / elapsed.Seconds()
+	if s.Throughput == 0 {
+		s.Throughput = throughput
+		s.ChunkTime = elapsed
+	} else {
+		s.Throughput += chunkAverageWeight * (throughput - s.Throughput)
+		s.ChunkTime += time.Duration(chunkAverageWeight * float64(elapsed-s.ChunkTime))
+	}
+	target := uint64(s.Throughput * chunkTargetDuration.Seconds())
+	if target > 2*s.ChunkSize {
+		target = 2 * s.ChunkSize
+	}
+	s.ChunkSize = clampTransferChunk(target)
+}
+
+// chunkSizer tunes the chunks of one transfer direction.
+type chunkSizer struct {
+	f         *Filesystem
+	direction string
+}
+
+// transferChunks returns the ChunkSizer for uploads or downloads.
+func (f *Filesystem) transferChunks(direction string) graph.ChunkSizer {
+	return chunkSizer{f: f, direction: direction}
+}
+
+func (c chunkSizer) stats(profile *ChunkProfile) *ChunkStats {
+	if c.direction == chunkUpload {
+		return &profile.Upload
+	}
+	return &profile.Download
+}
+
+// NextChunkSize returns the chunk size for the current network.
+func (c chunkSizer) NextChunkSize() uint64 {
+	t := &c.f.chunkTuner
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return c.stats(c.f.chunkProfileLocked(time.Now())).ChunkSize
+}
+
+// ObserveChunk learns from a chunk of size bytes that took elapsed.
+func (c chunkSizer) ObserveChunk(size uint64, elapsed time.Duration, err error) {
+	t := &c.f.chunkTuner
+	t.mu.Lock()
+	now := time.Now()
+	profile := c.f.chunkProfileLocked(now)
+	stats := c.stats(profile)
+	previous := stats.ChunkSize
+	stats.observeChunk(size, elapsed, err)
+	next := stats.ChunkSize
+	profile.UpdatedAt = now
+	snapshot := *profile
+	t.mu.Unlock()
+
+	if next != previous {
+		logging.Debug().Str("direction", c.direction).Str("network", snapshot.Network).
+			Uint64("from", previous).Uint64("to", next).Msg("Adjusted transfer chunk size")
+	}
+	c.f.persistChunkProfile(snapshot)
+}
+
+// ChunkProfile returns what the chunk tuner learned about the current
+// network.
+func (f *Filesystem) ChunkProfile() ChunkProfile {
+	f.chunkTuner.mu.Lock()
+	defer f.chunkTuner.mu.Unlock()
+	return *f.chunkProfileLocked(time.Now())
+}
@@ -0,0 +1,100 @@
+package fs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const mib = 1024 * 1024
+
+func TestUT_FS_ChunkTuning_FastLinkGrowsChunks(t *testing.T) {
+	stats := ChunkStats{ChunkSize: defaultTransferChunk}
+
+	// 10 MiB in a second: the 10 second target allows 100 MiB, but a chunk
+	// grows to at most twice the previous one.
+	stats.observeChunk(10*mib, time.Second, nil)
+	require.Equal(t, uint64(20*mib), stats.ChunkSize)
+
+	for i := 0; i < 5; i++ {
+		stats.observeChunk(stats.ChunkSize, time.Second, nil)
+	}
+	require.Equal(t, maxTransferChunk, stats.ChunkSize)
+	require.Equal(t, uint64(6), stats.Chunks)
+}
+
+func TestUT_FS_ChunkTuning_SlowLinkShrinksChunks(t *testing.T) {
+	stats := ChunkStats{ChunkSize: defaultTransferChunk}
+
+	// 10 MiB in 40 seconds is 256 KiB/s, 2.5 MiB per 10 seconds.
+	stats.observeChunk(10*mib, 40*time.Second, nil)
+	require.Equal(t, minTransferChunk, stats.ChunkSize)
+
+	stats = ChunkStats{ChunkSize: 40 * mib}
+	stats.observeChunk(40*mib, 25*time.Second, nil)
+	require.Equal(t, uint64(0), stats.ChunkSize%transferChunkAlign)
+	require.Less(t, stats.ChunkSize, uint64(40*mib))
+	require.GreaterOrEqual(t, stats.ChunkSize, uint64(15*mib))
+}
+
+func TestUT_FS_ChunkTuning_FailureHalvesChunks(t *testing.T) {
+	stats := ChunkStats{ChunkSize: 40 * mib}
+
+	stats.observeChunk(40*mib, time.Second, errors.New("connection reset"))
+	require.Equal(t, uint64(20*mib), stats.ChunkSize)
+	require.Equal(t, uint64(1), stats.Failures)
+
+	stats.observeChunk(20*mib, time.Second, errors.New("connection reset"))
+	stats.observeChunk(10*mib, time.Second, errors.New("connection reset"))
+	require.Equal(t, minTransferChunk, stats.ChunkSize)
+}
+
+func TestUT_FS_ChunkTuning_IgnoresShortLastChunk(t *testing.T) {
+	stats := ChunkStats{ChunkSize: defaultTransferChunk}
+
+	stats.observeChunk(64*1024, 5*time.Second, nil)
+	require.Equal(t, defaultTransferChunk, stats.ChunkSize)
+	require.Zero(t, stats.Chunks)
+	require.Zero(t, stats.Throughput)
+}
+
+func TestUT_FS_ChunkTuning_ClampsAndAligns(t *testing.T) {
+	require.Equal(t, minTransferChunk, clampTransferChunk(0))
+	require.Equal(t, maxTransferChunk, clampTransferChunk(1<<40))
+	require.Equal(t, uint64(20*mib), clampTransferChunk(20*mib+1000))
+	require.Zero(t, minTransferChunk%transferChunkAlign)
+	require.Zero(t, maxTransferChunk%transferChunkAlign)
+
+	// Graph rejects upload session ranges of 60 MiB or more.
+	largest := clampTransferChunk(60 * mib)
+	require.Less(t, largest, uint64(60*mib))
+	require.Zero(t, largest%transferChunkAlign)
+}
+
+func TestUT_FS_ChunkTuning_ProfilePersistsPerNetwork(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	network := "home"
+	fs.chunkTuner.network = func() string { return network }
+
+	uploads := fs.transferChunks(chunkUpload)
+	require.Equal(t, defaultTransferChunk, uploads.NextChunkSize())
+	uploads.ObserveChunk(10*mib, time.Second, nil)
+	require.Equal(t, uint64(20*mib), uploads.NextChunkSize())
+	require.Equal(t, defaultTransferChunk, fs.transferChunks(chunkDownload).NextChunkSize(),
+		"downloads are tuned separately")
+
+	// Another network starts from the default.
+	network = "cafe"
+	fs.chunkTuner.checked = time.Time{}
+	require.Equal(t, defaultTransferChunk, uploads.NextChunkSize())
+
+	// Forget what is in memory: the home profile is read back from the database.
+	network = "home"
+	fs.chunkTuner.profile = nil
+	profile := fs.ChunkProfile()
+	require.Equal(t, "home", profile.Network)
+	require.Equal(t, uint64(20*mib), profile.Upload.ChunkSize)
+	require.Equal(t, uint64(1), profile.Upload.Chunks)
+}
@@ -0,0 +1,360 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Conflicts flagged with MarkFileConflict, or left in the CONFLICT state by
+// delta sync, can be resolved interactively. The launcher receives the
+// ConflictDetected D-Bus signal, shows the local and remote versions side by
+// side and reports the user's choice through ResolveConflict.
+
+// Choices accepted by ResolveConflictChoice.
+const (
+	ConflictKeepLocal  = "keep-local"
+	ConflictKeepRemote = "keep-remote"
+	ConflictKeepBoth   = "keep-both"
+)
+
+const conflictRemoteDirName = "conflicts"
+
+// ConflictDetails describes both versions of a conflicted item.
+type ConflictDetails struct {
+	ID            string
+	Path          string
+	Message       string
+	LocalSize     uint64
+	LocalModTime  time.Time
+	RemoteSize    uint64
+	RemoteModTime time.Time
+	// RemoteAvailable is false when the remote version cannot be read, e.g.
+	// while offline or for items that were never uploaded.
+	RemoteAvailable bool
+	// RemoteModifiedBy is who last modified the remote version, if known.
+	RemoteModifiedBy string
+	// PeerPath is the path of the conflict copy paired with the item, or of
+	// the original when the item is a conflict copy.
+	PeerPath string
+}
+
+// Conflicts returns the IDs of all conflicted items.
+func (f *Filesystem) Conflicts() []string {
+	ids := make(map[string]struct{})
+	f.statusM.RLock()
+	for id, status := range f.statuses {
+		if status.Status == StatusConflict {
+			ids[id] = struct{}{}
+		}
+	}
+	f.statusM.RUnlock()
+
+	var copies []string
+	if f.db != nil {
+		_ = f.db.View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(bucketMetadataV2)
+			if bucket == nil {
+				return nil
+			}
+			return bucket.ForEach(func(_, v []byte) error {
+				var entry metadata.Entry
+				if err := json.Unmarshal(v, &entry); err == nil && entry.State == metadata.ItemStateConflict {
+					ids[entry.ID] = struct{}{}
+				}
+				if entry.ConflictDevice != "" && entry.ConflictPeer != "" {
+					// a conflict copy OneDrive made, the original is listed
+					copies = append(copies, entry.ConflictPeer)
+				}
+				return nil
+			})
+		})
+	}
+
+	for _, id := range copies {
+		if copyID, _ := f.remoteConflictCopy(id); copyID != "" {
+			ids[id] = struct{}{}
+		}
+	}
+
+	result := make([]string, 0, len(ids))
+	for id := range ids {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// conflicted reports whether the item is flagged as conflicted.
+func (f *Filesystem) conflicted(id string) bool {
+	f.statusM.RLock()
+	status, ok := f.statuses[id]
+	f.statusM.RUnlock()
+	if ok && status.Status == StatusConflict {
+		return true
+	}
+	entry, err := f.GetMetadataEntry(id)
+	if err == nil && entry.State == metadata.ItemStateConflict {
+		return true
+	}
+	copyID, _ := f.remoteConflictCopy(id)
+	return copyID != ""
+}
+
+// GetConflictDetails returns the local and remote size and modification time
+// of a conflicted item.
+func (f *Filesystem) GetConflictDetails(id string) (ConflictDetails, error) {
+	return f.conflictDetailsWith(id, graphItemRemote{ctx: f.mountContext(), auth: f.auth})
+}
+
+func (f *Filesystem) conflictDetailsWith(id string, remote itemRemote) (ConflictDetails, error) {
+	inode := f.GetID(id)
+	if inode == nil || !f.conflicted(id) {
+		return ConflictDetails{}, errors.NewNotFoundError("no conflict for item", nil)
+	}
+
+	details := ConflictDetails{
+		ID:           id,
+		Path:         inode.Path(),
+		Message:      "changed locally and remotely",
+		LocalSize:    inode.Size(),
+		LocalModTime: time.Unix(int64(inode.ModTime()), 0),
+	}
+	f.statusM.RLock()
+	if status, ok := f.statuses[id]; ok && status.ErrorMsg != "" {
+		details.Message = status.ErrorMsg
+	}
+	f.statusM.RUnlock()
+	if copyID, device := f.remoteConflictCopy(id); copyID != "" {
+		f.remoteConflictDetails(&details, copyID, device)
+		return details, nil
+	}
+	if peer := f.GetID(f.ConflictPeer(id)); peer != nil {
+		details.PeerPath = peer.Path()
+	}
+
+	if isLocalID(id) || f.IsOffline() {
+		return details, nil
+	}
+	item, err := remote.GetItem(id)
+	if err != nil {
+		logging.Debug().Err(err).Str("id", id).Msg("Could not read remote version of conflicted item")
+		return details, nil
+	}
+	details.RemoteAvailable = true
+	details.RemoteSize = item.Size
+	details.RemoteModifiedBy = item.ModifiedByName()
+	if item.ModTime != nil {
+		details.RemoteModTime = *item.ModTime
+	}
+	return details, nil
+}
+
+// conflictRemotePath is where the remote version of a conflicted item is
+// downloaded for previews.
+func (f *Filesystem) conflictRemotePath(id string) string {
+	return filepath.Join(filepath.Dir(f.content.directory), conflictRemoteDirName, id)
+}
+
+// FetchConflictRemote downloads the remote version of a conflicted item for
+// preview and returns the path of the downloaded copy. The copy is removed
+// when the conflict is resolved.
+func (f *Filesystem) FetchConflictRemote(id string) (string, error) {
+	return f.fetchConflictRemoteWith(id, graphItemRemote{ctx: f.mountContext(), auth: f.auth})
+}
+
+func (f *Filesystem) fetchConflictRemoteWith(id string, remote itemRemote) (string, error) {
+	if f.GetID(id) == nil || !f.conflicted(id) {
+		return "", errors.NewNotFoundError("no conflict for item", nil)
+	}
+	// The remote version of an item OneDrive made a conflict copy of is the copy
+	source := id
+	if copyID, _ := f.remoteConflictCopy(id); copyID != "" {
+		source = copyID
+	}
+	if isLocalID(source) {
+		return "", errors.NewNotFoundError("item has no remote version", nil)
+	}
+
+	path := f.conflictRemotePath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), id+".*")
+	if err != nil {
+		return "", err
+	}
+	if err := remote.Download(source, tmp); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return "", errors.Wrap(err, "failed to download remote version")
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return path, nil
+}
+
+// ResolveConflictChoice resolves a conflicted item as chosen by the user:
+// ConflictKeepLocal uploads the local version over the remote one,
+// ConflictKeepRemote replaces the local version with the remote one, and
+// ConflictKeepBoth saves the local version as a conflict copy beside the item
+// before taking the remote version. For an item OneDrive saved a conflict
+// copy of, the copy stands in for the remote version.
+func (f *Filesystem) ResolveConflictChoice(ctx context.Context, id, choice string) error {
+	return f.resolveConflictChoiceWith(ctx, id, choice, graphItemRemote{ctx: ctx, auth: f.auth})
+}
+
+func (f *Filesystem) resolveConflictChoiceWith(ctx context.Context, id, choice string, remote itemRemote) error {
+	inode := f.GetID(id)
+	if inode == nil || !f.conflicted(id) {
+		return errors.NewNotFoundError("no conflict for item", nil)
+	}
+
+	var err error
+	copyID, _ := f.remoteConflictCopy(id)
+	switch {
+	case copyID != "":
+		err = f.resolveRemoteConflictCopy(ctx, id, copyID, choice, remote)
+	case choice == ConflictKeepLocal:
+		f.keepLocalVersion(inode)
+	case choice == ConflictKeepRemote:
+		err = f.takeRemoteVersion(ctx, inode, remote)
+	case choice == ConflictKeepBoth:
+		var copyInode *Inode
+		if copyInode, err = f.copyLocalVersion(inode); err == nil {
+			if err = f.takeRemoteVersion(ctx, inode, remote); err != nil {
+				// Without the remote version the copy would only duplicate
+				// the local one.
+				f.DeleteID(copyInode.ID())
+				_ = f.content.Delete(copyInode.ID())
+			} else {
+				f.keepLocalVersion(copyInode)
+			}
+		}
+	default:
+		return errors.NewValidationError("unknown conflict choice "+choice, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	_ = os.Remove(f.conflictRemotePath(id))
+	f.statusM.Lock()
+	delete(f.statuses, id)
+	f.statusM.Unlock()
+	f.notifyStatusChange(id)
+
+	logging.Info().Str("id", id).Str("choice", choice).Msg("Resolved conflict")
+	return nil
+}
+
+// keepLocalVersion queues the local version for upload.
+func (f *Filesystem) keepLocalVersion(inode *Inode) {
+	id := inode.ID()
+	f.markPendingUpload(id)
+	if f.holdUpload(inode) || f.uploads == nil {
+		return
+	}
+	if _, err := f.uploads.QueueUploadWithPriority(inode, PriorityHigh); err != nil {
+		logging.Warn().Err(err).Str("id", id).Msg("Failed to queue upload of kept local version")
+	}
+}
+
+// takeRemoteVersion replaces the item's content and metadata with the remote
+// version, discarding local changes.
+func (f *Filesystem) takeRemoteVersion(ctx context.Context, inode *Inode, remote itemRemote) error {
+	id := inode.ID()
+	if isLocalID(id) {
+		return errors.NewNotFoundError("item has no remote version", nil)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	item, err := remote.GetItem(id)
+	if err != nil {
+		return errors.Wrap(err, "failed to read remote version")
+	}
+
+	if f.uploads != nil {
+		f.uploads.CancelUpload(id)
+	}
+	if err := f.content.Delete(id); err != nil {
+		return err
+	}
+	fd, err := f.content.Open(id)
+	if err != nil {
+		return err
+	}
+	if err := remote.Download(id, fd); err != nil {
+		_ = f.content.Delete(id)
+		return errors.Wrap(err, "failed to download remote version")
+	}
+	f.content.updateCacheEntry(id, int64(item.Size))
+
+	inode.mu.Lock()
+	inode.DriveItem = *item
+	inode.mu.Unlock()
+	f.persistMetadataEntry(id, inode)
+	f.markCleanLocalState(id)
+	return nil
+}
+
+// copyLocalVersion saves the item's local content as a new conflict copy in
+// the same folder.
+func (f *Filesystem) copyLocalVersion(inode *Inode) (*Inode, error) {
+	parentID := inode.ParentID()
+	parent := f.GetID(parentID)
+	if parent == nil {
+		return nil, errors.NewNotFoundError("parent of conflicted item not found", nil)
+	}
+
+	src, err := f.content.Open(inode.ID())
+	if err != nil {
+		return nil, err
+	}
+	copyInode := NewInode(f.conflictCopyName(parentID, inode.Name(), f.localAuthor(), time.Now()), fuse.S_IFREG|0644, parent)
+	copyID := copyInode.ID()
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	size, err := f.content.InsertStream(copyID, src)
+	if err != nil {
+		_ = f.content.Delete(copyID)
+		return nil, err
+	}
+
+	copyInode.mu.Lock()
+	copyInode.DriveItem.Size = uint64(size)
+	copyInode.mu.Unlock()
+	f.InsertChild(parentID, copyInode)
+	f.linkConflictPair(inode.ID(), copyID)
+	return copyInode, nil
+}
+
+// emitConflictDetected tells D-Bus clients that the item needs a decision.
+func (f *Filesystem) emitConflictDetected(id, message string) {
+	if f.dbusServer == nil {
+		return
+	}
+	inode := f.GetID(id)
+	if inode == nil {
+		return
+	}
+	f.dbusServer.SendConflictDetected(inode.Path(), message)
+}
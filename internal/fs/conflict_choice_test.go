@@ -0,0 +1,89 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/stretchr/testify/require"
+)
+
+// setupConflictedFile registers a file whose local edits conflict with a
+// newer remote version.
+func setupConflictedFile(t *testing.T) (*Filesystem, *Inode, *fakeRemote) {
+	t.Helper()
+	fs, file := setupFrozenFile(t)
+	fs.uploads = nil // uploads of kept versions are not queued in these tests
+	fs.transitionToState(file.ID(), metadata.ItemStateConflict)
+	fs.MarkFileConflict(file.ID(), "changed locally and remotely")
+
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	remote := &fakeRemote{
+		item: &graph.DriveItem{
+			ID:      file.ID(),
+			Name:    file.Name(),
+			Size:    uint64(len("upstream version")),
+			ModTime: &modified,
+			ETag:    "etag-2",
+			Parent:  &graph.DriveItemParent{ID: "parent"},
+		},
+		content: "upstream version",
+	}
+	return fs, file, remote
+}
+
+func TestUT_FS_ConflictChoice_DetailsAndKeepRemote(t *testing.T) {
+	fs, file, remote := setupConflictedFile(t)
+	require.Equal(t, []string{file.ID()}, fs.Conflicts())
+
+	details, err := fs.conflictDetailsWith(file.ID(), remote)
+	require.NoError(t, err)
+	require.Equal(t, "changed locally and remotely", details.Message)
+	require.Equal(t, uint64(len("local tweak")), details.LocalSize)
+	require.True(t, details.RemoteAvailable)
+	require.Equal(t, uint64(len("upstream version")), details.RemoteSize)
+	require.Equal(t, *remote.item.ModTime, details.RemoteModTime)
+
+	path, err := fs.fetchConflictRemoteWith(file.ID(), remote)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "upstream version", string(data))
+
+	require.Error(t, fs.resolveConflictChoiceWith(context.Background(), file.ID(), "keep-neither", remote))
+	require.NoError(t, fs.resolveConflictChoiceWith(context.Background(), file.ID(), ConflictKeepRemote, remote))
+
+	require.Equal(t, "upstream version", string(fs.content.Get(file.ID())))
+	require.Equal(t, "etag-2", file.DriveItem.ETag)
+	require.False(t, file.HasChanges())
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateHydrated, entry.State)
+	require.Empty(t, fs.Conflicts())
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "the preview copy is removed once resolved")
+}
+
+func TestUT_FS_ConflictChoice_KeepLocalAndKeepBoth(t *testing.T) {
+	fs, file, remote := setupConflictedFile(t)
+	require.NoError(t, fs.resolveConflictChoiceWith(context.Background(), file.ID(), ConflictKeepLocal, remote))
+	require.Equal(t, "local tweak", string(fs.content.Get(file.ID())))
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateDirtyLocal, entry.State, "the local version is uploaded")
+	require.Empty(t, fs.Conflicts())
+
+	fs, file, remote = setupConflictedFile(t)
+	require.NoError(t, fs.resolveConflictChoiceWith(context.Background(), file.ID(), ConflictKeepBoth, remote))
+	require.Equal(t, "upstream version", string(fs.content.Get(file.ID())))
+	copied := childNamed(fs, "parent", "app (conflicted copy from ")
+	require.NotNil(t, copied)
+	require.True(t, strings.HasSuffix(copied.Name(), ".conf"))
+	require.Equal(t, "local tweak", string(fs.content.Get(copied.ID())))
+	require.True(t, copied.HasChanges(), "the local version is uploaded as a new file")
+	require.Empty(t, fs.Conflicts())
+}
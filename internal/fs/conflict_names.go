@@ -0,0 +1,164 @@
+package fs
+
+import (
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// Conflict copies are named after who made the version they hold and when,
+// following a template with these placeholders:
+//
+//	{name}  original name without extension
+//	{ext}   extension of the original name, including the dot
+//	{user}  who last modified the saved version
+//	{date}  date the copy was made (2006-01-02)
+//	{time}  time the copy was made (15.04.05)
+//
+// When a copy of the same name already exists in the folder, for example two
+// conflicts by the same user within a second, a counter is added before the
+// extension: "name (2).ext".
+//
+// A copy of the remote version names the user reported by OneDrive; a copy of
+// the local version names the signed-in account. The copy and the original
+// record each other as ConflictPeer in their metadata entries so the conflict
+// dialog can show them as a pair.
+
+// DefaultConflictNameTemplate is the conflict copy name template used unless
+// one is configured.
+const DefaultConflictNameTemplate = "{name} (conflicted copy from {user} on {date} {time}){ext}"
+
+// conflictUnknownUser stands in for {user} when the author is unknown.
+const conflictUnknownUser = "unknown user"
+
+// ValidateConflictNameTemplate reports whether template can name conflict
+// copies: it must keep the original name.
+func ValidateConflictNameTemplate(template string) error {
+	if !strings.Contains(template, "{name}") {
+		return errors.NewValidationError("conflict name template must contain {name}", nil)
+	}
+	return nil
+}
+
+// SetConflictNameTemplate sets the template for conflict copy names; an empty
+// template restores DefaultConflictNameTemplate.
+func (f *Filesystem) SetConflictNameTemplate(template string) error {
+	if template == "" {
+		template = DefaultConflictNameTemplate
+	}
+	if err := ValidateConflictNameTemplate(template); err != nil {
+		return err
+	}
+	f.Lock()
+	f.conflictNameTemplate = template
+	f.Unlock()
+	return nil
+}
+
+// conflictCopyName names a conflict copy of originalName, placed in the folder
+// parentID, holding a version last modified by author, made at the given time.
+// The name does not collide with the folder's cached children.
+func (f *Filesystem) conflictCopyName(parentID, originalName, author string, at time.Time) string {
+	f.RLock()
+	template := f.conflictNameTemplate
+	f.RUnlock()
+	if template == "" {
+		template = DefaultConflictNameTemplate
+	}
+	name := formatConflictName(template, originalName, author, at)
+
+	taken := f.cachedChildNames(parentID)
+	ext := filepath.Ext(name)
+	candidate := name
+	for n := 2; taken[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	return candidate
+}
+
+// cachedChildNames returns the lower-cased names of the cached children of
+// parentID. OneDrive names are case-insensitive.
+func (f *Filesystem) cachedChildNames(parentID string) map[string]bool {
+	parent := f.GetID(parentID)
+	if parent == nil {
+		return nil
+	}
+	parent.mu.RLock()
+	children := append([]string(nil), parent.children...)
+	parent.mu.RUnlock()
+	names := make(map[string]bool, len(children))
+	for _, id := range children {
+		if child := f.GetID(id); child != nil {
+			names[strings.ToLower(child.Name())] = true
+		}
+	}
+	return names
+}
+
+// formatConflictName fills in a conflict name template.
+func formatConflictName(template, originalName, author string, at time.Time) string {
+	ext := filepath.Ext(originalName)
+	author = sanitizeConflictAuthor(author)
+	if author == "" {
+		author = conflictUnknownUser
+	}
+	return strings.NewReplacer(
+		"{name}", strings.TrimSuffix(originalName, ext),
+		"{ext}", ext,
+		"{user}", author,
+		"{date}", at.Format("2006-01-02"),
+		"{time}", at.Format("15.04.05"),
+	).Replace(template)
+}
+
+// sanitizeConflictAuthor drops characters OneDrive does not allow in names.
+func sanitizeConflictAuthor(author string) string {
+	author = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return -1
+		}
+		return r
+	}, author)
+	return strings.TrimSpace(author)
+}
+
+// localAuthor names the author of local versions: the signed-in account, or
+// the local user when the account is unknown.
+func (f *Filesystem) localAuthor() string {
+	if f.auth != nil && f.auth.Account != "" {
+		return f.auth.Account
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// linkConflictPair records original and copy as each other's conflict peer.
+func (f *Filesystem) linkConflictPair(originalID, copyID string) {
+	for id, peer := range map[string]string{originalID: copyID, copyID: originalID} {
+		_, err := f.UpdateMetadataEntry(id, func(entry *metadata.Entry) error {
+			entry.ConflictPeer = peer
+			return nil
+		})
+		if err != nil {
+			logging.Debug().Err(err).Str("id", id).Str("peer", peer).Msg("Failed to record conflict peer")
+		}
+	}
+}
+
+// ConflictPeer returns the ID of the other item of the conflict pair id
+// belongs to, or an empty string.
+func (f *Filesystem) ConflictPeer(id string) string {
+	entry, err := f.GetMetadataEntry(id)
+	if err != nil {
+		return ""
+	}
+	return entry.ConflictPeer
+}
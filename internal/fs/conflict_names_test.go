@@ -0,0 +1,79 @@
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_ConflictNames_Template(t *testing.T) {
+	at := time.Date(2026, 3, 1, 14, 5, 9, 0, time.UTC)
+	require.Equal(t, "report (conflicted copy from Ada Lovelace on 2026-03-01 14.05.09).docx",
+		formatConflictName(DefaultConflictNameTemplate, "report.docx", "Ada Lovelace", at))
+	require.Equal(t, "notes (conflicted copy from unknown user on 2026-03-01 14.05.09)",
+		formatConflictName(DefaultConflictNameTemplate, "notes", "", at))
+	require.Equal(t, "Makefile - AB Dept 2026-03-01 14.05.09",
+		formatConflictName("{name} - {user} {date} {time}{ext}", "Makefile", "A/B: Dept", at),
+		"characters OneDrive rejects are dropped from the user name")
+
+	fs := newTestFilesystemWithMetadata(t)
+	require.Error(t, fs.SetConflictNameTemplate("conflict {date}"))
+	require.NoError(t, fs.SetConflictNameTemplate("{user}'s {name}{ext}"))
+	require.Equal(t, "Ada's a.txt", fs.conflictCopyName("", "a.txt", "Ada", at))
+	require.NoError(t, fs.SetConflictNameTemplate(""))
+	require.Equal(t, "a (conflicted copy from Ada on 2026-03-01 14.05.09).txt", fs.conflictCopyName("", "a.txt", "Ada", at))
+}
+
+func TestUT_FS_ConflictNames_CounterAvoidsExistingCopies(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	require.NoError(t, fs.SetConflictNameTemplate("{name} ({user} {date}){ext}"))
+	at := time.Date(2026, 3, 1, 14, 5, 9, 0, time.UTC)
+
+	parent := NewInode("parent", fuse.S_IFDIR|0755, nil)
+	parent.DriveItem.ID = "parent"
+	registerHydratedEntry(t, fs, parent)
+	require.Equal(t, "a (Ada 2026-03-01).txt", fs.conflictCopyName("parent", "a.txt", "Ada", at))
+
+	for _, name := range []string{"a (Ada 2026-03-01).txt", "A (ADA 2026-03-01) (2).TXT"} {
+		fs.InsertChild("parent", NewInode(name, fuse.S_IFREG|0644, parent))
+	}
+	require.Equal(t, "a (Ada 2026-03-01) (3).txt", fs.conflictCopyName("parent", "a.txt", "Ada", at),
+		"a second conflict on the same day does not overwrite the first copy")
+}
+
+func TestUT_FS_ConflictNames_PairsCopyWithOriginal(t *testing.T) {
+	fs, file, remote := setupConflictedFile(t)
+	remote.item.LastModifiedBy = &graph.IdentitySet{User: &graph.Identity{DisplayName: "Grace Hopper"}}
+
+	details, err := fs.conflictDetailsWith(file.ID(), remote)
+	require.NoError(t, err)
+	require.Equal(t, "Grace Hopper", details.RemoteModifiedBy)
+	require.Empty(t, details.PeerPath)
+
+	require.NoError(t, fs.resolveConflictChoiceWith(context.Background(), file.ID(), ConflictKeepBoth, remote))
+	copied := childNamed(fs, "parent", "app (conflicted copy from ")
+	require.NotNil(t, copied)
+	require.Equal(t, copied.ID(), fs.ConflictPeer(file.ID()))
+	require.Equal(t, file.ID(), fs.ConflictPeer(copied.ID()))
+
+	fs.persistMetadataEntry(file.ID(), file)
+	require.Equal(t, copied.ID(), fs.ConflictPeer(file.ID()), "the pairing survives metadata updates")
+}
+
+func TestUT_FS_ConflictNames_FrozenCopyNamesRemoteAuthor(t *testing.T) {
+	fs, file := setupFrozenFile(t)
+	remote := &fakeRemote{
+		item: &graph.DriveItem{ID: file.ID(), LastModifiedBy: &graph.IdentitySet{
+			User: &graph.Identity{DisplayName: "Grace Hopper"},
+		}},
+		content: "upstream",
+	}
+	copied, err := fs.createFrozenConflictCopy(context.Background(), "parent", file.Name(), file.ID(), remote)
+	require.NoError(t, err)
+	require.Contains(t, copied.Name(), "conflicted copy from Grace Hopper on ")
+	require.Equal(t, file.ID(), fs.ConflictPeer(copied.ID()))
+}
@@ -3,8 +3,6 @@ package fs
 import (
 	"context"
 	"fmt"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/auriora/onemount/internal/graph"
@@ -187,7 +185,11 @@ func (cr *ConflictResolver) resolveKeepBoth(ctx context.Context, conflict *Confl
 
 	// Create a conflict copy of the remote version
 	if conflict.RemoteItem != nil {
-		conflictName := cr.generateConflictName(conflict.RemoteItem.Name)
+		parentID := ""
+		if conflict.RemoteItem.Parent != nil {
+			parentID = conflict.RemoteItem.Parent.ID
+		}
+		conflictName := cr.generateConflictName(parentID, conflict.RemoteItem.Name, conflict.RemoteItem.ModifiedByName())
 		logger.Info().Str("conflictName", conflictName).Msg("Creating conflict copy")
 
 		// Create a new item for the remote version with conflict name
@@ -202,6 +204,7 @@ func (cr *ConflictResolver) resolveKeepBoth(ctx context.Context, conflict *Confl
 			if parent != nil {
 				conflictInode := NewInodeDriveItem(conflictItem)
 				cr.fs.InsertID(conflictItem.ID+"_conflict", conflictInode)
+				cr.fs.linkConflictPair(conflict.ID, conflictItem.ID+"_conflict")
 			}
 		}
 	}
@@ -244,6 +247,10 @@ func (cr *ConflictResolver) keepLocalChanges(ctx context.Context, conflict *Conf
 	logger := logging.WithLogContext(logging.NewLogContextWithRequestAndUserID("keep_local_changes"))
 
 	if conflict.LocalItem != nil && conflict.OfflineChange != nil {
+		if cr.fs.holdUpload(conflict.LocalItem) {
+			logger.Info().Msg("Kept local changes without uploading; upload is held")
+			return nil
+		}
 		// Queue the local changes for upload only if the item has a valid parent
 		if cr.fs.uploads != nil && conflict.LocalItem.DriveItem.Parent != nil {
 			_, err := cr.fs.uploads.QueueUploadWithPriority(conflict.LocalItem, PriorityLow)
@@ -260,11 +267,8 @@ func (cr *ConflictResolver) keepLocalChanges(ctx context.Context, conflict *Conf
 	return nil
 }
 
-// generateConflictName generates a unique name for conflict copies
-func (cr *ConflictResolver) generateConflictName(originalName string) string {
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	ext := filepath.Ext(originalName)
-	nameWithoutExt := strings.TrimSuffix(originalName, ext)
-
-	return fmt.Sprintf("%s (Conflict Copy %s)%s", nameWithoutExt, timestamp, ext)
+// generateConflictName names a conflict copy of a version last modified by
+// author. The name is unique among the cached children of parentID.
+func (cr *ConflictResolver) generateConflictName(parentID, originalName, author string) string {
+	return cr.fs.conflictCopyName(parentID, originalName, author, time.Now())
 }
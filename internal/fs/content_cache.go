@@ -31,9 +31,14 @@ type LoopbackCache struct {
 	entries      map[string]*CacheEntry // Map of file ID to cache entry
 	totalSize    int64                  // Total size of all cached files
 	maxCacheSize int64                  // Maximum cache size in bytes (0 = unlimited)
+	ledger       *cacheUsageLedger      // Shares maxCacheSize with other caches, nil for a quota
+	unshareM     sync.Mutex             // One Unshare at a time, so that no copy replaces another
 
 	evictionHandler func(string)
 	evictionGuard   func(string) bool
+
+	// Mappings of cached files serving reads, see mapped_reads.go
+	mappings contentMappings
 }
 
 // NewLoopbackCache creates a new LoopbackCache with optional size limit
@@ -67,6 +72,10 @@ func NewLoopbackCacheWithSize(directory string, maxCacheSize int64) *LoopbackCac
 		totalSize:    0,
 		maxCacheSize: maxCacheSize,
 	}
+	if reason := mappingUnsafe(directory); reason != "" {
+		logging.Debug().Str("reason", reason).Msg("Not mapping cached content")
+		cache.mappings.disabled = true
+	}
 
 	// Initialize cache size tracking by scanning existing files
 	cache.initializeCacheTracking()
@@ -161,6 +170,13 @@ func (l *LoopbackCache) Insert(id string, content []byte) error {
 		return err
 	}
 
+	defer l.suspendMapping(id)()
+	// Replace rather than overwrite content shared with other mounts
+	if linkCount(l.contentPath(id)) > 1 {
+		_ = l.Close(id)
+		_ = os.Remove(l.contentPath(id))
+	}
+
 	// Write the file
 	if err := os.WriteFile(l.contentPath(id), content, 0600); err != nil {
 		return err
@@ -174,6 +190,10 @@ func (l *LoopbackCache) Insert(id string, content []byte) error {
 
 // InsertStream inserts a stream of data
 func (l *LoopbackCache) InsertStream(id string, reader io.Reader) (int64, error) {
+	defer l.suspendMapping(id)()
+	if err := l.Unshare(id); err != nil {
+		return 0, err
+	}
 	fd, err := l.Open(id)
 	if err != nil {
 		return 0, err
@@ -194,6 +214,7 @@ func (l *LoopbackCache) InsertStream(id string, reader io.Reader) (int64, error)
 
 // Delete closes the fd AND deletes content from disk.
 func (l *LoopbackCache) Delete(id string) error {
+	defer l.suspendMapping(id)()
 	// Try to close the file first
 	closeErr := l.Close(id)
 
@@ -215,6 +236,8 @@ func (l *LoopbackCache) Delete(id string) error {
 
 // Move moves content from one ID to another
 func (l *LoopbackCache) Move(oldID string, newID string) error {
+	defer l.suspendMapping(oldID)()
+	defer l.suspendMapping(newID)()
 	// Close both files to ensure they're not open during the move
 	// Capture errors but continue with the move operation
 	oldCloseErr := l.Close(oldID)
@@ -255,6 +278,16 @@ func (l *LoopbackCache) IsOpen(id string) bool {
 	return ok
 }
 
+// OpenIDs returns the IDs of all files with an open file handle
+func (l *LoopbackCache) OpenIDs() []string {
+	var ids []string
+	l.fds.Range(func(key, _ interface{}) bool {
+		ids = append(ids, key.(string))
+		return true
+	})
+	return ids
+}
+
 // HasContent is used to find if we have a file or not in cache (in any state)
 func (l *LoopbackCache) HasContent(id string) bool {
 	// is it already open?
@@ -269,10 +302,22 @@ func (l *LoopbackCache) HasContent(id string) bool {
 
 // Open returns a filehandle for subsequent access
 func (l *LoopbackCache) Open(id string) (*os.File, error) {
+	return l.open(id, true)
+}
+
+// OpenUntouched is Open for reads that should not keep the content cached,
+// such as search indexer scans: the entry's last access is left as it was.
+func (l *LoopbackCache) OpenUntouched(id string) (*os.File, error) {
+	return l.open(id, false)
+}
+
+func (l *LoopbackCache) open(id string, touch bool) (*os.File, error) {
 	if fd, ok := l.fds.Load(id); ok {
 		// already opened, return existing fd
 		// Touch the cache entry to update last accessed time
-		l.touchCacheEntry(id)
+		if touch {
+			l.touchCacheEntry(id)
+		}
 		return fd.(*os.File), nil
 	}
 
@@ -297,13 +342,16 @@ func (l *LoopbackCache) Open(id string) (*os.File, error) {
 	l.fds.Store(id, fd)
 
 	// Touch the cache entry to update last accessed time
-	l.touchCacheEntry(id)
+	if touch {
+		l.touchCacheEntry(id)
+	}
 
 	return fd, nil
 }
 
 // Close closes the currently open fd
 func (l *LoopbackCache) Close(id string) error {
+	l.unmap(id)
 	if fd, ok := l.fds.Load(id); ok {
 		file := fd.(*os.File)
 
@@ -385,19 +433,19 @@ func (l *LoopbackCache) CleanupCache(expirationDays int) (int, error) {
 	})
 
 	// After time-based cleanup, enforce size limits if configured
-	if l.maxCacheSize > 0 {
+	if limit := l.cacheLimit(); limit > 0 {
 		l.entriesM.RLock()
 		currentSize := l.totalSize
 		l.entriesM.RUnlock()
 
-		if currentSize > l.maxCacheSize {
+		if currentSize > limit {
 			logging.Info().
 				Int64("currentSize", currentSize).
-				Int64("maxCacheSize", l.maxCacheSize).
+				Int64("maxCacheSize", limit).
 				Msg("Cache size exceeds limit after time-based cleanup, performing LRU eviction")
 
 			// Evict entries to get under the limit
-			spaceToFree := currentSize - l.maxCacheSize
+			spaceToFree := currentSize - limit
 			if evictErr := l.evictIfNeeded(0); evictErr != nil {
 				logging.Error().Err(evictErr).Msg("Failed to enforce cache size limit during cleanup")
 			} else {
@@ -411,6 +459,84 @@ func (l *LoopbackCache) CleanupCache(expirationDays int) (int, error) {
 	return removedCount, err
 }
 
+// Reasons a cache cleanup removes a file.
+const (
+	CleanupExpired   = "expired"
+	CleanupSizeLimit = "size-limit"
+)
+
+// CleanupCandidate is a cached file a cleanup would remove.
+type CleanupCandidate struct {
+	ID           string
+	Size         int64
+	LastAccessed time.Time
+	Reason       string
+}
+
+// PlanCleanup returns the files CleanupCache(expirationDays) would remove,
+// without removing anything: files expired by modification time, then the
+// least recently used files the eviction guard allows until the cache fits
+// its size limit. Expiration is skipped when expirationDays is zero or less,
+// matching the periodic cleanup being disabled.
+func (l *LoopbackCache) PlanCleanup(expirationDays int) []CleanupCandidate {
+	var candidates []CleanupCandidate
+	planned := make(map[string]bool)
+
+	l.entriesM.RLock()
+	defer l.entriesM.RUnlock()
+
+	limit := l.cacheLimitLocked()
+	remaining := l.totalSize
+	if expirationDays > 0 {
+		cutoffTime := time.Now().AddDate(0, 0, -expirationDays)
+		_ = filepath.Walk(l.directory, func(path string, info os.FileInfo, err error) error {
+			if path == l.directory || err != nil || info.IsDir() {
+				return nil
+			}
+			id := filepath.Base(path)
+			if !info.ModTime().Before(cutoffTime) || l.IsOpen(id) {
+				return nil
+			}
+			candidate := CleanupCandidate{ID: id, Size: info.Size(), LastAccessed: info.ModTime(), Reason: CleanupExpired}
+			if entry, ok := l.entries[id]; ok {
+				candidate.Size = entry.size
+				candidate.LastAccessed = entry.lastAccessed
+				remaining -= entry.size
+			}
+			candidates = append(candidates, candidate)
+			planned[id] = true
+			return nil
+		})
+	}
+
+	if limit <= 0 || remaining <= limit {
+		return candidates
+	}
+	lru := make([]CleanupCandidate, 0, len(l.entries))
+	for id, entry := range l.entries {
+		if planned[id] || l.IsOpen(id) {
+			continue
+		}
+		lru = append(lru, CleanupCandidate{ID: id, Size: entry.size, LastAccessed: entry.lastAccessed, Reason: CleanupSizeLimit})
+	}
+	sort.Slice(lru, func(i, j int) bool {
+		return lru[i].LastAccessed.Before(lru[j].LastAccessed)
+	})
+	spaceNeeded := remaining - limit
+	var freed int64
+	for _, candidate := range lru {
+		if freed >= spaceNeeded {
+			break
+		}
+		if l.evictionGuard != nil && !l.evictionGuard(candidate.ID) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+		freed += candidate.Size
+	}
+	return candidates
+}
+
 // updateCacheEntry updates the cache entry for a file
 func (l *LoopbackCache) updateCacheEntry(id string, size int64) {
 	l.entriesM.Lock()
@@ -428,6 +554,9 @@ func (l *LoopbackCache) updateCacheEntry(id string, size int64) {
 		lastAccessed: time.Now(),
 	}
 	l.totalSize += size
+	if l.ledger != nil {
+		l.ledger.note(l.totalSize)
+	}
 
 	logging.Debug().
 		Str("id", id).
@@ -445,6 +574,9 @@ func (l *LoopbackCache) removeCacheEntry(id string) {
 	if entry, exists := l.entries[id]; exists {
 		l.totalSize -= entry.size
 		delete(l.entries, id)
+		if l.ledger != nil {
+			l.ledger.note(l.totalSize)
+		}
 
 		logging.Debug().
 			Str("id", id).
@@ -464,18 +596,41 @@ func (l *LoopbackCache) touchCacheEntry(id string) {
 	}
 }
 
+// noteAccessed moves the last access of a cache entry forward to at.
+func (l *LoopbackCache) noteAccessed(id string, at time.Time) {
+	l.entriesM.Lock()
+	defer l.entriesM.Unlock()
+
+	if entry, exists := l.entries[id]; exists && at.After(entry.lastAccessed) {
+		entry.lastAccessed = at
+	}
+}
+
+// cachedIDs returns the IDs of the cached files.
+func (l *LoopbackCache) cachedIDs() []string {
+	l.entriesM.RLock()
+	defer l.entriesM.RUnlock()
+
+	ids := make([]string, 0, len(l.entries))
+	for id := range l.entries {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 // evictIfNeeded evicts old entries if the cache size would exceed the limit
 func (l *LoopbackCache) evictIfNeeded(newSize int64) error {
+	l.entriesM.Lock()
+	defer l.entriesM.Unlock()
+
 	// If no size limit is set, no eviction needed
-	if l.maxCacheSize == 0 {
+	limit := l.cacheLimitLocked()
+	if limit <= 0 {
 		return nil
 	}
 
-	l.entriesM.Lock()
-	defer l.entriesM.Unlock()
-
 	// Calculate how much space we need
-	spaceNeeded := (l.totalSize + newSize) - l.maxCacheSize
+	spaceNeeded := (l.totalSize + newSize) - limit
 	if spaceNeeded <= 0 {
 		return nil // No eviction needed
 	}
@@ -483,7 +638,7 @@ func (l *LoopbackCache) evictIfNeeded(newSize int64) error {
 	logging.Info().
 		Int64("currentSize", l.totalSize).
 		Int64("newSize", newSize).
-		Int64("maxCacheSize", l.maxCacheSize).
+		Int64("maxCacheSize", limit).
 		Int64("spaceNeeded", spaceNeeded).
 		Msg("Cache size limit exceeded, evicting old entries")
 
@@ -558,7 +713,7 @@ func (l *LoopbackCache) evictIfNeeded(newSize int64) error {
 		Msg("Cache eviction completed")
 
 	// Check if we freed enough space
-	if l.totalSize+newSize > l.maxCacheSize {
+	if l.totalSize+newSize > limit {
 		if skipped > 0 {
 			return fmt.Errorf("unable to free cache space: %d entries skipped by guard, need %d bytes, freed %d bytes", skipped, spaceNeeded, evictedSize)
 		}
@@ -600,6 +755,17 @@ func (l *LoopbackCache) SetMaxCacheSize(maxSize int64) {
 	}
 }
 
+// GetCacheEntrySizes returns a snapshot of cached file sizes keyed by ID
+func (l *LoopbackCache) GetCacheEntrySizes() map[string]int64 {
+	l.entriesM.RLock()
+	defer l.entriesM.RUnlock()
+	sizes := make(map[string]int64, len(l.entries))
+	for id, entry := range l.entries {
+		sizes[id] = entry.size
+	}
+	return sizes
+}
+
 // GetCacheEntryCount returns the number of cached files
 func (l *LoopbackCache) GetCacheEntryCount() int {
 	l.entriesM.RLock()
@@ -0,0 +1,196 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Items with identical content (copies of the same document) share their
+// QuickXorHash and size. The content hash index remembers which hydrated
+// items hold content for each hash, so hydrating another item with the same
+// hash copies the bytes from the local cache instead of downloading them.
+//
+// Content that is not open is hard-linked, like the shared content store;
+// Unshare gives an item a private copy before it is modified, so one copy
+// diverging never changes the others. Content that is open may be written
+// concurrently and is copied instead. Either way the result is verified
+// against the item's hash before it is used, and index entries whose content
+// no longer matches (modified, evicted, re-downloaded) are dropped then.
+
+// contentHashIndex maps content keys (see sharedContentKey) to the IDs of
+// items whose cached content had that hash when it was hydrated.
+type contentHashIndex struct {
+	mu     sync.Mutex
+	seeded bool
+	byKey  map[string]map[string]struct{}
+	hits   uint64
+}
+
+func (x *contentHashIndex) addLocked(key, id string) {
+	if x.byKey == nil {
+		x.byKey = make(map[string]map[string]struct{})
+	}
+	ids := x.byKey[key]
+	if ids == nil {
+		ids = make(map[string]struct{})
+		x.byKey[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (x *contentHashIndex) remove(key, id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if ids := x.byKey[key]; ids != nil {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(x.byKey, key)
+		}
+	}
+}
+
+// indexContent records that the cached content of id has the given hash.
+func (f *Filesystem) indexContent(id, quickXorHash string, size uint64) {
+	key := sharedContentKey(quickXorHash, size)
+	if key == "" || isLocalID(id) {
+		return
+	}
+	f.contentIndex.mu.Lock()
+	f.contentIndex.addLocked(key, id)
+	f.contentIndex.mu.Unlock()
+}
+
+// seedContentIndex indexes the items that were already cached when the mount
+// started. It runs once, on the first lookup.
+func (f *Filesystem) seedContentIndex() {
+	x := &f.contentIndex
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.seeded {
+		return
+	}
+	x.seeded = true
+	f.metadata.Range(func(_, value interface{}) bool {
+		inode, ok := value.(*Inode)
+		if !ok {
+			return true
+		}
+		inode.mu.RLock()
+		id := inode.DriveItem.ID
+		var key string
+		if inode.DriveItem.File != nil {
+			key = sharedContentKey(inode.DriveItem.File.Hashes.QuickXorHash, inode.DriveItem.Size)
+		}
+		inode.mu.RUnlock()
+		if key != "" && !isLocalID(id) && f.content.HasContent(id) {
+			x.addLocked(key, id)
+		}
+		return true
+	})
+}
+
+// contentCandidates returns the indexed items other than id holding content
+// for key.
+func (f *Filesystem) contentCandidates(key, id string) []string {
+	f.seedContentIndex()
+	f.contentIndex.mu.Lock()
+	defer f.contentIndex.mu.Unlock()
+	var ids []string
+	for candidate := range f.contentIndex.byKey[key] {
+		if candidate != id {
+			ids = append(ids, candidate)
+		}
+	}
+	return ids
+}
+
+// ContentDedupHits returns how many hydrations were satisfied from another
+// item's cached content.
+func (f *Filesystem) ContentDedupHits() uint64 {
+	f.contentIndex.mu.Lock()
+	defer f.contentIndex.mu.Unlock()
+	return f.contentIndex.hits
+}
+
+// hydrateFromLocalCopy fills the item's content from another cached item with
+// the same hash and size. It reports false when no verified copy exists.
+func (f *Filesystem) hydrateFromLocalCopy(id string, inode *Inode) (uint64, string, bool) {
+	if isLocalID(id) {
+		return 0, "", false
+	}
+	inode.mu.RLock()
+	item := inode.DriveItem
+	inode.mu.RUnlock()
+	if item.File == nil {
+		return 0, "", false
+	}
+	hash := item.File.Hashes.QuickXorHash
+	key := sharedContentKey(hash, item.Size)
+	if key == "" {
+		return 0, "", false
+	}
+
+	for _, source := range f.contentCandidates(key, id) {
+		if !f.content.HasContent(source) {
+			f.contentIndex.remove(key, source)
+			continue
+		}
+		if err := f.copyCachedContent(source, id); err != nil {
+			logging.Debug().Err(err).Str("id", id).Str("source", source).Msg("Could not copy content from an identical item")
+			continue
+		}
+		fd, err := f.content.Open(id)
+		if err == nil && strings.EqualFold(graph.QuickXORHashStream(fd), hash) {
+			f.content.updateCacheEntry(id, int64(item.Size))
+			f.contentIndex.mu.Lock()
+			f.contentIndex.hits++
+			f.contentIndex.mu.Unlock()
+			logging.Debug().Str("id", id).Str("source", source).Msg("Hydrated from identical content already in the cache")
+			return item.Size, hash, true
+		}
+		// The source diverged since it was indexed
+		_ = f.content.Delete(id)
+		f.contentIndex.remove(key, source)
+	}
+	return 0, "", false
+}
+
+// copyCachedContent replaces the content of id with that of source, linking
+// the file when source is not open and copying it otherwise.
+func (f *Filesystem) copyCachedContent(source, id string) error {
+	_ = f.content.Close(id)
+	path := f.content.contentPath(id)
+	tmp := path + sharedContentTmpName
+	_ = os.Remove(tmp)
+
+	if !f.content.IsOpen(source) {
+		if err := os.Link(f.content.contentPath(source), tmp); err == nil {
+			return os.Rename(tmp, path)
+		}
+	}
+
+	src, err := os.Open(f.content.contentPath(source))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_ContentDedup_HydratesIdenticalCopiesLocally(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+
+	content := []byte("the same document")
+	hash := graph.QuickXORHash(&content)
+	newFile := func(id string) *Inode {
+		file := NewInode(id+".txt", fuse.S_IFREG|0644, nil)
+		file.DriveItem.ID = id
+		file.DriveItem.Size = uint64(len(content))
+		file.DriveItem.File = &graph.File{Hashes: graph.Hashes{QuickXorHash: hash}}
+		registerHydratedEntry(t, fs, file)
+		return file
+	}
+
+	original := newFile("original")
+	require.NoError(t, fs.content.Insert(original.ID(), content))
+	copyA := newFile("copy-a")
+	copyB := newFile("copy-b")
+
+	// The original was cached before the index existed and is found by seeding.
+	size, gotHash, ok := fs.hydrateFromLocalCopy(copyA.ID(), copyA)
+	require.True(t, ok)
+	require.Equal(t, uint64(len(content)), size)
+	require.Equal(t, hash, gotHash)
+	require.Equal(t, content, fs.content.Get(copyA.ID()))
+	require.Equal(t, uint64(1), fs.ContentDedupHits())
+
+	// Local edits to the original go to a private copy.
+	_, err := fs.content.InsertStream(original.ID(), strings.NewReader("edited"))
+	require.NoError(t, err)
+	require.Equal(t, content, fs.content.Get(copyA.ID()))
+
+	_, _, ok = fs.hydrateFromLocalCopy(copyB.ID(), copyB)
+	require.False(t, ok, "the diverged original no longer satisfies the hash")
+	require.Empty(t, fs.contentCandidates(sharedContentKey(hash, uint64(len(content))), ""),
+		"the diverged original is dropped from the index")
+
+	fs.indexContent(copyA.ID(), hash, uint64(len(content)))
+	_, _, ok = fs.hydrateFromLocalCopy(copyB.ID(), copyB)
+	require.True(t, ok)
+	require.Equal(t, content, fs.content.Get(copyB.ID()))
+}
+
+func TestUT_FS_ContentDedup_NoCopyWithoutMatchingContent(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+
+	file := NewInode("lonely.txt", fuse.S_IFREG|0644, nil)
+	file.DriveItem.ID = "lonely"
+	file.DriveItem.Size = 5
+	file.DriveItem.File = &graph.File{Hashes: graph.Hashes{QuickXorHash: "AAAAAAAAAAAAAAAAAAAAAAAAAAA="}}
+	registerHydratedEntry(t, fs, file)
+
+	_, _, ok := fs.hydrateFromLocalCopy(file.ID(), file)
+	require.False(t, ok)
+	require.False(t, fs.content.HasContent(file.ID()))
+}
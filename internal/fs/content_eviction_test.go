@@ -162,3 +162,49 @@ func TestUT_FS_ContentEviction_TransitionsToGhost(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, metadata.ItemStateGhost, entry.State, "evicted content should mark entry ghost")
 }
+
+func TestUT_FS_ContentEviction_ExemptPathNotEvicted(t *testing.T) {
+	fs := setupEvictionTestFS(t, 10)
+	require.NoError(t, fs.SetEvictionExemptions([]string{"**/projects/**"}))
+
+	parent := NewInode("Projects", fuse.S_IFDIR|0755, nil)
+	parent.DriveItem.ID = "parent-projects"
+	registerHydratedEntry(t, fs, parent)
+
+	exempt := NewInode("plan.txt", fuse.S_IFREG|0644, parent)
+	exempt.DriveItem.ID = "file-exempt"
+	registerHydratedEntry(t, fs, exempt)
+	require.NoError(t, fs.content.Insert(exempt.ID(), []byte("123456")))
+
+	other := NewInode("other.txt", fuse.S_IFREG|0644, nil)
+	other.DriveItem.ID = "file-other-exempt"
+	registerHydratedEntry(t, fs, other)
+
+	insertErr := fs.content.Insert(other.ID(), []byte("abcdef"))
+	require.Error(t, insertErr, "eviction should fail when only exempt content is available")
+
+	_, statErr := os.Stat(fs.content.contentPath(exempt.ID()))
+	require.NoError(t, statErr, "exempt file should remain in cache")
+
+	count, size := fs.exemptedContentBytes()
+	require.Equal(t, 1, count)
+	require.Equal(t, int64(6), size)
+}
+
+func TestUT_FS_ContentEviction_ExemptionPatternMatching(t *testing.T) {
+	exemption, err := compileEvictionExemption("Documents/Projects/**")
+	require.NoError(t, err)
+	require.True(t, exemption.matches("/Documents/Projects"))
+	require.True(t, exemption.matches("/documents/projects/a/b/c.txt"))
+	require.False(t, exemption.matches("/Documents/Other/c.txt"))
+
+	exemption, err = compileEvictionExemption("Photos/*.raw")
+	require.NoError(t, err)
+	require.True(t, exemption.matches("/Photos/IMG_1.RAW"))
+	require.False(t, exemption.matches("/Photos/2024/IMG_1.raw"))
+
+	_, err = compileEvictionExemption("Bad/[")
+	require.Error(t, err)
+	_, err = compileEvictionExemption("  / ")
+	require.Error(t, err)
+}
@@ -0,0 +1,373 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// A crash report is a tar.gz written to the crashes directory of the mount's
+// cache directory when the mount panics. It holds the panic, a dump of every
+// goroutine, the recent events, the upload and offline queues and checksums
+// of the configuration and executable, redacted like a support bundle. Every
+// crash increments a counter kept next to the reports, shown by "onemount
+// doctor".
+//
+// Panics are caught in the mount's own long-running goroutines. Anything else
+// that kills the process, such as a panic while serving a request or a fatal
+// runtime error, is written by the runtime to crashOutputName and turned into
+// a crash report when the drive is mounted again; its queues are then those
+// found at that mount. The runtime has one crash output per process, so the
+// mounts of a multi-mount process share the file of the first of them, which
+// lists the crashes directories of all of them ahead of the crash. The mount
+// finding a crash in it hands the crash to the other mounts listed.
+
+// CrashDirName is the directory in a mount's cache directory holding its
+// crash reports.
+const CrashDirName = "crashes"
+
+const (
+	crashCounterName     = "crash-count.json"
+	crashOutputName      = "crash-output.txt"
+	crashReportsRetained = 10
+	crashPartTimeout     = 2 * time.Second
+)
+
+// crashOutputMountPrefix starts the lines of a crash output file naming the
+// crashes directory of a mount writing to it.
+const crashOutputMountPrefix = "mount: "
+
+// processCrashOutput is the crash output file of the process and the mounts
+// writing to it, by crashes directory.
+var processCrashOutput struct {
+	sync.Mutex
+	path   string
+	mounts map[string]*Filesystem
+}
+
+// CrashSummary is the persisted crash counter of a mount.
+type CrashSummary struct {
+	Count      int       `json:"count"`
+	Last       time.Time `json:"last,omitempty"`
+	LastReason string    `json:"last_reason,omitempty"`
+	LastReport string    `json:"last_report,omitempty"` // file name in the crashes directory
+}
+
+// crashDir is where the mount's crash reports are written.
+func (f *Filesystem) crashDir() string {
+	return filepath.Join(f.cacheDir(), CrashDirName)
+}
+
+// ReadCrashSummary returns the crash counter of the mount whose cache
+// directory is cacheDir. A mount that never crashed has a zero summary.
+func ReadCrashSummary(cacheDir string) (CrashSummary, error) {
+	var summary CrashSummary
+	data, err := os.ReadFile(filepath.Join(cacheDir, CrashDirName, crashCounterName))
+	if errors.Is(err, os.ErrNotExist) {
+		return summary, nil
+	}
+	if err != nil {
+		return summary, err
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return summary, fmt.Errorf("crash counter: %w", err)
+	}
+	return summary, nil
+}
+
+// CrashReports lists the crash reports kept in the cache directory cacheDir,
+// oldest first.
+func CrashReports(cacheDir string) ([]string, error) {
+	reports, err := filepath.Glob(filepath.Join(cacheDir, CrashDirName, "crash-*.tar.gz"))
+	sort.Strings(reports)
+	return reports, err
+}
+
+// StartCrashReporting turns the crash output of a previous run into a crash
+// report and has the runtime write the output of fatal crashes of this run
+// to the crashes directory.
+func (f *Filesystem) StartCrashReporting() {
+	dir := f.crashDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		logging.Warn().Err(err).Msg("Failed to create the crash report directory")
+		return
+	}
+	f.collectCrashOutput()
+
+	p := &processCrashOutput
+	p.Lock()
+	defer p.Unlock()
+	if p.path == "" {
+		output, err := os.OpenFile(filepath.Join(dir, crashOutputName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			logging.Warn().Err(err).Msg("Failed to open the crash output file")
+			return
+		}
+		debug.SetTraceback("all")
+		err = debug.SetCrashOutput(output, debug.CrashOptions{})
+		// The runtime keeps its own duplicate of the descriptor
+		output.Close()
+		if err != nil {
+			logging.Warn().Err(err).Msg("Failed to redirect crash output")
+			return
+		}
+		p.path = output.Name()
+	}
+	output, err := os.OpenFile(p.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		logging.Warn().Err(err).Msg("Failed to open the crash output file")
+		return
+	}
+	_, err = fmt.Fprintf(output, "%s%s\n", crashOutputMountPrefix, dir)
+	output.Close()
+	if err != nil {
+		logging.Warn().Err(err).Msg("Failed to list the mount in the crash output file")
+	}
+	if p.mounts == nil {
+		p.mounts = make(map[string]*Filesystem)
+	}
+	p.mounts[dir] = f
+	context.AfterFunc(f.ctx, func() {
+		p.Lock()
+		defer p.Unlock()
+		if p.mounts[dir] == f {
+			delete(p.mounts, dir)
+		}
+	})
+}
+
+// collectCrashOutput turns the runtime's output of a crash in a previous run
+// into a crash report.
+func (f *Filesystem) collectCrashOutput() {
+	outputPath := filepath.Join(f.crashDir(), crashOutputName)
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		return
+	}
+	mounts, crash := splitCrashOutput(output)
+	if len(bytes.TrimSpace(crash)) == 0 {
+		return
+	}
+	reason := "crashed in a previous run: " + crashOutputReason(crash)
+	for _, dir := range mounts {
+		if dir != f.crashDir() {
+			handOverCrash(dir, reason, crash)
+		}
+	}
+	if report, err := f.ReportCrash(reason, output); err == nil {
+		logging.Warn().Str("report", report).Msg("The previous run of this mount crashed")
+		if err := os.Truncate(outputPath, 0); err != nil {
+			logging.Warn().Err(err).Msg("Failed to clear the crash output file")
+		}
+	}
+}
+
+// splitCrashOutput splits a crash output file into the crashes directories
+// of the mounts writing to it and the runtime's output.
+func splitCrashOutput(output []byte) (mounts []string, crash []byte) {
+	for {
+		line, rest, found := bytes.Cut(output, []byte("\n"))
+		dir, listed := bytes.CutPrefix(line, []byte(crashOutputMountPrefix))
+		if !found || !listed {
+			return mounts, output
+		}
+		mounts = append(mounts, string(dir))
+		output = rest
+	}
+}
+
+// handOverCrash reports a crash of a multi-mount process to another of its
+// mounts, whose crashes directory is dir: right away when the mount runs in
+// this process, and otherwise when it is mounted next.
+func handOverCrash(dir, reason string, crash []byte) {
+	p := &processCrashOutput
+	p.Lock()
+	mount := p.mounts[dir]
+	p.Unlock()
+	if mount != nil {
+		_, _ = mount.ReportCrash(reason, crash)
+		return
+	}
+	output, err := os.OpenFile(filepath.Join(dir, crashOutputName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		logging.Debug().Err(err).Str("dir", dir).Msg("Failed to hand a crash to another mount")
+		return
+	}
+	defer output.Close()
+	if _, err := output.Write(crash); err != nil {
+		logging.Debug().Err(err).Str("dir", dir).Msg("Failed to hand a crash to another mount")
+	}
+}
+
+// crashOutputReason picks the panic or fatal error message out of the
+// runtime's crash output.
+func crashOutputReason(output []byte) string {
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") {
+			return strings.TrimSpace(line)
+		}
+	}
+	return "unknown error"
+}
+
+// RecoverCrash writes a crash report when the goroutine it is deferred in
+// panics, then panics again. where names the goroutine.
+func (f *Filesystem) RecoverCrash(where string) {
+	if r := recover(); r != nil {
+		f.ReportCrash(fmt.Sprintf("panic in %s: %v", where, r), debug.Stack())
+		panic(r)
+	}
+}
+
+// ReportCrash writes a crash report with the given reason and stack, counts
+// the crash and returns the report's path.
+func (f *Filesystem) ReportCrash(reason string, stack []byte) (string, error) {
+	now := time.Now()
+	dir := f.crashDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	name := "crash-" + now.UTC().Format("20060102T150405.000") + ".tar.gz"
+	target := filepath.Join(dir, name)
+
+	f.supportM.RLock()
+	sources := f.supportSources
+	f.supportM.RUnlock()
+
+	var buf bytes.Buffer
+	err := writeSupportArchive(&buf, strings.TrimSuffix(name, ".tar.gz"), []supportFile{
+		{"crash.txt", func() ([]byte, error) {
+			return []byte(fmt.Sprintf("time: %s\nreason: %s\n\n%s", now.Format(time.RFC3339),
+				redactSecrets(reason), redactSecrets(string(stack)))), nil
+		}},
+		{"goroutines.txt", func() ([]byte, error) { return []byte(redactSecrets(string(goroutineDump()))), nil }},
+		{"events.json", crashPart(func() ([]byte, error) { return json.MarshalIndent(f.crashEvents(), "", "  ") })},
+		{"queues.json", crashPart(func() ([]byte, error) {
+			queues, _ := f.supportSnapshot()
+			return json.MarshalIndent(queues, "", "  ")
+		})},
+		{"checksums.json", crashPart(func() ([]byte, error) {
+			return json.MarshalIndent(crashChecksums(sources.Config), "", "  ")
+		})},
+	})
+	if err == nil {
+		err = os.WriteFile(target, buf.Bytes(), 0600)
+	}
+	if err != nil {
+		logging.Error().Err(err).Str("reason", reason).Msg("Failed to write a crash report")
+		return "", err
+	}
+
+	summary, _ := ReadCrashSummary(f.cacheDir())
+	summary.Count++
+	summary.Last = now
+	summary.LastReason = redactSecrets(reason)
+	summary.LastReport = name
+	if data, err := json.MarshalIndent(summary, "", "  "); err == nil {
+		if err := os.WriteFile(filepath.Join(dir, crashCounterName), data, 0600); err != nil {
+			logging.Warn().Err(err).Msg("Failed to update the crash counter")
+		}
+	}
+	pruneCrashReports(f.cacheDir())
+	logging.Error().Str("reason", reason).Str("report", target).Int("crashes", summary.Count).Msg("Wrote a crash report")
+	return target, nil
+}
+
+// crashPart gives up on a part of a crash report that does not finish in
+// time, since the crash may have left a lock it needs held.
+func crashPart(fn func() ([]byte, error)) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		type result struct {
+			data []byte
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					done <- result{err: fmt.Errorf("panic: %v", r)}
+				}
+			}()
+			data, err := fn()
+			done <- result{data, err}
+		}()
+		select {
+		case r := <-done:
+			return r.data, r.err
+		case <-time.After(crashPartTimeout):
+			return nil, fmt.Errorf("timed out after %s", crashPartTimeout)
+		}
+	}
+}
+
+// goroutineDump returns the stacks of every goroutine.
+func goroutineDump() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// crashEvents returns the recent events with their paths sanitized.
+func (f *Filesystem) crashEvents() []ActivityEvent {
+	events := f.RecentEvents(0)
+	for i := range events {
+		events[i].Path = sanitizePath(events[i].Path)
+		events[i].Message = redactSecrets(events[i].Message)
+	}
+	return events
+}
+
+// crashChecksums identifies the configuration and build that crashed.
+func crashChecksums(config []byte) map[string]string {
+	sum := sha256.Sum256(config)
+	checksums := map[string]string{
+		"config.yml": hex.EncodeToString(sum[:]),
+		"go":         runtime.Version(),
+	}
+	if exe, err := os.Executable(); err == nil {
+		if file, err := os.Open(exe); err == nil {
+			hash := sha256.New()
+			if _, err := io.Copy(hash, file); err == nil {
+				checksums["executable"] = hex.EncodeToString(hash.Sum(nil))
+			}
+			file.Close()
+		}
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		checksums["module"] = info.Main.Version
+	}
+	return checksums
+}
+
+// pruneCrashReports removes all but the newest crashReportsRetained reports.
+func pruneCrashReports(cacheDir string) {
+	reports, err := CrashReports(cacheDir)
+	if err != nil || len(reports) <= crashReportsRetained {
+		return
+	}
+	for _, report := range reports[:len(reports)-crashReportsRetained] {
+		if err := os.Remove(report); err != nil {
+			logging.Warn().Err(err).Str("report", report).Msg("Failed to remove an old crash report")
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package fs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readCrashReport returns the files of a crash report by name.
+func readCrashReport(t *testing.T, report string) map[string]string {
+	t.Helper()
+	file, err := os.Open(report)
+	require.NoError(t, err)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[filepath.Base(header.Name)] = string(data)
+	}
+}
+
+func TestUT_FS_CrashReport_RecoverCrashReportsAndPanicsAgain(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.SetSupportBundleSources(SupportBundleSources{Config: []byte("log: debug\n")})
+	fs.emitActivity(ActivityUploaded, "", "Uploaded")
+
+	require.PanicsWithValue(t, "access_token=abc boom", func() {
+		defer fs.RecoverCrash("test worker")
+		panic("access_token=abc boom")
+	})
+
+	summary, err := ReadCrashSummary(fs.cacheDir())
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Count)
+	require.Equal(t, "panic in test worker: access_token=[REDACTED] boom", summary.LastReason)
+	reports, err := CrashReports(fs.cacheDir())
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	require.Equal(t, summary.LastReport, filepath.Base(reports[0]))
+
+	files := readCrashReport(t, reports[0])
+	require.Contains(t, files["crash.txt"], "panic in test worker")
+	require.NotContains(t, files["crash.txt"], "abc")
+	require.Contains(t, files["goroutines.txt"], "TestUT_FS_CrashReport_RecoverCrashReportsAndPanicsAgain")
+	require.Contains(t, files["events.json"], ActivityUploaded)
+	require.Contains(t, files["queues.json"], "uploads")
+	require.Contains(t, files["checksums.json"], "config.yml")
+}
+
+func TestUT_FS_CrashReport_CountsAndPrunes(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	summary, err := ReadCrashSummary(fs.cacheDir())
+	require.NoError(t, err)
+	require.Zero(t, summary.Count)
+
+	for i := 0; i < crashReportsRetained+2; i++ {
+		_, err := fs.ReportCrash("panic", nil)
+		require.NoError(t, err)
+	}
+	summary, err = ReadCrashSummary(fs.cacheDir())
+	require.NoError(t, err)
+	require.Equal(t, crashReportsRetained+2, summary.Count, "pruned reports still count")
+	reports, err := CrashReports(fs.cacheDir())
+	require.NoError(t, err)
+	require.Len(t, reports, crashReportsRetained)
+}
+
+func TestUT_FS_CrashReport_CollectsPreviousCrashOutput(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	require.NoError(t, os.MkdirAll(fs.crashDir(), 0700))
+	output := "panic: runtime error: index out of range [3] with length 2\n\ngoroutine 42 [running]:\nmain.main()\n"
+	outputPath := filepath.Join(fs.crashDir(), crashOutputName)
+	require.NoError(t, os.WriteFile(outputPath, []byte(output), 0600))
+
+	fs.collectCrashOutput()
+
+	summary, err := ReadCrashSummary(fs.cacheDir())
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Count)
+	require.Equal(t, "crashed in a previous run: panic: runtime error: index out of range [3] with length 2", summary.LastReason)
+	files := readCrashReport(t, filepath.Join(fs.crashDir(), summary.LastReport))
+	require.True(t, strings.HasSuffix(files["crash.txt"], output))
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	require.Empty(t, data, "a crash is reported once")
+	fs.collectCrashOutput()
+	summary, err = ReadCrashSummary(fs.cacheDir())
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Count)
+}
+
+func TestUT_FS_CrashReport_HandsProcessCrashToEveryMount(t *testing.T) {
+	first := newTestFilesystemWithMetadata(t)
+	second := newTestFilesystemWithMetadata(t)
+	for _, fs := range []*Filesystem{first, second} {
+		require.NoError(t, os.MkdirAll(fs.crashDir(), 0700))
+	}
+	crash := "fatal error: concurrent map writes\n\ngoroutine 7 [running]:\n"
+	output := crashOutputMountPrefix + first.crashDir() + "\n" + crashOutputMountPrefix + second.crashDir() + "\n" + crash
+	require.NoError(t, os.WriteFile(filepath.Join(first.crashDir(), crashOutputName), []byte(output), 0600))
+
+	first.collectCrashOutput()
+	summary, err := ReadCrashSummary(first.cacheDir())
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Count)
+	require.Equal(t, "crashed in a previous run: fatal error: concurrent map writes", summary.LastReason)
+
+	// The other mount of the process reports the crash when it is mounted
+	handed, err := os.ReadFile(filepath.Join(second.crashDir(), crashOutputName))
+	require.NoError(t, err)
+	require.Equal(t, crash, string(handed))
+	second.collectCrashOutput()
+	summary, err = ReadCrashSummary(second.cacheDir())
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Count)
+	require.Equal(t, "crashed in a previous run: fatal error: concurrent map writes", summary.LastReason)
+
+	// A file only listing the mounts of a process that did not crash
+	require.NoError(t, os.WriteFile(filepath.Join(first.crashDir(), crashOutputName),
+		[]byte(crashOutputMountPrefix+first.crashDir()+"\n"), 0600))
+	first.collectCrashOutput()
+	summary, err = ReadCrashSummary(first.cacheDir())
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Count)
+}
@@ -0,0 +1,388 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/godbus/dbus/v5"
+)
+
+// Moving an item to another OneMount mount, e.g. from a personal drive to a
+// work drive, makes the kernel copy every file through both mounts and then
+// delete the original: the source mount downloads the whole tree into its
+// cache before the other mount uploads it again. "onemount move" runs such
+// a move as a JobMove job of the source mount instead. When both mounts are
+// signed in to the same account OneDrive copies the item on the server.
+// Otherwise the files are streamed into the other mount, from the cache when
+// they are cached and straight from OneDrive, without filling the cache,
+// when they are not. Writing a file into the other mount only queues its
+// upload there, so the original is deleted from OneDrive once the other mount
+// confirmed, through the SyncNow method of its D-Bus service, that every
+// streamed file is on OneDrive. A failed or cancelled transfer removes what
+// was written to the other mount and keeps the original; a server-side copy
+// cannot be stopped, so cancelling one only stops waiting for it. Changes
+// made below the item during the transfer are not in the copy, so the
+// original is only deleted when there are none once the copy is done.
+//
+// A rename from one mount into another never reaches either of them: the
+// kernel refuses it and "mv" or the file manager copy and delete the files
+// themselves. Moves between mounts are therefore only recognized when they
+// are made with "onemount move", which finds both mounts from their D-Bus
+// services.
+
+// moveCopyPollInterval is how often the monitor of a server-side copy is
+// asked how far the copy got.
+const moveCopyPollInterval = time.Second
+
+// MoveTarget is a folder of a mount that items are moved into from another
+// mount.
+type MoveTarget struct {
+	Account    string // the account the mount is signed in to
+	DriveID    string
+	FolderID   string
+	Mountpoint string // where the mount is mounted, its D-Bus service confirms streamed uploads
+}
+
+// moveRemote is the subset of the Graph API used to move items to another
+// mount, and the other mount confirming the uploads of the files streamed
+// into it. Tests substitute a fake.
+type moveRemote interface {
+	GetItem(ctx context.Context, id string) (*graph.DriveItem, error)
+	Copy(ctx context.Context, id string, target MoveTarget, name string) (string, error)
+	CopyStatus(ctx context.Context, monitor string) (graph.CopyStatus, error)
+	Download(ctx context.Context, id string, w io.Writer) error
+	Remove(ctx context.Context, id string) error
+	ConfirmUploads(ctx context.Context, mountpoint string, paths []string) error
+}
+
+// graphMoveRemote forwards move calls to the Graph API.
+type graphMoveRemote struct {
+	auth   *graph.Auth
+	chunks graph.ChunkSizer
+}
+
+func (c graphMoveRemote) GetItem(ctx context.Context, id string) (*graph.DriveItem, error) {
+	return graph.GetItemWithContext(ctx, id, c.auth)
+}
+
+func (c graphMoveRemote) Copy(ctx context.Context, id string, target MoveTarget, name string) (string, error) {
+	return graph.CopyItem(ctx, id, target.DriveID, target.FolderID, name, c.auth)
+}
+
+func (c graphMoveRemote) CopyStatus(ctx context.Context, monitor string) (graph.CopyStatus, error) {
+	return graph.GetCopyStatus(ctx, monitor)
+}
+
+func (c graphMoveRemote) Download(ctx context.Context, id string, w io.Writer) error {
+	_, err := graph.GetItemContentStreamChunkedWithContext(ctx, id, c.auth, w, c.chunks)
+	return err
+}
+
+func (c graphMoveRemote) Remove(ctx context.Context, id string) error {
+	return graph.RemoveWithContext(ctx, id, c.auth)
+}
+
+// ConfirmUploads asks the mount at mountpoint to sync each of the files at
+// paths, absolute paths in that mount, which returns once OneDrive has them.
+func (c graphMoveRemote) ConfirmUploads(ctx context.Context, mountpoint string, paths []string) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return errors.Wrap(err, "failed to reach the other mount")
+	}
+	defer conn.Close()
+	obj := conn.Object(DBusServiceNameForMount(mountpoint), DBusObjectPath)
+	for _, path := range paths {
+		rel, err := filepath.Rel(mountpoint, path)
+		if err != nil {
+			return err
+		}
+		var result string
+		if err := obj.CallWithContext(ctx, DBusInterface+".SyncNow", 0, "/"+filepath.ToSlash(rel)).Store(&result); err != nil {
+			return errors.Wrap(err, "the other mount did not upload "+path)
+		}
+	}
+	return nil
+}
+
+func (f *Filesystem) moveRemote() moveRemote {
+	return graphMoveRemote{auth: f.auth, chunks: f.transferChunks(chunkDownload)}
+}
+
+// account returns the account the mount is signed in to, "" when unknown.
+func (f *Filesystem) account() string {
+	if f.auth == nil {
+		return ""
+	}
+	return f.auth.Account
+}
+
+// MoveTarget describes the folder at path as the destination of items moved
+// from another mount.
+func (f *Filesystem) MoveTarget(ctx context.Context, path string) (MoveTarget, error) {
+	return f.moveTarget(ctx, path, f.moveRemote())
+}
+
+func (f *Filesystem) moveTarget(ctx context.Context, path string, remote moveRemote) (MoveTarget, error) {
+	id := f.GetIDByPath(path)
+	if id == "" {
+		return MoveTarget{}, errors.NewNotFoundError("path not found: "+path, nil)
+	}
+	if inode := f.GetID(id); inode == nil || !inode.IsDir() || inode.IsPackage() {
+		return MoveTarget{}, errors.NewValidationError(path+" is not a folder", nil)
+	}
+	if isLocalID(id) {
+		return MoveTarget{}, errors.NewValidationError(path+" is not on OneDrive yet", nil)
+	}
+	item, err := remote.GetItem(ctx, id)
+	if err != nil {
+		return MoveTarget{}, err
+	}
+	if item.Parent == nil || item.Parent.DriveID == "" {
+		return MoveTarget{}, errors.New("OneDrive did not say which drive holds " + path)
+	}
+	return MoveTarget{Account: f.account(), DriveID: item.Parent.DriveID, FolderID: item.ID}, nil
+}
+
+// MoveToMount starts a job moving the item with the given ID into the
+// folder target of another mount, as name. destination is the path the item
+// gets in the other mount, where it is streamed when OneDrive cannot copy it.
+// It returns the job ID; a move of the same item already running is reused.
+func (f *Filesystem) MoveToMount(id string, target MoveTarget, name, destination string) (string, error) {
+	return f.startMoveJob(id, target, name, destination, f.moveRemote())
+}
+
+func (f *Filesystem) startMoveJob(id string, target MoveTarget, name, destination string, remote moveRemote) (string, error) {
+	inode := f.GetID(id)
+	if inode == nil {
+		return "", errors.NewNotFoundError("item not found", nil)
+	}
+	if inode.ParentID() == "" {
+		return "", errors.NewValidationError("the root of a mount cannot be moved", nil)
+	}
+	if f.hasLocalChangesBelow(id) {
+		return "", errors.NewConflictError(inode.Path()+" has changes that are not uploaded yet", nil)
+	}
+	job := f.startJob(JobMove, inode.Path(), JobMove+":"+id, func(ctx context.Context, job *Job) error {
+		return f.runMoveJob(ctx, job, id, target, name, destination, remote)
+	})
+	return job.ID(), nil
+}
+
+// runMoveJob copies the item to the other mount and deletes the original.
+func (f *Filesystem) runMoveJob(ctx context.Context, job *Job, id string, target MoveTarget, name, destination string, remote moveRemote) error {
+	inode := f.GetID(id)
+	if inode == nil {
+		return errors.NewNotFoundError("item not found", nil)
+	}
+	copied := false
+	if account := f.account(); account != "" && account == target.Account {
+		started, err := f.copyOnServer(ctx, job, inode, target, name, remote)
+		switch {
+		case err == nil:
+			copied = true
+		case started || ctx.Err() != nil:
+			return err
+		default:
+			logging.Warn().Err(err).Str("job", job.ID()).Str("path", inode.Path()).
+				Msg("OneDrive refused to copy the item, streaming it to the other mount instead")
+		}
+	}
+	if !copied {
+		if target.Mountpoint == "" {
+			return errors.NewValidationError("the other mount was not named, it could not confirm the transfer", nil)
+		}
+		if _, err := os.Lstat(destination); err == nil {
+			return errors.NewConflictError(destination+" already exists", nil)
+		}
+		job.SetPhase("transferring")
+		var files []string
+		err := f.streamItem(ctx, job, id, destination, remote, &files)
+		if err == nil {
+			// Until the other mount uploaded them, its cache holds the only copy
+			job.SetPhase("confirming")
+			err = remote.ConfirmUploads(ctx, target.Mountpoint, files)
+		}
+		if err != nil {
+			if removeErr := os.RemoveAll(destination); removeErr != nil {
+				logging.Warn().Err(removeErr).Str("destination", destination).
+					Msg("Failed to remove the partial copy of a move")
+			}
+			return err
+		}
+	}
+
+	// Files may have been written while the item was transferred; those
+	// writes are not in the copy, so the original is kept
+	if f.hasLocalChangesBelow(id) {
+		if copied {
+			return errors.NewConflictError(inode.Path()+" changed while it was copied, the copy in the other mount "+
+				"was kept and so was the original", nil)
+		}
+		if err := os.RemoveAll(destination); err != nil {
+			logging.Warn().Err(err).Str("destination", destination).
+				Msg("Failed to remove the outdated copy of a move")
+		}
+		return errors.NewConflictError(inode.Path()+" changed while it was transferred, the original was kept", nil)
+	}
+
+	job.SetPhase("deleting")
+	if err := remote.Remove(ctx, id); err != nil {
+		return errors.Wrap(err, "copied to "+destination+" but could not delete the original")
+	}
+	f.forgetMovedItem(id)
+	return nil
+}
+
+// copyOnServer has OneDrive copy the item into target and waits for the copy
+// to finish. started is false when OneDrive refused to start the copy.
+func (f *Filesystem) copyOnServer(ctx context.Context, job *Job, inode *Inode, target MoveTarget, name string, remote moveRemote) (started bool, err error) {
+	job.SetPhase("copying")
+	monitor, err := remote.Copy(ctx, inode.ID(), target, name)
+	if err != nil {
+		return false, err
+	}
+	size := inode.Size()
+	job.AddTotal(1, size)
+
+	var done uint64
+	ticker := time.NewTicker(moveCopyPollInterval)
+	defer ticker.Stop()
+	for {
+		status, err := remote.CopyStatus(ctx, monitor)
+		if err != nil {
+			return true, errors.Wrap(err, "failed to follow the copy of "+inode.Path())
+		}
+		switch status.Status {
+		case graph.CopyCompleted:
+			job.Advance(1, size-done)
+			return true, nil
+		case graph.CopyFailed:
+			message := "OneDrive could not copy " + inode.Path()
+			if status.Error != nil {
+				message += ": " + status.Error.Message
+			}
+			return true, errors.New(message)
+		}
+		if now := uint64(status.PercentageComplete / 100 * float64(size)); now > done && now <= size {
+			job.Advance(0, now-done)
+			done = now
+		}
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// streamItem writes the item and everything below it to destination, a path
+// in the other mount, and adds the paths of the files it wrote to files.
+func (f *Filesystem) streamItem(ctx context.Context, job *Job, id, destination string, remote moveRemote, files *[]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	inode := f.GetID(id)
+	if inode == nil {
+		return errors.NewNotFoundError("item not found", nil)
+	}
+	if inode.IsPackage() {
+		return errors.NewValidationError(inode.Path()+" is a package, which can only be moved within an account", nil)
+	}
+	if !inode.IsDir() {
+		job.AddTotal(1, inode.Size())
+		if err := f.streamFile(ctx, job, inode, destination, remote); err != nil {
+			return errors.Wrap(err, "failed to transfer "+inode.Path())
+		}
+		*files = append(*files, destination)
+		job.Advance(1, 0)
+		return nil
+	}
+
+	job.AddTotal(1, 0)
+	if err := os.Mkdir(destination, 0755); err != nil {
+		return err
+	}
+	children, err := f.GetChildrenID(id, f.auth)
+	if err != nil {
+		return errors.Wrap(err, "failed to list "+inode.Path())
+	}
+	for _, child := range children {
+		if err := f.streamItem(ctx, job, child.ID(), filepath.Join(destination, child.Name()), remote, files); err != nil {
+			return err
+		}
+	}
+	job.Advance(1, 0)
+	return nil
+}
+
+// streamFile writes the content of the file to destination, from the cache
+// when it is cached and from OneDrive otherwise.
+func (f *Filesystem) streamFile(ctx context.Context, job *Job, inode *Inode, destination string, remote moveRemote) error {
+	id := inode.ID()
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w := jobProgressWriter{w: out, job: job}
+	if f.hasLocalContent(id) {
+		var fd *os.File
+		if fd, err = f.content.OpenUntouched(id); err == nil {
+			// the descriptor is shared with open handles, leave its offset alone
+			_, err = io.Copy(w, io.NewSectionReader(fd, 0, int64(inode.Size())))
+		}
+	} else {
+		err = remote.Download(ctx, id, w)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// jobProgressWriter counts the bytes written as done by the job.
+type jobProgressWriter struct {
+	w   io.Writer
+	job *Job
+}
+
+func (p jobProgressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.job.Advance(0, uint64(n))
+	return n, err
+}
+
+// forgetMovedItem removes the item, moved away and deleted from OneDrive,
+// from the mount. DeleteID cancels the uploads queued for anything below it.
+func (f *Filesystem) forgetMovedItem(id string) {
+	inode := f.GetID(id)
+	if inode == nil {
+		return
+	}
+	parentID, name := inode.ParentID(), inode.Name()
+	var ids []string
+	pending := []string{id}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		ids = append(ids, current)
+		if child := f.GetID(current); child != nil {
+			pending = append(pending, child.GetChildren()...)
+		}
+	}
+
+	_ = f.removeChildFromParent(context.Background(), parentID, id, inode.IsDir())
+	f.markEntryDeleted(id)
+	f.DeleteID(id)
+	for _, gone := range ids {
+		if err := f.content.Delete(gone); err != nil {
+			logging.Debug().Err(err).Str("id", gone).Msg("Failed to delete the content of a moved item")
+		}
+	}
+	f.notifyEntryChanged(parentID, name)
+}
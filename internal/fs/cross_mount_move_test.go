@@ -0,0 +1,252 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMoveRemote records the calls of a move. Copies are refused unless
+// monitor is set.
+type fakeMoveRemote struct {
+	mu         sync.Mutex
+	monitor    string
+	statuses   []graph.CopyStatus
+	copied     []string
+	downloaded []string
+	removed    []string
+	confirmed  []string
+	unconfirm  error
+	onDownload func(id string) // called before a file is downloaded
+}
+
+func (r *fakeMoveRemote) GetItem(_ context.Context, id string) (*graph.DriveItem, error) {
+	return &graph.DriveItem{ID: "real-" + id, Parent: &graph.DriveItemParent{DriveID: "drive-b"}}, nil
+}
+
+func (r *fakeMoveRemote) Copy(_ context.Context, id string, target MoveTarget, name string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.monitor == "" {
+		return "", errors.NewAuthError("accessDenied", nil)
+	}
+	r.copied = append(r.copied, id+" -> "+target.DriveID+"/"+target.FolderID+"/"+name)
+	return r.monitor, nil
+}
+
+func (r *fakeMoveRemote) CopyStatus(context.Context, string) (graph.CopyStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.statuses[0]
+	if len(r.statuses) > 1 {
+		r.statuses = r.statuses[1:]
+	}
+	return status, nil
+}
+
+func (r *fakeMoveRemote) Download(_ context.Context, id string, w io.Writer) error {
+	if r.onDownload != nil {
+		r.onDownload(id)
+	}
+	r.mu.Lock()
+	r.downloaded = append(r.downloaded, id)
+	r.mu.Unlock()
+	_, err := io.WriteString(w, "remote "+id)
+	return err
+}
+
+func (r *fakeMoveRemote) Remove(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removed = append(r.removed, id)
+	return nil
+}
+
+func (r *fakeMoveRemote) ConfirmUploads(_ context.Context, mountpoint string, paths []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.unconfirm != nil {
+		return r.unconfirm
+	}
+	for _, path := range paths {
+		rel, _ := filepath.Rel(mountpoint, path)
+		r.confirmed = append(r.confirmed, rel)
+	}
+	return nil
+}
+
+// seedMoveTree creates /docs/{a.txt (cached), sub/b.txt} for account
+// alice@example.com.
+func seedMoveTree(t *testing.T, fs *Filesystem) {
+	t.Helper()
+	fs.auth = &graph.Auth{Account: "alice@example.com"}
+	fs.uploads.deletionQueue = make(chan string, 8) // deletes cancel uploads
+	root := NewInode("root", fuse.S_IFDIR|0755, nil)
+	root.DriveItem.ID = "root"
+	registerHydratedEntry(t, fs, root)
+	fs.root = root.ID()
+
+	for _, item := range []*graph.DriveItem{
+		{ID: "docs", Name: "docs", Parent: &graph.DriveItemParent{ID: "root"}, Folder: &graph.Folder{}},
+		{ID: "a", Name: "a.txt", Size: 12, Parent: &graph.DriveItemParent{ID: "docs"}, File: &graph.File{}},
+		{ID: "sub", Name: "sub", Parent: &graph.DriveItemParent{ID: "docs"}, Folder: &graph.Folder{}},
+		{ID: "b", Name: "b.txt", Size: 8, Parent: &graph.DriveItemParent{ID: "sub"}, File: &graph.File{}},
+	} {
+		inode := NewInodeDriveItem(item)
+		registerHydratedEntry(t, fs, inode)
+		fs.InsertChild(item.Parent.ID, inode)
+	}
+	require.NoError(t, fs.content.Insert("a", []byte("cached a.txt")))
+	fs.transitionItemState("a", metadata.ItemStateHydrating)
+	fs.transitionItemState("a", metadata.ItemStateHydrated)
+}
+
+func TestUT_FS_CrossMountMove_CopiesOnServerWithinAnAccount(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	seedMoveTree(t, fs)
+	remote := &fakeMoveRemote{monitor: "https://monitor/1", statuses: []graph.CopyStatus{{Status: graph.CopyCompleted}}}
+
+	target, err := fs.moveTarget(context.Background(), "/", remote)
+	require.NoError(t, err)
+	require.Equal(t, MoveTarget{Account: "alice@example.com", DriveID: "drive-b", FolderID: "real-root"}, target)
+	_, err = fs.moveTarget(context.Background(), "/docs/a.txt", remote)
+	require.Error(t, err, "items are moved into folders")
+
+	destination := filepath.Join(t.TempDir(), "docs")
+	jobID, err := fs.startMoveJob("docs", target, "docs", destination, remote)
+	require.NoError(t, err)
+	info := waitForJob(t, fs, jobID)
+	require.Equal(t, JobCompleted, info.State, info.Error)
+	require.Equal(t, JobMove, info.Kind)
+
+	require.Equal(t, []string{"docs -> drive-b/real-root/docs"}, remote.copied)
+	require.Empty(t, remote.downloaded, "nothing goes through this machine")
+	require.NoDirExists(t, destination)
+	require.Equal(t, []string{"docs"}, remote.removed)
+	require.Nil(t, fs.GetID("docs"))
+	require.Empty(t, fs.GetID("root").GetChildren())
+	require.False(t, fs.content.HasContent("a"))
+}
+
+func TestUT_FS_CrossMountMove_StreamsBetweenAccounts(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	seedMoveTree(t, fs)
+	remote := &fakeMoveRemote{monitor: "https://monitor/1"}
+	mountpoint := t.TempDir()
+	target := MoveTarget{Account: "bob@example.com", DriveID: "drive-b", FolderID: "real-root", Mountpoint: mountpoint}
+
+	destination := filepath.Join(mountpoint, "moved")
+	jobID, err := fs.startMoveJob("docs", target, "moved", destination, remote)
+	require.NoError(t, err)
+	info := waitForJob(t, fs, jobID)
+	require.Equal(t, JobCompleted, info.State, info.Error)
+	require.Equal(t, uint64(4), info.Total)
+	require.Equal(t, uint64(4), info.Done)
+	require.Equal(t, uint64(20), info.BytesTotal)
+	require.Equal(t, uint64(20), info.BytesDone)
+
+	require.Empty(t, remote.copied, "another account cannot copy on the server")
+	require.Equal(t, []string{"b"}, remote.downloaded, "cached files are not downloaded again")
+	content, err := os.ReadFile(filepath.Join(destination, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "cached a.txt", string(content))
+	content, err = os.ReadFile(filepath.Join(destination, "sub", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "remote b", string(content))
+	require.False(t, fs.content.HasContent("b"), "streamed files do not fill the cache")
+	require.ElementsMatch(t, []string{"moved/a.txt", "moved/sub/b.txt"}, remote.confirmed,
+		"every streamed file is uploaded by the other mount before the original goes")
+	require.Equal(t, []string{"docs"}, remote.removed)
+	require.Nil(t, fs.GetID("docs"))
+}
+
+func TestUT_FS_CrossMountMove_KeepsTheOriginalWhenTheCopyFails(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	seedMoveTree(t, fs)
+	failed := graph.CopyStatus{Status: graph.CopyFailed}
+	remote := &fakeMoveRemote{monitor: "https://monitor/1", statuses: []graph.CopyStatus{{Status: "inProgress"}, failed}}
+	target := MoveTarget{Account: "alice@example.com", DriveID: "drive-b", FolderID: "real-root"}
+
+	jobID, err := fs.startMoveJob("a", target, "a.txt", filepath.Join(t.TempDir(), "a.txt"), remote)
+	require.NoError(t, err)
+	info := waitForJob(t, fs, jobID)
+	require.Equal(t, JobFailed, info.State)
+	require.True(t, strings.Contains(info.Error, "could not copy"), info.Error)
+	require.Empty(t, remote.removed)
+	require.NotNil(t, fs.GetID("a"))
+
+	existing := t.TempDir()
+	remote = &fakeMoveRemote{}
+	target.Account = "bob@example.com"
+	target.Mountpoint = filepath.Dir(existing)
+	jobID, err = fs.startMoveJob("docs", target, filepath.Base(existing), existing, remote)
+	require.NoError(t, err)
+	require.Equal(t, JobFailed, waitForJob(t, fs, jobID).State)
+	require.DirExists(t, existing, "what is already in the other mount is left alone")
+	require.Empty(t, remote.removed)
+
+	remote = &fakeMoveRemote{unconfirm: errors.New("upload failed")}
+	destination := filepath.Join(target.Mountpoint, "unconfirmed")
+	jobID, err = fs.startMoveJob("docs", target, "unconfirmed", destination, remote)
+	require.NoError(t, err)
+	info = waitForJob(t, fs, jobID)
+	require.Equal(t, JobFailed, info.State)
+	require.Empty(t, remote.removed, "the original stays until the other mount has uploaded the copy")
+	require.NoDirExists(t, destination)
+	require.NotNil(t, fs.GetID("docs"))
+
+	changed := fs.GetID("b")
+	changed.mu.Lock()
+	changed.hasChanges = true
+	changed.mu.Unlock()
+	_, err = fs.startMoveJob("docs", target, "docs", filepath.Join(t.TempDir(), "docs"), remote)
+	require.True(t, errors.IsConflictError(err), "changes are uploaded before moving")
+}
+
+func TestUT_FS_CrossMountMove_KeepsTheOriginalWhenWrittenDuringTheTransfer(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	seedMoveTree(t, fs)
+	mountpoint := t.TempDir()
+	target := MoveTarget{Account: "bob@example.com", DriveID: "drive-b", FolderID: "real-root", Mountpoint: mountpoint}
+	written := false
+	remote := &fakeMoveRemote{onDownload: func(string) {
+		// a.txt was already streamed when b.txt is downloaded
+		_, status := fs.Write(nil, &fuse.WriteIn{InHeader: fuse.InHeader{NodeId: fs.GetID("a").NodeID()}},
+			[]byte("edited"))
+		written = status == fuse.OK
+	}}
+
+	destination := filepath.Join(mountpoint, "moved")
+	jobID, err := fs.startMoveJob("docs", target, "moved", destination, remote)
+	require.NoError(t, err)
+	info := waitForJob(t, fs, jobID)
+	require.True(t, written)
+	require.Equal(t, JobFailed, info.State)
+	require.Contains(t, info.Error, "changed while it was transferred")
+	require.Empty(t, remote.removed, "the write is not in the copy, the original stays")
+	require.NotNil(t, fs.GetID("a"))
+	require.True(t, fs.GetID("a").HasChanges())
+	require.NoDirExists(t, destination, "the outdated copy is removed")
+}
+
+func TestUT_FS_CrossMountMove_CancelsUploadsOfMovedItems(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	seedMoveTree(t, fs)
+	fs.forgetMovedItem("docs")
+
+	var cancelled []string
+	for len(fs.uploads.deletionQueue) > 0 {
+		cancelled = append(cancelled, <-fs.uploads.deletionQueue)
+	}
+	require.Subset(t, cancelled, []string{"docs", "a", "sub", "b"}, "nothing below a moved item is uploaded")
+}
@@ -1,14 +1,20 @@
 package fs
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
 	"github.com/coreos/go-systemd/v22/unit"
 	dbus "github.com/godbus/dbus/v5"
 	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
 )
 
 const (
@@ -20,6 +26,12 @@ const (
 	DBusServiceNameBase = "org.onemount.FileStatus"
 	// DBusServiceNameFile is the file where the D-Bus service name is written for discovery
 	DBusServiceNameFile = "/tmp/onemount-dbus-service-name"
+
+	// Desktop notifications service, see the Desktop Notifications Specification
+	notificationsName      = "org.freedesktop.Notifications"
+	notificationsPath      = "/org/freedesktop/Notifications"
+	notificationsInterface = "org.freedesktop.Notifications"
+	notificationTimeout    = 5 * time.Second
 )
 
 // DBusServiceName returns the D-Bus service name, which may be unique in test environments
@@ -36,8 +48,19 @@ func SetDBusServiceNamePrefix(prefix string) {
 }
 
 // SetDBusServiceNameForMount derives a deterministic D-Bus service name from the mount path.
-// D-Bus names can only contain [A-Za-z0-9_.] so we sanitize the path accordingly.
 func SetDBusServiceNameForMount(mountPath string) {
+	SetDBusServiceNamePrefix(dbusMountPrefix(mountPath))
+}
+
+// DBusServiceNameForMount returns the D-Bus service name of the mount at
+// mountPath, for clients talking to several mounts.
+func DBusServiceNameForMount(mountPath string) string {
+	return fmt.Sprintf("%s.%s", DBusServiceNameBase, dbusMountPrefix(mountPath))
+}
+
+// dbusMountPrefix is the service name suffix of a mount path. D-Bus names can
+// only contain [A-Za-z0-9_.] so we sanitize the path accordingly.
+func dbusMountPrefix(mountPath string) string {
 	// Use systemd escaping as a base, then sanitize for D-Bus
 	escaped := unit.UnitNamePathEscape(mountPath)
 	if escaped == "" {
@@ -53,7 +76,7 @@ func SetDBusServiceNameForMount(mountPath string) {
 			sanitized += "_"
 		}
 	}
-	SetDBusServiceNamePrefix("mnt_" + sanitized)
+	return "mnt_" + sanitized
 }
 
 func init() {
@@ -63,11 +86,24 @@ func init() {
 
 // FileStatusDBusServer implements a D-Bus server for file status updates
 type FileStatusDBusServer struct {
-	fs       FilesystemInterface
-	conn     *dbus.Conn
-	mutex    sync.RWMutex
-	started  bool
-	stopChan chan struct{}
+	fs          FilesystemInterface
+	conn        *dbus.Conn
+	serviceName string // DBusServiceName when the server first started
+	mutex       sync.RWMutex
+	started     bool
+	stopChan    chan struct{}
+
+	// Readable properties, with the last sync digest kept across restarts
+	props         *prop.Properties
+	syncDigest    string
+	serviceHealth string
+
+	// Status signals waiting to be emitted and the clients subscribed to them
+	statusSignals statusSignalQueue
+
+	// onedriver compatibility, see onedriver_compat.go
+	legacy     bool
+	legacyName bool
 }
 
 // NewFileStatusDBusServer creates a new D-Bus server for file status updates
@@ -78,6 +114,333 @@ func NewFileStatusDBusServer(fs FilesystemInterface) *FileStatusDBusServer {
 	}
 }
 
+// fileStatusIntrospectNode describes the methods, signals and properties
+// exported on DBusInterface for introspection by clients.
+func fileStatusIntrospectNode() *introspect.Node {
+	return &introspect.Node{
+		Name: DBusObjectPath,
+		Interfaces: []introspect.Interface{
+			{
+				Name: DBusInterface,
+				Methods: []introspect.Method{
+					{
+						Name: "GetFileStatus",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "status", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetFileProgress",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "status", Type: "s", Direction: "out"},
+							{Name: "progress", Type: "d", Direction: "out"},
+							{Name: "bytesDone", Type: "t", Direction: "out"},
+							{Name: "bytesTotal", Type: "t", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetWebURL",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "url", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetUploadDeferral",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "reason", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "ListConflicts",
+						Args: []introspect.Arg{
+							{Name: "paths", Type: "as", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetConflictDetails",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "message", Type: "s", Direction: "out"},
+							{Name: "localSize", Type: "t", Direction: "out"},
+							{Name: "localModTime", Type: "x", Direction: "out"},
+							{Name: "remoteSize", Type: "t", Direction: "out"},
+							{Name: "remoteModTime", Type: "x", Direction: "out"},
+							{Name: "remoteAvailable", Type: "b", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetConflictPeer",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "peerPath", Type: "s", Direction: "out"},
+							{Name: "remoteModifiedBy", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetConflictContent",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "localPath", Type: "s", Direction: "out"},
+							{Name: "remotePath", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "ResolveConflict",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "choice", Type: "s", Direction: "in"},
+						},
+					},
+					{
+						Name: "WriteSupportBundle",
+						Args: []introspect.Arg{
+							{Name: "target", Type: "s", Direction: "in"},
+						},
+					},
+					{
+						Name: "GetRecentEvents",
+						Args: []introspect.Arg{
+							{Name: "count", Type: "i", Direction: "in"},
+							{Name: "events", Type: "a(xsssu)", Direction: "out"},
+						},
+					},
+					{
+						Name: "MakeAvailableOffline",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "job", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "Unpin",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+						},
+					},
+					{
+						Name: "ListJobs",
+						Args: []introspect.Arg{
+							{Name: "jobs", Type: "a(sssssttttts)", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetJob",
+						Args: []introspect.Arg{
+							{Name: "id", Type: "s", Direction: "in"},
+							{Name: "job", Type: "(sssssttttts)", Direction: "out"},
+						},
+					},
+					{
+						Name: "CancelJob",
+						Args: []introspect.Arg{
+							{Name: "id", Type: "s", Direction: "in"},
+						},
+					},
+					{
+						Name: "GetMoveTarget",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "account", Type: "s", Direction: "out"},
+							{Name: "driveId", Type: "s", Direction: "out"},
+							{Name: "folderId", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "MoveToMount",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "account", Type: "s", Direction: "in"},
+							{Name: "driveId", Type: "s", Direction: "in"},
+							{Name: "folderId", Type: "s", Direction: "in"},
+							{Name: "mountpoint", Type: "s", Direction: "in"},
+							{Name: "name", Type: "s", Direction: "in"},
+							{Name: "destination", Type: "s", Direction: "in"},
+							{Name: "job", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "PlanCacheCleanup",
+						Args: []introspect.Arg{
+							{Name: "expirationDays", Type: "i", Direction: "out"},
+							{Name: "maxCacheSize", Type: "x", Direction: "out"},
+							{Name: "cacheSize", Type: "x", Direction: "out"},
+							{Name: "reclaimedBytes", Type: "x", Direction: "out"},
+							{Name: "files", Type: "a(ssxxs)", Direction: "out"},
+						},
+					},
+					{
+						Name: "BeginBulkOperation",
+						Args: []introspect.Arg{
+							{Name: "reason", Type: "s", Direction: "in"},
+							{Name: "token", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "EndBulkOperation",
+						Args: []introspect.Arg{
+							{Name: "token", Type: "s", Direction: "in"},
+						},
+					},
+					{
+						Name: "ReconcileSubtree",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "folders", Type: "i", Direction: "out"},
+							{Name: "fixes", Type: "a(ss)", Direction: "out"},
+							{Name: "errors", Type: "as", Direction: "out"},
+						},
+					},
+					{
+						Name: "ListOversizedFolders",
+						Args: []introspect.Arg{
+							{Name: "limit", Type: "i", Direction: "in"},
+							{Name: "folders", Type: "a(ssi)", Direction: "out"},
+						},
+					},
+					{
+						Name: "ListBlockedUploads",
+						Args: []introspect.Arg{
+							{Name: "uploads", Type: "a(sst)", Direction: "out"},
+						},
+					},
+					{
+						Name: "VerifyFile",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "match", Type: "b", Direction: "out"},
+							{Name: "repaired", Type: "b", Direction: "out"},
+							{Name: "problem", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "SyncNow",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "result", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetPreview",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "preview", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetTemporaryDownloadURL",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s", Direction: "in"},
+							{Name: "url", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "GetStats",
+						Args: []introspect.Arg{
+							{Name: "stats", Type: "s", Direction: "out"},
+						},
+					},
+					{
+						Name: "ListErroredItems",
+						Args: []introspect.Arg{
+							{Name: "items", Type: "a(sssssixas)", Direction: "out"},
+						},
+					},
+					{
+						Name: "ReloadSettings",
+					},
+					{
+						Name: "Subscribe",
+						Args: []introspect.Arg{
+							{Name: "folders", Type: "as", Direction: "in"},
+						},
+					},
+					{
+						Name: "Unsubscribe",
+					},
+					{
+						Name: "ListFeatureFlags",
+						Args: []introspect.Arg{
+							{Name: "flags", Type: "a(ssbt)", Direction: "out"},
+						},
+					},
+					{
+						Name: "AuditUploads",
+						Args: []introspect.Arg{
+							{Name: "sample", Type: "i", Direction: "in"},
+							{Name: "checked", Type: "i", Direction: "out"},
+							{Name: "skipped", Type: "i", Direction: "out"},
+							{Name: "mismatches", Type: "a(sss)", Direction: "out"},
+							{Name: "errors", Type: "as", Direction: "out"},
+						},
+					},
+					{
+						Name: "PlanOfflineReplay",
+						Args: []introspect.Arg{
+							{Name: "plan", Type: "a(ssssss)", Direction: "out"},
+						},
+					},
+					{
+						Name: "ApplyOfflineReplay",
+						Args: []introspect.Arg{
+							{Name: "job", Type: "s", Direction: "out"},
+						},
+					},
+				},
+				Properties: []introspect.Property{
+					{Name: "SyncDigest", Type: "s", Access: "read"},
+					{Name: "ServiceHealth", Type: "s", Access: "read"},
+				},
+				Signals: []introspect.Signal{
+					{
+						Name: "FileStatusChanged",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s"},
+							{Name: "status", Type: "s"},
+						},
+					},
+					{
+						Name: "FileProgressChanged",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s"},
+							{Name: "status", Type: "s"},
+							{Name: "progress", Type: "d"},
+							{Name: "bytesDone", Type: "t"},
+							{Name: "bytesTotal", Type: "t"},
+						},
+					},
+					{
+						Name: "FileStatusesChanged",
+						Args: []introspect.Arg{
+							{Name: "statuses", Type: "a(ss)"},
+						},
+					},
+					{
+						Name: "ConflictDetected",
+						Args: []introspect.Arg{
+							{Name: "path", Type: "s"},
+							{Name: "message", Type: "s"},
+						},
+					},
+					{
+						Name: "JobFinished",
+						Args: []introspect.Arg{
+							{Name: "id", Type: "s"},
+							{Name: "kind", Type: "s"},
+							{Name: "state", Type: "s"},
+							{Name: "message", Type: "s"},
+						},
+					},
+				},
+			},
+			prop.IntrospectData,
+		},
+	}
+}
+
 // StartForTesting starts the D-Bus server in test mode
 // This method is used for testing purposes only and doesn't try to register a service name
 func (s *FileStatusDBusServer) StartForTesting() error {
@@ -87,6 +450,7 @@ func (s *FileStatusDBusServer) StartForTesting() error {
 	if s.started {
 		return nil
 	}
+	s.resolveServiceNameLocked()
 
 	conn, err := dbus.SessionBus()
 	if err != nil {
@@ -104,44 +468,38 @@ func (s *FileStatusDBusServer) StartForTesting() error {
 	}
 
 	// Export the introspection data
-	node := &introspect.Node{
-		Name: DBusObjectPath,
-		Interfaces: []introspect.Interface{
-			{
-				Name: DBusInterface,
-				Methods: []introspect.Method{
-					{
-						Name: "GetFileStatus",
-						Args: []introspect.Arg{
-							{Name: "path", Type: "s", Direction: "in"},
-							{Name: "status", Type: "s", Direction: "out"},
-						},
-					},
-				},
-				Signals: []introspect.Signal{
-					{
-						Name: "FileStatusChanged",
-						Args: []introspect.Arg{
-							{Name: "path", Type: "s"},
-							{Name: "status", Type: "s"},
-						},
-					},
-				},
-			},
-		},
-	}
+	node := fileStatusIntrospectNode()
 	err = conn.Export(introspect.NewIntrospectable(node), DBusObjectPath, "org.freedesktop.DBus.Introspectable")
 	if err != nil {
 		logging.Error().Err(err).Msg("Failed to export introspection data")
 		s.conn = nil
 		return err
 	}
+	if err := s.exportPropertiesLocked(); err != nil {
+		logging.Error().Err(err).Msg("Failed to export D-Bus properties")
+		s.conn = nil
+		return err
+	}
+	if s.legacy {
+		if err := s.exportLegacyLocked(false); err != nil {
+			logging.Warn().Err(err).Msg("Failed to export the onedriver D-Bus interface")
+		}
+	}
 
 	s.started = true
 	logging.Info().Msg("D-Bus server started in test mode")
 	return nil
 }
 
+// resolveServiceNameLocked takes DBusServiceName as the server's name on its
+// first start. The name is kept from then on, so that a mount served by the
+// same process setting DBusServiceName later does not rename this one.
+func (s *FileStatusDBusServer) resolveServiceNameLocked() {
+	if s.serviceName == "" {
+		s.serviceName = DBusServiceName
+	}
+}
+
 // Start starts the D-Bus server
 func (s *FileStatusDBusServer) Start() error {
 	s.mutex.Lock()
@@ -150,8 +508,11 @@ func (s *FileStatusDBusServer) Start() error {
 	if s.started {
 		return nil
 	}
+	s.resolveServiceNameLocked()
 
-	conn, err := dbus.SessionBus()
+	// A connection of its own, as the mounts served by one process each
+	// export their object at the same path
+	conn, err := dbus.ConnectSessionBus()
 	if err != nil {
 		logging.Error().Err(err).Msg("Failed to connect to D-Bus session bus")
 		return err
@@ -160,7 +521,7 @@ func (s *FileStatusDBusServer) Start() error {
 
 	// Request a name on the bus with flags to allow replacement and not queue
 	// This ensures we can always get a name, even if there are conflicts
-	reply, err := conn.RequestName(DBusServiceName, dbus.NameFlagAllowReplacement|dbus.NameFlagReplaceExisting|dbus.NameFlagDoNotQueue)
+	reply, err := conn.RequestName(s.serviceName, dbus.NameFlagAllowReplacement|dbus.NameFlagReplaceExisting|dbus.NameFlagDoNotQueue)
 	if err != nil {
 		logging.Error().Err(err).Msg("Failed to request D-Bus name")
 		s.conn = nil
@@ -169,9 +530,9 @@ func (s *FileStatusDBusServer) Start() error {
 	if reply != dbus.RequestNameReplyPrimaryOwner {
 		// Since we're using a unique name and NameFlagReplaceExisting, this should rarely happen
 		// But if it does, we'll log it and continue
-		logging.Warn().Msgf("Not primary owner of D-Bus name (reply: %v), but continuing with unique name: %s", reply, DBusServiceName)
+		logging.Warn().Msgf("Not primary owner of D-Bus name (reply: %v), but continuing with unique name: %s", reply, s.serviceName)
 	} else {
-		logging.Debug().Str("dbusName", DBusServiceName).Msg("Successfully acquired D-Bus name")
+		logging.Debug().Str("dbusName", s.serviceName).Msg("Successfully acquired D-Bus name")
 	}
 
 	// Export the FileStatusDBusServer object
@@ -183,38 +544,23 @@ func (s *FileStatusDBusServer) Start() error {
 	}
 
 	// Export the introspection data
-	node := &introspect.Node{
-		Name: DBusObjectPath,
-		Interfaces: []introspect.Interface{
-			{
-				Name: DBusInterface,
-				Methods: []introspect.Method{
-					{
-						Name: "GetFileStatus",
-						Args: []introspect.Arg{
-							{Name: "path", Type: "s", Direction: "in"},
-							{Name: "status", Type: "s", Direction: "out"},
-						},
-					},
-				},
-				Signals: []introspect.Signal{
-					{
-						Name: "FileStatusChanged",
-						Args: []introspect.Arg{
-							{Name: "path", Type: "s"},
-							{Name: "status", Type: "s"},
-						},
-					},
-				},
-			},
-		},
-	}
+	node := fileStatusIntrospectNode()
 	err = conn.Export(introspect.NewIntrospectable(node), DBusObjectPath, "org.freedesktop.DBus.Introspectable")
 	if err != nil {
 		logging.Error().Err(err).Msg("Failed to export introspection data")
 		s.conn = nil
 		return err
 	}
+	if err := s.exportPropertiesLocked(); err != nil {
+		logging.Error().Err(err).Msg("Failed to export D-Bus properties")
+		s.conn = nil
+		return err
+	}
+	if s.legacy {
+		if err := s.exportLegacyLocked(true); err != nil {
+			logging.Warn().Err(err).Msg("Failed to export the onedriver D-Bus interface")
+		}
+	}
 
 	// Write the service name to a file for discovery by clients (e.g., Nemo extension)
 	// This allows clients to discover the actual service name even when it includes a unique suffix
@@ -248,8 +594,8 @@ func (s *FileStatusDBusServer) Stop() {
 	if s.conn != nil {
 		// Release the D-Bus name before closing the connection
 		// This helps prevent name conflicts in subsequent runs
-		logging.Debug().Str("dbusName", DBusServiceName).Msg("Releasing D-Bus name")
-		if _, err := s.conn.ReleaseName(DBusServiceName); err != nil {
+		logging.Debug().Str("dbusName", s.serviceName).Msg("Releasing D-Bus name")
+		if _, err := s.conn.ReleaseName(s.serviceName); err != nil {
 			logging.Warn().Err(err).Msg("Failed to release D-Bus name")
 		}
 
@@ -260,6 +606,13 @@ func (s *FileStatusDBusServer) Stop() {
 		if err := s.conn.Export(nil, DBusObjectPath, "org.freedesktop.DBus.Introspectable"); err != nil {
 			logging.Warn().Err(err).Msg("Failed to unexport introspection data")
 		}
+		if err := s.conn.Export(nil, DBusObjectPath, "org.freedesktop.DBus.Properties"); err != nil {
+			logging.Warn().Err(err).Msg("Failed to unexport D-Bus properties")
+		}
+		s.props = nil
+		if s.legacy {
+			s.unexportLegacyLocked()
+		}
 
 		// Close the connection
 		if err := s.conn.Close(); err != nil {
@@ -268,6 +621,8 @@ func (s *FileStatusDBusServer) Stop() {
 		s.conn = nil
 	}
 
+	s.statusSignals.reset()
+
 	// Remove the service name file
 	if err := s.removeServiceNameFile(); err != nil {
 		logging.Warn().Err(err).Msg("Failed to remove D-Bus service name file")
@@ -307,14 +662,936 @@ func (s *FileStatusDBusServer) SendFileStatusUpdate(path string, status string)
 		return
 	}
 
-	err := s.conn.Emit(
-		DBusObjectPath,
-		DBusInterface+".FileStatusChanged",
+	// Queued and coalesced, see dbus_signal_batch.go
+	if delay, flush := s.statusSignals.queue(path, status, time.Now()); flush {
+		if delay <= 0 {
+			s.flushStatusSignals()
+		} else {
+			s.statusSignals.flushAfter(delay, s.flushStatusSignals)
+		}
+	}
+}
+
+// GetFileProgress returns the status of a file by path together with the
+// progress of any in-flight hydration or upload. Files without an active
+// transfer report a progress of 0 and zero byte counters.
+func (s *FileStatusDBusServer) GetFileProgress(path string) (string, float64, uint64, uint64, *dbus.Error) {
+	status, dbusErr := s.GetFileStatus(path)
+	if dbusErr != nil {
+		return status, 0, 0, 0, dbusErr
+	}
+
+	id := s.fs.GetIDByPath(path)
+	tracker, ok := s.fs.(interface {
+		GetTransferProgress(id string) (TransferProgress, bool)
+	})
+	if id == "" || !ok {
+		return status, 0, 0, 0, nil
+	}
+
+	progress, ok := tracker.GetTransferProgress(id)
+	if !ok {
+		return status, 0, 0, 0, nil
+	}
+	return status, progress.Fraction(), progress.BytesDone, progress.BytesTotal, nil
+}
+
+// GetWebURL returns the OneDrive web view link for the item at path, or an
+// empty string when the item is unknown or has not been synced yet.
+func (s *FileStatusDBusServer) GetWebURL(path string) (string, *dbus.Error) {
+	id := s.fs.GetIDByPath(path)
+	if id == "" {
+		logging.Debug().Str("path", path).Msg("File not found in filesystem")
+		return "", nil
+	}
+
+	inode := s.fs.GetID(id)
+	if inode == nil {
+		return "", nil
+	}
+
+	inode.mu.RLock()
+	url := inode.DriveItem.WebURL
+	inode.mu.RUnlock()
+
+	logging.Debug().
+		Str("path", path).
+		Str("id", id).
+		Str("webURL", url).
+		Msg("Retrieved web URL via D-Bus method")
+
+	return url, nil
+}
+
+// GetUploadDeferral returns why the upload of the item at path is waiting
+// (e.g. DeferredMetered), or an empty string when it is not deferred.
+func (s *FileStatusDBusServer) GetUploadDeferral(path string) (string, *dbus.Error) {
+	id := s.fs.GetIDByPath(path)
+	deferrals, ok := s.fs.(interface {
+		UploadDeferral(id string) string
+	})
+	if id == "" || !ok {
+		return "", nil
+	}
+	return deferrals.UploadDeferral(id), nil
+}
+
+// conflictChooser is implemented by filesystems that support interactive
+// conflict resolution.
+type conflictChooser interface {
+	Conflicts() []string
+	GetConflictDetails(id string) (ConflictDetails, error)
+	FetchConflictRemote(id string) (string, error)
+	ResolveConflictChoice(ctx context.Context, id, choice string) error
+}
+
+// ListConflicts returns the paths of all conflicted items.
+func (s *FileStatusDBusServer) ListConflicts() ([]string, *dbus.Error) {
+	resolver, ok := s.fs.(conflictChooser)
+	if !ok {
+		return []string{}, nil
+	}
+	paths := []string{}
+	for _, id := range resolver.Conflicts() {
+		if inode := s.fs.GetID(id); inode != nil {
+			paths = append(paths, inode.Path())
+		}
+	}
+	return paths, nil
+}
+
+// conflictID resolves path to a conflict resolver and item ID.
+func (s *FileStatusDBusServer) conflictID(path string) (conflictChooser, string, *dbus.Error) {
+	resolver, ok := s.fs.(conflictChooser)
+	if !ok {
+		return nil, "", dbus.MakeFailedError(fmt.Errorf("conflict resolution is not supported"))
+	}
+	id := s.fs.GetIDByPath(path)
+	if id == "" {
+		return nil, "", dbus.MakeFailedError(fmt.Errorf("file not found: %s", path))
+	}
+	return resolver, id, nil
+}
+
+// GetConflictDetails returns the conflict message and the size and
+// modification time (Unix seconds) of the local and remote versions of the
+// conflicted item at path.
+func (s *FileStatusDBusServer) GetConflictDetails(path string) (string, uint64, int64, uint64, int64, bool, *dbus.Error) {
+	resolver, id, dbusErr := s.conflictID(path)
+	if dbusErr != nil {
+		return "", 0, 0, 0, 0, false, dbusErr
+	}
+	details, err := resolver.GetConflictDetails(id)
+	if err != nil {
+		return "", 0, 0, 0, 0, false, dbus.MakeFailedError(err)
+	}
+	var remoteModTime int64
+	if !details.RemoteModTime.IsZero() {
+		remoteModTime = details.RemoteModTime.Unix()
+	}
+	return details.Message, details.LocalSize, details.LocalModTime.Unix(),
+		details.RemoteSize, remoteModTime, details.RemoteAvailable, nil
+}
+
+// GetConflictPeer returns the path of the conflict copy paired with the
+// conflicted item at path (or of the original, for a copy) and who last
+// modified the remote version. Either is empty when unknown.
+func (s *FileStatusDBusServer) GetConflictPeer(path string) (string, string, *dbus.Error) {
+	resolver, id, dbusErr := s.conflictID(path)
+	if dbusErr != nil {
+		return "", "", dbusErr
+	}
+	details, err := resolver.GetConflictDetails(id)
+	if err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	return details.PeerPath, details.RemoteModifiedBy, nil
+}
+
+// GetConflictContent returns the paths of the cached local version and of a
+// freshly downloaded copy of the remote version of the conflicted item at
+// path, for previews. The remote path is empty when the remote version cannot
+// be downloaded.
+func (s *FileStatusDBusServer) GetConflictContent(path string) (string, string, *dbus.Error) {
+	resolver, id, dbusErr := s.conflictID(path)
+	if dbusErr != nil {
+		return "", "", dbusErr
+	}
+	inode := s.fs.GetID(id)
+	if inode == nil {
+		return "", "", dbus.MakeFailedError(fmt.Errorf("file not found: %s", path))
+	}
+	remotePath, err := resolver.FetchConflictRemote(id)
+	if err != nil {
+		logging.Debug().Err(err).Str("path", path).Msg("Remote version of conflicted item unavailable")
+		remotePath = ""
+	}
+	return s.fs.GetInodeContentPath(inode), remotePath, nil
+}
+
+// ResolveConflict resolves the conflicted item at path with one of
+// ConflictKeepLocal, ConflictKeepRemote or ConflictKeepBoth.
+func (s *FileStatusDBusServer) ResolveConflict(path string, choice string) *dbus.Error {
+	resolver, id, dbusErr := s.conflictID(path)
+	if dbusErr != nil {
+		return dbusErr
+	}
+	if err := resolver.ResolveConflictChoice(context.Background(), id, choice); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// WriteSupportBundle writes a support bundle of the mount to the file at
+// target, which must be an absolute path.
+func (s *FileStatusDBusServer) WriteSupportBundle(target string) *dbus.Error {
+	bundler, ok := s.fs.(interface {
+		WriteSupportBundleFile(target string) error
+	})
+	if !ok {
+		return dbus.MakeFailedError(fmt.Errorf("support bundles are not supported"))
+	}
+	if !filepath.IsAbs(target) {
+		return dbus.MakeFailedError(fmt.Errorf("support bundle path must be absolute: %s", target))
+	}
+	if err := bundler.WriteSupportBundleFile(target); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// DBusRecentEvent is an ActivityEvent as returned by GetRecentEvents, with the
+// time in Unix seconds.
+type DBusRecentEvent struct {
+	Time       int64
+	Kind       string
+	Path       string
+	Message    string
+	Suppressed uint32
+}
+
+// GetRecentEvents returns up to count of the most recent notable events,
+// oldest first. A count of zero or less returns every retained event.
+func (s *FileStatusDBusServer) GetRecentEvents(count int32) ([]DBusRecentEvent, *dbus.Error) {
+	recorder, ok := s.fs.(interface {
+		RecentEvents(count int) []ActivityEvent
+	})
+	if !ok {
+		return []DBusRecentEvent{}, nil
+	}
+	events := []DBusRecentEvent{}
+	for _, event := range recorder.RecentEvents(int(count)) {
+		events = append(events, DBusRecentEvent{
+			Time:       event.Time.Unix(),
+			Kind:       event.Type,
+			Path:       event.Path,
+			Message:    event.Message,
+			Suppressed: event.Suppressed,
+		})
+	}
+	return events, nil
+}
+
+// DBusJob is a JobInfo as returned by ListJobs and GetJob.
+type DBusJob struct {
+	ID         string
+	Kind       string
+	Path       string
+	State      string
+	Phase      string
+	Done       uint64
+	Failed     uint64
+	Total      uint64
+	BytesDone  uint64
+	BytesTotal uint64
+	Message    string
+}
+
+// newDBusJob converts a job snapshot for D-Bus.
+func newDBusJob(info JobInfo) DBusJob {
+	return DBusJob{
+		ID:         info.ID,
+		Kind:       info.Kind,
+		Path:       info.Path,
+		State:      info.State,
+		Phase:      info.Phase,
+		Done:       info.Done,
+		Failed:     info.Failed,
+		Total:      info.Total,
+		BytesDone:  info.BytesDone,
+		BytesTotal: info.BytesTotal,
+		Message:    info.Error,
+	}
+}
+
+// jobRunner is implemented by filesystems that track long operations as jobs.
+type jobRunner interface {
+	Jobs() []JobInfo
+	Job(id string) (JobInfo, bool)
+	CancelJob(id string) error
+}
+
+// jobs returns the filesystem as a jobRunner.
+func (s *FileStatusDBusServer) jobs() (jobRunner, *dbus.Error) {
+	runner, ok := s.fs.(jobRunner)
+	if !ok {
+		return nil, dbus.MakeFailedError(fmt.Errorf("jobs are not supported"))
+	}
+	return runner, nil
+}
+
+// MakeAvailableOffline pins the item at path and everything below it and
+// starts hydrating it in the background. It returns the ID of the job.
+func (s *FileStatusDBusServer) MakeAvailableOffline(path string) (string, *dbus.Error) {
+	runner, ok := s.fs.(interface {
+		MakeAvailableOffline(id string) (string, error)
+	})
+	if !ok {
+		return "", dbus.MakeFailedError(fmt.Errorf("making items available offline is not supported"))
+	}
+	id := s.fs.GetIDByPath(path)
+	if id == "" {
+		return "", dbus.MakeFailedError(fmt.Errorf("file not found: %s", path))
+	}
+	jobID, err := runner.MakeAvailableOffline(id)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return jobID, nil
+}
+
+// Unpin removes the pin of the item at path and, for a folder, of everything
+// below it, cancelling a MakeAvailableOffline job still running for it.
+// Downloaded files stay cached until the cache needs the space.
+func (s *FileStatusDBusServer) Unpin(path string) *dbus.Error {
+	pinner, ok := s.fs.(interface {
+		SetTreePinMode(id string, mode metadata.PinMode) error
+	})
+	if !ok {
+		return dbus.MakeFailedError(fmt.Errorf("pinning is not supported"))
+	}
+	id := s.fs.GetIDByPath(path)
+	if id == "" {
+		return dbus.MakeFailedError(fmt.Errorf("file not found: %s", path))
+	}
+	if err := pinner.SetTreePinMode(id, metadata.PinModeUnset); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// ListJobs returns the running and recently finished jobs, oldest first.
+func (s *FileStatusDBusServer) ListJobs() ([]DBusJob, *dbus.Error) {
+	runner, ok := s.fs.(jobRunner)
+	if !ok {
+		return []DBusJob{}, nil
+	}
+	jobs := []DBusJob{}
+	for _, info := range runner.Jobs() {
+		jobs = append(jobs, newDBusJob(info))
+	}
+	return jobs, nil
+}
+
+// GetJob returns the job with the given ID.
+func (s *FileStatusDBusServer) GetJob(id string) (DBusJob, *dbus.Error) {
+	runner, dbusErr := s.jobs()
+	if dbusErr != nil {
+		return DBusJob{}, dbusErr
+	}
+	info, ok := runner.Job(id)
+	if !ok {
+		return DBusJob{}, dbus.MakeFailedError(fmt.Errorf("job not found: %s", id))
+	}
+	return newDBusJob(info), nil
+}
+
+// CancelJob stops the job with the given ID.
+func (s *FileStatusDBusServer) CancelJob(id string) *dbus.Error {
+	runner, dbusErr := s.jobs()
+	if dbusErr != nil {
+		return dbusErr
+	}
+	if err := runner.CancelJob(id); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// GetMoveTarget describes the folder at path, relative to the mount root, as
+// the destination of a move from another mount: the account the mount is
+// signed in to, the ID of its drive and the ID of the folder.
+func (s *FileStatusDBusServer) GetMoveTarget(path string) (string, string, string, *dbus.Error) {
+	mover, ok := s.fs.(interface {
+		MoveTarget(ctx context.Context, path string) (MoveTarget, error)
+	})
+	if !ok {
+		return "", "", "", dbus.MakeFailedError(fmt.Errorf("moves between mounts are not supported"))
+	}
+	target, err := mover.MoveTarget(context.Background(), path)
+	if err != nil {
+		return "", "", "", dbus.MakeFailedError(err)
+	}
+	return target.Account, target.DriveID, target.FolderID, nil
+}
+
+// MoveToMount starts moving the item at path, relative to the mount root, as
+// name into a folder of another mount, mounted at mountpoint and described by
+// GetMoveTarget of that mount. destination is the absolute path the item gets
+// in the other mount. It returns the ID of the job.
+func (s *FileStatusDBusServer) MoveToMount(path, account, driveID, folderID, mountpoint, name, destination string) (string, *dbus.Error) {
+	mover, ok := s.fs.(interface {
+		MoveToMount(id string, target MoveTarget, name, destination string) (string, error)
+	})
+	if !ok {
+		return "", dbus.MakeFailedError(fmt.Errorf("moves between mounts are not supported"))
+	}
+	id := s.fs.GetIDByPath(path)
+	if id == "" {
+		return "", dbus.MakeFailedError(fmt.Errorf("file not found: %s", path))
+	}
+	target := MoveTarget{Account: account, DriveID: driveID, FolderID: folderID, Mountpoint: mountpoint}
+	jobID, err := mover.MoveToMount(id, target, name, destination)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return jobID, nil
+}
+
+// DBusCachePlanFile is a CachePlanFile as returned by PlanCacheCleanup, with
+// the last access time in Unix seconds.
+type DBusCachePlanFile struct {
+	ID           string
+	Path         string
+	Size         int64
+	LastAccessed int64
+	Reason       string
+}
+
+// PlanCacheCleanup simulates a content cache cleanup under the current
+// settings and returns them, the cache size, the bytes the cleanup would
+// reclaim and the files it would evict.
+func (s *FileStatusDBusServer) PlanCacheCleanup() (int32, int64, int64, int64, []DBusCachePlanFile, *dbus.Error) {
+	planner, ok := s.fs.(interface {
+		PlanCacheCleanup() CachePlan
+	})
+	if !ok {
+		return 0, 0, 0, 0, nil, dbus.MakeFailedError(fmt.Errorf("cache cleanup plans are not supported"))
+	}
+	plan := planner.PlanCacheCleanup()
+	files := []DBusCachePlanFile{}
+	for _, file := range plan.Files {
+		files = append(files, DBusCachePlanFile{
+			ID:           file.ID,
+			Path:         file.Path,
+			Size:         file.Size,
+			LastAccessed: file.LastAccessed.Unix(),
+			Reason:       file.Reason,
+		})
+	}
+	return int32(plan.ExpirationDays), plan.MaxCacheSize, plan.CacheSize, plan.ReclaimedBytes, files, nil
+}
+
+// bulkOperator is implemented by filesystems that can pause delta processing
+// during bulk local operations.
+type bulkOperator interface {
+	BeginBulkOperation(reason string) string
+	EndBulkOperation(token string) error
+}
+
+// BeginBulkOperation pauses delta processing and background refreshes while
+// the caller performs a large local copy or move. It returns a token to pass
+// to EndBulkOperation.
+func (s *FileStatusDBusServer) BeginBulkOperation(reason string) (string, *dbus.Error) {
+	operator, ok := s.fs.(bulkOperator)
+	if !ok {
+		return "", dbus.MakeFailedError(fmt.Errorf("bulk operations are not supported"))
+	}
+	return operator.BeginBulkOperation(reason), nil
+}
+
+// EndBulkOperation ends the bulk operation started with token.
+func (s *FileStatusDBusServer) EndBulkOperation(token string) *dbus.Error {
+	operator, ok := s.fs.(bulkOperator)
+	if !ok {
+		return dbus.MakeFailedError(fmt.Errorf("bulk operations are not supported"))
+	}
+	if err := operator.EndBulkOperation(token); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// DBusReconcileFix is a ReconcileFix as returned by ReconcileSubtree.
+type DBusReconcileFix struct {
+	Kind string
+	Path string
+}
+
+// ReconcileSubtree enumerates the folder at path and everything below it from
+// OneDrive again and repairs the local state to match. It returns the number
+// of folders enumerated, the fixes made and the folders that failed.
+func (s *FileStatusDBusServer) ReconcileSubtree(path string) (int32, []DBusReconcileFix, []string, *dbus.Error) {
+	reconciler, ok := s.fs.(interface {
+		ReconcileSubtree(ctx context.Context, path string) (ReconcileReport, error)
+	})
+	if !ok {
+		return 0, nil, nil, dbus.MakeFailedError(fmt.Errorf("reconcile is not supported"))
+	}
+	report, err := reconciler.ReconcileSubtree(context.Background(), path)
+	if err != nil {
+		return 0, nil, nil, dbus.MakeFailedError(err)
+	}
+	fixes := []DBusReconcileFix{}
+	for _, fix := range report.Fixes {
+		fixes = append(fixes, DBusReconcileFix{Kind: fix.Kind, Path: fix.Path})
+	}
+	errs := append([]string{}, report.Errors...)
+	return int32(report.Folders), fixes, errs, nil
+}
+
+// DBusFolderItemCount is a FolderItemCount as returned by ListOversizedFolders.
+type DBusFolderItemCount struct {
+	ID    string
+	Path  string
+	Items int32
+}
+
+// ListOversizedFolders returns the folders holding more than limit items,
+// largest first. A limit of 0 or less uses the folder item warning of the
+// mount, or DefaultFolderItemWarning when the warning is disabled.
+func (s *FileStatusDBusServer) ListOversizedFolders(limit int32) ([]DBusFolderItemCount, *dbus.Error) {
+	lister, ok := s.fs.(interface {
+		FolderItemWarning() int
+		OversizedFolders(limit int) ([]FolderItemCount, error)
+	})
+	if !ok {
+		return nil, dbus.MakeFailedError(fmt.Errorf("folder item counts are not supported"))
+	}
+	n := int(limit)
+	if n <= 0 {
+		n = lister.FolderItemWarning()
+	}
+	if n <= 0 {
+		n = DefaultFolderItemWarning
+	}
+	folders, err := lister.OversizedFolders(n)
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+	result := []DBusFolderItemCount{}
+	for _, folder := range folders {
+		result = append(result, DBusFolderItemCount{ID: folder.ID, Path: folder.Path, Items: int32(folder.Items)})
+	}
+	return result, nil
+}
+
+// DBusBlockedUpload is a BlockedUpload as returned by ListBlockedUploads.
+type DBusBlockedUpload struct {
+	Path   string
+	Reason string
+	Size   uint64
+}
+
+// ListBlockedUploads returns the local changes that will not upload until
+// the user acts on them, such as files past OneDrive's size limit.
+func (s *FileStatusDBusServer) ListBlockedUploads() ([]DBusBlockedUpload, *dbus.Error) {
+	lister, ok := s.fs.(interface {
+		BlockedUploads() ([]BlockedUpload, error)
+	})
+	if !ok {
+		return []DBusBlockedUpload{}, nil
+	}
+	uploads, err := lister.BlockedUploads()
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+	result := []DBusBlockedUpload{}
+	for _, upload := range uploads {
+		result = append(result, DBusBlockedUpload{Path: upload.Path, Reason: upload.Reason, Size: upload.Size})
+	}
+	return result, nil
+}
+
+// DBusErroredItem is an ErroredItem as returned by ListErroredItems.
+type DBusErroredItem struct {
+	Path       string
+	Operation  string // "upload" or "download"
+	Class      string
+	Message    string
+	OccurredAt string // RFC 3339
+	Attempts   int32
+	NextRetry  int64    // Unix time, 0 when not retried automatically
+	History    []string // classes of the recent errors, oldest first
+}
+
+// ListErroredItems returns the items whose last upload or download failed,
+// with the class of their recent errors and their next automatic retry.
+func (s *FileStatusDBusServer) ListErroredItems() ([]DBusErroredItem, *dbus.Error) {
+	lister, ok := s.fs.(interface {
+		ErroredItems() ([]ErroredItem, error)
+	})
+	if !ok {
+		return []DBusErroredItem{}, nil
+	}
+	items, err := lister.ErroredItems()
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+	result := []DBusErroredItem{}
+	for _, item := range items {
+		entry := DBusErroredItem{
+			Path:       item.Path,
+			Operation:  "download",
+			Class:      string(item.LastError.Class),
+			Message:    item.LastError.Message,
+			OccurredAt: item.LastError.OccurredAt.Format(time.RFC3339),
+			Attempts:   int32(item.Attempts),
+			History:    []string{},
+		}
+		if item.Upload {
+			entry.Operation = "upload"
+		}
+		if !item.NextRetry.IsZero() {
+			entry.NextRetry = item.NextRetry.Unix()
+		}
+		for _, past := range item.History {
+			entry.History = append(entry.History, string(past.Class))
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// ReloadSettings makes the mount read its settings again, after the launcher
+// changed them in the configuration file.
+func (s *FileStatusDBusServer) ReloadSettings() *dbus.Error {
+	reloader, ok := s.fs.(interface{ ReloadSettings() error })
+	if !ok {
+		return dbus.MakeFailedError(fmt.Errorf("reloading settings is not supported"))
+	}
+	if err := reloader.ReloadSettings(); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// DBusFeatureFlag is a FeatureFlag as returned by ListFeatureFlags.
+type DBusFeatureFlag struct {
+	Name        string
+	Description string
+	Enabled     bool
+	Uses        uint64
+}
+
+// ListFeatureFlags returns every feature flag with whether the mount has it
+// on and how often its code path was taken.
+func (s *FileStatusDBusServer) ListFeatureFlags() ([]DBusFeatureFlag, *dbus.Error) {
+	lister, ok := s.fs.(interface{ FeatureFlags() []FeatureFlag })
+	if !ok {
+		return []DBusFeatureFlag{}, nil
+	}
+	result := []DBusFeatureFlag{}
+	for _, flag := range lister.FeatureFlags() {
+		result = append(result, DBusFeatureFlag{Name: flag.Name, Description: flag.Description, Enabled: flag.Enabled, Uses: flag.Uses})
+	}
+	return result, nil
+}
+
+// DBusUploadMismatch is an UploadMismatch as returned by AuditUploads.
+type DBusUploadMismatch struct {
+	ID      string
+	Path    string
+	Problem string
+}
+
+// AuditUploads compares up to sample recently uploaded files with their copy
+// on OneDrive. It returns the number of files compared and skipped, the files
+// that differ and the files that could not be fetched.
+func (s *FileStatusDBusServer) AuditUploads(sample int32) (int32, int32, []DBusUploadMismatch, []string, *dbus.Error) {
+	auditor, ok := s.fs.(interface {
+		AuditUploads(ctx context.Context, sample int) (UploadAuditReport, error)
+	})
+	if !ok {
+		return 0, 0, nil, nil, dbus.MakeFailedError(fmt.Errorf("upload audits are not supported"))
+	}
+	report, err := auditor.AuditUploads(context.Background(), int(sample))
+	if err != nil {
+		return 0, 0, nil, nil, dbus.MakeFailedError(err)
+	}
+	mismatches := []DBusUploadMismatch{}
+	for _, m := range report.Mismatches {
+		mismatches = append(mismatches, DBusUploadMismatch{ID: m.ID, Path: m.Path, Problem: m.Problem})
+	}
+	errs := append([]string{}, report.Errors...)
+	return int32(report.Checked), int32(report.Skipped), mismatches, errs, nil
+}
+
+// DBusReplayPlanItem is a ReplayPlanItem as returned by PlanOfflineReplay.
+type DBusReplayPlanItem struct {
+	Type    string
+	Path    string
+	OldPath string
+	State   string
+	Outcome string
+	Reason  string
+}
+
+// PlanOfflineReplay predicts what replaying each change made while offline
+// would do, checking the items on OneDrive without changing them.
+func (s *FileStatusDBusServer) PlanOfflineReplay() ([]DBusReplayPlanItem, *dbus.Error) {
+	planner, ok := s.fs.(interface {
+		PlanOfflineReplay(ctx context.Context) ([]ReplayPlanItem, error)
+	})
+	if !ok {
+		return nil, dbus.MakeFailedError(fmt.Errorf("replay plans are not supported"))
+	}
+	plan, err := planner.PlanOfflineReplay(context.Background())
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+	items := []DBusReplayPlanItem{}
+	for _, item := range plan {
+		items = append(items, DBusReplayPlanItem{Type: item.Type, Path: item.Path, OldPath: item.OldPath,
+			State: item.State, Outcome: item.Outcome, Reason: item.Reason})
+	}
+	return items, nil
+}
+
+// ApplyOfflineReplay starts replaying the changes made while offline and
+// returns the ID of the job.
+func (s *FileStatusDBusServer) ApplyOfflineReplay() (string, *dbus.Error) {
+	replayer, ok := s.fs.(interface {
+		ApplyOfflineReplay() (string, error)
+	})
+	if !ok {
+		return "", dbus.MakeFailedError(fmt.Errorf("replaying offline changes is not supported"))
+	}
+	jobID, err := replayer.ApplyOfflineReplay()
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return jobID, nil
+}
+
+// VerifyFile downloads the file at path, relative to the mount root, again
+// and compares it with its cached copy, which is replaced when they differ.
+func (s *FileStatusDBusServer) VerifyFile(path string) (bool, bool, string, *dbus.Error) {
+	verifier, ok := s.fs.(interface {
+		VerifyFile(ctx context.Context, path string) (FileVerification, error)
+	})
+	if !ok {
+		return false, false, "", dbus.MakeFailedError(fmt.Errorf("file verification is not supported"))
+	}
+	result, err := verifier.VerifyFile(context.Background(), path)
+	if err != nil {
+		return false, false, "", dbus.MakeFailedError(err)
+	}
+	return result.Match, result.Repaired, result.Problem, nil
+}
+
+// SyncNow uploads or downloads the file at path, relative to the mount root,
+// ahead of all queued transfers and returns "uploaded", "downloaded" or
+// "up-to-date" once it is done.
+func (s *FileStatusDBusServer) SyncNow(path string) (string, *dbus.Error) {
+	syncer, ok := s.fs.(interface {
+		SyncNow(ctx context.Context, path string) (FileSyncResult, error)
+	})
+	if !ok {
+		return "", dbus.MakeFailedError(fmt.Errorf("syncing files is not supported"))
+	}
+	result, err := syncer.SyncNow(context.Background(), path)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return string(result), nil
+}
+
+// GetPreview renders a PNG preview of the file at path, relative to the
+// mount root, without downloading it, and returns the preview's path.
+func (s *FileStatusDBusServer) GetPreview(path string) (string, *dbus.Error) {
+	previewer, ok := s.fs.(interface {
+		Preview(ctx context.Context, path string) (string, error)
+	})
+	if !ok {
+		return "", dbus.MakeFailedError(fmt.Errorf("previews are not supported"))
+	}
+	preview, err := previewer.Preview(context.Background(), path)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return preview, nil
+}
+
+// GetTemporaryDownloadURL returns a pre-authenticated URL, valid for about an
+// hour, for downloading the file at path, relative to the mount root,
+// directly from OneDrive.
+func (s *FileStatusDBusServer) GetTemporaryDownloadURL(path string) (string, *dbus.Error) {
+	provider, ok := s.fs.(interface {
+		TemporaryDownloadURL(ctx context.Context, path string) (string, error)
+	})
+	if !ok {
+		return "", dbus.MakeFailedError(fmt.Errorf("download URLs are not supported"))
+	}
+	url, err := provider.TemporaryDownloadURL(context.Background(), path)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return url, nil
+}
+
+// GetStats returns the mount's statistics encoded as JSON, so that
+// "onemount --stats" does not have to open the database of a running mount.
+func (s *FileStatusDBusServer) GetStats() (string, *dbus.Error) {
+	provider, ok := s.fs.(interface{ GetStats() (*Stats, error) })
+	if !ok {
+		return "", dbus.MakeFailedError(fmt.Errorf("statistics are not supported"))
+	}
+	stats, err := provider.GetStats()
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// exportPropertiesLocked exports the readable properties of DBusInterface.
+// The caller holds s.mutex.
+func (s *FileStatusDBusServer) exportPropertiesLocked() error {
+	props, err := prop.Export(s.conn, DBusObjectPath, prop.Map{
+		DBusInterface: {
+			"SyncDigest":    {Value: s.syncDigest, Emit: prop.EmitTrue},
+			"ServiceHealth": {Value: s.serviceHealth, Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	s.props = props
+	return nil
+}
+
+// SetSyncDigest publishes the summary of the last sync digest period as the
+// SyncDigest property, announcing it with PropertiesChanged.
+func (s *FileStatusDBusServer) SetSyncDigest(summary string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.syncDigest = summary
+	if s.props != nil {
+		s.props.SetMust(DBusInterface, "SyncDigest", summary)
+	}
+}
+
+// SetServiceHealth publishes a degradation of the OneDrive service as the
+// ServiceHealth property, empty while the service is healthy, announcing it
+// with PropertiesChanged.
+func (s *FileStatusDBusServer) SetServiceHealth(summary string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.serviceHealth = summary
+	if s.props != nil {
+		s.props.SetMust(DBusInterface, "ServiceHealth", summary)
+	}
+}
+
+// SendDesktopNotification shows a desktop notification through the session's
+// notification daemon.
+func (s *FileStatusDBusServer) SendDesktopNotification(summary, body string) {
+	if !s.started || s.conn == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	err := s.conn.Object(notificationsName, notificationsPath).CallWithContext(ctx,
+		notificationsInterface+".Notify", 0,
+		"OneMount",                // app_name
+		uint32(0),                 // replaces_id
+		"onemount",                // app_icon
+		summary,                   // summary
+		body,                      // body
+		[]string{},                // actions
+		map[string]dbus.Variant{}, // hints
+		int32(-1),                 // expire_timeout, server default
+	).Err
+	if err != nil {
+		logging.Warn().Err(err).Msg("Failed to show desktop notification")
+	}
+}
+
+// emit sends the signal with the given name, also under onedriver's names
+// when compatibility is enabled.
+func (s *FileStatusDBusServer) emit(signal string, args ...interface{}) error {
+	return emitSignal(s.conn, s.legacyEnabled(), signal, args...)
+}
+
+// emitSignal emits the signal with the given name on conn, also under
+// onedriver's interface when legacy is set.
+func emitSignal(conn *dbus.Conn, legacy bool, signal string, args ...interface{}) error {
+	if err := conn.Emit(DBusObjectPath, DBusInterface+"."+signal, args...); err != nil {
+		return err
+	}
+	if legacy {
+		return conn.Emit(LegacyDBusObjectPath, LegacyDBusInterface+"."+signal, args...)
+	}
+	return nil
+}
+
+// SendJobFinished sends a D-Bus signal announcing that a job stopped.
+func (s *FileStatusDBusServer) SendJobFinished(info JobInfo) {
+	if !s.started || s.conn == nil {
+		return
+	}
+
+	err := s.emit(
+		"JobFinished",
+		info.ID,
+		info.Kind,
+		info.State,
+		info.Error,
+	)
+	if err != nil {
+		logging.Error().Err(err).Str("job", info.ID).Msg("Failed to emit D-Bus job signal")
+	}
+}
+
+// SendConflictDetected sends a D-Bus signal asking clients to resolve the
+// conflicted item at path.
+func (s *FileStatusDBusServer) SendConflictDetected(path string, message string) {
+	if !s.started || s.conn == nil {
+		return
+	}
+
+	err := s.emit(
+		"ConflictDetected",
+		path,
+		message,
+	)
+	if err != nil {
+		logging.Error().Err(err).Str("path", path).Msg("Failed to emit D-Bus conflict signal")
+	}
+}
+
+// SendFileProgressUpdate sends a D-Bus signal with the byte-level progress of
+// a download or upload. Callers are expected to throttle emissions.
+func (s *FileStatusDBusServer) SendFileProgressUpdate(path string, status string, progress float64, bytesDone, bytesTotal uint64) {
+	if !s.started || s.conn == nil {
+		return
+	}
+
+	err := s.emit(
+		"FileProgressChanged",
 		path,
 		status,
+		progress,
+		bytesDone,
+		bytesTotal,
 	)
 	if err != nil {
-		logging.Error().Err(err).Str("path", path).Str("status", status).Msg("Failed to emit D-Bus signal")
+		logging.Error().Err(err).Str("path", path).Str("status", status).Msg("Failed to emit D-Bus progress signal")
 	}
 }
 
@@ -331,7 +1608,7 @@ func (s *FileStatusDBusServer) writeServiceNameFile() error {
 	defer f.Close()
 
 	// Write the service name
-	if _, err := f.WriteString(DBusServiceName + "\n"); err != nil {
+	if _, err := f.WriteString(s.serviceName + "\n"); err != nil {
 		os.Remove(tempFile) // Clean up temp file on error
 		return fmt.Errorf("failed to write service name: %w", err)
 	}
@@ -356,7 +1633,7 @@ func (s *FileStatusDBusServer) writeServiceNameFile() error {
 
 	logging.Debug().
 		Str("file", DBusServiceNameFile).
-		Str("serviceName", DBusServiceName).
+		Str("serviceName", s.serviceName).
 		Msg("Wrote D-Bus service name to file for client discovery")
 
 	return nil
@@ -379,12 +1656,12 @@ func (s *FileStatusDBusServer) removeServiceNameFile() error {
 	storedName := string(data)
 	// Trim whitespace and newlines
 	storedName = storedName[:len(storedName)-1] // Remove trailing newline
-	if storedName != DBusServiceName {
+	if storedName != s.serviceName {
 		// File contains a different service name, don't remove it
 		logging.Debug().
 			Str("file", DBusServiceNameFile).
 			Str("storedName", storedName).
-			Str("ourName", DBusServiceName).
+			Str("ourName", s.serviceName).
 			Msg("Service name file contains different name, not removing")
 		return nil
 	}
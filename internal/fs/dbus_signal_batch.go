@@ -0,0 +1,270 @@
+package fs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/godbus/dbus/v5"
+)
+
+// Status signals are queued instead of emitted one by one, so a sync that
+// touches thousands of files does not flood the session bus. Each path keeps
+// only its latest status until the queue is flushed. The first status after a
+// quiet period is emitted at once; after that the queue is flushed at most
+// every statusSignalInterval with at most maxStatusSignalsPerFlush paths, and
+// the rest wait for the next flush.
+//
+// Clients that only care about some folders call Subscribe with them. They
+// receive one FileStatusesChanged signal per flush, sent to them alone, with
+// the statuses of the paths below their folders. Every status is broadcast
+// with FileStatusChanged all the same, for the clients that never subscribe.
+// Subscriptions of clients that left the bus are dropped when a flush has a
+// batch for them.
+
+// statusSignalInterval is the shortest time between two flushes of queued
+// status signals.
+const statusSignalInterval = 100 * time.Millisecond
+
+// maxStatusSignalsPerFlush caps the paths whose status one flush emits.
+const maxStatusSignalsPerFlush = 100
+
+// maxStatusSubscribers caps the clients subscribed at the same time.
+const maxStatusSubscribers = 64
+
+// DBusFileStatus is a status as sent in FileStatusesChanged.
+type DBusFileStatus struct {
+	Path   string
+	Status string
+}
+
+// statusSignalQueue holds the status signals waiting to be emitted and the
+// folders each subscribed client asked for. The zero value is ready to use.
+type statusSignalQueue struct {
+	mu          sync.Mutex
+	order       []string          // queued paths, oldest first
+	pending     map[string]string // latest status per queued path
+	lastFlush   time.Time
+	scheduled   bool                // a flush is due, no need to ask for another
+	timer       *time.Timer         // the due flush, stopped by reset
+	subscribers map[string][]string // unique bus name -> subscribed folders
+}
+
+// queue adds the status of path. It returns true when the caller must flush
+// the queue after delay, false when a flush is due already.
+func (q *statusSignalQueue) queue(path, status string, now time.Time) (time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == nil {
+		q.pending = make(map[string]string)
+	}
+	if _, queued := q.pending[path]; !queued {
+		q.order = append(q.order, path)
+	}
+	q.pending[path] = status
+	if q.scheduled {
+		return 0, false
+	}
+	q.scheduled = true
+	return q.lastFlush.Add(statusSignalInterval).Sub(now), true
+}
+
+// take removes up to maxStatusSignalsPerFlush statuses from the queue, oldest
+// first, and sorts them out for the subscribers. broadcast holds all of them.
+// more reports whether statuses are left for another flush.
+func (q *statusSignalQueue) take(now time.Time) (broadcast []DBusFileStatus, subscribed map[string][]DBusFileStatus, more bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	count := len(q.order)
+	if count > maxStatusSignalsPerFlush {
+		count = maxStatusSignalsPerFlush
+	}
+	broadcast = make([]DBusFileStatus, 0, count)
+	for _, queued := range q.order[:count] {
+		status := DBusFileStatus{Path: queued, Status: q.pending[queued]}
+		delete(q.pending, queued)
+		broadcast = append(broadcast, status)
+		for name, folders := range q.subscribers {
+			if pathInFolders(status.Path, folders) {
+				if subscribed == nil {
+					subscribed = make(map[string][]DBusFileStatus)
+				}
+				subscribed[name] = append(subscribed[name], status)
+			}
+		}
+	}
+	q.order = q.order[count:]
+	q.lastFlush = now
+	q.scheduled = len(q.order) > 0
+	return broadcast, subscribed, q.scheduled
+}
+
+// subscriberNames returns the unique bus names of the subscribed clients.
+func (q *statusSignalQueue) subscriberNames() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	names := make([]string, 0, len(q.subscribers))
+	for name := range q.subscribers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// flushAfter runs flush after delay unless the queue is reset first.
+func (q *statusSignalQueue) flushAfter(delay time.Duration, flush func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.timer = time.AfterFunc(delay, flush)
+}
+
+// reset drops the queued statuses and the subscriptions and cancels the due
+// flush.
+func (q *statusSignalQueue) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.order = nil
+	q.pending = nil
+	q.scheduled = false
+	q.subscribers = nil
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+}
+
+// pathInFolders reports whether p is one of folders or below one of them.
+func pathInFolders(p string, folders []string) bool {
+	for _, folder := range folders {
+		if folder == "/" || p == folder || strings.HasPrefix(p, folder+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// flushStatusSignals emits the oldest queued statuses and schedules another
+// flush when statuses are left. It runs from timers, so it works with the
+// connection it finds when it starts: Stop closes it at worst, which fails
+// the signals still to go out, and drops the queue.
+func (s *FileStatusDBusServer) flushStatusSignals() {
+	s.mutex.RLock()
+	conn, legacy := s.conn, s.legacy
+	if !s.started {
+		conn = nil
+	}
+	s.mutex.RUnlock()
+	if conn == nil {
+		return
+	}
+	broadcast, subscribed, more := s.statusSignals.take(time.Now())
+	for _, status := range broadcast {
+		if err := emitSignal(conn, legacy, "FileStatusChanged", status.Path, status.Status); err != nil {
+			logging.Error().Err(err).Str("path", status.Path).Str("status", status.Status).Msg("Failed to emit D-Bus signal")
+		}
+	}
+	names := make([]string, 0, len(subscribed))
+	for name := range subscribed {
+		names = append(names, name)
+	}
+	for _, name := range s.pruneSubscribers(conn, names) {
+		delete(subscribed, name)
+	}
+	for name, statuses := range subscribed {
+		if err := emitSignalTo(conn, name, "FileStatusesChanged", statuses); err != nil {
+			logging.Debug().Err(err).Str("client", name).Msg("Failed to send D-Bus status batch")
+		}
+	}
+	if more {
+		s.statusSignals.flushAfter(statusSignalInterval, s.flushStatusSignals)
+	}
+}
+
+// emitSignalTo sends the signal with the given name to the client name only.
+func emitSignalTo(conn *dbus.Conn, name, signal string, args ...interface{}) error {
+	msg := &dbus.Message{
+		Type: dbus.TypeSignal,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldPath:        dbus.MakeVariant(dbus.ObjectPath(DBusObjectPath)),
+			dbus.FieldInterface:   dbus.MakeVariant(DBusInterface),
+			dbus.FieldMember:      dbus.MakeVariant(signal),
+			dbus.FieldDestination: dbus.MakeVariant(name),
+			dbus.FieldSignature:   dbus.MakeVariant(dbus.SignatureOf(args...)),
+		},
+		Body: args,
+	}
+	return conn.Send(msg, nil).Err
+}
+
+// Subscribe sends the caller a FileStatusesChanged signal with the status
+// changes below folders, paths inside the mount like "/Documents". It
+// replaces the caller's earlier subscription; no folders end it.
+func (s *FileStatusDBusServer) Subscribe(sender dbus.Sender, folders []string) *dbus.Error {
+	if sender == "" {
+		return dbus.MakeFailedError(fmt.Errorf("subscriptions need a caller on the bus"))
+	}
+	cleaned := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		if !strings.HasPrefix(folder, "/") {
+			return dbus.MakeFailedError(fmt.Errorf("subscribed folder must be absolute: %s", folder))
+		}
+		cleaned = append(cleaned, path.Clean(folder))
+	}
+	if len(cleaned) == 0 {
+		return s.Unsubscribe(sender)
+	}
+	s.mutex.RLock()
+	conn := s.conn
+	s.mutex.RUnlock()
+	if conn != nil {
+		s.pruneSubscribers(conn, s.statusSignals.subscriberNames())
+	}
+
+	q := &s.statusSignals
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.subscribers == nil {
+		q.subscribers = make(map[string][]string)
+	}
+	if _, ok := q.subscribers[string(sender)]; !ok && len(q.subscribers) >= maxStatusSubscribers {
+		return dbus.MakeFailedError(fmt.Errorf("too many clients subscribed, at most %d", maxStatusSubscribers))
+	}
+	q.subscribers[string(sender)] = cleaned
+	logging.Debug().Str("client", string(sender)).Strs("folders", cleaned).Msg("Client subscribed to status changes")
+	return nil
+}
+
+// Unsubscribe ends the caller's subscription.
+func (s *FileStatusDBusServer) Unsubscribe(sender dbus.Sender) *dbus.Error {
+	q := &s.statusSignals
+	q.mu.Lock()
+	delete(q.subscribers, string(sender))
+	q.mu.Unlock()
+	return nil
+}
+
+// pruneSubscribers drops the subscriptions of the clients among names that
+// left the bus without ending them, and returns those clients.
+func (s *FileStatusDBusServer) pruneSubscribers(conn *dbus.Conn, names []string) []string {
+	var gone []string
+	for _, name := range names {
+		var present bool
+		if err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, name).Store(&present); err != nil || present {
+			continue
+		}
+		gone = append(gone, name)
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	q := &s.statusSignals
+	q.mu.Lock()
+	for _, name := range gone {
+		delete(q.subscribers, name)
+	}
+	q.mu.Unlock()
+	logging.Debug().Strs("clients", gone).Msg("Dropped subscriptions of clients that left the bus")
+	return gone
+}
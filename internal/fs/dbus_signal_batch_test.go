@@ -0,0 +1,126 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_DBusSignalBatch_CoalescesAndLimitsRate(t *testing.T) {
+	var q statusSignalQueue
+	start := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	delay, flush := q.queue("/a.txt", "Downloading", start)
+	require.True(t, flush)
+	require.LessOrEqual(t, delay, time.Duration(0), "the first status after a quiet period goes out at once")
+	_, flush = q.queue("/a.txt", "Local", start)
+	require.False(t, flush, "a flush is due already")
+	batch, _, more := q.take(start)
+	require.Equal(t, []DBusFileStatus{{Path: "/a.txt", Status: "Local"}}, batch, "only the latest status is sent")
+	require.False(t, more)
+
+	delay, flush = q.queue("/b.txt", "Syncing", start.Add(10*time.Millisecond))
+	require.True(t, flush)
+	require.Equal(t, statusSignalInterval-10*time.Millisecond, delay, "the next flush waits for the interval")
+
+	for i := 0; i < maxStatusSignalsPerFlush+5; i++ {
+		q.queue(fmt.Sprintf("/bulk/%03d.txt", i), "Cloud", start.Add(20*time.Millisecond))
+	}
+	batch, _, more = q.take(start.Add(statusSignalInterval))
+	require.Len(t, batch, maxStatusSignalsPerFlush)
+	require.Equal(t, "/b.txt", batch[0].Path, "the oldest statuses go first")
+	require.True(t, more)
+	batch, _, more = q.take(start.Add(2 * statusSignalInterval))
+	require.Len(t, batch, 6)
+	require.False(t, more)
+}
+
+func TestUT_FS_DBusSignalBatch_SubscribersGetTheirFolders(t *testing.T) {
+	server := NewFileStatusDBusServer(nil)
+	require.Nil(t, server.Subscribe(":1.10", []string{"/Documents/", "/Photos/2026"}))
+	require.Nil(t, server.Subscribe(":1.11", []string{"/"}))
+	require.NotNil(t, server.Subscribe(":1.12", []string{"Documents"}), "folders are paths inside the mount")
+
+	now := time.Now()
+	for _, path := range []string{"/Documents/report.docx", "/DocumentsOld/a.txt", "/Photos/2026/beach.jpg", "/Music/song.mp3"} {
+		server.statusSignals.queue(path, "Local", now)
+	}
+	_, subscribed, _ := server.statusSignals.take(now)
+	require.Equal(t, []DBusFileStatus{
+		{Path: "/Documents/report.docx", Status: "Local"},
+		{Path: "/Photos/2026/beach.jpg", Status: "Local"},
+	}, subscribed[":1.10"])
+	require.Len(t, subscribed[":1.11"], 4)
+
+	require.Nil(t, server.Subscribe(":1.10", nil), "no folders end the subscription")
+	server.statusSignals.queue("/Documents/report.docx", "Syncing", now)
+	_, subscribed, _ = server.statusSignals.take(now)
+	require.NotContains(t, subscribed, ":1.10")
+}
+
+func TestUT_FS_DBusSignalBatch_StoppedServerSkipsFlush(t *testing.T) {
+	server := NewFileStatusDBusServer(nil)
+	now := time.Now()
+	server.statusSignals.queue("/a.txt", "Local", now)
+
+	// A flush firing after Stop finds no connection and leaves the queue
+	server.flushStatusSignals()
+	require.Equal(t, []string{"/a.txt"}, server.statusSignals.order)
+
+	fired := make(chan struct{})
+	server.statusSignals.flushAfter(20*time.Millisecond, func() { close(fired) })
+	server.statusSignals.reset()
+	select {
+	case <-fired:
+		t.Fatal("reset cancels the due flush")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Empty(t, server.statusSignals.order)
+}
+
+func TestUT_FS_DBusSignalBatch_SubscribedPathsAreStillBroadcast(t *testing.T) {
+	server := NewFileStatusDBusServer(nil)
+	require.Nil(t, server.Subscribe(":1.10", []string{"/Documents"}))
+	require.Nil(t, server.Subscribe(":1.11", []string{"/"}))
+
+	now := time.Now()
+	for _, path := range []string{"/Documents/report.docx", "/Music/song.mp3"} {
+		server.statusSignals.queue(path, "Syncing", now)
+	}
+	broadcast, subscribed, _ := server.statusSignals.take(now)
+	require.Equal(t, []DBusFileStatus{
+		{Path: "/Documents/report.docx", Status: "Syncing"},
+		{Path: "/Music/song.mp3", Status: "Syncing"},
+	}, broadcast, "clients that never subscribe still see every path")
+	require.Equal(t, []DBusFileStatus{{Path: "/Documents/report.docx", Status: "Syncing"}}, subscribed[":1.10"])
+	require.Len(t, subscribed[":1.11"], 2)
+}
+
+// TestIT_FS_DBusSignalBatch_FlushDropsClientsThatLeft tests that a flush
+// drops the subscription of a client no longer on the bus.
+// This is an integration test because it requires D-Bus session bus to be available
+func TestIT_FS_DBusSignalBatch_FlushDropsClientsThatLeft(t *testing.T) {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		t.Skip("D-Bus session bus not available")
+	}
+	server := NewFileStatusDBusServer(&Filesystem{})
+	require.NoError(t, server.StartForTesting())
+	defer server.Stop()
+
+	client, err := dbus.ConnectSessionBus()
+	require.NoError(t, err)
+	gone, err := dbus.ConnectSessionBus()
+	require.NoError(t, err)
+	require.Nil(t, server.Subscribe(dbus.Sender(client.Names()[0]), []string{"/"}))
+	require.Nil(t, server.Subscribe(dbus.Sender(gone.Names()[0]), []string{"/"}))
+	defer client.Close()
+	require.NoError(t, gone.Close())
+
+	server.statusSignals.queue("/a.txt", "Local", time.Now())
+	server.flushStatusSignals()
+	require.Equal(t, []string{client.Names()[0]}, server.statusSignals.subscriberNames())
+}
@@ -387,6 +387,7 @@ func TestIT_FS_DBus_SetServiceNameForMount(t *testing.T) {
 
 	SetDBusServiceNameForMount("/tmp/onemount auth")
 	assert.Equal("org.onemount.FileStatus.mnt_tmp_onemount_x20auth", DBusServiceName)
+	assert.Equal(DBusServiceName, DBusServiceNameForMount("/tmp/onemount auth"))
 }
 
 // TestDBusServer_MultipleInstances tests running multiple D-Bus server instances.
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"runtime/debug"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/auriora/onemount/internal/graph"
@@ -93,7 +96,9 @@ func (f *Filesystem) desiredDeltaInterval() time.Duration {
 		return interval
 	}
 
+	f.settingsM.RLock()
 	baseInterval := f.deltaInterval
+	f.settingsM.RUnlock()
 	if baseInterval <= 0 {
 		baseInterval = defaultPollingInterval
 	}
@@ -235,7 +240,9 @@ func (f *Filesystem) noteNotifierHealth(state socketio.HealthState) {
 func (f *Filesystem) DeltaLoop(interval time.Duration) {
 	logging.Info().Msg("Starting delta goroutine.")
 
+	f.settingsM.Lock()
 	f.deltaInterval = interval
+	f.settingsM.Unlock()
 
 	// Add to wait groups to track this goroutine
 	f.deltaLoopWg.Add(1)
@@ -246,6 +253,7 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 		f.Wg.Done()
 		logging.Debug().Msg("Delta goroutine completed")
 	}()
+	defer f.RecoverCrash("delta loop")
 
 	notificationCh, err := f.startRealtimeManager()
 	if err != nil {
@@ -269,6 +277,20 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 	// Use the normal ticker by default
 	currentTicker := ticker
 
+	bulkPaused := false
+
+	// The first cycle, and the first after being offline, catch up on
+	// changes made meanwhile and are not sampled for realtime latency
+	sampleLatency := false
+
+	// The slot of the running cycle in the scheduler shared with other mounts
+	var endCycle func()
+	defer func() {
+		if endCycle != nil {
+			endCycle()
+		}
+	}()
+
 	for { // eva
 		// Check if we should stop before starting a new cycle
 		select {
@@ -284,8 +306,36 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 			// Continue with normal operation
 		}
 
+		// Hold off while a bulk local operation is running; the first cycle
+		// after it ends reconciles everything that changed meanwhile.
+		if f.BulkOperationActive() {
+			if !bulkPaused {
+				logging.Info().Msg("Delta processing paused for a bulk local operation")
+				bulkPaused = true
+			}
+			select {
+			case <-f.bulk.resumed():
+			case <-time.After(bulkPauseCheckTime):
+			case <-f.deltaLoopStop:
+				return
+			case <-f.deltaLoopCtx.Done():
+				return
+			}
+			continue
+		}
+		if bulkPaused {
+			logging.Info().Msg("Bulk local operation finished; reconciling with OneDrive")
+			bulkPaused = false
+		}
+
+		var ok bool
+		if endCycle, ok = f.deltaScheduler.acquire(f.deltaLoopCtx, f.deltaLoopStop); !ok {
+			return
+		}
+
 		// get deltas
 		logging.Debug().Msg("Starting delta fetch cycle")
+		cycleStart := time.Now()
 		logging.Trace().Msg("Fetching deltas from server.")
 		pollSuccess := false
 		deltas := make(map[string]*graph.DriveItem)
@@ -345,8 +395,12 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 				// Lock ordering: filesystem.RWMutex only (no other locks held)
 				// See docs/guides/developer/concurrency-guidelines.md
 				f.Lock()
+				wasOnline := !f.offline
 				f.offline = true
 				f.Unlock()
+				if wasOnline {
+					f.emitActivity(ActivityOffline, "", err.Error())
+				}
 				break
 			}
 
@@ -383,7 +437,7 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 		applyCtx, applyCancel := context.WithTimeout(f.deltaLoopCtx, 1*time.Minute)
 
 	applyLoop:
-		for _, delta := range deltas {
+		for _, delta := range orderDeltas(deltas) {
 			// Check if we should stop before applying delta
 			select {
 			case <-f.deltaLoopStop:
@@ -399,11 +453,12 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 
 			err := f.applyDelta(delta)
 			// retry deletion of non-empty directories after all other deltas applied
-			if err != nil && err.Error() == "directory is non-empty" {
+			if errors.Is(err, syscall.ENOTEMPTY) {
 				secondPass = append(secondPass, delta.ID)
 			}
 		}
 
+		visible := time.Now()
 		waitDur = currentInterval
 
 		// Check if we should stop before second pass
@@ -471,6 +526,14 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 			}
 			f.offline = false
 			f.Unlock()
+			if wasOffline {
+				f.emitActivity(ActivityOnline, "", "")
+			}
+			if sampleLatency && !wasOffline {
+				f.recordRealtimeLatency(deltas, visible)
+			}
+			sampleLatency = true
+			f.metrics.recordDeltaCycle(time.Since(cycleStart))
 
 			// Switch to normal ticker if we were using offline ticker
 			if currentTicker == offlineTicker {
@@ -485,7 +548,7 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 			}
 
 			// If we were offline and now we're online, process offline changes
-			if wasOffline {
+			if wasOffline && !f.holdOfflineReplay() {
 				logging.Info().Msg("Transitioning from offline to online, processing offline changes with enhanced sync manager")
 				// Use a goroutine with proper error handling
 				f.Wg.Add(1)
@@ -494,6 +557,7 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 					defer func() {
 						if r := recover(); r != nil {
 							logging.Error().Interface("recover", r).Msg("Panic in ProcessOfflineChanges")
+							f.ReportCrash(fmt.Sprintf("panic in ProcessOfflineChanges: %v", r), debug.Stack())
 						}
 					}()
 
@@ -528,6 +592,7 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 				}(f.ctx)
 			}
 		} else {
+			sampleLatency = false
 			// Switch to offline ticker for shorter retry intervals
 			if currentTicker == ticker {
 				currentTicker = offlineTicker
@@ -550,6 +615,12 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 		}
 
 	nextCycle:
+		endCycle()
+		endCycle = nil
+
+		// The mount counts as started once the first cycle is done
+		f.markDeltaBootstrapped()
+
 		// Wait for next interval or stop signal
 		select {
 		case <-time.After(waitDur):
@@ -560,6 +631,15 @@ func (f *Filesystem) DeltaLoop(interval time.Duration) {
 		case <-currentTicker.C:
 			// Time to run the next cycle
 			logging.Debug().Msg("Ticker triggered, starting next delta cycle")
+		case <-f.resumeWake():
+			logging.Info().Msg("Resumed from sleep; reconnecting realtime and triggering immediate delta sync")
+			if f.subscriptionManager != nil {
+				f.stopRealtimeManager()
+				notificationCh, err = f.startRealtimeManager()
+				if err != nil {
+					logging.Error().Err(err).Msg("Failed to restart realtime subscription after resume; continuing with polling only")
+				}
+			}
 		case <-f.deltaLoopStop:
 			logging.Info().Msg("Stopping delta goroutine during wait interval.")
 			return
@@ -645,6 +725,7 @@ func (f *Filesystem) pollDeltas(auth *graph.Auth) ([]*graph.DriveItem, bool, err
 // * Changed content remotely, but not locally
 // * New items in a folder we have locally
 func (f *Filesystem) applyDelta(delta *graph.DriveItem) error {
+	delta.Name = f.normalizeName(delta.Name)
 	id := delta.ID
 	name := delta.Name
 	parentID := delta.Parent.ID
@@ -659,7 +740,8 @@ func (f *Filesystem) applyDelta(delta *graph.DriveItem) error {
 
 	// Ensure the parent exists in the structured metadata store. If not, skip quietly.
 	if f.metadataStore != nil {
-		if _, err := f.metadataStore.Get(ctx, parentID); err != nil {
+		parent, err := f.metadataStore.Get(ctx, parentID)
+		if err != nil {
 			if !errors.Is(err, metadata.ErrNotFound) {
 				logger.Debug().Err(err).Str("parentID", parentID).Msg("Failed to read parent metadata")
 			} else {
@@ -667,6 +749,10 @@ func (f *Filesystem) applyDelta(delta *graph.DriveItem) error {
 			}
 			return nil
 		}
+		if parent.PackageType != "" {
+			logger.Debug().Str("parentID", parentID).Msg("Skipping delta; item is part of a package")
+			return nil
+		}
 	}
 
 	// was it deleted?
@@ -675,6 +761,7 @@ func (f *Filesystem) applyDelta(delta *graph.DriveItem) error {
 		logger.Info().Str("delta", "delete").
 			Msg("Applying server-side deletion of item.")
 		_ = f.removeChildFromParent(ctx, parentID, id, delta.IsDir())
+		f.forgetRemoteConflictCopy(id)
 		f.markEntryDeleted(id)
 		f.DeleteID(id)
 		return nil
@@ -688,6 +775,12 @@ func (f *Filesystem) applyDelta(delta *graph.DriveItem) error {
 		}
 	}
 
+	// Frozen files keep their local edits; remote content goes to a conflict copy.
+	if !delta.IsDir() && !delta.IsPackage() && frozenHasLocalEdits(prior) {
+		logger.Info().Str("delta", "frozen").Msg("Item is frozen, keeping local content")
+		return f.applyFrozenDelta(ctx, prior, delta)
+	}
+
 	updated, previous, err := f.upsertDriveItemEntry(ctx, delta, time.Now().UTC())
 	if err != nil {
 		logger.Debug().Err(err).Str("id", id).Msg("Failed to upsert metadata entry for delta")
@@ -705,10 +798,14 @@ func (f *Filesystem) applyDelta(delta *graph.DriveItem) error {
 	}
 
 	// Hydrate inode cache for downstream consumers (metadata remains source of truth).
-	f.ensureInodeFromMetadataStore(updated.ID)
+	// A moved item that is already in memory is moved in place instead.
+	moved := previous != nil && (previous.ParentID != parentID || previous.Name != name)
+	if !moved || !f.moveInodeForDelta(updated, previous.ParentID) {
+		f.ensureInodeFromMetadataStore(updated.ID)
+	}
 
 	// was the item moved?
-	if previous != nil && (previous.ParentID != parentID || previous.Name != name) {
+	if moved {
 		logger.Debug().Msg("Processing move/rename delta")
 		logging.Info().
 			Str("parent", previous.ParentID).
@@ -718,15 +815,29 @@ func (f *Filesystem) applyDelta(delta *graph.DriveItem) error {
 			Str("id", id).
 			Str("delta", "rename").
 			Msg("Applying server-side rename")
+		f.notifyEntryChanged(previous.ParentID, previous.Name)
+		f.notifyEntryChanged(parentID, name)
 	}
 
-	etagChanged := previous != nil && previous.ETag != "" && delta.ETag != "" && previous.ETag != delta.ETag
+	change := classifyDelta(previous, delta)
+	if change != deltaUnchanged {
+		// Keep kernel attribute caching short for items that are actively changing.
+		f.attrCache.noteRemoteChange(id, time.Now())
+	}
+	if previous != nil && previous.CTag != "" && delta.CTag != "" && previous.CTag != delta.CTag {
+		// Thumbnails are rendered from the content the cTag stands for
+		f.invalidateThumbnails(id)
+	}
 
 	switch {
-	case delta.IsDir():
+	case delta.IsDir() || delta.IsPackage():
 		f.transitionToState(id, metadata.ItemStateHydrated, metadata.ClearPendingRemote())
 	default:
-		if etagChanged {
+		if change == deltaMetadataOnly {
+			logger.Debug().Str("delta", "metadata").
+				Msg("Only metadata changed, keeping cached content")
+		}
+		if change == deltaContentChanged {
 			logger.Info().Str("delta", "invalidate").
 				Msg("Content has changed, invalidating cache and marking file as out of sync")
 			if f.content != nil {
@@ -734,8 +845,8 @@ func (f *Filesystem) applyDelta(delta *graph.DriveItem) error {
 					logger.Warn().Err(err).Msg("Failed to delete cached content during invalidation")
 				}
 			}
-			f.handleContentEvicted(id)
-			f.MarkFileOutofSync(id)
+			// Pinned items are re-hydrated once below, not by the eviction path
+			f.markContentEvicted(id)
 
 			priorMode := metadata.PinModeUnset
 			if previous != nil {
@@ -768,12 +879,31 @@ func (f *Filesystem) applyDelta(delta *graph.DriveItem) error {
 
 			if previous.State == metadata.ItemStateDirtyLocal {
 				f.transitionToState(id, metadata.ItemStateConflict, metadata.ClearPendingRemote())
+				f.MarkFileConflict(id, "changed locally and remotely")
 			} else {
 				f.transitionToState(id, metadata.ItemStateGhost, metadata.ClearPendingRemote())
+				// Marked after the move, which drops explicit statuses
+				f.MarkFileOutofSync(id)
 			}
 		} else {
 			f.transitionToState(id, metadata.ItemStateHydrated, metadata.ClearPendingRemote())
 		}
+		if previous == nil {
+			f.adoptRemoteConflictCopy(id)
+		}
+	}
+	if change != deltaUnchanged {
+		// Drop what the kernel cached for the old version, once its content is
+		// gone from our cache; a move dropped the entry already
+		if !moved {
+			f.notifyEntryChanged(parentID, name)
+		}
+		f.notifyInodeChanged(id, change == deltaContentChanged)
+	}
+
+	// New items below a pinned folder are pinned and hydrated as they appear
+	if previous == nil || previous.ParentID != updated.ParentID {
+		f.inheritPin(id)
 	}
 
 	return nil
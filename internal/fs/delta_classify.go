@@ -0,0 +1,68 @@
+package fs
+
+import (
+	"strings"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// The eTag of an item changes on every modification, including renames, moves
+// and permission changes, so it cannot tell whether the file content changed.
+// classifyDelta compares content identifiers instead, strongest first: the
+// QuickXorHash of the cached content, then the cTag (which OneDrive only bumps
+// when content changes). Only when neither is available does an eTag change
+// alone count as a content change, so renaming or reorganizing hydrated files
+// keeps their cached content. Without an eTag change nothing is considered
+// changed at all.
+
+// deltaChange describes what a delta changed about an item already known
+// locally.
+type deltaChange int
+
+const (
+	deltaUnchanged deltaChange = iota
+	deltaMetadataOnly
+	deltaContentChanged
+)
+
+// String returns the name used in log messages.
+func (c deltaChange) String() string {
+	switch c {
+	case deltaMetadataOnly:
+		return "metadata"
+	case deltaContentChanged:
+		return "content"
+	default:
+		return "unchanged"
+	}
+}
+
+// classifyDelta reports whether the delta changed the item's content, only
+// its metadata, or nothing previous knew about.
+func classifyDelta(previous *metadata.Entry, delta *graph.DriveItem) deltaChange {
+	if previous == nil || delta == nil {
+		return deltaUnchanged
+	}
+	if previous.ETag == "" || delta.ETag == "" || previous.ETag == delta.ETag {
+		return deltaUnchanged
+	}
+
+	if delta.File != nil {
+		remoteHash := delta.File.Hashes.QuickXorHash
+		if previous.ContentHash != "" && remoteHash != "" {
+			if !strings.EqualFold(previous.ContentHash, remoteHash) {
+				return deltaContentChanged
+			}
+			return deltaMetadataOnly
+		}
+	}
+	if previous.CTag != "" && delta.CTag != "" {
+		if previous.CTag != delta.CTag {
+			return deltaContentChanged
+		}
+		return deltaMetadataOnly
+	}
+	// nothing better to go on, assume the content changed
+	return deltaContentChanged
+}
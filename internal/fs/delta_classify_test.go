@@ -0,0 +1,87 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_DeltaClassify_ContentIdentifiers(t *testing.T) {
+	previous := &metadata.Entry{ETag: "e1", CTag: "c1", Size: 6, ContentHash: "AAAA"}
+	file := func(etag, ctag, hash string, size uint64) *graph.DriveItem {
+		return &graph.DriveItem{ETag: etag, CTag: ctag, Size: size, File: &graph.File{Hashes: graph.Hashes{QuickXorHash: hash}}}
+	}
+
+	require.Equal(t, deltaUnchanged, classifyDelta(previous, file("e1", "c1", "AAAA", 6)))
+	require.Equal(t, deltaMetadataOnly, classifyDelta(previous, file("e2", "c1", "aaaa", 6)))
+	require.Equal(t, deltaContentChanged, classifyDelta(previous, file("e2", "c2", "BBBB", 6)))
+	require.Equal(t, deltaMetadataOnly, classifyDelta(previous, file("e2", "c2", "AAAA", 6)), "matching hashes win over the cTag")
+	require.Equal(t, deltaContentChanged, classifyDelta(previous, file("e2", "c2", "", 6)))
+	require.Equal(t, deltaMetadataOnly, classifyDelta(previous, file("e2", "c1", "", 6)))
+
+	bare := &metadata.Entry{ETag: "e1", Size: 6}
+	require.Equal(t, deltaContentChanged, classifyDelta(bare, file("e2", "", "", 6)), "eTag is the fallback")
+	require.Equal(t, deltaUnchanged, classifyDelta(bare, file("", "", "", 7)))
+	require.Equal(t, deltaUnchanged, classifyDelta(nil, file("e2", "c2", "", 6)))
+}
+
+func TestUT_FS_DeltaClassify_RenameKeepsCachedContent(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+
+	parent := NewInode("parent", fuse.S_IFDIR|0755, nil)
+	parent.DriveItem.ID = "parent"
+	registerHydratedEntry(t, fs, parent)
+	other := NewInode("other", fuse.S_IFDIR|0755, nil)
+	other.DriveItem.ID = "other"
+	registerHydratedEntry(t, fs, other)
+
+	doc := NewInodeDriveItem(&graph.DriveItem{
+		ID:     "doc",
+		Name:   "report.txt",
+		ETag:   "e1",
+		CTag:   "c1",
+		Size:   6,
+		Parent: &graph.DriveItemParent{ID: "parent"},
+		File:   &graph.File{},
+	})
+	registerHydratedEntry(t, fs, doc)
+	fs.InsertChild(parent.ID(), doc)
+	require.NoError(t, fs.content.Insert(doc.ID(), []byte("123456")))
+
+	now := time.Now().UTC()
+	require.NoError(t, fs.applyDelta(&graph.DriveItem{
+		ID:      "doc",
+		Name:    "final-report.txt",
+		ETag:    "e2",
+		CTag:    "c1",
+		Size:    6,
+		ModTime: &now,
+		Parent:  &graph.DriveItemParent{ID: "other"},
+		File:    &graph.File{},
+	}))
+	entry, err := fs.GetMetadataEntry("doc")
+	require.NoError(t, err)
+	require.Equal(t, "final-report.txt", entry.Name)
+	require.Equal(t, "other", entry.ParentID)
+	require.Equal(t, metadata.ItemStateHydrated, entry.State)
+	require.True(t, fs.content.HasContent("doc"), "a move must not invalidate cached content")
+
+	require.NoError(t, fs.applyDelta(&graph.DriveItem{
+		ID:      "doc",
+		Name:    "final-report.txt",
+		ETag:    "e3",
+		CTag:    "c2",
+		Size:    6,
+		ModTime: &now,
+		Parent:  &graph.DriveItemParent{ID: "other"},
+		File:    &graph.File{},
+	}))
+	entry, err = fs.GetMetadataEntry("doc")
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateGhost, entry.State)
+	require.False(t, fs.content.HasContent("doc"), "a content change invalidates the cache")
+}
@@ -0,0 +1,63 @@
+package fs
+
+import (
+	"sort"
+
+	"github.com/auriora/onemount/internal/graph"
+)
+
+// A delta cycle stages every item it fetches by ID, so an item delivered on
+// several pages is applied once, with the last version received. Graph does
+// not deliver pages in parent order: a new folder's children can arrive
+// before the folder itself. applyDelta skips items whose parent is not known
+// yet, so orderDeltas sorts the staged items before they are applied.
+
+// orderDeltas returns the staged deltas of a cycle in the order they can be
+// applied: new and changed items after their parent, then deletions with
+// children before their parent. Items without a staged parent keep the order
+// of their IDs, so a cycle applies the same way every time.
+func orderDeltas(staged map[string]*graph.DriveItem) []*graph.DriveItem {
+	ids := make([]string, 0, len(staged))
+	for id := range staged {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	ordered := make([]*graph.DriveItem, 0, len(staged))
+	var deletions []*graph.DriveItem
+	visited := make(map[string]bool, len(staged))
+	var visit func(item *graph.DriveItem, deleted bool)
+	visit = func(item *graph.DriveItem, deleted bool) {
+		if visited[item.ID] {
+			// Already placed, or a parent cycle from moves within the cycle
+			return
+		}
+		visited[item.ID] = true
+		if item.Parent != nil {
+			if parent, ok := staged[item.Parent.ID]; ok && (parent.Deleted != nil) == deleted {
+				visit(parent, deleted)
+			}
+		}
+		if deleted {
+			deletions = append(deletions, item)
+		} else {
+			ordered = append(ordered, item)
+		}
+	}
+	for _, id := range ids {
+		if item := staged[id]; item.Deleted == nil {
+			visit(item, false)
+		}
+	}
+	for _, id := range ids {
+		if item := staged[id]; item.Deleted != nil {
+			visit(item, true)
+		}
+	}
+
+	// Deletions were placed parents first
+	for i := len(deletions) - 1; i >= 0; i-- {
+		ordered = append(ordered, deletions[i])
+	}
+	return ordered
+}
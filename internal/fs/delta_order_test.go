@@ -0,0 +1,75 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+func stagedIDs(items []*graph.DriveItem) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestUT_FS_DeltaOrder_ParentsFirstDeletionsChildrenFirst(t *testing.T) {
+	staged := map[string]*graph.DriveItem{
+		"a-child":  {ID: "a-child", Parent: &graph.DriveItemParent{ID: "b-folder"}},
+		"b-folder": {ID: "b-folder", Parent: &graph.DriveItemParent{ID: "c-top"}, Folder: &graph.Folder{}},
+		"c-top":    {ID: "c-top", Parent: &graph.DriveItemParent{ID: "root"}, Folder: &graph.Folder{}},
+		"d-gone":   {ID: "d-gone", Parent: &graph.DriveItemParent{ID: "root"}, Deleted: &graph.Deleted{}},
+		"e-gone":   {ID: "e-gone", Parent: &graph.DriveItemParent{ID: "d-gone"}, Deleted: &graph.Deleted{}},
+		"f-orphan": {ID: "f-orphan"},
+	}
+
+	require.Equal(t,
+		[]string{"c-top", "b-folder", "a-child", "f-orphan", "e-gone", "d-gone"},
+		stagedIDs(orderDeltas(staged)))
+}
+
+func TestUT_FS_DeltaOrder_ToleratesParentCycles(t *testing.T) {
+	staged := map[string]*graph.DriveItem{
+		"a": {ID: "a", Parent: &graph.DriveItemParent{ID: "b"}, Folder: &graph.Folder{}},
+		"b": {ID: "b", Parent: &graph.DriveItemParent{ID: "a"}, Folder: &graph.Folder{}},
+	}
+
+	require.ElementsMatch(t, []string{"a", "b"}, stagedIDs(orderDeltas(staged)))
+}
+
+func TestUT_FS_DeltaOrder_ChildBeforeNewParentIsApplied(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	root := NewInodeDriveItem(&graph.DriveItem{ID: "root", Name: "root", Folder: &graph.Folder{}})
+	registerHydratedEntry(t, fs, root)
+	fs.root = root.ID()
+
+	// The child sorts, and is delivered, before its new parent folder
+	staged := map[string]*graph.DriveItem{
+		"a-doc": {
+			ID:     "a-doc",
+			Name:   "notes.txt",
+			Parent: &graph.DriveItemParent{ID: "b-folder"},
+			File:   &graph.File{},
+		},
+		"b-folder": {
+			ID:     "b-folder",
+			Name:   "projects",
+			Parent: &graph.DriveItemParent{ID: "root"},
+			Folder: &graph.Folder{},
+		},
+	}
+	for _, delta := range orderDeltas(staged) {
+		require.NoError(t, fs.applyDelta(delta))
+	}
+
+	_, err := fs.metadataStore.Get(fs.jobContext(), "a-doc")
+	require.NoError(t, err, "the child must not be skipped for a missing parent")
+	folder := fs.GetID("b-folder")
+	require.NotNil(t, folder)
+	child, err := fs.GetChild("b-folder", "notes.txt", nil)
+	require.NoError(t, err)
+	require.Equal(t, "a-doc", child.ID())
+	require.Len(t, folder.children, 1, "applying a cycle must not duplicate children")
+}
@@ -0,0 +1,138 @@
+package fs
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// A delta that renames or moves an item still carries the item's ID, so the
+// item is moved where it is rather than rebuilt from metadata. The inode keeps
+// its node ID, and with it the kernel's references and open handles, its
+// local changes and its cached content, which the content cache keys by ID.
+// The in-memory children of the old and new parent are updated, and the
+// kernel is told to drop its cached entries for the old and the new name, so
+// the next lookup of either asks us again.
+
+// kernelNotifier invalidates kernel caches. *fuse.Server implements it.
+type kernelNotifier interface {
+	EntryNotify(parent uint64, name string) fuse.Status
+	InodeNotify(node uint64, off int64, length int64) fuse.Status
+}
+
+// kernelNotify holds the FUSE server once it started. The zero value is ready
+// to use and notifies nothing.
+type kernelNotify struct {
+	mu     sync.RWMutex
+	server kernelNotifier
+}
+
+// Init is called by go-fuse with the server before it serves requests.
+func (f *Filesystem) Init(server *fuse.Server) {
+	f.kernelNotify.mu.Lock()
+	f.kernelNotify.server = server
+	f.kernelNotify.mu.Unlock()
+}
+
+// notifyEntryChanged tells the kernel to forget what it cached for name in
+// the directory parentID. It must not be called while serving a request.
+func (f *Filesystem) notifyEntryChanged(parentID, name string) {
+	f.kernelNotify.mu.RLock()
+	server := f.kernelNotify.server
+	f.kernelNotify.mu.RUnlock()
+	if server == nil {
+		return
+	}
+	parent := f.GetID(parentID)
+	if parent == nil || parent.NodeID() == 0 {
+		return
+	}
+	// ENOENT only means the kernel had nothing cached.
+	if status := server.EntryNotify(parent.NodeID(), name); status != fuse.OK && status != fuse.ENOENT {
+		logging.Debug().Str("parentID", parentID).Str("name", name).Str("status", status.String()).
+			Msg("Kernel entry notification failed")
+	}
+}
+
+// notifyInodeChanged tells the kernel to forget the attributes it cached for
+// the item id, and its cached pages too when content is set. It must not be
+// called while serving a request.
+func (f *Filesystem) notifyInodeChanged(id string, content bool) {
+	f.kernelNotify.mu.RLock()
+	server := f.kernelNotify.server
+	f.kernelNotify.mu.RUnlock()
+	if server == nil {
+		return
+	}
+	inode := f.GetID(id)
+	if inode == nil || inode.NodeID() == 0 {
+		return
+	}
+	// A negative offset keeps the cached pages
+	off := int64(-1)
+	if content {
+		off = 0
+	}
+	if status := server.InodeNotify(inode.NodeID(), off, 0); status != fuse.OK && status != fuse.ENOENT {
+		logging.Debug().Str("id", id).Str("status", status.String()).
+			Msg("Kernel inode notification failed")
+	}
+}
+
+// moveInodeForDelta moves the in-memory inode of entry from oldParentID to
+// the entry's parent and name. It reports false when the item has no inode in
+// memory, which leaves nothing to preserve.
+func (f *Filesystem) moveInodeForDelta(entry *metadata.Entry, oldParentID string) bool {
+	inode := f.GetID(entry.ID)
+	if inode == nil {
+		return false
+	}
+	fresh := f.inodeFromMetadataEntry(entry)
+	if fresh == nil {
+		return false
+	}
+	isDir := inode.IsDir()
+
+	if oldParentID != entry.ParentID {
+		if parent := f.GetID(oldParentID); parent != nil {
+			parent.mu.Lock()
+			for i, child := range parent.children {
+				if child == entry.ID {
+					parent.children = append(parent.children[:i], parent.children[i+1:]...)
+					if isDir && parent.subdir > 0 {
+						parent.subdir--
+					}
+					break
+				}
+			}
+			parent.mu.Unlock()
+		}
+		// A parent whose children were never listed reads them from the
+		// metadata store, which already has the move.
+		if parent := f.GetID(entry.ParentID); parent != nil {
+			parent.mu.Lock()
+			if parent.children != nil && !slices.Contains(parent.children, entry.ID) {
+				parent.children = append(parent.children, entry.ID)
+				if isDir {
+					parent.subdir++
+				}
+			}
+			parent.mu.Unlock()
+		}
+	}
+
+	inode.mu.Lock()
+	if inode.hasChanges {
+		// Local edits are uploaded from this inode; only its place changes.
+		inode.DriveItem.Name = entry.Name
+		inode.DriveItem.Parent = &graph.DriveItemParent{ID: entry.ParentID}
+	} else {
+		inode.DriveItem = fresh.DriveItem
+	}
+	inode.mu.Unlock()
+	return true
+}
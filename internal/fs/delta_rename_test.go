@@ -0,0 +1,139 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier records kernel entry and inode notifications.
+type recordingNotifier struct {
+	entries []string
+	inodes  []int64 // offsets, -1 for attributes only
+}
+
+func (r *recordingNotifier) EntryNotify(parent uint64, name string) fuse.Status {
+	r.entries = append(r.entries, name)
+	return fuse.OK
+}
+
+func (r *recordingNotifier) InodeNotify(node uint64, off int64, length int64) fuse.Status {
+	r.inodes = append(r.inodes, off)
+	return fuse.OK
+}
+
+func newRenameTestFile(t *testing.T) (*Filesystem, *Inode, *Inode, *Inode) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+	src := NewInodeDriveItem(&graph.DriveItem{ID: "src", Name: "inbox", Folder: &graph.Folder{}})
+	registerHydratedEntry(t, fs, src)
+	dst := NewInodeDriveItem(&graph.DriveItem{ID: "dst", Name: "archive", Folder: &graph.Folder{}})
+	registerHydratedEntry(t, fs, dst)
+	doc := NewInodeDriveItem(&graph.DriveItem{
+		ID:     "doc",
+		Name:   "report.txt",
+		ETag:   "e1",
+		CTag:   "c1",
+		Size:   6,
+		Parent: &graph.DriveItemParent{ID: "src"},
+		File:   &graph.File{},
+	})
+	registerHydratedEntry(t, fs, doc)
+	fs.InsertChild(src.ID(), doc)
+	fs.InsertChild(dst.ID(), NewInodeDriveItem(&graph.DriveItem{
+		ID:     "old",
+		Name:   "old.txt",
+		Parent: &graph.DriveItemParent{ID: "dst"},
+		File:   &graph.File{},
+	}))
+	require.NoError(t, fs.content.Insert(doc.ID(), []byte("123456")))
+	return fs, src, dst, doc
+}
+
+func renameDelta(name, parent string) *graph.DriveItem {
+	now := time.Now().UTC()
+	return &graph.DriveItem{
+		ID:      "doc",
+		Name:    name,
+		ETag:    "e2",
+		CTag:    "c1",
+		Size:    6,
+		ModTime: &now,
+		Parent:  &graph.DriveItemParent{ID: parent},
+		File:    &graph.File{},
+	}
+}
+
+func TestUT_FS_DeltaRename_MovesInodeInPlace(t *testing.T) {
+	fs, src, dst, doc := newRenameTestFile(t)
+	nodeID := doc.NodeID()
+
+	require.NoError(t, fs.applyDelta(renameDelta("final.txt", "dst")))
+
+	require.Same(t, doc, fs.GetID("doc"), "the inode must not be rebuilt")
+	require.Same(t, doc, fs.GetNodeID(nodeID), "the kernel's node ID must keep working")
+	require.Equal(t, "final.txt", doc.Name())
+	require.Equal(t, "dst", doc.ParentID())
+	require.Equal(t, "e2", doc.DriveItem.ETag)
+	require.True(t, fs.content.HasContent("doc"))
+
+	require.NotContains(t, src.children, "doc")
+	require.Contains(t, dst.children, "doc")
+	child, err := fs.GetChild("dst", "final.txt", nil)
+	require.NoError(t, err)
+	require.Same(t, doc, child)
+}
+
+func TestUT_FS_DeltaRename_KeepsLocalChanges(t *testing.T) {
+	fs, _, _, doc := newRenameTestFile(t)
+	doc.mu.Lock()
+	doc.hasChanges = true
+	doc.DriveItem.Size = 12
+	doc.mu.Unlock()
+
+	require.NoError(t, fs.applyDelta(renameDelta("renamed.txt", "src")))
+
+	require.Same(t, doc, fs.GetID("doc"))
+	require.True(t, doc.HasChanges())
+	require.Equal(t, "renamed.txt", doc.Name())
+	require.Equal(t, uint64(12), doc.Size(), "local edits are not replaced by remote metadata")
+}
+
+func TestUT_FS_DeltaRename_NotifiesKernelOfBothNames(t *testing.T) {
+	fs, _, _, _ := newRenameTestFile(t)
+	kernel := &recordingNotifier{}
+	fs.kernelNotify.server = kernel
+
+	require.NoError(t, fs.applyDelta(renameDelta("final.txt", "dst")))
+	require.Equal(t, []string{"report.txt", "final.txt"}, kernel.entries)
+
+	kernel.entries = nil
+	require.NoError(t, fs.applyDelta(renameDelta("final.txt", "dst")))
+	require.Empty(t, kernel.entries, "an unchanged item is not a rename")
+}
+
+func TestUT_FS_DeltaRename_RemoteChangeInvalidatesKernelCache(t *testing.T) {
+	fs, _, _, doc := newRenameTestFile(t)
+	kernel := &recordingNotifier{}
+	fs.kernelNotify.server = kernel
+
+	delta := renameDelta("report.txt", "src")
+	require.NoError(t, fs.applyDelta(delta))
+	require.Equal(t, []string{"report.txt"}, kernel.entries)
+	require.Equal(t, []int64{-1}, kernel.inodes, "a metadata change keeps the cached pages")
+
+	kernel.entries, kernel.inodes = nil, nil
+	delta.ETag, delta.CTag = "e3", "c3"
+	require.NoError(t, fs.applyDelta(delta))
+	require.Equal(t, []string{"report.txt"}, kernel.entries)
+	require.Equal(t, []int64{0}, kernel.inodes, "a content change drops the cached pages")
+	require.False(t, fs.content.HasContent(doc.ID()))
+
+	kernel.entries, kernel.inodes = nil, nil
+	require.NoError(t, fs.applyDelta(delta))
+	require.Empty(t, kernel.entries)
+	require.Empty(t, kernel.inodes, "an unchanged item is left cached")
+}
@@ -0,0 +1,49 @@
+package fs
+
+import (
+	"context"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Each mount polls OneDrive for changes on its own timer. When one process
+// serves several mounts, they share a DeltaScheduler that lets only a few of
+// them run a delta cycle at a time, so that the mounts don't all fetch and
+// apply changes at the same moment, such as after a resume or when the
+// network comes back.
+
+// DeltaScheduler limits how many delta cycles the filesystems sharing it run
+// at once. A nil DeltaScheduler runs every cycle right away.
+type DeltaScheduler struct {
+	slots chan struct{}
+}
+
+// NewDeltaScheduler returns a scheduler running at most concurrent delta
+// cycles at once, at least one.
+func NewDeltaScheduler(concurrent int) *DeltaScheduler {
+	if concurrent < 1 {
+		concurrent = 1
+	}
+	return &DeltaScheduler{slots: make(chan struct{}, concurrent)}
+}
+
+// acquire waits until a delta cycle may run. It returns the function ending
+// the cycle, or false when ctx ended or stop was closed first.
+func (s *DeltaScheduler) acquire(ctx context.Context, stop <-chan struct{}) (func(), bool) {
+	if s == nil {
+		return func() {}, true
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		logging.Debug().Msg("Waiting for the delta cycles of other mounts")
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, false
+		case <-stop:
+			return nil, false
+		}
+	}
+	return func() { <-s.slots }, true
+}
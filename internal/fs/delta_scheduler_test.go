@@ -0,0 +1,37 @@
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_DeltaScheduler_LimitsConcurrentCycles(t *testing.T) {
+	var unshared *DeltaScheduler
+	end, ok := unshared.acquire(context.Background(), nil)
+	require.True(t, ok, "a mount of its own never waits")
+	end()
+
+	scheduler := NewDeltaScheduler(1)
+	endFirst, ok := scheduler.acquire(context.Background(), nil)
+	require.True(t, ok)
+
+	stop := make(chan struct{})
+	close(stop)
+	_, ok = scheduler.acquire(context.Background(), stop)
+	require.False(t, ok, "a stopped mount gives up waiting")
+
+	acquired := make(chan func())
+	go func() {
+		end, _ := scheduler.acquire(context.Background(), nil)
+		acquired <- end
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("a second cycle ran while the first was running")
+	default:
+	}
+	endFirst()
+	(<-acquired)()
+}
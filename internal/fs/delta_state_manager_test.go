@@ -42,6 +42,7 @@ func newTestFilesystemWithMetadata(t *testing.T) *Filesystem {
 			sessionPriorities:          make(map[string]UploadPriority),
 			pendingHighPriorityUploads: make(map[string]bool),
 			pendingLowPriorityUploads:  make(map[string]bool),
+			revisions:                  make(map[string]UploadPriority),
 			shutdownContext:            context.Background(),
 			shutdownCancel:             func() {},
 		},
@@ -0,0 +1,101 @@
+package fs
+
+import (
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// OneDrive items can carry a free-text description. It is exposed as the
+// writable user.onemount.description attribute, so files can be annotated
+// with setfattr and scripts:
+//
+//	setfattr -n user.onemount.description -v "Signed copy" contract.pdf
+//
+// A write updates the item locally at once and queues a PATCH on the mutation
+// queue; delta brings back descriptions changed elsewhere. Removing the
+// attribute clears the description. Items not uploaded yet and offline mounts
+// refuse changes with EAGAIN, since the PATCH could not be sent.
+const xattrDescription = "user.onemount.description"
+
+var (
+	// ErrDescriptionNotUploaded is returned for items OneDrive does not know yet.
+	ErrDescriptionNotUploaded = errors.New("item has not been uploaded yet")
+	// ErrDescriptionOffline is returned for description changes while offline.
+	// It also matches ErrOffline.
+	ErrDescriptionOffline = errors.NewKind("descriptions cannot be changed while offline", errors.ErrOffline)
+	// ErrInvalidDescription is returned for descriptions that are not UTF-8.
+	ErrInvalidDescription = errors.New("description must be UTF-8 text")
+)
+
+// SetDescription changes the OneDrive description of an item. An empty
+// description removes it.
+func (f *Filesystem) SetDescription(id, description string) error {
+	if !utf8.ValidString(description) {
+		return ErrInvalidDescription
+	}
+	if isLocalID(id) {
+		return ErrDescriptionNotUploaded
+	}
+	if f.IsOffline() {
+		return ErrDescriptionOffline
+	}
+	inode := f.GetID(id)
+	if inode == nil {
+		return metadata.ErrNotFound
+	}
+
+	inode.mu.Lock()
+	inode.DriveItem.Description = description
+	inode.mu.Unlock()
+	if f.metadataStore != nil {
+		_, err := f.UpdateMetadataEntry(id, func(entry *metadata.Entry) error {
+			entry.Description = description
+			return nil
+		})
+		if err != nil && !errors.Is(err, metadata.ErrNotFound) {
+			return err
+		}
+	}
+
+	if f.auth == nil {
+		return nil
+	}
+	f.runMutationWithRetry("description", id, func() error {
+		return graph.SetDescription(id, description, f.auth)
+	})
+	return nil
+}
+
+// Description returns the OneDrive description of an item.
+func (f *Filesystem) Description(id string) string {
+	inode := f.GetID(id)
+	if inode == nil {
+		return ""
+	}
+	inode.mu.RLock()
+	defer inode.mu.RUnlock()
+	return inode.DriveItem.Description
+}
+
+// descriptionXAttrStatus maps a SetDescription error to a FUSE status.
+func descriptionXAttrStatus(err error, id string) fuse.Status {
+	switch {
+	case err == nil:
+		return fuse.OK
+	case errors.Is(err, ErrInvalidDescription):
+		return fuse.EINVAL
+	case errors.Is(err, ErrDescriptionNotUploaded), errors.Is(err, ErrDescriptionOffline):
+		return fuse.Status(syscall.EAGAIN)
+	case errors.Is(err, metadata.ErrNotFound):
+		return fuse.ENOENT
+	default:
+		logging.Warn().Err(err).Str("id", id).Msg("Failed to change description")
+		return fuse.EIO
+	}
+}
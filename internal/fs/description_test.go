@@ -0,0 +1,73 @@
+package fs
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func getXAttrString(t *testing.T, fs *Filesystem, inode *Inode, name string) (string, fuse.Status) {
+	t.Helper()
+	buf := make([]byte, 256)
+	n, status := fs.GetXAttr(nil, &fuse.InHeader{NodeId: inode.NodeID()}, name, buf)
+	return string(buf[:n]), status
+}
+
+func TestUT_FS_Description_XAttrRoundTrip(t *testing.T) {
+	fs, _, file := setupPolicyTree(t)
+	in := &fuse.SetXAttrIn{InHeader: fuse.InHeader{NodeId: file.NodeID()}}
+
+	_, status := getXAttrString(t, fs, file, xattrDescription)
+	require.Equal(t, fuse.Status(syscall.ENODATA), status)
+
+	require.Equal(t, fuse.OK, fs.SetXAttr(nil, in, xattrDescription, []byte("Signed copy")))
+	value, status := getXAttrString(t, fs, file, xattrDescription)
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, "Signed copy", value)
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, "Signed copy", entry.Description, "the description is persisted")
+
+	file.mu.RLock()
+	names := xattrNamesLocked(file)
+	file.mu.RUnlock()
+	require.Contains(t, names, xattrDescription)
+
+	require.Equal(t, fuse.EINVAL, fs.SetXAttr(nil, in, xattrDescription, []byte{0xff, 0xfe}))
+
+	require.Equal(t, fuse.OK, fs.RemoveXAttr(nil, &in.InHeader, xattrDescription))
+	require.Empty(t, fs.Description(file.ID()))
+	require.Equal(t, fuse.Status(syscall.ENODATA), fs.RemoveXAttr(nil, &in.InHeader, xattrDescription))
+}
+
+func TestUT_FS_Description_RefusedUntilUploadedOrOnline(t *testing.T) {
+	fs, dir, _ := setupPolicyTree(t)
+	local := NewInode("draft.md", fuse.S_IFREG|0644, dir)
+	local.DriveItem.ID = "local-draft"
+	registerHydratedEntry(t, fs, local)
+
+	require.ErrorIs(t, fs.SetDescription(local.ID(), "notes"), ErrDescriptionNotUploaded)
+	require.Equal(t, fuse.Status(syscall.EAGAIN),
+		fs.SetXAttr(nil, &fuse.SetXAttrIn{InHeader: fuse.InHeader{NodeId: local.NodeID()}}, xattrDescription, []byte("notes")))
+
+	fs.offline = true
+	require.ErrorIs(t, fs.SetDescription(dir.ID(), "notes"), ErrDescriptionOffline)
+}
+
+func TestUT_FS_Description_ReconciledByDelta(t *testing.T) {
+	fs, _, file := setupPolicyTree(t)
+	require.NoError(t, fs.SetDescription(file.ID(), "draft"))
+
+	fs.updateMetadataFromDelta(file.ID(), &graph.DriveItem{ID: file.ID(), Description: "final"})
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, "final", entry.Description)
+
+	fs.updateMetadataFromDelta(file.ID(), &graph.DriveItem{ID: file.ID()})
+	entry, err = fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Empty(t, entry.Description, "a description removed on OneDrive is removed locally")
+}
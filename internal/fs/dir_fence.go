@@ -0,0 +1,176 @@
+package fs
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Moving or renaming an item changes the path of everything below it, and
+// operations on those items that were started before the move can finish
+// after it. Without ordering, a download queued mid-rename records the old
+// path, and an upload that completes while its file is moved puts the new
+// ID into the old parent's children.
+//
+// Each directory has a fence. Operations on an item hold the fences of the
+// directories above it shared for the short step that reads the item's
+// place or attaches to its parent: queueing a download, starting a job,
+// replacing the item's ID after an upload. A move holds the fences of the old
+// and new parent, and of the item itself when it is a directory, exclusively
+// while it relinks the item and re-paths the work in flight below it. It
+// waits for the steps in progress and keeps new ones out until then; long
+// work, like the transfer itself, holds no fence. Fences are taken in ID
+// order, so holders of several never deadlock.
+
+// dirFences holds the fences of the directories in use. The zero value is
+// ready to use.
+type dirFences struct {
+	mu     sync.Mutex
+	fences map[string]*dirFence
+}
+
+type dirFence struct {
+	sync.RWMutex
+	users int // holders and waiters; the fence is dropped at zero
+}
+
+func (d *dirFences) get(id string) *dirFence {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fences == nil {
+		d.fences = make(map[string]*dirFence)
+	}
+	fence, ok := d.fences[id]
+	if !ok {
+		fence = &dirFence{}
+		d.fences[id] = fence
+	}
+	fence.users++
+	return fence
+}
+
+func (d *dirFences) put(id string, fence *dirFence) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fence.users--
+	if fence.users == 0 {
+		delete(d.fences, id)
+	}
+}
+
+// hold takes the fences of ids, exclusively or shared, and returns the
+// function releasing them.
+func (d *dirFences) hold(ids []string, exclusive bool) func() {
+	ids = slices.Clone(ids)
+	ids = slices.DeleteFunc(ids, func(id string) bool { return id == "" })
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	held := make([]*dirFence, len(ids))
+	for i, id := range ids {
+		held[i] = d.get(id)
+		if exclusive {
+			held[i].Lock()
+		} else {
+			held[i].RLock()
+		}
+	}
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			if exclusive {
+				held[i].Unlock()
+			} else {
+				held[i].RUnlock()
+			}
+			d.put(ids[i], held[i])
+		}
+	}
+}
+
+// ancestorIDs returns the IDs of the directories above inode, nearest first.
+func (f *Filesystem) ancestorIDs(inode *Inode) []string {
+	var ids []string
+	for parentID := inode.ParentID(); parentID != ""; {
+		if slices.Contains(ids, parentID) {
+			break // a cycle would be a bug elsewhere; do not spin on it
+		}
+		ids = append(ids, parentID)
+		parent := f.GetID(parentID)
+		if parent == nil {
+			break
+		}
+		parentID = parent.ParentID()
+	}
+	return ids
+}
+
+// fenceItem holds the fences of the directories above inode shared and
+// returns the function releasing them. A move that completes while they are
+// taken changes the ancestors, so they are taken again.
+func (f *Filesystem) fenceItem(inode *Inode) func() {
+	for attempt := 0; ; attempt++ {
+		ancestors := f.ancestorIDs(inode)
+		release := f.fences.hold(ancestors, false)
+		if attempt == 2 || slices.Equal(ancestors, f.ancestorIDs(inode)) {
+			return release
+		}
+		release()
+	}
+}
+
+// fenceMove holds the fences a move of an item from oldParentID to
+// newParentID needs exclusively: both parents, and dirID, the item itself,
+// when it is a directory. It returns the function releasing them.
+func (f *Filesystem) fenceMove(oldParentID, newParentID, dirID string) func() {
+	return f.fences.hold([]string{oldParentID, newParentID, dirID}, true)
+}
+
+// rebasePath returns path with its prefix oldPath replaced by newPath, and
+// whether path is oldPath or below it.
+func rebasePath(path, oldPath, newPath string) (string, bool) {
+	if path == oldPath {
+		return newPath, true
+	}
+	if rest, ok := strings.CutPrefix(path, strings.TrimSuffix(oldPath, "/")+"/"); ok {
+		return strings.TrimSuffix(newPath, "/") + "/" + rest, true
+	}
+	return path, false
+}
+
+// repathChildren updates the parent paths of the cached items below dir after
+// it moved. The caller holds the fences of the move.
+func (f *Filesystem) repathChildren(dir *Inode) {
+	queue := []*Inode{dir}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		parentPath := parent.Path()
+		for _, id := range parent.GetChildren() {
+			entry, ok := f.metadata.Load(id)
+			if !ok {
+				continue
+			}
+			child := entry.(*Inode)
+			child.mu.Lock()
+			if child.DriveItem.Parent != nil {
+				child.DriveItem.Parent.Path = parentPath
+			}
+			child.mu.Unlock()
+			if child.IsDir() {
+				queue = append(queue, child)
+			}
+		}
+	}
+}
+
+// repathInFlight moves the paths of the downloads and jobs in progress at or
+// below oldPath to newPath. The caller holds the fences of the move.
+func (f *Filesystem) repathInFlight(oldPath, newPath string) {
+	if oldPath == newPath {
+		return
+	}
+	if f.downloads != nil {
+		f.downloads.repath(oldPath, newPath)
+	}
+	f.jobs.repath(oldPath, newPath)
+}
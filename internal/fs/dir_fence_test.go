@@ -0,0 +1,146 @@
+package fs
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFenceTree returns a filesystem holding /Projects/inbox and /Archive,
+// with a download manager that queues but never downloads.
+func setupFenceTree(t *testing.T) (fs *Filesystem, projects, archive, inbox *Inode) {
+	t.Helper()
+	fs = newTestFilesystemWithMetadata(t)
+	fs.downloads = &DownloadManager{
+		fs:       fs,
+		sessions: make(map[string]*DownloadSession),
+		queue:    make(chan string, 1024),
+		db:       fs.db,
+	}
+	root := NewInodeDriveItem(&graph.DriveItem{ID: "root", Name: "root", Folder: &graph.Folder{}})
+	fs.root = root.ID()
+	registerHydratedEntry(t, fs, root)
+	dir := func(id, name string, parent *Inode) *Inode {
+		inode := NewInodeDriveItem(&graph.DriveItem{
+			ID: id, Name: name, Folder: &graph.Folder{}, Parent: &graph.DriveItemParent{ID: parent.ID(), Path: parent.Path()},
+		})
+		registerHydratedEntry(t, fs, inode)
+		fs.InsertChild(parent.ID(), inode)
+		return inode
+	}
+	projects = dir("projects", "Projects", root)
+	archive = dir("archive", "Archive", root)
+	inbox = dir("inbox", "inbox", projects)
+	return fs, projects, archive, inbox
+}
+
+func addFenceFile(t *testing.T, fs *Filesystem, id, name string, parent *Inode) *Inode {
+	t.Helper()
+	file := NewInodeDriveItem(&graph.DriveItem{
+		ID: id, Name: name, File: &graph.File{}, Parent: &graph.DriveItemParent{ID: parent.ID(), Path: parent.Path()},
+	})
+	registerHydratedEntry(t, fs, file)
+	fs.InsertChild(parent.ID(), file)
+	return file
+}
+
+func TestUT_FS_DirFence_MoveKeepsChildrenAndRepathsWork(t *testing.T) {
+	fs, _, _, inbox := setupFenceTree(t)
+	doc := addFenceFile(t, fs, "doc", "report.txt", inbox)
+	local := addFenceFile(t, fs, "local-new", "draft.txt", inbox)
+	nodeID := local.NodeID()
+
+	session, err := fs.downloads.QueueDownload("doc")
+	require.NoError(t, err)
+	require.Equal(t, "/Projects/inbox/report.txt", session.GetPath())
+	hydrating := make(chan struct{})
+	defer close(hydrating)
+	jobID, err := fs.startOfflineJob("doc", func(string) error { <-hydrating; return nil })
+	require.NoError(t, err)
+
+	require.NoError(t, fs.MovePath("projects", "archive", "inbox", "done", nil))
+
+	require.Same(t, inbox, fs.GetID("inbox"))
+	require.Equal(t, "/Archive/done/report.txt", doc.Path())
+	require.ElementsMatch(t, []string{"doc", "local-new"}, inbox.GetChildren(), "the children move along")
+	require.Same(t, local, fs.GetNodeID(nodeID))
+	require.Empty(t, fs.uploads.deletionQueue, "uploads below the directory are not cancelled")
+
+	require.Equal(t, "/Archive/done/report.txt", session.GetPath(), "queued downloads follow the move")
+	job, ok := fs.Job(jobID)
+	require.True(t, ok)
+	require.Equal(t, "/Archive/done/report.txt", job.Path)
+}
+
+// TestUT_FS_DirFence_RenameDuringUploadStress renames a directory back and
+// forth between two parents while the uploads of some of its files complete
+// and downloads of the others are queued.
+func TestUT_FS_DirFence_RenameDuringUploadStress(t *testing.T) {
+	fs, projects, archive, inbox := setupFenceTree(t)
+	const files = 100
+	for i := 0; i < files; i++ {
+		id := fmt.Sprintf("local-%d", i)
+		addFenceFile(t, fs, id, fmt.Sprintf("new-%d.txt", i), inbox)
+		require.NoError(t, fs.content.Insert(id, []byte("new file")))
+		addFenceFile(t, fs, fmt.Sprintf("remote-doc-%d", i), fmt.Sprintf("doc-%d.txt", i), inbox)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < files; i++ {
+			from, to := projects, archive
+			if i%2 == 1 {
+				from, to = archive, projects
+			}
+			name := fmt.Sprintf("inbox-%d", i)
+			if err := fs.MovePath(from.ID(), to.ID(), inbox.Name(), name, nil); err != nil {
+				t.Errorf("rename %d: %v", i, err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// The upload of each new file completes and it gets its OneDrive ID
+		for i := 0; i < files; i++ {
+			if err := fs.MoveID(fmt.Sprintf("local-%d", i), fmt.Sprintf("remote-new-%d", i)); err != nil {
+				t.Errorf("upload %d: %v", i, err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < files; i++ {
+			if _, err := fs.downloads.QueueDownload(fmt.Sprintf("remote-doc-%d", i)); err != nil {
+				t.Errorf("download %d: %v", i, err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	require.Equal(t, []string{"inbox"}, projects.GetChildren(), "the directory ends where it was moved last")
+	require.Empty(t, archive.GetChildren())
+	require.Equal(t, "/Projects/inbox-99", inbox.Path())
+
+	children := inbox.GetChildren()
+	require.Len(t, children, 2*files)
+	for i := 0; i < files; i++ {
+		require.Contains(t, children, fmt.Sprintf("remote-new-%d", i))
+		file := fs.GetID(fmt.Sprintf("remote-new-%d", i))
+		require.Equal(t, fmt.Sprintf("/Projects/inbox-99/new-%d.txt", i), file.Path())
+	}
+
+	fs.downloads.mutex.RLock()
+	defer fs.downloads.mutex.RUnlock()
+	require.Len(t, fs.downloads.sessions, files)
+	for i := 0; i < files; i++ {
+		session := fs.downloads.sessions[fmt.Sprintf("remote-doc-%d", i)]
+		require.NotNil(t, session)
+		require.Equal(t, fmt.Sprintf("/Projects/inbox-99/doc-%d.txt", i), session.GetPath(), "queued downloads follow the moves")
+	}
+}
@@ -12,19 +12,26 @@ import (
 
 // Mkdir creates a directory.
 func (f *Filesystem) Mkdir(_ <-chan struct{}, in *fuse.MkdirIn, name string, out *fuse.EntryOut) fuse.Status {
+	name = f.normalizeName(name)
 	if isNameRestricted(name) {
 		return fuse.EINVAL
 	}
+	f.noteLocalChange()
 
 	inode := f.GetNodeID(in.NodeId)
 	if inode == nil {
 		return fuse.ENOENT
 	}
+	if status := f.rejectPackageWrite("Mkdir", inode); status != fuse.OK {
+		return status
+	}
 	id := inode.ID()
 	path := filepath.Join(inode.Path(), name)
 	if existing, _ := f.GetChild(id, name, f.auth); existing != nil {
 		return fuse.Status(syscall.EEXIST)
 	}
+	f.checkFolderGrowth(id, 1)
+	f.sendPlannedDelete(id, name)
 	ctx := logging.DefaultLogger.With().
 		Str("op", "Mkdir").
 		Uint64("nodeID", in.NodeId).
@@ -35,8 +42,12 @@ func (f *Filesystem) Mkdir(_ <-chan struct{}, in *fuse.MkdirIn, name string, out
 	ctx.Debug().Msg("")
 
 	newInode := NewInode(name, in.Mode|fuse.S_IFDIR, inode)
+	if f.StrictPOSIX() {
+		return f.mkdirStrict(id, newInode, out)
+	}
 
 	out.NodeId = f.InsertChild(id, newInode)
+	out.Generation = newInode.Generation()
 	out.Attr = newInode.makeAttr()
 	out.SetAttrTimeout(timeout)
 	out.SetEntryTimeout(timeout)
@@ -54,6 +65,7 @@ func (f *Filesystem) Mkdir(_ <-chan struct{}, in *fuse.MkdirIn, name string, out
 
 // Rmdir removes a directory if it's empty.
 func (f *Filesystem) Rmdir(cancel <-chan struct{}, in *fuse.InHeader, name string) fuse.Status {
+	name = f.normalizeName(name)
 	parent := f.GetNodeID(in.NodeId)
 	if parent == nil {
 		return fuse.ENOENT
@@ -69,41 +81,54 @@ func (f *Filesystem) Rmdir(cancel <-chan struct{}, in *fuse.InHeader, name strin
 	return f.Unlink(cancel, in, name)
 }
 
-// OpenDir provides a list of all the entries in the directory
-func (f *Filesystem) OpenDir(_ <-chan struct{}, in *fuse.OpenIn, _ *fuse.OpenOut) fuse.Status {
-	dir := f.GetNodeID(in.NodeId)
+// OpenDir opens a directory for listing. The entries are read a page at a
+// time as the directory is listed, see dirStream.
+func (f *Filesystem) OpenDir(_ <-chan struct{}, in *fuse.OpenIn, out *fuse.OpenOut) fuse.Status {
+	stream, status := f.openDirStream(in.NodeId)
+	if status != fuse.OK {
+		return status
+	}
+	f.opendirsM.Lock()
+	f.lastDirHandle++
+	fh := f.lastDirHandle
+	f.opendirs[fh] = stream
+	f.opendirsM.Unlock()
+	if out != nil {
+		out.Fh = fh
+	}
+	return fuse.OK
+}
+
+// openDirStream prepares the listing of the directory nodeID.
+func (f *Filesystem) openDirStream(nodeID uint64) (*dirStream, fuse.Status) {
+	dir := f.GetNodeID(nodeID)
 	if dir == nil {
-		logging.Debug().Uint64("nodeID", in.NodeId).Msg("OpenDir: Directory not found")
-		return fuse.ENOENT
+		logging.Debug().Uint64("nodeID", nodeID).Msg("OpenDir: Directory not found")
+		return nil, fuse.ENOENT
 	}
 	id := dir.ID()
 	if !dir.IsDir() {
-		logging.Debug().Uint64("nodeID", in.NodeId).Str("id", id).Msg("OpenDir: Not a directory")
-		return fuse.ENOTDIR
+		logging.Debug().Uint64("nodeID", nodeID).Str("id", id).Msg("OpenDir: Not a directory")
+		return nil, fuse.ENOTDIR
 	}
 	path := dir.Path()
 	ctx := logging.DefaultLogger.With().
 		Str("op", "OpenDir").
-		Uint64("nodeID", in.NodeId).
+		Uint64("nodeID", nodeID).
 		Str("id", id).
 		Str("path", path).Logger()
 	ctx.Debug().Msg("Starting OpenDir operation")
 
-	ctx.Debug().Msg("About to call GetChildrenID")
-	children, err := f.GetChildrenID(id, f.auth)
-	ctx.Debug().Err(err).Int("childrenCount", len(children)).Msg("Returned from GetChildrenID")
-
-	if err != nil {
+	if err := f.ensureChildrenKnown(dir); err != nil {
 		// not an item not found error (Lookup/Getattr will always be called
 		// before Readdir()), something has happened to our connection
 		logging.LogError(err, "Could not fetch children",
 			logging.FieldOperation, "OpenDir",
 			logging.FieldID, id,
 			logging.FieldPath, path)
-		return fuse.EREMOTEIO
+		return nil, fuse.EREMOTEIO
 	}
 
-	ctx.Debug().Msg("Getting parent directory")
 	parent := f.GetID(dir.ParentID())
 	if parent == nil {
 		// This is the parent of the mountpoint. The FUSE kernel module discards
@@ -113,78 +138,45 @@ func (f *Filesystem) OpenDir(_ <-chan struct{}, in *fuse.OpenIn, _ *fuse.OpenOut
 		parent.nodeID = math.MaxUint64
 	}
 
-	ctx.Debug().Msg("Creating entries array")
-	entries := make([]*Inode, 2)
-	entries[0] = dir
-	entries[1] = parent
-
-	ctx.Debug().Int("childrenCount", len(children)).Msg("Adding children to entries")
-	for _, child := range children {
-		entries = append(entries, child)
-	}
-
-	ctx.Debug().Int("totalEntries", len(entries)).Msg("Storing entries in opendirs map")
-	f.opendirsM.Lock()
-	f.opendirs[in.NodeId] = entries
-	f.opendirsM.Unlock()
-
 	ctx.Debug().Msg("OpenDir operation completed successfully")
-	return fuse.OK
+	return newDirStream(dir, parent), fuse.OK
 }
 
 // ReleaseDir closes a directory and purges it from memory
 func (f *Filesystem) ReleaseDir(in *fuse.ReleaseIn) {
 	f.opendirsM.Lock()
-	delete(f.opendirs, in.NodeId)
+	delete(f.opendirs, in.Fh)
 	f.opendirsM.Unlock()
 }
 
 // readDirCommon contains the common code for ReadDir and ReadDirPlus
-func (f *Filesystem) readDirCommon(cancel <-chan struct{}, in *fuse.ReadIn) ([]*Inode, fuse.Status) {
+func (f *Filesystem) readDirCommon(_ <-chan struct{}, in *fuse.ReadIn) (*dirStream, fuse.Status) {
 	f.opendirsM.RLock()
-	entries, ok := f.opendirs[in.NodeId]
+	stream, ok := f.opendirs[in.Fh]
 	f.opendirsM.RUnlock()
-	if !ok {
-		// readdir can sometimes arrive before the corresponding opendir, so we force it
-		status := f.OpenDir(cancel, &fuse.OpenIn{InHeader: in.InHeader}, nil)
-		if status != fuse.OK {
-			return nil, status
-		}
-		f.opendirsM.RLock()
-		entries, ok = f.opendirs[in.NodeId]
-		f.opendirsM.RUnlock()
-		if !ok {
-			return nil, fuse.EBADF
-		}
-	}
-
-	if in.Offset >= uint64(len(entries)) {
-		// just tried to seek past end of directory, we're all done!
-		return nil, fuse.OK
+	if ok && stream.dir.NodeID() == in.NodeId {
+		return stream, fuse.OK
 	}
 
-	return entries, fuse.OK
-}
-
-// ReadDirPlus reads an individual directory entry AND does a lookup.
-func (f *Filesystem) ReadDirPlus(cancel <-chan struct{}, in *fuse.ReadIn, out *fuse.DirEntryList) fuse.Status {
-	entries, status := f.readDirCommon(cancel, in)
+	// readdir can sometimes arrive before the corresponding opendir, so we force it
+	stream, status := f.openDirStream(in.NodeId)
 	if status != fuse.OK {
-		return status
-	}
-
-	// Check if entries is nil or if offset is out of range
-	if entries == nil || in.Offset >= uint64(len(entries)) {
-		return fuse.OK
+		return nil, status
 	}
+	f.opendirsM.Lock()
+	f.opendirs[in.Fh] = stream
+	f.opendirsM.Unlock()
+	return stream, fuse.OK
+}
 
-	inode := entries[in.Offset]
+// dirEntry returns the directory entry of inode at offset.
+func dirEntry(inode *Inode, offset uint64) fuse.DirEntry {
 	entry := fuse.DirEntry{
-		Ino:  inode.NodeID(),
+		Ino:  inode.Ino(),
 		Mode: inode.Mode(),
 	}
 	// first two entries will always be "." and ".."
-	switch in.Offset {
+	switch offset {
 	case 0:
 		entry.Name = "."
 	case 1:
@@ -192,59 +184,65 @@ func (f *Filesystem) ReadDirPlus(cancel <-chan struct{}, in *fuse.ReadIn, out *f
 	default:
 		entry.Name = inode.Name()
 	}
-	entryOut := out.AddDirLookupEntry(entry)
-	if entryOut == nil {
-		// Buffer is full, return OK to indicate we've provided as many entries as possible
-		// The kernel will call ReadDirPlus again with a higher offset to get more entries
-		logging.Debug().
-			Uint64("nodeID", in.NodeId).
-			Uint64("offset", in.Offset).
-			Str("entryName", entry.Name).
-			Msg("Directory entry buffer full, returning partial results")
-		return fuse.OK
-	}
-	entryOut.NodeId = entry.Ino
-	entryOut.Attr = inode.makeAttr()
-	entryOut.SetAttrTimeout(timeout)
-	entryOut.SetEntryTimeout(timeout)
-	return fuse.OK
+	return entry
 }
 
-// ReadDir reads a directory entry. Usually doesn't get called (ReadDirPlus is
-// typically used).
-func (f *Filesystem) ReadDir(cancel <-chan struct{}, in *fuse.ReadIn, out *fuse.DirEntryList) fuse.Status {
-	entries, status := f.readDirCommon(cancel, in)
+// readDirEntries adds the entries from in.Offset on to out with add until
+// out is full or the directory ends.
+func (f *Filesystem) readDirEntries(cancel <-chan struct{}, in *fuse.ReadIn, add func(*Inode, fuse.DirEntry) bool) fuse.Status {
+	stream, status := f.readDirCommon(cancel, in)
 	if status != fuse.OK {
 		return status
 	}
-
-	// Check if entries is nil or if offset is out of range
-	if entries == nil || in.Offset >= uint64(len(entries)) {
-		return fuse.OK
+	for offset := in.Offset; ; offset++ {
+		inode, err := stream.entry(f, offset)
+		if err != nil {
+			logging.LogError(err, "Could not list directory",
+				logging.FieldOperation, "ReadDir",
+				logging.FieldID, stream.dir.ID())
+			if offset == in.Offset {
+				return fuse.EIO
+			}
+			// return what was listed, the next read tries again
+			return fuse.OK
+		}
+		if inode == nil || !add(inode, dirEntry(inode, offset)) {
+			return fuse.OK
+		}
 	}
+}
 
-	inode := entries[in.Offset]
-	entry := fuse.DirEntry{
-		Ino:  inode.NodeID(),
-		Mode: inode.Mode(),
-	}
-	// first two entries will always be "." and ".."
-	switch in.Offset {
-	case 0:
-		entry.Name = "."
-	case 1:
-		entry.Name = ".."
-	default:
-		entry.Name = inode.Name()
-	}
+// ReadDirPlus reads directory entries AND does a lookup of each.
+func (f *Filesystem) ReadDirPlus(cancel <-chan struct{}, in *fuse.ReadIn, out *fuse.DirEntryList) fuse.Status {
+	return f.readDirEntries(cancel, in, func(inode *Inode, entry fuse.DirEntry) bool {
+		entryOut := out.AddDirLookupEntry(entry)
+		if entryOut == nil {
+			// Buffer is full, the kernel calls ReadDirPlus again with a
+			// higher offset to get more entries
+			return false
+		}
+		ttl := f.attrTimeout(inode)
+		entryOut.NodeId = inode.NodeID()
+		entryOut.Generation = inode.Generation()
+		entryOut.Attr = inode.makeAttr()
+		entryOut.SetAttrTimeout(ttl)
+		entryOut.SetEntryTimeout(ttl)
+		return true
+	})
+}
 
-	out.AddDirEntry(entry)
-	return fuse.OK
+// ReadDir reads directory entries. Usually doesn't get called (ReadDirPlus is
+// typically used).
+func (f *Filesystem) ReadDir(cancel <-chan struct{}, in *fuse.ReadIn, out *fuse.DirEntryList) fuse.Status {
+	return f.readDirEntries(cancel, in, func(_ *Inode, entry fuse.DirEntry) bool {
+		return out.AddDirEntry(entry)
+	})
 }
 
 // Lookup is called by the kernel when the VFS wants to know about a file inside
 // a directory.
 func (f *Filesystem) Lookup(_ <-chan struct{}, in *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	name = f.normalizeName(name)
 	parent := f.GetNodeID(in.NodeId)
 	if parent == nil {
 		return fuse.ENOENT
@@ -257,14 +255,29 @@ func (f *Filesystem) Lookup(_ <-chan struct{}, in *fuse.InHeader, name string, o
 		Str("name", name).
 		Msg("")
 
-	child, _ := f.GetChild(id, strings.ToLower(name), f.auth)
+	// Children already in memory can be resolved without a metadata store or
+	// Graph round trip; count those separately from cold lookups.
+	if parent.HasChildren() {
+		f.attrCache.hits.Add(1)
+	} else {
+		f.attrCache.misses.Add(1)
+	}
+
+	var child *Inode
+	if node, ok := f.previews.node(id); ok {
+		child = f.lookupPreview(parent, node.item, name)
+	} else {
+		child, _ = f.GetChild(id, strings.ToLower(name), f.auth)
+	}
 	if child == nil {
 		return fuse.ENOENT
 	}
 
+	ttl := f.attrTimeout(child)
 	out.NodeId = child.NodeID()
+	out.Generation = child.Generation()
 	out.Attr = child.makeAttr()
-	out.SetAttrTimeout(timeout)
-	out.SetEntryTimeout(timeout)
+	out.SetAttrTimeout(ttl)
+	out.SetEntryTimeout(ttl)
 	return fuse.OK
 }
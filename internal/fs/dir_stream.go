@@ -0,0 +1,152 @@
+package fs
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// An open directory is listed a page at a time instead of copying all of its
+// children when it is opened. The pages come from the children index of the
+// metadata store, in name order, so listing a folder with hundreds of
+// thousands of items holds one page of them and returns the first entries
+// without waiting for the rest. Children created while the directory is
+// listed show up if they sort after the entries already returned.
+
+// readdirPageSize is the number of children an open directory holds at a
+// time.
+const readdirPageSize = 512
+
+// dirStream is an open directory. Offsets 0 and 1 are "." and "..", the
+// children follow from offset 2 on.
+type dirStream struct {
+	mu     sync.Mutex
+	dir    *Inode
+	parent *Inode
+	page   []*Inode // children from offset start on
+	start  uint64   // offset of page[0]
+	cursor string   // where the next page starts
+	done   bool     // page is the last page
+}
+
+func newDirStream(dir, parent *Inode) *dirStream {
+	return &dirStream{dir: dir, parent: parent, start: 2}
+}
+
+// entry returns the inode at offset, or nil past the end of the directory.
+// Going back before the current page lists the directory again from the
+// start.
+func (d *dirStream) entry(f *Filesystem, offset uint64) (*Inode, error) {
+	switch offset {
+	case 0:
+		return d.dir, nil
+	case 1:
+		return d.parent, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if offset < d.start || (d.page == nil && !d.done) {
+		d.page, d.start, d.cursor, d.done = nil, 2, "", false
+		if err := d.nextPage(f); err != nil {
+			return nil, err
+		}
+	}
+	for offset >= d.start+uint64(len(d.page)) {
+		if d.done {
+			return nil, nil
+		}
+		d.start += uint64(len(d.page))
+		if err := d.nextPage(f); err != nil {
+			return nil, err
+		}
+	}
+	return d.page[offset-d.start], nil
+}
+
+func (d *dirStream) nextPage(f *Filesystem) error {
+	page, cursor, done, err := f.childrenPage(d.dir.ID(), d.cursor, readdirPageSize)
+	if err != nil {
+		return err
+	}
+	d.page, d.cursor, d.done = page, cursor, done
+	return nil
+}
+
+// childrenPage returns up to limit children of the directory id that sort
+// after the cursor after, the cursor of the last one and whether they are the
+// last children.
+func (f *Filesystem) childrenPage(id, after string, limit int) ([]*Inode, string, bool, error) {
+	lister, ok := f.metadataStore.(metadata.ChildLister)
+	if !ok {
+		return f.childrenPageFromMemory(id, after, limit)
+	}
+	for {
+		entries, cursor, err := lister.ListChildren(context.Background(), id, after, limit)
+		if err != nil {
+			return nil, after, false, err
+		}
+		page := make([]*Inode, 0, len(entries))
+		for _, entry := range entries {
+			child := f.GetID(entry.ID)
+			if child == nil {
+				if child = f.inodeFromMetadataEntry(entry); child == nil {
+					continue
+				}
+				f.InsertID(entry.ID, child)
+			}
+			// the store may lag behind a move that is still being applied
+			if child.ParentID() != id {
+				continue
+			}
+			page = append(page, child)
+		}
+		// a page of skipped entries is not the end of the directory
+		if done := len(entries) < limit; len(page) > 0 || done {
+			return page, cursor, done, nil
+		}
+		after = cursor
+	}
+}
+
+// childrenPageFromMemory pages through the children held in memory, for
+// filesystems without a metadata store.
+func (f *Filesystem) childrenPageFromMemory(id, after string, limit int) ([]*Inode, string, bool, error) {
+	children, err := f.GetChildrenID(id, f.auth)
+	if err != nil {
+		return nil, after, false, err
+	}
+	keys := make([]string, 0, len(children))
+	byKey := make(map[string]*Inode, len(children))
+	for _, child := range children {
+		key := child.Name() + "\x00" + child.ID()
+		keys = append(keys, key)
+		byKey[key] = child
+	}
+	sort.Strings(keys)
+	i := sort.SearchStrings(keys, after)
+	if i < len(keys) && keys[i] == after {
+		i++
+	}
+	page := make([]*Inode, 0, limit)
+	cursor := after
+	for ; i < len(keys) && len(page) < limit; i++ {
+		page = append(page, byKey[keys[i]])
+		cursor = keys[i]
+	}
+	return page, cursor, i == len(keys), nil
+}
+
+// ensureChildrenKnown makes sure the children of dir are known locally,
+// fetching them when the directory was never listed.
+func (f *Filesystem) ensureChildrenKnown(dir *Inode) error {
+	dir.mu.RLock()
+	known := dir.children != nil
+	dir.mu.RUnlock()
+	if known {
+		return nil
+	}
+	_, err := f.GetChildrenID(dir.ID(), f.auth)
+	return err
+}
@@ -0,0 +1,73 @@
+package fs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_DirStream_ListsHugeDirectoriesPageByPage(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.opendirs = make(map[uint64]*dirStream)
+	fs.auth = &graph.Auth{}
+
+	const count = 2*readdirPageSize + 100
+	children := make([]string, 0, count)
+	for i := count - 1; i >= 0; i-- {
+		id := fmt.Sprintf("child-%04d", i)
+		seedEntry(t, fs, &metadata.Entry{ID: id, Name: fmt.Sprintf("file-%04d.txt", i), ParentID: "dir",
+			ItemType: metadata.ItemKindFile, State: metadata.ItemStateGhost})
+		children = append(children, id)
+	}
+	seedEntry(t, fs, &metadata.Entry{ID: "gone", Name: "deleted.txt", ParentID: "dir",
+		ItemType: metadata.ItemKindFile, State: metadata.ItemStateDeleted})
+	seedEntry(t, fs, &metadata.Entry{ID: "dir", Name: "dir", ItemType: metadata.ItemKindDirectory,
+		State: metadata.ItemStateHydrated, Children: children})
+	dir := fs.ensureInodeFromMetadataStore("dir")
+	require.NotNil(t, dir)
+
+	out := &fuse.OpenOut{}
+	require.Equal(t, fuse.OK, fs.OpenDir(nil, &fuse.OpenIn{InHeader: fuse.InHeader{NodeId: dir.NodeID()}}, out))
+	stream := fs.opendirs[out.Fh]
+	require.NotNil(t, stream)
+
+	first, err := stream.entry(fs, 0)
+	require.NoError(t, err)
+	require.Equal(t, dir, first)
+
+	var names []string
+	for offset := uint64(2); ; offset++ {
+		inode, err := stream.entry(fs, offset)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(stream.page), readdirPageSize, "an open directory holds one page")
+		if inode == nil {
+			break
+		}
+		names = append(names, inode.Name())
+		if offset == 2+readdirPageSize {
+			// created while the directory is listed, sorts after what was read
+			seedEntry(t, fs, &metadata.Entry{ID: "late", Name: "zz-late.txt", ParentID: "dir",
+				ItemType: metadata.ItemKindFile, State: metadata.ItemStateGhost})
+		}
+	}
+	require.Len(t, names, count+1)
+	for i := 0; i < count; i++ {
+		require.Equal(t, fmt.Sprintf("file-%04d.txt", i), names[i], "children are listed in name order")
+	}
+	require.Equal(t, "zz-late.txt", names[count])
+
+	rewound, err := stream.entry(fs, 5)
+	require.NoError(t, err)
+	require.Equal(t, "file-0003.txt", rewound.Name(), "seeking back lists the directory again")
+
+	list := fuse.NewDirEntryList(make([]byte, 4096), 0)
+	require.Equal(t, fuse.OK, fs.ReadDir(nil, &fuse.ReadIn{InHeader: fuse.InHeader{NodeId: dir.NodeID()}, Fh: out.Fh}, list))
+	require.Greater(t, list.Offset, uint64(2), "one read returns as many entries as fit")
+
+	fs.ReleaseDir(&fuse.ReleaseIn{InHeader: fuse.InHeader{NodeId: dir.NodeID()}, Fh: out.Fh})
+	require.Empty(t, fs.opendirs)
+}
@@ -0,0 +1,30 @@
+package fs
+
+import (
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// DefaultMaxIOSize is the largest read/write request the kernel is asked to
+// send in a single FUSE operation. It matches the go-fuse cap so 1MB+ IOs
+// issued by data-heavy applications are not split into 128KB pieces.
+const DefaultMaxIOSize = fuse.MAX_KERNEL_WRITE
+
+// isDirectIO reports whether the open flags request O_DIRECT semantics.
+func isDirectIO(flags uint32) bool {
+	return flags&syscall.O_DIRECT != 0
+}
+
+// directIOOpenFlags returns the FOPEN_* flags to hand back to the kernel for
+// an open request. O_DIRECT handles bypass the page cache so the kernel
+// forwards each request unmodified (up to max_write) instead of chunking it
+// through readahead. The content cache file itself is read as usual: O_DIRECT
+// on it would gain nothing for data that is already local, and tmpfs cache
+// directories reject it.
+func directIOOpenFlags(flags uint32) uint32 {
+	if !isDirectIO(flags) {
+		return 0
+	}
+	return fuse.FOPEN_DIRECT_IO
+}
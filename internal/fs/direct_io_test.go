@@ -0,0 +1,76 @@
+package fs
+
+import (
+	"bytes"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_DirectIO_OpenFlags(t *testing.T) {
+	require.True(t, isDirectIO(uint32(syscall.O_RDONLY|syscall.O_DIRECT)))
+	require.False(t, isDirectIO(uint32(syscall.O_RDWR)))
+
+	require.Equal(t, uint32(fuse.FOPEN_DIRECT_IO), directIOOpenFlags(uint32(syscall.O_DIRECT)))
+	require.Zero(t, directIOOpenFlags(uint32(syscall.O_WRONLY)))
+}
+
+// directReadChunk is the request size used by the O_DIRECT read test.
+const directReadChunk = 64 << 10
+
+func TestUT_FS_DirectIO_ReadSkipsReadAhead(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	file := NewInode("disk.img", fuse.S_IFREG|0644, nil)
+	file.DriveItem.ID = "disk"
+	payload := bytes.Repeat([]byte("x"), 3*directReadChunk)
+	file.DriveItem.Size = uint64(len(payload))
+	registerHydratedEntry(t, fs, file)
+	require.NoError(t, fs.content.Insert(file.ID(), payload))
+
+	buf := make([]byte, directReadChunk)
+	for off := 0; off < len(payload); off += directReadChunk {
+		result, status := fs.Read(nil, &fuse.ReadIn{
+			InHeader: fuse.InHeader{NodeId: file.NodeID()},
+			Offset:   uint64(off),
+			Size:     directReadChunk,
+			Flags:    uint32(syscall.O_RDONLY | syscall.O_DIRECT),
+		}, buf)
+		require.Equal(t, fuse.OK, status)
+		data, status := result.Bytes(buf)
+		require.Equal(t, fuse.OK, status)
+		require.Equal(t, payload[off:off+directReadChunk], data)
+		result.Done()
+	}
+	require.Zero(t, fs.ReadAheadStats().SequentialReads, "O_DIRECT reads are not tracked for read-ahead")
+}
+
+func benchmarkHydratedRead(b *testing.B, chunk int) {
+	cache := NewLoopbackCache(filepath.Join(b.TempDir(), "content"))
+	const fileSize = 64 << 20
+	require.NoError(b, cache.Insert("bench", bytes.Repeat([]byte{0xab}, fileSize)))
+	fd, err := cache.Open("bench")
+	require.NoError(b, err)
+	b.Cleanup(func() { _ = cache.Close("bench") })
+
+	out := make([]byte, DefaultMaxIOSize)
+	b.SetBytes(fileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for off := 0; off < fileSize; off += chunk {
+			result := fuse.ReadResultFd(fd.Fd(), int64(off), chunk)
+			if _, status := result.Bytes(out); status != fuse.OK {
+				b.Fatalf("read failed: %v", status)
+			}
+			result.Done()
+		}
+	}
+}
+
+// BenchmarkHydratedRead128K measures the legacy 128KB request size.
+func BenchmarkHydratedRead128K(b *testing.B) { benchmarkHydratedRead(b, 128<<10) }
+
+// BenchmarkHydratedRead1M measures 1MB requests enabled by DefaultMaxIOSize.
+func BenchmarkHydratedRead1M(b *testing.B) { benchmarkHydratedRead(b, DefaultMaxIOSize) }
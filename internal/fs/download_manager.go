@@ -21,7 +21,6 @@ package fs
 // proactively detects changes in batch, reducing API calls and network overhead.
 
 import (
-	"context"
 	"encoding/json"
 	"io"
 	"math"
@@ -77,6 +76,9 @@ type DownloadSession struct {
 	CanResume           bool      `json:"canResume"`
 	DownloadURL         string    `json:"downloadUrl"`
 	ETag                string    `json:"eTag"`
+	// CorrelationID ties the log entries and Graph requests of the download
+	// together (see logging.WithCorrelationID)
+	CorrelationID string `json:"correlationId,omitempty"`
 
 	mutex sync.RWMutex
 }
@@ -130,6 +132,7 @@ type DownloadManager struct {
 	stopChan   chan struct{}
 	db         *bolt.DB
 	completed  sync.Map // tracks IDs whose sessions finished and were cleaned up
+	health     *workerPool
 	// retry configuration (overridable for tests via env)
 	retryConfig     retry.Config
 	copyRetryConfig retry.Config
@@ -154,6 +157,7 @@ func NewDownloadManager(fs *Filesystem, auth *graph.Auth, numWorkers int, queueS
 		retryConfig:     tunedRetryConfig(),
 		copyRetryConfig: tunedRetryConfig(),
 	}
+	dm.health = newWorkerPool(poolHydration, func() int { return len(dm.queue) })
 
 	// Restore any incomplete download sessions from disk
 	dm.restoreDownloadSessions()
@@ -222,6 +226,9 @@ func (dm *DownloadManager) restoreDownloadSessions() {
 			// Reset state to queued for recovery
 			session.State = downloadQueued
 			session.RecoveryAttempts++
+			if session.CorrelationID == "" {
+				session.CorrelationID = logging.NewCorrelationID()
+			}
 
 			dm.mutex.Lock()
 			dm.sessions[session.ID] = session
@@ -230,6 +237,7 @@ func (dm *DownloadManager) restoreDownloadSessions() {
 			// Re-enqueue for processing
 			select {
 			case dm.queue <- session.ID:
+				dm.health.enqueued()
 				requeued++
 			default:
 				// If the queue is unexpectedly full on startup, mark the session errored to avoid waiters hanging.
@@ -240,6 +248,7 @@ func (dm *DownloadManager) restoreDownloadSessions() {
 			logging.Info().
 				Str("id", session.ID).
 				Str("path", session.Path).
+				Str(logging.FieldCorrelationID, session.CorrelationID).
 				Int("recoveryAttempts", session.RecoveryAttempts).
 				Msg("Restored download session for recovery")
 
@@ -254,19 +263,35 @@ func (dm *DownloadManager) restoreDownloadSessions() {
 // startWorkers starts the download worker goroutines
 func (dm *DownloadManager) startWorkers() {
 	for i := 0; i < dm.numWorkers; i++ {
-		dm.workerWg.Add(1)
-		go dm.worker()
+		dm.startWorker()
 	}
 }
 
+// startWorker starts one worker, which is replaced when it gets stuck.
+func (dm *DownloadManager) startWorker() {
+	dm.workerWg.Add(1)
+	go dm.worker(dm.health.add(dm.startWorker))
+}
+
 // worker processes download requests from the queue
-func (dm *DownloadManager) worker() {
+func (dm *DownloadManager) worker(workerID int) {
 	defer dm.workerWg.Done()
+	defer dm.health.remove(workerID)
+	if dm.fs != nil {
+		defer dm.fs.RecoverCrash("download worker")
+	}
 
 	for {
 		select {
 		case id := <-dm.queue:
+			if dm.fs != nil && !dm.fs.waitWhileSuspended(dm.stopChan) {
+				return
+			}
+			dm.health.begin(workerID, "download "+id)
 			dm.processDownload(id)
+			if !dm.health.end(workerID) {
+				return
+			}
 		case <-dm.stopChan:
 			return
 		}
@@ -301,12 +326,30 @@ func (dm *DownloadManager) processDownload(id string) {
 		return
 	}
 
+	// Another mount of the account may already have this content
+	if size, hash, ok := dm.fs.hydrateFromSharedContent(id, inode); ok {
+		dm.completeDownload(session, inode, size, hash)
+		return
+	}
+
+	// ...or another item in this mount may hold identical content
+	if size, hash, ok := dm.fs.hydrateFromLocalCopy(id, inode); ok {
+		dm.completeDownload(session, inode, size, hash)
+		return
+	}
+
 	// Update file status
 	dm.fs.SetFileStatus(id, FileStatusInfo{
 		Status:    StatusDownloading,
 		Timestamp: time.Now(),
 	})
 
+	// The content is rewritten in place; never write through to shared content
+	if err := dm.fs.content.Unshare(id); err != nil {
+		dm.setSessionError(session, err)
+		return
+	}
+
 	// Get file content
 	// Access content field directly
 	fd, err := dm.fs.content.Open(id)
@@ -330,12 +373,28 @@ func (dm *DownloadManager) processDownload(id string) {
 		}
 	}()
 
-	// Create a context for the download operation
-	ctx := context.Background()
+	// Create a context for the download operation, ending when the mount stops
+	ctx := logging.WithCorrelationID(dm.fs.mountContext(), session.GetCorrelationID())
 
 	// Create a retry config for the download operation
 	retryConfig := dm.retryConfig
 
+	// Report byte-level progress while the content streams into the temp file
+	inode.mu.RLock()
+	expectedSize := inode.DriveItem.Size
+	inode.mu.RUnlock()
+	var accounted uint64
+	progress := &progressWriter{
+		w: temp,
+		onUpdate: func(done uint64) {
+			if done > accounted {
+				dm.fs.recordTransfer(0, done-accounted)
+				accounted = done
+			}
+			dm.fs.reportTransferProgress(id, StatusDownloading, done, expectedSize)
+		},
+	}
+
 	// Download the file content with retry
 	var size uint64
 	var actualHash string
@@ -352,7 +411,10 @@ func (dm *DownloadManager) processDownload(id string) {
 
 		// Download the file content
 		var downloadErr error
-		size, downloadErr = graph.GetItemContentStream(id, dm.auth, temp)
+		// A retry starts over, the bytes it transfers again count again
+		progress.written = 0
+		accounted = 0
+		size, downloadErr = graph.GetItemContentStreamChunkedWithContext(ctx, id, dm.auth, progress, dm.fs.transferChunks(chunkDownload))
 		if downloadErr != nil {
 			return errors.Wrap(downloadErr, "failed to download file content")
 		}
@@ -367,7 +429,7 @@ func (dm *DownloadManager) processDownload(id string) {
 		inode.mu.RUnlock()
 
 		if expectedHash != "" && !strings.EqualFold(expectedHash, actualHash) {
-			return errors.NewValidationError("checksum verification failed", nil)
+			return errors.NewValidationError("checksum verification failed", ErrChecksumMismatch)
 		}
 
 		return nil
@@ -389,6 +451,7 @@ func (dm *DownloadManager) processDownload(id string) {
 		return
 	}
 
+	defer dm.fs.content.suspendMapping(id)()
 	if err := fd.Truncate(0); err != nil {
 		dm.setSessionError(session, err)
 		return
@@ -428,6 +491,15 @@ func (dm *DownloadManager) processDownload(id string) {
 		return
 	}
 
+	dm.fs.publishSharedContent(id, actualHash, size)
+	dm.completeDownload(session, inode, size, actualHash)
+}
+
+// completeDownload records hydrated content of size bytes with the given
+// QuickXorHash and marks the session completed.
+func (dm *DownloadManager) completeDownload(session *DownloadSession, inode *Inode, size uint64, actualHash string) {
+	id := session.ID
+
 	// Update inode size
 	inode.mu.Lock()
 	inode.DriveItem.Size = size
@@ -435,9 +507,13 @@ func (dm *DownloadManager) processDownload(id string) {
 		inode.DriveItem.File = &graph.File{}
 	}
 	inode.DriveItem.File.Hashes.QuickXorHash = actualHash
+	inode.resetWriteHashLocked()
 	inode.mu.Unlock()
 
+	dm.fs.indexContent(id, actualHash, size)
+	dm.fs.clearTransferProgress(id)
 	dm.fs.markHydratedState(id)
+	dm.fs.emitActivity(ActivityHydrated, id, "")
 	dm.fs.transitionToState(id, metadata.ItemStateHydrated,
 		metadata.WithHydrationEvent(),
 		metadata.WithWorker("download:"+id),
@@ -484,12 +560,13 @@ func (dm *DownloadManager) setSessionError(session *DownloadSession, err error)
 	session.mutex.Unlock()
 
 	// Update file status
+	dm.fs.clearTransferProgress(session.ID)
 	dm.fs.MarkFileError(session.ID, err)
 
 	dm.fs.transitionItemState(session.ID, metadata.ItemStateError,
-		metadata.WithHydrationEvent(),
-		metadata.WithWorker("download:"+session.ID),
-		metadata.WithTransitionError(err, false))
+		append(errorTransition(err),
+			metadata.WithHydrationEvent(),
+			metadata.WithWorker("download:"+session.ID))...)
 
 	// Persist updated session state for potential recovery
 	if dm.db != nil && session.RecoveryAttempts <= 3 {
@@ -504,6 +581,7 @@ func (dm *DownloadManager) setSessionError(session *DownloadSession, err error)
 		logging.FieldOperation, "setSessionError",
 		logging.FieldID, session.ID,
 		logging.FieldPath, session.Path,
+		logging.FieldCorrelationID, session.GetCorrelationID(),
 		"recoveryAttempts", session.RecoveryAttempts)
 }
 
@@ -530,6 +608,10 @@ func (dm *DownloadManager) finishDownloadSession(id string) {
 
 // QueueDownload adds a file to the download queue
 func (dm *DownloadManager) QueueDownload(id string) (*DownloadSession, error) {
+	if dm.fs != nil && dm.fs.ArchiveMode() {
+		return nil, ErrArchiveMount
+	}
+
 	// Check if the file is already being downloaded
 	dm.mutex.RLock()
 	session, exists := dm.sessions[id]
@@ -551,6 +633,8 @@ func (dm *DownloadManager) QueueDownload(id string) (*DownloadSession, error) {
 		metadata.WithHydrationEvent(),
 		metadata.WithWorker("download-queue:"+id))
 
+	// A move re-paths the session once it is registered
+	release := dm.fs.fenceItem(inode)
 	path := inode.Path()
 	// Clear any stale completion marker from prior downloads of the same item
 	dm.completed.Delete(id)
@@ -564,6 +648,7 @@ func (dm *DownloadManager) QueueDownload(id string) (*DownloadSession, error) {
 		BytesDownloaded:     0,
 		RecoveryAttempts:    0,
 		CanResume:           false,
+		CorrelationID:       logging.NewCorrelationID(),
 	}
 
 	// Initialize session for large files that support resumable downloads
@@ -584,13 +669,16 @@ func (dm *DownloadManager) QueueDownload(id string) (*DownloadSession, error) {
 	dm.mutex.Lock()
 	dm.sessions[id] = session
 	dm.mutex.Unlock()
+	release()
 
 	// Add to download queue
 	select {
 	case dm.queue <- id:
+		dm.health.enqueued()
 		logging.Info().
 			Str("id", id).
 			Str("path", path).
+			Str(logging.FieldCorrelationID, session.CorrelationID).
 			Msg("File queued for download")
 	default:
 		// Queue is full, return error
@@ -605,6 +693,40 @@ func (dm *DownloadManager) QueueDownload(id string) (*DownloadSession, error) {
 	return session, nil
 }
 
+// repath moves the paths of the downloads at or below oldPath to newPath.
+func (dm *DownloadManager) repath(oldPath, newPath string) {
+	dm.mutex.RLock()
+	moved := make(map[string][]byte)
+	for id, session := range dm.sessions {
+		session.mutex.Lock()
+		path, ok := rebasePath(session.Path, oldPath, newPath)
+		session.Path = path
+		if ok && dm.db != nil {
+			moved[id], _ = json.Marshal(session)
+		}
+		session.mutex.Unlock()
+	}
+	dm.mutex.RUnlock()
+	if len(moved) == 0 {
+		return
+	}
+	// Sessions resumed after a restart report the new path
+	if err := dm.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketDownloads)
+		if err != nil {
+			return err
+		}
+		for id, contents := range moved {
+			if err := b.Put([]byte(id), contents); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		logging.Warn().Err(err).Str("path", newPath).Msg("Failed to persist moved download sessions")
+	}
+}
+
 // GetDownloadStatus returns the status of a download
 func (dm *DownloadManager) GetDownloadStatus(id string) (DownloadState, error) {
 	dm.mutex.RLock()
@@ -717,6 +839,13 @@ func (ds *DownloadSession) GetError() error {
 	return ds.Error
 }
 
+// GetCorrelationID returns the correlation ID of the download
+func (ds *DownloadSession) GetCorrelationID() string {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return ds.CorrelationID
+}
+
 // IsComplete returns true if the download has completed successfully
 func (ds *DownloadSession) IsComplete() bool {
 	ds.mutex.RLock()
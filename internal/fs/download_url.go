@@ -0,0 +1,48 @@
+package fs
+
+import (
+	"context"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// A temporary download URL lets another program or device stream a file
+// straight from OneDrive, such as a video player on a television or a curl
+// pipeline, without the file going through the cache. It is the
+// pre-authenticated @microsoft.graph.downloadUrl OneDrive hands out: anyone
+// holding it can download the file until it expires after about an hour, so
+// it is never logged. The URL serves the version on OneDrive, so files with
+// local changes that are not uploaded yet have none.
+
+// TemporaryDownloadURL returns a short-lived URL for downloading the file at
+// path, relative to the mount root, directly from OneDrive.
+func (f *Filesystem) TemporaryDownloadURL(ctx context.Context, path string) (string, error) {
+	id := f.GetIDByPath(path)
+	if id == "" {
+		return "", errors.NewNotFoundError("path not found: "+path, nil)
+	}
+	return f.temporaryDownloadURLWith(ctx, id, graphItemRemote{ctx: ctx, auth: f.auth})
+}
+
+func (f *Filesystem) temporaryDownloadURLWith(ctx context.Context, id string, remote itemRemote) (string, error) {
+	inode := f.GetID(id)
+	if inode == nil {
+		return "", errors.NewNotFoundError("item not found", nil)
+	}
+	path := inode.Path()
+	switch {
+	case inode.IsDir() || inode.IsVirtual():
+		return "", errors.NewValidationError("not a file on OneDrive: "+path, nil)
+	case isLocalID(id) || inode.HasChanges():
+		return "", errors.NewValidationError("the file has local changes that are not uploaded yet: "+path, nil)
+	case f.IsOffline():
+		return "", errors.NewNetworkError("cannot get download URLs while offline", nil)
+	}
+	url, err := remote.DownloadURL(ctx, id)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get a download URL")
+	}
+	logging.Info().Str(logging.FieldID, id).Str(logging.FieldPath, path).Msg("Handed out a temporary download URL")
+	return url, nil
+}
@@ -0,0 +1,33 @@
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_DownloadURL_ReturnsOneDriveURL(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+	remote := remoteCopy("etag-1", "quarterly numbers")
+	remote.downloadURL = "https://public.bn.files.1drv.com/report.txt?tempauth=abc"
+
+	url, err := fs.temporaryDownloadURLWith(context.Background(), file.ID(), remote)
+	require.NoError(t, err)
+	require.Equal(t, remote.downloadURL, url)
+
+	_, err = fs.temporaryDownloadURLWith(context.Background(), "parent", remote)
+	require.Error(t, err, "folders have no download URL")
+}
+
+func TestUT_FS_DownloadURL_RefusesLocalChanges(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+	remote := remoteCopy("etag-1", "quarterly numbers")
+	remote.downloadURL = "https://public.bn.files.1drv.com/report.txt?tempauth=abc"
+
+	file.mu.Lock()
+	file.hasChanges = true
+	file.mu.Unlock()
+	_, err := fs.temporaryDownloadURLWith(context.Background(), file.ID(), remote)
+	require.ErrorContains(t, err, "local changes", "OneDrive would serve an older version")
+}
@@ -0,0 +1,53 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// An ephemeral mount (onemount --ephemeral) keeps nothing once it stops, for
+// CI jobs and containers that mount OneDrive briefly to fetch a few files.
+// Its metadata database lives in memory, without the snapshots kept for a
+// cache on a network filesystem; changes made while offline are not
+// journaled, since nothing would be left to replay them; and the cache
+// directory, content and thumbnails included, is removed once the database
+// is closed. The caller picks a fresh cache directory and a small content
+// cache limit.
+
+// ephemeralCache is what an ephemeral mount removes when it stops.
+type ephemeralCache struct {
+	cacheDir  string
+	memoryDir string // directory holding the database
+}
+
+// ephemeralDBPath creates a memory-backed directory for the database of the
+// ephemeral mount caching in cacheDir.
+func ephemeralDBPath(cacheDir string) (string, *ephemeralCache, error) {
+	memoryDir, err := os.MkdirTemp(memoryTempDir(), "onemount-ephemeral-")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "could not create in-memory metadata directory")
+	}
+	return filepath.Join(memoryDir, "onemount.db"), &ephemeralCache{cacheDir: cacheDir, memoryDir: memoryDir}, nil
+}
+
+// Ephemeral reports whether the mount removes its cache when it stops.
+func (f *Filesystem) Ephemeral() bool {
+	return f.ephemeral != nil
+}
+
+// removeEphemeralCache removes the database and the cache directory of an
+// ephemeral mount, once the database is closed.
+func (f *Filesystem) removeEphemeralCache() {
+	if f.ephemeral == nil {
+		return
+	}
+	for _, dir := range []string{f.ephemeral.memoryDir, f.ephemeral.cacheDir} {
+		if err := os.RemoveAll(dir); err != nil {
+			logging.Warn().Err(err).Str("path", dir).Msg("Failed to remove the cache of an ephemeral mount")
+		}
+	}
+	logging.Info().Str("cacheDir", f.ephemeral.cacheDir).Msg("Removed the cache of the ephemeral mount")
+}
@@ -0,0 +1,47 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_Ephemeral_RemovesDatabaseAndCacheOnStop(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "content"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "content", "item"), []byte("data"), 0600))
+
+	dbPath, ephemeral, err := ephemeralDBPath(cacheDir)
+	require.NoError(t, err)
+	require.False(t, strings.HasPrefix(dbPath, cacheDir), "the database is kept in memory")
+	require.NoError(t, os.WriteFile(dbPath, nil, 0600))
+
+	fs := &Filesystem{ephemeral: ephemeral}
+	require.True(t, fs.Ephemeral())
+	fs.removeEphemeralCache()
+	require.NoDirExists(t, cacheDir)
+	require.NoDirExists(t, filepath.Dir(dbPath))
+}
+
+func TestUT_FS_Ephemeral_DoesNotJournalOfflineChanges(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.offline = true
+	fs.ephemeral = &ephemeralCache{}
+
+	require.NoError(t, fs.TrackOfflineChange(&OfflineChange{ID: "item", Type: "modify", Timestamp: time.Now(), Path: "/a.txt"}))
+	changes, err := fs.getOfflineChanges(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	fs.ephemeral = nil
+	require.NoError(t, fs.TrackOfflineChange(&OfflineChange{ID: "item", Type: "modify", Timestamp: time.Now(), Path: "/a.txt"}))
+	changes, err = fs.getOfflineChanges(context.Background())
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+}
@@ -0,0 +1,273 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Items whose hydration or upload failed stay in the ERROR state with their
+// recent errors, each classified by what a retry needs to succeed. The
+// recovery scanner retries them with a backoff chosen by the class of the
+// last error: network failures come back quickly, throttling waits longer,
+// content that failed verification is retried a few times only, and
+// permission errors and conflicts wait for the user.
+
+// DefaultErrorRecoveryInterval is how often the recovery scanner looks for
+// errored items to retry.
+const DefaultErrorRecoveryInterval = time.Minute
+
+// errorRetryPolicy is the automatic retry schedule of an error class. The
+// delay starts at base and doubles with every failed attempt up to max. A
+// zero base means no automatic retries, a zero limit unlimited attempts.
+type errorRetryPolicy struct {
+	base  time.Duration
+	max   time.Duration
+	limit int
+}
+
+var errorRetryPolicies = map[metadata.ErrorClass]errorRetryPolicy{
+	metadata.ErrorClassNetwork:   {base: 30 * time.Second, max: 30 * time.Minute},
+	metadata.ErrorClassThrottle:  {base: 5 * time.Minute, max: time.Hour},
+	metadata.ErrorClassIntegrity: {base: time.Minute, max: 10 * time.Minute, limit: 3},
+	metadata.ErrorClassOther:     {base: 2 * time.Minute, max: time.Hour, limit: 10},
+	// Permission errors and conflicts need the user: signing in again,
+	// getting access back, or resolving the conflict
+	metadata.ErrorClassPermission: {},
+	metadata.ErrorClassConflict:   {},
+}
+
+// nextRetry returns when an item that failed attempts times, last at last,
+// is retried, and false when it is not retried automatically.
+func (p errorRetryPolicy) nextRetry(attempts int, last time.Time) (time.Time, bool) {
+	if p.base <= 0 || (p.limit > 0 && attempts >= p.limit) {
+		return time.Time{}, false
+	}
+	delay := p.base
+	for i := 1; i < attempts && delay < p.max; i++ {
+		delay *= 2
+	}
+	if delay > p.max {
+		delay = p.max
+	}
+	return last.Add(delay), true
+}
+
+// ErrChecksumMismatch reports content whose hash or size differs from what
+// OneDrive has for it.
+var ErrChecksumMismatch = errors.NewKind("content does not match its checksum", errors.ErrIntegrity)
+
+// classifyError returns the error class recorded for a failed hydration or
+// upload.
+func classifyError(err error) metadata.ErrorClass {
+	if err == nil {
+		return metadata.ErrorClassOther
+	}
+	switch {
+	case errors.IsResourceBusyError(err):
+		return metadata.ErrorClassThrottle
+	case errors.IsAuthError(err):
+		return metadata.ErrorClassPermission
+	case errors.Is(err, errors.ErrIntegrity):
+		return metadata.ErrorClassIntegrity
+	case errors.Is(err, errors.ErrConflict):
+		return metadata.ErrorClassConflict
+	case errors.IsNetworkError(err), errors.IsTimeoutError(err), errors.IsOperationError(err),
+		errors.Is(err, context.DeadlineExceeded), graph.IsOffline(err):
+		return metadata.ErrorClassNetwork
+	default:
+		return metadata.ErrorClassOther
+	}
+}
+
+// errorTransition returns the options recording err on a transition to the
+// ERROR state.
+func errorTransition(err error) []metadata.TransitionOption {
+	return []metadata.TransitionOption{
+		metadata.WithTransitionError(err, false),
+		metadata.WithErrorClass(classifyError(err)),
+	}
+}
+
+// ErroredItem is an item left in the ERROR state, as listed by
+// "onemount status".
+type ErroredItem struct {
+	ID        string
+	Path      string
+	Upload    bool // the upload failed, otherwise the download
+	LastError metadata.OperationError
+	History   []metadata.OperationError
+	Attempts  int
+	NextRetry time.Time // zero when the item is not retried automatically
+}
+
+// ErroredItems returns the items whose last hydration or upload failed,
+// sorted by path.
+func (f *Filesystem) ErroredItems() ([]ErroredItem, error) {
+	entries, err := f.erroredEntries()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]ErroredItem, 0, len(entries))
+	for _, entry := range entries {
+		item := ErroredItem{
+			ID:       entry.ID,
+			Path:     entry.Name,
+			Upload:   erroredUpload(entry),
+			History:  entry.ErrorHistory,
+			Attempts: entry.Attempts,
+		}
+		if entry.LastError != nil {
+			item.LastError = *entry.LastError
+		}
+		if next, ok := nextRetry(entry); ok {
+			item.NextRetry = next
+		}
+		if inode := f.GetID(entry.ID); inode != nil {
+			item.Path = inode.Path()
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	return items, nil
+}
+
+// erroredEntries reads the entries in the ERROR state from the database.
+func (f *Filesystem) erroredEntries() ([]*metadata.Entry, error) {
+	if f.db == nil {
+		return nil, nil
+	}
+	var entries []*metadata.Entry
+	err := f.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMetadataV2)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var entry metadata.Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return nil
+			}
+			if entry.State == metadata.ItemStateError && !entry.Virtual {
+				entries = append(entries, &entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read metadata entries")
+	}
+	return entries, nil
+}
+
+// erroredUpload reports whether the last error of entry came from an upload.
+func erroredUpload(entry *metadata.Entry) bool {
+	return entry.LastError != nil && entry.Upload.LastError != nil &&
+		entry.Upload.LastError.OccurredAt.Equal(entry.LastError.OccurredAt)
+}
+
+// nextRetry returns when the recovery scanner retries entry, and false when
+// it does not. Failed downloads are only retried for pinned files: other
+// files are downloaded again when they are next opened.
+func nextRetry(entry *metadata.Entry) (time.Time, bool) {
+	if entry.LastError == nil || entry.ItemType != metadata.ItemKindFile {
+		return time.Time{}, false
+	}
+	if !erroredUpload(entry) && entry.Pin.Mode != metadata.PinModeAlways {
+		return time.Time{}, false
+	}
+	class := entry.LastError.Class
+	if class == "" {
+		class = metadata.ErrorClassOther
+	}
+	return errorRetryPolicies[class].nextRetry(entry.Attempts, entry.LastError.OccurredAt)
+}
+
+// dueErroredEntries returns the errored entries whose retry is due at now.
+func (f *Filesystem) dueErroredEntries(now time.Time) ([]*metadata.Entry, error) {
+	entries, err := f.erroredEntries()
+	if err != nil {
+		return nil, err
+	}
+	var due []*metadata.Entry
+	for _, entry := range entries {
+		if next, ok := nextRetry(entry); ok && !now.Before(next) {
+			due = append(due, entry)
+		}
+	}
+	return due, nil
+}
+
+// retryErroredItems queues the uploads and downloads of errored items whose
+// retry is due and returns how many were queued.
+func (f *Filesystem) retryErroredItems(now time.Time) int {
+	due, err := f.dueErroredEntries(now)
+	if err != nil {
+		logging.Warn().Err(err).Msg("Could not list items to retry")
+		return 0
+	}
+	retried := 0
+	for _, entry := range due {
+		inode := f.GetID(entry.ID)
+		if inode == nil {
+			continue
+		}
+		var err error
+		if erroredUpload(entry) {
+			// The local changes are still waiting for OneDrive
+			f.transitionItemState(entry.ID, metadata.ItemStateDirtyLocal, metadata.ForceTransition())
+			if f.holdUpload(inode) {
+				continue // queued again when the item is unfrozen or the hold ends
+			}
+			_, err = f.uploads.QueueUploadWithPriority(inode, PriorityLow)
+		} else {
+			_, err = f.downloads.QueueDownload(entry.ID)
+		}
+		if err != nil {
+			logging.Warn().Err(err).Str("id", entry.ID).Msg("Could not retry failed item")
+			continue
+		}
+		logging.Info().
+			Str("id", entry.ID).
+			Str("class", string(entry.LastError.Class)).
+			Int("attempts", entry.Attempts).
+			Bool("upload", erroredUpload(entry)).
+			Msg("Retrying failed item")
+		retried++
+	}
+	return retried
+}
+
+// StartErrorRecovery starts the recovery scanner, which retries errored items
+// every interval according to the class of their last error.
+func (f *Filesystem) StartErrorRecovery(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if f.IsOffline() {
+					continue
+				}
+				f.retryErroredItems(time.Now())
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
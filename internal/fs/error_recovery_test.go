@@ -0,0 +1,125 @@
+package fs
+
+import (
+	"context"
+	goerrors "errors"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_ErrorRecovery_ClassifiesErrors(t *testing.T) {
+	cases := map[metadata.ErrorClass]error{
+		metadata.ErrorClassThrottle:   errors.NewResourceBusyError("activityLimitReached: slow down", nil),
+		metadata.ErrorClassPermission: errors.NewAuthError("accessDenied: no access", nil),
+		metadata.ErrorClassIntegrity:  errors.NewValidationError("checksum verification failed", ErrChecksumMismatch),
+		metadata.ErrorClassConflict:   graphAPIError(409, "nameAlreadyExists"),
+		metadata.ErrorClassNetwork:    errors.Wrap(errors.NewOperationError("serviceNotAvailable: try later", nil), "upload"),
+		metadata.ErrorClassOther:      goerrors.New("something unexpected"),
+	}
+	for want, err := range cases {
+		require.Equal(t, want, classifyError(err), err.Error())
+	}
+	require.Equal(t, metadata.ErrorClassNetwork, classifyError(context.DeadlineExceeded))
+	require.Equal(t, metadata.ErrorClassOther, classifyError(goerrors.New("no checksum for this file")),
+		"only the integrity sentinel makes an integrity error")
+}
+
+func TestUT_FS_ErrorRecovery_BackoffByClass(t *testing.T) {
+	last := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	network := errorRetryPolicies[metadata.ErrorClassNetwork]
+	next, ok := network.nextRetry(1, last)
+	require.True(t, ok)
+	require.Equal(t, last.Add(30*time.Second), next)
+	next, _ = network.nextRetry(3, last)
+	require.Equal(t, last.Add(2*time.Minute), next, "the delay doubles with every attempt")
+	next, _ = network.nextRetry(50, last)
+	require.Equal(t, last.Add(30*time.Minute), next, "the delay is capped")
+
+	next, _ = errorRetryPolicies[metadata.ErrorClassThrottle].nextRetry(1, last)
+	require.Equal(t, last.Add(5*time.Minute), next, "throttling waits longer than network failures")
+
+	_, ok = errorRetryPolicies[metadata.ErrorClassIntegrity].nextRetry(3, last)
+	require.False(t, ok, "integrity errors stop after a few attempts")
+	_, ok = errorRetryPolicies[metadata.ErrorClassPermission].nextRetry(1, last)
+	require.False(t, ok, "permission errors wait for the user")
+	_, ok = errorRetryPolicies[metadata.ErrorClassConflict].nextRetry(1, last)
+	require.False(t, ok, "conflicts wait for the user")
+}
+
+func TestUT_FS_ErrorRecovery_ListsAndSchedulesErroredItems(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	upload := NewInode("upload.txt", fuse.S_IFREG|0644, nil)
+	upload.DriveItem.ID = "upload"
+	registerHydratedEntry(t, fs, upload)
+	download := NewInode("download.txt", fuse.S_IFREG|0644, nil)
+	download.DriveItem.ID = "download"
+	registerHydratedEntry(t, fs, download)
+	denied := NewInode("denied.txt", fuse.S_IFREG|0644, nil)
+	denied.DriveItem.ID = "denied"
+	registerHydratedEntry(t, fs, denied)
+
+	fs.transitionItemState("upload", metadata.ItemStateError,
+		append(errorTransition(errors.NewOperationError("serviceNotAvailable", nil)), metadata.WithUploadEvent())...)
+	fs.transitionItemState("download", metadata.ItemStateError,
+		append(errorTransition(goerrors.New("connection reset")), metadata.WithHydrationEvent())...)
+	fs.transitionItemState("denied", metadata.ItemStateError,
+		append(errorTransition(errors.NewAuthError("accessDenied", nil)), metadata.WithUploadEvent())...)
+
+	items, err := fs.ErroredItems()
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	byID := map[string]ErroredItem{}
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+	require.True(t, byID["upload"].Upload)
+	require.Equal(t, metadata.ErrorClassNetwork, byID["upload"].LastError.Class)
+	require.Equal(t, 1, byID["upload"].Attempts)
+	require.Len(t, byID["upload"].History, 1)
+	require.False(t, byID["upload"].NextRetry.IsZero())
+	require.False(t, byID["download"].Upload)
+	require.True(t, byID["download"].NextRetry.IsZero(), "downloads of files that are not pinned wait for the next open")
+	require.Equal(t, metadata.ErrorClassPermission, byID["denied"].LastError.Class)
+	require.True(t, byID["denied"].NextRetry.IsZero())
+
+	due, err := fs.dueErroredEntries(time.Now())
+	require.NoError(t, err)
+	require.Empty(t, due, "nothing is due before its backoff")
+	due, err = fs.dueErroredEntries(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, "upload", due[0].ID)
+
+	_, err = fs.metadataStore.Update(context.Background(), "download", func(entry *metadata.Entry) error {
+		entry.Pin.Mode = metadata.PinModeAlways
+		return nil
+	})
+	require.NoError(t, err)
+	due, err = fs.dueErroredEntries(time.Now().Add(5 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, due, 2, "failed downloads of pinned files are retried")
+}
+
+func TestUT_FS_ErrorRecovery_RetriesRespectUploadHolds(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	large := NewInode("video.mp4", fuse.S_IFREG|0644, nil)
+	large.DriveItem.ID = "large"
+	large.DriveItem.Size = 50 << 20
+	registerHydratedEntry(t, fs, large)
+	fs.transitionItemState("large", metadata.ItemStateError,
+		append(errorTransition(errors.NewOperationError("serviceNotAvailable", nil)), metadata.WithUploadEvent())...)
+
+	fs.SetMeteredUploadThreshold(10 << 20)
+	fs.pollMetered(func() (bool, error) { return true, nil })
+	require.Zero(t, fs.retryErroredItems(time.Now().Add(time.Hour)))
+	require.Equal(t, DeferredMetered, fs.UploadDeferral("large"), "the retry waits for an unmetered connection")
+	entry, err := fs.GetMetadataEntry("large")
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateDirtyLocal, entry.State)
+}
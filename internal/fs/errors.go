@@ -0,0 +1,24 @@
+package fs
+
+import "github.com/auriora/onemount/internal/errors"
+
+// Errors returned by the filesystem match these sentinels with errors.Is,
+// whether they come from the filesystem itself, the metadata store or
+// Microsoft Graph, so callers never need to look at the message.
+var (
+	// ErrNotFound matches errors for items, jobs and entries that do not
+	// exist locally or on OneDrive.
+	ErrNotFound = errors.ErrNotFound
+	// ErrConflict matches changes OneDrive refused because they conflict with
+	// the item on the server, such as a name already in use.
+	ErrConflict = errors.ErrConflict
+	// ErrOffline matches errors for operations that need OneDrive while it
+	// cannot be reached.
+	ErrOffline = errors.ErrOffline
+	// ErrQuotaExceeded matches uploads refused because the OneDrive storage
+	// quota is used up.
+	ErrQuotaExceeded = errors.ErrQuotaExceeded
+	// ErrInvalidTransition matches metadata and replay state changes that are
+	// not allowed.
+	ErrInvalidTransition = errors.ErrInvalidTransition
+)
@@ -0,0 +1,128 @@
+package fs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// The event log keeps the last eventLogCapacity activity events (see
+// activity_feed.go) in memory so users can answer "what just happened?"
+// through D-Bus (GetRecentEvents) or `onemount events` without having enabled
+// debug logging ahead of time. Each event type is rate limited to
+// eventRateBurst per eventRateWindow, so a burst such as a large hydration
+// cannot push everything else out of the buffer; the number of events dropped
+// is reported on the next event of the same type that is kept. The activity
+// feed itself is not rate limited.
+const (
+	eventLogCapacity = 256
+	eventRateWindow  = time.Second
+	eventRateBurst   = 10
+)
+
+// eventRate tracks how many events of one type were seen in the current window.
+type eventRate struct {
+	start   time.Time
+	count   int
+	dropped uint32
+}
+
+// eventLog is a fixed-size ring buffer of recent events. The zero value is
+// ready to use.
+type eventLog struct {
+	mu     sync.Mutex
+	events []ActivityEvent
+	next   int // slot the next event is written to once the buffer is full
+	rates  map[string]*eventRate
+}
+
+// add stores the event unless its type exceeded the rate limit, reporting
+// whether it was kept.
+func (l *eventLog) add(event ActivityEvent) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rates == nil {
+		l.rates = make(map[string]*eventRate)
+	}
+	rate := l.rates[event.Type]
+	if rate == nil {
+		rate = &eventRate{}
+		l.rates[event.Type] = rate
+	}
+	if event.Time.Sub(rate.start) >= eventRateWindow {
+		rate.start = event.Time
+		rate.count = 0
+	}
+	if rate.count >= eventRateBurst {
+		rate.dropped++
+		return false
+	}
+	rate.count++
+	event.Suppressed = rate.dropped
+	rate.dropped = 0
+
+	if len(l.events) < eventLogCapacity {
+		l.events = append(l.events, event)
+		return true
+	}
+	l.events[l.next] = event
+	l.next = (l.next + 1) % eventLogCapacity
+	return true
+}
+
+// recent returns up to count events, oldest first. A count of zero or less
+// returns every retained event.
+func (l *eventLog) recent(count int) []ActivityEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ordered := make([]ActivityEvent, 0, len(l.events))
+	ordered = append(ordered, l.events[l.next:]...)
+	ordered = append(ordered, l.events[:l.next]...)
+	if count > 0 && count < len(ordered) {
+		ordered = ordered[len(ordered)-count:]
+	}
+	return ordered
+}
+
+// recordStateEvent logs a completed state transition, using the stored error
+// as the message for transitions into the error state.
+func (f *Filesystem) recordStateEvent(id string, entry *metadata.Entry) {
+	if entry == nil {
+		return
+	}
+	if entry.State == metadata.ItemStateError {
+		message := "unknown error"
+		if entry.LastError != nil && entry.LastError.Message != "" {
+			message = entry.LastError.Message
+		}
+		f.emitActivity(ActivityError, id, message)
+		return
+	}
+	f.emitActivity(ActivityStateChange, id, string(entry.State))
+}
+
+// recordThrottle logs a request that OneDrive rejected with 429 Too Many
+// Requests.
+func (f *Filesystem) recordThrottle(endpoint, retryAfter string) {
+	message := endpoint
+	if retryAfter != "" {
+		message += ", retry after " + retryAfter
+	}
+	f.emitActivity(ActivityThrottle, "", message)
+}
+
+// RecentEvents returns up to count of the most recent activity events, oldest
+// first. A count of zero or less returns every retained event.
+func (f *Filesystem) RecentEvents(count int) []ActivityEvent {
+	return f.events.recent(count)
+}
+
+// StartEventLog installs the observer that records throttled API requests in
+// the event log.
+func (f *Filesystem) StartEventLog() {
+	f.observeUntilStopped(graph.AddThrottleObserver(f.auth, f.recordThrottle))
+}
@@ -0,0 +1,55 @@
+package fs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_EventLog_RingBufferAndRateLimit(t *testing.T) {
+	var log eventLog
+	start := time.Now()
+	for i := 0; i < eventRateBurst+5; i++ {
+		log.add(ActivityEvent{Time: start, Type: ActivityThrottle})
+	}
+	require.Len(t, log.recent(0), eventRateBurst, "a burst of one kind is capped")
+	require.True(t, log.add(ActivityEvent{Time: start, Type: ActivityOffline}), "other types are not affected")
+
+	next := start.Add(eventRateWindow)
+	require.True(t, log.add(ActivityEvent{Time: next, Type: ActivityThrottle, Message: "later"}))
+	latest := log.recent(1)
+	require.Len(t, latest, 1)
+	require.Equal(t, "later", latest[0].Message)
+	require.Equal(t, uint32(5), latest[0].Suppressed)
+
+	for i := 0; i < eventLogCapacity; i++ {
+		log.add(ActivityEvent{Time: next.Add(time.Duration(i) * eventRateWindow), Type: ActivityStateChange, Message: "fill"})
+	}
+	all := log.recent(0)
+	require.Len(t, all, eventLogCapacity)
+	require.Equal(t, "fill", all[0].Message, "the oldest events are overwritten")
+	require.True(t, all[len(all)-1].Time.After(all[0].Time), "events are returned oldest first")
+}
+
+func TestUT_FS_EventLog_RecordsTransitionsAndThrottles(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	file := NewInode("report.pdf", fuse.S_IFREG|0644, nil)
+	file.DriveItem.ID = "report"
+	registerHydratedEntry(t, fs, file)
+
+	fs.transitionItemState("report", metadata.ItemStateError,
+		metadata.WithTransitionError(errors.New("upload rejected"), false))
+	fs.recordThrottle("/me/drive/items/{id}/content", "30")
+
+	events := fs.RecentEvents(2)
+	require.Len(t, events, 2)
+	require.Equal(t, ActivityError, events[0].Type)
+	require.Equal(t, "upload rejected", events[0].Message)
+	require.Equal(t, file.Path(), events[0].Path)
+	require.Equal(t, ActivityThrottle, events[1].Type)
+	require.Contains(t, events[1].Message, "retry after 30")
+}
@@ -0,0 +1,141 @@
+package fs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// evictionExemption is a compiled path glob that treats matching items as
+// implicitly pinned for content cache eviction. Patterns are relative to the
+// mount root and matched case-insensitively, mirroring OneDrive naming rules.
+// Besides the usual path.Match syntax, a "**" segment matches any number of
+// path segments, including none.
+type evictionExemption struct {
+	pattern  string
+	segments []string
+}
+
+func compileEvictionExemption(pattern string) (evictionExemption, error) {
+	segments, err := compilePathGlob(pattern)
+	if err != nil {
+		return evictionExemption{}, fmt.Errorf("invalid eviction exemption pattern %q: %w", pattern, err)
+	}
+	return evictionExemption{pattern: pattern, segments: segments}, nil
+}
+
+// ValidatePathGlob checks a mount-relative glob as accepted by
+// evictionExemptions and syncTreeScope.
+func ValidatePathGlob(pattern string) error {
+	_, err := compilePathGlob(pattern)
+	return err
+}
+
+// compilePathGlob splits a mount-relative glob into lower-cased segments for
+// matchPathSegments, validating each one.
+func compilePathGlob(pattern string) ([]string, error) {
+	trimmed := strings.Trim(strings.TrimSpace(pattern), "/")
+	if trimmed == "" {
+		return nil, fmt.Errorf("pattern is empty")
+	}
+	segments := strings.Split(strings.ToLower(trimmed), "/")
+	for _, seg := range segments {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// matches reports whether a mount-relative path matches the pattern.
+func (e evictionExemption) matches(itemPath string) bool {
+	trimmed := strings.Trim(itemPath, "/")
+	if trimmed == "" {
+		return false
+	}
+	return matchPathSegments(e.segments, strings.Split(strings.ToLower(trimmed), "/"))
+}
+
+func matchPathSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchPathSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// SetEvictionExemptions configures path globs (e.g. "Documents/Projects/**")
+// whose cached content is never evicted, as if every matching file were pinned.
+// Invalid patterns are rejected and leave the previous configuration in place.
+func (f *Filesystem) SetEvictionExemptions(patterns []string) error {
+	compiled := make([]evictionExemption, 0, len(patterns))
+	for _, pattern := range patterns {
+		exemption, err := compileEvictionExemption(pattern)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, exemption)
+	}
+
+	f.evictionExemptionsM.Lock()
+	f.evictionExemptions = compiled
+	f.evictionExemptionsM.Unlock()
+	return nil
+}
+
+// isEvictionExempt reports whether the item lives under a configured eviction
+// exemption pattern.
+func (f *Filesystem) isEvictionExempt(id string) bool {
+	f.evictionExemptionsM.RLock()
+	exemptions := f.evictionExemptions
+	f.evictionExemptionsM.RUnlock()
+	if len(exemptions) == 0 {
+		return false
+	}
+
+	inode := f.GetID(id)
+	if inode == nil {
+		return false
+	}
+	itemPath := inode.Path()
+	for _, exemption := range exemptions {
+		if exemption.matches(itemPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// exemptedContentBytes sums the cached content size of items protected by an
+// eviction exemption pattern.
+func (f *Filesystem) exemptedContentBytes() (int, int64) {
+	if f.content == nil {
+		return 0, 0
+	}
+	var count int
+	var size int64
+	for id, entrySize := range f.content.GetCacheEntrySizes() {
+		if f.isEvictionExempt(id) {
+			count++
+			size += entrySize
+		}
+	}
+	return count, size
+}
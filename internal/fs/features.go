@@ -0,0 +1,132 @@
+package fs
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Risky subsystems are shipped switched off behind a feature flag and turned
+// on per mount with the "features" section of config.yml (or of the mount's
+// section under "mounts"). Code paths ask FeatureEnabled before taking the
+// new route, which also counts how often each flag was used, so a mount can
+// report over D-Bus which of its flags are on and whether they did anything.
+// A flag is removed once its feature is on for everyone; configuration files
+// naming it keep working, the name is ignored with a warning. Only flags that
+// switch a code path are registered: a subsystem gets its flag together with
+// the code the flag turns on.
+
+// Feature names a subsystem behind a feature flag.
+type Feature string
+
+const (
+	// FeatureMappedReads serves reads of large cached files from a memory
+	// mapping of the file, see mapped_reads.go.
+	FeatureMappedReads Feature = "mappedReads"
+)
+
+// knownFeatures describes each feature flag.
+var knownFeatures = map[Feature]string{
+	FeatureMappedReads: "Serve reads of large cached files from a memory mapping",
+}
+
+// FeatureNames returns the names of the feature flags, sorted.
+func FeatureNames() []string {
+	names := make([]string, 0, len(knownFeatures))
+	for name := range knownFeatures {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupFeature returns the feature called name, ignoring case.
+func LookupFeature(name string) (Feature, bool) {
+	for feature := range knownFeatures {
+		if strings.EqualFold(string(feature), name) {
+			return feature, true
+		}
+	}
+	return "", false
+}
+
+// FeatureFlag is the state of a feature flag of a mount.
+type FeatureFlag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Uses        uint64 `json:"uses"` // times the feature's code path was taken
+}
+
+// featureFlags holds the feature flags of a mount. The zero value has every
+// flag off.
+type featureFlags struct {
+	mu      sync.RWMutex
+	enabled map[Feature]bool
+	uses    sync.Map // Feature -> *atomic.Uint64
+}
+
+// SetFeatures turns on the feature flags set to true in enabled and turns
+// off the others. Unknown names are ignored.
+func (f *Filesystem) SetFeatures(enabled map[string]bool) {
+	flags := make(map[Feature]bool)
+	for name, on := range enabled {
+		feature, ok := LookupFeature(name)
+		if !ok {
+			logging.Warn().Str("feature", name).Msg("Ignoring unknown feature flag")
+			continue
+		}
+		if on {
+			flags[feature] = true
+		}
+	}
+
+	f.features.mu.Lock()
+	previous := f.features.enabled
+	f.features.enabled = flags
+	f.features.mu.Unlock()
+
+	for _, name := range FeatureNames() {
+		feature := Feature(name)
+		if previous[feature] != flags[feature] {
+			logging.Info().Str("feature", name).Bool("enabled", flags[feature]).Msg("Feature flag changed")
+		}
+	}
+}
+
+// FeatureEnabled reports whether the feature flag is on. Code paths behind a
+// flag call it each time they would take the new route, which counts as a
+// use of the flag.
+func (f *Filesystem) FeatureEnabled(feature Feature) bool {
+	f.features.mu.RLock()
+	on := f.features.enabled[feature]
+	f.features.mu.RUnlock()
+	if on {
+		uses, _ := f.features.uses.LoadOrStore(feature, new(atomic.Uint64))
+		uses.(*atomic.Uint64).Add(1)
+	}
+	return on
+}
+
+// FeatureFlags returns the state of every feature flag, sorted by name.
+func (f *Filesystem) FeatureFlags() []FeatureFlag {
+	f.features.mu.RLock()
+	defer f.features.mu.RUnlock()
+	flags := make([]FeatureFlag, 0, len(knownFeatures))
+	for _, name := range FeatureNames() {
+		feature := Feature(name)
+		flag := FeatureFlag{
+			Name:        name,
+			Description: knownFeatures[feature],
+			Enabled:     f.features.enabled[feature],
+		}
+		if uses, ok := f.features.uses.Load(feature); ok {
+			flag.Uses = uses.(*atomic.Uint64).Load()
+		}
+		flags = append(flags, flag)
+	}
+	return flags
+}
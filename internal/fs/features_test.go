@@ -0,0 +1,34 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_Features_FlagsCountUses(t *testing.T) {
+	fs := &Filesystem{}
+	require.False(t, fs.FeatureEnabled(FeatureMappedReads), "flags are off by default")
+
+	fs.SetFeatures(map[string]bool{"MappedReads": true, "streamingReads": true})
+	require.True(t, fs.FeatureEnabled(FeatureMappedReads))
+	require.True(t, fs.FeatureEnabled(FeatureMappedReads))
+	require.False(t, fs.FeatureEnabled("streamingReads"), "unknown flags are ignored")
+
+	flags := fs.FeatureFlags()
+	require.Len(t, flags, len(FeatureNames()))
+	for _, flag := range flags {
+		switch Feature(flag.Name) {
+		case FeatureMappedReads:
+			require.True(t, flag.Enabled)
+			require.Equal(t, uint64(2), flag.Uses)
+		default:
+			require.False(t, flag.Enabled, flag.Name)
+			require.Zero(t, flag.Uses, flag.Name)
+		}
+	}
+
+	fs.SetFeatures(nil)
+	require.False(t, fs.FeatureEnabled(FeatureMappedReads), "a reload turns off flags no longer set")
+	require.Equal(t, uint64(2), fs.FeatureFlags()[0].Uses, "uses are kept across reloads")
+}
@@ -16,9 +16,11 @@ import (
 
 // Mknod creates a regular file. The server doesn't have this yet.
 func (f *Filesystem) Mknod(_ <-chan struct{}, in *fuse.MknodIn, name string, out *fuse.EntryOut) fuse.Status {
+	name = f.normalizeName(name)
 	if isNameRestricted(name) {
 		return fuse.EINVAL
 	}
+	f.noteLocalChange()
 
 	parent := f.GetNodeID(in.NodeId)
 	if parent == nil {
@@ -27,6 +29,9 @@ func (f *Filesystem) Mknod(_ <-chan struct{}, in *fuse.MknodIn, name string, out
 		}
 		return fuse.ENOENT
 	}
+	if status := f.rejectPackageWrite("Mknod", parent); status != fuse.OK {
+		return status
+	}
 	parentID := parent.ID()
 
 	path := filepath.Join(parent.Path(), name)
@@ -49,6 +54,8 @@ func (f *Filesystem) Mknod(_ <-chan struct{}, in *fuse.MknodIn, name string, out
 			return fuse.Status(syscall.EEXIST)
 		}
 	}
+	f.checkFolderGrowth(parentID, 1)
+	f.sendPlannedDelete(parentID, name)
 
 	inode := NewInode(name, in.Mode, parent)
 	ctx.Debug().
@@ -56,6 +63,7 @@ func (f *Filesystem) Mknod(_ <-chan struct{}, in *fuse.MknodIn, name string, out
 		Str("mode", Octal(in.Mode)).
 		Msg("Creating inode.")
 	out.NodeId = f.InsertChild(parentID, inode)
+	out.Generation = inode.Generation()
 	out.Attr = inode.makeAttr()
 	out.SetAttrTimeout(timeout)
 	out.SetEntryTimeout(timeout)
@@ -69,6 +77,7 @@ func (f *Filesystem) Mknod(_ <-chan struct{}, in *fuse.MknodIn, name string, out
 
 // Create creates a regular file and opens it. The server doesn't have this yet.
 func (f *Filesystem) Create(cancel <-chan struct{}, in *fuse.CreateIn, name string, out *fuse.CreateOut) fuse.Status {
+	name = f.normalizeName(name)
 	if hooks := f.testHooks; hooks != nil && hooks.CreateHook != nil {
 		if status, handled := hooks.CreateHook(f, in, name, out); handled {
 			return status
@@ -86,6 +95,9 @@ func (f *Filesystem) Create(cancel <-chan struct{}, in *fuse.CreateIn, name stri
 		name,
 		&out.EntryOut,
 	)
+	if result == fuse.OK || result == fuse.Status(syscall.EEXIST) {
+		out.OpenFlags |= directIOOpenFlags(in.Flags)
+	}
 	if result == fuse.Status(syscall.EEXIST) {
 		// if the inode already exists, we should truncate the existing file and
 		// return the existing file inode as per "man creat"
@@ -173,6 +185,13 @@ func (f *Filesystem) Open(cancel <-chan struct{}, in *fuse.OpenIn, out *fuse.Ope
 				Str(logging.FieldPath, path).
 				Msg("Opening virtual file")
 		}
+		if f.activity.isFeed(id) {
+			// The feed grows between reads; bypass the page cache.
+			out.OpenFlags |= fuse.FOPEN_DIRECT_IO
+		} else if f.policy.isPolicyFile(id) {
+			f.refreshPolicyFile(inode)
+			out.OpenFlags |= fuse.FOPEN_DIRECT_IO
+		}
 		f.updateFileStatus(inode)
 		defer func() {
 			logging.LogMethodExit(methodName, time.Since(startTime), fuse.OK)
@@ -228,6 +247,15 @@ func (f *Filesystem) Open(cancel <-chan struct{}, in *fuse.OpenIn, out *fuse.Ope
 	}
 
 	flags := int(in.Flags)
+	if isDirectIO(in.Flags) {
+		out.OpenFlags |= directIOOpenFlags(in.Flags)
+		if logging.IsDebugEnabled() {
+			logger.Debug().
+				Uint64("nodeID", in.NodeId).
+				Str(logging.FieldID, id).
+				Msg("Opening file with O_DIRECT, bypassing kernel page cache")
+		}
+	}
 	if flags&os.O_RDWR+flags&os.O_WRONLY > 0 && f.IsOffline() {
 		logger.Info().
 			Bool("readWrite", flags&os.O_RDWR > 0).
@@ -242,13 +270,42 @@ func (f *Filesystem) Open(cancel <-chan struct{}, in *fuse.OpenIn, out *fuse.Ope
 			Msg("Opening file")
 	}
 
+	// Give every regular open its own handle so read-ahead can follow each
+	// reader's access pattern independently
+	out.Fh = nextFileHandleID()
+
+	// An archive mount has nothing but the cache to read from
+	if f.ArchiveMode() && !isLocalID(id) && !f.content.HasContent(id) {
+		logger.Debug().Str(logging.FieldID, id).Msg("Content was never cached, not available in an archive mount")
+		defer func() {
+			logging.LogMethodExit(methodName, time.Since(startTime), fuse.ENODATA)
+		}()
+		return fuse.ENODATA
+	}
+
+	// Search indexers would otherwise download the whole drive
+	class := f.classifyAccess(in.Caller.Pid)
+	if !f.mayHydrate(class) && !isLocalID(id) && !f.content.HasContent(id) {
+		f.refuseHydration(id, path, in.Caller.Pid)
+		defer func() {
+			logging.LogMethodExit(methodName, time.Since(startTime), fuse.ENODATA)
+		}()
+		return fuse.ENODATA
+	}
+
 	// Lock ordering: inode.mu only (no filesystem lock needed)
 	// Content cache operations use internal locks.
 	// See docs/guides/developer/concurrency-guidelines.md for lock ordering policy.
 	inode.mu.Lock()
 
 	// try grabbing from disk
-	fd, err := f.content.Open(id)
+	open := f.content.Open
+	if class == AccessIndexer {
+		open = f.content.OpenUntouched
+	} else {
+		f.recordAccess(id)
+	}
+	fd, err := open(id)
 	if err != nil {
 		inode.mu.Unlock()
 		logging.LogErrorWithContext(err, logCtx, "Could not create cache file",
@@ -266,8 +323,9 @@ func (f *Filesystem) Open(cancel <-chan struct{}, in *fuse.OpenIn, out *fuse.Ope
 		return fuse.OK
 	}
 
-	// If we're in offline mode, use the cached content regardless of checksum
-	if f.IsOffline() {
+	// If we're in offline mode or an archive mount, use the cached content
+	// regardless of checksum
+	if f.IsOffline() || f.ArchiveMode() {
 		logger.Info().Msg("Using cached content in offline mode regardless of checksum")
 
 		// we check size ourselves in case the API file sizes are WRONG (it happens)
@@ -290,7 +348,7 @@ func (f *Filesystem) Open(cancel <-chan struct{}, in *fuse.OpenIn, out *fuse.Ope
 		return fuse.OK
 	}
 
-	if inode.DriveItem.VerifyChecksum(graph.QuickXORHashStream(fd)) {
+	if f.Capabilities().VerifyContent(&inode.DriveItem, fd) {
 		// disk content is only used if the checksums match
 		logger.Info().Msg("Found content in cache")
 
@@ -317,10 +375,19 @@ func (f *Filesystem) Open(cancel <-chan struct{}, in *fuse.OpenIn, out *fuse.Ope
 	// Release the lock before network operations
 	inode.mu.Unlock()
 
+	if !f.mayHydrate(class) {
+		f.refuseHydration(id, path, in.Caller.Pid)
+		defer func() {
+			logging.LogMethodExit(methodName, time.Since(startTime), fuse.ENODATA)
+		}()
+		return fuse.ENODATA
+	}
+
 	logger.Info().Msg("Not using cached item due to file hash mismatch, fetching content from API")
 
 	// Queue the download in the background
-	if _, err := f.downloads.QueueDownload(id); err != nil {
+	session, err := f.downloads.QueueDownload(id)
+	if err != nil {
 		logging.LogErrorWithContext(err, logCtx, "Failed to queue download",
 			logging.FieldID, id,
 			logging.FieldPath, path)
@@ -351,7 +418,8 @@ func (f *Filesystem) Open(cancel <-chan struct{}, in *fuse.OpenIn, out *fuse.Ope
 	if err := f.downloads.WaitForDownload(id); err != nil {
 		logging.LogErrorWithContext(err, logCtx, "Download failed",
 			logging.FieldID, id,
-			logging.FieldPath, path)
+			logging.FieldPath, path,
+			logging.FieldCorrelationID, session.GetCorrelationID())
 		defer func() {
 			logging.LogMethodExit(methodName, time.Since(startTime), fuse.EREMOTEIO)
 		}()
@@ -369,6 +437,8 @@ func (f *Filesystem) Open(cancel <-chan struct{}, in *fuse.OpenIn, out *fuse.Ope
 
 // Unlink deletes a child file.
 func (f *Filesystem) Unlink(_ <-chan struct{}, in *fuse.InHeader, name string) fuse.Status {
+	name = f.normalizeName(name)
+	f.noteLocalChange()
 	parent := f.GetNodeID(in.NodeId)
 	if parent == nil {
 		return fuse.ENOENT
@@ -379,6 +449,9 @@ func (f *Filesystem) Unlink(_ <-chan struct{}, in *fuse.InHeader, name string) f
 		// the file we are unlinking never existed
 		return fuse.ENOENT
 	}
+	if status := f.rejectPackageWrite("Unlink", child); status != fuse.OK {
+		return status
+	}
 
 	id := child.ID()
 	path := child.Path()
@@ -398,10 +471,15 @@ func (f *Filesystem) Unlink(_ <-chan struct{}, in *fuse.InHeader, name string) f
 
 	// if no ID, the item is local-only, and does not need to be deleted on the
 	// server
-	if !isLocalID(id) && !f.IsOffline() {
-		f.queueRemoteDelete(id)
+	if !isLocalID(id) && f.StrictPOSIX() {
+		if status := f.strictMutation("delete", id, func() error { return f.remoteDelete(id) }); status != fuse.OK {
+			return status
+		}
+	} else if !isLocalID(id) && !f.IsOffline() {
+		f.planRemoteDelete(child)
 	}
 
+	f.forgetRemoteConflictCopy(id)
 	f.DeleteID(id)
 	if err := f.content.Delete(id); err != nil {
 		ctx.Error().Err(err).Str("id", id).Msg("Failed to delete file content")
@@ -483,7 +561,12 @@ func (f *Filesystem) Read(cancel <-chan struct{}, in *fuse.ReadIn, buf []byte) (
 			Msg("Received Read request")
 	}
 	if inode.IsVirtual() {
-		chunk := inode.ReadVirtualContent(int(in.Offset), int(in.Size))
+		var chunk []byte
+		if f.activity.isFeed(id) {
+			chunk = f.activity.readAt(in.Offset, int(in.Size))
+		} else {
+			chunk = inode.ReadVirtualContent(int(in.Offset), int(in.Size))
+		}
 		result := fuse.ReadResultData(chunk)
 		logging.LogMethodExit(methodName, time.Since(startTime), result, fuse.OK)
 		return result, fuse.OK
@@ -504,6 +587,14 @@ func (f *Filesystem) Read(cancel <-chan struct{}, in *fuse.ReadIn, buf []byte) (
 			Msg("Reading file")
 	}
 
+	if status := f.flushWrites(in.NodeId); status != fuse.OK {
+		emptyResult := fuse.ReadResultData(make([]byte, 0))
+		defer func() {
+			logging.LogMethodExit(methodName, time.Since(startTime), emptyResult, status)
+		}()
+		return emptyResult, status
+	}
+
 	fd, err := f.content.Open(id)
 	if err != nil {
 		logging.LogErrorWithContext(err, logCtx, "Cache Open() failed",
@@ -521,6 +612,16 @@ func (f *Filesystem) Read(cancel <-chan struct{}, in *fuse.ReadIn, buf []byte) (
 	inode.mu.RLock()
 	defer inode.mu.RUnlock()
 
+	// O_DIRECT readers do their own caching and get no read-ahead
+	if !isDirectIO(in.Flags) {
+		f.scheduleReadAhead(fd, readAheadKey{nodeID: in.NodeId, fh: in.Fh}, int64(in.Offset), int(in.Size), int64(inode.DriveItem.Size))
+	}
+
+	if result := f.readMapped(inode, id, fd, in); result != nil {
+		logging.LogMethodExit(methodName, time.Since(startTime), result, fuse.OK)
+		return result, fuse.OK
+	}
+
 	result := fuse.ReadResultFd(fd.Fd(), int64(in.Offset), int(in.Size))
 	defer func() {
 		logging.LogMethodExit(methodName, time.Since(startTime), result, fuse.OK)
@@ -561,6 +662,12 @@ func (f *Filesystem) Write(cancel <-chan struct{}, in *fuse.WriteIn, data []byte
 	offset := int(in.Offset)
 	path := inode.Path()
 
+	if f.activity.isFeed(id) || f.policy.isPolicyFile(id) {
+		defer func() {
+			logging.LogMethodExit(methodName, time.Since(startTime), uint32(0), int32(fuse.EPERM))
+		}()
+		return 0, fuse.EPERM
+	}
 	if inode.IsVirtual() {
 		written, err := inode.WriteVirtualContent(offset, data)
 		if err != nil {
@@ -623,6 +730,14 @@ func (f *Filesystem) Write(cancel <-chan struct{}, in *fuse.WriteIn, data []byte
 		logger.Info().Msg("Write operations in offline mode will be cached locally")
 	}
 
+	if end := in.Offset + uint64(nWrite); exceedsSizeLimit(end) {
+		rejectOversizedWrite("Write", id, path, end)
+		defer func() {
+			logging.LogMethodExit(methodName, time.Since(startTime), uint32(0), int32(fuse.Status(syscall.EFBIG)))
+		}()
+		return 0, fuse.Status(syscall.EFBIG)
+	}
+
 	// Check for large file operations and log warnings
 	const largeFileThreshold = 1024 * 1024 * 1024 // 1GB
 	if nWrite > largeFileThreshold {
@@ -631,8 +746,24 @@ func (f *Filesystem) Write(cancel <-chan struct{}, in *fuse.WriteIn, data []byte
 			Msg("Large write operation detected - this may take some time")
 	}
 
+	// Unshared under the lock, so that concurrent writes copy a shared file
+	// once and write to the copy
+	inode.mu.Lock()
+	if err := f.content.Unshare(id); err != nil {
+		inode.mu.Unlock()
+		logging.LogErrorWithContext(err, logCtx, "Failed to unshare content before write",
+			logging.FieldOperation, "file_write",
+			logging.FieldID, id,
+			logging.FieldPath, path)
+		defer func() {
+			logging.LogMethodExit(methodName, time.Since(startTime), uint32(0), int32(fuse.EIO))
+		}()
+		return 0, fuse.EIO
+	}
+
 	fd, err := f.content.Open(id)
 	if err != nil {
+		inode.mu.Unlock()
 		logging.LogErrorWithContext(err, logCtx, "Cache Open() failed",
 			logging.FieldOperation, "file_write",
 			logging.FieldID, id,
@@ -643,8 +774,22 @@ func (f *Filesystem) Write(cancel <-chan struct{}, in *fuse.WriteIn, data []byte
 		return 0, fuse.EIO
 	}
 
-	inode.mu.Lock()
-	n, err := fd.WriteAt(data, int64(offset))
+	var preSize uint64
+	if st, err := fd.Stat(); err == nil {
+		preSize = uint64(st.Size())
+	}
+	if end := uint64(f.writeBuffers.pendingEnd(in.NodeId)); end > preSize {
+		preSize = end
+	}
+	var n int
+	buffered, err := f.bufferWriteLocked(id, in.NodeId, in.Fh, int64(offset), data, isDirectIO(in.Flags))
+	if err == nil {
+		if buffered {
+			n = nWrite
+		} else {
+			n, err = fd.WriteAt(data, int64(offset))
+		}
+	}
 	if err != nil {
 		inode.mu.Unlock()
 		logging.LogErrorWithContext(err, logCtx, "Error during write",
@@ -659,8 +804,12 @@ func (f *Filesystem) Write(cancel <-chan struct{}, in *fuse.WriteIn, data []byte
 		return uint32(n), fuse.EIO
 	}
 
-	st, _ := fd.Stat()
-	inode.DriveItem.Size = uint64(st.Size())
+	inode.noteWriteLocked(uint64(offset), preSize, data)
+	f.noteAppendWriteLocked(inode, uint64(offset), preSize, !inode.hasChanges)
+	inode.DriveItem.Size = preSize
+	if end := uint64(offset + n); end > preSize {
+		inode.DriveItem.Size = end
+	}
 	inode.hasChanges = true
 	inode.mu.Unlock()
 	f.transitionItemState(id, metadata.ItemStateDirtyLocal)
@@ -703,6 +852,9 @@ func (f *Filesystem) Fsync(_ <-chan struct{}, in *fuse.FsyncIn) fuse.Status {
 		Str("path", inode.Path()).
 		Logger()
 	ctx.Debug().Msg("")
+	if status := f.flushWrites(in.NodeId); status != fuse.OK {
+		return status
+	}
 	if inode.HasChanges() {
 		// recompute hashes when saving new content
 		inode.mu.Lock()
@@ -724,9 +876,31 @@ func (f *Filesystem) Fsync(_ <-chan struct{}, in *fuse.FsyncIn) fuse.Status {
 				logging.FieldPath, inode.Path())
 			return fuse.EIO
 		}
-		inode.DriveItem.File.Hashes.QuickXorHash = graph.QuickXORHashStream(fd)
+		var size uint64
+		if st, err := fd.Stat(); err == nil {
+			size = uint64(st.Size())
+		}
+		inode.DriveItem.File.Hashes.QuickXorHash = inode.contentHashLocked(fd, size)
 		inode.mu.Unlock()
 
+		if f.holdOversizedUpload(inode) {
+			return fuse.Status(syscall.EFBIG)
+		}
+		if f.holdUpload(inode) {
+			ctx.Debug().Msg("Upload is held, keeping changes local")
+			return fuse.OK
+		}
+
+		strict := f.StrictPOSIX()
+		if strict && f.IsOffline() {
+			ctx.Warn().Msg("Strict POSIX mode cannot confirm the upload while offline")
+			return fuse.EREMOTEIO
+		}
+		if !strict && f.deferAppendUpload(inode) {
+			ctx.Debug().Msg("File is only appended to, coalescing its upload")
+			return fuse.OK
+		}
+
 		// Queue the upload in the background with high priority since it's a mount point request
 		_, err = f.uploads.QueueUploadWithPriority(inode, PriorityHigh)
 		if err != nil {
@@ -734,6 +908,15 @@ func (f *Filesystem) Fsync(_ <-chan struct{}, in *fuse.FsyncIn) fuse.Status {
 			return fuse.EREMOTEIO
 		}
 
+		if strict {
+			if err := f.uploads.WaitForUpload(id); err != nil {
+				ctx.Error().Err(err).Msg("Upload failed in strict POSIX mode.")
+				return fuse.EREMOTEIO
+			}
+			ctx.Debug().Str("id", id).Msg("File upload confirmed before returning from fsync")
+			return fuse.OK
+		}
+
 		// Don't wait for the upload to complete, return immediately
 		ctx.Debug().Str("id", id).Msg("File upload queued in background with high priority")
 		return fuse.OK
@@ -779,7 +962,7 @@ func (f *Filesystem) Flush(cancel <-chan struct{}, in *fuse.FlushIn) fuse.Status
 		Str("path", inode.Path()).
 		Uint64("nodeID", in.NodeId).
 		Msg("")
-	f.Fsync(cancel, &fuse.FsyncIn{InHeader: in.InHeader})
+	status := f.Fsync(cancel, &fuse.FsyncIn{InHeader: in.InHeader})
 
 	// grab a lock to prevent a race condition closing an opened file prior to its use (use after free segfault)
 	inode.mu.Lock()
@@ -797,5 +980,9 @@ func (f *Filesystem) Flush(cancel <-chan struct{}, in *fuse.FlushIn) fuse.Status
 			Str(logging.FieldID, id).
 			Msg("Completed Flush request")
 	}
+	if status == fuse.Status(syscall.EFBIG) {
+		// let close() report why the file will never upload
+		return status
+	}
 	return 0
 }
@@ -28,8 +28,10 @@ func (f *Filesystem) Release(_ <-chan struct{}, in *fuse.ReleaseIn) {
 		}
 	}
 
-	// For regular files, we don't need to do anything special
-	// The content cache handles closing files automatically
+	// For regular files only buffered writes and the read-ahead state need
+	// handling. The content cache handles closing files automatically
+	f.flushWrites(in.NodeId)
+	f.readAhead.release(readAheadKey{nodeID: in.NodeId, fh: in.Fh})
 }
 
 // CleanupThumbnails cleans up the thumbnail cache by removing thumbnails
@@ -39,5 +41,5 @@ func (f *Filesystem) Release(_ <-chan struct{}, in *fuse.ReleaseIn) {
 //   - The number of thumbnails removed
 //   - An error if the cleanup failed
 func (f *Filesystem) CleanupThumbnails() (int, error) {
-	return f.thumbnails.CleanupCache(f.cacheExpirationDays)
+	return f.thumbnails.CleanupCache(f.cacheExpiration())
 }
@@ -1,14 +1,11 @@
 package fs
 
 import (
-	"bytes"
+	"io"
 	"sync"
 	"time"
 
 	"github.com/auriora/onemount/internal/logging"
-
-	"github.com/auriora/onemount/internal/graph"
-	bolt "go.etcd.io/bbolt"
 )
 
 // File Status Management
@@ -28,13 +25,21 @@ import (
 // Status Determination:
 // - Status is determined dynamically based on file state
 // - Results are cached with TTL to improve performance
-// - Cache is invalidated when file state changes
+// - Cache is invalidated when file state changes; uploads, downloads and
+//   metadata state transitions also push the new status to xattrs and D-Bus
+//   right away (see status_notify.go)
 //
 // D-Bus Integration:
 // - Status updates are sent via D-Bus signals when available
 // - Falls back to xattr-only mode if D-Bus is unavailable
 // - D-Bus failures are handled gracefully by the D-Bus server
 
+// Status xattrs maintained by updateFileStatus.
+const (
+	xattrStatus      = "user.onemount.status"
+	xattrStatusError = "user.onemount.error"
+)
+
 // statusCacheEntry represents a cached status determination result
 type statusCacheEntry struct {
 	status    FileStatusInfo
@@ -163,6 +168,8 @@ func (f *Filesystem) determineFileStatus(id string) FileStatusInfo {
 					return FileStatusInfo{Status: StatusLocalModified, Timestamp: time.Now()}
 				case uploadStarted:
 					return FileStatusInfo{Status: StatusSyncing, Timestamp: time.Now()}
+				case uploadVerifying:
+					return FileStatusInfo{Status: StatusVerifying, Timestamp: time.Now()}
 				case uploadComplete:
 					return FileStatusInfo{Status: StatusLocal, Timestamp: time.Now()}
 				case uploadErrored:
@@ -188,24 +195,7 @@ func (f *Filesystem) determineFileStatus(id string) FileStatusInfo {
 	}
 
 	// Check if file has offline changes (database query - expensive)
-	hasOfflineChanges := false
-	if err := f.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketOfflineChanges)
-		if b == nil {
-			return nil
-		}
-
-		// Check if there are any changes for this ID
-		c := b.Cursor()
-		prefix := []byte(id + "-")
-		k, _ := c.Seek(prefix)
-		if k != nil && bytes.HasPrefix(k, prefix) {
-			hasOfflineChanges = true
-		}
-		return nil
-	}); err != nil {
-		logging.DefaultLogger.Error().Err(err).Str("id", id).Msg("Error checking offline changes")
-	}
+	hasOfflineChanges := f.batchCheckOfflineChanges([]string{id})[id]
 
 	if hasOfflineChanges {
 		return FileStatusInfo{Status: StatusLocalModified, Timestamp: time.Now()}
@@ -224,18 +214,19 @@ func (f *Filesystem) determineFileStatus(id string) FileStatusInfo {
 		if inode != nil {
 			// Only verify checksum if the inode has a remote hash to compare against
 			// This avoids expensive hash calculation when not needed
+			caps := f.Capabilities()
 			inode.mu.RLock()
-			hasRemoteHash := inode.DriveItem.File != nil &&
-				inode.DriveItem.File.Hashes.QuickXorHash != ""
+			item := inode.DriveItem
 			inode.mu.RUnlock()
 
-			if hasRemoteHash {
+			if caps.HasVerifiableHash(&item) {
 				// Perform hash verification (expensive - only when necessary)
+				// The descriptor is shared with open handles, so it is read
+				// positionally and left open.
 				fd, err := f.content.Open(id)
 				if err == nil {
-					defer fd.Close()
-					localHash := graph.QuickXORHashStream(fd)
-					if !inode.VerifyChecksum(localHash) {
+					if st, statErr := fd.Stat(); statErr == nil &&
+						!caps.VerifyContent(&item, io.NewSectionReader(fd, 0, st.Size())) {
 						return FileStatusInfo{Status: StatusOutofSync, Timestamp: time.Now()}
 					}
 				}
@@ -251,13 +242,11 @@ func (f *Filesystem) determineFileStatus(id string) FileStatusInfo {
 // SetFileStatus updates the status of a file
 func (f *Filesystem) SetFileStatus(id string, status FileStatusInfo) {
 	f.statusM.Lock()
-	defer f.statusM.Unlock()
 	f.statuses[id] = status
+	f.statusM.Unlock()
 
-	// Invalidate the determination cache since we have an explicit status
-	if f.statusCache != nil {
-		f.statusCache.invalidate(id)
-	}
+	// Invalidate the determination cache and publish the explicit status
+	f.notifyStatusChange(id)
 }
 
 // MarkFileDownloading marks a file as currently downloading
@@ -292,6 +281,8 @@ func (f *Filesystem) MarkFileConflict(id string, message string) {
 		ErrorMsg:  message,
 		Timestamp: time.Now(),
 	})
+	f.emitActivity(ActivityConflict, id, message)
+	f.emitConflictDetected(id, message)
 }
 
 // InodePath returns the full path of an inode
@@ -327,13 +318,13 @@ func (f *Filesystem) updateFileStatus(inode *Inode) {
 	pathCopy := path
 	var statusStrCopy string
 
-	// Lock the inode before getting the status to prevent race conditions
-	inode.mu.Lock()
-
-	// Get the status after locking the inode
+	// Determine the status before locking the inode: determination may read
+	// the inode itself (hash verification) and the lock is not reentrant.
 	status := f.GetFileStatus(id)
 	statusStr := status.Status.String()
 
+	inode.mu.Lock()
+
 	// Store the status string for D-Bus signal
 	statusStrCopy = statusStr
 
@@ -348,14 +339,14 @@ func (f *Filesystem) updateFileStatus(inode *Inode) {
 
 	// Set the status xattr (in-memory operation, cannot fail)
 	// Note: These xattrs are stored in-memory only and are accessible via FUSE xattr operations
-	inode.xattrs["user.onemount.status"] = []byte(statusStr)
+	inode.xattrs[xattrStatus] = []byte(statusStr)
 
 	// If there's an error message, set it too
 	if status.ErrorMsg != "" {
-		inode.xattrs["user.onemount.error"] = []byte(status.ErrorMsg)
+		inode.xattrs[xattrStatusError] = []byte(status.ErrorMsg)
 	} else {
 		// Remove the error xattr if it exists
-		delete(inode.xattrs, "user.onemount.error")
+		delete(inode.xattrs, xattrStatusError)
 	}
 
 	// Track xattr support status (always true since xattrs are in-memory)
@@ -442,33 +433,17 @@ func (f *Filesystem) GetFileStatusBatch(ids []string) map[string]FileStatusInfo
 
 // batchCheckOfflineChanges checks offline changes for multiple files in a single transaction
 func (f *Filesystem) batchCheckOfflineChanges(ids []string) map[string]bool {
-	result := make(map[string]bool, len(ids))
-
-	// Initialize all to false
-	for _, id := range ids {
-		result[id] = false
+	journal, err := f.offlineJournal()
+	if err != nil {
+		logging.DefaultLogger.Error().Err(err).Msg("Error batch checking offline changes")
+		return make(map[string]bool, len(ids))
 	}
 
 	// Single database transaction for all IDs
-	if err := f.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketOfflineChanges)
-		if b == nil {
-			return nil
-		}
-
-		c := b.Cursor()
-		for _, id := range ids {
-			prefix := []byte(id + "-")
-			k, _ := c.Seek(prefix)
-			if k != nil && bytes.HasPrefix(k, prefix) {
-				result[id] = true
-			}
-		}
-		return nil
-	}); err != nil {
+	result, err := journal.HasChanges(ids)
+	if err != nil {
 		logging.DefaultLogger.Error().Err(err).Msg("Error batch checking offline changes")
 	}
-
 	return result
 }
 
@@ -491,6 +466,8 @@ func (f *Filesystem) determineFileStatusOptimized(id string, hasOfflineChanges b
 					return FileStatusInfo{Status: StatusLocalModified, Timestamp: time.Now()}
 				case uploadStarted:
 					return FileStatusInfo{Status: StatusSyncing, Timestamp: time.Now()}
+				case uploadVerifying:
+					return FileStatusInfo{Status: StatusVerifying, Timestamp: time.Now()}
 				case uploadComplete:
 					return FileStatusInfo{Status: StatusLocal, Timestamp: time.Now()}
 				case uploadErrored:
@@ -31,6 +31,10 @@ const (
 
 	// StatusConflict indicates there is a conflict between local and remote versions
 	StatusConflict
+
+	// StatusVerifying indicates the file has been uploaded and OneDrive's copy
+	// is being checked against it
+	StatusVerifying
 )
 
 // FileStatusInfo contains detailed information about a file's status
@@ -60,6 +64,8 @@ func (s FileStatus) String() string {
 		return "Error"
 	case StatusConflict:
 		return "Conflict"
+	case StatusVerifying:
+		return "Verifying"
 	default:
 		return "Unknown"
 	}
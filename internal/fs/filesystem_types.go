@@ -8,6 +8,7 @@ import (
 
 	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/metadata"
+	"github.com/auriora/onemount/internal/util"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	bolt "go.etcd.io/bbolt"
 )
@@ -55,6 +56,12 @@ type FileStatusDBusServerInterface interface {
 
 	// SendFileStatusUpdate sends a D-Bus signal with the updated file status
 	SendFileStatusUpdate(path string, status string)
+
+	// SendFileProgressUpdate sends a D-Bus signal with transfer progress for a file
+	SendFileProgressUpdate(path string, status string, progress float64, bytesDone, bytesTotal uint64)
+
+	// SendConflictDetected sends a D-Bus signal asking clients to resolve a conflict
+	SendConflictDetected(path string, message string)
 }
 
 // Filesystem is the actual FUSE filesystem implementation for onemount.
@@ -69,6 +76,7 @@ type Filesystem struct {
 	db                   *bolt.DB        // Persistent database for filesystem state
 	content              *LoopbackCache  // Cache for file contents
 	thumbnails           *ThumbnailCache // Cache for file thumbnails
+	thumbnailLimit       atomic.Int64    // Size the thumbnail cache is kept under, 0 = unlimited
 	nodeIndexMu          sync.RWMutex
 	nodeIndex            map[uint64]*Inode
 	metadataStore        metadata.Store          // Structured metadata persistence
@@ -91,6 +99,8 @@ type Filesystem struct {
 	cacheCleanupStop     chan struct{}  // Channel to signal cache cleanup to stop
 	cacheCleanupStopOnce sync.Once      // Ensures cleanup is stopped only once
 	cacheCleanupWg       sync.WaitGroup // Wait group for cache cleanup goroutine
+	cacheCleanupStarted  atomic.Bool    // Whether the cleanup goroutine was started
+	cacheLedgerDir       string         // Ledger of the caches sharing the size limit, "" to share it with none
 
 	// DeltaLoop stop channel and context
 	deltaLoopStop     chan struct{}      // Channel to signal delta loop to stop
@@ -99,24 +109,170 @@ type Filesystem struct {
 	deltaLoopCtx      context.Context    // Context for delta loop cancellation
 	deltaLoopCancel   context.CancelFunc // Function to cancel delta loop context
 
+	deltaBootstrap     chan struct{} // Closed once the first delta cycle has finished
+	deltaBootstrapOnce sync.Once
+	deltaScheduler     *DeltaScheduler // Shared with the other mounts of the process, nil when alone
+
 	sync.RWMutex          // Mutex for filesystem state
 	offline      bool     // Whether the filesystem is in offline mode
 	lastNodeID   uint64   // Last assigned node ID
 	inodes       []string // List of inode IDs
 
 	// Tracks currently open directories
-	opendirsM sync.RWMutex        // Mutex for open directories map
-	opendirs  map[uint64][]*Inode // Map of open directories by node ID
+	opendirsM     sync.RWMutex          // Mutex for open directories map
+	opendirs      map[uint64]*dirStream // Map of open directories by file handle
+	lastDirHandle uint64                // Last assigned directory file handle
 
 	// Track file statuses
 	statusM        sync.RWMutex              // Mutex for file statuses map
 	statuses       map[string]FileStatusInfo // Map of file statuses by ID
 	statusCache    *statusCache              // Cache for status determination results
 	statusCacheTTL time.Duration             // TTL for status cache entries (default: 5 seconds)
+	statusNotify   statusNotifier            // Pending status refreshes pushed to xattrs and D-Bus
 
 	// D-Bus server for file status updates
 	dbusServer *FileStatusDBusServer
 
+	// Byte-level progress for in-flight hydrations and uploads
+	transferProgress *progressTracker
+
+	// Volatility-driven kernel attribute cache timeouts and hit/miss counters
+	attrCache attrCachePolicy
+
+	// Per-handle sequential access detection and read-ahead counters
+	readAhead readAheadTracker
+
+	// Pending runs of small sequential writes per open handle
+	writeBuffers writeCoalescer
+
+	// Files only appended to since they were in sync, whose uploads are coalesced
+	appendUploads appendUploads
+
+	// Folder item count warning and the folders already warned about
+	folderLimits folderLimits
+
+	// Recent uploads sampled by upload audits
+	uploadAudit uploadAudit
+
+	// Transfer chunk sizes learned for the current network
+	chunkTuner chunkTuner
+
+	// FUSE server used to invalidate kernel entries after remote renames
+	kernelNotify kernelNotify
+
+	// Snapshot of the metadata database, nil unless it is kept in memory
+	// because the cache directory is on a network filesystem
+	metadataSnapshot *metadataSnapshot
+
+	// What an ephemeral mount removes when it stops, nil for other mounts
+	ephemeral *ephemeralCache
+
+	// Recent sync activity served through the .onemount/events virtual file
+	activity activityFeed
+
+	// Recent notable events served through D-Bus GetRecentEvents
+	events eventLog
+
+	// How long remote changes took to appear, see realtime_latency.go
+	latency realtimeLatency
+
+	// Inodes under .onemount-preview, see preview.go
+	previews previewTree
+
+	// Orders moves with the operations below the moved items, see dir_fence.go
+	fences dirFences
+
+	// Activity counted for the periodic sync digest
+	digest syncDigest
+
+	// Counters served to Prometheus, see metrics.go
+	metrics mountMetrics
+
+	// Results of the last cache verifications by item ID, read back through
+	// the user.onemount.verify xattr
+	verifications sync.Map
+
+	// Long-running operations tracked as jobs
+	jobs jobManager
+
+	// Bulk local operations pausing delta processing
+	bulk bulkOperations
+
+	// System suspend state followed from logind
+	suspend suspendState
+
+	// Deletion counters of item IDs reported as inode generations
+	generations itemGenerations
+
+	// Settings changed while mounted (delta interval, cache expiration,
+	// default overlay policy), the bandwidth limit and the reload hook
+	settingsM      sync.RWMutex
+	settingsReload func() error
+	bandwidth      atomic.Pointer[util.BandwidthThrottler]
+
+	// The .onemount/policy.yml virtual file
+	policy policyFile
+
+	// Graph features detected for the account (hash facets, delta and quota
+	// support); defaults for an unknown drive type until detection succeeds
+	capabilitiesM sync.RWMutex
+	capabilities  graph.Capabilities
+
+	// Server errors seen and the last check of the OneDrive service, see
+	// service_health.go
+	serviceHealth serviceHealthMonitor
+
+	// Daily resource usage counters and the optional transfer cap
+	usage usageTracker
+
+	// Uploads deferred while the connection is metered
+	meteredUploads meteredUploads
+
+	// Content store shared with other mounts of the same account (nil when disabled)
+	sharedContent *SharedContentStore
+
+	// Cached items by content hash, for hydrating identical copies locally
+	contentIndex contentHashIndex
+
+	// Configuration and log file included in support bundles
+	supportM       sync.RWMutex
+	supportSources SupportBundleSources
+
+	// Strict POSIX mode: metadata operations and fsync wait for OneDrive,
+	// inode numbers are derived from item IDs
+	strictPOSIX bool
+
+	// Keep offline changes until ApplyOfflineReplay, see replay_plan.go
+	reviewReplay bool
+
+	// Convert names entering the mount to NFC, and the cached names that
+	// could not be converted, see name_normalization.go
+	nfcNames       atomic.Bool
+	nameCollisions []string
+
+	// Archive mount: serve the cache only, see archive_mode.go
+	archive bool
+
+	// Expose onedriver's xattr and D-Bus names as well
+	onedriverCompat bool
+
+	// Template for conflict copy names; empty means DefaultConflictNameTemplate
+	conflictNameTemplate string
+
+	// Depth limit and path filters for the background tree sync
+	syncTreeM     sync.RWMutex
+	syncTree      syncTreeFilter
+	syncTreeScope SyncTreeScope
+	ignoreRules   []string // imported through the policy, stored with the root
+	ignoreLoaded  bool
+
+	// Path globs treated as implicitly pinned by the content eviction guard
+	evictionExemptionsM sync.RWMutex
+	evictionExemptions  []evictionExemption
+
+	// Access classes of opens, keeping search indexers from hydrating files
+	access accessClasses
+
 	// StatFs warning throttling
 	statfsWarningM    sync.RWMutex // Mutex for StatFs warning state
 	statfsWarningTime time.Time    // Last time StatFs warning was shown
@@ -165,9 +321,20 @@ type Filesystem struct {
 	mutationQueueStop chan struct{}
 	mutationStopOnce  sync.Once
 
+	// Feature flags of subsystems shipped switched off, see features.go
+	features featureFlags
+
+	// Remote deletes waiting to be carried out together, see bulk_delete.go
+	deletePlan deletePlan
+
+	// Access times waiting to be written, see access_times.go
+	accessTimes accessTimes
+
 	// Test hooks (only used in unit/integration tests)
 	testHooks *FilesystemTestHooks
 
 	// Stop synchronization
-	stopOnce sync.Once // Ensures Stop is only called once
+	stopOnce     sync.Once            // Ensures Stop is only called once
+	shutdownOnce sync.Once            // Creates shutdown on first use
+	shutdown     *shutdownCoordinator // Runs the shutdown stages in order, see shutdown.go
 }
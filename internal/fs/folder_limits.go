@@ -0,0 +1,169 @@
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	bolt "go.etcd.io/bbolt"
+)
+
+// OneDrive for Business slows down and some operations fail in folders with
+// more than about 5000 items, and SharePoint list views stop working. The
+// limit is not enforced when items are created, so the trouble shows up
+// later. Creating, making or moving an item into a folder that would then
+// hold more items than the folder item warning is logged and reported in the
+// activity feed, once until the folder is back under it. Folders show their
+// item count in the user.onemount.item_count attribute, and OversizedFolders
+// lists the folders over a limit for restructuring.
+
+// DefaultFolderItemWarning is the folder item count warned about unless one
+// is configured.
+const DefaultFolderItemWarning = 5000
+
+// xattrItemCount exposes the number of items in a folder.
+const xattrItemCount = "user.onemount.item_count"
+
+// ActivityLargeFolder reports a folder growing past the folder item warning.
+const ActivityLargeFolder = "large-folder"
+
+// folderLimits tracks the folder item warning. The zero value never warns.
+type folderLimits struct {
+	mu     sync.Mutex
+	limit  int
+	warned map[string]struct{} // folders over the limit already warned about
+}
+
+// FolderItemCount is a folder listed by OversizedFolders.
+type FolderItemCount struct {
+	ID    string
+	Path  string
+	Items int
+}
+
+// SetFolderItemWarning sets the item count above which local changes to a
+// folder are warned about; 0 or less disables the warning.
+func (f *Filesystem) SetFolderItemWarning(limit int) {
+	f.folderLimits.mu.Lock()
+	f.folderLimits.limit = limit
+	f.folderLimits.warned = nil
+	f.folderLimits.mu.Unlock()
+}
+
+// FolderItemWarning returns the folder item warning, 0 when disabled.
+func (f *Filesystem) FolderItemWarning() int {
+	f.folderLimits.mu.Lock()
+	defer f.folderLimits.mu.Unlock()
+	return f.folderLimits.limit
+}
+
+// folderItemCount returns the number of items known in the folder.
+func (f *Filesystem) folderItemCount(id string) int {
+	count := 0
+	if inode := f.GetID(id); inode != nil {
+		count = len(inode.GetChildren())
+	}
+	if entry, err := f.GetMetadataEntry(id); err == nil && len(entry.Children) > count {
+		count = len(entry.Children)
+	}
+	return count
+}
+
+// checkFolderGrowth warns when adding items to the folder would take it past
+// the folder item warning. It never prevents the change.
+func (f *Filesystem) checkFolderGrowth(folderID string, adding int) {
+	l := &f.folderLimits
+	l.mu.Lock()
+	limit := l.limit
+	l.mu.Unlock()
+	if limit <= 0 || folderID == "" {
+		return
+	}
+
+	count := f.folderItemCount(folderID) + adding
+	l.mu.Lock()
+	_, warned := l.warned[folderID]
+	if count <= limit {
+		delete(l.warned, folderID)
+		l.mu.Unlock()
+		return
+	}
+	if l.warned == nil {
+		l.warned = make(map[string]struct{})
+	}
+	l.warned[folderID] = struct{}{}
+	l.mu.Unlock()
+	if warned {
+		return
+	}
+
+	message := fmt.Sprintf("%d items, more than the %d OneDrive handles well", count, limit)
+	path := folderID
+	if inode := f.GetID(folderID); inode != nil {
+		path = inode.Path()
+	}
+	logging.Warn().Str("path", path).Int("items", count).Int("limit", limit).
+		Msg("Folder is growing past the OneDrive folder item limit, consider splitting it")
+	f.emitActivity(ActivityLargeFolder, folderID, message)
+}
+
+// itemCountXAttr returns the value of user.onemount.item_count for a folder.
+func (f *Filesystem) itemCountXAttr(id string) []byte {
+	return []byte(strconv.Itoa(f.folderItemCount(id)))
+}
+
+// OversizedFolders returns the folders in the metadata store holding more
+// than limit items, largest first.
+func (f *Filesystem) OversizedFolders(limit int) ([]FolderItemCount, error) {
+	if f.db == nil {
+		return nil, nil
+	}
+	entries := make(map[string]*metadata.Entry)
+	err := f.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMetadataV2)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var entry metadata.Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return nil
+			}
+			entries[entry.ID] = &entry
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read metadata entries")
+	}
+
+	var folders []FolderItemCount
+	for _, entry := range entries {
+		// Folders made locally are only typed as folders once uploaded.
+		isDir := entry.ItemType == metadata.ItemKindDirectory || entry.Mode&syscall.S_IFMT == syscall.S_IFDIR
+		if !isDir || entry.Virtual || entry.State == metadata.ItemStateDeleted || len(entry.Children) <= limit {
+			continue
+		}
+		p := "/"
+		if entry.ParentID != "" {
+			var ok bool
+			if p, ok = policyEntryPath(entries, entry); !ok {
+				continue
+			}
+		}
+		folders = append(folders, FolderItemCount{ID: entry.ID, Path: p, Items: len(entry.Children)})
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		if folders[i].Items != folders[j].Items {
+			return folders[i].Items > folders[j].Items
+		}
+		return folders[i].Path < folders[j].Path
+	})
+	return folders, nil
+}
@@ -0,0 +1,101 @@
+package fs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// addFolderWithItems registers a folder named name under parent holding n
+// files.
+func addFolderWithItems(t *testing.T, fs *Filesystem, parent *Inode, name string, n int) *Inode {
+	t.Helper()
+	dir := NewInode(name, fuse.S_IFDIR|0755, parent)
+	dir.DriveItem.ID = name
+	dir.children = []string{}
+	for i := 0; i < n; i++ {
+		child := NewInode(fmt.Sprintf("file-%d.txt", i), fuse.S_IFREG|0644, dir)
+		child.DriveItem.ID = fmt.Sprintf("%s-%d", name, i)
+		dir.children = append(dir.children, child.ID())
+		registerHydratedEntry(t, fs, child)
+	}
+	registerHydratedEntry(t, fs, dir)
+	parent.children = append(parent.children, dir.ID())
+	fs.persistMetadataEntry(parent.ID(), parent)
+	return dir
+}
+
+func TestUT_FS_FolderLimits_WarnsOncePerCrossing(t *testing.T) {
+	fs, events := setupActivityFeedFS(t)
+	root := fs.GetID("root")
+	dir := addFolderWithItems(t, fs, root, "photos", 2)
+	fs.SetFolderItemWarning(2)
+
+	fs.checkFolderGrowth(dir.ID(), 1)
+	fs.checkFolderGrowth(dir.ID(), 1)
+
+	var warnings []ActivityEvent
+	for _, event := range readFeedEvents(t, fs, events, 0) {
+		if event.Type == ActivityLargeFolder {
+			warnings = append(warnings, event)
+		}
+	}
+	require.Len(t, warnings, 1, "a folder past the limit is only reported once")
+	require.Equal(t, "/photos", warnings[0].Path)
+
+	// Back under the limit, the next crossing is reported again.
+	fs.checkFolderGrowth(dir.ID(), 0)
+	fs.checkFolderGrowth(dir.ID(), 1)
+	warnings = warnings[:0]
+	for _, event := range readFeedEvents(t, fs, events, 0) {
+		if event.Type == ActivityLargeFolder {
+			warnings = append(warnings, event)
+		}
+	}
+	require.Len(t, warnings, 2)
+}
+
+func TestUT_FS_FolderLimits_DisabledNeverWarns(t *testing.T) {
+	fs, events := setupActivityFeedFS(t)
+	dir := addFolderWithItems(t, fs, fs.GetID("root"), "photos", 3)
+	fs.SetFolderItemWarning(-1)
+
+	fs.checkFolderGrowth(dir.ID(), 1)
+
+	for _, event := range readFeedEvents(t, fs, events, 0) {
+		require.NotEqual(t, ActivityLargeFolder, event.Type)
+	}
+}
+
+func TestUT_FS_FolderLimits_ItemCountXAttr(t *testing.T) {
+	fs, _ := setupActivityFeedFS(t)
+	dir := addFolderWithItems(t, fs, fs.GetID("root"), "photos", 3)
+
+	require.Contains(t, xattrNamesLocked(dir), xattrItemCount)
+	buf := make([]byte, 16)
+	n, status := fs.GetXAttr(nil, &fuse.InHeader{NodeId: dir.NodeID()}, xattrItemCount, buf)
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, "3", string(buf[:n]))
+
+	file := fs.GetID("photos-0")
+	require.NotContains(t, xattrNamesLocked(file), xattrItemCount)
+	_, status = fs.GetXAttr(nil, &fuse.InHeader{NodeId: file.NodeID()}, xattrItemCount, buf)
+	require.NotEqual(t, fuse.OK, status, "files have no item count")
+}
+
+func TestUT_FS_FolderLimits_OversizedFoldersLargestFirst(t *testing.T) {
+	fs, _ := setupActivityFeedFS(t)
+	root := fs.GetID("root")
+	small := addFolderWithItems(t, fs, root, "small", 1)
+	addFolderWithItems(t, fs, small, "nested", 4)
+	addFolderWithItems(t, fs, root, "big", 5)
+
+	folders, err := fs.OversizedFolders(3)
+	require.NoError(t, err)
+	require.Equal(t, []FolderItemCount{
+		{ID: "big", Path: "/big", Items: 5},
+		{ID: "nested", Path: "/small/nested", Items: 4},
+	}, folders)
+}
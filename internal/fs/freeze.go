@@ -0,0 +1,331 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Frozen files are local overrides of a remote item, e.g. a machine-specific
+// tweak to a shared configuration template:
+//
+//   - Local edits are kept on this machine and never uploaded; the item simply
+//     stays DIRTY_LOCAL without an upload being queued.
+//   - Remote edits do not replace the local content. The remote version is
+//     downloaded into a conflict copy next to the file instead. The copy is
+//     itself frozen so it is not pushed to every collaborator.
+//   - Unfreezing reconciles: a remote version newer than the last one seen is
+//     saved as a conflict copy, then the local content is uploaded (or queued
+//     for replay when offline).
+//
+// The flag is stored as the xattrFrozen extended attribute, which persists with
+// the item's metadata entry.
+const xattrFrozen = "user.onemount.frozen"
+
+// ErrFreezeDirectory is returned when freezing anything other than a file.
+var ErrFreezeDirectory = errors.New("only files can be frozen")
+
+// parseFrozenValue interprets a value written to xattrFrozen.
+func parseFrozenValue(value []byte) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(strings.TrimRight(string(value), "\x00"))) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "", "0", "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid value %q for %s", value, xattrFrozen)
+}
+
+func entryFrozen(entry *metadata.Entry) bool {
+	if entry == nil {
+		return false
+	}
+	_, ok := entry.Xattrs[xattrFrozen]
+	return ok
+}
+
+// IsFrozen reports whether local edits to the item are kept from syncing.
+func (f *Filesystem) IsFrozen(id string) bool {
+	if inode := f.GetID(id); inode != nil {
+		inode.mu.RLock()
+		_, ok := inode.xattrs[xattrFrozen]
+		inode.mu.RUnlock()
+		return ok
+	}
+	entry, err := f.GetMetadataEntry(id)
+	return err == nil && entryFrozen(entry)
+}
+
+// Freeze stops local edits to a file from being uploaded. A pending upload for
+// the file is cancelled; its local content is kept.
+func (f *Filesystem) Freeze(id string) error {
+	inode := f.GetID(id)
+	if inode == nil {
+		return errors.NewNotFoundError("item not found", nil)
+	}
+	if inode.IsDir() {
+		return ErrFreezeDirectory
+	}
+	if err := f.setFrozen(inode, true); err != nil {
+		return err
+	}
+	if f.uploads != nil && inode.HasChanges() {
+		f.uploads.CancelUpload(id)
+	}
+	logging.Info().Str("id", id).Str("path", inode.Path()).Msg("Froze item; local edits will not be uploaded")
+	return nil
+}
+
+// Unfreeze lets the item sync again and reconciles any local edits made while
+// it was frozen.
+func (f *Filesystem) Unfreeze(ctx context.Context, id string) error {
+	return f.unfreezeWith(ctx, id, graphItemRemote{ctx: ctx, auth: f.auth})
+}
+
+// applyFrozenXAttr freezes or unfreezes the inode on behalf of an xattr write.
+func (f *Filesystem) applyFrozenXAttr(inode *Inode, frozen bool) fuse.Status {
+	var err error
+	if frozen {
+		err = f.Freeze(inode.ID())
+	} else if f.IsFrozen(inode.ID()) {
+		err = f.Unfreeze(context.Background(), inode.ID())
+	}
+	switch {
+	case err == nil:
+		return fuse.OK
+	case errors.Is(err, ErrFreezeDirectory):
+		return fuse.Status(syscall.EISDIR)
+	default:
+		logging.Warn().Err(err).Str("id", inode.ID()).Bool("frozen", frozen).Msg("Failed to update frozen flag")
+		return fuse.EIO
+	}
+}
+
+func (f *Filesystem) setFrozen(inode *Inode, frozen bool) error {
+	id := inode.ID()
+	inode.mu.Lock()
+	if frozen {
+		if inode.xattrs == nil {
+			inode.xattrs = make(map[string][]byte)
+		}
+		inode.xattrs[xattrFrozen] = []byte("1")
+	} else {
+		delete(inode.xattrs, xattrFrozen)
+	}
+	inode.mu.Unlock()
+
+	if f.metadataStore == nil {
+		return nil
+	}
+	_, err := f.UpdateMetadataEntry(id, func(entry *metadata.Entry) error {
+		if frozen {
+			if entry.Xattrs == nil {
+				entry.Xattrs = make(map[string][]byte)
+			}
+			entry.Xattrs[xattrFrozen] = []byte("1")
+		} else {
+			delete(entry.Xattrs, xattrFrozen)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, metadata.ErrNotFound) {
+		return errors.Wrap(err, "failed to persist frozen flag")
+	}
+	return nil
+}
+
+// holdFrozenUpload is checked before queueing an upload. For frozen items it
+// records the local edit as DIRTY_LOCAL and reports true so the caller skips
+// the upload.
+func (f *Filesystem) holdFrozenUpload(inode *Inode) bool {
+	if inode == nil || !f.IsFrozen(inode.ID()) {
+		return false
+	}
+	f.markPendingUpload(inode.ID())
+	logging.Debug().Str("id", inode.ID()).Msg("Holding upload for frozen item")
+	return true
+}
+
+// frozenHasLocalEdits reports whether a frozen entry holds content that differs
+// from the remote version it was based on.
+func frozenHasLocalEdits(entry *metadata.Entry) bool {
+	return entryFrozen(entry) &&
+		(entry.State == metadata.ItemStateDirtyLocal || entry.State == metadata.ItemStateConflict)
+}
+
+// remoteContentChanged compares content tags, falling back to ETags (which
+// also change on renames) when either side lacks a cTag.
+func remoteContentChanged(entry *metadata.Entry, remote *graph.DriveItem) bool {
+	if entry.CTag != "" && remote.CTag != "" {
+		return entry.CTag != remote.CTag
+	}
+	return entry.ETag != "" && remote.ETag != "" && entry.ETag != remote.ETag
+}
+
+// applyFrozenDelta applies a server-side change to a frozen file with local
+// edits. Names and locations follow the server, but the local content and size
+// are kept; a remote content change is saved as a conflict copy.
+func (f *Filesystem) applyFrozenDelta(ctx context.Context, prior *metadata.Entry, delta *graph.DriveItem) error {
+	return f.applyFrozenDeltaWith(ctx, prior, delta, graphItemRemote{ctx: ctx, auth: f.auth})
+}
+
+func (f *Filesystem) applyFrozenDeltaWith(ctx context.Context, prior *metadata.Entry, delta *graph.DriveItem, remote itemRemote) error {
+	id := prior.ID
+	if remoteContentChanged(prior, delta) {
+		if _, err := f.createFrozenConflictCopy(ctx, prior.ParentID, prior.Name, delta.ID, remote); err != nil {
+			// Keep the old base so unfreezing still detects the divergence.
+			return errors.Wrap(err, "failed to save remote version of frozen item")
+		}
+	}
+
+	size := prior.Size
+	if inode := f.GetID(id); inode != nil {
+		inode.mu.RLock()
+		size = inode.DriveItem.Size
+		inode.mu.RUnlock()
+	}
+	updated, err := f.UpdateMetadataEntry(id, func(entry *metadata.Entry) error {
+		entry.Name = delta.Name
+		if delta.Parent != nil && delta.Parent.ID != "" {
+			entry.ParentID = delta.Parent.ID
+		}
+		// The remote version has been seen (and saved if it differed), so it
+		// becomes the base the local edits are reconciled against.
+		if delta.ETag != "" {
+			entry.ETag = delta.ETag
+		}
+		if delta.CTag != "" {
+			entry.CTag = delta.CTag
+		}
+		if delta.WebURL != "" {
+			entry.WebURL = delta.WebURL
+		}
+		entry.Description = delta.Description
+		entry.Size = size
+		entry.PendingRemote = false
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if prior.ParentID != updated.ParentID {
+		f.moveChildBetweenParents(ctx, prior.ParentID, updated.ParentID, updated)
+	}
+	f.ensureInodeFromMetadataStore(id)
+	return nil
+}
+
+// createFrozenConflictCopy downloads the remote content of remoteID into a new
+// local-only file beside the frozen item. The copy is frozen as well.
+func (f *Filesystem) createFrozenConflictCopy(ctx context.Context, parentID, name, remoteID string, remote itemRemote) (*Inode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	parent := f.GetID(parentID)
+	if parent == nil {
+		return nil, errors.NewNotFoundError("parent of frozen item not found", nil)
+	}
+
+	var author string
+	if item, err := remote.GetItem(remoteID); err == nil {
+		author = item.ModifiedByName()
+	}
+	copyName := f.conflictCopyName(parentID, name, author, time.Now())
+	inode := NewInode(copyName, fuse.S_IFREG|0644, parent)
+	id := inode.ID()
+	fd, err := f.content.Open(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := remote.Download(remoteID, fd); err != nil {
+		_ = f.content.Delete(id)
+		return nil, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		_ = f.content.Delete(id)
+		return nil, err
+	}
+
+	inode.mu.Lock()
+	inode.DriveItem.Size = uint64(info.Size())
+	inode.hasChanges = true
+	inode.xattrs = map[string][]byte{xattrFrozen: []byte("1")}
+	inode.mu.Unlock()
+
+	f.InsertChild(parentID, inode)
+	f.linkConflictPair(remoteID, id)
+	f.markDirtyLocalState(id)
+	f.MarkFileConflict(id, "remote version of frozen file "+name)
+
+	logging.Info().
+		Str("id", remoteID).
+		Str("conflictCopy", copyName).
+		Msg("Saved remote version of frozen item as a conflict copy")
+	return inode, nil
+}
+
+func (f *Filesystem) unfreezeWith(ctx context.Context, id string, remote itemRemote) error {
+	inode := f.GetID(id)
+	if inode == nil {
+		return errors.NewNotFoundError("item not found", nil)
+	}
+	if err := f.setFrozen(inode, false); err != nil {
+		return err
+	}
+	if !inode.HasChanges() {
+		return nil
+	}
+
+	logger := logging.Info().Str("id", id).Str("path", inode.Path())
+	if f.IsOffline() {
+		// The journal replays the upload once connectivity returns.
+		logger.Msg("Unfroze item while offline; local edits queued for replay")
+		return f.TrackOfflineChange(&OfflineChange{
+			ID:        id,
+			Type:      "modify",
+			Timestamp: time.Now(),
+			Path:      inode.Path(),
+		})
+	}
+
+	if !isLocalID(id) {
+		entry, err := f.GetMetadataEntry(id)
+		if err != nil {
+			return err
+		}
+		current, err := remote.GetItem(id)
+		if err != nil && !isNotFoundError(err) {
+			return errors.Wrap(err, "failed to check remote version of unfrozen item")
+		}
+		if current != nil && remoteContentChanged(entry, current) {
+			if _, err := f.createFrozenConflictCopy(ctx, entry.ParentID, entry.Name, id, remote); err != nil {
+				return err
+			}
+			inode.mu.Lock()
+			inode.DriveItem.ETag = current.ETag
+			inode.DriveItem.CTag = current.CTag
+			inode.mu.Unlock()
+		}
+	}
+
+	if f.holdUpload(inode) {
+		logger.Msg("Unfroze item; upload of local edits deferred")
+		return nil
+	}
+	if f.uploads != nil {
+		if _, err := f.uploads.QueueUploadWithPriority(inode, PriorityLow); err != nil {
+			return errors.Wrap(err, "failed to queue upload for unfrozen item")
+		}
+	}
+	logger.Msg("Unfroze item; local edits queued for upload")
+	return nil
+}
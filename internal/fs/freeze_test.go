@@ -0,0 +1,158 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFrozenFile registers a hydrated remote file with local edits.
+func setupFrozenFile(t *testing.T) (*Filesystem, *Inode) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+
+	parent := NewInode("templates", fuse.S_IFDIR|0755, nil)
+	parent.DriveItem.ID = "parent"
+	registerHydratedEntry(t, fs, parent)
+
+	file := NewInode("app.conf", fuse.S_IFREG|0644, parent)
+	file.DriveItem.ID = "file"
+	file.DriveItem.ETag = "etag-1"
+	file.DriveItem.CTag = "ctag-1"
+	registerHydratedEntry(t, fs, file)
+	parent.children = append(parent.children, file.ID())
+
+	require.NoError(t, fs.content.Insert(file.ID(), []byte("local tweak")))
+	file.DriveItem.Size = uint64(len("local tweak"))
+	fs.markPendingUpload(file.ID())
+	return fs, file
+}
+
+func TestUT_FS_Freeze_FsyncKeepsEditsLocal(t *testing.T) {
+	fs, file := setupFrozenFile(t)
+	require.NoError(t, fs.Freeze(file.ID()))
+
+	status := fs.Fsync(nil, &fuse.FsyncIn{InHeader: fuse.InHeader{NodeId: file.NodeID()}})
+	require.Equal(t, fuse.OK, status)
+	require.Empty(t, fs.uploads.sessions, "frozen items must not queue uploads")
+
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateDirtyLocal, entry.State)
+	require.Contains(t, entry.Xattrs, xattrFrozen, "frozen flag should persist with the entry")
+}
+
+func TestUT_FS_Freeze_RemoteChangeCreatesConflictCopy(t *testing.T) {
+	fs, file := setupFrozenFile(t)
+	require.NoError(t, fs.Freeze(file.ID()))
+
+	prior, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.True(t, frozenHasLocalEdits(prior))
+
+	delta := &graph.DriveItem{
+		ID:     file.ID(),
+		Name:   "app.conf",
+		ETag:   "etag-2",
+		CTag:   "ctag-2",
+		Size:   99,
+		Parent: &graph.DriveItemParent{ID: "parent"},
+		File:   &graph.File{},
+	}
+	remote := &fakeRemote{content: "upstream template"}
+	require.NoError(t, fs.applyFrozenDeltaWith(context.Background(), prior, delta, remote))
+
+	local, err := fs.content.Open(file.ID())
+	require.NoError(t, err)
+	data, err := io.ReadAll(io.NewSectionReader(local, 0, 1<<20))
+	require.NoError(t, err)
+	require.Equal(t, "local tweak", string(data), "local edits must not be overwritten")
+
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, "ctag-2", entry.CTag, "remote version becomes the new base")
+	require.Equal(t, uint64(len("local tweak")), entry.Size)
+	require.Equal(t, metadata.ItemStateDirtyLocal, entry.State)
+
+	copied := childNamed(fs, "parent", "app (conflicted copy from ")
+	require.NotNil(t, copied, "remote version should be saved beside the frozen file")
+	require.True(t, fs.IsFrozen(copied.ID()), "conflict copy should not be uploaded either")
+	require.Equal(t, uint64(len("upstream template")), copied.Size())
+}
+
+func TestUT_FS_Freeze_UnfreezeOfflineQueuesReplay(t *testing.T) {
+	fs, file := setupFrozenFile(t)
+	require.NoError(t, fs.Freeze(file.ID()))
+	fs.SetOfflineMode(OfflineModeReadWrite)
+
+	require.NoError(t, fs.unfreezeWith(context.Background(), file.ID(), &fakeRemote{}))
+	require.False(t, fs.IsFrozen(file.ID()))
+
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.NotContains(t, entry.Xattrs, xattrFrozen)
+
+	changes, err := fs.getOfflineChanges(context.Background())
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, "modify", changes[0].Type)
+	require.Equal(t, file.ID(), changes[0].ID)
+}
+
+func TestUT_FS_Freeze_UnfreezeSavesDivergedRemote(t *testing.T) {
+	fs, file := setupFrozenFile(t)
+	require.NoError(t, fs.Freeze(file.ID()))
+	fs.uploads = nil // upload queueing is covered elsewhere
+
+	remote := &fakeRemote{
+		item:    &graph.DriveItem{ID: file.ID(), ETag: "etag-3", CTag: "ctag-3"},
+		content: "changed while frozen",
+	}
+	require.NoError(t, fs.unfreezeWith(context.Background(), file.ID(), remote))
+	require.NotNil(t, childNamed(fs, "parent", "app (conflicted copy from "))
+
+	file.mu.RLock()
+	defer file.mu.RUnlock()
+	require.Equal(t, "ctag-3", file.DriveItem.CTag)
+}
+
+func TestUT_FS_Freeze_UnfreezeOnMeteredConnectionDefersUpload(t *testing.T) {
+	fs, file := setupFrozenFile(t)
+	require.NoError(t, fs.Freeze(file.ID()))
+	fs.SetMeteredUploadThreshold(1)
+	fs.pollMetered(func() (bool, error) { return true, nil })
+
+	remote := &fakeRemote{item: &graph.DriveItem{ID: file.ID(), ETag: "etag-1", CTag: "ctag-1"}}
+	require.NoError(t, fs.unfreezeWith(context.Background(), file.ID(), remote))
+	require.Equal(t, DeferredMetered, fs.UploadDeferral(file.ID()))
+	_, queued := fs.uploads.GetSession(file.ID())
+	require.False(t, queued, "the upload waits for an unmetered connection")
+}
+
+func TestUT_FS_Freeze_XAttrInterface(t *testing.T) {
+	fs, file := setupFrozenFile(t)
+	parent := fs.GetID("parent")
+
+	set := func(nodeID uint64, value string) fuse.Status {
+		return fs.SetXAttr(nil, &fuse.SetXAttrIn{InHeader: fuse.InHeader{NodeId: nodeID}}, xattrFrozen, []byte(value))
+	}
+	require.Equal(t, fuse.EINVAL, set(file.NodeID(), "maybe"))
+	require.Equal(t, fuse.Status(syscall.EISDIR), set(parent.NodeID(), "1"))
+	require.Equal(t, fuse.OK, set(file.NodeID(), "1"))
+	require.True(t, fs.IsFrozen(file.ID()))
+
+	buf := make([]byte, 8)
+	n, status := fs.GetXAttr(nil, &fuse.InHeader{NodeId: file.NodeID()}, xattrFrozen, buf)
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, "1", string(buf[:n]))
+
+	fs.SetOfflineMode(OfflineModeReadWrite)
+	require.Equal(t, fuse.OK, fs.RemoveXAttr(nil, &fuse.InHeader{NodeId: file.NodeID()}, xattrFrozen))
+	require.False(t, fs.IsFrozen(file.ID()))
+}
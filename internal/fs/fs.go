@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/auriora/onemount/internal/errors"
 	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/logging"
 )
@@ -67,7 +68,7 @@ func (f *Filesystem) remoteID(i *Inode) (string, error) {
 		if err != nil {
 			i.mu.Unlock()
 
-			if strings.Contains(err.Error(), "nameAlreadyExists") {
+			if errors.Code(err) == "nameAlreadyExists" {
 				// A file with this name already exists on the server, get its ID and
 				// use that. This is probably the same file, but just got uploaded
 				// earlier.
@@ -180,7 +180,7 @@ func TestUT_FS_FUSEMetadata_GetChildMissingDoesNotHitGraph(t *testing.T) {
 func TestUT_FS_FUSEMetadata_OpenDirUsesMetadataOffline(t *testing.T) {
 	now := time.Now().UTC()
 	fs := newTestFilesystemWithMetadata(t)
-	fs.opendirs = make(map[uint64][]*Inode)
+	fs.opendirs = make(map[uint64]*dirStream)
 	fs.auth = &graph.Auth{}
 
 	parent := &metadata.Entry{
@@ -220,15 +220,18 @@ func TestUT_FS_FUSEMetadata_OpenDirUsesMetadataOffline(t *testing.T) {
 	graph.SetOperationalOffline(true)
 	t.Cleanup(func() { graph.SetOperationalOffline(false) })
 
-	status := fs.OpenDir(nil, &fuse.OpenIn{InHeader: fuse.InHeader{NodeId: directory.NodeID()}}, &fuse.OpenOut{})
+	out := &fuse.OpenOut{}
+	status := fs.OpenDir(nil, &fuse.OpenIn{InHeader: fuse.InHeader{NodeId: directory.NodeID()}}, out)
 	require.Equal(t, fuse.OK, status)
 
 	fs.opendirsM.RLock()
-	entries := fs.opendirs[directory.NodeID()]
+	stream := fs.opendirs[out.Fh]
 	fs.opendirsM.RUnlock()
-	require.NotNil(t, entries)
-	require.True(t, len(entries) >= 3)
-	require.Equal(t, childInode.NodeID(), entries[2].NodeID())
+	require.NotNil(t, stream)
+	entry, err := stream.entry(fs, 2)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	require.Equal(t, childInode.NodeID(), entry.NodeID())
 }
 
 // Lookup should be satisfied from metadata without triggering Graph when offline.
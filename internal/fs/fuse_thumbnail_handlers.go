@@ -192,13 +192,20 @@ var nextHandleID uint64 = 1
 // handleIDLock protects nextHandleID
 var handleIDLock sync.Mutex
 
-// RegisterFileHandle registers a file handle and returns a handle ID
-func (f *Filesystem) RegisterFileHandle(fh *ThumbnailFileHandle) uint64 {
-	// Get a unique handle ID
+// nextFileHandleID returns a handle ID unique across thumbnail and regular
+// file opens
+func nextFileHandleID() uint64 {
 	handleIDLock.Lock()
+	defer handleIDLock.Unlock()
 	handleID := nextHandleID
 	nextHandleID++
-	handleIDLock.Unlock()
+	return handleID
+}
+
+// RegisterFileHandle registers a file handle and returns a handle ID
+func (f *Filesystem) RegisterFileHandle(fh *ThumbnailFileHandle) uint64 {
+	// Get a unique handle ID
+	handleID := nextFileHandleID()
 
 	// Store the file handle
 	fileHandles.Store(handleID, fh)
@@ -0,0 +1,100 @@
+package fs
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/auriora/onemount/internal/logging"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Every inode reports a generation with its node ID, so an (ino, generation)
+// pair names one item for good. OneDrive reuses an item ID when a deleted
+// item is restored, so every item ID carries a generation counting how often
+// it was deleted; an Inode takes the generation of its ID when it gets a node
+// ID and keeps it for its lifetime. A handle to the deleted item then no
+// longer matches the restored one. Counters live in the generations bucket so
+// they survive remounts. Local IDs are random and never reused, so they stay
+// at generation 0.
+//
+// Export support is not implemented. go-fuse masks CAP_EXPORT_SUPPORT out of
+// its INIT reply and offers no option to keep it, so the kernel never asks the
+// mount to decode a file handle and resolves only handles of inodes it still
+// has cached. An NFS re-export works until the server drops an item from its
+// inode cache or remounts, and then hands out "Stale file handle".
+
+var bucketGenerations = []byte("generations")
+
+// itemGenerations caches the generation counters. The zero value is ready to
+// use.
+type itemGenerations struct {
+	mu     sync.Mutex
+	loaded bool
+	counts map[string]uint64
+}
+
+// loadGenerationsLocked reads the counters from the database on first use.
+// Callers hold f.generations.mu.
+func (f *Filesystem) loadGenerationsLocked() {
+	g := &f.generations
+	if g.loaded {
+		return
+	}
+	g.loaded = true
+	g.counts = make(map[string]uint64)
+	if f.db == nil {
+		return
+	}
+	_ = f.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketGenerations)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if len(v) == 8 {
+				g.counts[string(k)] = binary.BigEndian.Uint64(v)
+			}
+			return nil
+		})
+	})
+}
+
+// itemGeneration returns the generation new inodes for the item ID get.
+func (f *Filesystem) itemGeneration(id string) uint64 {
+	if isLocalID(id) {
+		return 0
+	}
+	f.generations.mu.Lock()
+	defer f.generations.mu.Unlock()
+	f.loadGenerationsLocked()
+	return f.generations.counts[id]
+}
+
+// bumpGeneration records that the item was deleted, so an item reusing its ID
+// gets the next generation.
+func (f *Filesystem) bumpGeneration(id string) {
+	if isLocalID(id) {
+		return
+	}
+	f.generations.mu.Lock()
+	f.loadGenerationsLocked()
+	f.generations.counts[id]++
+	generation := f.generations.counts[id]
+	f.generations.mu.Unlock()
+
+	if f.db == nil {
+		return
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, generation)
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketGenerations)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), value)
+	})
+	if err != nil {
+		logging.Warn().Err(err).Str("id", id).Msg("Failed to persist inode generation")
+	}
+}
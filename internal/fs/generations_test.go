@@ -0,0 +1,54 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_Generations_DeleteRecreateCycles(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	parent := NewInode("parent", fuse.S_IFDIR|0755, nil)
+	parent.DriveItem.ID = "parent"
+	registerHydratedEntry(t, fs, parent)
+
+	lookup := func() fuse.EntryOut {
+		t.Helper()
+		var out fuse.EntryOut
+		require.Equal(t, fuse.OK, fs.Lookup(nil, &fuse.InHeader{NodeId: parent.NodeID()}, "report.txt", &out))
+		return out
+	}
+	create := func() *Inode {
+		doc := NewInodeDriveItem(&graph.DriveItem{ID: "doc", Name: "report.txt", Parent: &graph.DriveItemParent{ID: "parent"}, File: &graph.File{}})
+		fs.InsertChild(parent.ID(), doc)
+		return doc
+	}
+
+	deleteID := func(id string) {
+		fs.DeleteID(id)
+		<-fs.uploads.deletionQueue // no upload manager loop drains it
+	}
+
+	seen := map[[2]uint64]bool{}
+	for cycle := uint64(0); cycle < 3; cycle++ {
+		doc := create()
+		out := lookup()
+		require.Equal(t, doc.NodeID(), out.NodeId)
+		require.Equal(t, cycle, out.Generation, "generation after %d deletions", cycle)
+		key := [2]uint64{out.NodeId, out.Generation}
+		require.False(t, seen[key], "(node ID, generation) pairs are never reused")
+		seen[key] = true
+		deleteID("doc")
+	}
+
+	fs.generations = itemGenerations{}
+	require.Equal(t, uint64(3), fs.itemGeneration("doc"), "generations survive remounts")
+
+	local := NewInode("draft.txt", fuse.S_IFREG|0644, parent)
+	fs.InsertChild(parent.ID(), local)
+	require.Zero(t, local.Generation())
+	deleteID(local.ID())
+	require.Zero(t, fs.itemGeneration(local.ID()), "local IDs are never reused")
+}
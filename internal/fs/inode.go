@@ -146,6 +146,34 @@ func (i *Inode) NodeID() uint64 {
 	return i.nodeID
 }
 
+// Ino returns the inode number reported to applications. It is the node ID
+// unless strict POSIX mode assigned a stable number.
+func (i *Inode) Ino() uint64 {
+	if i == nil {
+		return 0
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.inoLocked()
+}
+
+func (i *Inode) inoLocked() uint64 {
+	if i.ino != 0 {
+		return i.ino
+	}
+	return i.nodeID
+}
+
+// Generation returns the generation reported to the kernel with the node ID.
+func (i *Inode) Generation() uint64 {
+	if i == nil {
+		return 0
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.generation
+}
+
 // SetNodeID sets the inode ID for an inode if not already set. Does nothing if
 // the Inode already has an ID.
 func (i *Inode) SetNodeID(id uint64) uint64 {
@@ -238,7 +266,7 @@ func (i *Inode) makeAttr() fuse.Attr {
 	size := i.Size()
 	mtime := i.ModTime()
 	return fuse.Attr{
-		Ino:     i.NodeID(),
+		Ino:     i.Ino(),
 		Size:    size,
 		Blocks:  blocksForSize(size),
 		Nlink:   i.NLink(),
@@ -264,6 +292,17 @@ func (i *Inode) IsDir() bool {
 	return i.Mode()&fuse.S_IFDIR > 0
 }
 
+// IsPackage returns if the inode is a OneDrive package such as a OneNote
+// notebook. Packages are presented as opaque read-only directories.
+func (i *Inode) IsPackage() bool {
+	if i == nil {
+		return false
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.DriveItem.IsPackage()
+}
+
 // Mode returns the permissions/mode of the file.
 func (i *Inode) Mode() uint32 {
 	if i == nil {
@@ -272,6 +311,9 @@ func (i *Inode) Mode() uint32 {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 	if i.mode == 0 { // only 0 if fetched from Graph API
+		if i.DriveItem.IsPackage() {
+			return packageMode
+		}
 		if i.DriveItem.IsDir() {
 			return fuse.S_IFDIR | 0755
 		}
@@ -409,7 +451,7 @@ func (i *Inode) MakeAttr() fuse.Attr {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 	attr := fuse.Attr{
-		Ino:     i.nodeID,
+		Ino:     i.inoLocked(),
 		Mode:    i.mode,
 		Size:    i.DriveItem.Size,
 		Blocks:  blocksForSize(i.DriveItem.Size),
@@ -28,6 +28,8 @@ type Inode struct {
 	mu              *sync.RWMutex     // Protects access to all fields
 	graph.DriveItem                   // The underlying OneDrive item
 	nodeID          uint64            // Filesystem node ID used by the kernel
+	ino             uint64            // Inode number reported in attributes, nodeID when zero
+	generation      uint64            // Generation reported with nodeID, see generations.go
 	children        []string          // Slice of child item IDs, nil when uninitialized
 	hasChanges      bool              // Flag to trigger an upload on flush
 	subdir          uint32            // Number of subdirectories, used by NLink()
@@ -35,6 +37,7 @@ type Inode struct {
 	xattrs          map[string][]byte // Extended attributes
 	virtual         bool              // Whether this inode represents a virtual (local-only) file
 	virtualContent  []byte            // Content for virtual files served directly from memory
+	writeHash       *writeHasher      // Running hash of sequentially written content, nil when unknown
 }
 
 // SerializeableInode is like a Inode, but can be serialized for local storage
@@ -0,0 +1,36 @@
+package fs
+
+import (
+	"context"
+	"io"
+
+	"github.com/auriora/onemount/internal/graph"
+)
+
+// itemRemote is the subset of the Graph API used to fetch the current version
+// of a single item and its content, e.g. to reconcile frozen items, resolve
+// conflicts or audit uploads. Tests substitute a fake.
+type itemRemote interface {
+	GetItem(id string) (*graph.DriveItem, error)
+	Download(id string, w io.Writer) error
+	DownloadURL(ctx context.Context, id string) (string, error)
+}
+
+// graphItemRemote forwards item calls to the Graph API.
+type graphItemRemote struct {
+	ctx  context.Context
+	auth *graph.Auth
+}
+
+func (c graphItemRemote) GetItem(id string) (*graph.DriveItem, error) {
+	return graph.GetItemWithContext(c.ctx, id, c.auth)
+}
+
+func (c graphItemRemote) Download(id string, w io.Writer) error {
+	_, err := graph.GetItemContentStreamWithContext(c.ctx, id, c.auth, w)
+	return err
+}
+
+func (c graphItemRemote) DownloadURL(ctx context.Context, id string) (string, error) {
+	return graph.GetDownloadURL(ctx, id, c.auth)
+}
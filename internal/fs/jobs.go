@@ -0,0 +1,314 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Long-running operations of a mount (tree sync, bulk hydration, cache
+// cleanup, cache verification, ...) register as jobs so UIs and the CLI can
+// track and cancel them the same way. A job counts items and bytes done out
+// of a total that may grow while it runs, and ends completed, cancelled or
+// failed. Finished jobs are announced with the JobFinished D-Bus signal and in
+// the event log; the last jobsRetained of them stay queryable. There is no
+// compaction job: bbolt compacts into a new database file, which a mount
+// cannot swap in while its stores hold the open database.
+const jobsRetained = 32
+
+// Job kinds.
+const (
+	JobTreeSync    = "tree-sync"
+	JobHydration   = "hydration"
+	JobEviction    = "eviction"
+	JobCacheVerify = "cache-verify"
+	JobMove        = "move"
+	JobReplay      = "replay"
+)
+
+// Job states.
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobCancelled = "cancelled"
+	JobFailed    = "failed"
+)
+
+// JobInfo is a snapshot of a job.
+type JobInfo struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Path       string    `json:"path,omitempty"`
+	State      string    `json:"state"`
+	Phase      string    `json:"phase,omitempty"`
+	Done       uint64    `json:"done"`
+	Failed     uint64    `json:"failed,omitempty"`
+	Total      uint64    `json:"total"`
+	BytesDone  uint64    `json:"bytes_done,omitempty"`
+	BytesTotal uint64    `json:"bytes_total,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished,omitempty"`
+}
+
+// IsFinished reports whether the job has stopped.
+func (i JobInfo) IsFinished() bool {
+	return i.State != JobRunning
+}
+
+// Job is a running or finished long operation. Operations report their
+// progress through it.
+type Job struct {
+	mu     sync.Mutex
+	key    string
+	info   JobInfo
+	cancel context.CancelFunc
+}
+
+// ID returns the job's ID.
+func (j *Job) ID() string {
+	return j.info.ID
+}
+
+// Info returns a snapshot of the job.
+func (j *Job) Info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.info
+}
+
+// SetPhase describes what the job is currently doing, e.g. "scanning".
+func (j *Job) SetPhase(phase string) {
+	j.mu.Lock()
+	j.info.Phase = phase
+	j.mu.Unlock()
+}
+
+// AddTotal grows the amount of work the job has to do.
+func (j *Job) AddTotal(items, bytes uint64) {
+	j.mu.Lock()
+	j.info.Total += items
+	j.info.BytesTotal += bytes
+	j.mu.Unlock()
+}
+
+// Advance records completed work.
+func (j *Job) Advance(items, bytes uint64) {
+	j.mu.Lock()
+	j.info.Done += items
+	j.info.BytesDone += bytes
+	j.mu.Unlock()
+}
+
+// AddFailed records items that could not be processed. A job with failed
+// items ends failed.
+func (j *Job) AddFailed(items uint64) {
+	j.mu.Lock()
+	j.info.Failed += items
+	j.mu.Unlock()
+}
+
+// jobFunc runs the operation of a job until done or ctx is cancelled.
+type jobFunc func(ctx context.Context, job *Job) error
+
+// jobManager is the registry of jobs of a filesystem. The zero value is
+// ready to use.
+type jobManager struct {
+	mu    sync.Mutex
+	next  int
+	jobs  map[string]*Job
+	order []string
+}
+
+// register creates a running job. With a non-empty key, a running job with
+// the same key is returned instead and created is false.
+func (m *jobManager) register(ctx context.Context, kind, path, key string) (job *Job, jobCtx context.Context, created bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key != "" {
+		for _, existing := range m.jobs {
+			if existing.key == key && !existing.Info().IsFinished() {
+				return existing, nil, false
+			}
+		}
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	m.next++
+	job = &Job{
+		key:    key,
+		cancel: cancel,
+		info: JobInfo{
+			ID:      fmt.Sprintf("%s-%d", kind, m.next),
+			Kind:    kind,
+			Path:    path,
+			State:   JobRunning,
+			Started: time.Now().UTC(),
+		},
+	}
+	if m.jobs == nil {
+		m.jobs = make(map[string]*Job)
+	}
+	m.jobs[job.ID()] = job
+	m.order = append(m.order, job.ID())
+	m.pruneLocked()
+	return job, jobCtx, true
+}
+
+// pruneLocked forgets the oldest finished jobs beyond jobsRetained. Callers
+// hold m.mu.
+func (m *jobManager) pruneLocked() {
+	excess := len(m.order) - jobsRetained
+	kept := m.order[:0]
+	for _, id := range m.order {
+		if excess > 0 && m.jobs[id].Info().IsFinished() {
+			delete(m.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
+
+// cancelKey stops the running job with the given key, if there is one.
+func (m *jobManager) cancelKey(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		if job.key == key && !job.Info().IsFinished() {
+			job.cancel()
+		}
+	}
+}
+
+func (m *jobManager) get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+func (m *jobManager) list() []JobInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	infos := make([]JobInfo, 0, len(m.order))
+	for _, id := range m.order {
+		infos = append(infos, m.jobs[id].Info())
+	}
+	return infos
+}
+
+// repath moves the paths of the running jobs at or below oldPath to newPath.
+func (m *jobManager) repath(oldPath, newPath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		job.mu.Lock()
+		if job.info.State == JobRunning {
+			job.info.Path, _ = rebasePath(job.info.Path, oldPath, newPath)
+		}
+		job.mu.Unlock()
+	}
+}
+
+// jobContext returns the context jobs derive from, so they stop on unmount.
+func (f *Filesystem) jobContext() context.Context {
+	return f.mountContext()
+}
+
+// runJob runs the operation as a job in the calling goroutine and returns its
+// error. ctx cancels the job in addition to CancelJob.
+func (f *Filesystem) runJob(ctx context.Context, kind, path string, run jobFunc) error {
+	job, jobCtx, _ := f.jobs.register(ctx, kind, path, "")
+	return f.executeJob(jobCtx, job, run)
+}
+
+// startJob runs the operation as a job in the background and returns it.
+// With a non-empty key, a job with the same key that is still running is
+// returned instead of starting another one.
+func (f *Filesystem) startJob(kind, path, key string, run jobFunc) *Job {
+	job, jobCtx, created := f.jobs.register(f.jobContext(), kind, path, key)
+	if !created {
+		return job
+	}
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+		_ = f.executeJob(jobCtx, job, run)
+	}()
+	return job
+}
+
+// executeJob runs the job's operation and records its outcome.
+func (f *Filesystem) executeJob(ctx context.Context, job *Job, run jobFunc) error {
+	defer job.cancel()
+	logging.Info().Str("job", job.ID()).Str("path", job.info.Path).Msg("Job started")
+
+	err := run(ctx, job)
+
+	job.mu.Lock()
+	switch {
+	case ctx.Err() != nil:
+		job.info.State = JobCancelled
+	case err != nil:
+		job.info.State = JobFailed
+		job.info.Error = err.Error()
+	case job.info.Failed > 0:
+		job.info.State = JobFailed
+		job.info.Error = fmt.Sprintf("%d of %d items failed", job.info.Failed, job.info.Total)
+	default:
+		job.info.State = JobCompleted
+	}
+	job.info.Phase = ""
+	job.info.Finished = time.Now().UTC()
+	info := job.info
+	job.mu.Unlock()
+
+	logging.Info().
+		Str("job", info.ID).
+		Str("state", info.State).
+		Uint64("done", info.Done).
+		Uint64("total", info.Total).
+		Str("error", info.Error).
+		Dur("duration", info.Finished.Sub(info.Started)).
+		Msg("Job finished")
+	message := info.ID + " " + info.State
+	if info.Error != "" {
+		message += ": " + info.Error
+	}
+	f.emitActivity(ActivityJob, "", message)
+	if f.dbusServer != nil {
+		f.dbusServer.SendJobFinished(info)
+	}
+	return err
+}
+
+// Jobs returns the running and recently finished jobs, oldest first.
+func (f *Filesystem) Jobs() []JobInfo {
+	return f.jobs.list()
+}
+
+// Job returns the job with the given ID.
+func (f *Filesystem) Job(id string) (JobInfo, bool) {
+	job, ok := f.jobs.get(id)
+	if !ok {
+		return JobInfo{}, false
+	}
+	return job.Info(), true
+}
+
+// CancelJob stops the job with the given ID. Cancelling a finished job is a
+// no-op.
+func (f *Filesystem) CancelJob(id string) error {
+	job, ok := f.jobs.get(id)
+	if !ok {
+		return errors.NewNotFoundError("job not found", nil)
+	}
+	job.cancel()
+	return nil
+}
@@ -0,0 +1,61 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_Jobs_TrackOutcomeAndCancel(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+
+	err := fs.runJob(context.Background(), JobEviction, "", func(ctx context.Context, job *Job) error {
+		job.AddTotal(4, 4096)
+		job.Advance(3, 3072)
+		job.AddFailed(1)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Error(t, fs.runJob(context.Background(), JobTreeSync, "", func(ctx context.Context, job *Job) error {
+		return errors.New("database is locked")
+	}))
+
+	started := make(chan struct{})
+	running := fs.startJob(JobEviction, "/", "evict", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+	require.Same(t, running, fs.startJob(JobEviction, "/", "evict", nil), "running jobs are reused by key")
+	require.NoError(t, fs.CancelJob(running.ID()))
+	require.Equal(t, JobCancelled, waitForJob(t, fs, running.ID()).State)
+	require.Error(t, fs.CancelJob("unknown-1"))
+
+	jobs := fs.Jobs()
+	require.Len(t, jobs, 3)
+	require.Equal(t, JobFailed, jobs[0].State)
+	require.Equal(t, "1 of 4 items failed", jobs[0].Error)
+	require.Equal(t, uint64(3072), jobs[0].BytesDone)
+	require.Equal(t, JobFailed, jobs[1].State)
+	require.Equal(t, "database is locked", jobs[1].Error)
+	require.Equal(t, JobCancelled, jobs[2].State)
+	require.False(t, jobs[2].Finished.IsZero())
+
+	var finished []string
+	for _, event := range fs.RecentEvents(0) {
+		if event.Type == ActivityJob {
+			finished = append(finished, event.Message)
+		}
+	}
+	require.Len(t, finished, 3)
+	require.True(t, strings.HasSuffix(finished[1], "failed: database is locked"), finished[1])
+
+	for i := 0; i < jobsRetained; i++ {
+		require.NoError(t, fs.runJob(context.Background(), JobEviction, "", func(ctx context.Context, job *Job) error { return nil }))
+	}
+	require.Len(t, fs.Jobs(), jobsRetained, "only the most recent finished jobs are kept")
+}
@@ -0,0 +1,241 @@
+package fs
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Reads of hydrated files answer with the descriptor of the cached file,
+// which go-fuse splices into the reply when the kernel allows it and
+// otherwise reads into a buffer before writing the reply. With the
+// mappedReads feature flag, large files without local changes are served
+// from a read-only shared mapping of the cached file instead: the reply is
+// written straight from the page cache, without reading the range into a
+// buffer first. A mapping is kept per file and replaced when the size of the
+// file changes. Before the content cache rewrites, truncates, moves or
+// removes a file it suspends mapping it: the mapping is dropped, new reads
+// take the descriptor route, and the change waits for the replies still
+// being written from the mapping, so the file never shrinks under one.
+// Content shared with other mounts is replaced rather than modified (see
+// Unshare), so other processes do not truncate a mapped file either. Files
+// are not mapped on 32-bit platforms or from a cache on a network
+// filesystem, where another client can truncate a mapped file, and a cache
+// filesystem that cannot map files turns mapping off.
+
+// mappedReadMinSize is the size from which files are served from a mapping;
+// smaller files are read in a request or two either way.
+const mappedReadMinSize = 1 << 20
+
+// maxContentMappings bounds the mappings kept; the least recently read is
+// dropped to map another file.
+const maxContentMappings = 64
+
+// mappedReplyWait bounds how long a change to a cached file waits for the
+// replies written from its mapping.
+const mappedReplyWait = 10 * time.Second
+
+// contentMappings holds the mappings of a content cache. The zero value maps
+// files unless disabled is set.
+type contentMappings struct {
+	mu        sync.Mutex
+	disabled  bool // the cache filesystem cannot map files safely
+	maps      map[string]*contentMapping
+	suspended map[string]int // files being changed, by number of changes
+	tick      uint64
+}
+
+// contentMapping is a read-only mapping of a whole cached file.
+type contentMapping struct {
+	data    []byte
+	refs    int           // replies not written yet
+	used    uint64        // tick of the last read
+	dropped bool          // unmapped once refs drops to 0
+	idle    chan struct{} // closed once dropped and refs drops to 0
+}
+
+// mappingUnsafe returns why files in the cache directory dir should not be
+// mapped, or "" when they can be.
+func mappingUnsafe(dir string) string {
+	if strconv.IntSize < 64 {
+		return "32-bit address space"
+	}
+	if fsType := networkFilesystemType(dir); fsType != "" {
+		return "cache on " + fsType
+	}
+	return ""
+}
+
+// ReadMapped returns a read of size bytes at off of the cached file id,
+// open as fd and fileSize bytes long, served from a mapping of the file. It
+// returns nil when the file cannot be mapped or is being rewritten, and the
+// read is to be served from fd.
+func (l *LoopbackCache) ReadMapped(id string, fd *os.File, off int64, size int, fileSize int64) fuse.ReadResult {
+	m := &l.mappings
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.disabled || m.suspended[id] > 0 || size <= 0 || off < 0 || off >= fileSize {
+		return nil
+	}
+
+	mapping := m.maps[id]
+	if mapping == nil || int64(len(mapping.data)) != fileSize {
+		if info, err := fd.Stat(); err != nil || info.Size() != fileSize {
+			return nil
+		}
+		data, err := syscall.Mmap(int(fd.Fd()), 0, int(fileSize), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			if err == syscall.ENODEV {
+				m.disabled = true
+				logging.Warn().Str("directory", l.directory).
+					Msg("The cache filesystem cannot map files, serving reads from file descriptors")
+			} else {
+				logging.Debug().Err(err).Str("id", id).Msg("Failed to map cached content")
+			}
+			return nil
+		}
+		m.dropLocked(id)
+		if len(m.maps) >= maxContentMappings {
+			m.dropLeastRecentlyUsedLocked()
+		}
+		if m.maps == nil {
+			m.maps = make(map[string]*contentMapping)
+		}
+		mapping = &contentMapping{data: data, idle: make(chan struct{})}
+		m.maps[id] = mapping
+	}
+
+	m.tick++
+	mapping.used = m.tick
+	mapping.refs++
+	end := min(off+int64(size), fileSize)
+	return &mappedReadResult{mappings: m, mapping: mapping, data: mapping.data[off:end]}
+}
+
+// unmap drops the mapping of id, if any, and waits for the replies still
+// being written from it.
+func (l *LoopbackCache) unmap(id string) {
+	l.mappings.mu.Lock()
+	mapping := l.mappings.dropLocked(id)
+	l.mappings.mu.Unlock()
+	l.mappings.wait(id, mapping)
+}
+
+// suspendMapping drops the mapping of id and keeps id from being mapped
+// until the returned function is called, once the file is changed.
+func (l *LoopbackCache) suspendMapping(id string) (resume func()) {
+	m := &l.mappings
+	m.mu.Lock()
+	if m.suspended == nil {
+		m.suspended = make(map[string]int)
+	}
+	m.suspended[id]++
+	mapping := m.dropLocked(id)
+	m.mu.Unlock()
+	m.wait(id, mapping)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			if m.suspended[id]--; m.suspended[id] <= 0 {
+				delete(m.suspended, id)
+			}
+			m.mu.Unlock()
+		})
+	}
+}
+
+// wait waits for the replies written from the dropped mapping of id.
+func (m *contentMappings) wait(id string, mapping *contentMapping) {
+	if mapping == nil {
+		return
+	}
+	select {
+	case <-mapping.idle:
+	case <-time.After(mappedReplyWait):
+		logging.Warn().Str("id", id).
+			Msg("Changing cached content while a reply is still written from its mapping")
+	}
+}
+
+// dropLocked drops the mapping of id, returning it, or nil when id is not
+// mapped.
+func (m *contentMappings) dropLocked(id string) *contentMapping {
+	mapping, ok := m.maps[id]
+	if !ok {
+		return nil
+	}
+	delete(m.maps, id)
+	mapping.dropped = true
+	if mapping.refs == 0 {
+		m.munmap(mapping)
+	}
+	return mapping
+}
+
+func (m *contentMappings) dropLeastRecentlyUsedLocked() {
+	oldest := ""
+	var used uint64
+	for id, mapping := range m.maps {
+		if oldest == "" || mapping.used < used {
+			oldest, used = id, mapping.used
+		}
+	}
+	m.dropLocked(oldest)
+}
+
+// release ends a reply written from mapping.
+func (m *contentMappings) release(mapping *contentMapping) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mapping.refs--
+	if mapping.dropped && mapping.refs == 0 {
+		m.munmap(mapping)
+	}
+}
+
+func (m *contentMappings) munmap(mapping *contentMapping) {
+	if err := syscall.Munmap(mapping.data); err != nil {
+		logging.Warn().Err(err).Msg("Failed to unmap cached content")
+	}
+	mapping.data = nil
+	close(mapping.idle)
+}
+
+// mappedReadResult is a fuse.ReadResult written from a mapping, which stays
+// mapped until go-fuse calls Done.
+type mappedReadResult struct {
+	mappings *contentMappings
+	mapping  *contentMapping
+	data     []byte
+	once     sync.Once
+}
+
+func (r *mappedReadResult) Size() int {
+	return len(r.data)
+}
+
+func (r *mappedReadResult) Bytes([]byte) ([]byte, fuse.Status) {
+	return r.data, fuse.OK
+}
+
+func (r *mappedReadResult) Done() {
+	r.once.Do(func() { r.mappings.release(r.mapping) })
+}
+
+// readMapped serves a read of the hydrated file inode, cached as id, from a
+// mapping when the mappedReads feature flag is on, or returns nil. The
+// caller holds inode.mu for reading.
+func (f *Filesystem) readMapped(inode *Inode, id string, fd *os.File, in *fuse.ReadIn) fuse.ReadResult {
+	size := int64(inode.DriveItem.Size)
+	if size < mappedReadMinSize || inode.hasChanges || !f.FeatureEnabled(FeatureMappedReads) {
+		return nil
+	}
+	return f.content.ReadMapped(id, fd, int64(in.Offset), int(in.Size), size)
+}
@@ -0,0 +1,132 @@
+package fs
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_MappedReads_ServeLargeCachedFiles(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	file := NewInode("video.mp4", fuse.S_IFREG|0644, nil)
+	file.DriveItem.ID = "video"
+	payload := bytes.Repeat([]byte("0123456789abcdef"), (mappedReadMinSize+1000)/16)
+	file.DriveItem.Size = uint64(len(payload))
+	registerHydratedEntry(t, fs, file)
+	require.NoError(t, fs.content.Insert(file.ID(), payload))
+
+	read := func(off, size int) fuse.ReadResult {
+		t.Helper()
+		result, status := fs.Read(nil, &fuse.ReadIn{
+			InHeader: fuse.InHeader{NodeId: file.NodeID()},
+			Offset:   uint64(off),
+			Size:     uint32(size),
+		}, make([]byte, size))
+		require.Equal(t, fuse.OK, status)
+		return result
+	}
+
+	result := read(0, 4096)
+	require.NotNil(t, result)
+	_, mapped := result.(*mappedReadResult)
+	require.False(t, mapped, "mapping is behind the mappedReads flag")
+	result.Done()
+
+	fs.SetFeatures(map[string]bool{"mappedReads": true})
+	result = read(len(payload)-100, 4096)
+	require.IsType(t, &mappedReadResult{}, result)
+	data, status := result.Bytes(nil)
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, payload[len(payload)-100:], data, "reads past the end are short")
+
+	// Rewriting the file drops the mapping and waits for the reply written
+	// from it; reads in the meantime are served from the descriptor.
+	mapping := result.(*mappedReadResult).mapping
+	rewritten := make(chan error)
+	go func() { rewritten <- fs.content.Insert(file.ID(), payload[:100]) }()
+	require.Eventually(t, func() bool {
+		fs.content.mappings.mu.Lock()
+		defer fs.content.mappings.mu.Unlock()
+		return fs.content.mappings.suspended[file.ID()] > 0
+	}, time.Second, time.Millisecond)
+	select {
+	case <-rewritten:
+		t.Fatal("the file was rewritten under a reply")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Empty(t, fs.content.mappings.maps)
+	require.NotNil(t, mapping.data, "a reply is still written from the mapping")
+	during := read(0, 4096)
+	require.IsType(t, fuse.ReadResultFd(0, 0, 0), during, "files being changed are not mapped")
+	during.Done()
+	result.Done()
+	result.Done()
+	require.NoError(t, <-rewritten)
+	require.Nil(t, mapping.data)
+	require.Zero(t, mapping.refs)
+	require.Empty(t, fs.content.mappings.suspended, "mapping resumes once the file is changed")
+	require.NoError(t, fs.content.Insert(file.ID(), payload))
+
+	file.SetHasChanges(true)
+	result = read(0, 4096)
+	require.IsType(t, fuse.ReadResultFd(0, 0, 0), result, "files with local changes are read from the descriptor")
+	result.Done()
+}
+
+func TestUT_FS_MappedReads_NotOnNetworkFilesystems(t *testing.T) {
+	original := networkFilesystemType
+	t.Cleanup(func() { networkFilesystemType = original })
+	networkFilesystemType = func(string) string { return "nfs" }
+	require.Equal(t, "cache on nfs", mappingUnsafe(t.TempDir()))
+
+	cache := NewLoopbackCache(filepath.Join(t.TempDir(), "content"))
+	payload := make([]byte, mappedReadMinSize)
+	require.NoError(t, cache.Insert("big", payload))
+	fd, err := cache.Open("big")
+	require.NoError(t, err)
+	require.Nil(t, cache.ReadMapped("big", fd, 0, 4096, int64(len(payload))))
+}
+
+// benchmarkServedRead serves a 64MB cached file in 1MB replies, reading them
+// with pread into a buffer or from a mapping. Each reply is copied once into
+// a sink, as the kernel copies it out of the writev to /dev/fuse, so the
+// difference between the two is the copy a mapping saves.
+func benchmarkServedRead(b *testing.B, mapped bool) {
+	cache := NewLoopbackCache(filepath.Join(b.TempDir(), "content"))
+	const fileSize = 64 << 20
+	require.NoError(b, cache.Insert("bench", bytes.Repeat([]byte{0xab}, fileSize)))
+	fd, err := cache.Open("bench")
+	require.NoError(b, err)
+	b.Cleanup(func() { _ = cache.Close("bench") })
+
+	buf := make([]byte, DefaultMaxIOSize)
+	sink := make([]byte, DefaultMaxIOSize)
+	b.SetBytes(fileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for off := 0; off < fileSize; off += DefaultMaxIOSize {
+			var result fuse.ReadResult
+			if mapped {
+				result = cache.ReadMapped("bench", fd, int64(off), DefaultMaxIOSize, fileSize)
+			} else {
+				result = fuse.ReadResultFd(fd.Fd(), int64(off), DefaultMaxIOSize)
+			}
+			data, status := result.Bytes(buf)
+			if status != fuse.OK {
+				b.Fatalf("read failed: %v", status)
+			}
+			copy(sink, data)
+			result.Done()
+		}
+	}
+}
+
+// BenchmarkServedReadDescriptor1M measures replies read into a buffer first.
+func BenchmarkServedReadDescriptor1M(b *testing.B) { benchmarkServedRead(b, false) }
+
+// BenchmarkServedReadMapped1M measures replies written from a mapping.
+func BenchmarkServedReadMapped1M(b *testing.B) { benchmarkServedRead(b, true) }
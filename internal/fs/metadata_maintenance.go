@@ -130,6 +130,12 @@ func MigrateLegacyMetadata(db *bolt.DB) (*MetadataMigrationReport, error) {
 			return err
 		}
 
+		// The entries were written without the store; the next mount builds
+		// the children index again.
+		if err := tx.DeleteBucket(metadata.ChildrenIndexBucket(bucketMetadataV2)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+
 		if err := tx.DeleteBucket(bucketMetadata); err == nil {
 			report.DroppedLegacy = true
 		} else {
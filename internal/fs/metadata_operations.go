@@ -3,6 +3,7 @@ package fs
 import (
 	"math"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/auriora/onemount/internal/logging"
@@ -24,7 +25,12 @@ func (f *Filesystem) StatFs(_ <-chan struct{}, _ *fuse.InHeader, out *fuse.Statf
 	// Estimate file count from cached metadata
 	estimatedFileCount := f.getEstimatedFileCount()
 
-	if drive.DriveType == graph.DriveTypePersonal {
+	caps := f.Capabilities()
+	if !caps.Probed {
+		caps = graph.DefaultCapabilities(drive.DriveType)
+	}
+
+	if !caps.QuotaFileCount {
 		// Throttle the warning to show only once every 5 minutes
 		f.statfsWarningM.RLock()
 		lastWarning := f.statfsWarningTime
@@ -36,14 +42,15 @@ func (f *Filesystem) StatFs(_ <-chan struct{}, _ *fuse.InHeader, out *fuse.Statf
 			if time.Since(f.statfsWarningTime) > 5*time.Minute {
 				ctx.Warn().
 					Uint64("estimatedFiles", estimatedFileCount).
-					Msg("Personal OneDrive accounts do not show number of files, " +
+					Msg("This OneDrive account does not report the number of files, " +
 						"using estimated count from local cache.")
 				f.statfsWarningTime = time.Now()
 			}
 			f.statfsWarningM.Unlock()
 		}
-	} else if drive.Quota.Total == 0 { // <-- check for if microsoft ever fixes their API
-		ctx.Warn().Msg("OneDrive for Business accounts do not report quotas, " +
+	}
+	if drive.Quota.Total == 0 { // <-- check for if microsoft ever fixes their API
+		ctx.Warn().Msg("This OneDrive account does not report quotas, " +
 			"pretending the quota is 5TB and it's all unused.")
 		drive.Quota.Total = 5 * uint64(math.Pow(1024, 4))
 		drive.Quota.Remaining = 5 * uint64(math.Pow(1024, 4))
@@ -57,8 +64,8 @@ func (f *Filesystem) StatFs(_ <-chan struct{}, _ *fuse.InHeader, out *fuse.Statf
 	out.Bfree = drive.Quota.Remaining / blkSize
 	out.Bavail = drive.Quota.Remaining / blkSize
 
-	// Use estimated file count for Personal OneDrive, actual count for Business
-	if drive.DriveType == graph.DriveTypePersonal {
+	// Use the estimated file count when the quota lacks one
+	if !caps.QuotaFileCount {
 		out.Files = estimatedFileCount
 		// Reserve some inodes for new files (10% or minimum 1000)
 		reserved := estimatedFileCount / 10
@@ -113,8 +120,9 @@ func (f *Filesystem) GetAttr(_ <-chan struct{}, in *fuse.GetAttrIn, out *fuse.At
 		Str("path", inode.Path()).
 		Msg("")
 
+	f.attrCache.hits.Add(1)
 	out.Attr = inode.makeAttr()
-	out.SetTimeout(timeout)
+	out.SetTimeout(f.attrTimeout(inode))
 	return fuse.OK
 }
 
@@ -126,6 +134,9 @@ func (f *Filesystem) SetAttr(_ <-chan struct{}, in *fuse.SetAttrIn, out *fuse.At
 	if i == nil {
 		return fuse.ENOENT
 	}
+	if status := f.rejectPackageWrite("SetAttr", i); status != fuse.OK {
+		return status
+	}
 
 	path := i.Path()
 	isDir := i.IsDir() // holds an rlock
@@ -171,6 +182,11 @@ func (f *Filesystem) SetAttr(_ <-chan struct{}, in *fuse.SetAttrIn, out *fuse.At
 
 	// truncate
 	if size, valid := in.GetSize(); valid {
+		if exceedsSizeLimit(size) {
+			i.mu.Unlock()
+			rejectOversizedWrite("SetAttr.truncate", inodeID, path, size)
+			return fuse.Status(syscall.EFBIG)
+		}
 		ctx.Info().
 			Str("subop", "truncate").
 			Uint64("oldSize", i.DriveItem.Size).
@@ -200,6 +216,16 @@ func (f *Filesystem) SetAttr(_ <-chan struct{}, in *fuse.SetAttrIn, out *fuse.At
 	i.mu.Unlock()
 
 	if doTruncate {
+		if status := f.flushWrites(in.NodeId); status != fuse.OK {
+			return status
+		}
+		if err := f.content.Unshare(inodeID); err != nil {
+			logging.LogError(err, "Failed to unshare content before truncation",
+				logging.FieldID, inodeID,
+				logging.FieldOperation, "SetAttr.truncate",
+				logging.FieldPath, path)
+			return fuse.EIO
+		}
 		fd, err := f.content.Open(inodeID)
 		if err != nil {
 			logging.LogError(err, "Failed to open file for truncation",
@@ -208,6 +234,7 @@ func (f *Filesystem) SetAttr(_ <-chan struct{}, in *fuse.SetAttrIn, out *fuse.At
 				logging.FieldPath, path)
 			return fuse.EIO
 		}
+		defer f.content.suspendMapping(inodeID)()
 		// the unix syscall does not update the seek position, so neither should we
 		if err := fd.Truncate(int64(truncateSize)); err != nil {
 			logging.LogError(err, "Failed to truncate file",
@@ -221,6 +248,8 @@ func (f *Filesystem) SetAttr(_ <-chan struct{}, in *fuse.SetAttrIn, out *fuse.At
 		// Update metadata with a short lock hold.
 		i.mu.Lock()
 		i.DriveItem.Size = truncateSize
+		i.noteTruncateLocked(truncateSize)
+		f.noteAppendTruncateLocked(i, truncateSize)
 		i.mu.Unlock()
 		f.markDirtyLocalState(inodeID)
 	}
@@ -232,9 +261,11 @@ func (f *Filesystem) SetAttr(_ <-chan struct{}, in *fuse.SetAttrIn, out *fuse.At
 
 // Rename renames and/or moves an inode.
 func (f *Filesystem) Rename(_ <-chan struct{}, in *fuse.RenameIn, name string, newName string) fuse.Status {
+	name, newName = f.normalizeName(name), f.normalizeName(newName)
 	if isNameRestricted(newName) {
 		return fuse.EINVAL
 	}
+	f.noteLocalChange()
 
 	oldParentItem := f.GetNodeID(in.NodeId)
 	if oldParentItem == nil {
@@ -251,6 +282,9 @@ func (f *Filesystem) Rename(_ <-chan struct{}, in *fuse.RenameIn, name string, n
 		return fuse.ENOENT
 	}
 	dest := filepath.Join(newParentItem.Path(), newName)
+	if status := f.rejectPackageWrite("Rename", newParentItem); status != fuse.OK {
+		return status
+	}
 
 	inode, _ := f.GetChild(oldParentID, name, f.auth)
 	if inode == nil {
@@ -271,6 +305,10 @@ func (f *Filesystem) Rename(_ <-chan struct{}, in *fuse.RenameIn, name string, n
 		Uint64("srcNodeID", in.NodeId).
 		Uint64("dstNodeID", in.Newdir).
 		Msg("")
+	if newParentID != oldParentID {
+		f.checkFolderGrowth(newParentID, 1)
+	}
+	f.sendPlannedDelete(newParentID, newName)
 
 	remoteID := ""
 	if !isLocalID(id) {
@@ -286,6 +324,13 @@ func (f *Filesystem) Rename(_ <-chan struct{}, in *fuse.RenameIn, name string, n
 		}
 	}
 
+	strict := f.StrictPOSIX()
+	if strict {
+		if status := f.renameStrict(remoteID, newParentID, newName); status != fuse.OK {
+			return status
+		}
+	}
+
 	// Check if there's already a file with the same name (case-insensitive) at the destination
 	existingChild, _ := f.GetChild(newParentID, newName, f.auth)
 	if existingChild != nil && existingChild.ID() != id {
@@ -294,10 +339,18 @@ func (f *Filesystem) Rename(_ <-chan struct{}, in *fuse.RenameIn, name string, n
 			Str("newName", newName).
 			Msg("Found existing file with same name at destination, removing local entry")
 		conflictID := existingChild.ID()
-		f.DeleteID(conflictID)
-		if !isLocalID(conflictID) && !f.IsOffline() {
+		switch {
+		case isLocalID(conflictID):
+		case strict && remoteID != "":
+			// the confirmed remote rename already replaced it
+		case strict:
+			if status := f.strictMutation("delete", conflictID, func() error { return f.remoteDelete(conflictID) }); status != fuse.OK {
+				return status
+			}
+		case !f.IsOffline():
 			f.queueRemoteDelete(conflictID)
 		}
+		f.DeleteID(conflictID)
 	}
 
 	if err := f.MovePath(oldParentID, newParentID, name, newName, f.auth); err != nil {
@@ -329,7 +382,11 @@ func (f *Filesystem) Rename(_ <-chan struct{}, in *fuse.RenameIn, name string, n
 	}
 
 	if remoteID != "" {
-		f.queueRemoteRename(remoteID, newParentID, newName)
+		if strict {
+			f.markHydratedState(id)
+		} else {
+			f.queueRemoteRename(remoteID, newParentID, newName)
+		}
 	}
 
 	return fuse.OK
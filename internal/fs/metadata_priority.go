@@ -29,6 +29,10 @@ const (
 	PriorityForeground
 )
 
+// foregroundRequestTimeout bounds how long a foreground metadata request may
+// take once a worker picks it up.
+const foregroundRequestTimeout = 30 * time.Second
+
 // MetadataRequest represents a queued metadata request
 type MetadataRequest struct {
 	ID       string
@@ -63,6 +67,8 @@ type MetadataRequestManager struct {
 
 	waitTotalNs atomic.Int64
 	waitCount   atomic.Int64
+
+	health *workerPool
 }
 
 type inFlightEntry struct {
@@ -76,7 +82,7 @@ func NewMetadataRequestManager(fs *Filesystem, workers, highQueueSize, lowQueueS
 	if workers >= 2 {
 		foregroundWorkers = 1
 	}
-	return &MetadataRequestManager{
+	m := &MetadataRequestManager{
 		highPriorityQueue: make(chan *MetadataRequest, highQueueSize), // Buffer for foreground requests
 		lowPriorityQueue:  make(chan *MetadataRequest, lowQueueSize),  // Larger buffer for background requests
 		workers:           workers,
@@ -85,6 +91,8 @@ func NewMetadataRequestManager(fs *Filesystem, workers, highQueueSize, lowQueueS
 		fs:                fs,
 		inFlight:          make(map[string]*inFlightEntry),
 	}
+	m.health = newWorkerPool(poolMetadata, func() int { return len(m.highPriorityQueue) + len(m.lowPriorityQueue) })
+	return m
 }
 
 // Start begins processing metadata requests with the specified number of workers
@@ -92,16 +100,27 @@ func (m *MetadataRequestManager) Start() {
 	logging.Info().Int("workers", m.workers).Msg("Starting metadata request manager")
 
 	for i := 0; i < m.foregroundWorkers; i++ {
-		m.wg.Add(1)
-		go m.foregroundWorker(i)
+		m.startForegroundWorker()
 	}
 
 	for i := m.foregroundWorkers; i < m.workers; i++ {
-		m.wg.Add(1)
-		go m.worker(i)
+		m.startWorker()
 	}
 }
 
+// startWorker starts one worker, which is replaced when it gets stuck.
+func (m *MetadataRequestManager) startWorker() {
+	m.wg.Add(1)
+	go m.worker(m.health.add(m.startWorker))
+}
+
+// startForegroundWorker starts one foreground worker, which is replaced when
+// it gets stuck.
+func (m *MetadataRequestManager) startForegroundWorker() {
+	m.wg.Add(1)
+	go m.foregroundWorker(m.health.add(m.startForegroundWorker))
+}
+
 // Stop gracefully stops the metadata request manager
 func (m *MetadataRequestManager) Stop() {
 	logging.Info().Msg("Stopping metadata request manager")
@@ -113,21 +132,13 @@ func (m *MetadataRequestManager) Stop() {
 
 // QueueChildrenRequest queues a request to fetch children of a directory
 func (m *MetadataRequestManager) QueueChildrenRequest(id string, auth *graph.Auth, priority MetadataPriority, callback func([]*graph.DriveItem, error)) error {
-	ctx := context.Background()
-	if priority == PriorityForeground {
-		// Add timeout for foreground requests to prevent hanging
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
-		defer cancel()
-	}
-
 	request := &MetadataRequest{
 		ID:       id,
 		Priority: priority,
 		Type:     "children",
 		Auth:     auth,
 		Callback: callback,
-		Context:  ctx,
+		Context:  m.requestContext(),
 	}
 
 	return m.queueRequest(request)
@@ -135,20 +146,13 @@ func (m *MetadataRequestManager) QueueChildrenRequest(id string, auth *graph.Aut
 
 // QueueItemRequest queues a request to fetch a single item
 func (m *MetadataRequestManager) QueueItemRequest(id string, auth *graph.Auth, priority MetadataPriority, callback func([]*graph.DriveItem, error)) error {
-	ctx := context.Background()
-	if priority == PriorityForeground {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
-		defer cancel()
-	}
-
 	request := &MetadataRequest{
 		ID:       id,
 		Priority: priority,
 		Type:     "item",
 		Auth:     auth,
 		Callback: callback,
-		Context:  ctx,
+		Context:  m.requestContext(),
 	}
 
 	return m.queueRequest(request)
@@ -156,25 +160,27 @@ func (m *MetadataRequestManager) QueueItemRequest(id string, auth *graph.Auth, p
 
 // QueuePathRequest queues a request to fetch children by path
 func (m *MetadataRequestManager) QueuePathRequest(path string, auth *graph.Auth, priority MetadataPriority, callback func([]*graph.DriveItem, error)) error {
-	ctx := context.Background()
-	if priority == PriorityForeground {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
-		defer cancel()
-	}
-
 	request := &MetadataRequest{
 		Path:     path,
 		Priority: priority,
 		Type:     "path",
 		Auth:     auth,
 		Callback: callback,
-		Context:  ctx,
+		Context:  m.requestContext(),
 	}
 
 	return m.queueRequest(request)
 }
 
+// requestContext returns the context requests are made in, which ends when
+// the mount stops.
+func (m *MetadataRequestManager) requestContext() context.Context {
+	if m.fs == nil {
+		return context.Background()
+	}
+	return m.fs.mountContext()
+}
+
 // queueRequest adds a request to the appropriate priority queue
 func (m *MetadataRequestManager) queueRequest(request *MetadataRequest) error {
 	key := request.cacheKey()
@@ -207,6 +213,7 @@ func (m *MetadataRequestManager) queueRequest(request *MetadataRequest) error {
 
 	select {
 	case targetQueue <- request:
+		m.health.enqueued()
 		logging.Debug().
 			Str("type", request.Type).
 			Str("id", request.ID).
@@ -231,6 +238,7 @@ func (m *MetadataRequestManager) queueRequest(request *MetadataRequest) error {
 // worker processes metadata requests from the priority queues
 func (m *MetadataRequestManager) worker(workerID int) {
 	defer m.wg.Done()
+	defer m.health.remove(workerID)
 
 	logging.Debug().Int("workerID", workerID).Msg("Metadata request worker started")
 
@@ -242,29 +250,38 @@ func (m *MetadataRequestManager) worker(workerID int) {
 
 		case request := <-m.highPriorityQueue:
 			// Process high priority requests immediately
-			m.processRequest(workerID, request, "high")
+			if !m.processRequest(workerID, request, "high") {
+				return
+			}
 
 		case request := <-m.lowPriorityQueue:
 			// Process low priority requests only if no high priority requests are waiting
 			select {
 			case highPriorityRequest := <-m.highPriorityQueue:
 				// High priority request arrived, process it first
-				m.processRequest(workerID, highPriorityRequest, "high")
+				active := m.processRequest(workerID, highPriorityRequest, "high")
 				// Put the low priority request back in the queue
 				select {
 				case m.lowPriorityQueue <- request:
+					m.health.enqueued()
 				default:
 					// Queue full, drop the request
 					logging.Warn().Int("workerID", workerID).Msg("Low priority queue full, dropping request")
 					request.Callback(nil, ErrQueueFull)
 				}
+				if !active {
+					return
+				}
 			default:
 				// No high priority requests, process the low priority request
-				m.processRequest(workerID, request, "low")
+				if !m.processRequest(workerID, request, "low") {
+					return
+				}
 			}
 
 		default:
 			// No requests available, wait a bit to avoid busy waiting
+			m.health.beat(workerID)
 			time.Sleep(10 * time.Millisecond)
 		}
 	}
@@ -272,6 +289,7 @@ func (m *MetadataRequestManager) worker(workerID int) {
 
 func (m *MetadataRequestManager) foregroundWorker(workerID int) {
 	defer m.wg.Done()
+	defer m.health.remove(workerID)
 	logging.Debug().Int("workerID", workerID).Msg("Foreground metadata request worker started")
 	for {
 		select {
@@ -279,18 +297,26 @@ func (m *MetadataRequestManager) foregroundWorker(workerID int) {
 			logging.Debug().Int("workerID", workerID).Msg("Foreground metadata request worker stopping")
 			return
 		case request := <-m.highPriorityQueue:
-			m.processRequest(workerID, request, "high")
+			if !m.processRequest(workerID, request, "high") {
+				return
+			}
 		case request := <-m.lowPriorityQueue:
 			// Only help with low-priority work when high queue is empty.
-			m.processRequest(workerID, request, "low-steal")
+			if !m.processRequest(workerID, request, "low-steal") {
+				return
+			}
 		default:
+			m.health.beat(workerID)
 			time.Sleep(5 * time.Millisecond)
 		}
 	}
 }
 
-// processRequest executes a metadata request
-func (m *MetadataRequestManager) processRequest(workerID int, request *MetadataRequest, priorityName string) {
+// processRequest executes a metadata request. It reports false when the
+// worker was replaced while the request was stuck and must exit.
+func (m *MetadataRequestManager) processRequest(workerID int, request *MetadataRequest, priorityName string) bool {
+	// The task leaves out the path, since worker state goes into support bundles.
+	m.health.begin(workerID, strings.TrimSpace(request.Type+" "+request.ID))
 	startTime := time.Now()
 	var waitDur time.Duration
 	if !request.queuedAt.IsZero() {
@@ -310,18 +336,32 @@ func (m *MetadataRequestManager) processRequest(workerID int, request *MetadataR
 	var result []*graph.DriveItem
 	var err error
 
-	switch request.Type {
-	case "children":
-		result, err = graph.GetItemChildren(request.ID, request.Auth)
-	case "item":
-		item, itemErr := graph.GetItem(request.ID, request.Auth)
+	ctx := request.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if request.Priority == PriorityForeground {
+		// Keep foreground requests from hanging
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, foregroundRequestTimeout)
+		defer cancel()
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		// the mount stopped while the request was queued
+		err = ctx.Err()
+	case request.Type == "children":
+		result, err = graph.GetItemChildrenWithContext(ctx, request.ID, request.Auth)
+	case request.Type == "item":
+		item, itemErr := graph.GetItemWithContext(ctx, request.ID, request.Auth)
 		if itemErr != nil {
 			err = itemErr
 		} else {
 			result = []*graph.DriveItem{item}
 		}
-	case "path":
-		result, err = graph.GetItemChildrenPath(request.Path, request.Auth)
+	case request.Type == "path":
+		result, err = graph.GetItemChildrenPathWithContext(ctx, request.Path, request.Auth)
 	default:
 		err = ErrInvalidRequestType
 	}
@@ -352,6 +392,7 @@ func (m *MetadataRequestManager) processRequest(workerID int, request *MetadataR
 
 	// Call the callback with the result
 	request.Callback(result, err)
+	return m.health.end(workerID)
 }
 
 // GetQueueStats returns statistics about the request queues
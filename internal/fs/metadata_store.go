@@ -27,7 +27,7 @@ func (f *Filesystem) metadataEntryFromInode(id string, inode *Inode, snapshot ti
 	inode.mu.RLock()
 	defer inode.mu.RUnlock()
 
-	isDir := inode.DriveItem.IsDir()
+	isDir := inode.DriveItem.IsDir() || inode.DriveItem.IsPackage()
 	hasChanges := inode.hasChanges
 	isVirtual := inode.virtual
 
@@ -42,6 +42,7 @@ func (f *Filesystem) metadataEntryFromInode(id string, inode *Inode, snapshot ti
 		Mode:          inode.mode,
 		Xattrs:        cloneXattrs(inode.xattrs),
 		Size:          inode.DriveItem.Size,
+		Ino:           inode.ino,
 		Pin: metadata.PinState{
 			Mode: metadata.PinModeUnset,
 		},
@@ -58,6 +59,16 @@ func (f *Filesystem) metadataEntryFromInode(id string, inode *Inode, snapshot ti
 	if inode.DriveItem.ETag != "" {
 		entry.ETag = inode.DriveItem.ETag
 	}
+	if inode.DriveItem.CTag != "" {
+		entry.CTag = inode.DriveItem.CTag
+	}
+	if inode.DriveItem.WebURL != "" {
+		entry.WebURL = inode.DriveItem.WebURL
+	}
+	entry.Description = inode.DriveItem.Description
+	if inode.DriveItem.IsPackage() {
+		entry.PackageType = packageType(&inode.DriveItem)
+	}
 	if inode.DriveItem.ModTime != nil {
 		ts := inode.DriveItem.ModTime.UTC()
 		entry.LastModified = &ts
@@ -86,8 +97,12 @@ func (f *Filesystem) metadataEntryFromInode(id string, inode *Inode, snapshot ti
 	if f != nil && f.isChildPendingRemote(id) {
 		entry.PendingRemote = true
 	}
-	if f != nil && f.defaultOverlayPolicy != "" {
-		entry.OverlayPolicy = f.defaultOverlayPolicy
+	if f != nil && f.overlayPolicyDefault() != "" {
+		entry.OverlayPolicy = f.overlayPolicyDefault()
+	}
+	if override, ok := overlayOverride(entry.Xattrs); ok {
+		entry.OverlayPolicy = override
+		entry.OverlaySet = true
 	}
 
 	return entry
@@ -139,6 +154,7 @@ func (f *Filesystem) inodeFromMetadataEntry(entry *metadata.Entry) *Inode {
 		mode:     entry.Mode,
 		xattrs:   cloneXattrs(entry.Xattrs),
 		virtual:  entry.Virtual,
+		ino:      entry.Ino,
 	}
 
 	itemID := entry.ID
@@ -146,6 +162,9 @@ func (f *Filesystem) inodeFromMetadataEntry(entry *metadata.Entry) *Inode {
 	inode.DriveItem.Name = entry.Name
 	inode.DriveItem.Size = entry.Size
 	inode.DriveItem.ETag = entry.ETag
+	inode.DriveItem.CTag = entry.CTag
+	inode.DriveItem.WebURL = entry.WebURL
+	inode.DriveItem.Description = entry.Description
 
 	if entry.ParentID != "" {
 		inode.DriveItem.Parent = &graph.DriveItemParent{
@@ -157,8 +176,11 @@ func (f *Filesystem) inodeFromMetadataEntry(entry *metadata.Entry) *Inode {
 		inode.DriveItem.ModTime = &ts
 	}
 
-	switch entry.ItemType {
-	case metadata.ItemKindDirectory:
+	switch {
+	case entry.PackageType != "":
+		inode.DriveItem.Package = &graph.Package{Type: entry.PackageType}
+		inode.mode = packageMode
+	case entry.ItemType == metadata.ItemKindDirectory:
 		inode.DriveItem.Folder = &graph.Folder{ChildCount: entry.SubdirCount}
 		if inode.mode == 0 {
 			inode.mode = fuse.S_IFDIR | 0755
@@ -271,26 +293,39 @@ func (f *Filesystem) entryFromDriveItem(item *graph.DriveItem, snapshot time.Tim
 	if item.ETag != "" {
 		entry.ETag = item.ETag
 	}
+	if item.CTag != "" {
+		entry.CTag = item.CTag
+	}
+	if item.WebURL != "" {
+		entry.WebURL = item.WebURL
+	}
+	entry.Description = item.Description
 	if item.ModTime != nil {
 		ts := item.ModTime.UTC()
 		entry.LastModified = &ts
 	}
-	if item.IsDir() {
+	switch {
+	case item.IsPackage():
+		entry.ItemType = metadata.ItemKindDirectory
+		entry.State = metadata.ItemStateHydrated
+		entry.PackageType = packageType(item)
+		entry.Mode = packageMode
+	case item.IsDir():
 		entry.ItemType = metadata.ItemKindDirectory
 		entry.State = metadata.ItemStateHydrated
 		entry.SubdirCount = uint32(item.Folder.ChildCount)
 		if entry.Mode == 0 {
 			entry.Mode = fuse.S_IFDIR | 0755
 		}
-	} else {
+	default:
 		entry.Size = item.Size
 		if entry.Mode == 0 {
 			entry.Mode = fuse.S_IFREG | 0644
 		}
 	}
 
-	if f != nil && f.defaultOverlayPolicy != "" {
-		entry.OverlayPolicy = f.defaultOverlayPolicy
+	if f != nil && f.overlayPolicyDefault() != "" {
+		entry.OverlayPolicy = f.overlayPolicyDefault()
 	}
 
 	return entry
@@ -316,12 +351,26 @@ func (f *Filesystem) applyDriveItemToEntry(entry *metadata.Entry, item *graph.Dr
 	if item.ETag != "" {
 		entry.ETag = item.ETag
 	}
+	if item.CTag != "" {
+		entry.CTag = item.CTag
+	}
+	if item.WebURL != "" {
+		entry.WebURL = item.WebURL
+	}
+	entry.Description = item.Description
 	if item.ModTime != nil {
 		ts := item.ModTime.UTC()
 		entry.LastModified = &ts
 	}
 
-	if item.IsDir() {
+	if item.IsPackage() {
+		entry.ItemType = metadata.ItemKindDirectory
+		entry.PackageType = packageType(item)
+		entry.Mode = packageMode
+		if entry.State == "" {
+			entry.State = metadata.ItemStateHydrated
+		}
+	} else if item.IsDir() {
 		entry.ItemType = metadata.ItemKindDirectory
 		entry.SubdirCount = uint32(item.Folder.ChildCount)
 		if entry.Mode == 0 {
@@ -343,8 +392,8 @@ func (f *Filesystem) applyDriveItemToEntry(entry *metadata.Entry, item *graph.Dr
 
 	if entry.OverlayPolicy == "" {
 		entry.OverlayPolicy = metadata.OverlayPolicyRemoteWins
-		if f != nil && f.defaultOverlayPolicy != "" {
-			entry.OverlayPolicy = f.defaultOverlayPolicy
+		if f != nil && f.overlayPolicyDefault() != "" {
+			entry.OverlayPolicy = f.overlayPolicyDefault()
 		}
 	}
 
@@ -383,6 +432,10 @@ func cloneMetadataEntry(entry *metadata.Entry) *metadata.Entry {
 		ts := entry.LastUploaded.UTC()
 		copied.LastUploaded = &ts
 	}
+	if entry.LastAccessed != nil {
+		ts := entry.LastAccessed.UTC()
+		copied.LastAccessed = &ts
+	}
 	return &copied
 }
 
@@ -564,7 +617,26 @@ func (f *Filesystem) persistMetadataEntry(id string, inode *Inode) {
 	if entry == nil {
 		return
 	}
-	if err := f.metadataStore.Save(context.Background(), entry); err != nil {
+	// The inode carries neither the pin, the conflict pairing nor the access
+	// time, nor its stable inode number outside strict POSIX mode; keep the
+	// stored ones.
+	_, err := f.metadataStore.Update(context.Background(), id, func(existing *metadata.Entry) error {
+		if entry.Pin.Mode == "" || entry.Pin.Mode == metadata.PinModeUnset {
+			entry.Pin = existing.Pin
+		}
+		if entry.Ino == 0 {
+			entry.Ino = existing.Ino
+		}
+		entry.ConflictPeer = existing.ConflictPeer
+		entry.ConflictDevice = existing.ConflictDevice
+		entry.LastAccessed = existing.LastAccessed
+		*existing = *entry
+		return nil
+	})
+	if goerrors.Is(err, metadata.ErrNotFound) {
+		err = f.metadataStore.Save(context.Background(), entry)
+	}
+	if err != nil {
 		logging.Debug().
 			Err(err).
 			Str("id", id).
@@ -576,13 +648,19 @@ func (f *Filesystem) transitionItemState(id string, target metadata.ItemState, o
 	if f.stateManager == nil || id == "" {
 		return
 	}
-	if _, err := f.stateManager.Transition(context.Background(), id, target, opts...); err != nil && !goerrors.Is(err, metadata.ErrNotFound) {
-		logging.Debug().
-			Err(err).
-			Str("id", id).
-			Str("state", string(target)).
-			Msg("Metadata state transition failed")
+	entry, err := f.stateManager.Transition(context.Background(), id, target, opts...)
+	if err != nil {
+		if !goerrors.Is(err, metadata.ErrNotFound) {
+			logging.Debug().
+				Err(err).
+				Str("id", id).
+				Str("state", string(target)).
+				Msg("Metadata state transition failed")
+		}
+		return
 	}
+	f.recordStateEvent(id, entry)
+	f.onStateTransition(id, target)
 }
 
 // transitionToState transitions via the state manager, forcing the transition when the current state matches.
@@ -621,6 +699,7 @@ func (f *Filesystem) markEntryDeleted(id string) {
 		entry.PendingRemote = false
 		entry.LastHydrated = nil
 		entry.LastUploaded = nil
+		entry.LastAccessed = nil
 		entry.Hydration = metadata.HydrationState{}
 		entry.Upload = metadata.UploadState{}
 		entry.LastError = nil
@@ -651,6 +730,13 @@ func (f *Filesystem) updateMetadataFromDelta(id string, delta *graph.DriveItem)
 		if delta.ETag != "" {
 			entry.ETag = delta.ETag
 		}
+		if delta.CTag != "" {
+			entry.CTag = delta.CTag
+		}
+		if delta.WebURL != "" {
+			entry.WebURL = delta.WebURL
+		}
+		entry.Description = delta.Description
 		if !delta.IsDir() && delta.Size != 0 {
 			entry.Size = delta.Size
 		}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/metadata"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	bolt "go.etcd.io/bbolt"
@@ -97,6 +98,7 @@ func TestUT_FS_MetadataStore_InodeFromMetadataEntry(t *testing.T) {
 		ParentID:      "parent-1",
 		Size:          1024,
 		ETag:          "etag-123",
+		WebURL:        "https://onedrive.live.com/?id=item-3",
 		LastModified:  &lastModified,
 		Children:      []string{},
 		Mode:          fuse.S_IFREG | 0644,
@@ -118,6 +120,28 @@ func TestUT_FS_MetadataStore_InodeFromMetadataEntry(t *testing.T) {
 	if inode.DriveItem.ETag != entry.ETag {
 		t.Fatalf("expected etag propagation")
 	}
+	if inode.DriveItem.WebURL != entry.WebURL {
+		t.Fatalf("expected web URL propagation")
+	}
+	if names := xattrNamesLocked(inode); len(names) != 1 || names[0] != xattrWebURL {
+		t.Fatalf("expected derived web URL xattr, got %v", names)
+	}
+}
+
+func TestUT_FS_MetadataStore_DeltaUpdatesWebURL(t *testing.T) {
+	fs := &Filesystem{}
+	item := &graph.DriveItem{ID: "item-4", Name: "doc.txt", WebURL: "https://onedrive.live.com/old"}
+
+	entry := fs.entryFromDriveItem(item, time.Now().UTC())
+	if entry.WebURL != item.WebURL {
+		t.Fatalf("expected web URL on new entry, got %q", entry.WebURL)
+	}
+
+	item.WebURL = "https://onedrive.live.com/new"
+	fs.applyDriveItemToEntry(entry, item, time.Now().UTC())
+	if entry.WebURL != item.WebURL {
+		t.Fatalf("expected web URL updated from delta, got %q", entry.WebURL)
+	}
 }
 
 func TestUT_FS_MetadataStore_PendingRemoteMetadataUpdates(t *testing.T) {
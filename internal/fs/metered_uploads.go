@@ -0,0 +1,289 @@
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/godbus/dbus/v5"
+	bolt "go.etcd.io/bbolt"
+)
+
+// While NetworkManager reports a metered connection (e.g. a mobile hotspot),
+// uploads of files larger than the metered upload threshold are deferred. The
+// item stays DIRTY_LOCAL with DeferredMetered recorded as its upload deferral
+// reason, which --stats counts and the D-Bus GetUploadDeferral method reports.
+// Deferred uploads are queued again once the connection is unmetered or the
+// threshold is raised. The metered state is polled, so a change takes effect
+// within meteredPollInterval.
+
+// DeferredMetered is the deferral reason of uploads waiting for an unmetered
+// connection.
+const DeferredMetered = "DeferredMetered"
+
+const meteredPollInterval = 30 * time.Second
+
+// NetworkManager D-Bus names and the NMMetered values that count as metered.
+const (
+	nmBusName         = "org.freedesktop.NetworkManager"
+	nmObjectPath      = "/org/freedesktop/NetworkManager"
+	nmMeteredYes      = 1
+	nmMeteredGuessYes = 3
+)
+
+// meteredProbe reports whether the current connection is metered.
+type meteredProbe func() (bool, error)
+
+// meteredUploads tracks uploads deferred by the metered connection policy.
+// The zero value is ready to use and never defers.
+type meteredUploads struct {
+	mu        sync.Mutex
+	threshold uint64 // bytes; 0 disables deferral
+	metered   bool
+	probeErr  bool // the last probe failed; logged once
+	deferred  map[string]struct{}
+}
+
+// networkManagerMetered reads the Metered property of NetworkManager's
+// primary connection from the system bus.
+func networkManagerMetered() (bool, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return false, err
+	}
+	v, err := conn.Object(nmBusName, nmObjectPath).GetProperty(nmBusName + ".Metered")
+	if err != nil {
+		return false, err
+	}
+	m, ok := v.Value().(uint32)
+	if !ok {
+		return false, fmt.Errorf("unexpected NetworkManager Metered value %v", v)
+	}
+	return m == nmMeteredYes || m == nmMeteredGuessYes, nil
+}
+
+// SetMeteredUploadThreshold sets the file size in bytes above which uploads
+// wait for an unmetered connection; 0 never defers uploads.
+func (f *Filesystem) SetMeteredUploadThreshold(bytes uint64) {
+	f.meteredUploads.mu.Lock()
+	f.meteredUploads.threshold = bytes
+	f.meteredUploads.mu.Unlock()
+	f.resumeMeteredUploads()
+}
+
+// setMetered records the connection's metered state, resuming deferred
+// uploads when it becomes unmetered.
+func (f *Filesystem) setMetered(metered bool) {
+	m := &f.meteredUploads
+	m.mu.Lock()
+	changed := m.metered != metered
+	m.metered = metered
+	m.mu.Unlock()
+	if !changed {
+		return
+	}
+	logging.Info().Bool("metered", metered).Msg("Network connection metered state changed")
+	if !metered {
+		f.resumeMeteredUploads()
+	}
+}
+
+// holdMeteredUpload reports true, recording the item as deferred, when its
+// upload has to wait for an unmetered connection.
+func (f *Filesystem) holdMeteredUpload(inode *Inode) bool {
+	if inode == nil {
+		return false
+	}
+	inode.mu.RLock()
+	size := inode.DriveItem.Size
+	inode.mu.RUnlock()
+
+	id := inode.ID()
+	m := &f.meteredUploads
+	m.mu.Lock()
+	if !m.metered || m.threshold == 0 || size <= m.threshold {
+		m.mu.Unlock()
+		return false
+	}
+	if m.deferred == nil {
+		m.deferred = make(map[string]struct{})
+	}
+	_, already := m.deferred[id]
+	m.deferred[id] = struct{}{}
+	m.mu.Unlock()
+
+	f.markPendingUpload(id)
+	f.setUploadDeferral(id, DeferredMetered)
+	f.SetFileStatus(id, FileStatusInfo{
+		Status:    StatusLocalModified,
+		ErrorCode: DeferredMetered,
+		Timestamp: time.Now(),
+	})
+	if !already {
+		logging.Info().
+			Str("id", id).
+			Uint64("size", size).
+			Msg("Deferring upload until the connection is unmetered")
+	}
+	return true
+}
+
+// holdUpload is checked before queueing an upload. It reports true when the
+// upload has to wait because the item is frozen, too large for OneDrive or
+// too large for a metered connection; the item is left DIRTY_LOCAL.
+func (f *Filesystem) holdUpload(inode *Inode) bool {
+	return f.holdFrozenUpload(inode) || f.holdOversizedUpload(inode) || f.holdMeteredUpload(inode)
+}
+
+// setUploadDeferral persists why the item's upload is waiting; an empty
+// reason clears it.
+func (f *Filesystem) setUploadDeferral(id, reason string) {
+	if f.metadataStore == nil {
+		return
+	}
+	_, err := f.UpdateMetadataEntry(id, func(entry *metadata.Entry) error {
+		entry.Upload.DeferredReason = reason
+		return nil
+	})
+	if err != nil && !errors.Is(err, metadata.ErrNotFound) {
+		logging.Debug().Err(err).Str("id", id).Msg("Failed to persist upload deferral")
+	}
+}
+
+// UploadDeferral returns why the item's upload is waiting, or an empty string
+// when it is not deferred.
+func (f *Filesystem) UploadDeferral(id string) string {
+	f.meteredUploads.mu.Lock()
+	_, ok := f.meteredUploads.deferred[id]
+	f.meteredUploads.mu.Unlock()
+	if ok {
+		return DeferredMetered
+	}
+	if reason := f.uploadDeferralReason(id); reason == DeferredTooLarge {
+		return reason
+	}
+	return ""
+}
+
+// resumeMeteredUploads queues the deferred uploads that may now proceed.
+func (f *Filesystem) resumeMeteredUploads() {
+	m := &f.meteredUploads
+	m.mu.Lock()
+	if len(m.deferred) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	var ready []string
+	for id := range m.deferred {
+		// While still metered only a raised threshold releases items.
+		if m.metered && m.threshold > 0 {
+			if inode := f.GetID(id); inode != nil && inode.Size() > m.threshold {
+				continue
+			}
+		}
+		ready = append(ready, id)
+		delete(m.deferred, id)
+	}
+	m.mu.Unlock()
+	if len(ready) == 0 {
+		return
+	}
+
+	logging.Info().Int("uploads", len(ready)).Msg("Resuming uploads deferred on a metered connection")
+	for _, id := range ready {
+		f.setUploadDeferral(id, "")
+		inode := f.GetID(id)
+		if inode == nil || f.uploads == nil || f.holdFrozenUpload(inode) {
+			continue
+		}
+		if _, err := f.uploads.QueueUploadWithPriority(inode, PriorityLow); err != nil {
+			logging.Warn().Err(err).Str("id", id).Msg("Failed to queue deferred upload")
+		}
+	}
+}
+
+// restoreMeteredDeferrals reloads uploads deferred before the last unmount so
+// they resume with the next unmetered connection.
+func (f *Filesystem) restoreMeteredDeferrals() {
+	if f.db == nil {
+		return
+	}
+	var ids []string
+	_ = f.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMetadataV2)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var entry metadata.Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return nil
+			}
+			if entry.State == metadata.ItemStateDirtyLocal && entry.Upload.DeferredReason == DeferredMetered {
+				ids = append(ids, entry.ID)
+			}
+			return nil
+		})
+	})
+	if len(ids) == 0 {
+		return
+	}
+	f.meteredUploads.mu.Lock()
+	if f.meteredUploads.deferred == nil {
+		f.meteredUploads.deferred = make(map[string]struct{})
+	}
+	for _, id := range ids {
+		f.meteredUploads.deferred[id] = struct{}{}
+	}
+	f.meteredUploads.mu.Unlock()
+}
+
+// pollMetered updates the metered state from probe. A failing probe (e.g. no
+// NetworkManager) counts as unmetered.
+func (f *Filesystem) pollMetered(probe meteredProbe) {
+	metered, err := probe()
+	m := &f.meteredUploads
+	m.mu.Lock()
+	logErr := err != nil && !m.probeErr
+	m.probeErr = err != nil
+	m.mu.Unlock()
+	if logErr {
+		logging.Debug().Err(err).Msg("Cannot read metered state from NetworkManager, assuming unmetered")
+	}
+	f.setMetered(metered && err == nil)
+}
+
+// StartMeteredUploadMonitor follows NetworkManager's metered state until the
+// filesystem stops, deferring large uploads while the connection is metered.
+func (f *Filesystem) StartMeteredUploadMonitor() {
+	f.startMeteredMonitor(networkManagerMetered, meteredPollInterval)
+}
+
+func (f *Filesystem) startMeteredMonitor(probe meteredProbe, interval time.Duration) {
+	f.restoreMeteredDeferrals()
+	f.pollMetered(probe)
+	// The first poll only resumes deferrals when it finds the connection no
+	// longer metered; restored ones wait for no change when it never was
+	f.resumeMeteredUploads()
+
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				f.pollMetered(probe)
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_MeteredUploads_DefersLargeFilesUntilUnmetered(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.uploads = nil // resumed uploads are not queued in this test
+
+	small := NewInode("notes.txt", fuse.S_IFREG|0644, nil)
+	small.DriveItem.ID = "small"
+	small.DriveItem.Size = 1 << 10
+	registerHydratedEntry(t, fs, small)
+
+	large := NewInode("video.mp4", fuse.S_IFREG|0644, nil)
+	large.DriveItem.ID = "large"
+	large.DriveItem.Size = 50 << 20
+	registerHydratedEntry(t, fs, large)
+
+	fs.SetMeteredUploadThreshold(10 << 20)
+	require.False(t, fs.holdUpload(large), "unmetered connections never defer")
+
+	fs.pollMetered(func() (bool, error) { return true, nil })
+	require.False(t, fs.holdUpload(small), "files under the threshold upload on metered connections")
+	require.True(t, fs.holdUpload(large))
+	require.Equal(t, DeferredMetered, fs.UploadDeferral(large.ID()))
+	require.Equal(t, StatusLocalModified, fs.GetFileStatus(large.ID()).Status)
+
+	entry, err := fs.GetMetadataEntry(large.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateDirtyLocal, entry.State)
+	require.Equal(t, DeferredMetered, entry.Upload.DeferredReason)
+
+	// A remount picks the deferral up again from metadata.
+	remounted := &Filesystem{db: fs.db}
+	remounted.restoreMeteredDeferrals()
+	require.Equal(t, DeferredMetered, remounted.UploadDeferral(large.ID()))
+
+	fs.pollMetered(func() (bool, error) { return true, nil })
+	require.Equal(t, DeferredMetered, fs.UploadDeferral(large.ID()), "still metered")
+
+	fs.pollMetered(func() (bool, error) { return false, nil })
+	require.Empty(t, fs.UploadDeferral(large.ID()), "deferrals resume once unmetered")
+	entry, err = fs.GetMetadataEntry(large.ID())
+	require.NoError(t, err)
+	require.Empty(t, entry.Upload.DeferredReason)
+}
+
+func TestUT_FS_MeteredUploads_ResumesRestoredDeferralsWhenUnmetered(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.uploads = nil // resumed uploads are not queued in this test
+	ctx, cancel := context.WithCancel(context.Background())
+	fs.ctx = ctx
+	t.Cleanup(func() {
+		cancel()
+		fs.Wg.Wait()
+	})
+
+	large := NewInode("video.mp4", fuse.S_IFREG|0644, nil)
+	large.DriveItem.ID = "large"
+	large.DriveItem.Size = 50 << 20
+	registerHydratedEntry(t, fs, large)
+	fs.SetMeteredUploadThreshold(10 << 20)
+	fs.pollMetered(func() (bool, error) { return true, nil })
+	require.True(t, fs.holdUpload(large))
+
+	// Mounted again on an unmetered connection
+	fs.meteredUploads = meteredUploads{threshold: 10 << 20}
+	fs.startMeteredMonitor(func() (bool, error) { return false, nil }, time.Hour)
+	require.Empty(t, fs.UploadDeferral(large.ID()))
+	entry, err := fs.GetMetadataEntry(large.ID())
+	require.NoError(t, err)
+	require.Empty(t, entry.Upload.DeferredReason)
+}
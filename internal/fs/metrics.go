@@ -0,0 +1,240 @@
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// A mount can serve its live counters to Prometheus at /metrics, so that
+// dashboards and alerts do not have to run onemount --stats. The metrics come
+// from the same sources as the statistics, minus the walk over all items that
+// GetStats does, and are written in the Prometheus text format on every
+// scrape. They are only served on the loopback interface or a unix socket:
+// the paths are not exposed, but how the mount is used is.
+
+// metricsContentType is the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metricsUnixPrefix marks a metrics address as the path of a unix socket.
+const metricsUnixPrefix = "unix:"
+
+// mountMetrics counts what the other sources of the metrics do not keep
+// since the mount started. The zero value is ready to use.
+type mountMetrics struct {
+	uploads         atomic.Uint64 // files uploaded
+	downloads       atomic.Uint64 // files downloaded into the cache
+	uploadedBytes   atomic.Uint64
+	downloadedBytes atomic.Uint64
+	deltaCycles     atomic.Uint64 // successful delta fetch and apply cycles
+	deltaNanos      atomic.Uint64 // total duration of the delta cycles
+	lastDeltaNanos  atomic.Int64  // duration of the last delta cycle
+}
+
+// recordActivity counts the uploads and downloads reported to the activity
+// feed.
+func (m *mountMetrics) recordActivity(eventType string) {
+	switch eventType {
+	case ActivityUploaded:
+		m.uploads.Add(1)
+	case ActivityHydrated:
+		m.downloads.Add(1)
+	}
+}
+
+// recordDeltaCycle counts a delta cycle that took d to fetch and apply.
+func (m *mountMetrics) recordDeltaCycle(d time.Duration) {
+	m.deltaCycles.Add(1)
+	m.deltaNanos.Add(uint64(d))
+	m.lastDeltaNanos.Store(int64(d))
+}
+
+// ParseMetricsAddress returns the network and address the metrics of a mount
+// are served on for the metricsAddress setting: "unix:<path>" for a unix
+// socket, or host:port with a loopback host such as localhost:9464.
+func ParseMetricsAddress(address string) (network, addr string, err error) {
+	if path, ok := strings.CutPrefix(address, metricsUnixPrefix); ok {
+		if path == "" {
+			return "", "", errors.NewValidationError("the metrics socket needs a path, as in unix:/run/user/1000/onemount.sock", nil)
+		}
+		return "unix", path, nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", errors.NewValidationError("the metrics address must be host:port or unix:<path>, got "+address, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", "", errors.NewValidationError("the metrics address has an invalid port: "+address, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", "", errors.NewValidationError("metrics are only served on localhost, not on "+address, nil)
+	}
+	return "tcp", address, nil
+}
+
+// StartMetricsServer serves the metrics of the mount at /metrics on address,
+// as taken by ParseMetricsAddress, until the filesystem stops.
+func (f *Filesystem) StartMetricsServer(address string) error {
+	network, addr, err := ParseMetricsAddress(address)
+	if err != nil {
+		return err
+	}
+	if network == "unix" {
+		// A socket left behind by a mount that was killed
+		if info, err := os.Lstat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(addr)
+		}
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return errors.Wrap(err, "could not serve metrics on "+address)
+	}
+	if network == "unix" {
+		if err := os.Chmod(addr, 0600); err != nil {
+			listener.Close()
+			return errors.Wrap(err, "could not restrict the metrics socket")
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+		if err := f.WriteMetrics(w); err != nil {
+			logging.Debug().Err(err).Msg("Failed to write metrics")
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+		<-f.ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logging.Warn().Err(err).Str("address", address).Msg("Metrics server stopped")
+		}
+	}()
+	logging.Info().Str("address", address).Msg("Serving Prometheus metrics at /metrics")
+	return nil
+}
+
+// WriteMetrics writes the metrics of the mount in the Prometheus text format.
+func (f *Filesystem) WriteMetrics(w io.Writer) error {
+	out := metricsWriter{w: bufio.NewWriter(w)}
+	m := &f.metrics
+
+	downloads := f.downloads.Snapshot()
+	out.gauge("onemount_hydration_queue_depth", "Downloads waiting for a worker.", float64(downloads.QueueDepth))
+	out.gauge("onemount_hydration_active_downloads", "Downloads in progress.", float64(downloads.Active))
+	out.counter("onemount_downloads_total", "Files downloaded into the cache.", float64(m.downloads.Load()))
+	out.counter("onemount_downloaded_bytes_total", "Bytes downloaded from OneDrive.", float64(m.downloadedBytes.Load()))
+
+	if f.metadataRequestManager != nil {
+		queue := f.metadataRequestManager.Snapshot()
+		out.labeled("onemount_metadata_queue_depth", "gauge", "Folder listings and item lookups waiting for a worker.",
+			"priority", map[string]float64{"high": float64(queue.HighDepth), "low": float64(queue.LowDepth)})
+		out.counter("onemount_metadata_queue_wait_seconds_total", "Time metadata requests waited in the queue.",
+			float64(f.metadataRequestManager.waitTotalNs.Load())/float64(time.Second))
+		out.counter("onemount_metadata_queue_requests_total", "Metadata requests taken from the queue.",
+			float64(f.metadataRequestManager.waitCount.Load()))
+	}
+
+	sessions := map[string]float64{"not_started": 0, "in_progress": 0, "verifying": 0, "completed": 0, "errored": 0}
+	if f.uploads != nil {
+		f.uploads.mutex.RLock()
+		for _, session := range f.uploads.sessions {
+			switch session.getState() {
+			case uploadNotStarted:
+				sessions["not_started"]++
+			case uploadStarted:
+				sessions["in_progress"]++
+			case uploadVerifying:
+				sessions["verifying"]++
+			case uploadComplete:
+				sessions["completed"]++
+			case uploadErrored:
+				sessions["errored"]++
+			}
+		}
+		f.uploads.mutex.RUnlock()
+	}
+	out.labeled("onemount_upload_sessions", "gauge", "Uploads in the upload queue by state.", "state", sessions)
+	out.counter("onemount_uploads_total", "Files uploaded.", float64(m.uploads.Load()))
+	out.counter("onemount_uploaded_bytes_total", "Bytes uploaded to OneDrive.", float64(m.uploadedBytes.Load()))
+
+	out.counter("onemount_delta_cycles_total", "Successful cycles fetching and applying remote changes.", float64(m.deltaCycles.Load()))
+	out.counter("onemount_delta_cycle_seconds_total", "Time spent fetching and applying remote changes.",
+		float64(m.deltaNanos.Load())/float64(time.Second))
+	out.gauge("onemount_delta_last_cycle_seconds", "Duration of the last cycle fetching and applying remote changes.",
+		time.Duration(m.lastDeltaNanos.Load()).Seconds())
+
+	if f.content != nil {
+		out.gauge("onemount_cache_size_bytes", "Size of the content cache.", float64(f.content.GetCacheSize()))
+		out.gauge("onemount_cache_limit_bytes", "Size limit of the content cache, 0 when unlimited.", float64(f.content.GetMaxCacheSize()))
+	}
+	offline := 0.0
+	if f.IsOffline() {
+		offline = 1
+	}
+	out.gauge("onemount_offline", "1 while OneDrive cannot be reached.", offline)
+	return out.flush()
+}
+
+// metricsWriter writes metrics in the Prometheus text format, keeping the
+// first error.
+type metricsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (m *metricsWriter) gauge(name, help string, value float64) {
+	m.labeled(name, "gauge", help, "", map[string]float64{"": value})
+}
+
+func (m *metricsWriter) counter(name, help string, value float64) {
+	m.labeled(name, "counter", help, "", map[string]float64{"": value})
+}
+
+// labeled writes a metric with one sample per value of label; an empty label
+// writes a single sample without labels.
+func (m *metricsWriter) labeled(name, kind, help, label string, values map[string]float64) {
+	if m.err != nil {
+		return
+	}
+	_, m.err = fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if m.err != nil {
+			return
+		}
+		value := strconv.FormatFloat(values[key], 'g', -1, 64)
+		if label == "" {
+			_, m.err = fmt.Fprintf(m.w, "%s %s\n", name, value)
+		} else {
+			_, m.err = fmt.Fprintf(m.w, "%s{%s=%q} %s\n", name, label, key, value)
+		}
+	}
+}
+
+func (m *metricsWriter) flush() error {
+	if m.err != nil {
+		return m.err
+	}
+	return m.w.Flush()
+}
@@ -0,0 +1,89 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_Metrics_ParseAddressOnlyAllowsLoopback(t *testing.T) {
+	for address, network := range map[string]string{
+		"localhost:9464":      "tcp",
+		"127.0.0.1:9464":      "tcp",
+		"[::1]:9464":          "tcp",
+		"unix:/run/user/1/om": "unix",
+	} {
+		got, _, err := ParseMetricsAddress(address)
+		require.NoError(t, err, address)
+		require.Equal(t, network, got, address)
+	}
+	for _, address := range []string{":9464", "0.0.0.0:9464", "192.168.1.2:9464", "example.com:9464", "localhost", "localhost:http", "unix:"} {
+		_, _, err := ParseMetricsAddress(address)
+		require.Error(t, err, address)
+	}
+}
+
+func TestUT_FS_Metrics_WritesCountersAndGauges(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	require.NoError(t, fs.content.Insert("a", []byte("12345")))
+	fs.metrics.recordActivity(ActivityUploaded)
+	fs.metrics.recordActivity(ActivityHydrated)
+	fs.metrics.recordActivity(ActivityHydrated)
+	fs.metrics.recordActivity(ActivityConflict)
+	fs.metrics.recordDeltaCycle(1500 * time.Millisecond)
+	fs.metrics.recordDeltaCycle(500 * time.Millisecond)
+	fs.uploads.sessions["a"] = &UploadSession{ID: "a"}
+
+	var out strings.Builder
+	require.NoError(t, fs.WriteMetrics(&out))
+	text := out.String()
+	for _, line := range []string{
+		"# TYPE onemount_uploads_total counter",
+		"onemount_uploads_total 1\n",
+		"onemount_downloads_total 2\n",
+		"onemount_delta_cycles_total 2\n",
+		"onemount_delta_cycle_seconds_total 2\n",
+		"onemount_delta_last_cycle_seconds 0.5\n",
+		"# TYPE onemount_cache_size_bytes gauge",
+		"onemount_cache_size_bytes 5\n",
+		`onemount_upload_sessions{state="not_started"} 1` + "\n",
+		`onemount_upload_sessions{state="errored"} 0` + "\n",
+		"onemount_hydration_queue_depth 0\n",
+		"onemount_offline 0\n",
+	} {
+		require.Contains(t, text, line)
+	}
+}
+
+func TestUT_FS_Metrics_ServesOnUnixSocketUntilStopped(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.ctx, fs.cancel = context.WithCancel(context.Background())
+	socket := filepath.Join(t.TempDir(), "metrics.sock")
+	require.NoError(t, fs.StartMetricsServer("unix:"+socket))
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://onemount/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, metricsContentType, resp.Header.Get("Content-Type"))
+	require.Contains(t, string(body), "onemount_uploads_total 0")
+
+	fs.cancel()
+	fs.Wg.Wait()
+	client.CloseIdleConnections()
+	_, err = client.Get("http://onemount/metrics")
+	require.Error(t, err, "the server stops with the filesystem")
+}
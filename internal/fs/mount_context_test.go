@@ -0,0 +1,172 @@
+package fs
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// hangingTransport holds every request until its context ends, like a Graph
+// endpoint that stopped answering.
+type hangingTransport struct {
+	started chan string
+}
+
+func (h hangingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	select {
+	case h.started <- request.URL.Path:
+	default:
+	}
+	<-request.Context().Done()
+	return nil, request.Context().Err()
+}
+
+// useHangingGraph routes Graph requests to a hangingTransport for the test.
+func useHangingGraph(t *testing.T) (chan string, *graph.Auth) {
+	t.Helper()
+	started := make(chan string, 16)
+	graph.SetHTTPClient(&http.Client{Transport: hangingTransport{started: started}})
+	t.Cleanup(func() { graph.SetHTTPClient(nil) })
+	return started, &graph.Auth{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+}
+
+// withMountContext gives the filesystem a cancellable mount context.
+func withMountContext(fs *Filesystem) context.CancelFunc {
+	fs.ctx, fs.cancel = context.WithCancel(context.Background())
+	return fs.cancel
+}
+
+// waitForRequest waits for the hanging transport to receive a request.
+func waitForRequest(t *testing.T, started chan string) {
+	t.Helper()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no Graph request was made")
+	}
+}
+
+// requireNoGoroutineLeak waits for the goroutine count to drop back to
+// baseline.
+func requireNoGoroutineLeak(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines left running, expected at most %d:\n%s",
+				runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUT_FS_MountContext_UnmountCancelsChildRefresh(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	cancel := withMountContext(fs)
+	started, auth := useHangingGraph(t)
+	dir := NewInode("Documents", fuse.S_IFDIR|0755, nil)
+	dir.DriveItem.ID = "dir-refresh"
+	registerHydratedEntry(t, fs, dir)
+	baseline := runtime.NumGoroutine()
+
+	fs.refreshChildrenAsync(dir.ID(), auth)
+	waitForRequest(t, started)
+
+	stopped := time.Now()
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		fs.Wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the background refresh did not stop on unmount")
+	}
+	require.Less(t, time.Since(stopped), time.Second)
+	_, refreshing := fs.metadataRefresh.Load(dir.ID())
+	require.False(t, refreshing)
+	requireNoGoroutineLeak(t, baseline)
+
+	fs.refreshChildrenAsync(dir.ID(), auth)
+	_, refreshing = fs.metadataRefresh.Load(dir.ID())
+	require.False(t, refreshing, "no refresh starts once unmounting")
+}
+
+func TestUT_FS_MountContext_UnmountCancelsQueuedMetadataRequests(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	cancel := withMountContext(fs)
+	started, auth := useHangingGraph(t)
+	baseline := runtime.NumGoroutine()
+
+	manager := NewMetadataRequestManager(fs, 2, 10, 10)
+	manager.Start()
+	results := make(chan error, 2)
+	callback := func(_ []*graph.DriveItem, err error) { results <- err }
+	require.NoError(t, manager.QueueChildrenRequest("dir-foreground", auth, PriorityForeground, callback))
+	waitForRequest(t, started)
+
+	stopped := time.Now()
+	cancel()
+	select {
+	case err := <-results:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("the in-flight request did not end on unmount")
+	}
+
+	// Requests queued after the mount stopped fail without reaching Graph
+	require.NoError(t, manager.QueueChildrenRequest("dir-background", auth, PriorityBackground, callback))
+	select {
+	case err := <-results:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("the queued request was not failed")
+	}
+	require.Empty(t, started, "no request is made once unmounting")
+
+	manager.Stop()
+	require.Less(t, time.Since(stopped), 2*time.Second)
+	requireNoGoroutineLeak(t, baseline)
+}
+
+func TestUT_FS_MountContext_NoAutoHydrationAfterUnmount(t *testing.T) {
+	fs := setupEvictionTestFS(t, 0)
+	cancel := withMountContext(fs)
+	parent := NewInode("parent", fuse.S_IFDIR|0755, nil)
+	parent.DriveItem.ID = "parent"
+	registerHydratedEntry(t, fs, parent)
+	pinned := NewInode("pinned.txt", fuse.S_IFREG|0644, parent)
+	pinned.DriveItem.ID = "file-pinned-unmount"
+	registerHydratedEntry(t, fs, pinned)
+	_, err := fs.UpdateMetadataEntry(pinned.ID(), func(entry *metadata.Entry) error {
+		entry.Pin.Mode = metadata.PinModeAlways
+		entry.ItemType = metadata.ItemKindFile
+		return nil
+	})
+	require.NoError(t, err)
+
+	requested := 0
+	fs.SetTestHooks(&FilesystemTestHooks{
+		AutoHydrateHook: func(_ *Filesystem, id string) bool {
+			requested++
+			return true
+		},
+	})
+	defer fs.ClearTestHooks()
+
+	fs.autoHydratePinned(pinned.ID())
+	require.Equal(t, 1, requested)
+	cancel()
+	fs.autoHydratePinned(pinned.ID())
+	require.Equal(t, 1, requested, "pinned files are not queued once unmounting")
+}
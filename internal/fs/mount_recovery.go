@@ -0,0 +1,36 @@
+package fs
+
+import (
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// The kernel aborts a FUSE connection when someone writes to
+// /sys/fs/fuse/connections/N/abort, or when a request crashes or the system
+// runs out of memory. Serving then ends but the mountpoint stays, answering
+// every access with "Transport endpoint is not connected". The process
+// notices, saves what it holds in memory and mounts the same filesystem
+// again at the same mountpoint (see cmd/onemount); the items, caches and
+// queues survive, only what the kernel cached is lost.
+
+// SaveState writes what the mount keeps in memory to the database without
+// stopping anything, so that nothing is lost if the process dies next.
+func (f *Filesystem) SaveState() {
+	f.flushUsage()
+	f.flushAccessTimes()
+	f.saveMetadataSnapshot()
+	if f.db != nil {
+		if err := f.db.Sync(); err != nil {
+			logging.Warn().Err(err).Msg("Failed to sync database")
+		}
+	}
+}
+
+// ReportMountEvent records what happened to the connection with the kernel
+// as an activity event, and shows it as a desktop notification as well when
+// desktop is set.
+func (f *Filesystem) ReportMountEvent(message string, desktop bool) {
+	f.emitActivity(ActivityMount, "", message)
+	if desktop && f.dbusServer != nil {
+		f.dbusServer.SendDesktopNotification("OneDrive mount", message)
+	}
+}
@@ -0,0 +1,105 @@
+package fs
+
+import (
+	"errors"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/auriora/onemount/internal/util"
+)
+
+// MountSettings are the settings a running mount applies without being
+// remounted. The launcher changes them by rewriting the configuration and
+// calling the ReloadSettings D-Bus method.
+type MountSettings struct {
+	DeltaInterval       time.Duration
+	CacheExpirationDays int
+	BandwidthLimit      int64 // bytes per second for uploads and downloads together, 0 for no limit
+	OverlayPolicy       metadata.OverlayPolicy
+	MaxCacheSize        int64           // content cache limit in bytes, 0 for no limit
+	CacheQuota          bool            // MaxCacheSize is this mount's own, not shared with other mounts
+	Features            map[string]bool // feature flags by name, see features.go
+}
+
+// ApplySettings changes the settings of the running mount. A zero delta
+// interval keeps the current one.
+func (f *Filesystem) ApplySettings(s MountSettings) {
+	f.settingsM.Lock()
+	if s.DeltaInterval > 0 {
+		f.deltaInterval = s.DeltaInterval
+	}
+	f.cacheExpirationDays = s.CacheExpirationDays
+	f.settingsM.Unlock()
+
+	f.SetDefaultOverlayPolicy(s.OverlayPolicy)
+	f.SetBandwidthLimit(s.BandwidthLimit)
+	f.SetFeatures(s.Features)
+	if f.content != nil {
+		f.content.SetCacheLimit(s.MaxCacheSize, s.CacheQuota, f.cacheLedgerDir)
+	}
+	// Expiration enabled while mounted starts the cleanup routine; turned
+	// off, the routine keeps running without removing anything.
+	f.StartCacheCleanup()
+
+	logging.Info().
+		Dur("deltaInterval", s.DeltaInterval).
+		Int("cacheExpirationDays", s.CacheExpirationDays).
+		Int64("bandwidthLimit", s.BandwidthLimit).
+		Str("overlayPolicy", string(s.OverlayPolicy)).
+		Int64("maxCacheSize", s.MaxCacheSize).
+		Bool("cacheQuota", s.CacheQuota).
+		Msg("Applied mount settings")
+}
+
+// SetBandwidthLimit limits uploads and downloads together to bytesPerSecond,
+// or removes the limit when it is 0.
+func (f *Filesystem) SetBandwidthLimit(bytesPerSecond int64) {
+	if bytesPerSecond <= 0 {
+		f.bandwidth.Store(nil)
+		return
+	}
+	f.bandwidth.Store(util.NewBandwidthThrottler(bytesPerSecond))
+}
+
+// throttleTransfer waits until n more transferred bytes fit the bandwidth
+// limit.
+func (f *Filesystem) throttleTransfer(n uint64) {
+	if throttler := f.bandwidth.Load(); throttler != nil {
+		_ = throttler.Wait(f.jobContext(), int64(n))
+	}
+}
+
+// SetSettingsReloader installs the function ReloadSettings calls to read the
+// settings again, usually from the configuration file.
+func (f *Filesystem) SetSettingsReloader(reload func() error) {
+	f.settingsM.Lock()
+	f.settingsReload = reload
+	f.settingsM.Unlock()
+}
+
+// ReloadSettings reads the mount's settings again and applies them.
+func (f *Filesystem) ReloadSettings() error {
+	f.settingsM.RLock()
+	reload := f.settingsReload
+	f.settingsM.RUnlock()
+	if reload == nil {
+		return errors.New("this mount cannot reload its settings")
+	}
+	return reload()
+}
+
+// cacheExpiration returns the number of days after which cached content
+// expires, 0 or less for never.
+func (f *Filesystem) cacheExpiration() int {
+	f.settingsM.RLock()
+	defer f.settingsM.RUnlock()
+	return f.cacheExpirationDays
+}
+
+// overlayPolicyDefault returns the overlay policy of new metadata entries.
+func (f *Filesystem) overlayPolicyDefault() metadata.OverlayPolicy {
+	f.settingsM.RLock()
+	defer f.settingsM.RUnlock()
+	return f.defaultOverlayPolicy
+}
@@ -0,0 +1,57 @@
+package fs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_MountSettings_ApplyWhileMounted(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+
+	fs.ApplySettings(MountSettings{
+		DeltaInterval: 90 * time.Second,
+		OverlayPolicy: metadata.OverlayPolicyLocalWins,
+	})
+	require.Equal(t, 90*time.Second, fs.desiredDeltaInterval())
+	require.Equal(t, 0, fs.cacheExpiration())
+	require.Equal(t, metadata.OverlayPolicyLocalWins, fs.overlayPolicyDefault())
+	require.Nil(t, fs.bandwidth.Load(), "no limit without a bandwidth setting")
+
+	// A zero interval keeps the current one
+	fs.ApplySettings(MountSettings{OverlayPolicy: metadata.OverlayPolicyLocalWins})
+	require.Equal(t, 90*time.Second, fs.desiredDeltaInterval())
+}
+
+func TestUT_FS_MountSettings_BandwidthLimitHoldsTransfersBack(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.SetBandwidthLimit(1000)
+
+	start := time.Now()
+	fs.recordTransfer(0, 500)
+	require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	fs.SetBandwidthLimit(0)
+	start = time.Now()
+	fs.recordTransfer(0, 500)
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestUT_FS_MountSettings_ReloadUsesInstalledReloader(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	require.Error(t, fs.ReloadSettings(), "nothing to reload from")
+
+	reloads := 0
+	fs.SetSettingsReloader(func() error {
+		reloads++
+		return nil
+	})
+	require.NoError(t, fs.ReloadSettings())
+	require.Equal(t, 1, reloads)
+
+	fs.SetSettingsReloader(func() error { return errors.New("bad config") })
+	require.EqualError(t, fs.ReloadSettings(), "bad config")
+}
@@ -70,7 +70,7 @@ func (f *Filesystem) queueRemoteDirCreate(parentID, tempID, name string) {
 	}
 
 	work := func() error {
-		item, err := graph.Mkdir(name, parentID, f.auth)
+		item, err := graph.MkdirWithContext(f.mountContext(), name, parentID, f.auth)
 		if err != nil {
 			return err
 		}
@@ -89,15 +89,20 @@ func (f *Filesystem) queueRemoteDelete(id string) {
 		return
 	}
 	f.runMutationWithRetry("delete", id, func() error {
-		if err := graph.Remove(id, f.auth); err != nil {
-			return err
-		}
-		f.clearChildPendingRemote(id)
-		f.transitionItemState(id, metadata.ItemStateDeleted)
-		return nil
+		return f.remoteDelete(id)
 	})
 }
 
+// remoteDelete deletes the item on OneDrive and records the deletion.
+func (f *Filesystem) remoteDelete(id string) error {
+	if err := graph.RemoveWithContext(f.mountContext(), id, f.auth); err != nil {
+		return err
+	}
+	f.clearChildPendingRemote(id)
+	f.transitionItemState(id, metadata.ItemStateDeleted)
+	return nil
+}
+
 // queueRemoteDeleteTestHook runs a remote delete synchronously for tests, ensuring state transition to DELETED.
 func (f *Filesystem) queueRemoteDeleteTestHook(id string) error {
 	if id == "" || isLocalID(id) {
@@ -182,7 +187,7 @@ func (f *Filesystem) queueRemoteRename(remoteID, newParentID, newName string) {
 		return
 	}
 	f.runMutationWithRetry("rename", remoteID, func() error {
-		if err := graph.Rename(remoteID, newName, newParentID, f.auth); err != nil {
+		if err := graph.RenameWithContext(f.mountContext(), remoteID, newName, newParentID, f.auth); err != nil {
 			return err
 		}
 		f.markHydratedState(remoteID)
@@ -209,7 +214,7 @@ func (f *Filesystem) promoteTempInode(tempID string, remoteItem *graph.DriveItem
 
 	promoted.mu.Lock()
 	promoted.DriveItem.ID = remoteItem.ID
-	promoted.DriveItem.Name = remoteItem.Name
+	promoted.DriveItem.Name = f.normalizeName(remoteItem.Name)
 	promoted.DriveItem.Parent = remoteItem.Parent
 	promoted.DriveItem.ETag = remoteItem.ETag
 	promoted.DriveItem.Size = remoteItem.Size
@@ -0,0 +1,190 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The same name can be spelled in two Unicode forms: files from macOS and
+// some tools use decomposed names (NFD), Linux programs and OneDrive mostly
+// the composed form (NFC). With the NFC policy, the default, names are
+// converted to NFC where they enter the mount: in FUSE requests naming an
+// entry, in paths looked up for D-Bus and the command line, and in the items
+// listed or changed on OneDrive. A program then finds "café" however it
+// spells it and a folder does not show two entries that look the same.
+//
+// A cache filled before the policy, or under the "none" policy, can still
+// hold NFD names. MigrateNameNormalization converts those locally, once per
+// cache, and reports the names it cannot convert because a sibling already
+// has the same NFC name; the policy that the cache was last migrated to is
+// kept in the version bucket.
+
+// Name normalization policies of the nameNormalization setting.
+const (
+	NameNormalizationNFC  = "nfc"  // convert names to NFC
+	NameNormalizationNone = "none" // keep names as they are spelled
+)
+
+// nameNormalizationKey is the key in bucketVersion holding the policy the
+// cached names were migrated to.
+var nameNormalizationKey = []byte("nameNormalization")
+
+// NameNormalizationReport is the outcome of MigrateNameNormalization.
+type NameNormalizationReport struct {
+	Checked    int      // names in the metadata store
+	Normalized int      // names converted to NFC
+	Collisions []string // paths left as they are because a sibling has the same NFC name
+}
+
+// ValidateNameNormalization checks a nameNormalization setting.
+func ValidateNameNormalization(policy string) error {
+	switch policy {
+	case NameNormalizationNFC, NameNormalizationNone:
+		return nil
+	}
+	return errors.NewValidationError("nameNormalization must be nfc or none, got "+policy, nil)
+}
+
+// SetNameNormalization sets how names entering the mount are normalized.
+func (f *Filesystem) SetNameNormalization(policy string) error {
+	if err := ValidateNameNormalization(policy); err != nil {
+		return err
+	}
+	f.nfcNames.Store(policy == NameNormalizationNFC)
+	return nil
+}
+
+// normalizeName returns name as the mount stores it under the name
+// normalization policy.
+func (f *Filesystem) normalizeName(name string) string {
+	if !f.nfcNames.Load() {
+		return name
+	}
+	return norm.NFC.String(name)
+}
+
+// MigrateNameNormalization converts the NFD names in the metadata store to
+// NFC when the cache was not migrated to the NFC policy yet. The cache is
+// marked as migrated once no collisions are left, so that they are reported
+// on every start until they are resolved. Under the "none" policy it only
+// clears the mark, as names may be stored in either form from then on.
+func (f *Filesystem) MigrateNameNormalization() (NameNormalizationReport, error) {
+	var report NameNormalizationReport
+	if f.db == nil || f.metadataStore == nil {
+		return report, nil
+	}
+	if !f.nfcNames.Load() {
+		err := f.db.Update(func(tx *bolt.Tx) error {
+			if version := tx.Bucket(bucketVersion); version != nil {
+				return version.Delete(nameNormalizationKey)
+			}
+			return nil
+		})
+		return report, errors.Wrap(err, "failed to record the name normalization")
+	}
+
+	migrated := false
+	entries := make(map[string]*metadata.Entry)
+	err := f.db.View(func(tx *bolt.Tx) error {
+		if version := tx.Bucket(bucketVersion); version != nil {
+			migrated = string(version.Get(nameNormalizationKey)) == NameNormalizationNFC
+		}
+		bucket := tx.Bucket(bucketMetadataV2)
+		if migrated || bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var entry metadata.Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return nil
+			}
+			entries[entry.ID] = &entry
+			return nil
+		})
+	})
+	if err != nil || migrated {
+		return report, errors.Wrap(err, "failed to read metadata entries")
+	}
+
+	// Names each folder holds once normalized, to find the collisions
+	siblings := make(map[string]int)
+	siblingKey := func(entry *metadata.Entry) string {
+		return entry.ParentID + "/" + strings.ToLower(norm.NFC.String(entry.Name))
+	}
+	for _, entry := range entries {
+		if entry.ParentID != "" && entry.State != metadata.ItemStateDeleted {
+			siblings[siblingKey(entry)]++
+		}
+	}
+
+	ctx := context.Background()
+	var collisions []*metadata.Entry
+	for _, entry := range entries {
+		if entry.ParentID == "" || entry.State == metadata.ItemStateDeleted {
+			continue
+		}
+		report.Checked++
+		if norm.NFC.IsNormalString(entry.Name) {
+			continue
+		}
+		if siblings[siblingKey(entry)] > 1 {
+			collisions = append(collisions, entry)
+			continue
+		}
+		name := norm.NFC.String(entry.Name)
+		if _, err := f.metadataStore.Update(ctx, entry.ID, func(e *metadata.Entry) error {
+			e.Name = name
+			return nil
+		}); err != nil {
+			return report, errors.Wrap(err, "failed to normalize the name of "+entry.ID)
+		}
+		if inode, ok := f.metadata.Load(entry.ID); ok {
+			inode.(*Inode).SetName(name)
+		}
+		entry.Name = name
+		report.Normalized++
+	}
+	// Paths are taken once the folders holding the collisions are converted
+	for _, entry := range collisions {
+		p, _ := policyEntryPath(entries, entry)
+		report.Collisions = append(report.Collisions, p)
+	}
+
+	if report.Normalized > 0 {
+		logging.Info().Int("names", report.Normalized).Msg("Converted cached names to NFC")
+	}
+	sort.Strings(report.Collisions)
+	f.Lock()
+	f.nameCollisions = report.Collisions
+	f.Unlock()
+	if len(report.Collisions) > 0 {
+		logging.Warn().Strs("paths", report.Collisions).
+			Msg("Some names differ from a sibling only in their Unicode form and are shadowed by it, " +
+				"rename them on OneDrive or mount with nameNormalization: none")
+		return report, nil
+	}
+	err = f.db.Update(func(tx *bolt.Tx) error {
+		version, err := tx.CreateBucketIfNotExists(bucketVersion)
+		if err != nil {
+			return err
+		}
+		return version.Put(nameNormalizationKey, []byte(NameNormalizationNFC))
+	})
+	return report, errors.Wrap(err, "failed to record the name normalization")
+}
+
+// NameCollisions returns the cached names MigrateNameNormalization could not
+// convert to NFC because a sibling has the same NFC name.
+func (f *Filesystem) NameCollisions() []string {
+	f.RLock()
+	defer f.RUnlock()
+	return f.nameCollisions
+}
@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_NameNormalization_NormalizeName(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	require.Equal(t, "Cafe\u0301.txt", fs.normalizeName("Cafe\u0301.txt"), "names are kept until a policy is set")
+
+	require.NoError(t, fs.SetNameNormalization(NameNormalizationNFC))
+	require.Equal(t, "Caf\u00e9.txt", fs.normalizeName("Cafe\u0301.txt"))
+	require.Equal(t, "Caf\u00e9.txt", fs.normalizeName("Caf\u00e9.txt"))
+
+	require.NoError(t, fs.SetNameNormalization(NameNormalizationNone))
+	require.Equal(t, "Cafe\u0301.txt", fs.normalizeName("Cafe\u0301.txt"))
+	require.Error(t, fs.SetNameNormalization("nfd"))
+}
+
+func TestUT_FS_NameNormalization_MigratesCachedNames(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	ctx := context.Background()
+	save := func(id, parentID, name string, kind metadata.ItemKind) {
+		require.NoError(t, fs.metadataStore.Save(ctx, &metadata.Entry{
+			ID:        id,
+			ParentID:  parentID,
+			Name:      name,
+			ItemType:  kind,
+			State:     metadata.ItemStateHydrated,
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+		}))
+	}
+	save("root", "", "root", metadata.ItemKindDirectory)
+	save("docs", "root", "Re\u0301sume\u0301s", metadata.ItemKindDirectory)
+	save("cafe-nfd", "docs", "Cafe\u0301.txt", metadata.ItemKindFile)
+	save("cafe-nfc", "docs", "Caf\u00e9.txt", metadata.ItemKindFile)
+	save("notes", "root", "notes.txt", metadata.ItemKindFile)
+	require.NoError(t, fs.SetNameNormalization(NameNormalizationNFC))
+
+	report, err := fs.MigrateNameNormalization()
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Checked)
+	require.Equal(t, 1, report.Normalized)
+	require.Equal(t, []string{"/R\u00e9sum\u00e9s/Cafe\u0301.txt"}, report.Collisions)
+	require.Equal(t, report.Collisions, fs.NameCollisions())
+
+	entry, err := fs.metadataStore.Get(ctx, "docs")
+	require.NoError(t, err)
+	require.Equal(t, "R\u00e9sum\u00e9s", entry.Name)
+	entry, err = fs.metadataStore.Get(ctx, "cafe-nfd")
+	require.NoError(t, err)
+	require.Equal(t, "Cafe\u0301.txt", entry.Name, "a name shadowed by its NFC sibling is left as it is")
+
+	// Collisions keep the cache unmarked so they are reported again
+	report, err = fs.MigrateNameNormalization()
+	require.NoError(t, err)
+	require.Zero(t, report.Normalized)
+	require.Len(t, report.Collisions, 1)
+
+	_, err = fs.metadataStore.Update(ctx, "cafe-nfd", func(e *metadata.Entry) error {
+		e.Name = "Cafe\u0301 (2).txt"
+		return nil
+	})
+	require.NoError(t, err)
+	report, err = fs.MigrateNameNormalization()
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Normalized)
+	require.Empty(t, report.Collisions)
+	report, err = fs.MigrateNameNormalization()
+	require.NoError(t, err)
+	require.Zero(t, report.Checked, "a migrated cache is not scanned again")
+}
@@ -0,0 +1,317 @@
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	bolt "go.etcd.io/bbolt"
+)
+
+// bbolt relies on file locks and mmap, which NFS, SMB and other network
+// filesystems do not provide reliably: a database there gets stuck on its
+// lock or corrupted. The cache directory's filesystem is checked when the
+// filesystem is created, and the network cache policy decides what happens
+// when it is a network filesystem: keep the database in memory (the
+// default), warn and use it anyway, or refuse to start. In memory the database lives in a tmpfs
+// directory and is written to MetadataSnapshotName in the cache directory as
+// JSON every few minutes and on shutdown, and read back from there on the next
+// start. Content and thumbnails stay in the cache directory in every case.
+
+// NetworkCachePolicy says what to do with a cache directory on a network
+// filesystem.
+type NetworkCachePolicy string
+
+// Network cache policies.
+const (
+	NetworkCacheRefuse NetworkCachePolicy = "refuse"
+	NetworkCacheWarn   NetworkCachePolicy = "warn"
+	NetworkCacheMemory NetworkCachePolicy = "memory"
+)
+
+// MetadataSnapshotName is the file in the cache directory holding the
+// metadata of a mount whose database is kept in memory.
+const MetadataSnapshotName = "metadata-snapshot.json"
+
+const metadataSnapshotInterval = 5 * time.Minute
+
+// networkFilesystems are the statfs magic numbers of network filesystems.
+var networkFilesystems = map[int64]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x5346414f: "afs",
+	0x00c36400: "ceph",
+	0x01021997: "9p",
+	0x0bd00bd0: "lustre",
+	0x47504653: "gpfs",
+	0x01161970: "gfs2",
+	0x73757245: "coda",
+	0x564c:     "ncp",
+}
+
+// networkFilesystemType returns the name of the network filesystem holding
+// dir, or "" when it is local or cannot be determined.
+var networkFilesystemType = func(dir string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	return networkFilesystems[int64(uint32(st.Type))]
+}
+
+// metadataSnapshot saves the in-memory database of a mount to the cache
+// directory.
+type metadataSnapshot struct {
+	mu        sync.Mutex
+	path      string // snapshot in the cache directory
+	memoryDir string // tmpfs directory holding the database
+}
+
+// metadataDBPath returns where the database of cacheDir is opened under the
+// given policy, and, for a database kept in memory, the snapshot it is saved
+// to. An empty or unknown policy keeps the database in memory.
+func metadataDBPath(cacheDir string, policy NetworkCachePolicy) (dbPath string, snapshot *metadataSnapshot, err error) {
+	dbPath = filepath.Join(cacheDir, "onemount.db")
+	fsType := networkFilesystemType(cacheDir)
+	if fsType == "" {
+		return dbPath, nil, nil
+	}
+	switch policy {
+	case NetworkCacheWarn:
+		logging.Warn().Str("cacheDir", cacheDir).Str("filesystem", fsType).
+			Msg("Cache directory is on a network filesystem, the metadata database may get stuck or corrupted")
+		return dbPath, nil, nil
+	case NetworkCacheRefuse:
+		return "", nil, errors.NewValidationError("the cache directory "+cacheDir+" is on a "+fsType+
+			" network filesystem, where the metadata database gets stuck or corrupted; set cacheDir to a local "+
+			"directory, or set networkCache to \"memory\" to keep metadata in memory or \"warn\" to use it anyway", nil)
+	default:
+		memoryDir, err := os.MkdirTemp(memoryTempDir(), "onemount-metadata-")
+		if err != nil {
+			return "", nil, errors.Wrap(err, "could not create in-memory metadata directory")
+		}
+		snapshot = &metadataSnapshot{
+			path:      filepath.Join(cacheDir, MetadataSnapshotName),
+			memoryDir: memoryDir,
+		}
+		dbPath = filepath.Join(memoryDir, "onemount.db")
+		if err := snapshot.restore(dbPath); err != nil {
+			os.RemoveAll(memoryDir)
+			return "", nil, err
+		}
+		logging.Warn().Str("cacheDir", cacheDir).Str("filesystem", fsType).Str("snapshot", snapshot.path).
+			Msg("Cache directory is on a network filesystem, keeping metadata in memory with periodic snapshots")
+		return dbPath, snapshot, nil
+	}
+}
+
+// memoryTempDir returns a memory-backed directory for temporary files.
+func memoryTempDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// snapshotBucket is a bucket of a metadata snapshot. Keys and values are
+// bytes, which JSON encodes as base64.
+type snapshotBucket struct {
+	Name    []byte            `json:"name"`
+	Entries []snapshotEntry   `json:"entries,omitempty"`
+	Buckets []*snapshotBucket `json:"buckets,omitempty"`
+}
+
+type snapshotEntry struct {
+	Key   []byte `json:"k"`
+	Value []byte `json:"v"`
+}
+
+func dumpBucket(name []byte, b *bolt.Bucket) *snapshotBucket {
+	dump := &snapshotBucket{Name: append([]byte(nil), name...)}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v == nil {
+			if nested := b.Bucket(k); nested != nil {
+				dump.Buckets = append(dump.Buckets, dumpBucket(k, nested))
+				continue
+			}
+		}
+		dump.Entries = append(dump.Entries, snapshotEntry{
+			Key:   append([]byte(nil), k...),
+			Value: append([]byte(nil), v...),
+		})
+	}
+	return dump
+}
+
+func loadBucket(b *bolt.Bucket, dump *snapshotBucket) error {
+	for _, entry := range dump.Entries {
+		if err := b.Put(entry.Key, entry.Value); err != nil {
+			return err
+		}
+	}
+	for _, nested := range dump.Buckets {
+		child, err := b.CreateBucketIfNotExists(nested.Name)
+		if err != nil {
+			return err
+		}
+		if err := loadBucket(child, nested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errUnreadableSnapshot is returned by readMetadataSnapshot when the snapshot
+// is not valid JSON.
+var errUnreadableSnapshot = errors.New("unreadable metadata snapshot")
+
+// readMetadataSnapshot reads the buckets of the snapshot at path. The error
+// satisfies os.IsNotExist when there is no snapshot.
+func readMetadataSnapshot(path string) ([]*snapshotBucket, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var buckets []*snapshotBucket
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnreadableSnapshot, err)
+	}
+	return buckets, nil
+}
+
+// loadMetadataSnapshot creates the database at dbPath holding buckets.
+func loadMetadataSnapshot(dbPath string, buckets []*snapshotBucket) error {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return errors.Wrap(err, "could not create in-memory metadata database")
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, dump := range buckets {
+			b, err := tx.CreateBucketIfNotExists(dump.Name)
+			if err != nil {
+				return err
+			}
+			if err := loadBucket(b, dump); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// restore creates the database at dbPath from the snapshot, if there is one.
+func (s *metadataSnapshot) restore(dbPath string) error {
+	buckets, err := readMetadataSnapshot(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if errors.Is(err, errUnreadableSnapshot) {
+		// The metadata is rebuilt from OneDrive, only offline changes are lost.
+		logging.Warn().Err(err).Str("snapshot", s.path).Msg("Ignoring unreadable metadata snapshot")
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not read metadata snapshot")
+	}
+	return loadMetadataSnapshot(dbPath, buckets)
+}
+
+// save writes the database to the snapshot, replacing it atomically.
+func (s *metadataSnapshot) save(db *bolt.DB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var buckets []*snapshotBucket
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			buckets = append(buckets, dumpBucket(name, b))
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(buckets)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".metadata-snapshot-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// MetadataInMemory reports whether the metadata database is kept in memory
+// because the cache directory is on a network filesystem.
+func (f *Filesystem) MetadataInMemory() bool {
+	return f.metadataSnapshot != nil
+}
+
+// startMetadataSnapshots saves the in-memory database periodically.
+func (f *Filesystem) startMetadataSnapshots() {
+	if f.metadataSnapshot == nil {
+		return
+	}
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+		ticker := time.NewTicker(metadataSnapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := f.metadataSnapshot.save(f.db); err != nil {
+					logging.Warn().Err(err).Msg("Failed to save metadata snapshot")
+				}
+			}
+		}
+	}()
+}
+
+// saveMetadataSnapshot saves the in-memory database a last time before it is
+// closed.
+func (f *Filesystem) saveMetadataSnapshot() {
+	if f.metadataSnapshot == nil || f.db == nil {
+		return
+	}
+	if err := f.metadataSnapshot.save(f.db); err != nil {
+		logging.Error().Err(err).Str("snapshot", f.metadataSnapshot.path).
+			Msg("Failed to save metadata snapshot, changes since the last snapshot are lost")
+	}
+}
+
+// removeInMemoryMetadata removes the closed in-memory database.
+func (f *Filesystem) removeInMemoryMetadata() {
+	if f.metadataSnapshot != nil {
+		os.RemoveAll(f.metadataSnapshot.memoryDir)
+	}
+}
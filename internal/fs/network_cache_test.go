@@ -0,0 +1,109 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// onNetworkFilesystem makes every cache directory look like it is on NFS.
+func onNetworkFilesystem(t *testing.T) {
+	t.Helper()
+	detect := networkFilesystemType
+	networkFilesystemType = func(string) string { return "nfs" }
+	t.Cleanup(func() {
+		networkFilesystemType = detect
+	})
+}
+
+func TestUT_FS_NetworkCache_MemoryByDefault(t *testing.T) {
+	onNetworkFilesystem(t)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	dir := t.TempDir()
+	dbPath, snapshot, err := metadataDBPath(dir, "")
+	require.NoError(t, err, "existing caches on network filesystems keep mounting")
+	require.NotNil(t, snapshot)
+	defer os.RemoveAll(snapshot.memoryDir)
+	require.False(t, strings.HasPrefix(dbPath, dir))
+}
+
+func TestUT_FS_NetworkCache_RefuseIsOptIn(t *testing.T) {
+	onNetworkFilesystem(t)
+	_, _, err := metadataDBPath(t.TempDir(), NetworkCacheRefuse)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nfs")
+	require.Contains(t, err.Error(), "networkCache")
+}
+
+func TestUT_FS_NetworkCache_WarnKeepsDatabaseInCacheDir(t *testing.T) {
+	onNetworkFilesystem(t)
+	dir := t.TempDir()
+	dbPath, snapshot, err := metadataDBPath(dir, NetworkCacheWarn)
+	require.NoError(t, err)
+	require.Nil(t, snapshot)
+	require.Equal(t, filepath.Join(dir, "onemount.db"), dbPath)
+}
+
+func TestUT_FS_NetworkCache_MemorySnapshotRoundTrip(t *testing.T) {
+	onNetworkFilesystem(t)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	dir := t.TempDir()
+
+	dbPath, snapshot, err := metadataDBPath(dir, NetworkCacheMemory)
+	require.NoError(t, err)
+	require.NotNil(t, snapshot)
+	require.False(t, strings.HasPrefix(dbPath, dir), "the database must not be opened on the network filesystem")
+
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketMetadataV2)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("item"), []byte{0, 1, 0xff}); err != nil {
+			return err
+		}
+		nested, err := b.CreateBucketIfNotExists([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		return nested.Put([]byte("key"), []byte("value"))
+	}))
+	require.NoError(t, snapshot.save(db))
+	require.NoError(t, db.Close())
+	require.FileExists(t, filepath.Join(dir, MetadataSnapshotName))
+	require.NoError(t, os.RemoveAll(snapshot.memoryDir))
+
+	dbPath, snapshot, err = metadataDBPath(dir, NetworkCacheMemory)
+	require.NoError(t, err)
+	defer os.RemoveAll(snapshot.memoryDir)
+	db, err = bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMetadataV2)
+		require.NotNil(t, b)
+		require.Equal(t, []byte{0, 1, 0xff}, b.Get([]byte("item")))
+		nested := b.Bucket([]byte("nested"))
+		require.NotNil(t, nested)
+		require.Equal(t, []byte("value"), nested.Get([]byte("key")))
+		return nil
+	}))
+}
+
+func TestUT_FS_NetworkCache_UnreadableSnapshotStartsEmpty(t *testing.T) {
+	onNetworkFilesystem(t)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, MetadataSnapshotName), []byte("{truncated"), 0600))
+
+	_, snapshot, err := metadataDBPath(dir, NetworkCacheMemory)
+	require.NoError(t, err)
+	require.NoError(t, os.RemoveAll(snapshot.memoryDir))
+}
@@ -21,8 +21,7 @@ const (
 // See docs/guides/developer/concurrency-guidelines.md
 func (f *Filesystem) SetOfflineMode(mode OfflineMode) {
 	f.Lock()
-	defer f.Unlock()
-
+	wasOffline := f.offline
 	switch mode {
 	case OfflineModeDisabled:
 		f.offline = false
@@ -31,6 +30,16 @@ func (f *Filesystem) SetOfflineMode(mode OfflineMode) {
 		f.offline = true
 		logging.Info().Msg("Offline mode enabled")
 	}
+	offline := f.offline
+	f.Unlock()
+
+	if offline != wasOffline {
+		if offline {
+			f.emitActivity(ActivityOffline, "", "offline mode enabled")
+		} else {
+			f.emitActivity(ActivityOnline, "", "")
+		}
+	}
 }
 
 // GetOfflineMode returns the current offline mode
@@ -0,0 +1,38 @@
+package offline
+
+import (
+	"fmt"
+	"time"
+)
+
+// Change is a journal entry describing a change made while offline.
+type Change struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"` // "create", "modify", "delete", "rename", etc.
+	Timestamp time.Time `json:"timestamp"`
+	Path      string    `json:"path,omitempty"`
+	OldPath   string    `json:"old_path,omitempty"` // For rename operations
+	NewPath   string    `json:"new_path,omitempty"` // For rename operations
+	Phase     string    `json:"phase,omitempty"`    // Replay progress for multi-step changes
+
+	// Replay bookkeeping. Entries written before the state machine existed
+	// have no state and are treated as pending.
+	State     ReplayState `json:"state,omitempty"`
+	Attempts  int         `json:"attempts,omitempty"`
+	LastError string      `json:"last_error,omitempty"`
+	UpdatedAt *time.Time  `json:"updated_at,omitempty"`
+}
+
+// Key returns the journal key the change is stored under. Keys are prefixed
+// with the item ID so all changes for an item can be found with a prefix scan.
+func (c *Change) Key() []byte {
+	return []byte(fmt.Sprintf("%s-%d", c.ID, c.Timestamp.UnixNano()))
+}
+
+// CurrentState returns the change's replay state, defaulting to pending.
+func (c *Change) CurrentState() ReplayState {
+	if c.State == "" {
+		return StatePending
+	}
+	return c.State
+}
@@ -0,0 +1,265 @@
+package offline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNotFound indicates the journal has no entry for a change. It also
+// matches errors.ErrNotFound.
+var ErrNotFound = errors.NewKind("offline: journal entry not found", errors.ErrNotFound)
+
+// Clock abstracts time retrieval for deterministic testing.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Journal persists offline changes and their replay state in a BBolt bucket.
+type Journal struct {
+	db     *bolt.DB
+	bucket []byte
+	clock  Clock
+}
+
+// JournalOption customizes journal construction.
+type JournalOption func(*Journal)
+
+// WithClock overrides the default system clock.
+func WithClock(clock Clock) JournalOption {
+	return func(j *Journal) {
+		if clock != nil {
+			j.clock = clock
+		}
+	}
+}
+
+// NewJournal returns a journal backed by the provided bucket.
+func NewJournal(db *bolt.DB, bucket []byte, opts ...JournalOption) (*Journal, error) {
+	if db == nil {
+		return nil, fmt.Errorf("offline: bolt DB is required")
+	}
+	if len(bucket) == 0 {
+		return nil, fmt.Errorf("offline: bucket name is required")
+	}
+	j := &Journal{
+		db:     db,
+		bucket: bucket,
+		clock:  systemClock{},
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j, nil
+}
+
+// Record adds a new change to the journal in the pending state.
+func (j *Journal) Record(change *Change) error {
+	if change == nil || change.ID == "" {
+		return fmt.Errorf("offline: change requires an item ID")
+	}
+	if change.State == "" {
+		change.State = StatePending
+	}
+	if err := change.State.Validate(); err != nil {
+		return err
+	}
+	now := j.clock.Now()
+	change.UpdatedAt = &now
+	return j.put(change)
+}
+
+// Save persists replay progress (such as Phase) without changing state.
+func (j *Journal) Save(change *Change) error {
+	if change == nil {
+		return fmt.Errorf("offline: change is nil")
+	}
+	return j.put(change)
+}
+
+func (j *Journal) put(change *Change) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return j.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(j.bucket)
+		if err != nil {
+			return err
+		}
+		return b.Put(change.Key(), data)
+	})
+}
+
+// Get loads the stored copy of a change.
+func (j *Journal) Get(change *Change) (*Change, error) {
+	var stored *Change
+	err := j.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(j.bucket)
+		if b == nil {
+			return ErrNotFound
+		}
+		data := b.Get(change.Key())
+		if data == nil {
+			return ErrNotFound
+		}
+		stored = &Change{}
+		return json.Unmarshal(data, stored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// List returns every journal entry ordered by the time the change was made.
+func (j *Journal) List(ctx context.Context) ([]*Change, error) {
+	return j.list(ctx, func(*Change) bool { return true })
+}
+
+// Replayable returns the entries a replay should process, oldest first.
+func (j *Journal) Replayable(ctx context.Context) ([]*Change, error) {
+	return j.list(ctx, func(c *Change) bool { return c.CurrentState().Replayable() })
+}
+
+func (j *Journal) list(ctx context.Context, keep func(*Change) bool) ([]*Change, error) {
+	changes := make([]*Change, 0)
+	err := j.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(j.bucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			change := &Change{}
+			if err := json.Unmarshal(v, change); err != nil {
+				return err
+			}
+			if keep(change) {
+				changes = append(changes, change)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(changes, func(a, b int) bool {
+		return changes[a].Timestamp.Before(changes[b].Timestamp)
+	})
+	return changes, nil
+}
+
+// TransitionOption configures replay transition behavior.
+type TransitionOption func(*transitionConfig)
+
+type transitionConfig struct {
+	err error
+}
+
+// WithError records why an entry failed or conflicted.
+func WithError(err error) TransitionOption {
+	return func(cfg *transitionConfig) {
+		cfg.err = err
+	}
+}
+
+// Transition validates and persists a replay state change. The stored entry is
+// authoritative for the current state; change is updated in place on success.
+// Confirmed entries are removed from the journal.
+func (j *Journal) Transition(change *Change, to ReplayState, opts ...TransitionOption) error {
+	cfg := transitionConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return j.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(j.bucket)
+		if b == nil {
+			return ErrNotFound
+		}
+		key := change.Key()
+		data := b.Get(key)
+		if data == nil {
+			return ErrNotFound
+		}
+		stored := &Change{}
+		if err := json.Unmarshal(data, stored); err != nil {
+			return err
+		}
+		if err := validateTransition(stored.CurrentState(), to); err != nil {
+			return err
+		}
+
+		j.applyTransition(stored, to, cfg)
+		// Preserve replay progress recorded on the caller's copy.
+		stored.Phase = change.Phase
+		*change = *stored
+
+		if to == StateConfirmed {
+			return b.Delete(key)
+		}
+		updated, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, updated)
+	})
+}
+
+func (j *Journal) applyTransition(change *Change, to ReplayState, cfg transitionConfig) {
+	now := j.clock.Now()
+	change.State = to
+	change.UpdatedAt = &now
+
+	switch to {
+	case StateReplaying:
+		change.Attempts++
+	case StateFailed, StateConflicted:
+		if cfg.err != nil {
+			change.LastError = cfg.err.Error()
+		}
+	case StatePending, StateConfirmed:
+		change.LastError = ""
+	}
+}
+
+// HasChanges reports, for each item ID, whether the journal holds any entry
+// for it.
+func (j *Journal) HasChanges(ids []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		result[id] = false
+	}
+	err := j.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(j.bucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for _, id := range ids {
+			prefix := []byte(id + "-")
+			k, _ := c.Seek(prefix)
+			if k != nil && bytes.HasPrefix(k, prefix) {
+				result[id] = true
+			}
+		}
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,190 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var testBucket = []byte("offline_changes")
+
+func newTestJournal(t *testing.T) *Journal {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "journal.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	journal, err := NewJournal(db, testBucket)
+	if err != nil {
+		t.Fatalf("journal: %v", err)
+	}
+	return journal
+}
+
+func TestUT_Offline_JournalReplayLifecycle(t *testing.T) {
+	journal := newTestJournal(t)
+	change := &Change{ID: "item-1", Type: "modify", Timestamp: time.Now()}
+	if err := journal.Record(change); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if change.State != StatePending {
+		t.Fatalf("expected pending state, got %s", change.State)
+	}
+
+	if err := journal.Transition(change, StateReplaying); err != nil {
+		t.Fatalf("transition to replaying: %v", err)
+	}
+	if err := journal.Transition(change, StateFailed, WithError(errors.New("connection reset"))); err != nil {
+		t.Fatalf("transition to failed: %v", err)
+	}
+	stored, err := journal.Get(change)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stored.State != StateFailed || stored.LastError != "connection reset" || stored.Attempts != 1 {
+		t.Fatalf("expected failure recorded %+v", stored)
+	}
+
+	if err := journal.Transition(change, StateReplaying); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if err := journal.Transition(change, StateConfirmed); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if change.Attempts != 2 || change.LastError != "" {
+		t.Fatalf("expected two attempts and cleared error %+v", change)
+	}
+	if _, err := journal.Get(change); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected confirmed entry removed, got %v", err)
+	}
+}
+
+func TestUT_Offline_JournalRejectsInvalidTransition(t *testing.T) {
+	journal := newTestJournal(t)
+	change := &Change{ID: "item-2", Type: "delete", Timestamp: time.Now()}
+	if err := journal.Record(change); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if err := journal.Transition(change, StateConflicted); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected invalid transition error, got %v", err)
+	}
+	stored, err := journal.Get(change)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stored.State != StatePending {
+		t.Fatalf("expected state unchanged, got %s", stored.State)
+	}
+}
+
+func TestUT_Offline_JournalReplayableOrdering(t *testing.T) {
+	journal := newTestJournal(t)
+	base := time.Date(2025, time.November, 19, 10, 0, 0, 0, time.UTC)
+
+	changes := []*Change{
+		{ID: "c", Type: "modify", Timestamp: base.Add(2 * time.Minute)},
+		{ID: "a", Type: "create", Timestamp: base},
+		{ID: "b", Type: "rename", Timestamp: base.Add(time.Minute)},
+	}
+	for _, change := range changes {
+		if err := journal.Record(change); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	// b conflicts and is no longer replayed automatically.
+	if err := journal.Transition(changes[2], StateReplaying); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if err := journal.Transition(changes[2], StateConflicted); err != nil {
+		t.Fatalf("conflict: %v", err)
+	}
+
+	replayable, err := journal.Replayable(context.Background())
+	if err != nil {
+		t.Fatalf("replayable: %v", err)
+	}
+	if len(replayable) != 2 || replayable[0].ID != "a" || replayable[1].ID != "c" {
+		t.Fatalf("expected a, c in timestamp order, got %+v", replayable)
+	}
+
+	all, err := journal.List(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected conflicted entry kept, got %d entries", len(all))
+	}
+
+	has, err := journal.HasChanges([]string{"a", "b", "z"})
+	if err != nil {
+		t.Fatalf("has changes: %v", err)
+	}
+	if !has["a"] || !has["b"] || has["z"] {
+		t.Fatalf("unexpected HasChanges result %v", has)
+	}
+}
+
+func TestUT_Offline_LegacyEntriesArePending(t *testing.T) {
+	journal := newTestJournal(t)
+	ts := time.Now()
+	legacy := fmt.Sprintf(`{"id":"old","type":"modify","timestamp":%q}`, ts.Format(time.RFC3339Nano))
+	if err := journal.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(testBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(fmt.Sprintf("old-%d", ts.UnixNano())), []byte(legacy))
+	}); err != nil {
+		t.Fatalf("seed legacy entry: %v", err)
+	}
+
+	replayable, err := journal.Replayable(context.Background())
+	if err != nil {
+		t.Fatalf("replayable: %v", err)
+	}
+	if len(replayable) != 1 || replayable[0].CurrentState() != StatePending {
+		t.Fatalf("expected legacy entry to replay as pending, got %+v", replayable)
+	}
+	if err := journal.Transition(replayable[0], StateReplaying); err != nil {
+		t.Fatalf("transition legacy entry: %v", err)
+	}
+}
+
+func TestUT_Offline_StateTransitionTable(t *testing.T) {
+	type step struct {
+		from    ReplayState
+		to      ReplayState
+		allowed bool
+	}
+
+	table := []step{
+		{StatePending, StateReplaying, true},
+		{StatePending, StateConfirmed, true},
+		{StatePending, StateFailed, false},
+		{StatePending, StateConflicted, false},
+		{StateReplaying, StateConfirmed, true},
+		{StateReplaying, StateFailed, true},
+		{StateReplaying, StateConflicted, true},
+		{StateReplaying, StatePending, true},
+		{StateFailed, StateReplaying, true},
+		{StateFailed, StatePending, false},
+		{StateConflicted, StatePending, true},
+		{StateConflicted, StateReplaying, false},
+		{StateConfirmed, StatePending, false},
+		{StateConfirmed, StateReplaying, false},
+	}
+
+	for _, tc := range table {
+		if got := CanTransition(tc.from, tc.to); got != tc.allowed {
+			t.Fatalf("expected %s->%s allowed=%v, got %v", tc.from, tc.to, tc.allowed, got)
+		}
+	}
+}
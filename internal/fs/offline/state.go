@@ -0,0 +1,110 @@
+// Package offline records changes made while the filesystem is disconnected
+// and tracks their replay against OneDrive through an explicit state machine.
+package offline
+
+import (
+	"fmt"
+
+	"github.com/auriora/onemount/internal/errors"
+)
+
+// ErrInvalidTransition indicates an unsupported replay state change was
+// requested. It also matches errors.ErrInvalidTransition.
+var ErrInvalidTransition = errors.NewKind("offline: invalid replay state transition", errors.ErrInvalidTransition)
+
+// ReplayState is the lifecycle state of a journal entry.
+type ReplayState string
+
+const (
+	// StatePending entries are waiting to be replayed.
+	StatePending ReplayState = "PENDING"
+	// StateReplaying entries are being applied remotely. An entry still in
+	// this state after a restart was interrupted and is replayed again.
+	StateReplaying ReplayState = "REPLAYING"
+	// StateConfirmed entries were applied and verified remotely. They are
+	// removed from the journal as part of the transition.
+	StateConfirmed ReplayState = "CONFIRMED"
+	// StateFailed entries hit a transient error and are retried on the next
+	// replay.
+	StateFailed ReplayState = "FAILED"
+	// StateConflicted entries diverged from the server and need user action;
+	// they are kept for auditing but not replayed automatically.
+	StateConflicted ReplayState = "CONFLICTED"
+)
+
+var validReplayStates = map[ReplayState]struct{}{
+	StatePending:    {},
+	StateReplaying:  {},
+	StateConfirmed:  {},
+	StateFailed:     {},
+	StateConflicted: {},
+}
+
+// Validate ensures the provided state is one of the supported values.
+func (s ReplayState) Validate() error {
+	if _, ok := validReplayStates[s]; ok {
+		return nil
+	}
+	return fmt.Errorf("invalid replay state %q", s)
+}
+
+// Replayable reports whether entries in this state are picked up by a replay.
+func (s ReplayState) Replayable() bool {
+	switch s {
+	case StatePending, StateReplaying, StateFailed:
+		return true
+	}
+	return false
+}
+
+// allowedTransitions is the replay state machine.
+var allowedTransitions = map[ReplayState]map[ReplayState]struct{}{
+	StatePending: stateSet(
+		StateReplaying,
+		StateConfirmed, // superseded before replay, e.g. the item was deleted locally
+	),
+	StateReplaying: stateSet(
+		StateReplaying, // resumed after an interrupted replay
+		StatePending,   // deferred until a dependency is replayed
+		StateConfirmed,
+		StateFailed,
+		StateConflicted,
+	),
+	StateFailed: stateSet(
+		StateReplaying,
+		StateConfirmed,
+	),
+	StateConflicted: stateSet(
+		StatePending, // conflict resolved, replay again
+		StateConfirmed,
+	),
+	StateConfirmed: {},
+}
+
+// CanTransition reports whether the state machine allows from -> to.
+func CanTransition(from, to ReplayState) bool {
+	targets, ok := allowedTransitions[from]
+	if !ok {
+		return false
+	}
+	_, allowed := targets[to]
+	return allowed
+}
+
+func validateTransition(from, to ReplayState) error {
+	if err := to.Validate(); err != nil {
+		return err
+	}
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	return nil
+}
+
+func stateSet(states ...ReplayState) map[ReplayState]struct{} {
+	set := make(map[ReplayState]struct{}, len(states))
+	for _, st := range states {
+		set[st] = struct{}{}
+	}
+	return set
+}
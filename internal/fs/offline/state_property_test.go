@@ -0,0 +1,115 @@
+package offline
+
+import (
+	"errors"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+var allReplayStates = []ReplayState{
+	StatePending,
+	StateReplaying,
+	StateConfirmed,
+	StateFailed,
+	StateConflicted,
+}
+
+// Property: for any sequence of requested transitions, the journal only
+// applies those allowed by the state machine, persists every applied
+// transition, counts one attempt per replay and removes confirmed entries.
+func TestProperty_Offline_JournalFollowsStateMachine(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping property test in short mode")
+	}
+
+	journal := newTestJournal(t)
+	base := time.Now()
+	run := 0
+
+	property := func(steps []uint8) bool {
+		run++
+		change := &Change{ID: "prop", Type: "modify", Timestamp: base.Add(time.Duration(run))}
+		if err := journal.Record(change); err != nil {
+			t.Logf("record: %v", err)
+			return false
+		}
+
+		model := StatePending
+		attempts := 0
+		for _, step := range steps {
+			to := allReplayStates[int(step)%len(allReplayStates)]
+			err := journal.Transition(change, to)
+
+			if model == StateConfirmed {
+				// The entry is gone; nothing may resurrect it.
+				if !errors.Is(err, ErrNotFound) {
+					t.Logf("transition after confirm: %v", err)
+					return false
+				}
+				continue
+			}
+			if !CanTransition(model, to) {
+				if !errors.Is(err, ErrInvalidTransition) {
+					t.Logf("expected invalid %s->%s, got %v", model, to, err)
+					return false
+				}
+				continue
+			}
+			if err != nil {
+				t.Logf("allowed %s->%s failed: %v", model, to, err)
+				return false
+			}
+			model = to
+			if to == StateReplaying {
+				attempts++
+			}
+
+			stored, err := journal.Get(change)
+			if model == StateConfirmed {
+				if !errors.Is(err, ErrNotFound) {
+					t.Logf("confirmed entry still stored: %v", err)
+					return false
+				}
+				continue
+			}
+			if err != nil || stored.State != model || stored.Attempts != attempts {
+				t.Logf("stored %+v (err %v) does not match model %s/%d", stored, err, model, attempts)
+				return false
+			}
+			if stored.CurrentState().Replayable() != model.Replayable() {
+				return false
+			}
+		}
+		return true
+	}
+
+	config := &quick.Config{
+		MaxCount: 200,
+	}
+	if err := quick.Check(property, config); err != nil {
+		t.Errorf("Property violated: %v", err)
+	}
+}
+
+// Property: every state reachable from PENDING can eventually reach CONFIRMED,
+// so no journal entry can get stuck forever.
+func TestProperty_Offline_EveryStateCanBeConfirmed(t *testing.T) {
+	for _, start := range allReplayStates {
+		seen := map[ReplayState]bool{start: true}
+		queue := []ReplayState{start}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, next := range allReplayStates {
+				if CanTransition(current, next) && !seen[next] {
+					seen[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+		if !seen[StateConfirmed] {
+			t.Fatalf("state %s cannot reach %s", start, StateConfirmed)
+		}
+	}
+}
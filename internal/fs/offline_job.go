@@ -0,0 +1,156 @@
+package fs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// "Make available offline" pins a folder and everything below it ALWAYS and
+// hydrates the files right away instead of waiting for them to be opened.
+// It runs as a JobHydration job: the folder is scanned first (listing
+// directories that were never opened), then at most offlineJobParallelism
+// files are downloaded at a time so a large folder cannot monopolise the
+// download queue. Cancelling the job stops scheduling downloads but keeps the
+// pins, so the remaining files are still hydrated on demand.
+const offlineJobParallelism = 4
+
+// offlineFile is a file to hydrate as part of a job.
+type offlineFile struct {
+	id   string
+	size uint64
+}
+
+// MakeAvailableOffline starts a job pinning and hydrating the item with the
+// given ID and, for folders, everything below it. It returns the job ID; a
+// job already running for the same item is reused.
+func (f *Filesystem) MakeAvailableOffline(id string) (string, error) {
+	return f.startOfflineJob(id, f.hydrateForOffline)
+}
+
+func (f *Filesystem) startOfflineJob(id string, hydrate func(id string) error) (string, error) {
+	inode := f.GetID(id)
+	if inode == nil {
+		return "", errors.NewNotFoundError("item not found", nil)
+	}
+	if inode.IsPackage() {
+		return "", errors.New("packages cannot be made available offline")
+	}
+	release := f.fenceItem(inode)
+	job := f.startJob(JobHydration, inode.Path(), JobHydration+":"+id, func(ctx context.Context, job *Job) error {
+		return f.runOfflineJob(ctx, job, id, hydrate)
+	})
+	release()
+	return job.ID(), nil
+}
+
+// runOfflineJob pins and scans the item, then hydrates its files.
+func (f *Filesystem) runOfflineJob(ctx context.Context, job *Job, id string, hydrate func(id string) error) error {
+	job.SetPhase("scanning")
+	var files []offlineFile
+	if err := f.collectOfflineFiles(ctx, id, &files); err != nil {
+		return err
+	}
+	for _, file := range files {
+		job.AddTotal(1, file.size)
+	}
+	job.SetPhase("downloading")
+
+	queue := make(chan offlineFile)
+	var workers sync.WaitGroup
+	for i := 0; i < offlineJobParallelism; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for file := range queue {
+				if err := hydrate(file.id); err != nil {
+					logging.Warn().Err(err).
+						Str("job", job.ID()).
+						Str("id", file.id).
+						Msg("Failed to make file available offline")
+					job.AddFailed(1)
+					continue
+				}
+				job.Advance(1, file.size)
+			}
+		}()
+	}
+feed:
+	for _, file := range files {
+		select {
+		case queue <- file:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	workers.Wait()
+	return nil
+}
+
+// collectOfflineFiles pins the item and everything below it, appending the
+// files found to files. Folders are listed from the server when their
+// children are not known yet. Packages, and items below the item that are
+// marked NEVER, are skipped.
+func (f *Filesystem) collectOfflineFiles(ctx context.Context, id string, files *[]offlineFile) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	inode := f.GetID(id)
+	if inode == nil || inode.IsPackage() {
+		return nil
+	}
+	if err := f.persistPinMode(id, metadata.PinModeAlways); err != nil {
+		return err
+	}
+	if !inode.IsDir() {
+		*files = append(*files, offlineFile{id: id, size: inode.Size()})
+		return nil
+	}
+	children, err := f.GetChildrenID(id, f.auth)
+	if err != nil {
+		return errors.Wrap(err, "failed to list "+inode.Path())
+	}
+	for _, child := range children {
+		if f.PinMode(child.ID()) == metadata.PinModeNever {
+			continue
+		}
+		if err := f.collectOfflineFiles(ctx, child.ID(), files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hydrateForOffline downloads the file unless its content is already cached.
+func (f *Filesystem) hydrateForOffline(id string) error {
+	if f.hasLocalContent(id) {
+		return nil
+	}
+	if f.downloads == nil {
+		return errors.New("download manager unavailable")
+	}
+	if f.deferHydrationForCap(id) {
+		return errors.New("transfer cap reached, download deferred")
+	}
+	if _, err := f.downloads.QueueDownload(id); err != nil {
+		return err
+	}
+	return f.downloads.WaitForDownload(id)
+}
+
+// hasLocalContent reports whether the file's content is cached and current.
+func (f *Filesystem) hasLocalContent(id string) bool {
+	entry, err := f.GetMetadataEntry(id)
+	if err != nil || entry == nil {
+		return false
+	}
+	switch entry.State {
+	case metadata.ItemStateHydrated, metadata.ItemStateDirtyLocal:
+		return f.content != nil && f.content.HasContent(id)
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package fs
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// seedOfflineTree creates photos/{a.jpg, b.jpg, 2024/c.jpg, Notes (package)}.
+func seedOfflineTree(t *testing.T, fs *Filesystem) *Inode {
+	t.Helper()
+	photos := NewInode("photos", fuse.S_IFDIR|0755, nil)
+	photos.DriveItem.ID = "photos"
+	registerHydratedEntry(t, fs, photos)
+
+	year := NewInodeDriveItem(&graph.DriveItem{ID: "2024", Name: "2024", Parent: &graph.DriveItemParent{ID: "photos"}, Folder: &graph.Folder{}})
+	registerHydratedEntry(t, fs, year)
+	fs.InsertChild(photos.ID(), year)
+
+	for _, item := range []struct{ id, parent string }{{"a.jpg", "photos"}, {"b.jpg", "photos"}, {"c.jpg", "2024"}} {
+		file := NewInodeDriveItem(&graph.DriveItem{ID: item.id, Name: item.id, Size: 100, Parent: &graph.DriveItemParent{ID: item.parent}, File: &graph.File{}})
+		registerHydratedEntry(t, fs, file)
+		fs.InsertChild(item.parent, file)
+	}
+
+	notes := NewInodeDriveItem(&graph.DriveItem{ID: "notes", Name: "Notes", Parent: &graph.DriveItemParent{ID: "photos"}, Package: &graph.Package{Type: "oneNote"}})
+	registerHydratedEntry(t, fs, notes)
+	fs.InsertChild(photos.ID(), notes)
+	return photos
+}
+
+func waitForJob(t *testing.T, fs *Filesystem, jobID string) JobInfo {
+	t.Helper()
+	var info JobInfo
+	require.Eventually(t, func() bool {
+		var ok bool
+		info, ok = fs.Job(jobID)
+		return ok && info.IsFinished()
+	}, 5*time.Second, 10*time.Millisecond)
+	return info
+}
+
+func TestUT_FS_OfflineJob_PinsAndHydratesFolder(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	photos := seedOfflineTree(t, fs)
+
+	var mu sync.Mutex
+	hydrated := map[string]bool{}
+	var running, peak int32
+	jobID, err := fs.startOfflineJob(photos.ID(), func(id string) error {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		mu.Lock()
+		hydrated[id] = true
+		mu.Unlock()
+		return nil
+	})
+	require.NoError(t, err)
+
+	info := waitForJob(t, fs, jobID)
+	require.Equal(t, JobCompleted, info.State)
+	require.Equal(t, JobHydration, info.Kind)
+	require.Equal(t, uint64(3), info.Total)
+	require.Equal(t, uint64(3), info.Done)
+	require.Equal(t, uint64(300), info.BytesTotal)
+	require.Equal(t, uint64(300), info.BytesDone)
+	require.Equal(t, map[string]bool{"a.jpg": true, "b.jpg": true, "c.jpg": true}, hydrated)
+	require.LessOrEqual(t, atomic.LoadInt32(&peak), int32(offlineJobParallelism))
+
+	for _, id := range []string{"photos", "2024", "a.jpg", "c.jpg"} {
+		require.Equal(t, metadata.PinModeAlways, fs.PinMode(id), id)
+	}
+	require.Equal(t, metadata.PinModeUnset, fs.PinMode("notes"), "packages are skipped")
+
+	_, err = fs.MakeAvailableOffline("notes")
+	require.Error(t, err)
+}
+
+func TestUT_FS_OfflineJob_Cancel(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	photos := seedOfflineTree(t, fs)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	jobID, err := fs.startOfflineJob(photos.ID(), func(id string) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	require.NoError(t, err)
+	<-started
+
+	again, err := fs.startOfflineJob(photos.ID(), nil)
+	require.NoError(t, err)
+	require.Equal(t, jobID, again, "a running job is reused")
+
+	require.NoError(t, fs.CancelJob(jobID))
+	close(release)
+	require.Equal(t, JobCancelled, waitForJob(t, fs, jobID).State)
+	require.Equal(t, metadata.PinModeAlways, fs.PinMode("photos"), "cancelling keeps the pins")
+}
+
+func TestUT_FS_OfflineJob_UnpinCancelsAndUnpins(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	photos := seedOfflineTree(t, fs)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	jobID, err := fs.startOfflineJob(photos.ID(), func(id string) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	require.NoError(t, err)
+	<-started
+	require.Equal(t, metadata.PinModeAlways, fs.PinMode("c.jpg"))
+
+	require.NoError(t, fs.SetTreePinMode(photos.ID(), metadata.PinModeUnset))
+	close(release)
+	require.Equal(t, JobCancelled, waitForJob(t, fs, jobID).State)
+	for _, id := range []string{"photos", "2024", "a.jpg", "b.jpg", "c.jpg"} {
+		require.Equal(t, metadata.PinModeUnset, fs.PinMode(id), id)
+	}
+}
@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/auriora/onemount/internal/fs/offline"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// offlineConflictError reports that replaying a change found the item diverged
+// on the server. The journal entry is kept as CONFLICTED for the user to resolve.
+type offlineConflictError struct {
+	reason string
+}
+
+func (e *offlineConflictError) Error() string {
+	return "offline change conflicts with server: " + e.reason
+}
+
+// offlineJournal returns the journal of changes made while offline.
+func (f *Filesystem) offlineJournal() (*offline.Journal, error) {
+	return offline.NewJournal(f.db, bucketOfflineChanges)
+}
+
+// replayOfflineChange drives a journal entry through the replay state machine
+// around fn: REPLAYING while fn runs, then CONFIRMED (removed), PENDING when
+// deferred, CONFLICTED on divergence or FAILED for a later retry. Deferred
+// replays are not reported as errors.
+func (f *Filesystem) replayOfflineChange(ctx context.Context, change *OfflineChange, fn func(context.Context, *OfflineChange) error) error {
+	journal, err := f.offlineJournal()
+	if err != nil {
+		return err
+	}
+	if err := journal.Transition(change, offline.StateReplaying); err != nil {
+		return err
+	}
+
+	replayErr := fn(ctx, change)
+
+	var conflict *offlineConflictError
+	var transitionErr error
+	switch {
+	case replayErr == nil:
+		transitionErr = journal.Transition(change, offline.StateConfirmed)
+	case errors.Is(replayErr, errRenameDeferred):
+		logging.Debug().
+			Str("id", change.ID).
+			Str("type", change.Type).
+			Msg("Deferring offline change until its dependencies are replayed")
+		transitionErr = journal.Transition(change, offline.StatePending)
+		replayErr = nil
+	case errors.As(replayErr, &conflict):
+		transitionErr = journal.Transition(change, offline.StateConflicted, offline.WithError(replayErr))
+	default:
+		transitionErr = journal.Transition(change, offline.StateFailed, offline.WithError(replayErr))
+	}
+
+	if transitionErr != nil {
+		logging.Warn().
+			Err(transitionErr).
+			Str("id", change.ID).
+			Str("type", change.Type).
+			Msg("Failed to record offline change replay state")
+	}
+	return replayErr
+}
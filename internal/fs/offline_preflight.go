@@ -0,0 +1,200 @@
+package fs
+
+import (
+	"context"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// Deletes journaled while offline often target items OneDrive no longer has,
+// because the item or a folder it was in was deleted remotely as well.
+// Replaying those one at a time fails with a not-found error for each. Before
+// a replay, the items of pending deletes and their folders are therefore
+// looked up in JSON batches spaced existenceBatchInterval apart. Deletes of
+// items already gone are confirmed without a request of their own, and
+// folders gone remotely are removed from the local tree unless something in
+// them has local changes, which the replay then uploads or reports.
+
+// existenceBatchInterval is the least time between two existence batches, so
+// a long journal does not get the mount throttled.
+const existenceBatchInterval = time.Second
+
+// existenceClient is the subset of the Graph API used to check that items
+// still exist.
+type existenceClient interface {
+	ItemsExist(ctx context.Context, ids []string) (map[string]bool, error)
+}
+
+// graphExistenceClient forwards existence checks to the Graph API.
+type graphExistenceClient struct {
+	auth *graph.Auth
+}
+
+func (c graphExistenceClient) ItemsExist(ctx context.Context, ids []string) (map[string]bool, error) {
+	return graph.ItemsExist(ctx, ids, c.auth)
+}
+
+// preflightOfflineDeletes confirms the journaled deletes of items that are
+// already gone from OneDrive and returns the changes still to replay.
+func (f *Filesystem) preflightOfflineDeletes(ctx context.Context, changes []*OfflineChange) []*OfflineChange {
+	return f.preflightOfflineDeletesWith(ctx, changes, graphExistenceClient{auth: f.auth}, existenceBatchInterval)
+}
+
+func (f *Filesystem) preflightOfflineDeletesWith(ctx context.Context, changes []*OfflineChange, client existenceClient, interval time.Duration) []*OfflineChange {
+	parents := make(map[string]string)
+	var ids []string
+	queued := make(map[string]bool)
+	check := func(id string) {
+		if id != "" && id != f.root && !isLocalID(id) && !queued[id] {
+			queued[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, change := range changes {
+		if change.Type != "delete" || isLocalID(change.ID) {
+			continue
+		}
+		check(change.ID)
+		if entry, err := f.GetMetadataEntry(change.ID); err == nil {
+			parents[change.ID] = entry.ParentID
+			check(entry.ParentID)
+		}
+	}
+	if len(ids) == 0 {
+		return changes
+	}
+
+	exists := f.checkRemoteExistence(ctx, client, ids, interval)
+	remaining := make([]*OfflineChange, 0, len(changes))
+	confirmed := 0
+	for _, change := range changes {
+		if change.Type != "delete" {
+			remaining = append(remaining, change)
+			continue
+		}
+		if found, known := exists[change.ID]; !known || found {
+			remaining = append(remaining, change)
+			continue
+		}
+		parentID := parents[change.ID]
+		err := f.replayOfflineChange(ctx, change, func(ctx context.Context, change *OfflineChange) error {
+			if parentID != "" {
+				_ = f.removeChildFromParent(ctx, parentID, change.ID, f.isDirEntry(change.ID))
+			}
+			f.markEntryDeleted(change.ID)
+			f.DeleteID(change.ID)
+			return nil
+		})
+		if err != nil {
+			remaining = append(remaining, change)
+			continue
+		}
+		confirmed++
+		logging.Debug().
+			Str(logging.FieldID, change.ID).
+			Str(logging.FieldPath, change.Path).
+			Msg("Offline delete already applied remotely")
+	}
+
+	removed := 0
+	folders := make(map[string]bool, len(parents))
+	for _, parentID := range parents {
+		if found, known := exists[parentID]; known && !found && !folders[parentID] {
+			folders[parentID] = true
+			if f.removeRemotelyDeletedFolder(ctx, parentID) {
+				removed++
+			}
+		}
+	}
+	if confirmed > 0 || removed > 0 {
+		logging.Info().
+			Int("deletesConfirmed", confirmed).
+			Int("foldersRemoved", removed).
+			Msg("Confirmed offline deletes of items already gone from OneDrive")
+	}
+	return remaining
+}
+
+// checkRemoteExistence looks the items up in batches, waiting interval
+// between batches. Items that could not be checked are left out; checking
+// stops at the first failed batch, leaving the rest to the replay itself.
+func (f *Filesystem) checkRemoteExistence(ctx context.Context, client existenceClient, ids []string, interval time.Duration) map[string]bool {
+	exists := make(map[string]bool, len(ids))
+	for start := 0; start < len(ids); start += graph.MaxBatchRequests {
+		if start > 0 && interval > 0 {
+			select {
+			case <-ctx.Done():
+				return exists
+			case <-time.After(interval):
+			}
+		}
+		end := start + graph.MaxBatchRequests
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch, err := client.ItemsExist(ctx, ids[start:end])
+		if err != nil {
+			logging.Debug().Err(err).Int("items", end-start).Msg("Could not check whether offline deletes still apply")
+			return exists
+		}
+		for id, found := range batch {
+			exists[id] = found
+		}
+	}
+	return exists
+}
+
+// isDirEntry reports whether the stored entry of id is a folder.
+func (f *Filesystem) isDirEntry(id string) bool {
+	entry, err := f.GetMetadataEntry(id)
+	return err == nil && entry.ItemType == metadata.ItemKindDirectory
+}
+
+// removeRemotelyDeletedFolder removes a folder deleted remotely from the local
+// tree, unless something in it has local changes.
+func (f *Filesystem) removeRemotelyDeletedFolder(ctx context.Context, id string) bool {
+	entry, err := f.GetMetadataEntry(id)
+	if err != nil || entry.State == metadata.ItemStateDeleted || f.hasLocalChangesBelow(id) {
+		return false
+	}
+	_ = f.removeChildFromParent(ctx, entry.ParentID, id, true)
+	f.markEntryDeleted(id)
+	f.DeleteID(id)
+	logging.Info().
+		Str(logging.FieldID, id).
+		Str("name", entry.Name).
+		Msg("Removed a folder deleted from OneDrive while offline")
+	return true
+}
+
+// hasLocalChangesBelow reports whether the item or anything below it has
+// changes that are not uploaded yet.
+func (f *Filesystem) hasLocalChangesBelow(id string) bool {
+	var ids []string
+	pending := []string{id}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if isLocalID(current) {
+			return true
+		}
+		ids = append(ids, current)
+		inode := f.GetID(current)
+		if inode == nil {
+			continue
+		}
+		if inode.HasChanges() {
+			return true
+		}
+		pending = append(pending, inode.GetChildren()...)
+	}
+	for _, changed := range f.batchCheckOfflineChanges(ids) {
+		if changed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExistenceClient answers existence batches from a set of remote items.
+type fakeExistenceClient struct {
+	remote  map[string]bool
+	batches [][]string
+	failAt  int // batch number that fails, 0 for none
+}
+
+func (c *fakeExistenceClient) ItemsExist(_ context.Context, ids []string) (map[string]bool, error) {
+	c.batches = append(c.batches, append([]string(nil), ids...))
+	if len(c.batches) == c.failAt {
+		return nil, errors.New("throttled")
+	}
+	exists := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		exists[id] = c.remote[id]
+	}
+	return exists, nil
+}
+
+// recordOfflineDelete deletes the item locally and journals the delete.
+func recordOfflineDelete(t *testing.T, fs *Filesystem, id string) *OfflineChange {
+	t.Helper()
+	fs.DeleteID(id)
+	change := &OfflineChange{ID: id, Type: "delete", Timestamp: time.Now(), Path: "/" + id}
+	journal, err := fs.offlineJournal()
+	require.NoError(t, err)
+	require.NoError(t, journal.Record(change))
+	return change
+}
+
+func TestUT_FS_OfflinePreflight_ConfirmsDeletesUnderDeletedFolders(t *testing.T) {
+	fs := setupEvictionTestFS(t, 0)
+	fs.statuses = make(map[string]FileStatusInfo)
+	fs.uploads = &UploadManager{deletionQueue: make(chan string, 32)} // deletes cancel uploads
+	folder := func(id string) *Inode {
+		inode := NewInode(id, fuse.S_IFDIR|0755, nil)
+		inode.DriveItem.ID = id
+		registerHydratedEntry(t, fs, inode)
+		return inode
+	}
+	file := func(id string, parent *Inode) {
+		inode := NewInode(id+".txt", fuse.S_IFREG|0644, parent)
+		inode.DriveItem.ID = id
+		registerHydratedEntry(t, fs, inode)
+		fs.InsertChild(parent.ID(), inode)
+	}
+	gone, edited, live := folder("gone"), folder("edited"), folder("live")
+	file("a", gone)
+	file("b", gone)
+	file("c", edited)
+	file("local-new", edited)
+	file("d", live)
+
+	changes := []*OfflineChange{
+		recordOfflineDelete(t, fs, "a"),
+		recordOfflineDelete(t, fs, "b"),
+		recordOfflineDelete(t, fs, "c"),
+		recordOfflineDelete(t, fs, "d"),
+		{ID: "local-new", Type: "create", Timestamp: time.Now()},
+	}
+	client := &fakeExistenceClient{remote: map[string]bool{"live": true, "d": true}}
+
+	remaining := fs.preflightOfflineDeletesWith(context.Background(), changes, client, 0)
+	require.Equal(t, []*OfflineChange{changes[3], changes[4]}, remaining, "only the delete of an existing item is replayed")
+	require.Len(t, client.batches, 1)
+	require.ElementsMatch(t, []string{"a", "b", "c", "d", "gone", "edited", "live"}, client.batches[0])
+	for _, change := range changes[:3] {
+		require.Nil(t, loadOfflineChange(t, fs, change), change.ID)
+	}
+	require.NotNil(t, loadOfflineChange(t, fs, changes[3]))
+
+	entry, err := fs.GetMetadataEntry("gone")
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateDeleted, entry.State, "an emptied folder deleted remotely goes too")
+	require.Nil(t, fs.GetID("gone"))
+	require.NotNil(t, fs.GetID("edited"), "a folder with local changes is kept for the replay")
+	require.NotNil(t, fs.GetID("live"))
+}
+
+func TestUT_FS_OfflinePreflight_BatchesAndStopsWhenThrottled(t *testing.T) {
+	fs := setupEvictionTestFS(t, 0)
+	ids := make([]string, 45)
+	for i := range ids {
+		ids[i] = "item-" + string(rune('a'+i/26)) + string(rune('a'+i%26))
+	}
+
+	client := &fakeExistenceClient{}
+	exists := fs.checkRemoteExistence(context.Background(), client, ids, 0)
+	require.Len(t, client.batches, 3)
+	require.Len(t, client.batches[2], 5)
+	require.Len(t, exists, 45)
+
+	client = &fakeExistenceClient{failAt: 2}
+	exists = fs.checkRemoteExistence(context.Background(), client, ids, 0)
+	require.Len(t, client.batches, 2, "no more batches after one fails")
+	require.Len(t, exists, 20, "items not checked are left to the replay")
+}
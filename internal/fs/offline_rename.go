@@ -0,0 +1,219 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// Offline renames are replayed in two phases so a failure (or crash) midway
+// never leaves the local and remote trees silently divergent:
+//
+//  1. Prepare: verify the item, its destination folder and the destination
+//     name against the server. The intent is then persisted by marking the
+//     journal entry as renamePhaseMoving.
+//  2. Commit: issue the move and confirm the server reports the item at the
+//     destination before the entry is confirmed.
+//
+// An entry found in renamePhaseMoving after a restart is simply re-verified:
+// if the server already shows the destination the rename is confirmed,
+// otherwise the move is retried. Permanent failures either roll the local view
+// back to the server location or flag the item as a conflict.
+const renamePhaseMoving = "moving"
+
+// errRenameDeferred signals that a rename cannot be replayed yet, typically
+// because its destination folder was also created offline and has not been
+// uploaded. The journal entry returns to PENDING for the next replay.
+var errRenameDeferred = errors.New("rename replay deferred until destination exists remotely")
+
+// renameReplayClient is the subset of the Graph API used to replay renames.
+type renameReplayClient interface {
+	GetItem(id string) (*graph.DriveItem, error)
+	GetItemChild(parentID, name string) (*graph.DriveItem, error)
+	Rename(id, name, parentID string) error
+}
+
+// graphRenameClient forwards rename replay calls to the Graph API.
+type graphRenameClient struct {
+	ctx  context.Context
+	auth *graph.Auth
+}
+
+func (c graphRenameClient) GetItem(id string) (*graph.DriveItem, error) {
+	return graph.GetItemWithContext(c.ctx, id, c.auth)
+}
+
+func (c graphRenameClient) GetItemChild(parentID, name string) (*graph.DriveItem, error) {
+	return graph.GetItemChild(parentID, name, c.auth)
+}
+
+func (c graphRenameClient) Rename(id, name, parentID string) error {
+	return graph.RenameWithContext(c.ctx, id, name, parentID, c.auth)
+}
+
+// replayOfflineRename replays a rename recorded while offline. A nil return
+// means local and remote agree again and the journal entry can be confirmed.
+func (f *Filesystem) replayOfflineRename(ctx context.Context, change *OfflineChange) error {
+	return f.replayOfflineRenameWith(ctx, change, graphRenameClient{ctx: ctx, auth: f.auth})
+}
+
+func (f *Filesystem) replayOfflineRenameWith(ctx context.Context, change *OfflineChange, client renameReplayClient) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	inode := f.GetID(change.ID)
+	if inode == nil || isLocalID(change.ID) {
+		// Deleted locally since, or never uploaded: the delete/upload replay
+		// places the item correctly and there is nothing to move remotely.
+		return nil
+	}
+
+	parentID := inode.ParentID()
+	name := inode.Name()
+	if parentID == "" || isLocalID(parentID) {
+		return errRenameDeferred
+	}
+
+	logger := logging.Info().
+		Str("id", change.ID).
+		Str("oldPath", change.OldPath).
+		Str("newPath", change.NewPath).
+		Str("phase", change.Phase)
+
+	// Phase 1: verify preconditions against the server.
+	remote, err := client.GetItem(change.ID)
+	if err != nil {
+		if errors.IsNotFoundError(err) {
+			return f.markRenameConflict(change, "item no longer exists on the server")
+		}
+		return err
+	}
+	if remoteAtLocation(remote, parentID, name) {
+		logger.Msg("Offline rename already reflected on server")
+		return f.confirmRename(change, remote)
+	}
+
+	if _, err := client.GetItem(parentID); err != nil {
+		if errors.IsNotFoundError(err) {
+			return f.rollbackRename(change, inode, remote, "destination folder no longer exists on the server")
+		}
+		return err
+	}
+	existing, err := client.GetItemChild(parentID, name)
+	if err != nil && !errors.IsNotFoundError(err) {
+		return err
+	}
+	if existing != nil && existing.ID != "" && existing.ID != change.ID {
+		return f.markRenameConflict(change, fmt.Sprintf("destination name %q is already taken on the server", name))
+	}
+
+	if change.Phase != renamePhaseMoving {
+		journal, err := f.offlineJournal()
+		if err != nil {
+			return err
+		}
+		change.Phase = renamePhaseMoving
+		if err := journal.Save(change); err != nil {
+			return err
+		}
+	}
+
+	// Phase 2: perform the move and confirm it on the server.
+	if err := client.Rename(change.ID, name, parentID); err != nil {
+		switch {
+		case isRenameConflictError(err):
+			return f.markRenameConflict(change, fmt.Sprintf("destination name %q is already taken on the server", name))
+		case errors.IsNotFoundError(err), errors.IsValidationError(err):
+			return f.rollbackRename(change, inode, remote, err.Error())
+		}
+		return err
+	}
+
+	confirmed, err := client.GetItem(change.ID)
+	if err != nil {
+		return err
+	}
+	if !remoteAtLocation(confirmed, parentID, name) {
+		return fmt.Errorf("rename of %s not yet visible on the server", change.ID)
+	}
+
+	logger.Msg("Replayed offline rename")
+	return f.confirmRename(change, confirmed)
+}
+
+// remoteAtLocation reports whether the remote item sits at parentID/name.
+// OneDrive names are case-insensitive.
+func remoteAtLocation(item *graph.DriveItem, parentID, name string) bool {
+	if item == nil || item.Parent == nil {
+		return false
+	}
+	return item.Parent.ID == parentID && strings.EqualFold(item.Name, name)
+}
+
+// isRenameConflictError reports whether the server rejected a move because the
+// destination name already exists.
+func isRenameConflictError(err error) bool {
+	return errors.Is(err, errors.ErrConflict)
+}
+
+// confirmRename finalizes a rename that the server reports at its destination.
+func (f *Filesystem) confirmRename(change *OfflineChange, remote *graph.DriveItem) error {
+	if inode := f.GetID(change.ID); inode != nil {
+		inode.mu.Lock()
+		if remote.ETag != "" {
+			inode.DriveItem.ETag = remote.ETag
+		}
+		dirty := inode.hasChanges
+		inode.mu.Unlock()
+		if !dirty {
+			f.markCleanLocalState(change.ID)
+		}
+	}
+	return nil
+}
+
+// rollbackRename restores the local view to the server location after the
+// remote move failed permanently.
+func (f *Filesystem) rollbackRename(change *OfflineChange, inode *Inode, remote *graph.DriveItem, reason string) error {
+	if remote == nil || remote.Parent == nil || remote.Parent.ID == "" {
+		return f.markRenameConflict(change, reason)
+	}
+	if err := f.MovePath(inode.ParentID(), remote.Parent.ID, inode.Name(), remote.Name, f.auth); err != nil {
+		logging.Warn().
+			Err(err).
+			Str("id", change.ID).
+			Msg("Failed to roll back offline rename locally")
+		return f.markRenameConflict(change, reason)
+	}
+
+	logging.Warn().
+		Str("id", change.ID).
+		Str("path", change.NewPath).
+		Str("restoredPath", change.OldPath).
+		Str("reason", reason).
+		Msg("Offline rename rejected by server; restored server location")
+	if !inode.HasChanges() {
+		f.transitionToState(change.ID, metadata.ItemStateHydrated, metadata.ClearPendingRemote())
+	}
+	return nil
+}
+
+// markRenameConflict keeps the local view but flags the item as conflicted so
+// the divergence is visible to the user, and reports the conflict so the
+// journal entry is kept as CONFLICTED.
+func (f *Filesystem) markRenameConflict(change *OfflineChange, reason string) error {
+	logging.Warn().
+		Str("id", change.ID).
+		Str("path", change.NewPath).
+		Str("reason", reason).
+		Msg("Offline rename could not be replayed; marking conflict")
+	f.transitionItemState(change.ID, metadata.ItemStateConflict)
+	f.MarkFileConflict(change.ID, "rename failed: "+reason)
+	return &offlineConflictError{reason: reason}
+}
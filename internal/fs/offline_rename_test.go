@@ -0,0 +1,188 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/fs/offline"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRenameClient is an in-memory stand-in for the Graph API that tracks
+// item locations by ID.
+type fakeRenameClient struct {
+	items     map[string]*graph.DriveItem
+	renameErr error
+	renames   int
+}
+
+func (c *fakeRenameClient) GetItem(id string) (*graph.DriveItem, error) {
+	item, ok := c.items[id]
+	if !ok {
+		return nil, graphAPIError(404, "itemNotFound")
+	}
+	copied := *item
+	return &copied, nil
+}
+
+func (c *fakeRenameClient) GetItemChild(parentID, name string) (*graph.DriveItem, error) {
+	for _, item := range c.items {
+		if item.Parent != nil && item.Parent.ID == parentID && item.Name == name {
+			copied := *item
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *fakeRenameClient) Rename(id, name, parentID string) error {
+	c.renames++
+	if c.renameErr != nil {
+		return c.renameErr
+	}
+	c.items[id].Name = name
+	c.items[id].Parent = &graph.DriveItemParent{ID: parentID}
+	return nil
+}
+
+// setupRenameReplayTest builds a folder "dest" holding "new.txt", which was
+// renamed offline from "old.txt" in folder "src", plus a matching remote tree
+// that still shows the old location.
+func setupRenameReplayTest(t *testing.T) (*Filesystem, *OfflineChange, *fakeRenameClient) {
+	t.Helper()
+	fs := setupEvictionTestFS(t, 0)
+	fs.statuses = make(map[string]FileStatusInfo)
+
+	dest := NewInode("dest", fuse.S_IFDIR|0755, nil)
+	dest.DriveItem.ID = "dest"
+	registerHydratedEntry(t, fs, dest)
+
+	file := NewInode("new.txt", fuse.S_IFREG|0644, dest)
+	file.DriveItem.ID = "file"
+	registerHydratedEntry(t, fs, file)
+	fs.markDirtyLocalState(file.ID()) // as done by the Rename operation
+
+	client := &fakeRenameClient{items: map[string]*graph.DriveItem{
+		"src":  {ID: "src", Name: "src"},
+		"dest": {ID: "dest", Name: "dest"},
+		"file": {ID: "file", Name: "old.txt", ETag: "etag-2", Parent: &graph.DriveItemParent{ID: "src"}},
+	}}
+
+	change := &OfflineChange{
+		ID:        "file",
+		Type:      "rename",
+		Timestamp: time.Now(),
+		OldPath:   "/src/old.txt",
+		NewPath:   "/dest/new.txt",
+	}
+	journal, err := fs.offlineJournal()
+	require.NoError(t, err)
+	require.NoError(t, journal.Record(change))
+	return fs, change, client
+}
+
+// replayRename replays a rename journal entry through the replay state machine.
+func replayRename(fs *Filesystem, change *OfflineChange, client renameReplayClient) error {
+	return fs.replayOfflineChange(context.Background(), change, func(ctx context.Context, change *OfflineChange) error {
+		return fs.replayOfflineRenameWith(ctx, change, client)
+	})
+}
+
+func loadOfflineChange(t *testing.T, fs *Filesystem, change *OfflineChange) *OfflineChange {
+	t.Helper()
+	journal, err := fs.offlineJournal()
+	require.NoError(t, err)
+	stored, err := journal.Get(change)
+	if errors.Is(err, offline.ErrNotFound) {
+		return nil
+	}
+	require.NoError(t, err)
+	return stored
+}
+
+func TestUT_FS_OfflineRename_ReplaysAndConfirms(t *testing.T) {
+	fs, change, client := setupRenameReplayTest(t)
+
+	require.NoError(t, replayRename(fs, change, client))
+	require.Equal(t, 1, client.renames)
+	require.Equal(t, "dest", client.items["file"].Parent.ID)
+	require.Equal(t, "new.txt", client.items["file"].Name)
+	require.Nil(t, loadOfflineChange(t, fs, change), "confirmed rename should drop the record")
+	require.Equal(t, "etag-2", fs.GetID("file").DriveItem.ETag)
+
+	entry, err := fs.GetMetadataEntry("file")
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateHydrated, entry.State)
+}
+
+func TestUT_FS_OfflineRename_ResumesAfterCrash(t *testing.T) {
+	fs, change, client := setupRenameReplayTest(t)
+
+	// The move reached the server but the process died before confirming it.
+	journal, err := fs.offlineJournal()
+	require.NoError(t, err)
+	change.State = offline.StateReplaying
+	change.Phase = renamePhaseMoving
+	require.NoError(t, journal.Save(change))
+	client.items["file"].Name = "new.txt"
+	client.items["file"].Parent = &graph.DriveItemParent{ID: "dest"}
+
+	require.NoError(t, replayRename(fs, change, client))
+	require.Zero(t, client.renames, "an already applied move must not be reissued")
+	require.Nil(t, loadOfflineChange(t, fs, change))
+}
+
+func TestUT_FS_OfflineRename_TransientFailureKeepsRecord(t *testing.T) {
+	fs, change, client := setupRenameReplayTest(t)
+	client.renameErr = errors.New("connection reset")
+
+	require.Error(t, replayRename(fs, change, client))
+	stored := loadOfflineChange(t, fs, change)
+	require.NotNil(t, stored)
+	require.Equal(t, offline.StateFailed, stored.State)
+	require.Equal(t, renamePhaseMoving, stored.Phase)
+	require.Equal(t, "connection reset", stored.LastError)
+}
+
+func TestUT_FS_OfflineRename_DestinationTakenMarksConflict(t *testing.T) {
+	fs, change, client := setupRenameReplayTest(t)
+	client.items["other"] = &graph.DriveItem{ID: "other", Name: "new.txt", Parent: &graph.DriveItemParent{ID: "dest"}}
+
+	var conflict *offlineConflictError
+	require.ErrorAs(t, replayRename(fs, change, client), &conflict)
+	require.Zero(t, client.renames)
+	stored := loadOfflineChange(t, fs, change)
+	require.NotNil(t, stored, "conflicts are kept in the journal for auditing")
+	require.Equal(t, offline.StateConflicted, stored.State)
+	require.Equal(t, StatusConflict, fs.statuses["file"].Status)
+
+	entry, err := fs.GetMetadataEntry("file")
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateConflict, entry.State)
+}
+
+func TestUT_FS_OfflineRename_DeferredUntilParentUploaded(t *testing.T) {
+	fs, change, client := setupRenameReplayTest(t)
+
+	localDir := NewInode("fresh", fuse.S_IFDIR|0755, nil)
+	registerHydratedEntry(t, fs, localDir)
+	fs.GetID("file").DriveItem.Parent.ID = localDir.ID()
+
+	require.NoError(t, replayRename(fs, change, client))
+	require.Zero(t, client.renames)
+	stored := loadOfflineChange(t, fs, change)
+	require.NotNil(t, stored)
+	require.Equal(t, offline.StatePending, stored.State)
+}
+
+func TestUT_FS_OfflineRename_ConflictErrorClassification(t *testing.T) {
+	require.True(t, isRenameConflictError(graphAPIError(409, "nameAlreadyExists")))
+	require.False(t, isRenameConflictError(graphAPIError(503, "serviceUnavailable")))
+	require.False(t, isRenameConflictError(errors.New("HTTP 409 - nameAlreadyExists: name in use")), "messages are not parsed")
+	require.False(t, isRenameConflictError(nil))
+}
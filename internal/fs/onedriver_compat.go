@@ -0,0 +1,139 @@
+package fs
+
+import (
+	"strings"
+
+	"github.com/auriora/onemount/internal/logging"
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+// OneMount started as a fork of onedriver, and file manager extensions and
+// scripts written for onedriver still look for its names. With onedriver
+// compatibility enabled, every user.onemount.* extended attribute can also be
+// read, set and removed as user.onedriver.*, and the D-Bus object is exported
+// a second time under onedriver's bus name, object path and interface, emitting
+// the same signals. Only the first mount with compatibility enabled gets the
+// legacy bus name, as onedriver used a single name for all mounts.
+const (
+	// LegacyDBusInterface is the D-Bus interface name used by onedriver
+	LegacyDBusInterface = "com.github.jstaf.onedriver.FileStatus"
+	// LegacyDBusObjectPath is the D-Bus object path used by onedriver
+	LegacyDBusObjectPath = "/com/github/jstaf/onedriver/FileStatus"
+	// LegacyDBusServiceName is the D-Bus service name used by onedriver
+	LegacyDBusServiceName = "com.github.jstaf.onedriver.FileStatus"
+
+	xattrPrefix       = "user.onemount."
+	legacyXattrPrefix = "user.onedriver."
+)
+
+// SetOnedriverCompat enables or disables the onedriver compatibility names.
+func (f *Filesystem) SetOnedriverCompat(enabled bool) {
+	f.Lock()
+	f.onedriverCompat = enabled
+	f.Unlock()
+	if enabled && f.dbusServer != nil {
+		if err := f.dbusServer.EnableLegacyInterface(); err != nil {
+			logging.Warn().Err(err).Msg("Failed to export the onedriver D-Bus interface")
+		}
+	}
+}
+
+// OnedriverCompat reports whether the onedriver compatibility names are
+// exposed.
+func (f *Filesystem) OnedriverCompat() bool {
+	f.RLock()
+	defer f.RUnlock()
+	return f.onedriverCompat
+}
+
+// canonicalXAttrName maps a legacy user.onedriver.* attribute name to its
+// user.onemount.* equivalent when compatibility is enabled.
+func (f *Filesystem) canonicalXAttrName(name string) string {
+	if !strings.HasPrefix(name, legacyXattrPrefix) || !f.OnedriverCompat() {
+		return name
+	}
+	return xattrPrefix + strings.TrimPrefix(name, legacyXattrPrefix)
+}
+
+// withLegacyXAttrNames appends the legacy alias of every user.onemount.*
+// attribute name.
+func withLegacyXAttrNames(names []string) []string {
+	for _, name := range names {
+		if strings.HasPrefix(name, xattrPrefix) {
+			names = append(names, legacyXattrPrefix+strings.TrimPrefix(name, xattrPrefix))
+		}
+	}
+	return names
+}
+
+// EnableLegacyInterface additionally exports the server under onedriver's
+// names, now if the server runs or else when it starts.
+func (s *FileStatusDBusServer) EnableLegacyInterface() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.legacy {
+		return nil
+	}
+	s.legacy = true
+	if !s.started || s.conn == nil {
+		return nil
+	}
+	return s.exportLegacyLocked(true)
+}
+
+// legacyEnabled reports whether signals are also emitted under onedriver's
+// names.
+func (s *FileStatusDBusServer) legacyEnabled() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.legacy
+}
+
+// exportLegacyLocked exports the object under onedriver's path and interface
+// and, if requestName is set, requests its bus name. Callers hold s.mutex.
+func (s *FileStatusDBusServer) exportLegacyLocked(requestName bool) error {
+	if err := s.conn.Export(s, LegacyDBusObjectPath, LegacyDBusInterface); err != nil {
+		return err
+	}
+	node := fileStatusIntrospectNode()
+	node.Name = LegacyDBusObjectPath
+	node.Interfaces[0].Name = LegacyDBusInterface
+	// Properties are only exported under onemount's path
+	node.Interfaces[0].Properties = nil
+	node.Interfaces = node.Interfaces[:1]
+	if err := s.conn.Export(introspect.NewIntrospectable(node), LegacyDBusObjectPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return err
+	}
+	if !requestName {
+		return nil
+	}
+	reply, err := s.conn.RequestName(LegacyDBusServiceName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		logging.Warn().Str("dbusName", LegacyDBusServiceName).
+			Msg("Another mount owns the onedriver D-Bus name; exporting the onedriver interface without it")
+		return nil
+	}
+	s.legacyName = true
+	logging.Info().Str("dbusName", LegacyDBusServiceName).Msg("Exporting the onedriver D-Bus interface")
+	return nil
+}
+
+// unexportLegacyLocked undoes exportLegacyLocked. Callers hold s.mutex.
+func (s *FileStatusDBusServer) unexportLegacyLocked() {
+	if s.legacyName {
+		if _, err := s.conn.ReleaseName(LegacyDBusServiceName); err != nil {
+			logging.Warn().Err(err).Msg("Failed to release onedriver D-Bus name")
+		}
+		s.legacyName = false
+	}
+	if err := s.conn.Export(nil, LegacyDBusObjectPath, LegacyDBusInterface); err != nil {
+		logging.Warn().Err(err).Msg("Failed to unexport onedriver D-Bus object")
+	}
+	if err := s.conn.Export(nil, LegacyDBusObjectPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		logging.Warn().Err(err).Msg("Failed to unexport onedriver introspection data")
+	}
+}
@@ -0,0 +1,48 @@
+package fs
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_OnedriverCompat_LegacyXAttrNames(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	doc := NewInodeDriveItem(&graph.DriveItem{ID: "doc", Name: "report.txt", File: &graph.File{}})
+	registerHydratedEntry(t, fs, doc)
+	header := &fuse.InHeader{NodeId: doc.NodeID()}
+	get := func(name string) (string, fuse.Status) {
+		buf := make([]byte, 64)
+		n, status := fs.GetXAttr(nil, header, name, buf)
+		return string(buf[:n]), status
+	}
+	list := func() []string {
+		buf := make([]byte, 512)
+		n, status := fs.ListXAttr(nil, header, buf)
+		require.Equal(t, fuse.OK, status)
+		return strings.Split(strings.TrimSuffix(string(buf[:n]), "\x00"), "\x00")
+	}
+
+	require.Equal(t, fuse.OK, fs.SetXAttr(nil, &fuse.SetXAttrIn{InHeader: *header}, "user.onemount.status", []byte("Local")))
+	_, status := get("user.onedriver.status")
+	require.Equal(t, fuse.Status(syscall.ENODATA), status, "legacy names are off by default")
+	require.NotContains(t, list(), "user.onedriver.status")
+
+	fs.SetOnedriverCompat(true)
+	value, status := get("user.onedriver.status")
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, "Local", value)
+	require.Contains(t, list(), "user.onedriver.status")
+	require.Contains(t, list(), "user.onemount.status")
+
+	require.Equal(t, fuse.OK, fs.SetXAttr(nil, &fuse.SetXAttrIn{InHeader: *header}, "user.onedriver.status", []byte("Cloud")))
+	value, _ = get("user.onemount.status")
+	require.Equal(t, "Cloud", value, "legacy writes reach the same attribute")
+	require.Equal(t, fuse.OK, fs.RemoveXAttr(nil, header, "user.onedriver.status"))
+	_, status = get("user.onemount.status")
+	require.Equal(t, fuse.Status(syscall.ENODATA), status)
+}
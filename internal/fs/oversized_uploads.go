@@ -0,0 +1,137 @@
+package fs
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	bolt "go.etcd.io/bbolt"
+)
+
+// OneDrive rejects files larger than maxOneDriveFileSize. Writes and
+// truncates that would grow a file past the limit fail with EFBIG. A file that
+// is already too large (e.g. cached before the check existed) is never queued
+// for upload: it stays DIRTY_LOCAL with DeferredTooLarge recorded as its
+// upload deferral reason, fsync and close report EFBIG, --stats counts it and
+// `onemount status` lists it.
+// Shrinking the file below the limit releases it on the next flush.
+
+// maxOneDriveFileSize is the largest file OneDrive accepts (250 GB).
+const maxOneDriveFileSize uint64 = 250 << 30
+
+// DeferredTooLarge is the deferral reason of files exceeding
+// maxOneDriveFileSize.
+const DeferredTooLarge = "DeferredTooLarge"
+
+// exceedsSizeLimit reports whether a file of the given size cannot be
+// uploaded to OneDrive.
+func exceedsSizeLimit(size uint64) bool {
+	return size > maxOneDriveFileSize
+}
+
+// rejectOversizedWrite logs why a write or truncate growing the item to size
+// was refused.
+func rejectOversizedWrite(operation, id, path string, size uint64) {
+	logging.Warn().
+		Str("op", operation).
+		Str("id", id).
+		Str("path", path).
+		Uint64("size", size).
+		Uint64("limit", maxOneDriveFileSize).
+		Msg("Refusing to grow file past OneDrive's 250 GB file size limit")
+}
+
+// holdOversizedUpload reports true, recording the item as blocked, when the
+// item is too large to upload. A previously blocked item that shrank below
+// the limit has its deferral cleared.
+func (f *Filesystem) holdOversizedUpload(inode *Inode) bool {
+	if inode == nil {
+		return false
+	}
+	id := inode.ID()
+	blocked := f.uploadDeferralReason(id) == DeferredTooLarge
+	size := inode.Size()
+	if !exceedsSizeLimit(size) {
+		if blocked {
+			f.setUploadDeferral(id, "")
+		}
+		return false
+	}
+
+	f.markPendingUpload(id)
+	f.setUploadDeferral(id, DeferredTooLarge)
+	f.SetFileStatus(id, FileStatusInfo{
+		Status:    StatusError,
+		ErrorMsg:  "file exceeds OneDrive's 250 GB size limit",
+		ErrorCode: DeferredTooLarge,
+		Timestamp: time.Now(),
+	})
+	if !blocked {
+		logging.Warn().
+			Str("id", id).
+			Str("path", inode.Path()).
+			Uint64("size", size).
+			Uint64("limit", maxOneDriveFileSize).
+			Msg("File is too large for OneDrive, keeping it local until it is reduced")
+		f.emitActivity(ActivityError, id, "file exceeds OneDrive's 250 GB size limit")
+	}
+	return true
+}
+
+// uploadDeferralReason returns the persisted upload deferral reason of the
+// item, or an empty string.
+func (f *Filesystem) uploadDeferralReason(id string) string {
+	entry, err := f.GetMetadataEntry(id)
+	if err != nil || entry == nil {
+		return ""
+	}
+	return entry.Upload.DeferredReason
+}
+
+// BlockedUpload is a local change that will not upload until the user acts on
+// it.
+type BlockedUpload struct {
+	ID     string
+	Path   string
+	Reason string
+	Size   uint64
+}
+
+// BlockedUploads returns the items held back by holdOversizedUpload, sorted
+// by path.
+func (f *Filesystem) BlockedUploads() ([]BlockedUpload, error) {
+	if f.db == nil {
+		return nil, nil
+	}
+	var blocked []BlockedUpload
+	err := f.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMetadataV2)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var entry metadata.Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return nil
+			}
+			if entry.State == metadata.ItemStateDirtyLocal && entry.Upload.DeferredReason == DeferredTooLarge {
+				blocked = append(blocked, BlockedUpload{ID: entry.ID, Path: entry.Name, Reason: DeferredTooLarge, Size: entry.Size})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read metadata entries")
+	}
+	for i := range blocked {
+		if inode := f.GetID(blocked[i].ID); inode != nil {
+			blocked[i].Path = inode.Path()
+			blocked[i].Size = inode.Size()
+		}
+	}
+	sort.Slice(blocked, func(i, j int) bool { return blocked[i].Path < blocked[j].Path })
+	return blocked, nil
+}
@@ -0,0 +1,55 @@
+package fs
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_OversizedUploads_BlockedWithEFBIG(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	file := NewInode("disk.img", fuse.S_IFREG|0644, nil)
+	file.DriveItem.ID = "disk"
+	registerHydratedEntry(t, fs, file)
+	require.NoError(t, fs.content.Insert(file.ID(), []byte("boot")))
+	header := fuse.InHeader{NodeId: file.NodeID()}
+
+	// Growing a file past the limit is refused before anything is written.
+	n, status := fs.Write(nil, &fuse.WriteIn{InHeader: header, Offset: maxOneDriveFileSize}, []byte("x"))
+	require.Equal(t, fuse.Status(syscall.EFBIG), status)
+	require.Zero(t, n)
+	var out fuse.AttrOut
+	truncate := &fuse.SetAttrIn{SetAttrInCommon: fuse.SetAttrInCommon{InHeader: header, Valid: fuse.FATTR_SIZE, Size: maxOneDriveFileSize + 1}}
+	require.Equal(t, fuse.Status(syscall.EFBIG), fs.SetAttr(nil, truncate, &out))
+	require.Equal(t, uint64(0), file.Size())
+
+	// A file that is already too large stays local instead of uploading.
+	file.mu.Lock()
+	file.DriveItem.Size = maxOneDriveFileSize + 1
+	file.hasChanges = true
+	file.mu.Unlock()
+	require.Equal(t, fuse.Status(syscall.EFBIG), fs.Fsync(nil, &fuse.FsyncIn{InHeader: header}))
+	require.Equal(t, DeferredTooLarge, fs.UploadDeferral(file.ID()))
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateDirtyLocal, entry.State)
+	require.Equal(t, DeferredTooLarge, entry.Upload.DeferredReason, "counted by --stats")
+	require.Equal(t, StatusError, fs.GetFileStatus(file.ID()).Status)
+	blocked, err := fs.BlockedUploads()
+	require.NoError(t, err)
+	require.Equal(t, []BlockedUpload{{ID: file.ID(), Path: file.Path(), Reason: DeferredTooLarge, Size: maxOneDriveFileSize + 1}},
+		blocked, "listed by onemount status")
+
+	// Shrinking the file releases it.
+	file.mu.Lock()
+	file.DriveItem.Size = 4
+	file.mu.Unlock()
+	require.False(t, fs.holdOversizedUpload(file))
+	require.Empty(t, fs.UploadDeferral(file.ID()))
+	blocked, err = fs.BlockedUploads()
+	require.NoError(t, err)
+	require.Empty(t, blocked)
+}
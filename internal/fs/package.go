@@ -0,0 +1,49 @@
+package fs
+
+import (
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// OneDrive packages (OneNote notebooks being the common case) are stored as
+// a single item with neither a file nor a folder facet. Their content can
+// only be edited through the owning application, and writing sections back as
+// plain files corrupts the notebook. They are therefore shown as empty,
+// read-only directories: the package type is exposed through an xattr and
+// every change is refused with EPERM before anything is queued for upload.
+
+// packageMode is the mode reported for package items.
+const packageMode = fuse.S_IFDIR | 0555
+
+// packageType returns the package type of an item, falling back to a generic
+// name when OneDrive does not report one.
+func packageType(item *graph.DriveItem) string {
+	if item == nil || item.Package == nil {
+		return ""
+	}
+	if item.Package.Type == "" {
+		return "package"
+	}
+	return item.Package.Type
+}
+
+// rejectPackageWrite returns EPERM if the inode is a package, logging where
+// the item can be edited instead. It returns fuse.OK for all other inodes.
+func (f *Filesystem) rejectPackageWrite(operation string, inode *Inode) fuse.Status {
+	if !inode.IsPackage() {
+		return fuse.OK
+	}
+	inode.mu.RLock()
+	kind := packageType(&inode.DriveItem)
+	webURL := inode.DriveItem.WebURL
+	inode.mu.RUnlock()
+	logging.Warn().
+		Str("op", operation).
+		Str("id", inode.ID()).
+		Str("path", inode.Path()).
+		Str("package", kind).
+		Str("webUrl", webURL).
+		Msg("Refusing to modify a OneDrive package; open it in its application instead")
+	return fuse.EPERM
+}
@@ -0,0 +1,76 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_Package_ReadOnlyOpaqueDirectory(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+
+	parent := NewInode("parent", fuse.S_IFDIR|0755, nil)
+	parent.DriveItem.ID = "parent"
+	registerHydratedEntry(t, fs, parent)
+
+	notebook := NewInodeDriveItem(&graph.DriveItem{
+		ID:      "notebook",
+		Name:    "Notes",
+		Parent:  &graph.DriveItemParent{ID: "parent"},
+		Package: &graph.Package{Type: "oneNote"},
+		WebURL:  "https://onedrive.example/notebook",
+	})
+	registerHydratedEntry(t, fs, notebook)
+	fs.InsertChild(parent.ID(), notebook)
+
+	require.True(t, notebook.IsDir())
+	require.Equal(t, uint32(packageMode), notebook.Mode())
+	children, err := fs.GetChildrenID(notebook.ID(), fs.auth)
+	require.NoError(t, err)
+	require.Empty(t, children)
+
+	buf := make([]byte, 64)
+	n, status := fs.GetXAttr(nil, &fuse.InHeader{NodeId: notebook.NodeID()}, xattrPackage, buf)
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, "oneNote", string(buf[:n]))
+
+	var entryOut fuse.EntryOut
+	mkdirIn := &fuse.MkdirIn{InHeader: fuse.InHeader{NodeId: notebook.NodeID()}, Mode: 0755}
+	require.Equal(t, fuse.EPERM, fs.Mkdir(nil, mkdirIn, "Section", &entryOut))
+	var createOut fuse.CreateOut
+	createIn := &fuse.CreateIn{InHeader: fuse.InHeader{NodeId: notebook.NodeID()}, Mode: 0644}
+	require.Equal(t, fuse.EPERM, fs.Create(nil, createIn, "Page.one", &createOut))
+	renameIn := &fuse.RenameIn{InHeader: fuse.InHeader{NodeId: parent.NodeID()}, Newdir: notebook.NodeID()}
+	require.Equal(t, fuse.EPERM, fs.Rename(nil, renameIn, "Notes", "Nested"))
+	var attrOut fuse.AttrOut
+	setAttrIn := &fuse.SetAttrIn{SetAttrInCommon: fuse.SetAttrInCommon{InHeader: fuse.InHeader{NodeId: notebook.NodeID()}, Valid: fuse.FATTR_MODE, Mode: 0777}}
+	require.Equal(t, fuse.EPERM, fs.SetAttr(nil, setAttrIn, &attrOut))
+	require.Equal(t, fuse.EPERM, fs.Rmdir(nil, &fuse.InHeader{NodeId: parent.NodeID()}, "Notes"))
+	require.NotNil(t, fs.GetID("notebook"))
+
+	// Parts of a package reported by delta are never materialised.
+	now := time.Now().UTC()
+	require.NoError(t, fs.applyDelta(&graph.DriveItem{
+		ID:      "section",
+		Name:    "Section.one",
+		ModTime: &now,
+		Parent:  &graph.DriveItemParent{ID: "notebook"},
+		File:    &graph.File{},
+	}))
+	entry, err := fs.GetMetadataEntry("section")
+	require.Error(t, err)
+	require.Nil(t, entry)
+
+	// The package survives a round trip through the metadata store.
+	stored, err := fs.GetMetadataEntry("notebook")
+	require.NoError(t, err)
+	require.Equal(t, "oneNote", stored.PackageType)
+	require.Equal(t, metadata.ItemStateHydrated, stored.State, "refused changes leave nothing to upload")
+	restored := fs.inodeFromMetadataEntry(stored)
+	require.True(t, restored.IsPackage())
+	require.Equal(t, uint32(packageMode), restored.Mode())
+}
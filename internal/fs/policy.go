@@ -0,0 +1,504 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/yaml.v3"
+)
+
+// Offline-availability policy is set per item through extended attributes:
+//
+//   - xattrPin ("always", "never", "smart" or "unset") sets the item's pin
+//     mode. Files pinned "always" are kept hydrated; "never" marks items that
+//     stay online-only. Set on a folder, "always" makes the folder and
+//     everything below it available offline (see SetTreePinMode), and
+//     "unset" or removing the attribute unpins all of it again.
+//   - xattrOverlay ("REMOTE_WINS", "LOCAL_WINS" or "MERGED") overrides the
+//     mount's default overlay policy for the item. The override is stored as
+//     the attribute itself so it persists with the item's metadata entry. Set
+//     on a folder, it applies to everything below that has no override of
+//     its own; xattrEffectiveOverlay reads the policy that applies to an item.
+//   - xattrIgnore, on the mount root only, holds ignore rules: path globs,
+//     one per line, that the tree sync skips in addition to the configured
+//     syncTreeScope exclusions (see SetIgnoreRules).
+//
+// The read-only virtual file .onemount/policy.yml renders the current policy
+// as a PolicyDocument whenever it is opened, so it can be copied to another
+// machine (or kept across a cache wipe) and applied again with the same
+// attributes.
+const (
+	xattrPin              = "user.onemount.pin"
+	xattrOverlay          = "user.onemount.overlay"
+	xattrEffectiveOverlay = "user.onemount.effective_overlay"
+	xattrIgnore           = "user.onemount.ignore"
+	policyFileName        = "policy.yml"
+	policyDocumentVersion = 1
+)
+
+// PolicyDocument is the exported offline-availability setup of a mount. Paths
+// are relative to the mount root and start with "/".
+type PolicyDocument struct {
+	Version    int               `yaml:"version"`
+	Pinned     []string          `yaml:"pinned,omitempty"`
+	OnlineOnly []string          `yaml:"onlineOnly,omitempty"`
+	Overlay    map[string]string `yaml:"overlay,omitempty"`
+	Ignore     []string          `yaml:"ignore,omitempty"`
+}
+
+// policyFile tracks the policy.yml virtual file. The zero value is ready to use.
+type policyFile struct {
+	mu    sync.Mutex
+	inode *Inode
+}
+
+// isPolicyFile reports whether id is the policy.yml file.
+func (p *policyFile) isPolicyFile(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inode != nil && p.inode.ID() == id
+}
+
+// parsePinValue interprets a value written to xattrPin.
+func parsePinValue(value []byte) (metadata.PinMode, error) {
+	mode := metadata.PinMode(strings.ToUpper(strings.TrimSpace(strings.TrimRight(string(value), "\x00"))))
+	if mode == "" {
+		mode = metadata.PinModeUnset
+	}
+	if err := mode.Validate(); err != nil {
+		return "", fmt.Errorf("invalid value %q for %s", value, xattrPin)
+	}
+	return mode, nil
+}
+
+// parseOverlayValue interprets a value written to xattrOverlay.
+func parseOverlayValue(value []byte) (metadata.OverlayPolicy, error) {
+	policy := metadata.OverlayPolicy(strings.ToUpper(strings.TrimSpace(strings.TrimRight(string(value), "\x00"))))
+	if err := policy.Validate(); err != nil {
+		return "", fmt.Errorf("invalid value %q for %s", value, xattrOverlay)
+	}
+	return policy, nil
+}
+
+// overlayOverride returns the per-item overlay policy stored in xattrs, if any.
+func overlayOverride(xattrs map[string][]byte) (metadata.OverlayPolicy, bool) {
+	value, ok := xattrs[xattrOverlay]
+	if !ok {
+		return "", false
+	}
+	policy, err := parseOverlayValue(value)
+	if err != nil {
+		return "", false
+	}
+	return policy, true
+}
+
+// PinMode returns the item's pin mode, UNSET when it has none.
+func (f *Filesystem) PinMode(id string) metadata.PinMode {
+	entry, err := f.GetMetadataEntry(id)
+	if err != nil || entry == nil || entry.Pin.Mode == "" {
+		return metadata.PinModeUnset
+	}
+	return entry.Pin.Mode
+}
+
+// SetPinMode changes the item's pin mode. Setting the current mode again is a
+// no-op. Files pinned ALWAYS are queued for hydration.
+func (f *Filesystem) SetPinMode(id string, mode metadata.PinMode) error {
+	if err := f.persistPinMode(id, mode); err != nil {
+		return err
+	}
+	if mode == metadata.PinModeAlways {
+		f.autoHydratePinned(id)
+	}
+	return nil
+}
+
+// SetTreePinMode changes the pin mode of an item set through xattrPin. For
+// files, packages and modes other than ALWAYS and UNSET it is SetPinMode. A
+// folder pinned ALWAYS is made available offline by a JobHydration job,
+// which lists the folders below that were never opened and pins and
+// hydrates everything below except what is marked NEVER. A folder set to
+// UNSET is unpinned with everything below it that is pinned ALWAYS, and a job
+// still making it available offline is cancelled.
+func (f *Filesystem) SetTreePinMode(id string, mode metadata.PinMode) error {
+	inode := f.GetID(id)
+	if inode == nil || !inode.IsDir() || inode.IsPackage() {
+		return f.SetPinMode(id, mode)
+	}
+	switch mode {
+	case metadata.PinModeAlways:
+		_, err := f.MakeAvailableOffline(id)
+		return err
+	case metadata.PinModeUnset:
+		f.jobs.cancelKey(JobHydration + ":" + id)
+		return f.unpinTree(id)
+	}
+	return f.SetPinMode(id, mode)
+}
+
+// unpinTree sets the folder with the given ID, and everything below it known
+// to the metadata store that is pinned ALWAYS, to UNSET.
+func (f *Filesystem) unpinTree(id string) error {
+	if err := f.persistPinMode(id, metadata.PinModeUnset); err != nil {
+		return err
+	}
+	if f.metadataStore == nil {
+		return nil
+	}
+	seen := map[string]bool{id: true}
+	pending := []string{id}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		entry, err := f.metadataStore.Get(context.Background(), current)
+		if err != nil {
+			continue
+		}
+		if entry.Pin.Mode == metadata.PinModeAlways {
+			if err := f.persistPinMode(current, metadata.PinModeUnset); err != nil {
+				return err
+			}
+		}
+		for _, child := range entry.Children {
+			if !seen[child] {
+				seen[child] = true
+				pending = append(pending, child)
+			}
+		}
+	}
+	return nil
+}
+
+// persistPinMode records the item's pin mode without queueing hydration.
+func (f *Filesystem) persistPinMode(id string, mode metadata.PinMode) error {
+	if err := mode.Validate(); err != nil {
+		return err
+	}
+	if f.metadataStore == nil {
+		return errors.New("metadata store not initialized")
+	}
+	changed := false
+	_, err := f.UpdateMetadataEntry(id, func(entry *metadata.Entry) error {
+		if entry.Pin.Mode == mode {
+			return nil
+		}
+		now := time.Now().UTC()
+		entry.Pin.Mode = mode
+		entry.Pin.Since = &now
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to persist pin mode")
+	}
+	if changed {
+		logging.Info().Str("id", id).Str("pin", string(mode)).Msg("Changed pin mode")
+	}
+	return nil
+}
+
+// pinInheritDepthLimit bounds the walk up the tree for the pin mode a new item
+// inherits.
+const pinInheritDepthLimit = 512
+
+// inheritedPinMode returns the pin mode set on the folder with the given ID
+// or, when it has none, on its nearest ancestor; UNSET when no ancestor has
+// one. A folder marked NEVER below a pinned one stops the inheritance.
+func (f *Filesystem) inheritedPinMode(id string) metadata.PinMode {
+	if f.metadataStore == nil {
+		return metadata.PinModeUnset
+	}
+	for depth := 0; id != "" && depth < pinInheritDepthLimit; depth++ {
+		entry, err := f.metadataStore.Get(context.Background(), id)
+		if err != nil {
+			break
+		}
+		if entry.Pin.Mode != "" && entry.Pin.Mode != metadata.PinModeUnset {
+			return entry.Pin.Mode
+		}
+		id = entry.ParentID
+	}
+	return metadata.PinModeUnset
+}
+
+// inheritPin pins an item that appeared in, or moved into, a folder pinned
+// ALWAYS, and queues it for hydration when it is a file. A folder is pinned
+// too, so that what delta adds below it later inherits the pin from its
+// parent. Items with a pin mode of their own and packages are left alone.
+func (f *Filesystem) inheritPin(id string) {
+	entry, err := f.GetMetadataEntry(id)
+	if err != nil || entry == nil || entry.PackageType != "" {
+		return
+	}
+	if entry.Pin.Mode != "" && entry.Pin.Mode != metadata.PinModeUnset {
+		return
+	}
+	if f.inheritedPinMode(entry.ParentID) != metadata.PinModeAlways {
+		return
+	}
+	if err := f.persistPinMode(id, metadata.PinModeAlways); err != nil {
+		logging.Debug().Err(err).Str("id", id).Msg("Failed to pin item below a pinned folder")
+		return
+	}
+	f.autoHydratePinned(id)
+}
+
+// SetOverlayPolicy overrides the mount's default overlay policy for the item.
+// An empty policy removes the override.
+func (f *Filesystem) SetOverlayPolicy(id string, policy metadata.OverlayPolicy) error {
+	if policy != "" {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+	}
+	inode := f.GetID(id)
+	if inode == nil {
+		return errors.NewNotFoundError("item not found", nil)
+	}
+	inode.mu.Lock()
+	if policy != "" {
+		if inode.xattrs == nil {
+			inode.xattrs = make(map[string][]byte)
+		}
+		inode.xattrs[xattrOverlay] = []byte(policy)
+	} else {
+		delete(inode.xattrs, xattrOverlay)
+	}
+	inode.mu.Unlock()
+
+	if f.metadataStore == nil {
+		return nil
+	}
+	_, err := f.UpdateMetadataEntry(id, func(entry *metadata.Entry) error {
+		if policy != "" {
+			if entry.Xattrs == nil {
+				entry.Xattrs = make(map[string][]byte)
+			}
+			entry.Xattrs[xattrOverlay] = []byte(policy)
+			entry.OverlayPolicy = policy
+			entry.OverlaySet = true
+			return nil
+		}
+		delete(entry.Xattrs, xattrOverlay)
+		entry.OverlayPolicy = f.overlayPolicyDefault()
+		entry.OverlaySet = false
+		return nil
+	})
+	if err != nil && !errors.Is(err, metadata.ErrNotFound) {
+		return errors.Wrap(err, "failed to persist overlay policy")
+	}
+	return nil
+}
+
+// EffectiveOverlayPolicy returns the overlay policy that applies to the item:
+// its own override, otherwise the override of its nearest folder, otherwise
+// the mount's default. It also returns the ID of the item the policy was set
+// on, empty for the default.
+func (f *Filesystem) EffectiveOverlayPolicy(id string) (metadata.OverlayPolicy, string, error) {
+	fallback := f.overlayPolicyDefault()
+	if fallback == "" {
+		fallback = metadata.OverlayPolicyRemoteWins
+	}
+	if f.metadataStore == nil {
+		return fallback, "", nil
+	}
+	policy, source, err := metadata.EffectiveOverlayPolicy(context.Background(), f.metadataStore, id, fallback)
+	if errors.Is(err, metadata.ErrNotFound) {
+		// Not persisted yet: the item has no override, its folder decides
+		inode := f.GetID(id)
+		if inode == nil {
+			return "", "", errors.NewNotFoundError("item not found", nil)
+		}
+		if value, ok := inode.GetXattr(xattrOverlay); ok {
+			if override, err := parseOverlayValue(value); err == nil {
+				return override, id, nil
+			}
+		}
+		policy, source, err = metadata.EffectiveOverlayPolicy(context.Background(), f.metadataStore, inode.ParentID(), fallback)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return policy, source, nil
+}
+
+// policyXAttrStatus maps a policy update error to a FUSE status.
+func policyXAttrStatus(err error, id, name string) fuse.Status {
+	switch {
+	case err == nil:
+		return fuse.OK
+	case errors.Is(err, metadata.ErrNotFound):
+		return fuse.ENOENT
+	default:
+		logging.Warn().Err(err).Str("id", id).Str("name", name).Msg("Failed to update policy attribute")
+		return fuse.EIO
+	}
+}
+
+// applyPolicyXAttr handles writes to the policy attributes. handled is false
+// for any other attribute name.
+func (f *Filesystem) applyPolicyXAttr(inode *Inode, name string, value []byte) (fuse.Status, bool) {
+	switch name {
+	case xattrPin:
+		mode, err := parsePinValue(value)
+		if err != nil {
+			return fuse.EINVAL, true
+		}
+		return policyXAttrStatus(f.SetTreePinMode(inode.ID(), mode), inode.ID(), name), true
+	case xattrOverlay:
+		policy, err := parseOverlayValue(value)
+		if err != nil {
+			return fuse.EINVAL, true
+		}
+		return policyXAttrStatus(f.SetOverlayPolicy(inode.ID(), policy), inode.ID(), name), true
+	case xattrIgnore:
+		if inode.ID() != f.root {
+			return fuse.EINVAL, true
+		}
+		if err := f.SetIgnoreRules(parseIgnoreValue(value)); err != nil {
+			logging.Debug().Err(err).Msg("Rejected ignore rules")
+			return fuse.EINVAL, true
+		}
+		return fuse.OK, true
+	}
+	return fuse.OK, false
+}
+
+// removePolicyXAttr handles removal of the policy attributes. handled is false
+// for any other attribute name.
+func (f *Filesystem) removePolicyXAttr(inode *Inode, name string) (fuse.Status, bool) {
+	switch name {
+	case xattrPin:
+		if f.PinMode(inode.ID()) == metadata.PinModeUnset {
+			return fuse.Status(syscall.ENODATA), true
+		}
+		return policyXAttrStatus(f.SetTreePinMode(inode.ID(), metadata.PinModeUnset), inode.ID(), name), true
+	case xattrOverlay:
+		inode.mu.RLock()
+		_, ok := inode.xattrs[xattrOverlay]
+		inode.mu.RUnlock()
+		if !ok {
+			return fuse.Status(syscall.ENODATA), true
+		}
+		return policyXAttrStatus(f.SetOverlayPolicy(inode.ID(), ""), inode.ID(), name), true
+	case xattrIgnore:
+		if inode.ID() != f.root || len(f.IgnoreRules()) == 0 {
+			return fuse.Status(syscall.ENODATA), true
+		}
+		return policyXAttrStatus(f.SetIgnoreRules(nil), inode.ID(), name), true
+	}
+	return fuse.OK, false
+}
+
+// ExportPolicy collects the pin modes and overlay overrides recorded in the
+// metadata store, and the mount's ignore rules. Virtual items are skipped,
+// and so are items pinned in a folder that is pinned itself, since pinning
+// the folder pins them again.
+func (f *Filesystem) ExportPolicy() (*PolicyDocument, error) {
+	doc := &PolicyDocument{Version: policyDocumentVersion, Ignore: f.IgnoreRules()}
+	if f.db == nil {
+		return doc, nil
+	}
+
+	entries := make(map[string]*metadata.Entry)
+	err := f.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMetadataV2)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var entry metadata.Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return nil
+			}
+			entries[entry.ID] = &entry
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read metadata entries")
+	}
+
+	for _, entry := range entries {
+		if entry.Virtual || entry.ParentID == "" {
+			continue
+		}
+		p, ok := policyEntryPath(entries, entry)
+		if !ok {
+			continue
+		}
+		switch entry.Pin.Mode {
+		case metadata.PinModeAlways:
+			if parent, ok := entries[entry.ParentID]; !ok || parent.Pin.Mode != metadata.PinModeAlways {
+				doc.Pinned = append(doc.Pinned, p)
+			}
+		case metadata.PinModeNever:
+			doc.OnlineOnly = append(doc.OnlineOnly, p)
+		}
+		if policy, ok := overlayOverride(entry.Xattrs); ok {
+			if doc.Overlay == nil {
+				doc.Overlay = make(map[string]string)
+			}
+			doc.Overlay[p] = string(policy)
+		}
+	}
+	sort.Strings(doc.Pinned)
+	sort.Strings(doc.OnlineOnly)
+	return doc, nil
+}
+
+// policyEntryPath builds the mount-relative path of entry from its parent
+// chain. It fails when an ancestor is missing from the store.
+func policyEntryPath(entries map[string]*metadata.Entry, entry *metadata.Entry) (string, bool) {
+	var names []string
+	for current := entry; current.ParentID != ""; {
+		names = append(names, current.Name)
+		parent, ok := entries[current.ParentID]
+		if !ok || len(names) > len(entries) {
+			return "", false
+		}
+		current = parent
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return path.Join(append([]string{"/"}, names...)...), true
+}
+
+// refreshPolicyFile renders the current policy into the policy.yml file.
+func (f *Filesystem) refreshPolicyFile(inode *Inode) {
+	doc, err := f.ExportPolicy()
+	if err != nil {
+		logging.Warn().Err(err).Msg("Failed to export policy")
+		return
+	}
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		logging.Warn().Err(err).Msg("Failed to encode policy")
+		return
+	}
+	inode.SetVirtualContent(data)
+}
+
+// createPolicyFile exposes policy.yml inside dir as a local-only virtual file.
+func (f *Filesystem) createPolicyFile(dir *Inode) {
+	file := NewInode(policyFileName, fuse.S_IFREG|0444, dir)
+	file.SetVirtualContent(nil)
+	f.policy.mu.Lock()
+	f.policy.inode = file
+	f.policy.mu.Unlock()
+	f.RegisterVirtualFile(file)
+}
@@ -0,0 +1,242 @@
+package fs
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func setupPolicyTree(t *testing.T) (*Filesystem, *Inode, *Inode) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+
+	root := NewInode("root", fuse.S_IFDIR|0755, nil)
+	root.DriveItem.ID = "root"
+	registerHydratedEntry(t, fs, root)
+
+	dir := NewInode("Projects", fuse.S_IFDIR|0755, root)
+	dir.DriveItem.ID = "dir"
+	registerHydratedEntry(t, fs, dir)
+
+	file := NewInode("plan.md", fuse.S_IFREG|0644, dir)
+	file.DriveItem.ID = "file"
+	registerHydratedEntry(t, fs, file)
+	return fs, dir, file
+}
+
+func TestUT_FS_Policy_ExportRoundTrip(t *testing.T) {
+	fs, dir, file := setupPolicyTree(t)
+	var hydrated []string
+	fs.testHooks = &FilesystemTestHooks{AutoHydrateHook: func(_ *Filesystem, id string) bool {
+		hydrated = append(hydrated, id)
+		return true
+	}}
+
+	require.NoError(t, fs.SetPinMode(file.ID(), metadata.PinModeAlways))
+	require.Equal(t, []string{file.ID()}, hydrated, "pinning a file queues hydration")
+	require.NoError(t, fs.SetPinMode(dir.ID(), metadata.PinModeNever))
+	require.NoError(t, fs.SetOverlayPolicy(dir.ID(), metadata.OverlayPolicyLocalWins))
+
+	// Persisting the inodes again keeps the policy.
+	fs.persistMetadataEntry(file.ID(), file)
+	fs.persistMetadataEntry(dir.ID(), dir)
+	require.Equal(t, metadata.PinModeAlways, fs.PinMode(file.ID()))
+	entry, err := fs.GetMetadataEntry(dir.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.OverlayPolicyLocalWins, entry.OverlayPolicy)
+
+	doc, err := fs.ExportPolicy()
+	require.NoError(t, err)
+	require.Equal(t, &PolicyDocument{
+		Version:    policyDocumentVersion,
+		Pinned:     []string{"/Projects/plan.md"},
+		OnlineOnly: []string{"/Projects"},
+		Overlay:    map[string]string{"/Projects": "LOCAL_WINS"},
+	}, doc)
+
+	data, err := yaml.Marshal(doc)
+	require.NoError(t, err)
+	var decoded PolicyDocument
+	require.NoError(t, yaml.Unmarshal(data, &decoded))
+	require.Equal(t, *doc, decoded)
+}
+
+func TestUT_FS_Policy_XAttrs(t *testing.T) {
+	fs, dir, file := setupPolicyTree(t)
+	fs.testHooks = &FilesystemTestHooks{AutoHydrateHook: func(*Filesystem, string) bool { return true }}
+
+	status, handled := fs.applyPolicyXAttr(file, xattrPin, []byte("always"))
+	require.True(t, handled)
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, metadata.PinModeAlways, fs.PinMode(file.ID()))
+
+	// Applying the same value again is a no-op.
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	since := entry.Pin.Since
+	status, _ = fs.applyPolicyXAttr(file, xattrPin, []byte("ALWAYS\x00"))
+	require.Equal(t, fuse.OK, status)
+	entry, err = fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, since, entry.Pin.Since)
+
+	status, _ = fs.applyPolicyXAttr(dir, xattrOverlay, []byte("sometimes"))
+	require.Equal(t, fuse.EINVAL, status)
+
+	status, handled = fs.removePolicyXAttr(file, xattrPin)
+	require.True(t, handled)
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, metadata.PinModeUnset, fs.PinMode(file.ID()))
+	status, _ = fs.removePolicyXAttr(dir, xattrOverlay)
+	require.NotEqual(t, fuse.OK, status, "removing an unset override reports ENODATA")
+
+	_, handled = fs.applyPolicyXAttr(file, "user.other", []byte("x"))
+	require.False(t, handled)
+}
+
+func TestUT_FS_Policy_IgnoreRules(t *testing.T) {
+	fs, dir, _ := setupPolicyTree(t)
+	fs.root = "root"
+	root := fs.GetID("root")
+	require.NoError(t, fs.ConfigureSyncTree(SyncTreeScope{Exclude: []string{"Backups/**"}}))
+
+	status, handled := fs.applyPolicyXAttr(root, xattrIgnore, []byte("node_modules\nBackups/**\n\n"))
+	require.True(t, handled)
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, []string{"Backups/**", "node_modules"}, fs.IgnoreRules())
+	require.False(t, fs.syncTreeFilter().descend("/node_modules/pkg"))
+
+	status, _ = fs.applyPolicyXAttr(dir, xattrIgnore, []byte("tmp"))
+	require.Equal(t, fuse.EINVAL, status, "ignore rules are set on the mount root only")
+
+	doc, err := fs.ExportPolicy()
+	require.NoError(t, err)
+	require.Equal(t, []string{"Backups/**", "node_modules"}, doc.Ignore)
+
+	// Only the imported rule is stored, and it is restored on the next mount.
+	entry, err := fs.GetMetadataEntry("root")
+	require.NoError(t, err)
+	require.Equal(t, "node_modules", string(entry.Xattrs[xattrIgnore]))
+	fs.ignoreLoaded = false
+	fs.ignoreRules = nil
+	require.NoError(t, fs.ConfigureSyncTree(SyncTreeScope{}))
+	require.Equal(t, []string{"node_modules"}, fs.IgnoreRules())
+
+	status, handled = fs.removePolicyXAttr(root, xattrIgnore)
+	require.True(t, handled)
+	require.Equal(t, fuse.OK, status)
+	require.Empty(t, fs.IgnoreRules())
+}
+
+func TestUT_FS_Policy_OverlayInheritedFromFolder(t *testing.T) {
+	fs, dir, file := setupPolicyTree(t)
+	notes := NewInode("notes.md", fuse.S_IFREG|0644, dir)
+	notes.DriveItem.ID = "notes"
+	registerHydratedEntry(t, fs, notes)
+
+	policy, source, err := fs.EffectiveOverlayPolicy(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.OverlayPolicyRemoteWins, policy)
+	require.Empty(t, source, "without overrides the mount default applies")
+
+	require.NoError(t, fs.SetOverlayPolicy(dir.ID(), metadata.OverlayPolicyMerged))
+	require.NoError(t, fs.SetOverlayPolicy(notes.ID(), metadata.OverlayPolicyLocalWins))
+	policy, source, err = fs.EffectiveOverlayPolicy(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.OverlayPolicyMerged, policy)
+	require.Equal(t, dir.ID(), source)
+	policy, source, err = fs.EffectiveOverlayPolicy(notes.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.OverlayPolicyLocalWins, policy, "an item's own override wins")
+	require.Equal(t, notes.ID(), source)
+
+	buf := make([]byte, 64)
+	n, status := fs.GetXAttr(nil, &fuse.InHeader{NodeId: file.NodeID()}, xattrEffectiveOverlay, buf)
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, "MERGED", string(buf[:n]))
+
+	require.NoError(t, fs.SetOverlayPolicy(dir.ID(), ""))
+	policy, _, err = fs.EffectiveOverlayPolicy(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.OverlayPolicyRemoteWins, policy, "removing the folder override stops the inheritance")
+}
+
+func TestUT_FS_Policy_PinInheritedByDeltaAdditions(t *testing.T) {
+	fs, dir, file := setupPolicyTree(t)
+	var hydrated []string
+	fs.testHooks = &FilesystemTestHooks{AutoHydrateHook: func(_ *Filesystem, id string) bool {
+		hydrated = append(hydrated, id)
+		return true
+	}}
+	require.NoError(t, fs.SetPinMode(dir.ID(), metadata.PinModeAlways))
+	archive := NewInode("archive", fuse.S_IFDIR|0755, dir)
+	archive.DriveItem.ID = "archive"
+	registerHydratedEntry(t, fs, archive)
+	require.NoError(t, fs.SetPinMode(archive.ID(), metadata.PinModeNever))
+	hydrated = nil
+
+	// A new tree arrives a level per delta item, parents first.
+	for _, item := range []*graph.DriveItem{
+		{ID: "a", Name: "a", Parent: &graph.DriveItemParent{ID: dir.ID()}, Folder: &graph.Folder{}},
+		{ID: "b", Name: "b", Parent: &graph.DriveItemParent{ID: "a"}, Folder: &graph.Folder{}},
+		{ID: "deep", Name: "deep.txt", Parent: &graph.DriveItemParent{ID: "b"}, File: &graph.File{}},
+		{ID: "notebook", Name: "notebook", Parent: &graph.DriveItemParent{ID: "b"}, Package: &graph.Package{Type: "oneNote"}},
+		{ID: "old", Name: "old.txt", Parent: &graph.DriveItemParent{ID: archive.ID()}, File: &graph.File{}},
+		{ID: file.ID(), Name: "plan.md", Parent: &graph.DriveItemParent{ID: "b"}, File: &graph.File{}},
+	} {
+		require.NoError(t, fs.applyDelta(item))
+	}
+
+	require.Equal(t, metadata.PinModeAlways, fs.PinMode("a"))
+	require.Equal(t, metadata.PinModeAlways, fs.PinMode("b"))
+	require.Equal(t, metadata.PinModeAlways, fs.PinMode("deep"))
+	require.Equal(t, metadata.PinModeAlways, fs.PinMode(file.ID()), "items moved into a pinned folder are pinned")
+	require.Equal(t, metadata.PinModeUnset, fs.PinMode("notebook"), "packages are not pinned")
+	require.Equal(t, metadata.PinModeUnset, fs.PinMode("old"), "a folder marked never stops the inheritance")
+	require.Equal(t, []string{"deep", file.ID()}, hydrated, "only the new files are hydrated")
+
+	// An item with a pin mode of its own keeps it when delta changes it.
+	require.NoError(t, fs.SetPinMode("deep", metadata.PinModeNever))
+	require.NoError(t, fs.applyDelta(&graph.DriveItem{ID: "deep", Name: "deep.txt", Parent: &graph.DriveItemParent{ID: "a"}, File: &graph.File{}}))
+	require.Equal(t, metadata.PinModeNever, fs.PinMode("deep"))
+}
+
+func TestUT_FS_Policy_PinFolderXAttrPinsSubtree(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	photos := seedOfflineTree(t, fs)
+	for _, id := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		require.NoError(t, fs.content.Insert(id, []byte("cached")))
+		fs.transitionItemState(id, metadata.ItemStateHydrating)
+		fs.transitionItemState(id, metadata.ItemStateHydrated)
+	}
+	require.NoError(t, fs.SetPinMode("2024", metadata.PinModeNever))
+
+	status, handled := fs.applyPolicyXAttr(photos, xattrPin, []byte("always"))
+	require.True(t, handled)
+	require.Equal(t, fuse.OK, status)
+	jobs := fs.Jobs()
+	require.Len(t, jobs, 1)
+	require.Equal(t, JobHydration, jobs[0].Kind)
+	require.Equal(t, JobCompleted, waitForJob(t, fs, jobs[0].ID).State)
+	for _, id := range []string{"photos", "a.jpg", "b.jpg"} {
+		require.Equal(t, metadata.PinModeAlways, fs.PinMode(id), id)
+	}
+	require.Equal(t, metadata.PinModeNever, fs.PinMode("2024"), "online-only folders stay online-only")
+	require.Equal(t, metadata.PinModeUnset, fs.PinMode("c.jpg"))
+	require.Equal(t, metadata.PinModeUnset, fs.PinMode("notes"))
+
+	status, handled = fs.removePolicyXAttr(photos, xattrPin)
+	require.True(t, handled)
+	require.Equal(t, fuse.OK, status)
+	for _, id := range []string{"photos", "a.jpg", "b.jpg"} {
+		require.Equal(t, metadata.PinModeUnset, fs.PinMode(id), id)
+	}
+	require.Equal(t, metadata.PinModeNever, fs.PinMode("2024"), "unpinning leaves other modes alone")
+	status, _ = fs.removePolicyXAttr(photos, xattrPin)
+	require.Equal(t, fuse.Status(syscall.ENODATA), status)
+}
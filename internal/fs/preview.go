@@ -0,0 +1,281 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	_ "image/gif" // decoders of the formats Graph renders previews in
+	_ "image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Previews let indexers and preview tools look at cloud-only files without
+// downloading them. For images, videos and documents, OneDrive renders a
+// large thumbnail (the first page of a document); OneMount converts it to
+// PNG and keeps it in the thumbnail cache, keyed by the file's ETag so a
+// changed file gets a new preview. Previews are read through the D-Bus
+// GetPreview method or as <mount>/.onemount-preview/<path>.png. The preview
+// tree is built as it is looked up: it lists only what was looked up before,
+// and looking up a preview fetches it, so a missing one is simply not there.
+
+const (
+	previewDirName = ".onemount-preview"
+	previewExt     = ".png"
+	// previewSize is the Graph thumbnail size previews are rendered from
+	previewSize    = "large"
+	previewTimeout = 30 * time.Second
+)
+
+// Preview kinds, by what OneDrive renders for them.
+const (
+	PreviewImage    = "image"
+	PreviewVideo    = "video"
+	PreviewDocument = "document"
+)
+
+// previewKinds maps the file extensions OneDrive renders previews of to their
+// kind.
+var previewKinds = map[string]string{
+	".jpg": PreviewImage, ".jpeg": PreviewImage, ".png": PreviewImage, ".gif": PreviewImage,
+	".bmp": PreviewImage, ".tif": PreviewImage, ".tiff": PreviewImage, ".heic": PreviewImage,
+	".webp": PreviewImage,
+	".mp4":  PreviewVideo, ".mov": PreviewVideo, ".m4v": PreviewVideo, ".avi": PreviewVideo,
+	".wmv": PreviewVideo, ".mkv": PreviewVideo,
+	".pdf": PreviewDocument, ".doc": PreviewDocument, ".docx": PreviewDocument,
+	".xls": PreviewDocument, ".xlsx": PreviewDocument, ".ppt": PreviewDocument,
+	".pptx": PreviewDocument, ".odt": PreviewDocument, ".ods": PreviewDocument,
+	".odp": PreviewDocument, ".rtf": PreviewDocument,
+}
+
+// previewKind returns the kind of preview OneDrive renders of the file name,
+// or "" when it renders none.
+func previewKind(name string) string {
+	return previewKinds[strings.ToLower(filepath.Ext(name))]
+}
+
+// previewNode is what an inode of the preview tree shows.
+type previewNode struct {
+	item string // ID of the folder or file shown
+	etag string // ETag the preview of a file was rendered from
+}
+
+// previewTree tracks the inodes under .onemount-preview. The zero value is
+// ready to use.
+type previewTree struct {
+	mu    sync.Mutex
+	nodes map[string]previewNode // by inode ID
+}
+
+func (t *previewTree) node(id string) (previewNode, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node, ok := t.nodes[id]
+	return node, ok
+}
+
+func (t *previewTree) set(id string, node previewNode) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.nodes == nil {
+		t.nodes = make(map[string]previewNode)
+	}
+	t.nodes[id] = node
+}
+
+// previewFetcher returns the rendering of an item OneDrive made.
+type previewFetcher func(ctx context.Context, id string) ([]byte, error)
+
+// fetchGraphPreview fetches the large thumbnail of an item from Graph.
+func (f *Filesystem) fetchGraphPreview(ctx context.Context, id string) ([]byte, error) {
+	return graph.GetThumbnailContentWithContext(ctx, id, previewSize, f.auth)
+}
+
+// previewCacheKey returns the thumbnail cache size key of the preview of a
+// file with the given ETag.
+func previewCacheKey(etag string) string {
+	sum := sha256.Sum256([]byte(etag))
+	return "preview-" + hex.EncodeToString(sum[:6])
+}
+
+// toPNG converts a rendering to PNG, unless it is PNG already.
+func toPNG(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) {
+		return data, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode preview")
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, errors.Wrap(err, "failed to encode preview")
+	}
+	return out.Bytes(), nil
+}
+
+// previewOf returns the PNG preview of a file and the ETag it was rendered
+// from, from the thumbnail cache or fetched with fetch. The file's content is
+// never downloaded.
+func (f *Filesystem) previewOf(ctx context.Context, inode *Inode, fetch previewFetcher) ([]byte, string, error) {
+	if inode.IsDir() {
+		return nil, "", errors.NewValidationError("folders have no preview", nil)
+	}
+	if previewKind(inode.Name()) == "" {
+		return nil, "", errors.NewValidationError("OneDrive renders no preview of "+inode.Name(), nil)
+	}
+	id := inode.ID()
+	if isLocalID(id) {
+		return nil, "", errors.NewValidationError("the file is not uploaded yet", nil)
+	}
+	inode.mu.RLock()
+	etag := inode.DriveItem.ETag
+	inode.mu.RUnlock()
+
+	key := previewCacheKey(etag)
+	if f.thumbnails.HasThumbnail(id, key) {
+		return f.thumbnails.Get(id, key), etag, nil
+	}
+	if f.IsOffline() {
+		return nil, "", errors.NewNetworkError("cannot fetch previews while offline", nil)
+	}
+	data, err := fetch(ctx, id)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to fetch preview")
+	}
+	data, err = toPNG(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := f.thumbnails.Insert(id, key, data); err != nil {
+		logging.Warn().Err(err).Str("id", id).Msg("Failed to cache preview")
+	}
+	return data, etag, nil
+}
+
+// Preview renders a preview of the file at path, relative to the mount root,
+// and returns the path of the PNG in the thumbnail cache.
+func (f *Filesystem) Preview(ctx context.Context, path string) (string, error) {
+	id := f.GetIDByPath(path)
+	if id == "" {
+		return "", errors.NewNotFoundError("path not found: "+path, nil)
+	}
+	inode := f.GetID(id)
+	if inode == nil {
+		return "", errors.NewNotFoundError("item not found", nil)
+	}
+	_, etag, err := f.previewOf(ctx, inode, f.fetchGraphPreview)
+	if err != nil {
+		return "", err
+	}
+	return f.thumbnails.thumbnailPath(id, previewCacheKey(etag)), nil
+}
+
+// CreatePreviewDir exposes previews as .onemount-preview at the mount root.
+func (f *Filesystem) CreatePreviewDir() {
+	root := f.GetID(f.root)
+	if root == nil {
+		logging.Warn().Msg("Root not available, preview directory not created")
+		return
+	}
+	dir := NewInode(previewDirName, fuse.S_IFDIR|0555, root)
+	dir.SetVirtualContent(nil)
+	f.RegisterVirtualFile(dir)
+	f.previews.set(dir.ID(), previewNode{item: f.root})
+}
+
+// lookupPreview resolves name in a directory of the preview tree: a folder
+// of the folder shown, or <file>.png for a file in it.
+func (f *Filesystem) lookupPreview(parent *Inode, shown string, name string) *Inode {
+	for _, childID := range parent.GetChildren() {
+		child := f.GetID(childID)
+		if child == nil || !strings.EqualFold(child.Name(), name) {
+			continue
+		}
+		if child.IsDir() || f.refreshPreview(child) {
+			return child
+		}
+		return nil
+	}
+
+	if item, _ := f.GetChild(shown, strings.ToLower(name), f.auth); item != nil && item.IsDir() {
+		dir := NewInode(item.Name(), fuse.S_IFDIR|0555, parent)
+		dir.SetVirtualContent(nil)
+		f.previews.set(dir.ID(), previewNode{item: item.ID()})
+		f.addPreviewNode(parent, dir)
+		return dir
+	}
+	if !strings.HasSuffix(strings.ToLower(name), previewExt) {
+		return nil
+	}
+	fileName := name[:len(name)-len(previewExt)]
+	item, _ := f.GetChild(shown, strings.ToLower(fileName), f.auth)
+	if item == nil || item.IsDir() {
+		return nil
+	}
+	file := NewInode(item.Name()+previewExt, fuse.S_IFREG|0444, parent)
+	file.SetVirtualContent(nil)
+	f.previews.set(file.ID(), previewNode{item: item.ID()})
+	if !f.refreshPreview(file) {
+		return nil
+	}
+	f.addPreviewNode(parent, file)
+	return file
+}
+
+// refreshPreview renders the preview a file of the preview tree shows again
+// when the file changed, reporting whether there is one.
+func (f *Filesystem) refreshPreview(file *Inode) bool {
+	node, ok := f.previews.node(file.ID())
+	item := f.GetID(node.item)
+	if !ok || item == nil {
+		return false
+	}
+	item.mu.RLock()
+	etag := item.DriveItem.ETag
+	item.mu.RUnlock()
+	if node.etag != "" && node.etag == etag {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(f.ctx, previewTimeout)
+	defer cancel()
+	data, etag, err := f.previewOf(ctx, item, f.fetchGraphPreview)
+	if err != nil {
+		logging.Debug().Err(err).Str("id", item.ID()).Msg("No preview available")
+		return false
+	}
+	file.SetVirtualContent(data)
+	node.etag = etag
+	f.previews.set(file.ID(), node)
+	return true
+}
+
+// addPreviewNode makes an inode of the preview tree visible. Like all of the
+// preview tree it is kept in memory only.
+func (f *Filesystem) addPreviewNode(parent, inode *Inode) {
+	f.virtualMu.Lock()
+	if f.virtualFiles == nil {
+		f.virtualFiles = make(map[string]*Inode)
+	}
+	f.virtualFiles[inode.ID()] = inode
+	f.virtualMu.Unlock()
+	f.metadata.Store(inode.ID(), inode)
+	f.InsertNodeID(inode)
+
+	parent.mu.Lock()
+	parent.children = append(parent.children, inode.ID())
+	if inode.IsDir() {
+		parent.subdir++
+	}
+	parent.mu.Unlock()
+}
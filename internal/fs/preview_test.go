@@ -0,0 +1,127 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// setupPreviewTree returns a filesystem holding Photos/beach.jpg and
+// Photos/notes.txt, none of them downloaded.
+func setupPreviewTree(t *testing.T) (*Filesystem, *Inode) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+	fs.ctx = context.Background()
+	fs.thumbnails = NewThumbnailCache(t.TempDir())
+
+	root := NewInode("root", fuse.S_IFDIR|0755, nil)
+	root.DriveItem.ID = "root"
+	fs.root = root.ID()
+	registerHydratedEntry(t, fs, root)
+	dir := NewInode("Photos", fuse.S_IFDIR|0755, root)
+	dir.DriveItem.ID = "photos"
+	registerHydratedEntry(t, fs, dir)
+	photo := NewInode("beach.jpg", fuse.S_IFREG|0644, dir)
+	photo.DriveItem.ID = "beach"
+	photo.DriveItem.ETag = "etag-1"
+	registerHydratedEntry(t, fs, photo)
+	notes := NewInode("notes.txt", fuse.S_IFREG|0644, dir)
+	notes.DriveItem.ID = "notes"
+	registerHydratedEntry(t, fs, notes)
+	root.children = []string{dir.ID()}
+	dir.children = []string{photo.ID(), notes.ID()}
+	return fs, photo
+}
+
+// jpegRendering returns a JPEG as OneDrive renders thumbnails.
+func jpegRendering(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.RGBA{R: 200, A: 255})
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	return buf.Bytes()
+}
+
+func TestUT_FS_Preview_RendersPNGOncePerVersion(t *testing.T) {
+	fs, photo := setupPreviewTree(t)
+	fetches := 0
+	fetch := func(_ context.Context, id string) ([]byte, error) {
+		require.Equal(t, "beach", id)
+		fetches++
+		return jpegRendering(t), nil
+	}
+
+	data, etag, err := fs.previewOf(context.Background(), photo, fetch)
+	require.NoError(t, err)
+	require.Equal(t, "etag-1", etag)
+	img, format, err := image.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, "png", format)
+	require.Equal(t, image.Rect(0, 0, 4, 3), img.Bounds())
+	require.False(t, fs.content.HasContent(photo.ID()), "the file itself is not downloaded")
+
+	_, _, err = fs.previewOf(context.Background(), photo, fetch)
+	require.NoError(t, err)
+	require.Equal(t, 1, fetches, "the preview is cached")
+
+	photo.DriveItem.ETag = "etag-2"
+	_, _, err = fs.previewOf(context.Background(), photo, fetch)
+	require.NoError(t, err)
+	require.Equal(t, 2, fetches, "a changed file is rendered again")
+
+	notes := fs.GetID("notes")
+	_, _, err = fs.previewOf(context.Background(), notes, func(context.Context, string) ([]byte, error) {
+		return nil, errors.New("must not be fetched")
+	})
+	require.Error(t, err, "OneDrive renders no preview of text files")
+}
+
+func TestUT_FS_Preview_LookupThroughPreviewDir(t *testing.T) {
+	fs, photo := setupPreviewTree(t)
+	_, _, err := fs.previewOf(context.Background(), photo, func(context.Context, string) ([]byte, error) {
+		return jpegRendering(t), nil
+	})
+	require.NoError(t, err)
+
+	fs.CreatePreviewDir()
+	var previewDir *Inode
+	for _, id := range fs.GetID("root").GetChildren() {
+		if child := fs.GetID(id); child != nil && child.Name() == previewDirName {
+			previewDir = child
+		}
+	}
+	require.NotNil(t, previewDir)
+
+	lookup := func(parent *Inode, name string) (*Inode, fuse.Status) {
+		var out fuse.EntryOut
+		status := fs.Lookup(nil, &fuse.InHeader{NodeId: parent.NodeID()}, name, &out)
+		return fs.GetNodeID(out.NodeId), status
+	}
+	dir, status := lookup(previewDir, "Photos")
+	require.Equal(t, fuse.OK, status)
+	require.True(t, dir.IsDir())
+
+	preview, status := lookup(dir, "beach.jpg.png")
+	require.Equal(t, fuse.OK, status)
+	require.True(t, preview.IsVirtual())
+	content := preview.ReadVirtualContent(0, int(preview.Size()))
+	require.True(t, bytes.HasPrefix(content, []byte("\x89PNG")))
+	require.Equal(t, []string{preview.ID()}, dir.GetChildren(), "looked up previews are listed")
+
+	again, status := lookup(dir, "beach.jpg.png")
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, preview.ID(), again.ID())
+
+	_, status = lookup(dir, "notes.txt.png")
+	require.Equal(t, fuse.ENOENT, status)
+	_, status = lookup(dir, "beach.jpg")
+	require.Equal(t, fuse.ENOENT, status)
+}
@@ -0,0 +1,147 @@
+package fs
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Read-ahead tuning. Once a handle has issued readAheadTrigger consecutive
+// sequential reads, the next part of the cached file is read in the
+// background so that the page cache already holds it when the kernel asks.
+// The window starts at readAheadMinWindow and doubles on every further
+// sequential read up to readAheadMaxWindow; a seek resets it.
+const (
+	readAheadTrigger   = 2
+	readAheadMinWindow = 256 * 1024
+	readAheadMaxWindow = 8 * 1024 * 1024
+	readAheadChunkSize = 1024 * 1024
+)
+
+// readAheadKey identifies an open handle on an inode.
+type readAheadKey struct {
+	nodeID uint64
+	fh     uint64
+}
+
+// readAheadState is the access pattern observed on a single open handle.
+type readAheadState struct {
+	mu           sync.Mutex
+	nextOffset   int64 // offset a sequential read would start at
+	streak       int   // consecutive sequential reads
+	window       int64 // current read-ahead window
+	prefetchedTo int64 // end of the range already scheduled for prefetch
+	inflight     bool  // a prefetch is currently running
+}
+
+// readAheadTracker tracks per-handle access patterns and read-ahead counters.
+// The zero value is ready to use.
+type readAheadTracker struct {
+	handles sync.Map // readAheadKey -> *readAheadState
+
+	sequentialReads atomic.Uint64
+	randomReads     atomic.Uint64
+	prefetches      atomic.Uint64
+	prefetchedBytes atomic.Uint64
+}
+
+// ReadAheadStats reports how reads were classified and how much data was
+// prefetched ahead of sequential readers.
+type ReadAheadStats struct {
+	SequentialReads uint64
+	RandomReads     uint64
+	Prefetches      uint64
+	PrefetchedBytes uint64
+}
+
+// observe records a read of size bytes at offset on a handle and returns the
+// range to prefetch, if any. The caller must call done once that prefetch
+// finishes.
+func (t *readAheadTracker) observe(key readAheadKey, offset int64, size int, fileSize int64) (start, length int64, ok bool) {
+	val, _ := t.handles.LoadOrStore(key, &readAheadState{})
+	state := val.(*readAheadState)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	end := offset + int64(size)
+	// A fresh handle reading from offset 0 counts as the start of a sequential run.
+	if offset == state.nextOffset {
+		state.streak++
+		t.sequentialReads.Add(1)
+	} else {
+		state.streak = 0
+		state.window = 0
+		state.prefetchedTo = 0
+		t.randomReads.Add(1)
+	}
+	state.nextOffset = end
+
+	if state.streak < readAheadTrigger || state.inflight {
+		return 0, 0, false
+	}
+	if state.window == 0 {
+		state.window = readAheadMinWindow
+	} else if state.window < readAheadMaxWindow {
+		state.window = min(state.window*2, readAheadMaxWindow)
+	}
+
+	target := min(end+state.window, fileSize)
+	start = max(state.prefetchedTo, end)
+	if start >= target {
+		return 0, 0, false
+	}
+	state.prefetchedTo = target
+	state.inflight = true
+	return start, target - start, true
+}
+
+// done marks the prefetch for a handle as finished.
+func (t *readAheadTracker) done(key readAheadKey) {
+	if val, ok := t.handles.Load(key); ok {
+		state := val.(*readAheadState)
+		state.mu.Lock()
+		state.inflight = false
+		state.mu.Unlock()
+	}
+}
+
+// release forgets the access pattern of a closed handle.
+func (t *readAheadTracker) release(key readAheadKey) {
+	t.handles.Delete(key)
+}
+
+// scheduleReadAhead prefetches the next window of a sequentially read file
+// from the content cache in the background.
+func (f *Filesystem) scheduleReadAhead(fd *os.File, key readAheadKey, offset int64, size int, fileSize int64) {
+	start, length, ok := f.readAhead.observe(key, offset, size, fileSize)
+	if !ok {
+		return
+	}
+
+	f.readAhead.prefetches.Add(1)
+	go func() {
+		defer f.readAhead.done(key)
+		buf := make([]byte, min(length, readAheadChunkSize))
+		for pos := start; pos < start+length; {
+			n, err := fd.ReadAt(buf[:min(int64(len(buf)), start+length-pos)], pos)
+			f.readAhead.prefetchedBytes.Add(uint64(n))
+			if err != nil {
+				// EOF, or the content was evicted and its descriptor closed;
+				// either way there is nothing more to prefetch.
+				return
+			}
+			pos += int64(n)
+		}
+	}()
+}
+
+// ReadAheadStats returns the read-ahead counters.
+func (f *Filesystem) ReadAheadStats() ReadAheadStats {
+	return ReadAheadStats{
+		SequentialReads: f.readAhead.sequentialReads.Load(),
+		RandomReads:     f.readAhead.randomReads.Load(),
+		Prefetches:      f.readAhead.prefetches.Load(),
+		PrefetchedBytes: f.readAhead.prefetchedBytes.Load(),
+	}
+}
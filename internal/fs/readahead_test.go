@@ -0,0 +1,99 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_ReadAhead_SequentialDetection(t *testing.T) {
+	var tracker readAheadTracker
+	key := readAheadKey{nodeID: 1, fh: 7}
+	const chunk = 128 * 1024
+	const size = 64 * 1024 * 1024
+
+	_, _, ok := tracker.observe(key, 0, chunk, size)
+	require.False(t, ok, "a single read is not a sequential pattern yet")
+
+	start, length, ok := tracker.observe(key, chunk, chunk, size)
+	require.True(t, ok)
+	require.Equal(t, int64(2*chunk), start)
+	require.Equal(t, int64(readAheadMinWindow), length)
+
+	// No second prefetch while the first is still running.
+	_, _, ok = tracker.observe(key, 2*chunk, chunk, size)
+	require.False(t, ok)
+	tracker.done(key)
+
+	// The window grows and continues from where the last prefetch ended.
+	start, length, ok = tracker.observe(key, 3*chunk, chunk, size)
+	require.True(t, ok)
+	require.Equal(t, int64(2*chunk+readAheadMinWindow), start)
+	require.Equal(t, int64(4*chunk+2*readAheadMinWindow)-start, length)
+	tracker.done(key)
+
+	require.Equal(t, uint64(4), tracker.sequentialReads.Load())
+}
+
+func TestUT_FS_ReadAhead_SeekResetsWindow(t *testing.T) {
+	var tracker readAheadTracker
+	key := readAheadKey{nodeID: 1, fh: 1}
+	const size = 64 * 1024 * 1024
+
+	tracker.observe(key, 0, 4096, size)
+	_, _, ok := tracker.observe(key, 4096, 4096, size)
+	require.True(t, ok)
+	tracker.done(key)
+
+	_, _, ok = tracker.observe(key, 10*1024*1024, 4096, size)
+	require.False(t, ok, "a seek breaks the sequential run")
+	require.Equal(t, uint64(1), tracker.randomReads.Load())
+
+	// Handles are tracked independently.
+	other := readAheadKey{nodeID: 1, fh: 2}
+	_, _, ok = tracker.observe(other, 0, 4096, size)
+	require.False(t, ok)
+}
+
+func TestUT_FS_ReadAhead_ClampedToFileSize(t *testing.T) {
+	var tracker readAheadTracker
+	key := readAheadKey{nodeID: 3, fh: 3}
+
+	tracker.observe(key, 0, 4096, 10000)
+	start, length, ok := tracker.observe(key, 4096, 4096, 10000)
+	require.True(t, ok)
+	require.Equal(t, int64(8192), start)
+	require.Equal(t, int64(10000-8192), length)
+	tracker.done(key)
+
+	_, _, ok = tracker.observe(key, 8192, 1808, 10000)
+	require.False(t, ok, "nothing left to prefetch at end of file")
+}
+
+func TestUT_FS_ReadAhead_PrefetchesFromCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "content")
+	data := make([]byte, 2*readAheadMinWindow)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	fd, err := os.Open(path)
+	require.NoError(t, err)
+	defer fd.Close()
+
+	f := &Filesystem{}
+	key := readAheadKey{nodeID: 9, fh: 9}
+	f.scheduleReadAhead(fd, key, 0, 4096, int64(len(data)))
+	f.scheduleReadAhead(fd, key, 4096, 4096, int64(len(data)))
+
+	require.Eventually(t, func() bool {
+		return f.ReadAheadStats().PrefetchedBytes == readAheadMinWindow
+	}, time.Second, 10*time.Millisecond)
+	stats := f.ReadAheadStats()
+	require.Equal(t, uint64(1), stats.Prefetches)
+	require.Equal(t, uint64(2), stats.SequentialReads)
+
+	f.readAhead.release(key)
+	_, tracked := f.readAhead.handles.Load(key)
+	require.False(t, tracked)
+}
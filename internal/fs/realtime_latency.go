@@ -0,0 +1,201 @@
+package fs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Realtime latency is the time from a change on OneDrive, as timestamped by
+// Graph in the item's lastModifiedDateTime, to the delta cycle that made it
+// visible in the mount. While realtime notifications are enabled, every item
+// a delta cycle applies adds a sample; stats report the distribution of the
+// samples of the last hour. When the 95th percentile of the samples of the
+// last SLO period stays above the latency SLO for a whole period, a latency
+// event warns that changes arrive late, and another one follows once they
+// arrive in time again.
+//
+// Items that reappear in a delta without a new change, such as after a
+// permission change, carry an old modification time; gaps longer than
+// realtimeLatencyMaxSample are skipped as such. The first cycle after the
+// mount starts or comes back online is not sampled either, as it catches up
+// on changes made while nothing was listening.
+
+// Defaults of the latency SLO.
+const (
+	DefaultRealtimeLatencySLO       = 2 * time.Minute
+	DefaultRealtimeLatencySLOPeriod = 10 * time.Minute
+)
+
+const (
+	realtimeLatencyCapacity  = 512
+	realtimeLatencyWindow    = time.Hour
+	realtimeLatencyMaxSample = time.Hour
+)
+
+// RealtimeLatencyStats describes how long remote changes took to appear.
+type RealtimeLatencyStats struct {
+	Samples     int
+	P50         time.Duration
+	P95         time.Duration
+	Max         time.Duration
+	SLO         time.Duration // 0 when the SLO is not checked
+	SLOBreached bool          // the SLO was missed for a whole period
+}
+
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// realtimeLatency keeps the latest samples in a ring buffer. The zero value
+// is ready to use.
+type realtimeLatency struct {
+	mu          sync.Mutex
+	samples     []latencySample
+	next        int
+	breachSince time.Time // first check the SLO was missed, zero when met
+	alerted     bool      // the missed SLO was reported
+}
+
+// add records the latency of a change made at modified that became visible
+// at visible, reporting whether it was kept as a sample.
+func (r *realtimeLatency) add(modified, visible time.Time) bool {
+	latency := visible.Sub(modified)
+	if latency > realtimeLatencyMaxSample {
+		return false
+	}
+	if latency < 0 {
+		// Clock skew between Graph and this machine
+		latency = 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sample := latencySample{at: visible, latency: latency}
+	if len(r.samples) < realtimeLatencyCapacity {
+		r.samples = append(r.samples, sample)
+		return true
+	}
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % realtimeLatencyCapacity
+	return true
+}
+
+// latenciesSince returns the sorted latencies of the samples taken after
+// since. The caller holds mu.
+func (r *realtimeLatency) latenciesSince(since time.Time) []time.Duration {
+	latencies := make([]time.Duration, 0, len(r.samples))
+	for _, sample := range r.samples {
+		if sample.at.After(since) {
+			latencies = append(latencies, sample.latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+// stats returns the distribution of the samples of the last hour.
+func (r *realtimeLatency) stats(now time.Time) RealtimeLatencyStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	latencies := r.latenciesSince(now.Add(-realtimeLatencyWindow))
+	stats := RealtimeLatencyStats{Samples: len(latencies), SLOBreached: r.alerted}
+	if len(latencies) > 0 {
+		stats.P50 = percentile(latencies, 50)
+		stats.P95 = percentile(latencies, 95)
+		stats.Max = latencies[len(latencies)-1]
+	}
+	return stats
+}
+
+// check compares the 95th percentile of the samples of the last period with
+// slo. It reports whether the SLO was just found missed for a whole period,
+// or just met again after that.
+func (r *realtimeLatency) check(now time.Time, slo, period time.Duration) (missed, recovered bool, p95 time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	latencies := r.latenciesSince(now.Add(-period))
+	if len(latencies) == 0 {
+		return false, false, 0
+	}
+	p95 = percentile(latencies, 95)
+	if p95 <= slo {
+		recovered = r.alerted
+		r.breachSince, r.alerted = time.Time{}, false
+		return false, recovered, p95
+	}
+	if r.breachSince.IsZero() {
+		r.breachSince = now
+	}
+	if !r.alerted && now.Sub(r.breachSince) >= period {
+		r.alerted = true
+		return true, false, p95
+	}
+	return false, false, p95
+}
+
+// latencySLO returns the configured SLO and its period, with a zero SLO when
+// latency is not measured.
+func (f *Filesystem) latencySLO() (time.Duration, time.Duration) {
+	opts := f.realtimeOptions
+	if opts == nil || !opts.Enabled || opts.PollingOnly {
+		return 0, 0
+	}
+	period := opts.LatencySLOPeriod
+	if period <= 0 {
+		period = DefaultRealtimeLatencySLOPeriod
+	}
+	return opts.LatencySLO, period
+}
+
+// recordRealtimeLatency samples the latency of the items a delta cycle made
+// visible at visible and checks the SLO.
+func (f *Filesystem) recordRealtimeLatency(items map[string]*graph.DriveItem, visible time.Time) {
+	if f.realtimeOptions == nil || !f.realtimeOptions.Enabled {
+		return
+	}
+	sampled := 0
+	for _, item := range items {
+		if item.ModTime != nil && f.latency.add(*item.ModTime, visible) {
+			sampled++
+		}
+	}
+	slo, period := f.latencySLO()
+	if sampled == 0 || slo <= 0 {
+		return
+	}
+	missed, recovered, p95 := f.latency.check(visible, slo, period)
+	switch {
+	case missed:
+		logging.Warn().
+			Dur("p95", p95).
+			Dur("slo", slo).
+			Dur("period", period).
+			Msg("Remote changes arrive later than the realtime latency SLO")
+		f.emitActivity(ActivityLatency, "", fmt.Sprintf("remote changes took %s to appear (95th percentile), over the %s objective for %s",
+			p95.Round(time.Second), slo, period))
+	case recovered:
+		logging.Info().Dur("p95", p95).Dur("slo", slo).Msg("Remote changes arrive within the realtime latency SLO again")
+		f.emitActivity(ActivityLatency, "", fmt.Sprintf("remote changes appear within the %s objective again", slo))
+	}
+}
+
+// RealtimeLatency returns how long remote changes took to appear in the
+// mount over the last hour.
+func (f *Filesystem) RealtimeLatency() RealtimeLatencyStats {
+	stats := f.latency.stats(time.Now())
+	stats.SLO, _ = f.latencySLO()
+	return stats
+}
@@ -0,0 +1,77 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+func changedItems(visible time.Time, latencies ...time.Duration) map[string]*graph.DriveItem {
+	items := make(map[string]*graph.DriveItem, len(latencies))
+	for i, latency := range latencies {
+		modified := visible.Add(-latency)
+		items[string(rune('a'+i))] = &graph.DriveItem{ID: string(rune('a' + i)), ModTime: &modified}
+	}
+	return items
+}
+
+func TestUT_FS_RealtimeLatency_Distribution(t *testing.T) {
+	f := &Filesystem{realtimeOptions: &RealtimeOptions{Enabled: true}}
+	now := time.Now()
+
+	f.recordRealtimeLatency(changedItems(now.Add(-2*time.Hour), time.Second), now.Add(-2*time.Hour))
+	f.recordRealtimeLatency(changedItems(now, 2*time.Second, 4*time.Second, 30*time.Second, 3*time.Hour), now)
+
+	stats := f.RealtimeLatency()
+	require.Equal(t, 3, stats.Samples, "samples older than an hour and unchanged items are left out")
+	require.Equal(t, 4*time.Second, stats.P50)
+	require.Equal(t, 30*time.Second, stats.Max)
+	require.Zero(t, stats.SLO)
+	require.False(t, stats.SLOBreached)
+
+	f.realtimeOptions.PollingOnly = true
+	f.recordRealtimeLatency(changedItems(now, time.Second), now)
+	require.Equal(t, 4, f.RealtimeLatency().Samples, "latency is measured while polling too")
+}
+
+func TestUT_FS_RealtimeLatency_SustainedMissEmitsEvent(t *testing.T) {
+	f := &Filesystem{realtimeOptions: &RealtimeOptions{
+		Enabled:          true,
+		LatencySLO:       time.Minute,
+		LatencySLOPeriod: 10 * time.Minute,
+	}}
+	start := time.Now().Add(-30 * time.Minute)
+	latencyEvents := func() int {
+		count := 0
+		for _, event := range f.RecentEvents(0) {
+			if event.Type == ActivityLatency {
+				count++
+			}
+		}
+		return count
+	}
+
+	// A single late change does not raise the alarm
+	f.recordRealtimeLatency(changedItems(start, 5*time.Minute), start)
+	require.Zero(t, latencyEvents())
+
+	// Late changes for a whole period do
+	f.recordRealtimeLatency(changedItems(start.Add(5*time.Minute), 3*time.Minute), start.Add(5*time.Minute))
+	require.Zero(t, latencyEvents())
+	f.recordRealtimeLatency(changedItems(start.Add(10*time.Minute), 2*time.Minute), start.Add(10*time.Minute))
+	require.Equal(t, 1, latencyEvents())
+	require.True(t, f.latency.stats(start.Add(10*time.Minute)).SLOBreached)
+
+	// Reported once, and once more when changes arrive in time again
+	f.recordRealtimeLatency(changedItems(start.Add(12*time.Minute), 2*time.Minute), start.Add(12*time.Minute))
+	require.Equal(t, 1, latencyEvents())
+	fast := make([]time.Duration, 40)
+	for i := range fast {
+		fast[i] = time.Second
+	}
+	f.recordRealtimeLatency(changedItems(start.Add(15*time.Minute), fast...), start.Add(15*time.Minute))
+	require.Equal(t, 2, latencyEvents())
+	require.False(t, f.latency.stats(start.Add(15*time.Minute)).SLOBreached)
+}
@@ -27,6 +27,12 @@ type RealtimeOptions struct {
 	// When Socket.IO is healthy, polling occurs much less frequently.
 	// When Socket.IO fails, polling falls back to this interval.
 	FallbackInterval time.Duration
+
+	// LatencySLO is how long a remote change may take to appear in the mount.
+	// A latency event is emitted when changes arrive later for a whole
+	// LatencySLOPeriod. Zero only measures latency without checking it.
+	LatencySLO       time.Duration
+	LatencySLOPeriod time.Duration
 }
 
 // ConfigureRealtime stores the realtime options for the filesystem.
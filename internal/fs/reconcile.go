@@ -0,0 +1,241 @@
+package fs
+
+import (
+	"context"
+	gopath "path"
+	"strings"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// When one folder "looks wrong", ReconcileSubtree enumerates it and every
+// folder below it from OneDrive again and repairs the local state to match,
+// instead of wiping the whole cache. Items missing locally are added, entries
+// whose name, location, size or eTag disagree with OneDrive are updated the
+// way a delta would update them, items OneDrive no longer has are removed,
+// and folder child lists are relinked. Items with local changes that are not
+// uploaded yet are left alone.
+
+// Kinds of ReconcileFix.
+const (
+	ReconcileAdded    = "added"
+	ReconcileUpdated  = "updated"
+	ReconcileRemoved  = "removed"
+	ReconcileRelinked = "relinked"
+)
+
+// ReconcileFix is one repair made by ReconcileSubtree.
+type ReconcileFix struct {
+	Kind string
+	Path string
+}
+
+// ReconcileReport summarizes a ReconcileSubtree run.
+type ReconcileReport struct {
+	Folders int // folders enumerated
+	Fixes   []ReconcileFix
+	Errors  []string // folders that could not be enumerated
+}
+
+// reconcileRemote lists the children of a folder on OneDrive.
+type reconcileRemote interface {
+	GetItemChildren(id string) ([]*graph.DriveItem, error)
+}
+
+// graphReconcileRemote forwards reconcile calls to the Graph API.
+type graphReconcileRemote struct {
+	ctx  context.Context
+	auth *graph.Auth
+}
+
+func (c graphReconcileRemote) GetItemChildren(id string) ([]*graph.DriveItem, error) {
+	return graph.GetItemChildrenWithContext(c.ctx, id, c.auth)
+}
+
+// ReconcileSubtree repairs the folder at path and everything below it against
+// a fresh enumeration from OneDrive.
+func (f *Filesystem) ReconcileSubtree(ctx context.Context, path string) (ReconcileReport, error) {
+	return f.reconcileSubtreeWith(ctx, path, graphReconcileRemote{ctx: ctx, auth: f.auth})
+}
+
+func (f *Filesystem) reconcileSubtreeWith(ctx context.Context, path string, remote reconcileRemote) (ReconcileReport, error) {
+	var report ReconcileReport
+	if f.IsOffline() {
+		return report, errors.NewNetworkError("cannot reconcile while offline", nil)
+	}
+	id := f.GetIDByPath(path)
+	if id == "" {
+		return report, errors.NewNotFoundError("path not found: "+path, nil)
+	}
+	if inode := f.GetID(id); inode == nil || !inode.IsDir() {
+		return report, errors.NewValidationError("not a folder: "+path, nil)
+	}
+
+	queue := []reconcileFolderRef{{id: id, path: gopath.Clean("/" + path)}}
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		folder := queue[0]
+		queue = queue[1:]
+		subfolders, err := f.reconcileFolder(ctx, folder, remote, &report)
+		if err != nil {
+			logging.Warn().Err(err).Str("path", folder.path).Msg("Could not reconcile folder")
+			report.Errors = append(report.Errors, folder.path+": "+err.Error())
+			continue
+		}
+		report.Folders++
+		queue = append(queue, subfolders...)
+	}
+
+	logging.Info().Str("path", path).Int("folders", report.Folders).Int("fixes", len(report.Fixes)).
+		Int("errors", len(report.Errors)).Msg("Reconciled subtree")
+	return report, nil
+}
+
+// reconcileFolderRef is a folder queued for reconciling. Paths are tracked
+// along the walk since items built from deltas do not know theirs.
+type reconcileFolderRef struct {
+	id   string
+	path string
+}
+
+// reconcileFolder repairs the children of one folder and returns its
+// subfolders.
+func (f *Filesystem) reconcileFolder(ctx context.Context, folder reconcileFolderRef, remote reconcileRemote, report *ReconcileReport) ([]reconcileFolderRef, error) {
+	id := folder.id
+	items, err := remote.GetItemChildren(id)
+	if err != nil {
+		return nil, err
+	}
+	fix := func(kind, name string) {
+		report.Fixes = append(report.Fixes, ReconcileFix{Kind: kind, Path: gopath.Join(folder.path, name)})
+	}
+
+	listed := make(map[string]bool)
+	if entry, err := f.GetMetadataEntry(id); err == nil {
+		for _, childID := range entry.Children {
+			listed[childID] = true
+		}
+	}
+	if parent := f.GetID(id); parent != nil {
+		for _, childID := range parent.GetChildren() {
+			listed[childID] = true
+		}
+	}
+
+	var subfolders []reconcileFolderRef
+	remoteIDs := make(map[string]bool, len(items))
+	for _, item := range items {
+		if item == nil || item.ID == "" || item.Deleted != nil {
+			continue
+		}
+		remoteIDs[item.ID] = true
+		item.Name = f.normalizeName(item.Name)
+		if item.IsDir() {
+			subfolders = append(subfolders, reconcileFolderRef{id: item.ID, path: gopath.Join(folder.path, item.Name)})
+		}
+		if item.Parent == nil {
+			item.Parent = &graph.DriveItemParent{}
+		}
+		item.Parent.ID = id
+		if item.Parent.Path == "" {
+			item.Parent.Path = "/drive/root:" + strings.TrimSuffix(folder.path, "/")
+		}
+
+		if inode := f.GetID(item.ID); inode != nil && inode.HasChanges() {
+			continue
+		}
+		prior, err := f.GetMetadataEntry(item.ID)
+		switch {
+		case err != nil || prior.State == metadata.ItemStateDeleted:
+			if err := f.applyDelta(item); err != nil {
+				return nil, err
+			}
+			fix(ReconcileAdded, item.Name)
+		case f.entryDisagrees(prior, item):
+			if err := f.applyDelta(item); err != nil {
+				return nil, err
+			}
+			fix(ReconcileUpdated, item.Name)
+		case !listed[item.ID]:
+			_ = f.addChildToParent(ctx, id, prior)
+			fix(ReconcileRelinked, item.Name)
+		}
+	}
+
+	for childID := range listed {
+		if remoteIDs[childID] || isLocalID(childID) || f.isChildPendingRemote(childID) {
+			continue
+		}
+		child := f.GetID(childID)
+		if child != nil && (child.HasChanges() || child.IsVirtual()) {
+			continue
+		}
+		entry, err := f.GetMetadataEntry(childID)
+		if err == nil && entry.Virtual {
+			continue
+		}
+		if err == nil && entry.ParentID == id && entry.State != metadata.ItemStateDeleted {
+			_ = f.removeChildFromParent(ctx, id, childID, entry.ItemType == metadata.ItemKindDirectory)
+			f.markEntryDeleted(childID)
+			f.DeleteID(childID)
+			fix(ReconcileRemoved, entry.Name)
+			continue
+		}
+		// Listed here, but gone or filed under another folder.
+		name := childID
+		if err == nil {
+			name = entry.Name
+		}
+		_ = f.removeChildFromParent(ctx, id, childID, err == nil && entry.ItemType == metadata.ItemKindDirectory)
+		f.removeInodeChild(id, childID)
+		fix(ReconcileRelinked, name)
+	}
+
+	children := make(map[string]*Inode, len(remoteIDs))
+	for childID := range remoteIDs {
+		child := f.GetID(childID)
+		if child == nil {
+			child = f.ensureInodeFromMetadataStore(childID)
+		}
+		if child != nil {
+			children[strings.ToLower(child.Name())] = child
+		}
+	}
+	f.cacheChildrenFromMap(id, children)
+	return subfolders, nil
+}
+
+// entryDisagrees reports whether the stored entry or the inode of an item
+// differs from what OneDrive reports for it.
+func (f *Filesystem) entryDisagrees(entry *metadata.Entry, item *graph.DriveItem) bool {
+	if entry.Name != item.Name || entry.ParentID != item.Parent.ID ||
+		(item.ETag != "" && entry.ETag != item.ETag) {
+		return true
+	}
+	if !item.IsDir() && entry.Size != item.Size {
+		return true
+	}
+	inode := f.GetID(item.ID)
+	return inode != nil && (inode.Name() != item.Name || (!item.IsDir() && inode.Size() != item.Size))
+}
+
+// removeInodeChild drops childID from the cached child list of the folder.
+func (f *Filesystem) removeInodeChild(parentID, childID string) {
+	parent := f.GetID(parentID)
+	if parent == nil {
+		return
+	}
+	parent.mu.Lock()
+	defer parent.mu.Unlock()
+	for i, existing := range parent.children {
+		if existing == childID {
+			parent.children = append(parent.children[:i], parent.children[i+1:]...)
+			return
+		}
+	}
+}
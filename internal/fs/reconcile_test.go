@@ -0,0 +1,115 @@
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReconcileRemote serves folder listings from memory.
+type fakeReconcileRemote map[string][]*graph.DriveItem
+
+func (r fakeReconcileRemote) GetItemChildren(id string) ([]*graph.DriveItem, error) {
+	return r[id], nil
+}
+
+func reconcileFile(id, name, etag string, size uint64) *graph.DriveItem {
+	return &graph.DriveItem{ID: id, Name: name, ETag: etag, Size: size, File: &graph.File{}}
+}
+
+func TestUT_FS_Reconcile_RepairsSubtree(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+
+	root := NewInode("root", fuse.S_IFDIR|0755, nil)
+	root.DriveItem.ID = "root"
+	registerHydratedEntry(t, fs, root)
+	fs.root = root.ID()
+
+	files := map[string]*Inode{}
+	for _, name := range []string{"keep.txt", "stale.txt", "old.txt"} {
+		file := NewInode(name, fuse.S_IFREG|0644, root)
+		file.DriveItem.ID = name
+		file.DriveItem.ETag = "etag-1"
+		file.DriveItem.Size = 4
+		registerHydratedEntry(t, fs, file)
+		root.children = append(root.children, file.ID())
+		files[name] = file
+	}
+	// Known to the store but missing from the child list.
+	sub := NewInode("sub", fuse.S_IFDIR|0755, root)
+	sub.DriveItem.ID = "sub"
+	registerHydratedEntry(t, fs, sub)
+
+	remote := fakeReconcileRemote{
+		"root": {
+			reconcileFile("keep.txt", "keep.txt", "etag-1", 4),
+			reconcileFile("old.txt", "old.txt", "etag-2", 9),
+			reconcileFile("new.txt", "new.txt", "etag-1", 3),
+			{ID: "sub", Name: "sub", Folder: &graph.Folder{}},
+		},
+		"sub": {reconcileFile("deep.txt", "deep.txt", "etag-1", 5)},
+	}
+
+	report, err := fs.reconcileSubtreeWith(context.Background(), "/", remote)
+	require.NoError(t, err)
+	<-fs.uploads.deletionQueue
+	require.Equal(t, 2, report.Folders)
+	require.Empty(t, report.Errors)
+
+	kinds := map[string]string{}
+	for _, fix := range report.Fixes {
+		kinds[fix.Path] = fix.Kind
+	}
+	require.Equal(t, map[string]string{
+		"/new.txt":      ReconcileAdded,
+		"/old.txt":      ReconcileUpdated,
+		"/stale.txt":    ReconcileRemoved,
+		"/sub":          ReconcileRelinked,
+		"/sub/deep.txt": ReconcileAdded,
+	}, kinds)
+
+	require.ElementsMatch(t, []string{"keep.txt", "old.txt", "new.txt", "sub"}, fs.GetID("root").GetChildren())
+	require.Nil(t, fs.GetID("stale.txt"))
+	entry, err := fs.GetMetadataEntry("stale.txt")
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateDeleted, entry.State)
+	require.Equal(t, uint64(9), fs.GetID("old.txt").Size())
+	require.NotNil(t, childNamed(fs, "sub", "deep.txt"))
+}
+
+func TestUT_FS_Reconcile_KeepsLocalChanges(t *testing.T) {
+	fs, file := setupFrozenFile(t)
+	fs.root = "parent"
+
+	report, err := fs.reconcileSubtreeWith(context.Background(), "/", fakeReconcileRemote{})
+	require.NoError(t, err)
+	require.Empty(t, report.Fixes, "unuploaded local changes must survive a reconcile")
+	require.NotNil(t, fs.GetID(file.ID()))
+}
+
+func TestUT_FS_Reconcile_ComparesNormalizedNames(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	require.NoError(t, fs.SetNameNormalization(NameNormalizationNFC))
+
+	root := NewInode("root", fuse.S_IFDIR|0755, nil)
+	root.DriveItem.ID = "root"
+	registerHydratedEntry(t, fs, root)
+	fs.root = root.ID()
+	file := NewInode("Café.txt", fuse.S_IFREG|0644, root)
+	file.DriveItem.ID = "cafe"
+	file.DriveItem.ETag = "etag-1"
+	file.DriveItem.Size = 4
+	registerHydratedEntry(t, fs, file)
+	root.children = append(root.children, file.ID())
+
+	// OneDrive lists the name decomposed, as uploaded from macOS
+	remote := fakeReconcileRemote{"root": {reconcileFile("cafe", "Café.txt", "etag-1", 4)}}
+	report, err := fs.reconcileSubtreeWith(context.Background(), "/", remote)
+	require.NoError(t, err)
+	require.Empty(t, report.Fixes)
+	require.Equal(t, "Café.txt", fs.GetID("cafe").Name())
+}
@@ -0,0 +1,266 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// When two computers change a file at the same time, OneDrive keeps the
+// version that arrived first and saves the other beside it as
+// "Name-COMPUTER.ext", COMPUTER being the Windows name of the computer that
+// lost. Delta sync recognizes such copies when they appear next to a file
+// named "Name.ext" and pairs the two, so they show up with the other
+// conflicts in "onemount status" and the conflict dialog. There, keeping the
+// local version keeps the original and deletes the copy, keeping the remote
+// version moves the content of the copy into the original (which keeps its
+// version history) and deletes the copy, and keeping both only forgets the
+// pairing.
+//
+// Windows computer names are upper case, at most 15 characters of letters,
+// digits and hyphens. A file named like "notes-V2.txt" next to "notes.txt"
+// looks the same and is paired as well; keeping both dismisses it.
+
+// remoteConflictDevice matches the computer name OneDrive appends to its
+// conflict copies.
+var remoteConflictDevice = regexp.MustCompile(`^[A-Z0-9][A-Z0-9-]{0,14}$`)
+
+// remoteConflictCandidate is an original a conflict copy may have been made
+// from.
+type remoteConflictCandidate struct {
+	original string // name of the original
+	device   string // computer whose version the copy holds
+}
+
+// parseRemoteConflictCopy returns the originals the file name could be a
+// OneDrive conflict copy of, the one with the shortest computer name first.
+// Computer names may contain hyphens, so "Report-DESKTOP-AB12CD.docx" could
+// come from "Report-DESKTOP.docx" or "Report.docx".
+func parseRemoteConflictCopy(name string) []remoteConflictCandidate {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	var candidates []remoteConflictCandidate
+	for i := strings.LastIndex(stem, "-"); i > 0; i = strings.LastIndex(stem[:i], "-") {
+		device := stem[i+1:]
+		if !remoteConflictDevice.MatchString(device) {
+			break
+		}
+		// A number alone is how people and programs tell versions apart
+		if strings.IndexFunc(device, func(r rune) bool { return r >= 'A' && r <= 'Z' }) < 0 {
+			continue
+		}
+		candidates = append(candidates, remoteConflictCandidate{original: stem[:i] + ext, device: device})
+	}
+	return candidates
+}
+
+// adoptRemoteConflictCopy pairs the file id with its original when it is a
+// conflict copy OneDrive made, and flags the original as conflicted.
+func (f *Filesystem) adoptRemoteConflictCopy(id string) {
+	copyInode := f.GetID(id)
+	if copyInode == nil || copyInode.IsDir() || f.ConflictPeer(id) != "" {
+		return
+	}
+	candidates := parseRemoteConflictCopy(copyInode.Name())
+	if len(candidates) == 0 {
+		return
+	}
+	parentID := copyInode.ParentID()
+	parent := f.GetID(parentID)
+	if parent == nil {
+		return
+	}
+
+	siblings := make(map[string]*Inode)
+	for _, childID := range parent.GetChildren() {
+		if child := f.GetID(childID); child != nil && childID != id && !child.IsDir() {
+			siblings[strings.ToLower(child.Name())] = child
+		}
+	}
+	for _, candidate := range candidates {
+		original := siblings[strings.ToLower(candidate.original)]
+		if original == nil || f.GetID(f.ConflictPeer(original.ID())) != nil {
+			continue
+		}
+		_, err := f.UpdateMetadataEntry(id, func(entry *metadata.Entry) error {
+			entry.ConflictDevice = candidate.device
+			return nil
+		})
+		if err != nil {
+			logging.Debug().Err(err).Str("id", id).Msg("Failed to record conflict copy made by OneDrive")
+			return
+		}
+		f.linkConflictPair(original.ID(), id)
+		logging.Info().
+			Str("original", original.Path()).
+			Str("copy", copyInode.Name()).
+			Str("device", candidate.device).
+			Msg("Found a conflict copy made by OneDrive")
+		f.MarkFileConflict(original.ID(), remoteConflictMessage(copyInode.Name(), candidate.device))
+		return
+	}
+}
+
+// remoteConflictMessage explains a conflict OneDrive resolved with a copy.
+func remoteConflictMessage(copyName, device string) string {
+	return fmt.Sprintf("OneDrive saved the version from %s as %s", device, copyName)
+}
+
+// remoteConflictCopy returns the conflict copy OneDrive made of the original
+// id and the computer its version came from, or empty strings.
+func (f *Filesystem) remoteConflictCopy(id string) (string, string) {
+	peer := f.ConflictPeer(id)
+	if peer == "" || f.GetID(peer) == nil {
+		return "", ""
+	}
+	entry, err := f.GetMetadataEntry(peer)
+	if err != nil || entry.ConflictDevice == "" || entry.ConflictPeer != id ||
+		entry.State == metadata.ItemStateDeleted {
+		return "", ""
+	}
+	return peer, entry.ConflictDevice
+}
+
+// remoteConflictDetails fills in the copy OneDrive made as the remote
+// version of the original.
+func (f *Filesystem) remoteConflictDetails(details *ConflictDetails, copyID, device string) {
+	copyInode := f.GetID(copyID)
+	details.PeerPath = copyInode.Path()
+	details.RemoteAvailable = true
+	details.RemoteSize = copyInode.Size()
+	details.RemoteModTime = time.Unix(int64(copyInode.ModTime()), 0)
+	details.RemoteModifiedBy = device
+	if details.Message == "" {
+		details.Message = remoteConflictMessage(copyInode.Name(), device)
+	}
+}
+
+// resolveRemoteConflictCopy resolves the pairing of the original id with the
+// conflict copy OneDrive made of it.
+func (f *Filesystem) resolveRemoteConflictCopy(ctx context.Context, id, copyID, choice string, remote itemRemote) error {
+	if choice != ConflictKeepBoth && f.IsOffline() {
+		return errors.NewNetworkError("the conflict copy cannot be deleted while offline", nil)
+	}
+	switch choice {
+	case ConflictKeepLocal:
+		f.removeRemoteConflictCopy(id, copyID)
+		return nil
+	case ConflictKeepRemote:
+		if err := f.takeConflictCopyContent(ctx, id, copyID, remote); err != nil {
+			return err
+		}
+		f.removeRemoteConflictCopy(id, copyID)
+		return nil
+	case ConflictKeepBoth:
+		f.unlinkConflictPair(id, copyID)
+		return nil
+	}
+	return errors.NewValidationError("unknown conflict choice "+choice, nil)
+}
+
+// takeConflictCopyContent replaces the content of the original with that of
+// the conflict copy and uploads it.
+func (f *Filesystem) takeConflictCopyContent(ctx context.Context, id, copyID string, remote itemRemote) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	original := f.GetID(id)
+	if original == nil {
+		return errors.NewNotFoundError("conflicted item not found", nil)
+	}
+	src, err := f.openConflictCopy(id, copyID, remote)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the conflict copy")
+	}
+	defer src.Close()
+
+	if f.uploads != nil {
+		f.uploads.CancelUpload(id)
+	}
+	if err := f.content.Delete(id); err != nil {
+		return err
+	}
+	size, err := f.content.InsertStream(id, src)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	original.mu.Lock()
+	original.DriveItem.Size = uint64(size)
+	original.DriveItem.ModTime = &now
+	original.mu.Unlock()
+	f.keepLocalVersion(original)
+	return nil
+}
+
+// openConflictCopy opens the content of the conflict copy of the original
+// id: the cached content, or else a download of it.
+func (f *Filesystem) openConflictCopy(id, copyID string, remote itemRemote) (io.ReadCloser, error) {
+	path := f.content.contentPath(copyID)
+	if !f.content.HasContent(copyID) {
+		var err error
+		if path, err = f.fetchConflictRemoteWith(id, remote); err != nil {
+			return nil, err
+		}
+	}
+	return os.Open(path)
+}
+
+// removeRemoteConflictCopy deletes the conflict copy of the original id
+// locally and on OneDrive.
+func (f *Filesystem) removeRemoteConflictCopy(id, copyID string) {
+	copyInode := f.GetID(copyID)
+	if copyInode == nil {
+		return
+	}
+	f.unlinkConflictPair(id, copyID)
+	f.planRemoteDelete(copyInode)
+	f.DeleteID(copyID)
+	if err := f.content.Delete(copyID); err != nil {
+		logging.Warn().Err(err).Str("id", copyID).Msg("Failed to delete content of conflict copy")
+	}
+}
+
+// unlinkConflictPair forgets that original and copy belong together.
+func (f *Filesystem) unlinkConflictPair(originalID, copyID string) {
+	for _, id := range []string{originalID, copyID} {
+		_, err := f.UpdateMetadataEntry(id, func(entry *metadata.Entry) error {
+			entry.ConflictPeer = ""
+			entry.ConflictDevice = ""
+			return nil
+		})
+		if err != nil {
+			logging.Debug().Err(err).Str("id", id).Msg("Failed to forget conflict peer")
+		}
+	}
+}
+
+// forgetRemoteConflictCopy clears the conflict of the original when the
+// conflict copy OneDrive made of it is deleted some other way.
+func (f *Filesystem) forgetRemoteConflictCopy(copyID string) {
+	entry, err := f.GetMetadataEntry(copyID)
+	if err != nil || entry.ConflictDevice == "" || entry.ConflictPeer == "" {
+		return
+	}
+	originalID := entry.ConflictPeer
+	f.unlinkConflictPair(originalID, copyID)
+	f.statusM.Lock()
+	status, ok := f.statuses[originalID]
+	if ok && status.Status == StatusConflict {
+		delete(f.statuses, originalID)
+	}
+	f.statusM.Unlock()
+	if ok {
+		f.notifyStatusChange(originalID)
+	}
+}
@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_RemoteConflictCopy_ParsesComputerNames(t *testing.T) {
+	require.Equal(t, []remoteConflictCandidate{
+		{original: "Report-DESKTOP.docx", device: "AB12CD"},
+		{original: "Report.docx", device: "DESKTOP-AB12CD"},
+	}, parseRemoteConflictCopy("Report-DESKTOP-AB12CD.docx"))
+	require.Equal(t, []remoteConflictCandidate{{original: "notes", device: "LAPTOP7"}},
+		parseRemoteConflictCopy("notes-LAPTOP7"))
+
+	for _, name := range []string{"photo-1.jpg", "my-notes.txt", "Report.docx", "plan-WORKSTATIONNUMBER7.xlsx"} {
+		require.Empty(t, parseRemoteConflictCopy(name), name)
+	}
+}
+
+// setupRemoteConflictCopy registers "plan.xlsx" and applies the delta that
+// brings OneDrive's conflict copy of it.
+func setupRemoteConflictCopy(t *testing.T) (*Filesystem, *Inode, *Inode) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+	fs.uploads = nil // uploads of kept versions are not queued in these tests
+	parent := NewInodeDriveItem(&graph.DriveItem{ID: "parent", Name: "Documents", Folder: &graph.Folder{}})
+	registerHydratedEntry(t, fs, parent)
+	original := NewInodeDriveItem(&graph.DriveItem{
+		ID: "plan", Name: "plan.xlsx", File: &graph.File{}, Size: 5,
+		Parent: &graph.DriveItemParent{ID: "parent"},
+	})
+	registerHydratedEntry(t, fs, original)
+	fs.InsertChild("parent", original)
+	require.NoError(t, fs.content.Insert("plan", []byte("mine!")))
+
+	require.NoError(t, fs.applyDelta(&graph.DriveItem{
+		ID: "plan-copy", Name: "plan-DESKTOP-AB12CD.xlsx", File: &graph.File{}, Size: 6, ETag: "etag-1",
+		Parent: &graph.DriveItemParent{ID: "parent"},
+	}))
+	copied := fs.GetID("plan-copy")
+	require.NotNil(t, copied)
+	require.NoError(t, fs.content.Insert("plan-copy", []byte("theirs")))
+	return fs, original, copied
+}
+
+func TestUT_FS_RemoteConflictCopy_AdoptedFromDelta(t *testing.T) {
+	fs, original, copied := setupRemoteConflictCopy(t)
+	require.Equal(t, []string{original.ID()}, fs.Conflicts())
+	require.Equal(t, copied.ID(), fs.ConflictPeer(original.ID()))
+
+	details, err := fs.conflictDetailsWith(original.ID(), &fakeRemote{})
+	require.NoError(t, err)
+	require.Equal(t, "OneDrive saved the version from DESKTOP-AB12CD as plan-DESKTOP-AB12CD.xlsx", details.Message)
+	require.Equal(t, copied.Path(), details.PeerPath)
+	require.Equal(t, "DESKTOP-AB12CD", details.RemoteModifiedBy)
+	require.True(t, details.RemoteAvailable)
+	require.Equal(t, uint64(6), details.RemoteSize)
+}
+
+func TestUT_FS_RemoteConflictCopy_KeepRemoteMovesContentIntoOriginal(t *testing.T) {
+	fs, original, copied := setupRemoteConflictCopy(t)
+	require.NoError(t, fs.resolveConflictChoiceWith(context.Background(), original.ID(), ConflictKeepRemote, &fakeRemote{}))
+
+	require.Equal(t, "theirs", string(fs.content.Get(original.ID())))
+	require.Equal(t, uint64(6), original.Size())
+	entry, err := fs.GetMetadataEntry(original.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateDirtyLocal, entry.State, "the original is uploaded with the copy's content")
+	require.Empty(t, entry.ConflictPeer)
+	require.Nil(t, fs.GetID(copied.ID()), "the copy is deleted")
+	require.Empty(t, fs.Conflicts())
+}
+
+func TestUT_FS_RemoteConflictCopy_KeepBothForgetsPairing(t *testing.T) {
+	fs, original, copied := setupRemoteConflictCopy(t)
+	require.NoError(t, fs.resolveConflictChoiceWith(context.Background(), original.ID(), ConflictKeepBoth, &fakeRemote{}))
+
+	require.Equal(t, "mine!", string(fs.content.Get(original.ID())))
+	require.NotNil(t, fs.GetID(copied.ID()))
+	require.Empty(t, fs.ConflictPeer(original.ID()))
+	require.Empty(t, fs.Conflicts())
+}
+
+func TestUT_FS_RemoteConflictCopy_DeletingCopyClearsConflict(t *testing.T) {
+	fs, original, copied := setupRemoteConflictCopy(t)
+	require.NoError(t, fs.applyDelta(&graph.DriveItem{
+		ID: copied.ID(), Name: copied.Name(), Deleted: &graph.Deleted{},
+		Parent: &graph.DriveItemParent{ID: "parent"},
+	}))
+	require.Empty(t, fs.Conflicts())
+	require.Empty(t, fs.ConflictPeer(original.ID()))
+}
@@ -0,0 +1,254 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/fs/offline"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// After a long time offline, replaying the journal of offline changes can
+// overwrite edits made elsewhere or fail on folders deleted in the meantime.
+// With reviewOfflineReplay set, a mount coming back online keeps the journal
+// instead of replaying it, until ApplyOfflineReplay ("onemount replay
+// --apply") replays it as a JobReplay job. PlanOfflineReplay ("onemount
+// replay --plan") predicts what replaying each change will do from the
+// current state of the items on OneDrive, which it only reads.
+
+// ActivityReplayHeld reports offline changes kept for review when the mount
+// came back online.
+const ActivityReplayHeld = "replay-held"
+
+// Outcomes of replaying a journaled change, as predicted by PlanOfflineReplay.
+const (
+	ReplayApplies   = "apply"    // the change is made on OneDrive
+	ReplaySkipped   = "skip"     // there is nothing left to do
+	ReplayConflicts = "conflict" // OneDrive changed too, the item becomes a conflict
+	ReplayFails     = "fail"     // OneDrive refuses the change
+)
+
+// ReplayPlanItem is the predicted outcome of replaying a journaled change.
+type ReplayPlanItem struct {
+	Type    string // create, modify, delete or rename
+	Path    string
+	OldPath string // for renames, where the item was before
+	State   string // replay state of the journal entry
+	Outcome string
+	Reason  string
+}
+
+// replayPlanClient is the read-only subset of the Graph API the plan is
+// checked against. Tests substitute a fake.
+type replayPlanClient interface {
+	GetItem(id string) (*graph.DriveItem, error)
+	GetItemChild(parentID, name string) (*graph.DriveItem, error)
+}
+
+// SetReviewOfflineReplay sets whether a mount coming back online keeps the
+// changes made while offline until ApplyOfflineReplay instead of replaying
+// them right away.
+func (f *Filesystem) SetReviewOfflineReplay(enabled bool) {
+	f.Lock()
+	f.reviewReplay = enabled
+	f.Unlock()
+}
+
+// holdOfflineReplay reports whether the journal is kept for review instead of
+// being replayed now that the mount is back online.
+func (f *Filesystem) holdOfflineReplay() bool {
+	f.RLock()
+	review := f.reviewReplay
+	f.RUnlock()
+	if !review {
+		return false
+	}
+	changes, err := f.getOfflineChanges(f.mountContext())
+	if err != nil || len(changes) == 0 {
+		return false
+	}
+	logging.Warn().Int("changes", len(changes)).
+		Msg("Keeping the changes made offline for review, replay them with onemount replay --apply")
+	f.emitActivity(ActivityReplayHeld, "", fmt.Sprintf("%d offline changes wait for onemount replay --apply", len(changes)))
+	return true
+}
+
+// PlanOfflineReplay predicts what replaying each change in the journal would
+// do, oldest first, without changing anything.
+func (f *Filesystem) PlanOfflineReplay(ctx context.Context) ([]ReplayPlanItem, error) {
+	if f.IsOffline() {
+		return nil, errors.NewNetworkError("OneDrive cannot be reached, try again once the mount is online", nil)
+	}
+	return f.planOfflineReplayWith(ctx, graphRenameClient{ctx: ctx, auth: f.auth})
+}
+
+func (f *Filesystem) planOfflineReplayWith(ctx context.Context, client replayPlanClient) ([]ReplayPlanItem, error) {
+	journal, err := f.offlineJournal()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := journal.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan := make([]ReplayPlanItem, 0, len(changes))
+	for _, change := range changes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		item := ReplayPlanItem{Type: change.Type, State: string(change.CurrentState())}
+		switch inode := f.GetID(change.ID); {
+		case inode != nil:
+			item.Path = inode.Path()
+		case change.NewPath != "":
+			item.Path = change.NewPath
+		default:
+			item.Path = change.Path
+		}
+		if change.Type == "rename" {
+			item.OldPath = change.OldPath
+		}
+		item.Outcome, item.Reason, err = f.predictReplay(change, client)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not check "+item.Path+" on OneDrive")
+		}
+		plan = append(plan, item)
+	}
+	return plan, nil
+}
+
+// predictReplay predicts the outcome of replaying the change and why.
+func (f *Filesystem) predictReplay(change *OfflineChange, client replayPlanClient) (outcome, reason string, err error) {
+	if change.CurrentState() == offline.StateConflicted {
+		return ReplaySkipped, "conflicted in an earlier replay: " + change.LastError, nil
+	}
+	inode := f.GetID(change.ID)
+	switch change.Type {
+	case "create", "modify":
+		if inode == nil {
+			return ReplaySkipped, "removed locally since", nil
+		}
+		if isLocalID(change.ID) {
+			return f.predictUpload(inode, client)
+		}
+		remote, err := client.GetItem(change.ID)
+		if errors.IsNotFoundError(err) {
+			return ReplayConflicts, "deleted on OneDrive", nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if f.changedRemotely(change.ID, remote) {
+			return ReplayConflicts, "changed on OneDrive since it was last synced", nil
+		}
+		return ReplayApplies, "uploads the local content", nil
+
+	case "delete":
+		if isLocalID(change.ID) {
+			return ReplaySkipped, "never uploaded", nil
+		}
+		remote, err := client.GetItem(change.ID)
+		if errors.IsNotFoundError(err) {
+			return ReplaySkipped, "already deleted on OneDrive", nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if f.changedRemotely(change.ID, remote) {
+			return ReplayConflicts, "changed on OneDrive since it was last synced, deleting it discards that change", nil
+		}
+		return ReplayApplies, "deletes it on OneDrive", nil
+
+	case "rename":
+		if inode == nil {
+			return ReplaySkipped, "removed locally since", nil
+		}
+		if isLocalID(change.ID) {
+			return ReplaySkipped, "uploaded under its new name", nil
+		}
+		parentID, name := inode.ParentID(), inode.Name()
+		if isLocalID(parentID) {
+			return ReplayApplies, "moves it once its new folder is uploaded", nil
+		}
+		remote, err := client.GetItem(change.ID)
+		if errors.IsNotFoundError(err) {
+			return ReplayConflicts, "deleted on OneDrive", nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if remoteAtLocation(remote, parentID, name) {
+			return ReplaySkipped, "already renamed on OneDrive", nil
+		}
+		if _, err := client.GetItem(parentID); errors.IsNotFoundError(err) {
+			return ReplayFails, "the destination folder was deleted on OneDrive, the item is moved back", nil
+		} else if err != nil {
+			return "", "", err
+		}
+		existing, err := client.GetItemChild(parentID, name)
+		if err != nil && !errors.IsNotFoundError(err) {
+			return "", "", err
+		}
+		if existing != nil && existing.ID != "" && existing.ID != change.ID {
+			return ReplayConflicts, fmt.Sprintf("the name %q is taken on OneDrive", name), nil
+		}
+		return ReplayApplies, "moves it on OneDrive", nil
+	}
+	return ReplayFails, "unknown change type " + change.Type, nil
+}
+
+// predictUpload predicts the outcome of uploading an item created offline.
+func (f *Filesystem) predictUpload(inode *Inode, client replayPlanClient) (outcome, reason string, err error) {
+	parentID := inode.ParentID()
+	if isLocalID(parentID) {
+		return ReplayApplies, "uploads it after its folder", nil
+	}
+	if _, err := client.GetItem(parentID); errors.IsNotFoundError(err) {
+		return ReplayFails, "its folder was deleted on OneDrive", nil
+	} else if err != nil {
+		return "", "", err
+	}
+	existing, err := client.GetItemChild(parentID, inode.Name())
+	if err != nil && !errors.IsNotFoundError(err) {
+		return "", "", err
+	}
+	if existing != nil && existing.ID != "" {
+		return ReplayConflicts, fmt.Sprintf("an item named %q was added on OneDrive", inode.Name()), nil
+	}
+	return ReplayApplies, "uploads it", nil
+}
+
+// changedRemotely reports whether the remote item has another ETag than the
+// one recorded when the item was last synced.
+func (f *Filesystem) changedRemotely(id string, remote *graph.DriveItem) bool {
+	entry, err := f.GetMetadataEntry(id)
+	if err != nil || entry == nil || entry.ETag == "" {
+		return false
+	}
+	return !remote.ETagIsMatch(entry.ETag)
+}
+
+// ApplyOfflineReplay starts replaying the journal of offline changes as a
+// JobReplay job and returns its ID; a replay already running is reused.
+func (f *Filesystem) ApplyOfflineReplay() (string, error) {
+	if f.IsOffline() {
+		return "", errors.NewNetworkError("OneDrive cannot be reached, try again once the mount is online", nil)
+	}
+	job := f.startJob(JobReplay, "/", JobReplay, func(ctx context.Context, job *Job) error {
+		changes, err := f.getOfflineChanges(ctx)
+		if err != nil {
+			return err
+		}
+		job.AddTotal(uint64(len(changes)), 0)
+		result, err := f.ProcessOfflineChangesWithSyncManager(ctx)
+		if err != nil {
+			return err
+		}
+		job.Advance(uint64(result.ProcessedChanges), 0)
+		job.AddFailed(uint64(len(result.Errors)))
+		return nil
+	})
+	return job.ID(), nil
+}
@@ -0,0 +1,89 @@
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/fs/offline"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_ReplayPlan_PredictsOutcomes(t *testing.T) {
+	fs := setupEvictionTestFS(t, 0)
+	fs.statuses = make(map[string]FileStatusInfo)
+
+	root := NewInode("root", fuse.S_IFDIR|0755, nil)
+	root.DriveItem.ID = "root"
+	registerHydratedEntry(t, fs, root)
+	fs.root = root.ID()
+	docs := NewInode("docs", fuse.S_IFDIR|0755, root)
+	docs.DriveItem.ID = "docs"
+	registerHydratedEntry(t, fs, docs)
+	gone := NewInode("gone", fuse.S_IFDIR|0755, root)
+	gone.DriveItem.ID = "gone"
+	registerHydratedEntry(t, fs, gone)
+	for _, file := range []struct{ id, name, etag string }{
+		{"edited", "edited.txt", "e1"},
+		{"same", "same.txt", "s1"},
+		{"local-new", "new.txt", ""},
+		{"local-orphan", "orphan.txt", ""},
+	} {
+		parent := docs
+		if file.id == "local-orphan" {
+			parent = gone
+		}
+		inode := NewInode(file.name, fuse.S_IFREG|0644, parent)
+		inode.DriveItem.ID = file.id
+		inode.DriveItem.ETag = file.etag
+		registerHydratedEntry(t, fs, inode)
+	}
+
+	client := &fakeRenameClient{items: map[string]*graph.DriveItem{
+		"docs":   {ID: "docs", Name: "docs"},
+		"edited": {ID: "edited", Name: "edited.txt", ETag: "e2", Parent: &graph.DriveItemParent{ID: "docs"}},
+		"same":   {ID: "same", Name: "same.txt", ETag: "s1", Parent: &graph.DriveItemParent{ID: "docs"}},
+		"other":  {ID: "other", Name: "new.txt", Parent: &graph.DriveItemParent{ID: "docs"}},
+	}}
+
+	journal, err := fs.offlineJournal()
+	require.NoError(t, err)
+	now := time.Now()
+	for i, change := range []*OfflineChange{
+		{ID: "edited", Type: "modify", Path: "/docs/edited.txt"},
+		{ID: "same", Type: "modify", Path: "/docs/same.txt"},
+		{ID: "local-new", Type: "create", Path: "/docs/new.txt"},
+		{ID: "local-orphan", Type: "create", Path: "/gone/orphan.txt"},
+		{ID: "deleted", Type: "delete", Path: "/docs/deleted.txt"},
+		{ID: "stuck", Type: "modify", Path: "/docs/stuck.txt", State: offline.StateConflicted, LastError: "etag mismatch"},
+	} {
+		change.Timestamp = now.Add(time.Duration(i) * time.Second)
+		require.NoError(t, journal.Record(change))
+	}
+
+	plan, err := fs.planOfflineReplayWith(context.Background(), client)
+	require.NoError(t, err)
+	outcomes := map[string]string{}
+	for _, item := range plan {
+		outcomes[item.Path] = item.Outcome
+	}
+	require.Equal(t, map[string]string{
+		"/docs/edited.txt":  ReplayConflicts,
+		"/docs/same.txt":    ReplayApplies,
+		"/docs/new.txt":     ReplayConflicts,
+		"/gone/orphan.txt":  ReplayFails,
+		"/docs/deleted.txt": ReplaySkipped,
+		"/docs/stuck.txt":   ReplaySkipped,
+	}, outcomes)
+	require.Equal(t, "e2", client.items["edited"].ETag, "planning changes nothing")
+
+	require.False(t, fs.holdOfflineReplay(), "changes are replayed unless review is on")
+	fs.SetReviewOfflineReplay(true)
+	require.True(t, fs.holdOfflineReplay())
+
+	fs.SetOfflineMode(OfflineModeReadWrite)
+	_, err = fs.ApplyOfflineReplay()
+	require.Error(t, err, "replaying needs OneDrive")
+}
@@ -0,0 +1,328 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Resource usage is accounted per mount (each mount runs in its own process)
+// and kept as one set of counters per local calendar day in the usage bucket,
+// so day and week totals survive remounts. Counters are flushed once a minute
+// and when the filesystem stops.
+//
+// With a daily transfer cap set, background hydration of pinned items pauses
+// once the day's uploads plus downloads exceed the cap. Files opened by the
+// user are still downloaded. Paused items are queued again when the next day
+// starts or the cap is raised.
+
+var bucketUsage = []byte("usage")
+
+const (
+	usageDayFormat     = "2006-01-02"
+	usageFlushInterval = time.Minute
+	usageWeekDays      = 7
+)
+
+// UsageCounters are the resource counters accumulated over a period.
+type UsageCounters struct {
+	UploadedBytes   uint64            `json:"uploadedBytes"`
+	DownloadedBytes uint64            `json:"downloadedBytes"`
+	CPUSeconds      float64           `json:"cpuSeconds"`
+	APICalls        map[string]uint64 `json:"apiCalls,omitempty"` // keyed by "METHOD endpoint"
+}
+
+// TransferredBytes is the total of uploaded and downloaded bytes.
+func (c UsageCounters) TransferredBytes() uint64 {
+	return c.UploadedBytes + c.DownloadedBytes
+}
+
+// TotalAPICalls sums API calls across endpoints.
+func (c UsageCounters) TotalAPICalls() uint64 {
+	var total uint64
+	for _, n := range c.APICalls {
+		total += n
+	}
+	return total
+}
+
+func (c *UsageCounters) add(other UsageCounters) {
+	c.UploadedBytes += other.UploadedBytes
+	c.DownloadedBytes += other.DownloadedBytes
+	c.CPUSeconds += other.CPUSeconds
+	for endpoint, n := range other.APICalls {
+		if c.APICalls == nil {
+			c.APICalls = make(map[string]uint64)
+		}
+		c.APICalls[endpoint] += n
+	}
+}
+
+// ResourceUsage is a snapshot of the mount's resource accounting.
+type ResourceUsage struct {
+	Today            UsageCounters
+	Week             UsageCounters // the last seven days, including today
+	ProcessCPU       time.Duration // CPU time used by this process since it started
+	CacheBytes       int64         // disk space used by the content cache
+	DailyTransferCap uint64        // 0 when unlimited
+	CapExceeded      bool
+	DeferredItems    int // pinned items waiting for the cap to reset
+}
+
+// usageTracker accumulates counters for the current day. The zero value is
+// ready to use.
+type usageTracker struct {
+	mu       sync.Mutex
+	day      string
+	today    UsageCounters // persisted counters for day plus unflushed changes
+	loaded   bool          // today was read from the database
+	dirty    bool
+	lastCPU  time.Duration
+	cap      uint64
+	deferred map[string]struct{}
+}
+
+// processCPUTime returns the user plus system CPU time of this process.
+func processCPUTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// rollUsageLocked switches the tracker to the day containing now, flushing the
+// previous day's counters first. It reports whether the day changed.
+func (f *Filesystem) rollUsageLocked(now time.Time) bool {
+	u := &f.usage
+	day := now.Format(usageDayFormat)
+	if u.day == day && u.loaded {
+		return false
+	}
+	changed := u.day != "" && u.day != day
+	if changed {
+		f.persistUsageLocked()
+	}
+	u.day = day
+	u.today = f.loadUsageDay(day)
+	u.loaded = true
+	u.dirty = false
+	return changed
+}
+
+func (f *Filesystem) loadUsageDay(day string) UsageCounters {
+	var counters UsageCounters
+	if f.db == nil {
+		return counters
+	}
+	_ = f.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketUsage)
+		if b == nil {
+			return nil
+		}
+		if data := b.Get([]byte(day)); data != nil {
+			if err := json.Unmarshal(data, &counters); err != nil {
+				logging.Debug().Err(err).Str("day", day).Msg("Discarding unreadable usage counters")
+				counters = UsageCounters{}
+			}
+		}
+		return nil
+	})
+	return counters
+}
+
+func (f *Filesystem) persistUsageLocked() {
+	u := &f.usage
+	if !u.dirty || u.day == "" || f.db == nil {
+		return
+	}
+	data, err := json.Marshal(u.today)
+	if err != nil {
+		return
+	}
+	err = f.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketUsage)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(u.day), data)
+	})
+	if err != nil {
+		logging.Warn().Err(err).Str("day", u.day).Msg("Failed to persist resource usage counters")
+		return
+	}
+	u.dirty = false
+}
+
+// recordTransfer adds uploaded and downloaded bytes to today's counters and
+// holds the transfer back while it is over the bandwidth limit.
+func (f *Filesystem) recordTransfer(uploaded, downloaded uint64) {
+	if uploaded == 0 && downloaded == 0 {
+		return
+	}
+	f.usage.mu.Lock()
+	rolled := f.rollUsageLocked(time.Now())
+	f.usage.today.UploadedBytes += uploaded
+	f.usage.today.DownloadedBytes += downloaded
+	f.usage.dirty = true
+	f.usage.mu.Unlock()
+	f.metrics.uploadedBytes.Add(uploaded)
+	f.metrics.downloadedBytes.Add(downloaded)
+	if rolled {
+		f.resumeDeferredHydration()
+	}
+	f.throttleTransfer(uploaded + downloaded)
+}
+
+// recordAPICall counts a Graph API request; it is installed as the graph
+// request observer.
+func (f *Filesystem) recordAPICall(method, endpoint string) {
+	f.usage.mu.Lock()
+	defer f.usage.mu.Unlock()
+	f.rollUsageLocked(time.Now())
+	if f.usage.today.APICalls == nil {
+		f.usage.today.APICalls = make(map[string]uint64)
+	}
+	f.usage.today.APICalls[method+" "+endpoint]++
+	f.usage.dirty = true
+}
+
+// flushUsage attributes CPU time used since the last flush to today and
+// persists the counters. Paused hydrations resume when the day has changed.
+func (f *Filesystem) flushUsage() {
+	f.usage.mu.Lock()
+	rolled := f.rollUsageLocked(time.Now())
+	cpu := processCPUTime()
+	if cpu > f.usage.lastCPU {
+		f.usage.today.CPUSeconds += (cpu - f.usage.lastCPU).Seconds()
+		f.usage.lastCPU = cpu
+		f.usage.dirty = true
+	}
+	f.persistUsageLocked()
+	f.usage.mu.Unlock()
+	if rolled {
+		f.resumeDeferredHydration()
+	}
+}
+
+// SetDailyTransferCap sets the daily upload plus download budget in bytes that
+// background hydration respects; 0 removes the cap.
+func (f *Filesystem) SetDailyTransferCap(bytes uint64) {
+	f.usage.mu.Lock()
+	f.usage.cap = bytes
+	f.usage.mu.Unlock()
+	if !f.transferCapExceeded() {
+		f.resumeDeferredHydration()
+	}
+}
+
+// transferCapExceeded reports whether today's transfers have used up the cap.
+func (f *Filesystem) transferCapExceeded() bool {
+	f.usage.mu.Lock()
+	defer f.usage.mu.Unlock()
+	if f.usage.cap == 0 {
+		return false
+	}
+	f.rollUsageLocked(time.Now())
+	return f.usage.today.TransferredBytes() >= f.usage.cap
+}
+
+// deferHydrationForCap reports true, remembering the item, when background
+// hydration has to wait for the transfer cap to reset.
+func (f *Filesystem) deferHydrationForCap(id string) bool {
+	if !f.transferCapExceeded() {
+		return false
+	}
+	f.usage.mu.Lock()
+	if f.usage.deferred == nil {
+		f.usage.deferred = make(map[string]struct{})
+	}
+	_, already := f.usage.deferred[id]
+	f.usage.deferred[id] = struct{}{}
+	f.usage.mu.Unlock()
+	if !already {
+		logging.Info().Str("id", id).Msg("Daily transfer cap reached, pausing background hydration")
+	}
+	return true
+}
+
+// resumeDeferredHydration queues the pinned items paused by the transfer cap.
+func (f *Filesystem) resumeDeferredHydration() {
+	f.usage.mu.Lock()
+	deferred := f.usage.deferred
+	f.usage.deferred = nil
+	f.usage.mu.Unlock()
+	if len(deferred) == 0 {
+		return
+	}
+	logging.Info().Int("items", len(deferred)).Msg("Resuming background hydration paused by the transfer cap")
+	for id := range deferred {
+		f.autoHydratePinned(id)
+	}
+}
+
+// ResourceUsage returns today's and this week's counters along with live
+// process and cache figures.
+func (f *Filesystem) ResourceUsage() ResourceUsage {
+	now := time.Now()
+	f.usage.mu.Lock()
+	f.rollUsageLocked(now)
+	today := f.usage.today
+	today.APICalls = make(map[string]uint64, len(f.usage.today.APICalls))
+	for endpoint, n := range f.usage.today.APICalls {
+		today.APICalls[endpoint] = n
+	}
+	report := ResourceUsage{
+		Today:            today,
+		DailyTransferCap: f.usage.cap,
+		DeferredItems:    len(f.usage.deferred),
+	}
+	report.CapExceeded = report.DailyTransferCap > 0 && today.TransferredBytes() >= report.DailyTransferCap
+	f.usage.mu.Unlock()
+
+	report.Week.add(today)
+	for i := 1; i < usageWeekDays; i++ {
+		report.Week.add(f.loadUsageDay(now.AddDate(0, 0, -i).Format(usageDayFormat)))
+	}
+	report.ProcessCPU = processCPUTime()
+	if f.content != nil {
+		report.CacheBytes = f.content.GetCacheSize()
+	}
+	return report
+}
+
+// StartUsageAccounting installs the API call observer and periodically
+// flushes the resource usage counters until the filesystem stops.
+func (f *Filesystem) StartUsageAccounting() {
+	f.observeUntilStopped(graph.AddRequestObserver(f.auth, f.recordAPICall))
+
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+
+		ticker := time.NewTicker(usageFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				f.flushUsage()
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// observeUntilStopped keeps an observer installed with the graph package, of
+// the requests made with the mount's tokens, until the filesystem stops. The
+// other mounts of the process install their own.
+func (f *Filesystem) observeUntilStopped(remove func()) {
+	context.AfterFunc(f.ctx, remove)
+}
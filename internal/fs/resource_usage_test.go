@@ -0,0 +1,64 @@
+package fs
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestUT_FS_ResourceUsage_CountersPersistAcrossRemounts(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+
+	// Seed yesterday's counters as an earlier mount would have left them.
+	yesterday := UsageCounters{DownloadedBytes: 1000, APICalls: map[string]uint64{"GET /me/drive/root/delta": 3}}
+	data, err := json.Marshal(yesterday)
+	require.NoError(t, err)
+	require.NoError(t, fs.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketUsage)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(time.Now().AddDate(0, 0, -1).Format(usageDayFormat)), data)
+	}))
+
+	fs.recordTransfer(200, 0)
+	fs.recordTransfer(0, 50)
+	fs.recordAPICall("GET", "/me/drive/root/delta")
+	fs.recordAPICall("PUT", "uploadSession")
+	fs.flushUsage()
+
+	// A fresh tracker on the same database picks up today's counters.
+	remounted := &Filesystem{db: fs.db, content: fs.content}
+	usage := remounted.ResourceUsage()
+	require.Equal(t, uint64(200), usage.Today.UploadedBytes)
+	require.Equal(t, uint64(50), usage.Today.DownloadedBytes)
+	require.Equal(t, uint64(2), usage.Today.TotalAPICalls())
+	require.Positive(t, usage.Today.CPUSeconds)
+
+	require.Equal(t, uint64(1050), usage.Week.DownloadedBytes, "week includes earlier days")
+	require.Equal(t, uint64(4), usage.Week.APICalls["GET /me/drive/root/delta"])
+	require.Positive(t, usage.ProcessCPU)
+}
+
+func TestUT_FS_ResourceUsage_TransferCapPausesBackgroundHydration(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.SetDailyTransferCap(100)
+
+	require.False(t, fs.deferHydrationForCap("pinned-1"), "hydration runs while under the cap")
+
+	fs.recordTransfer(60, 40)
+	require.True(t, fs.deferHydrationForCap("pinned-1"))
+	require.True(t, fs.deferHydrationForCap("pinned-2"))
+	usage := fs.ResourceUsage()
+	require.True(t, usage.CapExceeded)
+	require.Equal(t, 2, usage.DeferredItems)
+
+	// Raising the cap releases the paused items.
+	fs.SetDailyTransferCap(0)
+	usage = fs.ResourceUsage()
+	require.False(t, usage.CapExceeded)
+	require.Zero(t, usage.DeferredItems)
+}
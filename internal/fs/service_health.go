@@ -0,0 +1,168 @@
+package fs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Sync problems caused by an incident on Microsoft's side end up reported as
+// OneMount bugs. Once OneDrive answers serviceHealthErrorThreshold requests
+// with server errors within serviceHealthWindow, the mount checks the health
+// of the service (see graph.CheckServiceHealth). A degraded service is shown
+// as ServiceDegradedMessage in the statistics, the ServiceHealth D-Bus
+// property and the launcher's status window, announced with a desktop
+// notification and a "service-degraded" activity event, and checked again
+// every serviceHealthRecheck until it recovers.
+
+const (
+	serviceHealthWindow         = 10 * time.Minute
+	serviceHealthErrorThreshold = 3
+	// serviceHealthRecheck is also the least time between two checks, so
+	// that a failing mount does not add to the load of a degraded service
+	serviceHealthRecheck = 15 * time.Minute
+	serviceHealthTimeout = 30 * time.Second
+)
+
+// Activity events reporting the health of the OneDrive service.
+const (
+	ActivityServiceDegraded  = "service-degraded"
+	ActivityServiceRecovered = "service-recovered"
+)
+
+// ServiceDegradedMessage is shown while the OneDrive service is degraded.
+const ServiceDegradedMessage = "OneDrive service degradation detected"
+
+// serviceHealthMonitor counts server errors and keeps the result of the last
+// check of the service. The zero value is ready to use.
+type serviceHealthMonitor struct {
+	mu        sync.Mutex
+	errors    []time.Time // server errors within serviceHealthWindow
+	checking  bool
+	lastCheck time.Time
+	health    graph.ServiceHealth
+
+	// check replaces graph.CheckServiceHealth in tests
+	check func(ctx context.Context) (graph.ServiceHealth, error)
+}
+
+// StartServiceHealthChecks installs the observer that checks the OneDrive
+// service when requests fail with server errors.
+func (f *Filesystem) StartServiceHealthChecks() {
+	f.observeUntilStopped(graph.AddServerErrorObserver(f.auth, f.recordServerError))
+}
+
+// ServiceHealth returns the result of the last check of the OneDrive service,
+// with a zero CheckedAt before the first check.
+func (f *Filesystem) ServiceHealth() graph.ServiceHealth {
+	f.serviceHealth.mu.Lock()
+	defer f.serviceHealth.mu.Unlock()
+	return f.serviceHealth.health
+}
+
+// recordServerError counts a request that OneDrive answered with a server
+// error, and checks the service when they add up.
+func (f *Filesystem) recordServerError(endpoint string, status int) {
+	m := &f.serviceHealth
+	now := time.Now()
+	m.mu.Lock()
+	recent := m.errors[:0]
+	for _, at := range m.errors {
+		if now.Sub(at) < serviceHealthWindow {
+			recent = append(recent, at)
+		}
+	}
+	m.errors = append(recent, now)
+	// While degraded the service is rechecked on a timer instead
+	start := len(m.errors) >= serviceHealthErrorThreshold && !m.checking && !m.health.Degraded &&
+		now.Sub(m.lastCheck) >= serviceHealthRecheck
+	if start {
+		m.checking = true
+	}
+	m.mu.Unlock()
+
+	if start {
+		logging.Info().Str("endpoint", endpoint).Int("status", status).
+			Msg("OneDrive keeps answering with server errors, checking the service health")
+		f.Wg.Add(1)
+		go func() {
+			defer f.Wg.Done()
+			f.checkServiceHealth()
+		}()
+	}
+}
+
+// checkServiceHealth checks the service, reports a change of its health and
+// returns whether it is degraded. The caller has set checking.
+func (f *Filesystem) checkServiceHealth() bool {
+	m := &f.serviceHealth
+	ctx, cancel := context.WithTimeout(f.mountContext(), serviceHealthTimeout)
+	defer cancel()
+	check := m.check
+	if check == nil {
+		check = func(ctx context.Context) (graph.ServiceHealth, error) {
+			return graph.CheckServiceHealth(ctx, f.auth)
+		}
+	}
+	health, err := check(ctx)
+
+	m.mu.Lock()
+	m.checking = false
+	m.lastCheck = time.Now()
+	wasDegraded := m.health.Degraded
+	if err != nil {
+		m.mu.Unlock()
+		logging.Debug().Err(err).Msg("Could not check the OneDrive service health")
+		return wasDegraded
+	}
+	m.health = health
+	m.mu.Unlock()
+
+	switch {
+	case health.Degraded && !wasDegraded:
+		logging.Warn().Str("source", health.Source).Str("detail", health.Detail).Msg(ServiceDegradedMessage)
+		f.emitActivity(ActivityServiceDegraded, "", health.Detail)
+		if f.dbusServer != nil {
+			f.dbusServer.SetServiceHealth(ServiceDegradedMessage + ": " + health.Detail)
+			f.dbusServer.SendDesktopNotification(ServiceDegradedMessage,
+				"Sync problems are likely caused by Microsoft: "+health.Detail)
+		}
+		f.Wg.Add(1)
+		go f.recheckServiceHealth()
+	case !health.Degraded && wasDegraded:
+		logging.Info().Str("source", health.Source).Msg("The OneDrive service has recovered")
+		f.emitActivity(ActivityServiceRecovered, "", health.Detail)
+		if f.dbusServer != nil {
+			f.dbusServer.SetServiceHealth("")
+		}
+	}
+	return health.Degraded
+}
+
+// recheckServiceHealth checks a degraded service every serviceHealthRecheck
+// until it recovers or the filesystem stops.
+func (f *Filesystem) recheckServiceHealth() {
+	defer f.Wg.Done()
+	m := &f.serviceHealth
+	ticker := time.NewTicker(serviceHealthRecheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.mu.Lock()
+			busy := m.checking
+			if !busy {
+				m.checking = true
+			}
+			m.mu.Unlock()
+			if !busy && !f.checkServiceHealth() {
+				return
+			}
+		case <-f.mountContext().Done():
+			return
+		}
+	}
+}
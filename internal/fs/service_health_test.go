@@ -0,0 +1,51 @@
+package fs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_ServiceHealth_CheckedAfterServerErrors(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.ctx, fs.cancel = context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		fs.cancel()
+		fs.Wg.Wait()
+	})
+
+	var checks atomic.Int32
+	var degraded atomic.Bool
+	degraded.Store(true)
+	fs.serviceHealth.check = func(context.Context) (graph.ServiceHealth, error) {
+		checks.Add(1)
+		return graph.ServiceHealth{Degraded: degraded.Load(), Source: graph.ServiceHealthProbe,
+			Detail: "OneDrive answers with server errors", CheckedAt: time.Now()}, nil
+	}
+
+	for i := 0; i < serviceHealthErrorThreshold-1; i++ {
+		fs.recordServerError("/me/drive/root/delta", 503)
+	}
+	require.Zero(t, checks.Load(), "a few server errors are not worth a check")
+	fs.recordServerError("/me/drive/root/delta", 503)
+	require.Eventually(t, func() bool {
+		events := fs.RecentEvents(1)
+		return len(events) == 1 && events[0].Type == ActivityServiceDegraded
+	}, 5*time.Second, 10*time.Millisecond)
+	require.True(t, fs.ServiceHealth().Degraded)
+
+	fs.recordServerError("/me/drive/root/delta", 503)
+	require.Equal(t, int32(1), checks.Load(), "a degraded service is rechecked on a timer")
+
+	degraded.Store(false)
+	fs.serviceHealth.mu.Lock()
+	fs.serviceHealth.checking = true
+	fs.serviceHealth.mu.Unlock()
+	require.False(t, fs.checkServiceHealth())
+	events := fs.RecentEvents(0)
+	require.Equal(t, ActivityServiceRecovered, events[len(events)-1].Type)
+}
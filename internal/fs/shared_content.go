@@ -0,0 +1,280 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Mounts of the same account share downloaded content through an
+// account-scoped store at <cacheDir>/shared/<account>/. Each verified download
+// is hard-linked into the store under a key derived from its QuickXorHash and
+// size. A mount hydrating an item whose content is already stored links the
+// blob into its own content cache instead of downloading it again, so both
+// mounts use the same disk blocks.
+//
+// Hard links double as reference counts: a blob whose link count has dropped
+// to one is used by no mount and is removed by the next collection. Content
+// files are unshared (copied) before they are modified, so local edits never
+// reach the store or other mounts. Store changes and collection hold an
+// exclusive flock on the store's lock file, which is safe across processes.
+
+const (
+	sharedContentDirName  = "shared"
+	sharedContentLockName = ".lock"
+	sharedContentTmpName  = ".tmp"
+)
+
+// SharedContentStore is an account-scoped content store shared by all mounts
+// of that account.
+type SharedContentStore struct {
+	dir string
+}
+
+// SharedContentRoot returns the directory holding the stores of every account
+// under cacheDir.
+func SharedContentRoot(cacheDir string) string {
+	return filepath.Join(cacheDir, sharedContentDirName)
+}
+
+// SharedContentDir returns the store directory for account under cacheDir.
+func SharedContentDir(cacheDir, account string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(account)))
+	return filepath.Join(SharedContentRoot(cacheDir), hex.EncodeToString(sum[:8]))
+}
+
+// OpenSharedContentStore creates the store directory if needed.
+func OpenSharedContentStore(dir string) (*SharedContentStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, sharedContentTmpName), 0700); err != nil {
+		return nil, err
+	}
+	return &SharedContentStore{dir: dir}, nil
+}
+
+// sharedContentKey names the blob holding content with the given QuickXorHash
+// and size. Base64 characters that are not valid in file names are replaced.
+func sharedContentKey(quickXorHash string, size uint64) string {
+	if quickXorHash == "" {
+		return ""
+	}
+	hash := strings.NewReplacer("/", "_", "+", "-", "=", "").Replace(quickXorHash)
+	return fmt.Sprintf("qx-%s-%d", hash, size)
+}
+
+func (s *SharedContentStore) blobPath(key string) string {
+	return filepath.Join(s.dir, key)
+}
+
+// withLock runs fn while holding the store's exclusive file lock.
+func (s *SharedContentStore) withLock(fn func() error) error {
+	lock, err := os.OpenFile(filepath.Join(s.dir, sharedContentLockName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer func() { _ = syscall.Flock(int(lock.Fd()), syscall.LOCK_UN) }()
+	return fn()
+}
+
+// publish links the content file at path into the store under key unless a
+// blob for key already exists.
+func (s *SharedContentStore) publish(key, path string) error {
+	return s.withLock(func() error {
+		err := os.Link(path, s.blobPath(key))
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// linkInto replaces the file at path with a link to the blob for key. It
+// reports false when the store has no such blob.
+func (s *SharedContentStore) linkInto(key, path string) (bool, error) {
+	found := false
+	err := s.withLock(func() error {
+		tmp := filepath.Join(s.dir, sharedContentTmpName, filepath.Base(path))
+		_ = os.Remove(tmp)
+		if err := os.Link(s.blobPath(key), tmp); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+		found = true
+		return nil
+	})
+	return found, err
+}
+
+// Collect removes blobs no longer linked from any mount's content cache and
+// returns how many were removed.
+func (s *SharedContentStore) Collect() (int, error) {
+	removed := 0
+	err := s.withLock(func() error {
+		entries, err := os.ReadDir(s.dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || entry.Name() == sharedContentLockName {
+				continue
+			}
+			path := s.blobPath(entry.Name())
+			if linkCount(path) == 1 {
+				if err := os.Remove(path); err == nil {
+					removed++
+				}
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// linkCount returns the number of hard links to path, or 0 when it cannot
+// be determined.
+func linkCount(path string) uint64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 0
+}
+
+// Unshare gives the item a private copy of its content when the content file
+// is linked from the shared store or another mount. It must be called before
+// the content is modified in place.
+func (l *LoopbackCache) Unshare(id string) error {
+	l.unshareM.Lock()
+	defer l.unshareM.Unlock()
+	path := l.contentPath(id)
+	if linkCount(path) <= 1 {
+		return nil
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".unshare-*")
+	if err != nil {
+		return err
+	}
+	tmp := dst.Name()
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	// The cached descriptor refers to the shared file; drop it so the next
+	// Open uses the private copy.
+	_ = l.Close(id)
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	logging.Debug().Str("id", id).Msg("Unshared content before modification")
+	return nil
+}
+
+// EnableSharedContent shares downloaded content with other mounts of the
+// same account through the store in dir.
+func (f *Filesystem) EnableSharedContent(dir string) error {
+	store, err := OpenSharedContentStore(dir)
+	if err != nil {
+		return err
+	}
+	f.sharedContent = store
+	logging.Info().Str("dir", dir).Msg("Sharing content cache with other mounts of this account")
+	return nil
+}
+
+// publishSharedContent offers freshly downloaded content to other mounts.
+func (f *Filesystem) publishSharedContent(id, quickXorHash string, size uint64) {
+	key := sharedContentKey(quickXorHash, size)
+	if f.sharedContent == nil || key == "" {
+		return
+	}
+	if err := f.sharedContent.publish(key, f.content.contentPath(id)); err != nil {
+		logging.Debug().Err(err).Str("id", id).Msg("Could not publish content to the shared store")
+	}
+}
+
+// hydrateFromSharedContent links the item's content from the shared store
+// when another mount has already downloaded it. The linked content is
+// verified against the item's hash before it is used.
+func (f *Filesystem) hydrateFromSharedContent(id string, inode *Inode) (uint64, string, bool) {
+	if f.sharedContent == nil || isLocalID(id) {
+		return 0, "", false
+	}
+	inode.mu.RLock()
+	item := inode.DriveItem
+	inode.mu.RUnlock()
+	if item.File == nil {
+		return 0, "", false
+	}
+	hash := item.File.Hashes.QuickXorHash
+	key := sharedContentKey(hash, item.Size)
+	if key == "" {
+		return 0, "", false
+	}
+
+	_ = f.content.Close(id)
+	path := f.content.contentPath(id)
+	found, err := f.sharedContent.linkInto(key, path)
+	if err != nil {
+		logging.Debug().Err(err).Str("id", id).Msg("Could not link content from the shared store")
+	}
+	if !found {
+		return 0, "", false
+	}
+
+	fd, err := f.content.Open(id)
+	if err == nil && strings.EqualFold(graph.QuickXORHashStream(fd), hash) {
+		f.content.updateCacheEntry(id, int64(item.Size))
+		logging.Debug().Str("id", id).Msg("Hydrated from content shared by another mount")
+		return item.Size, hash, true
+	}
+	logging.Warn().Str("id", id).Str("key", key).Msg("Shared content failed verification, downloading instead")
+	_ = f.content.Delete(id)
+	return 0, "", false
+}
+
+// collectSharedContent removes shared blobs no mount references any more.
+func (f *Filesystem) collectSharedContent() {
+	if f.sharedContent == nil {
+		return
+	}
+	removed, err := f.sharedContent.Collect()
+	if err != nil {
+		logging.Debug().Err(err).Msg("Shared content collection failed")
+		return
+	}
+	if removed > 0 {
+		logging.Info().Int("removed", removed).Msg("Removed unreferenced shared content")
+	}
+}
@@ -0,0 +1,66 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_SharedContent_MountsShareVerifiedBlobs(t *testing.T) {
+	cacheDir := t.TempDir()
+	storeDir := SharedContentDir(cacheDir, "User@Example.com")
+	require.Equal(t, storeDir, SharedContentDir(cacheDir, "user@example.com"), "the store is per account, not per spelling")
+
+	content := []byte("shared content")
+	hash := graph.QuickXORHash(&content)
+	newMount := func() (*Filesystem, *Inode) {
+		fs := newTestFilesystemWithMetadata(t)
+		require.NoError(t, fs.EnableSharedContent(storeDir))
+		file := NewInode("report.txt", fuse.S_IFREG|0644, nil)
+		file.DriveItem.ID = "file"
+		file.DriveItem.Size = uint64(len(content))
+		file.DriveItem.File = &graph.File{Hashes: graph.Hashes{QuickXorHash: hash}}
+		registerHydratedEntry(t, fs, file)
+		return fs, file
+	}
+
+	first, firstFile := newMount()
+	second, secondFile := newMount()
+
+	_, _, ok := second.hydrateFromSharedContent(secondFile.ID(), secondFile)
+	require.False(t, ok, "nothing is shared before the first download")
+
+	require.NoError(t, first.content.Insert(firstFile.ID(), content))
+	first.publishSharedContent(firstFile.ID(), hash, uint64(len(content)))
+
+	size, gotHash, ok := second.hydrateFromSharedContent(secondFile.ID(), secondFile)
+	require.True(t, ok)
+	require.Equal(t, uint64(len(content)), size)
+	require.Equal(t, hash, gotHash)
+	require.Equal(t, content, second.content.Get(secondFile.ID()))
+	require.Equal(t, uint64(3), linkCount(second.content.contentPath(secondFile.ID())), "both mounts and the store share one file")
+
+	// Local edits go to a private copy.
+	_, err := second.content.InsertStream(secondFile.ID(), strings.NewReader("edited"))
+	require.NoError(t, err)
+	require.Equal(t, content, first.content.Get(firstFile.ID()))
+	require.Equal(t, uint64(1), linkCount(second.content.contentPath(secondFile.ID())))
+
+	removed, err := first.sharedContent.Collect()
+	require.NoError(t, err)
+	require.Zero(t, removed, "the first mount still references the blob")
+
+	require.NoError(t, first.content.Delete(firstFile.ID()))
+	removed, err = first.sharedContent.Collect()
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	entries, err := os.ReadDir(storeDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.True(t, entry.IsDir() || entry.Name() == sharedContentLockName, "unexpected blob %s", entry.Name())
+	}
+}
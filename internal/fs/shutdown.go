@@ -0,0 +1,261 @@
+package fs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Stopping the mount is split into stages, each naming the stages that must
+// finish before it: the delta loop stops feeding the metadata queue, which
+// stops before hydration, which stops before uploads, which finish before
+// the D-Bus server goes and the database closes last. A stage runs once; the
+// Stop* methods run their stage and whatever it depends on, so they can be
+// called in any order and more than once. A stage that does not finish in
+// time is logged with the stacks of all goroutines and left behind, and
+// shutdown continues with the next one.
+
+// Shutdown stages, in the order they run.
+const (
+	shutdownRequests      = "requests"       // send planned deletes, then cancel background requests
+	shutdownCacheCleanup  = "cache-cleanup"  // stop expiring cached content
+	shutdownDelta         = "delta"          // stop the delta loop and realtime notifications
+	shutdownMetadataQueue = "metadata-queue" // stop fetching folder listings
+	shutdownMutations     = "mutations"      // stop sending creates, renames and deletes
+	shutdownHydration     = "hydration"      // stop downloads
+	shutdownUploads       = "uploads"        // let active uploads finish and save the rest
+	shutdownDBus          = "dbus"           // release the D-Bus name
+	shutdownGoroutines    = "goroutines"     // wait for the remaining background work
+	shutdownDatabase      = "database"       // save counters, access times and metadata, close the database
+)
+
+// shutdownStage is a step of stopping the mount.
+type shutdownStage struct {
+	name    string
+	after   []string // stages that finish first
+	timeout time.Duration
+	stop    func()
+}
+
+// shutdownCoordinator runs shutdown stages in dependency order.
+type shutdownCoordinator struct {
+	mu      sync.Mutex
+	stages  map[string]*shutdownStage
+	done    map[string]bool
+	aborted []string
+}
+
+// newShutdownCoordinator checks that the stages only depend on known stages
+// and contain no cycle.
+func newShutdownCoordinator(stages []shutdownStage) (*shutdownCoordinator, error) {
+	c := &shutdownCoordinator{
+		stages: make(map[string]*shutdownStage, len(stages)),
+		done:   make(map[string]bool),
+	}
+	for i := range stages {
+		c.stages[stages[i].name] = &stages[i]
+	}
+	visiting := make(map[string]bool)
+	checked := make(map[string]bool)
+	var check func(name string) error
+	check = func(name string) error {
+		stage, ok := c.stages[name]
+		switch {
+		case !ok:
+			return fmt.Errorf("unknown shutdown stage %q", name)
+		case checked[name]:
+			return nil
+		case visiting[name]:
+			return fmt.Errorf("shutdown stage %q depends on itself", name)
+		}
+		visiting[name] = true
+		for _, dep := range stage.after {
+			if err := check(dep); err != nil {
+				return err
+			}
+		}
+		checked[name] = true
+		return nil
+	}
+	for _, stage := range stages {
+		if err := check(stage.name); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// run runs the stage and the stages it depends on that have not run yet,
+// dependencies first.
+func (c *shutdownCoordinator) run(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.runLocked(name)
+}
+
+func (c *shutdownCoordinator) runLocked(name string) {
+	stage, ok := c.stages[name]
+	if !ok || c.done[name] {
+		return
+	}
+	c.done[name] = true
+	for _, dep := range stage.after {
+		c.runLocked(dep)
+	}
+
+	start := time.Now()
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		stage.stop()
+	}()
+	select {
+	case <-finished:
+		logging.Debug().Str("stage", name).Dur("took", time.Since(start)).Msg("Shutdown stage finished")
+	case <-time.After(stage.timeout):
+		c.aborted = append(c.aborted, name)
+		logging.Error().
+			Str("stage", name).
+			Dur("timeout", stage.timeout).
+			Msg("Shutdown stage did not finish in time, continuing without it")
+		logging.Debug().Str("stage", name).Msg("Goroutines when the shutdown stage was abandoned:\n" + goroutineStacks())
+	}
+}
+
+// abandoned returns the stages that did not finish in time.
+func (c *shutdownCoordinator) abandoned() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.aborted...)
+}
+
+// runShutdown runs the shutdown stage name and the stages before it.
+func (f *Filesystem) runShutdown(name string) {
+	f.shutdownOnce.Do(func() {
+		coordinator, err := newShutdownCoordinator(f.shutdownStages())
+		if err != nil {
+			// a programming error in shutdownStages
+			panic(err)
+		}
+		f.shutdown = coordinator
+	})
+	f.shutdown.run(name)
+}
+
+// shutdownStages returns the stages of stopping the mount.
+func (f *Filesystem) shutdownStages() []shutdownStage {
+	timeouts := f.timeoutConfig
+	if timeouts == nil {
+		timeouts = DefaultTimeoutConfig()
+	}
+	return []shutdownStage{
+		{
+			name:    shutdownRequests,
+			timeout: deletePlanShutdown + 5*time.Second,
+			stop: func() {
+				// Send the deletes still planned while requests can be made
+				f.flushDeletePlan()
+				if f.cancel != nil {
+					f.cancel()
+				}
+			},
+		},
+		{
+			name:    shutdownCacheCleanup,
+			after:   []string{shutdownRequests},
+			timeout: 5 * time.Second,
+			stop:    f.stopCacheCleanup,
+		},
+		{
+			name:    shutdownDelta,
+			after:   []string{shutdownRequests},
+			timeout: 15 * time.Second,
+			stop: func() {
+				f.stopDeltaLoop()
+				f.stopRealtimeManager()
+			},
+		},
+		{
+			name:    shutdownMetadataQueue,
+			after:   []string{shutdownDelta},
+			timeout: 5 * time.Second,
+			stop: func() {
+				if f.metadataRequestManager != nil {
+					f.metadataRequestManager.Stop()
+				}
+			},
+		},
+		{
+			name:    shutdownMutations,
+			after:   []string{shutdownRequests},
+			timeout: 5 * time.Second,
+			stop:    f.stopMutationQueue,
+		},
+		{
+			name:    shutdownHydration,
+			after:   []string{shutdownMetadataQueue},
+			timeout: timeouts.DownloadWorkerShutdown + time.Second,
+			stop: func() {
+				if f.downloads != nil {
+					f.downloads.Stop()
+				}
+			},
+		},
+		{
+			name:    shutdownUploads,
+			after:   []string{shutdownHydration, shutdownMutations},
+			timeout: timeouts.UploadGracefulShutdown + 15*time.Second,
+			stop: func() {
+				if f.uploads != nil {
+					f.flushAppendUploads()
+					f.uploads.Stop()
+				}
+			},
+		},
+		{
+			name:    shutdownDBus,
+			after:   []string{shutdownUploads, shutdownCacheCleanup},
+			timeout: 5 * time.Second,
+			stop: func() {
+				if f.dbusServer != nil {
+					f.dbusServer.Stop()
+				}
+			},
+		},
+		{
+			name:    shutdownGoroutines,
+			after:   []string{shutdownDBus},
+			timeout: timeouts.FilesystemShutdown,
+			stop:    f.Wg.Wait,
+		},
+		{
+			name:    shutdownDatabase,
+			after:   []string{shutdownGoroutines},
+			timeout: 10 * time.Second,
+			stop: func() {
+				// Persist resource usage counters before the database closes
+				f.flushUsage()
+				f.flushAccessTimes()
+				f.saveMetadataSnapshot()
+				if f.content != nil {
+					f.content.leaveLedger()
+				}
+				if f.db != nil {
+					if err := f.db.Close(); err != nil {
+						logging.Warn().Err(err).Msg("Failed to close database connection")
+					}
+				}
+				f.removeInMemoryMetadata()
+				f.removeEphemeralCache()
+			},
+		},
+	}
+}
+
+// StopBackground stops everything the mount does besides answering the
+// kernel, so that it can be unmounted. Stop closes the database afterwards.
+func (f *Filesystem) StopBackground() {
+	f.runShutdown(shutdownGoroutines)
+}
@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_Shutdown_RunsStagesAfterTheirDependencies(t *testing.T) {
+	var mu sync.Mutex
+	var ran []string
+	stage := func(name string, after ...string) shutdownStage {
+		return shutdownStage{name: name, after: after, timeout: time.Second, stop: func() {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+		}}
+	}
+	c, err := newShutdownCoordinator([]shutdownStage{
+		stage("database", "uploads"),
+		stage("uploads", "hydration"),
+		stage("hydration", "delta"),
+		stage("delta"),
+	})
+	require.NoError(t, err)
+
+	c.run("hydration")
+	require.Equal(t, []string{"delta", "hydration"}, ran)
+	c.run("database")
+	c.run("uploads")
+	require.Equal(t, []string{"delta", "hydration", "uploads", "database"}, ran, "each stage runs once")
+	require.Empty(t, c.abandoned())
+}
+
+func TestUT_FS_Shutdown_AbandonsStuckStage(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	closed := false
+	c, err := newShutdownCoordinator([]shutdownStage{
+		{name: "uploads", timeout: 20 * time.Millisecond, stop: func() { <-release }},
+		{name: "database", after: []string{"uploads"}, timeout: time.Second, stop: func() { closed = true }},
+	})
+	require.NoError(t, err)
+
+	c.run("database")
+	require.True(t, closed, "shutdown continues past a stuck stage")
+	require.Equal(t, []string{"uploads"}, c.abandoned())
+}
+
+func TestUT_FS_Shutdown_RejectsBadGraph(t *testing.T) {
+	_, err := newShutdownCoordinator([]shutdownStage{
+		{name: "a", after: []string{"b"}},
+		{name: "b", after: []string{"a"}},
+	})
+	require.Error(t, err)
+
+	_, err = newShutdownCoordinator([]shutdownStage{{name: "a", after: []string{"missing"}}})
+	require.Error(t, err)
+
+	_, err = newShutdownCoordinator((&Filesystem{}).shutdownStages())
+	require.NoError(t, err, "the mount's own stages form a valid graph")
+}
+
+func TestUT_FS_Shutdown_StopMethodsCanRepeat(t *testing.T) {
+	fs := &Filesystem{}
+	fs.StopUploadManager()
+	fs.StopDeltaLoop()
+	fs.StopUploadManager()
+	fs.Stop()
+	fs.Stop()
+	require.Empty(t, fs.shutdown.abandoned())
+}
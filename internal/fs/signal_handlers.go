@@ -33,26 +33,9 @@ func UnmountHandler(signal <-chan os.Signal, server *fuse.Server, filesystem *Fi
 		logging.Info().Str("signal", strings.ToUpper(sig.String())).
 			Msg("Signal received, cleaning up and unmounting filesystem.")
 
-		// Stop all background processes
+		// Stop all background processes in order before unmounting
 		if filesystem != nil {
-			// Stop the cache cleanup routine
-			filesystem.StopCacheCleanup()
-
-			// Stop the delta loop
-			filesystem.StopDeltaLoop()
-
-			// Stop the download manager
-			filesystem.StopDownloadManager()
-
-			// Stop the upload manager
-			filesystem.StopUploadManager()
-
-			// Stop the metadata request manager
-			filesystem.StopMetadataRequestManager()
-
-			// Give the system a moment to release all resources
-			logging.Info().Msg("Waiting for all resources to be released before unmounting...")
-			time.Sleep(500 * time.Millisecond)
+			filesystem.StopBackground()
 		}
 
 		// Unmount the filesystem with retries
@@ -81,6 +64,9 @@ func UnmountHandler(signal <-chan os.Signal, server *fuse.Server, filesystem *Fi
 			}
 		}
 
+		if filesystem != nil {
+			filesystem.Stop()
+		}
 		if err != nil {
 			logging.Error().Err(err).Msg("Failed to unmount filesystem cleanly after multiple attempts! " +
 				"Run \"fusermount3 -uz /MOUNTPOINT/GOES/HERE\" to unmount.")
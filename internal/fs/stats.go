@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/logging"
 	"github.com/auriora/onemount/internal/metadata"
 	"github.com/auriora/onemount/internal/socketio"
@@ -29,19 +30,29 @@ type Stats struct {
 	Expiration     int
 	MaxCacheSize   int64   // Maximum cache size limit (0 = unlimited)
 	CacheSizeUsage float64 // Percentage of max cache size used (0-100, or -1 if unlimited)
+	ExemptedCount  int     // Cached files protected from eviction by exemption patterns
+	ExemptedBytes  int64   // Cached bytes protected from eviction by exemption patterns
+
+	// Thumbnail cache statistics, previews included
+	ThumbnailCount int
+	ThumbnailSize  int64
+	ThumbnailLimit int64 // Size the cleanup keeps the thumbnail cache under (0 = unlimited)
 
 	// Upload queue statistics
 	UploadCount       int
 	UploadsNotStarted int
 	UploadsInProgress int
+	UploadsVerifying  int // sent, awaiting OneDrive's confirmation
 	UploadsCompleted  int
 	UploadsErrored    int
+	UploadsDeferred   map[string]int // DIRTY_LOCAL items waiting to upload, by reason (e.g. DeferredMetered)
 
 	// File status statistics
 	StatusCloud         int
 	StatusLocal         int
 	StatusLocalModified int
 	StatusSyncing       int
+	StatusVerifying     int
 	StatusDownloading   int
 	StatusOutofSync     int
 	StatusError         int
@@ -101,6 +112,7 @@ type Stats struct {
 	RealtimeLastError           string
 	RealtimeRecoveryWindowOpen  bool
 	RealtimeRecoverySince       time.Time
+	RealtimeLatency             RealtimeLatencyStats // How long remote changes took to appear over the last hour
 
 	// Metadata/hydration telemetry
 	MetadataStateCounts      map[string]int
@@ -114,6 +126,41 @@ type Stats struct {
 	MetadataQueueHighDepth   int
 	MetadataQueueLowDepth    int
 	MetadataQueueAvgWaitMs   float64
+
+	// Kernel attribute cache counters
+	AttrCacheHits   uint64 // Lookup/GetAttr requests answered from in-memory metadata
+	AttrCacheMisses uint64 // Lookups that had to populate the parent directory first
+
+	// Read-ahead counters
+	ReadAheadSequentialReads uint64 // Reads continuing where the previous read on the handle ended
+	ReadAheadRandomReads     uint64 // Reads that broke a sequential run
+	ReadAheadPrefetches      uint64 // Background prefetches started
+	ReadAheadPrefetchedBytes uint64 // Bytes read ahead from the content cache
+
+	// Write coalescing counters
+	CoalescedWrites  uint64 // Small sequential writes collected in a write buffer
+	CoalescedFlushes uint64 // Cache file writes the buffered writes were combined into
+
+	// Append upload counters
+	AppendCoalescedFsyncs uint64 // Fsyncs of appended files folded into a later upload
+	AppendUploads         uint64 // Uploads of appended files
+
+	// Search indexer access counters
+	IndexerOpens             uint64 // Files opened by desktop search indexers
+	IndexerHydrationsRefused uint64 // Opens of files that are not cached refused to indexers
+
+	// Transfer chunk sizes tuned for the current network
+	Chunks ChunkProfile
+
+	// Per-mount resource accounting (day/week counters and transfer cap)
+	Usage ResourceUsage
+
+	// Cached names shadowed by a sibling with the same NFC name
+	NameCollisions []string
+
+	// Last check of the OneDrive service, made when requests fail with
+	// server errors; zero CheckedAt when it was not needed yet
+	ServiceHealth graph.ServiceHealth
 }
 
 // CachedStats holds cached statistics with TTL
@@ -166,6 +213,7 @@ func (f *Filesystem) GetStatsWithConfig(config *StatsConfig) (*Stats, error) {
 		if f.cachedStats.stats != nil && time.Now().Before(f.cachedStats.expiresAt) {
 			stats := f.cachedStats.stats
 			f.augmentRealtimeStats(stats)
+			f.augmentAttrCacheStats(stats)
 			f.cachedStats.mu.RUnlock()
 			logging.Debug().Msg("Returning cached statistics")
 			return stats, nil
@@ -208,6 +256,7 @@ func (f *Filesystem) GetStatsWithConfig(config *StatsConfig) (*Stats, error) {
 	f.cachedStats.expiresAt = time.Now().Add(config.CacheTTL)
 	f.cachedStats.mu.Unlock()
 	f.augmentRealtimeStats(stats)
+	f.augmentAttrCacheStats(stats)
 
 	// Trigger background update if enabled
 	if config.UseBackgroundCalculation && f.statsUpdateCh != nil {
@@ -240,7 +289,7 @@ func (f *Filesystem) calculateStats(config *StatsConfig) (*Stats, error) {
 	f.xattrSupportedM.RUnlock()
 
 	stats := &Stats{
-		Expiration:     f.cacheExpirationDays,
+		Expiration:     f.cacheExpiration(),
 		IsOffline:      f.IsOffline(),
 		DeltaLink:      f.deltaLink,
 		FileExtensions: make(map[string]int),
@@ -280,6 +329,8 @@ func (f *Filesystem) calculateStats(config *StatsConfig) (*Stats, error) {
 	} else {
 		stats.CacheSizeUsage = -1 // Unlimited
 	}
+	stats.ExemptedCount, stats.ExemptedBytes = f.exemptedContentBytes()
+	f.thumbnailStats(stats)
 
 	if config.UseBackgroundCalculation {
 		// Use a channel to collect results from background goroutine
@@ -555,6 +606,12 @@ func (f *Filesystem) calculateStats(config *StatsConfig) (*Stats, error) {
 					state = "UNKNOWN"
 				}
 				stats.MetadataStateCounts[state]++
+				if entry.State == metadata.ItemStateDirtyLocal && entry.Upload.DeferredReason != "" {
+					if stats.UploadsDeferred == nil {
+						stats.UploadsDeferred = make(map[string]int)
+					}
+					stats.UploadsDeferred[entry.Upload.DeferredReason]++
+				}
 				return nil
 			}); err != nil {
 				return err
@@ -602,6 +659,8 @@ func (f *Filesystem) calculateStats(config *StatsConfig) (*Stats, error) {
 				stats.UploadsCompleted++
 			case uploadErrored:
 				stats.UploadsErrored++
+			case uploadVerifying:
+				stats.UploadsVerifying++
 			}
 		}
 		f.uploads.mutex.RUnlock()
@@ -619,6 +678,8 @@ func (f *Filesystem) calculateStats(config *StatsConfig) (*Stats, error) {
 			stats.StatusLocalModified++
 		case StatusSyncing:
 			stats.StatusSyncing++
+		case StatusVerifying:
+			stats.StatusVerifying++
 		case StatusDownloading:
 			stats.StatusDownloading++
 		case StatusOutofSync:
@@ -783,7 +844,7 @@ func (f *Filesystem) GetQuickStats() (*Stats, error) {
 	f.xattrSupportedM.RUnlock()
 
 	stats := &Stats{
-		Expiration:     f.cacheExpirationDays,
+		Expiration:     f.cacheExpiration(),
 		IsOffline:      f.IsOffline(),
 		DeltaLink:      f.deltaLink,
 		FileExtensions: make(map[string]int),
@@ -808,6 +869,8 @@ func (f *Filesystem) GetQuickStats() (*Stats, error) {
 	} else {
 		stats.CacheSizeUsage = -1 // Unlimited
 	}
+	stats.ExemptedCount, stats.ExemptedBytes = f.exemptedContentBytes()
+	f.thumbnailStats(stats)
 
 	// Get database statistics (fast)
 	if f.db != nil {
@@ -854,6 +917,8 @@ func (f *Filesystem) GetQuickStats() (*Stats, error) {
 				stats.UploadsCompleted++
 			case uploadErrored:
 				stats.UploadsErrored++
+			case uploadVerifying:
+				stats.UploadsVerifying++
 			}
 		}
 		f.uploads.mutex.RUnlock()
@@ -871,6 +936,8 @@ func (f *Filesystem) GetQuickStats() (*Stats, error) {
 			stats.StatusLocalModified++
 		case StatusSyncing:
 			stats.StatusSyncing++
+		case StatusVerifying:
+			stats.StatusVerifying++
 		case StatusDownloading:
 			stats.StatusDownloading++
 		case StatusOutofSync:
@@ -887,6 +954,41 @@ func (f *Filesystem) GetQuickStats() (*Stats, error) {
 	return stats, nil
 }
 
+// augmentAttrCacheStats refreshes the live attribute cache, read-ahead, write
+// coalescing, indexer access and resource usage counters, which change far more often than the cached statistics are
+// recalculated.
+func (f *Filesystem) augmentAttrCacheStats(stats *Stats) {
+	if stats == nil {
+		return
+	}
+	attr := f.AttrCacheStats()
+	stats.AttrCacheHits = attr.Hits
+	stats.AttrCacheMisses = attr.Misses
+
+	readAhead := f.ReadAheadStats()
+	stats.ReadAheadSequentialReads = readAhead.SequentialReads
+	stats.ReadAheadRandomReads = readAhead.RandomReads
+	stats.ReadAheadPrefetches = readAhead.Prefetches
+	stats.ReadAheadPrefetchedBytes = readAhead.PrefetchedBytes
+
+	writes := f.WriteCoalescingStats()
+	stats.CoalescedWrites = writes.CoalescedWrites
+	stats.CoalescedFlushes = writes.Flushes
+
+	appends := f.AppendUploadStats()
+	stats.AppendCoalescedFsyncs = appends.CoalescedFsyncs
+	stats.AppendUploads = appends.Uploads
+
+	stats.Chunks = f.ChunkProfile()
+
+	stats.Usage = f.ResourceUsage()
+	stats.ServiceHealth = f.ServiceHealth()
+	stats.NameCollisions = f.NameCollisions()
+
+	stats.IndexerOpens = f.access.indexerOpens.Load()
+	stats.IndexerHydrationsRefused = f.access.indexerRefused.Load()
+}
+
 func (f *Filesystem) augmentRealtimeStats(stats *Stats) {
 	if stats == nil {
 		return
@@ -898,6 +1000,7 @@ func (f *Filesystem) augmentRealtimeStats(stats *Stats) {
 	stats.RealtimeMissedHeartbeats = 0
 	stats.RealtimeConsecutiveFailures = 0
 	stats.RealtimeReconnectCount = 0
+	stats.RealtimeLatency = f.RealtimeLatency()
 
 	if f.realtimeOptions != nil && f.realtimeOptions.Enabled {
 		if f.realtimeOptions.PollingOnly {
@@ -945,3 +1048,17 @@ func (f *Filesystem) augmentRealtimeStats(stats *Stats) {
 		}
 	}
 }
+
+// thumbnailStats fills in the thumbnail cache statistics.
+func (f *Filesystem) thumbnailStats(stats *Stats) {
+	stats.ThumbnailLimit = f.thumbnailLimit.Load()
+	if f.thumbnails == nil {
+		return
+	}
+	thumbnails, err := f.thumbnails.Stats()
+	if err != nil {
+		logging.Warn().Err(err).Msg("Failed to read thumbnail cache statistics")
+	}
+	stats.ThumbnailCount = thumbnails.Files
+	stats.ThumbnailSize = thumbnails.Bytes
+}
@@ -0,0 +1,35 @@
+package fs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUT_FS_Stats_DBusGetStatsRoundTrips checks that the statistics a mount
+// returns over D-Bus decode into the same Stats "onemount --stats" prints.
+func TestUT_FS_Stats_DBusGetStatsRoundTrips(t *testing.T) {
+	fs := setupEvictionTestFS(t, 0)
+	fs.thumbnails = NewThumbnailCache(t.TempDir())
+	file := NewInodeDriveItem(&graph.DriveItem{ID: "doc", Name: "report.txt", Size: 5, File: &graph.File{}})
+	registerHydratedEntry(t, fs, file)
+	require.NoError(t, fs.content.Insert("doc", []byte("hello")))
+	require.NoError(t, fs.thumbnails.Insert("doc", "small", []byte("png")))
+
+	server := &FileStatusDBusServer{fs: fs}
+	data, dbusErr := server.GetStats()
+	require.Nil(t, dbusErr)
+
+	var stats Stats
+	require.NoError(t, json.Unmarshal([]byte(data), &stats))
+	require.Equal(t, 1, stats.ContentCount)
+	require.Equal(t, int64(5), stats.ContentSize)
+	require.Equal(t, 1, stats.ThumbnailCount)
+	require.NotEmpty(t, stats.DBPath)
+
+	again, err := json.Marshal(&stats)
+	require.NoError(t, err)
+	require.JSONEq(t, data, string(again), "no statistic is lost on the way")
+}
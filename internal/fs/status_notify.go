@@ -0,0 +1,110 @@
+package fs
+
+import (
+	"sync"
+
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// Status changes are pushed to the file manager as they happen instead of
+// waiting for the status cache TTL to expire. Explicit status updates and
+// metadata state transitions drop the item's cached determination and queue
+// it for a refresh. A single goroutine drains the queue, recomputes each
+// queued item's status, updates its status xattrs and emits a D-Bus signal
+// when the status actually changed. Refreshing off the caller's goroutine
+// keeps notification safe on paths that hold inode or upload locks.
+
+// statusNotifier coalesces pending status refreshes. The zero value is ready
+// to use.
+type statusNotifier struct {
+	mu      sync.Mutex
+	pending map[string]struct{}
+	running bool
+}
+
+// staleExplicitStatus reports whether an explicitly set status no longer
+// applies once the item reaches state. Downloads, uploads and errors set the
+// status they need right after their transitions, so only states reached
+// through other paths (eviction, invalidation, deletion) are listed.
+func staleExplicitStatus(state metadata.ItemState) bool {
+	switch state {
+	case metadata.ItemStateGhost, metadata.ItemStateHydrated, metadata.ItemStateDeleted:
+		return true
+	}
+	return false
+}
+
+// onStateTransition keeps file status in step with a metadata transition.
+func (f *Filesystem) onStateTransition(id string, state metadata.ItemState) {
+	if staleExplicitStatus(state) {
+		f.statusM.Lock()
+		delete(f.statuses, id)
+		f.statusM.Unlock()
+	}
+	f.notifyStatusChange(id)
+}
+
+// notifyStatusChange invalidates the item's cached status and queues a
+// refresh of its status xattrs and D-Bus signal.
+func (f *Filesystem) notifyStatusChange(id string) {
+	if id == "" {
+		return
+	}
+	if f.statusCache != nil {
+		f.statusCache.invalidate(id)
+	}
+
+	n := &f.statusNotify
+	n.mu.Lock()
+	if n.pending == nil {
+		n.pending = make(map[string]struct{})
+	}
+	n.pending[id] = struct{}{}
+	if n.running {
+		n.mu.Unlock()
+		return
+	}
+	n.running = true
+	n.mu.Unlock()
+
+	go f.drainStatusNotifications()
+}
+
+func (f *Filesystem) drainStatusNotifications() {
+	n := &f.statusNotify
+	for {
+		n.mu.Lock()
+		if len(n.pending) == 0 || (f.ctx != nil && f.ctx.Err() != nil) {
+			n.pending = nil
+			n.running = false
+			n.mu.Unlock()
+			return
+		}
+		batch := n.pending
+		n.pending = nil
+		n.mu.Unlock()
+
+		for id := range batch {
+			f.refreshFileStatus(id)
+		}
+	}
+}
+
+// refreshFileStatus recomputes the status of a loaded item and publishes it
+// when it differs from the status last written to its xattrs.
+func (f *Filesystem) refreshFileStatus(id string) {
+	inode := f.GetID(id)
+	if inode == nil {
+		return
+	}
+	inode.mu.RLock()
+	previous := string(inode.xattrs[xattrStatus])
+	previousErr := string(inode.xattrs[xattrStatusError])
+	inode.mu.RUnlock()
+
+	status := f.GetFileStatus(id)
+	if status.Status.String() == previous && status.ErrorMsg == previousErr {
+		return
+	}
+	f.updateFileStatus(inode)
+}
@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func statusXAttr(inode *Inode) string {
+	inode.mu.RLock()
+	defer inode.mu.RUnlock()
+	return string(inode.xattrs[xattrStatus])
+}
+
+func TestUT_FS_StatusNotify_TransitionsRefreshStatusImmediately(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.statusCache = newStatusCache(time.Hour) // longer than the test; only invalidation can refresh
+
+	file := NewInode("report.txt", fuse.S_IFREG|0644, nil)
+	file.DriveItem.ID = "file"
+	registerHydratedEntry(t, fs, file)
+	require.NoError(t, fs.content.Insert(file.ID(), []byte("content")))
+
+	fs.SetFileStatus(file.ID(), FileStatusInfo{Status: StatusLocal, Timestamp: time.Now()})
+	require.Eventually(t, func() bool { return statusXAttr(file) == StatusLocal.String() },
+		time.Second, 5*time.Millisecond, "explicit status is published")
+
+	// Eviction drops the content and the now stale explicit status.
+	require.NoError(t, fs.content.Delete(file.ID()))
+	fs.transitionItemState(file.ID(), metadata.ItemStateGhost)
+	require.Eventually(t, func() bool { return statusXAttr(file) == StatusCloud.String() },
+		time.Second, 5*time.Millisecond, "eviction is published without waiting for the cache TTL")
+	require.Equal(t, StatusCloud, fs.GetFileStatus(file.ID()).Status)
+}
+
+func TestUT_FS_StatusNotify_KeepsExplicitStatusForOtherStates(t *testing.T) {
+	require.True(t, staleExplicitStatus(metadata.ItemStateGhost))
+	require.True(t, staleExplicitStatus(metadata.ItemStateHydrated))
+	require.False(t, staleExplicitStatus(metadata.ItemStateHydrating), "downloads set their own status")
+	require.False(t, staleExplicitStatus(metadata.ItemStateDirtyLocal), "writes set their own status")
+	require.False(t, staleExplicitStatus(metadata.ItemStateError), "errors carry a message")
+}
@@ -0,0 +1,130 @@
+package fs
+
+import (
+	"hash/fnv"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Strict POSIX mode trades throughput for the semantics some applications
+// (git, build tools, databases) rely on. Mkdir, Rmdir, Unlink and Rename only
+// return once OneDrive has confirmed the change, Fsync waits for the upload to
+// finish, and inode numbers are derived from the item ID so they stay the same
+// across remounts. The number is stored with the metadata entry, so a file
+// created locally keeps the number derived from its local ID once its upload
+// gives it its OneDrive ID. When one of these operations cannot be confirmed,
+// e.g. while offline, it fails with EREMOTEIO instead of being recorded
+// locally.
+
+// SetStrictPOSIX enables or disables strict POSIX mode. It must be called
+// before the filesystem is mounted; inodes already registered are renumbered
+// so the kernel never sees two numbers for the same item.
+func (f *Filesystem) SetStrictPOSIX(enabled bool) {
+	f.Lock()
+	f.strictPOSIX = enabled
+	f.Unlock()
+
+	f.nodeIndexMu.RLock()
+	defer f.nodeIndexMu.RUnlock()
+	for _, inode := range f.nodeIndex {
+		inode.mu.Lock()
+		if enabled {
+			if inode.ino == 0 {
+				inode.ino = stableIno(inode.DriveItem.ID)
+			}
+		} else {
+			inode.ino = 0
+		}
+		inode.mu.Unlock()
+	}
+}
+
+// StrictPOSIX reports whether strict POSIX mode is enabled.
+func (f *Filesystem) StrictPOSIX() bool {
+	f.RLock()
+	defer f.RUnlock()
+	return f.strictPOSIX
+}
+
+// stableIno derives an inode number from an item ID. The top bit is cleared
+// so applications storing inode numbers as signed integers see them positive.
+func stableIno(id string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(id))
+	ino := h.Sum64() &^ (1 << 63)
+	if ino == 0 {
+		ino = 1
+	}
+	return ino
+}
+
+// strictMutation runs a remote mutation before the calling FUSE operation
+// returns, mapping any failure to EREMOTEIO.
+func (f *Filesystem) strictMutation(operation, id string, fn func() error) fuse.Status {
+	if f.IsOffline() || f.auth == nil {
+		logging.Warn().
+			Str("mutation", operation).
+			Str("id", id).
+			Msg("Strict POSIX mode rejected a change that cannot be confirmed remotely")
+		return fuse.EREMOTEIO
+	}
+	if err := fn(); err != nil {
+		logging.Warn().
+			Str("mutation", operation).
+			Str("id", id).
+			Err(err).
+			Msg("Strict POSIX mutation failed")
+		return fuse.EREMOTEIO
+	}
+	return fuse.OK
+}
+
+// mkdirStrict creates a directory on OneDrive before it is added locally, so
+// the kernel only ever sees its remote ID and inode number.
+func (f *Filesystem) mkdirStrict(parentID string, dir *Inode, out *fuse.EntryOut) fuse.Status {
+	if isLocalID(parentID) {
+		return fuse.EREMOTEIO
+	}
+	var item *graph.DriveItem
+	status := f.strictMutation("mkdir", parentID, func() error {
+		var err error
+		item, err = graph.MkdirWithContext(f.mountContext(), dir.Name(), parentID, f.auth)
+		return err
+	})
+	if status != fuse.OK {
+		return status
+	}
+
+	dir.mu.Lock()
+	dir.DriveItem.ID = item.ID
+	dir.DriveItem.ETag = item.ETag
+	if item.ModTime != nil {
+		dir.DriveItem.ModTime = item.ModTime
+	}
+	dir.mu.Unlock()
+
+	out.NodeId = f.InsertChild(parentID, dir)
+	out.Generation = dir.Generation()
+	out.Attr = dir.makeAttr()
+	out.SetAttrTimeout(timeout)
+	out.SetEntryTimeout(timeout)
+	f.persistMetadataEntry(item.ID, dir)
+	f.markHydratedState(item.ID)
+	return fuse.OK
+}
+
+// renameStrict moves an item on OneDrive before it is moved locally. Items
+// that were never uploaded only exist locally and are not confirmed.
+func (f *Filesystem) renameStrict(remoteID, newParentID, newName string) fuse.Status {
+	if remoteID == "" {
+		return fuse.OK
+	}
+	if isLocalID(newParentID) {
+		return fuse.EREMOTEIO
+	}
+	return f.strictMutation("rename", remoteID, func() error {
+		return graph.RenameWithContext(f.mountContext(), remoteID, newName, newParentID, f.auth)
+	})
+}
@@ -0,0 +1,110 @@
+package fs
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_StrictPOSIX_StableInodeNumbers(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.uploads = nil
+
+	before := NewInode("before.txt", fuse.S_IFREG|0644, nil)
+	before.DriveItem.ID = "item-before"
+	registerHydratedEntry(t, fs, before)
+	require.Equal(t, before.NodeID(), before.makeAttr().Ino, "relaxed mode reports node IDs")
+
+	fs.SetStrictPOSIX(true)
+	require.True(t, fs.StrictPOSIX())
+	require.Equal(t, stableIno("item-before"), before.makeAttr().Ino, "registered inodes are renumbered")
+
+	after := NewInode("after.txt", fuse.S_IFREG|0644, nil)
+	after.DriveItem.ID = "item-after"
+	registerHydratedEntry(t, fs, after)
+	require.Equal(t, stableIno("item-after"), after.Ino())
+	require.NotEqual(t, after.NodeID(), after.Ino())
+
+	require.Equal(t, stableIno("item-after"), stableIno("item-after"), "numbers do not depend on mount order")
+	require.NotEqual(t, stableIno("item-before"), stableIno("item-after"))
+	require.Zero(t, stableIno("item-after")&(1<<63), "numbers stay positive as signed integers")
+
+	fs.SetStrictPOSIX(false)
+	require.Equal(t, after.NodeID(), after.Ino())
+}
+
+func TestUT_FS_StrictPOSIX_InodeNumberSurvivesUpload(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.uploads = nil
+	fs.SetStrictPOSIX(true)
+
+	parent := NewInode("parent", fuse.S_IFDIR|0755, nil)
+	parent.DriveItem.ID = "parent"
+	registerHydratedEntry(t, fs, parent)
+	file := NewInode("new.txt", fuse.S_IFREG|0644, parent)
+	registerHydratedEntry(t, fs, file)
+	fs.InsertChild(parent.ID(), file)
+	require.NoError(t, fs.content.Insert(file.ID(), []byte("draft")))
+	ino := file.Ino()
+	require.Equal(t, stableIno(file.ID()), ino)
+
+	// The upload gives the file its OneDrive ID
+	require.NoError(t, fs.MoveID(file.ID(), "remote-1"))
+	require.Equal(t, ino, file.Ino())
+
+	// and a remount finds the number in the metadata store
+	entry, err := fs.GetMetadataEntry("remote-1")
+	require.NoError(t, err)
+	require.Equal(t, ino, entry.Ino)
+	reloaded := fs.inodeFromMetadataEntry(entry)
+	fs.InsertNodeID(reloaded)
+	require.Equal(t, ino, reloaded.Ino())
+}
+
+func TestUT_FS_StrictPOSIX_MetadataChangesWaitForOneDrive(t *testing.T) {
+	mockClient := graph.NewMockGraphClient()
+	t.Cleanup(mockClient.Cleanup)
+
+	fs := newTestFilesystemWithMetadata(t)
+	fs.auth = &mockClient.Auth
+	fs.SetStrictPOSIX(true)
+
+	parent := NewInode("parent", fuse.S_IFDIR|0755, nil)
+	parent.DriveItem.ID = "parent"
+	registerHydratedEntry(t, fs, parent)
+	file := NewInode("notes.txt", fuse.S_IFREG|0644, parent)
+	file.DriveItem.ID = "file-1"
+	registerHydratedEntry(t, fs, file)
+	fs.InsertChild(parent.ID(), file)
+
+	var out fuse.EntryOut
+	mkdirIn := &fuse.MkdirIn{InHeader: fuse.InHeader{NodeId: parent.NodeID()}, Mode: 0755}
+	require.Equal(t, fuse.OK, fs.Mkdir(nil, mkdirIn, "src", &out))
+	dir := fs.GetNodeID(out.NodeId)
+	require.NotNil(t, dir)
+	require.False(t, isLocalID(dir.ID()), "the directory is created remotely before returning")
+	require.Equal(t, stableIno(dir.ID()), out.Attr.Ino)
+
+	// A failed remote delete leaves the file in place.
+	mockClient.AddMockResponse("/me/drive/items/file-1",
+		[]byte(`{"error":{"code":"accessDenied","message":"Access denied"}}`), http.StatusForbidden, nil)
+	header := &fuse.InHeader{NodeId: parent.NodeID()}
+	require.Equal(t, fuse.EREMOTEIO, fs.Unlink(nil, header, "notes.txt"))
+	require.NotNil(t, fs.GetID("file-1"))
+
+	mockClient.AddMockResponse("/me/drive/items/file-1", nil, http.StatusNoContent, nil)
+	require.Equal(t, fuse.OK, fs.Unlink(nil, header, "notes.txt"))
+	require.Nil(t, fs.GetID("file-1"))
+
+	// Changes that cannot be confirmed are refused while offline.
+	fs.Lock()
+	fs.offline = true
+	fs.Unlock()
+	renameIn := &fuse.RenameIn{InHeader: fuse.InHeader{NodeId: parent.NodeID()}, Newdir: parent.NodeID()}
+	require.Equal(t, fuse.EREMOTEIO, fs.Rename(nil, renameIn, "src", "lib"))
+	require.Equal(t, "src", dir.Name())
+	require.Equal(t, fuse.EREMOTEIO, fs.Mkdir(nil, mkdirIn, "docs", &out))
+}
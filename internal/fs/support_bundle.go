@@ -0,0 +1,449 @@
+package fs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	bolt "go.etcd.io/bbolt"
+)
+
+// A support bundle is a single tar.gz users can attach to bug reports. It
+// holds the upload, offline and deferred queues, recent errors, statistics,
+// the state of the worker pools, the configuration and the tail of the log. File and folder names are
+// replaced by short hashes (keeping extensions) and secrets are redacted, so
+// the bundle does not reveal what is stored in the drive.
+
+// SupportSnapshotName is the file in the cache directory holding the most
+// recent automatic support bundle.
+const SupportSnapshotName = "support-bundle.tar.gz"
+
+const (
+	defaultSupportSnapshotInterval = time.Hour
+	supportBundleLogTailBytes      = 256 * 1024
+	supportBundleMaxErrors         = 200
+)
+
+// SupportBundleSources are the parts of a support bundle kept outside the
+// filesystem.
+type SupportBundleSources struct {
+	Config  []byte // configuration as YAML, with secrets already removed
+	LogPath string // log file, empty when logging to stdout
+}
+
+// supportQueues is the queues.json document of a support bundle.
+type supportQueues struct {
+	Uploads           []supportUpload `json:"uploads"`
+	PendingHigh       []string        `json:"pending_high_priority"`
+	PendingLow        []string        `json:"pending_low_priority"`
+	DeferredUploads   []supportItem   `json:"deferred_uploads"`
+	DirtyItems        []supportItem   `json:"dirty_items"`
+	OfflineChanges    []supportChange `json:"offline_changes"`
+	MutationQueueSize int             `json:"mutation_queue_size"`
+	DeletionQueueSize int             `json:"deletion_queue_size"`
+	Offline           bool            `json:"offline"`
+}
+
+type supportUpload struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	Size             uint64    `json:"size"`
+	State            string    `json:"state"`
+	BytesUploaded    uint64    `json:"bytes_uploaded"`
+	RecoveryAttempts int       `json:"recovery_attempts"`
+	LastProgress     time.Time `json:"last_progress,omitempty"`
+	Error            string    `json:"error,omitempty"`
+}
+
+type supportItem struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type supportChange struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Path      string    `json:"path,omitempty"`
+	OldPath   string    `json:"old_path,omitempty"`
+	NewPath   string    `json:"new_path,omitempty"`
+	State     string    `json:"state,omitempty"`
+	Attempts  int       `json:"attempts,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// supportError is one entry of errors.json.
+type supportError struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name,omitempty"`
+	Source     string    `json:"source"`
+	Message    string    `json:"message"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// SetSupportBundleSources records the configuration and log file included in
+// support bundles.
+func (f *Filesystem) SetSupportBundleSources(sources SupportBundleSources) {
+	f.supportM.Lock()
+	f.supportSources = sources
+	f.supportM.Unlock()
+}
+
+// WriteSupportBundle writes a support bundle to w.
+func (f *Filesystem) WriteSupportBundle(w io.Writer) error {
+	f.supportM.RLock()
+	sources := f.supportSources
+	f.supportM.RUnlock()
+
+	queues, errs := f.supportSnapshot()
+	return writeSupportArchive(w, "onemount-support", []supportFile{
+		{"queues.json", func() ([]byte, error) { return json.MarshalIndent(queues, "", "  ") }},
+		{"errors.json", func() ([]byte, error) { return json.MarshalIndent(errs, "", "  ") }},
+		{"stats.json", f.supportStats},
+		{"workers.json", func() ([]byte, error) { return json.MarshalIndent(f.WorkerPoolStats(), "", "  ") }},
+		{"crashes.json", func() ([]byte, error) {
+			summary, err := ReadCrashSummary(f.cacheDir())
+			if err != nil {
+				return nil, err
+			}
+			return json.MarshalIndent(summary, "", "  ")
+		}},
+		{"config.yml", func() ([]byte, error) { return sources.Config, nil }},
+		{"log-tail.txt", func() ([]byte, error) { return supportLogTail(sources.LogPath) }},
+	})
+}
+
+// supportFile is a file of a support bundle or crash report.
+type supportFile struct {
+	name string
+	data func() ([]byte, error)
+}
+
+// writeSupportArchive writes files as a tar.gz holding the directory dir.
+func writeSupportArchive(w io.Writer, dir string, files []supportFile) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, file := range files {
+		data, err := file.data()
+		if err != nil {
+			// A missing part should not prevent the rest from being reported.
+			data = []byte("unavailable: " + err.Error() + "\n")
+		}
+		header := &tar.Header{
+			Name:    path.Join(dir, file.name),
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// WriteSupportBundleFile writes a support bundle to the file at path,
+// replacing it atomically.
+func (f *Filesystem) WriteSupportBundleFile(target string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".support-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	if err := f.WriteSupportBundle(tmp); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// cacheDir is the mount's cache directory, holding the content cache.
+func (f *Filesystem) cacheDir() string {
+	return filepath.Dir(f.content.directory)
+}
+
+// supportSnapshotPath is where automatic support bundles are written.
+func (f *Filesystem) supportSnapshotPath() string {
+	return filepath.Join(f.cacheDir(), SupportSnapshotName)
+}
+
+// StartSupportSnapshots writes a support bundle to the cache directory
+// immediately and then at every interval, so a recent one is available even
+// when the mount can no longer be reached.
+func (f *Filesystem) StartSupportSnapshots(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultSupportSnapshotInterval
+	}
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := f.WriteSupportBundleFile(f.supportSnapshotPath()); err != nil {
+				logging.Warn().Err(err).Msg("Failed to write support bundle snapshot")
+			}
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// supportSnapshot collects the queue contents and recent errors.
+func (f *Filesystem) supportSnapshot() (supportQueues, []supportError) {
+	queues := supportQueues{
+		Uploads:         []supportUpload{},
+		PendingHigh:     []string{},
+		PendingLow:      []string{},
+		DeferredUploads: []supportItem{},
+		DirtyItems:      []supportItem{},
+		OfflineChanges:  []supportChange{},
+		Offline:         f.IsOffline(),
+	}
+	errs := []supportError{}
+
+	if u := f.uploads; u != nil {
+		u.mutex.RLock()
+		for id, session := range u.sessions {
+			upload := supportUpload{
+				ID:    id,
+				Name:  sanitizeName(session.Name),
+				Size:  session.Size,
+				State: uploadStateName(session.getState()),
+			}
+			session.Lock()
+			upload.BytesUploaded = session.BytesUploaded
+			upload.RecoveryAttempts = session.RecoveryAttempts
+			upload.LastProgress = session.LastProgressTime
+			if session.error != nil {
+				upload.Error = redactSecrets(session.error.Error())
+			}
+			session.Unlock()
+			queues.Uploads = append(queues.Uploads, upload)
+		}
+		for id := range u.pendingHighPriorityUploads {
+			queues.PendingHigh = append(queues.PendingHigh, id)
+		}
+		for id := range u.pendingLowPriorityUploads {
+			queues.PendingLow = append(queues.PendingLow, id)
+		}
+		queues.DeletionQueueSize = len(u.deletionQueue)
+		u.mutex.RUnlock()
+	}
+	queues.MutationQueueSize = len(f.mutationQueue)
+
+	if journal, err := f.offlineJournal(); err == nil {
+		if changes, err := journal.List(context.Background()); err == nil {
+			for _, change := range changes {
+				queues.OfflineChanges = append(queues.OfflineChanges, supportChange{
+					ID:        change.ID,
+					Type:      change.Type,
+					Path:      sanitizePath(change.Path),
+					OldPath:   sanitizePath(change.OldPath),
+					NewPath:   sanitizePath(change.NewPath),
+					State:     string(change.State),
+					Attempts:  change.Attempts,
+					LastError: redactSecrets(change.LastError),
+					Timestamp: change.Timestamp,
+				})
+			}
+		}
+	}
+
+	if f.db != nil {
+		_ = f.db.View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(bucketMetadataV2)
+			if bucket == nil {
+				return nil
+			}
+			return bucket.ForEach(func(_, v []byte) error {
+				var entry metadata.Entry
+				if err := json.Unmarshal(v, &entry); err != nil {
+					return nil
+				}
+				name := sanitizeName(entry.Name)
+				if entry.State == metadata.ItemStateDirtyLocal {
+					item := supportItem{ID: entry.ID, Name: name, State: string(entry.State)}
+					if entry.Upload.DeferredReason != "" {
+						item.Reason = entry.Upload.DeferredReason
+						queues.DeferredUploads = append(queues.DeferredUploads, item)
+					} else {
+						queues.DirtyItems = append(queues.DirtyItems, item)
+					}
+				}
+				for source, opErr := range map[string]*metadata.OperationError{
+					"item":    entry.LastError,
+					"upload":  entry.Upload.LastError,
+					"hydrate": entry.Hydration.Error,
+				} {
+					if opErr == nil {
+						continue
+					}
+					errs = append(errs, supportError{
+						ID:         entry.ID,
+						Name:       name,
+						Source:     source,
+						Message:    redactSecrets(opErr.Message),
+						OccurredAt: opErr.OccurredAt,
+					})
+				}
+				return nil
+			})
+		})
+	}
+
+	f.statusM.RLock()
+	for id, status := range f.statuses {
+		if status.Status != StatusError && status.Status != StatusConflict {
+			continue
+		}
+		errs = append(errs, supportError{
+			ID:         id,
+			Source:     "status:" + status.Status.String(),
+			Message:    redactSecrets(status.ErrorMsg),
+			OccurredAt: status.Timestamp,
+		})
+	}
+	f.statusM.RUnlock()
+
+	sort.Slice(queues.Uploads, func(i, j int) bool { return queues.Uploads[i].ID < queues.Uploads[j].ID })
+	sort.Strings(queues.PendingHigh)
+	sort.Strings(queues.PendingLow)
+	sort.Slice(errs, func(i, j int) bool { return errs[i].OccurredAt.After(errs[j].OccurredAt) })
+	if len(errs) > supportBundleMaxErrors {
+		errs = errs[:supportBundleMaxErrors]
+	}
+	return queues, errs
+}
+
+func uploadStateName(state int) string {
+	switch state {
+	case uploadNotStarted:
+		return "not-started"
+	case uploadStarted:
+		return "in-progress"
+	case uploadComplete:
+		return "completed"
+	case uploadErrored:
+		return "errored"
+	case uploadVerifying:
+		return "verifying"
+	}
+	return "unknown"
+}
+
+// supportStats returns the quick statistics with local paths and the delta
+// token removed.
+func (f *Filesystem) supportStats() ([]byte, error) {
+	stats, err := f.GetQuickStats()
+	if err != nil {
+		return nil, err
+	}
+	if stats.DeltaLink != "" {
+		stats.DeltaLink = "[REDACTED]"
+	}
+	stats.ContentDir = filepath.Base(stats.ContentDir)
+	stats.DBPath = filepath.Base(stats.DBPath)
+	stats.MaxFilesInDirID = ""
+	stats.FileExtensions = nil
+	return json.MarshalIndent(stats, "", "  ")
+}
+
+// supportLogTail returns the end of the log file with secrets redacted.
+func supportLogTail(logPath string) ([]byte, error) {
+	if logPath == "" {
+		return []byte("logging to standard output, no log file\n"), nil
+	}
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - supportBundleLogTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		// drop the partial first line
+		if i := strings.IndexByte(string(data), '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return []byte(redactSecrets(string(data))), nil
+}
+
+// secretPattern matches tokens, client secrets and pre-authenticated upload
+// URLs in log lines and error messages.
+var secretPattern = regexp.MustCompile(
+	`(?i)((?:access|refresh)_?token|client_?secret|client_?state|authorization|upload_?url|tempauth)("?\s*[:=]\s*"?)(?:bearer\s+)?[^"\s,}&]+`)
+
+// redactSecrets removes secrets from text included in a support bundle.
+func redactSecrets(text string) string {
+	return secretPattern.ReplaceAllString(text, "${1}${2}[REDACTED]")
+}
+
+// sanitizeName replaces a file name by a short hash, keeping the extension
+// since file types often matter when reproducing a problem.
+func sanitizeName(name string) string {
+	if name == "" || name == "root" {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) > 8 || strings.ContainsAny(ext, " ") {
+		ext = ""
+	}
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:4]) + ext
+}
+
+// sanitizePath sanitizes every component of a path.
+func sanitizePath(p string) string {
+	if p == "" {
+		return ""
+	}
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = sanitizeName(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,92 @@
+package fs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/stretchr/testify/require"
+)
+
+// readSupportBundle returns the files of a support bundle by name.
+func readSupportBundle(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[path.Base(header.Name)] = string(content)
+	}
+	return files
+}
+
+func TestUT_FS_SupportBundle_SanitizedSnapshot(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	failedAt := time.Now().UTC()
+	seedEntry(t, fs, &metadata.Entry{
+		ID:       "deferred",
+		Name:     "holiday-video.mp4",
+		ItemType: metadata.ItemKindFile,
+		State:    metadata.ItemStateDirtyLocal,
+		Upload:   metadata.UploadState{DeferredReason: DeferredMetered},
+	})
+	seedEntry(t, fs, &metadata.Entry{
+		ID:       "failed",
+		Name:     "tax-return.pdf",
+		ItemType: metadata.ItemKindFile,
+		State:    metadata.ItemStateError,
+		LastError: &metadata.OperationError{
+			Message:    "upload rejected, access_token=eyJ0eXAi",
+			OccurredAt: failedAt,
+		},
+	})
+	fs.SetFileStatus("conflicted", FileStatusInfo{Status: StatusConflict, ErrorMsg: "changed locally and remotely"})
+
+	logPath := filepath.Join(t.TempDir(), "onemount.log")
+	require.NoError(t, os.WriteFile(logPath, []byte("uploading chunk\nAuthorization: Bearer secret-token\n"), 0600))
+	fs.SetSupportBundleSources(SupportBundleSources{Config: []byte("log: debug\n"), LogPath: logPath})
+
+	var buf bytes.Buffer
+	require.NoError(t, fs.WriteSupportBundle(&buf))
+	files := readSupportBundle(t, buf.Bytes())
+	for _, name := range []string{"queues.json", "errors.json", "stats.json", "workers.json", "crashes.json", "config.yml", "log-tail.txt"} {
+		require.Contains(t, files, name)
+	}
+
+	require.Contains(t, files["queues.json"], `"reason": "DeferredMetered"`)
+	require.Contains(t, files["queues.json"], sanitizeName("holiday-video.mp4"))
+	require.Contains(t, files["errors.json"], "upload rejected")
+	require.Contains(t, files["errors.json"], "changed locally and remotely")
+	require.Equal(t, "log: debug\n", files["config.yml"])
+	require.Contains(t, files["log-tail.txt"], "uploading chunk")
+	require.Contains(t, files["crashes.json"], `"count": 0`)
+
+	all := strings.Join([]string{files["queues.json"], files["errors.json"], files["log-tail.txt"]}, "\n")
+	for _, secret := range []string{"holiday-video", "tax-return", "eyJ0eXAi", "secret-token"} {
+		require.NotContains(t, all, secret)
+	}
+	require.True(t, strings.HasSuffix(sanitizeName("holiday-video.mp4"), ".mp4"), "extensions are kept")
+	require.Equal(t, sanitizeName("a")+"/"+sanitizeName("b.txt"), sanitizePath("a/b.txt"))
+
+	target := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	require.NoError(t, fs.WriteSupportBundleFile(target))
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	require.Len(t, readSupportBundle(t, data), 7)
+}
@@ -0,0 +1,239 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/godbus/dbus/v5"
+)
+
+// After a system suspend the tokens may have expired, the realtime connection
+// is dead and the delta link is stale. The suspend monitor follows logind's
+// PrepareForSleep signal. Before sleep, upload progress is checkpointed and
+// no new uploads or downloads start; a logind delay lock gives us the moment
+// to do so. On resume, the tokens are refreshed, files that are open are
+// revalidated against the server, and the delta loop reconnects the realtime
+// subscription and polls for changes at once instead of waiting for its next
+// interval.
+
+// logind D-Bus names.
+const (
+	logindBusName    = "org.freedesktop.login1"
+	logindObjectPath = "/org/freedesktop/login1"
+	logindManager    = "org.freedesktop.login1.Manager"
+)
+
+// resumeRefreshMargin is longer than any token lifetime, so the tokens are
+// always renewed on resume.
+const resumeRefreshMargin = 24 * time.Hour
+
+// suspendState tracks system suspend. The zero value is ready to use.
+type suspendState struct {
+	mu       sync.Mutex
+	sleeping bool
+	resumed  chan struct{} // closed on resume; nil while awake
+	wake     chan struct{} // wakes the delta loop after a resume
+}
+
+// Suspended reports whether the system is about to sleep or sleeping.
+func (f *Filesystem) Suspended() bool {
+	f.suspend.mu.Lock()
+	defer f.suspend.mu.Unlock()
+	return f.suspend.sleeping
+}
+
+// resumeWake returns the channel signalled when the delta loop should poll
+// after a resume.
+func (f *Filesystem) resumeWake() chan struct{} {
+	s := &f.suspend
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wake == nil {
+		s.wake = make(chan struct{}, 1)
+	}
+	return s.wake
+}
+
+// waitWhileSuspended blocks until the system resumed. It returns false if stop
+// was closed first.
+func (f *Filesystem) waitWhileSuspended(stop <-chan struct{}) bool {
+	f.suspend.mu.Lock()
+	resumed := f.suspend.resumed
+	f.suspend.mu.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// handlePrepareForSleep reacts to logind's PrepareForSleep signal.
+func (f *Filesystem) handlePrepareForSleep(sleeping bool) {
+	if sleeping {
+		f.prepareForSleep()
+	} else {
+		f.resumeFromSleep()
+	}
+}
+
+// prepareForSleep stops new transfers and checkpoints running uploads, so
+// they continue from their last chunk after resume.
+func (f *Filesystem) prepareForSleep() {
+	s := &f.suspend
+	s.mu.Lock()
+	if s.sleeping {
+		s.mu.Unlock()
+		return
+	}
+	s.sleeping = true
+	s.resumed = make(chan struct{})
+	s.mu.Unlock()
+
+	logging.Info().Msg("System is going to sleep, pausing transfers")
+	if f.uploads != nil && f.uploads.db != nil {
+		f.uploads.persistActiveUploads()
+	}
+}
+
+// resumeFromSleep restarts transfers, refreshes the tokens, revalidates open
+// files and wakes the delta loop.
+func (f *Filesystem) resumeFromSleep() {
+	s := &f.suspend
+	s.mu.Lock()
+	if !s.sleeping {
+		s.mu.Unlock()
+		return
+	}
+	s.sleeping = false
+	close(s.resumed)
+	s.resumed = nil
+	s.mu.Unlock()
+
+	logging.Info().Msg("System resumed from sleep, revalidating state")
+	ctx := f.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if f.auth != nil && !f.IsOffline() {
+		if err := f.auth.RefreshBefore(ctx, resumeRefreshMargin); err != nil {
+			logging.Warn().Err(err).Msg("Failed to refresh tokens after resume")
+		}
+	}
+	f.revalidateOpenFiles()
+
+	select {
+	case f.resumeWake() <- struct{}{}:
+	default:
+	}
+}
+
+// revalidateOpenFiles fetches the metadata of files that were open across the
+// suspend and applies it like a delta, invalidating content changed remotely
+// in the meantime. Files with local changes keep their content.
+func (f *Filesystem) revalidateOpenFiles() {
+	if f.content == nil || f.auth == nil || f.IsOffline() {
+		return
+	}
+	for _, id := range f.content.OpenIDs() {
+		if isLocalID(id) {
+			continue
+		}
+		if inode := f.GetID(id); inode == nil || inode.HasChanges() {
+			continue
+		}
+		item, err := graph.GetItemWithContext(f.mountContext(), id, f.auth)
+		if err != nil {
+			logging.Debug().Err(err).Str("id", id).Msg("Failed to revalidate open file after resume")
+			continue
+		}
+		if item.Parent == nil {
+			continue
+		}
+		if err := f.applyDelta(item); err != nil {
+			logging.Debug().Err(err).Str("id", id).Msg("Failed to apply revalidated metadata after resume")
+		}
+	}
+}
+
+// sleepDelayLock takes a logind inhibitor lock delaying sleep until it is
+// closed.
+func sleepDelayLock(conn *dbus.Conn) (*os.File, error) {
+	var fd dbus.UnixFD
+	err := conn.Object(logindBusName, logindObjectPath).Call(logindManager+".Inhibit", 0,
+		"sleep", "OneMount", "Pausing OneDrive transfers", "delay").Store(&fd)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "logind-inhibit"), nil
+}
+
+// StartSuspendMonitor follows logind's sleep signals from the system bus until
+// the filesystem stops. Without logind, suspends go unnoticed.
+func (f *Filesystem) StartSuspendMonitor() {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		logging.Debug().Err(err).Msg("Cannot connect to the system bus, not following suspend and resume")
+		return
+	}
+	err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(logindObjectPath),
+		dbus.WithMatchInterface(logindManager),
+		dbus.WithMatchMember("PrepareForSleep"),
+	)
+	if err != nil {
+		logging.Debug().Err(err).Msg("Cannot subscribe to logind, not following suspend and resume")
+		return
+	}
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+
+	lock, err := sleepDelayLock(conn)
+	if err != nil {
+		logging.Debug().Err(err).Msg("Cannot take a logind delay lock, transfers may be cut off by sleep")
+	}
+
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+		defer conn.RemoveSignal(signals)
+		defer func() {
+			if lock != nil {
+				lock.Close()
+			}
+		}()
+
+		for {
+			select {
+			case sig := <-signals:
+				if sig.Name != logindManager+".PrepareForSleep" || len(sig.Body) != 1 {
+					continue
+				}
+				sleeping, ok := sig.Body[0].(bool)
+				if !ok {
+					continue
+				}
+				f.handlePrepareForSleep(sleeping)
+				if sleeping {
+					if lock != nil {
+						lock.Close()
+						lock = nil
+					}
+				} else if lock == nil {
+					if lock, err = sleepDelayLock(conn); err != nil {
+						logging.Debug().Err(err).Msg("Cannot take a logind delay lock")
+					}
+				}
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_Suspend_PausesTransfersUntilResume(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	require.False(t, fs.Suspended())
+	require.True(t, fs.waitWhileSuspended(nil), "transfers run while awake")
+
+	fs.handlePrepareForSleep(true)
+	require.True(t, fs.Suspended())
+
+	done := make(chan bool, 1)
+	go func() { done <- fs.waitWhileSuspended(nil) }()
+	select {
+	case <-done:
+		t.Fatal("transfers started while sleeping")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fs.handlePrepareForSleep(false)
+	require.False(t, fs.Suspended())
+	select {
+	case resumed := <-done:
+		require.True(t, resumed)
+	case <-time.After(time.Second):
+		t.Fatal("transfers did not continue after resume")
+	}
+	select {
+	case <-fs.resumeWake():
+	default:
+		t.Fatal("delta loop was not woken after resume")
+	}
+
+	fs.handlePrepareForSleep(false)
+	select {
+	case <-fs.resumeWake():
+		t.Fatal("a resume without a prior sleep must not wake the delta loop")
+	default:
+	}
+}
+
+func TestUT_FS_Suspend_StopEndsWait(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.handlePrepareForSleep(true)
+	stop := make(chan struct{})
+	close(stop)
+	require.False(t, fs.waitWhileSuspended(stop))
+}
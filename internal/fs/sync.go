@@ -22,6 +22,7 @@ type SyncProgress struct {
 	LastUpdateTime       time.Time // Last progress update
 	IsComplete           bool      // Whether sync is complete
 	mutex                sync.RWMutex
+	job                  *Job // Job tracking the sync, counting directories
 }
 
 // SyncProgressSnapshot represents a snapshot of sync progress without mutex
@@ -54,6 +55,9 @@ func (sp *SyncProgress) GetProgress() SyncProgressSnapshot {
 func (sp *SyncProgress) UpdateProgress(processedDirs, processedFiles int64) {
 	atomic.AddInt64(&sp.ProcessedDirectories, processedDirs)
 	atomic.AddInt64(&sp.ProcessedFiles, processedFiles)
+	if sp.job != nil {
+		sp.job.Advance(uint64(processedDirs), 0)
+	}
 
 	sp.mutex.Lock()
 	sp.LastUpdateTime = time.Now()
@@ -64,6 +68,9 @@ func (sp *SyncProgress) UpdateProgress(processedDirs, processedFiles int64) {
 func (sp *SyncProgress) AddDiscovered(dirs, files int64) {
 	atomic.AddInt64(&sp.TotalDirectories, dirs)
 	atomic.AddInt64(&sp.TotalFiles, files)
+	if sp.job != nil {
+		sp.job.AddTotal(uint64(dirs), 0)
+	}
 }
 
 // MarkComplete marks the sync as complete
@@ -81,15 +88,23 @@ func (f *Filesystem) SyncDirectoryTree(auth *graph.Auth) error {
 }
 
 // SyncDirectoryTreeWithContext recursively traverses the filesystem from the root
-// with context support for cancellation
+// with context support for cancellation. The sync runs as a JobTreeSync job.
 func (f *Filesystem) SyncDirectoryTreeWithContext(ctx context.Context, auth *graph.Auth) error {
+	return f.runJob(ctx, JobTreeSync, "/", func(ctx context.Context, job *Job) error {
+		return f.syncDirectoryTree(ctx, auth, job)
+	})
+}
+
+func (f *Filesystem) syncDirectoryTree(ctx context.Context, auth *graph.Auth, job *Job) error {
 	logging.Info().Msg("Starting full directory tree synchronization...")
 
 	// Initialize sync progress
 	progress := &SyncProgress{
 		StartTime:      time.Now(),
 		LastUpdateTime: time.Now(),
+		job:            job,
 	}
+	job.AddTotal(1, 0) // the root
 
 	// Store progress in filesystem for external access
 	// Lock ordering: filesystem.RWMutex only (no other locks held)
@@ -100,10 +115,11 @@ func (f *Filesystem) SyncDirectoryTreeWithContext(ctx context.Context, auth *gra
 
 	// Create a map to track visited directories to prevent cycles
 	visited := make(map[string]bool)
-	// Set a reasonable maximum depth to prevent excessive recursion
-	const maxDepth = 20
+	// Directories beyond the configured depth or outside the include/exclude
+	// filters are left for lazy discovery
+	filter := f.syncTreeFilter()
 
-	err := f.syncDirectoryTreeRecursiveWithContext(ctx, f.root, auth, visited, 0, maxDepth, progress)
+	err := f.syncDirectoryTreeRecursiveWithContext(ctx, f.root, auth, visited, 0, filter.maxDepth, progress)
 
 	// Mark sync as complete
 	progress.MarkComplete()
@@ -141,7 +157,7 @@ func (f *Filesystem) syncDirectoryTreeRecursiveWithContext(ctx context.Context,
 
 	// Check if we've reached the maximum depth
 	if depth >= maxDepth {
-		logging.Warn().Str("dirID", dirID).Int("depth", depth).Int("maxDepth", maxDepth).Msg("Reached maximum recursion depth, stopping")
+		logging.Debug().Str("dirID", dirID).Int("depth", depth).Int("maxDepth", maxDepth).Msg("Reached maximum sync depth, leaving subtree for lazy discovery")
 		return nil
 	}
 
@@ -277,9 +293,14 @@ func (f *Filesystem) syncDirectoryTreeRecursiveWithContext(ctx context.Context,
 			Msg("Sync progress update")
 	}
 
-	// Recursively process all subdirectories
+	// Recursively process all subdirectories in scope
+	filter := f.syncTreeFilter()
 	for _, child := range children {
 		if child.ItemType == metadata.ItemKindDirectory {
+			if inode := f.GetID(child.ID); inode != nil && !filter.descend(inode.Path()) {
+				logging.Debug().Str("dirID", child.ID).Str("path", inode.Path()).Msg("Directory outside sync tree scope, leaving for lazy discovery")
+				continue
+			}
 			if err := f.syncDirectoryTreeRecursiveWithContext(ctx, child.ID, auth, visited, depth+1, maxDepth, progress); err != nil {
 				// Check if it's a cancellation error
 				if err == context.Canceled || err == context.DeadlineExceeded {
@@ -0,0 +1,162 @@
+package fs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// The sync digest summarizes background activity every notificationDigest
+// minutes ("Synced 214 files, 2 conflicts, 1 error in the last hour") instead
+// of notifying about every file. It is counted from the activity events (see
+// activity_feed.go), published as the SyncDigest D-Bus property and, when
+// desktopNotifications is enabled, shown as a desktop notification. Periods
+// without activity publish nothing.
+
+// SyncDigest counts the activity of one digest period.
+type SyncDigest struct {
+	Since     time.Time
+	Until     time.Time
+	Synced    int // files uploaded or downloaded
+	Conflicts int
+	Errors    int
+}
+
+// Empty reports whether nothing happened during the period.
+func (d SyncDigest) Empty() bool {
+	return d.Synced == 0 && d.Conflicts == 0 && d.Errors == 0
+}
+
+// Summary describes the digest in one sentence.
+func (d SyncDigest) Summary() string {
+	parts := []string{"Synced " + countNoun(d.Synced, "file", "files")}
+	if d.Conflicts > 0 {
+		parts = append(parts, countNoun(d.Conflicts, "conflict", "conflicts"))
+	}
+	if d.Errors > 0 {
+		parts = append(parts, countNoun(d.Errors, "error", "errors"))
+	}
+	return strings.Join(parts, ", ") + " in the last " + digestWindow(d.Until.Sub(d.Since))
+}
+
+// countNoun formats n with the singular or plural noun.
+func countNoun(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+// digestWindow describes the length of a digest period, rounded to minutes,
+// hours or days.
+func digestWindow(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return countWindow(int((d+12*time.Hour)/(24*time.Hour)), "day", "days")
+	case d >= time.Hour:
+		return countWindow(int((d+30*time.Minute)/time.Hour), "hour", "hours")
+	default:
+		return countWindow(int((d+30*time.Second)/time.Minute), "minute", "minutes")
+	}
+}
+
+// countWindow is countNoun without the count for a single unit.
+func countWindow(n int, singular, plural string) string {
+	if n <= 1 {
+		return singular
+	}
+	return countNoun(n, singular, plural)
+}
+
+// syncDigest counts activity since the last digest. The zero value is ready
+// to use.
+type syncDigest struct {
+	mu      sync.Mutex
+	current SyncDigest
+	last    SyncDigest
+}
+
+// record counts an activity event towards the current period.
+func (s *syncDigest) record(eventType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch eventType {
+	case ActivityUploaded, ActivityHydrated:
+		s.current.Synced++
+	case ActivityConflict:
+		s.current.Conflicts++
+	case ActivityError:
+		s.current.Errors++
+	}
+}
+
+// take ends the current period at now and starts the next one, returning the
+// counts of the ended period.
+func (s *syncDigest) take(now time.Time) SyncDigest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	digest := s.current
+	digest.Until = now
+	s.current = SyncDigest{Since: now}
+	if !digest.Empty() {
+		s.last = digest
+	}
+	return digest
+}
+
+// LastSyncDigest returns the most recent digest with activity, and false
+// before there was one.
+func (f *Filesystem) LastSyncDigest() (SyncDigest, bool) {
+	f.digest.mu.Lock()
+	defer f.digest.mu.Unlock()
+	return f.digest.last, !f.digest.last.Empty()
+}
+
+// StartSyncDigest publishes a digest of sync activity every interval, as a
+// desktop notification as well when desktop is set.
+func (f *Filesystem) StartSyncDigest(interval time.Duration, desktop bool) {
+	if interval <= 0 {
+		return
+	}
+	f.digest.take(time.Now())
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				f.publishSyncDigest(now, desktop)
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// publishSyncDigest ends the current digest period and publishes it unless
+// nothing happened.
+func (f *Filesystem) publishSyncDigest(now time.Time, desktop bool) {
+	digest := f.digest.take(now)
+	if digest.Empty() {
+		return
+	}
+	summary := digest.Summary()
+	logging.Info().
+		Int("synced", digest.Synced).
+		Int("conflicts", digest.Conflicts).
+		Int("errors", digest.Errors).
+		Msg(summary)
+	if f.dbusServer != nil {
+		f.dbusServer.SetSyncDigest(summary)
+		if desktop {
+			f.dbusServer.SendDesktopNotification("OneDrive sync summary", summary)
+		}
+	}
+}
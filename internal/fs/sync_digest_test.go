@@ -0,0 +1,46 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_SyncDigest_Summary(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	digest := SyncDigest{Since: start, Until: start.Add(time.Hour), Synced: 214, Conflicts: 2, Errors: 1}
+	require.Equal(t, "Synced 214 files, 2 conflicts, 1 error in the last hour", digest.Summary())
+
+	digest = SyncDigest{Since: start, Until: start.Add(15 * time.Minute), Synced: 1}
+	require.Equal(t, "Synced 1 file in the last 15 minutes", digest.Summary())
+
+	digest = SyncDigest{Since: start, Until: start.Add(48 * time.Hour), Errors: 3}
+	require.Equal(t, "Synced 0 files, 3 errors in the last 2 days", digest.Summary())
+}
+
+func TestUT_FS_SyncDigest_CountsActivityPerPeriod(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	start := time.Now()
+	fs.digest.take(start)
+
+	_, ok := fs.LastSyncDigest()
+	require.False(t, ok, "no digest before any activity")
+
+	fs.emitActivity(ActivityUploaded, "", "")
+	fs.emitActivity(ActivityHydrated, "", "")
+	fs.emitActivity(ActivityConflict, "", "both changed")
+	fs.emitActivity(ActivityThrottle, "", "delta")
+
+	digest := fs.digest.take(start.Add(time.Hour))
+	require.Equal(t, 2, digest.Synced)
+	require.Equal(t, 1, digest.Conflicts)
+	require.Zero(t, digest.Errors)
+	require.Equal(t, start, digest.Since)
+
+	require.True(t, fs.digest.take(start.Add(2*time.Hour)).Empty(), "counts restart each period")
+	last, ok := fs.LastSyncDigest()
+	require.True(t, ok)
+	require.Equal(t, digest, last, "quiet periods keep the last digest")
+}
@@ -3,9 +3,9 @@ package fs
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/auriora/onemount/internal/errors"
 	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/logging"
 	"github.com/auriora/onemount/internal/retry"
@@ -77,6 +77,7 @@ func (sm *SyncManager) ProcessOfflineChangesWithRetry(ctx context.Context) (*Syn
 	}
 
 	logger.Info().Int("changeCount", len(changes)).Msg("Retrieved offline changes")
+	changes = sm.fs.preflightOfflineDeletes(ctx, changes)
 
 	// Process each change with individual retry logic
 	for _, change := range changes {
@@ -89,7 +90,9 @@ func (sm *SyncManager) ProcessOfflineChangesWithRetry(ctx context.Context) (*Syn
 			// Continue processing
 		}
 
-		err := sm.processChangeWithRetry(ctx, change, result)
+		err := sm.fs.replayOfflineChange(ctx, change, func(ctx context.Context, change *OfflineChange) error {
+			return sm.processChangeWithRetry(ctx, change, result)
+		})
 		if err != nil {
 			logger.Error().Err(err).
 				Str("changeID", change.ID).
@@ -184,7 +187,7 @@ func (sm *SyncManager) detectConflictForChange(ctx context.Context, change *Offl
 // getRemoteItemWithRetry gets remote item state with retry logic
 func (sm *SyncManager) getRemoteItemWithRetry(ctx context.Context, itemID string) (*graph.DriveItem, error) {
 	return retry.DoWithResult(ctx, func() (*graph.DriveItem, error) {
-		return graph.GetItem(itemID, sm.fs.auth)
+		return graph.GetItemWithContext(ctx, itemID, sm.fs.auth)
 	}, sm.retryConfig)
 }
 
@@ -195,6 +198,10 @@ func (sm *SyncManager) processCreateOrModifyChange(ctx context.Context, change *
 		return fmt.Errorf("inode not found for change ID: %s", change.ID)
 	}
 
+	if sm.fs.holdUpload(inode) {
+		return nil
+	}
+
 	// Queue upload with retry logic built into the upload manager
 	if sm.fs.uploads != nil {
 		_, err := sm.fs.uploads.QueueUploadWithPriority(inode, PriorityLow)
@@ -214,7 +221,10 @@ func (sm *SyncManager) processDeleteChange(ctx context.Context, change *OfflineC
 	}
 
 	return retry.Do(ctx, func() error {
-		return graph.Remove(change.ID, sm.fs.auth)
+		if err := graph.RemoveWithContext(ctx, change.ID, sm.fs.auth); err != nil && !isNotFoundError(err) {
+			return err
+		}
+		return nil
 	}, sm.retryConfig)
 }
 
@@ -224,9 +234,7 @@ func (sm *SyncManager) processRenameChange(ctx context.Context, change *OfflineC
 		return fmt.Errorf("rename change missing new path")
 	}
 
-	// For now, treat rename as a modify operation
-	// More sophisticated rename handling could be implemented later
-	return sm.processCreateOrModifyChange(ctx, change)
+	return sm.fs.replayOfflineRename(ctx, change)
 }
 
 // RecoverFromNetworkInterruption handles recovery after network interruptions
@@ -292,9 +300,5 @@ func (sm *SyncManager) GetSyncStatus(ctx context.Context) (map[string]interface{
 
 // isNotFoundError checks if an error indicates that a resource was not found
 func isNotFoundError(err error) bool {
-	if err == nil {
-		return false
-	}
-	errorStr := strings.ToLower(err.Error())
-	return strings.Contains(errorStr, "not found") || strings.Contains(errorStr, "404")
+	return errors.Is(err, errors.ErrNotFound)
 }
@@ -0,0 +1,202 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Syncing a file now skips the upload and download queues. A file with local
+// changes is uploaded ahead of all queued uploads, without waiting for a free
+// upload slot or for an unmetered connection. Any other file is compared with
+// OneDrive and downloaded straight into the cache when its cached copy is
+// missing or out of date. Either way SyncNow returns once OneDrive has
+// confirmed the upload or the download finished. Syncing runs through
+// "onemount sync <path>" or the D-Bus SyncNow method.
+
+// FileSyncResult says what syncing a file did.
+type FileSyncResult string
+
+const (
+	// SyncUploaded means the local changes were uploaded.
+	SyncUploaded FileSyncResult = "uploaded"
+	// SyncDownloaded means the content on OneDrive was downloaded.
+	SyncDownloaded FileSyncResult = "downloaded"
+	// SyncUpToDate means the cached copy already matched OneDrive.
+	SyncUpToDate FileSyncResult = "up-to-date"
+)
+
+// ErrSyncFrozen is returned when syncing a frozen file.
+var ErrSyncFrozen = errors.New("the file is frozen, unfreeze it to sync it")
+
+// SyncNow uploads or downloads the file at path right away, ahead of all
+// queued transfers.
+func (f *Filesystem) SyncNow(ctx context.Context, path string) (FileSyncResult, error) {
+	id := f.GetIDByPath(path)
+	if id == "" {
+		return "", errors.NewNotFoundError("path not found: "+path, nil)
+	}
+	return f.syncNowWith(ctx, id, graphItemRemote{ctx: ctx, auth: f.auth})
+}
+
+func (f *Filesystem) syncNowWith(ctx context.Context, id string, remote itemRemote) (FileSyncResult, error) {
+	inode := f.GetID(id)
+	if inode == nil {
+		return "", errors.NewNotFoundError("item not found", nil)
+	}
+	path := inode.Path()
+	switch {
+	case inode.IsDir(), inode.IsVirtual():
+		return "", errors.NewValidationError("not a file: "+path, nil)
+	case f.IsOffline():
+		return "", errors.NewNetworkError("cannot sync files while offline", nil)
+	case f.IsFrozen(id):
+		return "", ErrSyncFrozen
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if isLocalID(id) || inode.HasChanges() {
+		return f.uploadNow(inode)
+	}
+	return f.downloadNow(ctx, inode, remote)
+}
+
+// uploadNow uploads the changes to inode and waits for OneDrive to confirm
+// them.
+func (f *Filesystem) uploadNow(inode *Inode) (FileSyncResult, error) {
+	id := inode.ID()
+	// The size checked and the content uploaded include buffered writes
+	inode.mu.Lock()
+	status := f.flushWritesLocked(inode.nodeID)
+	inode.mu.Unlock()
+	if status != fuse.OK {
+		return "", errors.New("failed to write buffered data to the cache")
+	}
+	if f.holdOversizedUpload(inode) {
+		return "", errors.NewValidationError("the file exceeds OneDrive's 250 GB size limit", nil)
+	}
+	// Asked for explicitly, so not held back by a metered connection
+	f.meteredUploads.mu.Lock()
+	_, deferred := f.meteredUploads.deferred[id]
+	delete(f.meteredUploads.deferred, id)
+	f.meteredUploads.mu.Unlock()
+	if deferred {
+		f.setUploadDeferral(id, "")
+	}
+
+	if _, err := f.uploads.UploadNow(inode); err != nil {
+		return "", errors.Wrap(err, "failed to start the upload")
+	}
+	if err := f.uploads.WaitForUpload(id); err != nil {
+		return "", errors.Wrap(err, "the upload failed")
+	}
+	logging.Info().Str("id", id).Str("path", inode.Path()).Msg("File uploaded on request")
+	return SyncUploaded, nil
+}
+
+// downloadNow downloads the file's content from OneDrive into the cache
+// unless the cached copy already matches it.
+func (f *Filesystem) downloadNow(ctx context.Context, inode *Inode, remote itemRemote) (FileSyncResult, error) {
+	id := inode.ID()
+	if f.downloads != nil {
+		if state, err := f.downloads.GetDownloadStatus(id); err == nil && state == downloadStarted {
+			// Already on its way into the cache; compared with OneDrive below
+			if err := f.downloads.WaitForDownload(id); err != nil {
+				return "", errors.Wrap(err, "the download failed")
+			}
+		}
+	}
+
+	item, err := remote.GetItem(id)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch the file from OneDrive")
+	}
+	inode.mu.RLock()
+	local := inode.DriveItem
+	inode.mu.RUnlock()
+	if f.content.HasContent(id) && sameRemoteVersion(&local, item) {
+		return SyncUpToDate, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.content.directory), ".sync-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := remote.Download(id, tmp); err != nil {
+		return "", errors.Wrap(err, "failed to download the file")
+	}
+	hash := graph.QuickXORHashStream(tmp)
+	if item.File != nil && item.File.Hashes.QuickXorHash != "" && hash != item.File.Hashes.QuickXorHash {
+		return "", errors.Wrap(ErrChecksumMismatch, "the download from OneDrive is damaged")
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	// Writes hold the inode lock, so none gets in between the last check and
+	// the swap
+	inode.mu.Lock()
+	if inode.hasChanges {
+		inode.mu.Unlock()
+		// Written to while downloading; the local changes win
+		return "", ErrVerifyLocalChanges
+	}
+	if err := f.content.Delete(id); err != nil {
+		inode.mu.Unlock()
+		return "", err
+	}
+	size, err := f.content.InsertStream(id, tmp)
+	if err != nil {
+		_ = f.content.Delete(id)
+		inode.mu.Unlock()
+		f.markContentEvicted(id)
+		return "", errors.Wrap(err, "failed to store the download in the cache")
+	}
+	inode.DriveItem = *item
+	inode.DriveItem.Size = uint64(size)
+	if inode.DriveItem.File == nil {
+		inode.DriveItem.File = &graph.File{}
+	}
+	inode.DriveItem.File.Hashes.QuickXorHash = hash
+	inode.resetWriteHashLocked()
+	inode.mu.Unlock()
+	f.persistMetadataEntry(id, inode)
+	f.indexContent(id, hash, uint64(size))
+	f.markHydratedState(id)
+	f.transitionToState(id, metadata.ItemStateHydrated,
+		metadata.WithHydrationEvent(),
+		metadata.WithWorker("sync:"+id),
+		metadata.WithContentHash(hash),
+		metadata.WithSize(uint64(size)),
+		metadata.ClearPendingRemote())
+	f.SetFileStatus(id, FileStatusInfo{Status: StatusLocal, Timestamp: time.Now()})
+	f.emitActivity(ActivityHydrated, id, "")
+	logging.Info().Str("id", id).Str("path", inode.Path()).Msg("File downloaded on request")
+	return SyncDownloaded, nil
+}
+
+// sameRemoteVersion reports whether local describes the same content as the
+// current remote item, by QuickXorHash when OneDrive reports one and by eTag
+// otherwise.
+func sameRemoteVersion(local, remote *graph.DriveItem) bool {
+	if remote.File != nil && remote.File.Hashes.QuickXorHash != "" {
+		return local.File != nil && local.File.Hashes.QuickXorHash == remote.File.Hashes.QuickXorHash
+	}
+	return local.ETag != "" && local.ETag == remote.ETag
+}
@@ -0,0 +1,82 @@
+package fs
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_SyncNow_DownloadsStaleCopyOnce(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+	remote := remoteContent("quarterly NUMBERS")
+
+	result, err := fs.syncNowWith(context.Background(), file.ID(), remote)
+	require.NoError(t, err)
+	require.Equal(t, SyncDownloaded, result)
+	require.Equal(t, "quarterly NUMBERS", string(fs.content.Get(file.ID())))
+	require.Equal(t, remote.item.File.Hashes.QuickXorHash, file.DriveItem.File.Hashes.QuickXorHash)
+	require.Equal(t, StatusLocal, fs.GetFileStatus(file.ID()).Status)
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(fs.content.directory), ".sync-*"))
+	require.Empty(t, leftovers, "the download is removed")
+
+	result, err = fs.syncNowWith(context.Background(), file.ID(), remote)
+	require.NoError(t, err)
+	require.Equal(t, SyncUpToDate, result)
+}
+
+func TestUT_FS_SyncNow_DownloadsMissingContent(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+	remote := remoteContent("quarterly numbers")
+	file.DriveItem.File.Hashes.QuickXorHash = remote.item.File.Hashes.QuickXorHash
+	require.NoError(t, fs.content.Delete(file.ID()))
+
+	result, err := fs.syncNowWith(context.Background(), file.ID(), remote)
+	require.NoError(t, err)
+	require.Equal(t, SyncDownloaded, result)
+	require.Equal(t, "quarterly numbers", string(fs.content.Get(file.ID())))
+}
+
+func TestUT_FS_SyncNow_RefusesWhatCannotBeSynced(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+
+	corrupt := remoteContent("quarterly NUMBERS")
+	corrupt.content = "truncated"
+	_, err := fs.syncNowWith(context.Background(), file.ID(), corrupt)
+	require.Error(t, err)
+	require.Equal(t, "quarterly numbers", string(fs.content.Get(file.ID())), "a bad download changes nothing")
+
+	_, err = fs.syncNowWith(context.Background(), "parent", remoteContent("other"))
+	require.Error(t, err)
+
+	require.NoError(t, fs.setFrozen(file, true))
+	_, err = fs.syncNowWith(context.Background(), file.ID(), remoteContent("other"))
+	require.ErrorIs(t, err, ErrSyncFrozen)
+	require.Equal(t, "quarterly numbers", string(fs.content.Get(file.ID())))
+}
+
+func TestUT_FS_SyncNow_UrgentUploadSkipsInFlightLimit(t *testing.T) {
+	u := &UploadManager{inFlight: maxUploadsInFlight}
+	require.False(t, u.tryIncrementInFlight())
+	require.False(t, u.takeUrgent("report"), "only uploads asked for with UploadNow skip the limit")
+
+	u.urgent = map[string]bool{"report": true}
+	u.pendingHighPriorityUploads = map[string]bool{"report": true}
+	require.True(t, u.urgentQueued())
+	delete(u.pendingHighPriorityUploads, "report")
+	require.False(t, u.urgentQueued())
+
+	require.True(t, u.takeUrgent("report"))
+	require.Equal(t, uint8(maxUploadsInFlight+1), u.inFlight)
+	require.False(t, u.takeUrgent("report"), "an urgent upload starts once")
+}
+
+func TestUT_FS_SyncNow_KeepsWritesMadeWhileDownloading(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+	remote := writtenWhileDownloading{fakeRemote: remoteContent("quarterly NUMBERS"), fs: fs, file: file}
+
+	_, err := fs.syncNowWith(context.Background(), file.ID(), remote)
+	require.ErrorIs(t, err, ErrVerifyLocalChanges)
+	require.Equal(t, "Quarterly numbers", string(fs.content.Get(file.ID())), "the write is not replaced")
+}
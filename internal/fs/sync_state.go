@@ -0,0 +1,114 @@
+package fs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyncState is a cheap snapshot of what the mount is doing, reported to the
+// service manager as the STATUS line of "systemctl status". Unlike GetStats
+// it does not read the metadata database, so it can be taken every few
+// seconds.
+type SyncState struct {
+	Offline          bool
+	Suspended        bool
+	Archive          bool
+	Uploading        int // uploads in progress
+	UploadsWaiting   int // uploads queued or waiting for a free slot
+	UploadsFailed    int // uploads that failed and wait for a retry or the user
+	Downloading      int // downloads in progress
+	DownloadsWaiting int // downloads queued
+}
+
+// SyncState returns what the mount is doing right now.
+func (f *Filesystem) SyncState() SyncState {
+	state := SyncState{
+		Offline:   f.IsOffline(),
+		Suspended: f.Suspended(),
+		Archive:   f.ArchiveMode(),
+	}
+	if f.uploads != nil {
+		state.Uploading, state.UploadsWaiting, state.UploadsFailed = f.uploads.uploadCounts()
+	}
+	if f.downloads != nil {
+		downloads := f.downloads.Snapshot()
+		state.Downloading = downloads.Active
+		state.DownloadsWaiting = downloads.QueueDepth
+	}
+	return state
+}
+
+// String describes the state in one line, e.g. "Online: uploading 2 files,
+// 3 waiting".
+func (s SyncState) String() string {
+	mode := "Online"
+	switch {
+	case s.Archive:
+		mode = "Archive (read-only)"
+	case s.Suspended:
+		mode = "Suspended"
+	case s.Offline:
+		mode = "Offline"
+	}
+
+	var parts []string
+	if s.Uploading > 0 {
+		parts = append(parts, "uploading "+countNoun(s.Uploading, "file", "files"))
+	}
+	if s.UploadsWaiting > 0 {
+		parts = append(parts, fmt.Sprintf("%d waiting to upload", s.UploadsWaiting))
+	}
+	if s.Downloading > 0 {
+		parts = append(parts, "downloading "+countNoun(s.Downloading, "file", "files"))
+	}
+	if s.DownloadsWaiting > 0 {
+		parts = append(parts, fmt.Sprintf("%d waiting to download", s.DownloadsWaiting))
+	}
+	if s.UploadsFailed > 0 {
+		parts = append(parts, countNoun(s.UploadsFailed, "upload failed", "uploads failed"))
+	}
+	if len(parts) == 0 {
+		switch {
+		case s.Archive:
+			return mode
+		case s.Offline, s.Suspended:
+			return mode + ", changes are kept until reconnected"
+		}
+		return mode + ", up to date"
+	}
+	return mode + ": " + strings.Join(parts, ", ")
+}
+
+// uploadCounts returns the number of uploads in progress, waiting to start
+// and failed.
+func (u *UploadManager) uploadCounts() (active, waiting, failed int) {
+	waiting = len(u.highPriorityQueue) + len(u.lowPriorityQueue)
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	for _, session := range u.sessions {
+		switch session.getState() {
+		case uploadNotStarted:
+			waiting++
+		case uploadStarted, uploadVerifying:
+			active++
+		case uploadErrored:
+			failed++
+		}
+	}
+	return active, waiting, failed
+}
+
+// DeltaBootstrapped is closed once the first delta cycle has finished,
+// whether it reached OneDrive or left the mount offline.
+func (f *Filesystem) DeltaBootstrapped() <-chan struct{} {
+	return f.deltaBootstrap
+}
+
+// markDeltaBootstrapped closes the DeltaBootstrapped channel.
+func (f *Filesystem) markDeltaBootstrapped() {
+	f.deltaBootstrapOnce.Do(func() {
+		if f.deltaBootstrap != nil {
+			close(f.deltaBootstrap)
+		}
+	})
+}
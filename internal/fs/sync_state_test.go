@@ -0,0 +1,43 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_SyncState_DescribesMount(t *testing.T) {
+	require.Equal(t, "Online, up to date", SyncState{}.String())
+	require.Equal(t, "Offline, changes are kept until reconnected", SyncState{Offline: true}.String())
+	require.Equal(t, "Archive (read-only)", SyncState{Archive: true, Offline: true}.String())
+	require.Equal(t, "Online: uploading 1 file, 3 waiting to upload, downloading 2 files, 1 upload failed",
+		SyncState{Uploading: 1, UploadsWaiting: 3, Downloading: 2, UploadsFailed: 1}.String())
+	require.Equal(t, "Offline: 2 waiting to upload", SyncState{Offline: true, UploadsWaiting: 2}.String())
+}
+
+func TestUT_FS_SyncState_CountsTransfers(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	started := &UploadSession{ID: "started"}
+	started.setState(uploadStarted, nil)
+	failed := &UploadSession{ID: "failed"}
+	failed.setState(uploadErrored, nil)
+	fs.uploads = &UploadManager{sessions: map[string]*UploadSession{
+		"started": started,
+		"waiting": {ID: "waiting"},
+		"failed":  failed,
+	}}
+
+	state := fs.SyncState()
+	require.Equal(t, 1, state.Uploading)
+	require.Equal(t, 1, state.UploadsWaiting)
+	require.Equal(t, 1, state.UploadsFailed)
+
+	fs.deltaBootstrap = make(chan struct{})
+	fs.markDeltaBootstrapped()
+	fs.markDeltaBootstrapped()
+	select {
+	case <-fs.DeltaBootstrapped():
+	default:
+		t.Fatal("the first delta cycle was not reported")
+	}
+}
@@ -0,0 +1,239 @@
+package fs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/metadata"
+)
+
+// defaultSyncTreeMaxDepth bounds the background tree sync when no depth limit
+// is configured.
+const defaultSyncTreeMaxDepth = 20
+
+// SyncTreeScope limits which directories the background tree sync enumerates.
+// Directories outside the scope are still listed in their parent, but their
+// children are only fetched when the directory is first opened.
+type SyncTreeScope struct {
+	// MaxDepth is the number of directory levels below the root to enumerate;
+	// zero or less uses the default.
+	MaxDepth int
+	// Include holds mount-relative path globs (e.g. "Documents/**"). When set,
+	// only matching directories, their subtrees and the directories leading
+	// to them are enumerated.
+	Include []string
+	// Exclude holds path globs whose directories (and subtrees) are skipped.
+	// Exclusions win over inclusions.
+	Exclude []string
+}
+
+// syncTreeFilter is the compiled form of a SyncTreeScope.
+type syncTreeFilter struct {
+	maxDepth int
+	include  [][]string
+	exclude  [][]string
+}
+
+func compileSyncTreeScope(scope SyncTreeScope) (syncTreeFilter, error) {
+	filter := syncTreeFilter{maxDepth: scope.MaxDepth}
+	if filter.maxDepth <= 0 {
+		filter.maxDepth = defaultSyncTreeMaxDepth
+	}
+	for _, pattern := range scope.Include {
+		segments, err := compilePathGlob(pattern)
+		if err != nil {
+			return syncTreeFilter{}, fmt.Errorf("invalid sync tree include pattern %q: %w", pattern, err)
+		}
+		filter.include = append(filter.include, segments)
+	}
+	for _, pattern := range scope.Exclude {
+		segments, err := compilePathGlob(pattern)
+		if err != nil {
+			return syncTreeFilter{}, fmt.Errorf("invalid sync tree exclude pattern %q: %w", pattern, err)
+		}
+		filter.exclude = append(filter.exclude, segments)
+	}
+	return filter, nil
+}
+
+// descend reports whether the tree sync should enumerate the directory at the
+// given mount-relative path. The root is always enumerated.
+func (s syncTreeFilter) descend(dirPath string) bool {
+	trimmed := strings.Trim(dirPath, "/")
+	if trimmed == "" {
+		return true
+	}
+	name := strings.Split(strings.ToLower(trimmed), "/")
+	for _, pattern := range s.exclude {
+		if matchPathOrAncestor(pattern, name) {
+			return false
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+	for _, pattern := range s.include {
+		if matchPathOrAncestor(pattern, name) || matchPathPrefix(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathOrAncestor reports whether the path or one of its ancestors matches
+// the pattern, i.e. whether the path lies in a matching subtree.
+func matchPathOrAncestor(pattern, name []string) bool {
+	for i := 1; i <= len(name); i++ {
+		if matchPathSegments(pattern, name[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPrefix reports whether some descendant of the path could match the
+// pattern, so the path has to be walked to reach it.
+func matchPathPrefix(pattern, name []string) bool {
+	for _, seg := range name {
+		if len(pattern) == 0 {
+			return false
+		}
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], seg); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+	}
+	return true
+}
+
+// ConfigureSyncTree sets the depth limit and path filters used by the
+// background tree sync. Invalid patterns are rejected and leave the previous
+// configuration in place. Ignore rules imported into the mount (see
+// SetIgnoreRules) are added to the exclusions.
+func (f *Filesystem) ConfigureSyncTree(scope SyncTreeScope) error {
+	f.syncTreeM.Lock()
+	defer f.syncTreeM.Unlock()
+	if !f.ignoreLoaded {
+		f.ignoreRules = f.loadIgnoreRules()
+		f.ignoreLoaded = true
+	}
+	return f.applySyncTreeLocked(scope, f.ignoreRules)
+}
+
+// applySyncTreeLocked compiles scope plus the ignore rules and installs the
+// result. Callers hold syncTreeM.
+func (f *Filesystem) applySyncTreeLocked(scope SyncTreeScope, ignore []string) error {
+	effective := scope
+	effective.Exclude = mergeIgnoreRules(scope.Exclude, ignore)
+	filter, err := compileSyncTreeScope(effective)
+	if err != nil {
+		return err
+	}
+	f.syncTreeScope = scope
+	f.ignoreRules = ignore
+	f.syncTree = filter
+	return nil
+}
+
+// IgnoreRules returns the path globs the tree sync skips: the configured
+// exclusions followed by the imported ignore rules.
+func (f *Filesystem) IgnoreRules() []string {
+	f.syncTreeM.RLock()
+	defer f.syncTreeM.RUnlock()
+	return mergeIgnoreRules(f.syncTreeScope.Exclude, f.ignoreRules)
+}
+
+// SetIgnoreRules replaces the ignore rules imported into the mount and stores
+// them with the root's metadata entry, so they survive a remount. Rules
+// already present in the configured exclusions are not stored twice.
+func (f *Filesystem) SetIgnoreRules(rules []string) error {
+	f.syncTreeM.Lock()
+	defer f.syncTreeM.Unlock()
+	configured := make(map[string]bool, len(f.syncTreeScope.Exclude))
+	for _, pattern := range f.syncTreeScope.Exclude {
+		configured[pattern] = true
+	}
+	var imported []string
+	for _, pattern := range mergeIgnoreRules(nil, rules) {
+		if !configured[pattern] {
+			imported = append(imported, pattern)
+		}
+	}
+	if err := f.applySyncTreeLocked(f.syncTreeScope, imported); err != nil {
+		return err
+	}
+	f.ignoreLoaded = true
+	return f.storeIgnoreRules(imported)
+}
+
+// mergeIgnoreRules appends the non-empty patterns of extra to base, skipping
+// duplicates.
+func mergeIgnoreRules(base, extra []string) []string {
+	var merged []string
+	seen := make(map[string]bool, len(base)+len(extra))
+	for _, list := range [][]string{base, extra} {
+		for _, pattern := range list {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" || seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			merged = append(merged, pattern)
+		}
+	}
+	return merged
+}
+
+// loadIgnoreRules reads the ignore rules stored with the root's entry.
+func (f *Filesystem) loadIgnoreRules() []string {
+	if f.metadataStore == nil || f.root == "" {
+		return nil
+	}
+	entry, err := f.GetMetadataEntry(f.root)
+	if err != nil || entry == nil {
+		return nil
+	}
+	return parseIgnoreValue(entry.Xattrs[xattrIgnore])
+}
+
+// storeIgnoreRules records the imported ignore rules with the root's entry.
+func (f *Filesystem) storeIgnoreRules(rules []string) error {
+	if f.metadataStore == nil || f.root == "" {
+		return nil
+	}
+	_, err := f.UpdateMetadataEntry(f.root, func(entry *metadata.Entry) error {
+		if len(rules) == 0 {
+			delete(entry.Xattrs, xattrIgnore)
+			return nil
+		}
+		if entry.Xattrs == nil {
+			entry.Xattrs = make(map[string][]byte)
+		}
+		entry.Xattrs[xattrIgnore] = []byte(strings.Join(rules, "\n"))
+		return nil
+	})
+	if err != nil && !errors.Is(err, metadata.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// parseIgnoreValue splits an xattrIgnore value into one pattern per line.
+func parseIgnoreValue(value []byte) []string {
+	return mergeIgnoreRules(nil, strings.Split(strings.TrimRight(string(value), "\x00"), "\n"))
+}
+
+func (f *Filesystem) syncTreeFilter() syncTreeFilter {
+	f.syncTreeM.RLock()
+	defer f.syncTreeM.RUnlock()
+	filter := f.syncTree
+	if filter.maxDepth <= 0 {
+		filter.maxDepth = defaultSyncTreeMaxDepth
+	}
+	return filter
+}
@@ -0,0 +1,38 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_SyncTreeScope_IncludeExcludeFilters(t *testing.T) {
+	filter, err := compileSyncTreeScope(SyncTreeScope{
+		Include: []string{"Documents/Projects/**", "Photos/2024"},
+		Exclude: []string{"**/Archive"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, defaultSyncTreeMaxDepth, filter.maxDepth)
+
+	require.True(t, filter.descend("/"), "root is always enumerated")
+	require.True(t, filter.descend("/Documents"), "ancestors of included paths are walked")
+	require.True(t, filter.descend("/documents/projects/site/src"))
+	require.True(t, filter.descend("/Photos/2024/Trip"), "subtrees of included directories are walked")
+	require.False(t, filter.descend("/Photos/2023"))
+	require.False(t, filter.descend("/Music"))
+	require.False(t, filter.descend("/Documents/Projects/Archive"), "exclusions win over inclusions")
+	require.False(t, filter.descend("/Documents/Projects/Archive/2019"))
+}
+
+func TestUT_FS_SyncTreeScope_Configure(t *testing.T) {
+	fs := &Filesystem{}
+	require.Equal(t, defaultSyncTreeMaxDepth, fs.syncTreeFilter().maxDepth)
+	require.True(t, fs.syncTreeFilter().descend("/Anything/Deep"), "an empty scope enumerates everything")
+
+	require.NoError(t, fs.ConfigureSyncTree(SyncTreeScope{MaxDepth: 2, Exclude: []string{"Backups"}}))
+	require.Equal(t, 2, fs.syncTreeFilter().maxDepth)
+	require.False(t, fs.syncTreeFilter().descend("/backups/old"))
+
+	require.Error(t, fs.ConfigureSyncTree(SyncTreeScope{Include: []string{"Bad/["}}))
+	require.Equal(t, 2, fs.syncTreeFilter().maxDepth, "invalid scopes keep the previous configuration")
+}
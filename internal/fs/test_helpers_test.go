@@ -1,10 +1,65 @@
 package fs
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
 	"github.com/auriora/onemount/internal/graph"
 	"github.com/auriora/onemount/internal/testutil/helpers"
 )
 
+// graphAPIError returns the error Graph requests fail with for a response
+// with the given status and error code.
+func graphAPIError(status int, code string) error {
+	body := fmt.Sprintf(`{"error":{"code":%q,"message":"request failed"}}`, code)
+	return graph.ResponseError(status, []byte(body), "")
+}
+
+// fakeRemote is an itemRemote serving one remote version of an item. A nil
+// item reads as deleted on OneDrive; err makes downloads fail.
+type fakeRemote struct {
+	item        *graph.DriveItem
+	content     string
+	downloadURL string
+	err         error
+}
+
+func (r *fakeRemote) GetItem(id string) (*graph.DriveItem, error) {
+	if r.item == nil {
+		return nil, graphAPIError(404, "itemNotFound")
+	}
+	return r.item, nil
+}
+
+func (r *fakeRemote) Download(id string, w io.Writer) error {
+	if r.err != nil {
+		return r.err
+	}
+	_, err := io.WriteString(w, r.content)
+	return err
+}
+
+func (r *fakeRemote) DownloadURL(_ context.Context, id string) (string, error) {
+	if r.item == nil {
+		return "", graphAPIError(404, "itemNotFound")
+	}
+	return r.downloadURL, r.err
+}
+
+// childNamed returns the first child of the parent whose name starts with
+// prefix.
+func childNamed(fs *Filesystem, parentID, prefix string) *Inode {
+	parent := fs.GetID(parentID)
+	for _, id := range parent.GetChildren() {
+		if child := fs.GetID(id); child != nil && strings.HasPrefix(child.Name(), prefix) {
+			return child
+		}
+	}
+	return nil
+}
+
 // registerDriveItem seeds the filesystem cache with a mock DriveItem so tests
 // can observe it without performing Graph calls.
 func registerDriveItem(fs *Filesystem, parentID string, item *graph.DriveItem) *Inode {
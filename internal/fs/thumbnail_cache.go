@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -43,14 +45,23 @@ func (t *ThumbnailCache) thumbnailPath(id string, size string) string {
 
 // Get reads a thumbnail from disk.
 func (t *ThumbnailCache) Get(id string, size string) []byte {
-	content, err := os.ReadFile(t.thumbnailPath(id, size))
+	path := t.thumbnailPath(id, size)
+	content, err := os.ReadFile(path)
 	if err != nil {
 		// Return empty content if file doesn't exist or can't be read
 		return []byte{}
 	}
+	touchThumbnail(path)
 	return content
 }
 
+// touchThumbnail marks a thumbnail as used now. Collect removes the
+// thumbnails used least recently first.
+func touchThumbnail(path string) {
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+}
+
 // Insert writes thumbnail content to disk.
 func (t *ThumbnailCache) Insert(id string, size string, content []byte) error {
 	return os.WriteFile(t.thumbnailPath(id, size), content, 0600)
@@ -128,6 +139,7 @@ func (t *ThumbnailCache) Open(id string, size string) (*os.File, error) {
 	if err != nil {
 		return nil, err
 	}
+	touchThumbnail(path)
 
 	// Store the file descriptor
 	t.fds.Store(id+"-"+size, fd)
@@ -193,3 +205,116 @@ func (t *ThumbnailCache) CleanupCache(expirationDays int) (int, error) {
 
 	return count, err
 }
+
+// ThumbnailCacheStats describes the contents of the thumbnail cache.
+type ThumbnailCacheStats struct {
+	Files int
+	Bytes int64
+}
+
+// thumbnailFile is a file in the thumbnail cache.
+type thumbnailFile struct {
+	name    string
+	size    int64
+	lastUse time.Time
+}
+
+// files lists the thumbnails on disk.
+func (t *ThumbnailCache) files() ([]thumbnailFile, error) {
+	entries, err := os.ReadDir(t.directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	files := make([]thumbnailFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed meanwhile
+		}
+		files = append(files, thumbnailFile{name: entry.Name(), size: info.Size(), lastUse: info.ModTime()})
+	}
+	return files, nil
+}
+
+// Stats returns the number and total size of the cached thumbnails.
+func (t *ThumbnailCache) Stats() (ThumbnailCacheStats, error) {
+	var stats ThumbnailCacheStats
+	files, err := t.files()
+	for _, file := range files {
+		stats.Files++
+		stats.Bytes += file.size
+	}
+	return stats, err
+}
+
+// Collect removes the thumbnails not used for maxAge, then the least
+// recently used ones until they take at most maxBytes. A maxAge or maxBytes
+// of 0 disables that limit. Thumbnails open for reading are kept. It returns
+// the number of thumbnails removed.
+func (t *ThumbnailCache) Collect(maxAge time.Duration, maxBytes int64) (int, error) {
+	files, err := t.files()
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].lastUse.Before(files[j].lastUse) })
+
+	var total int64
+	for _, file := range files {
+		total += file.size
+	}
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, file := range files {
+		expired := maxAge > 0 && file.lastUse.Before(cutoff)
+		oversize := maxBytes > 0 && total > maxBytes
+		if !expired && !oversize {
+			break // sorted by last use, the rest are newer
+		}
+		if _, open := t.fds.Load(file.name); open {
+			continue
+		}
+		if err := os.Remove(filepath.Join(t.directory, file.name)); err != nil && !os.IsNotExist(err) {
+			logging.Warn().Err(err).Str("file", file.name).Msg("Failed to remove thumbnail during cleanup")
+			continue
+		}
+		total -= file.size
+		removed++
+	}
+	return removed, nil
+}
+
+// thumbnailKey returns whether key is a size key of the cache: a thumbnail
+// size or a preview (see previewCacheKey).
+func thumbnailKey(key string) bool {
+	switch key {
+	case "small", "medium", "large":
+		return true
+	}
+	return strings.HasPrefix(key, "preview-") && !strings.Contains(strings.TrimPrefix(key, "preview-"), "-")
+}
+
+// Invalidate removes every cached thumbnail and preview of the item with the
+// given ID, after its content changed.
+func (t *ThumbnailCache) Invalidate(id string) error {
+	files, err := t.files()
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, file := range files {
+		size, ok := strings.CutPrefix(file.name, id+"-")
+		if !ok || !thumbnailKey(size) {
+			continue
+		}
+		if err := t.Delete(id, size); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,98 @@
+package fs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+// insertAgedThumbnail caches a thumbnail last used age ago.
+func insertAgedThumbnail(t *testing.T, cache *ThumbnailCache, id, size string, bytes int, age time.Duration) {
+	t.Helper()
+	require.NoError(t, cache.Insert(id, size, make([]byte, bytes)))
+	used := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(cache.thumbnailPath(id, size), used, used))
+}
+
+func TestUT_FS_ThumbnailCache_CollectsByAgeThenSize(t *testing.T) {
+	cache := NewThumbnailCache(t.TempDir())
+	insertAgedThumbnail(t, cache, "stale", "small", 100, 10*24*time.Hour)
+	insertAgedThumbnail(t, cache, "old", "large", 300, 3*time.Hour)
+	insertAgedThumbnail(t, cache, "open", "medium", 200, 2*time.Hour)
+	insertAgedThumbnail(t, cache, "recent", "small", 100, time.Minute)
+	_, err := cache.Open("open", "medium")
+	require.NoError(t, err)
+	defer cache.Close("open", "medium")
+
+	removed, err := cache.Collect(7*24*time.Hour, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.False(t, cache.HasThumbnail("stale", "small"))
+
+	// Opening it marked "open" as used now, and it is kept anyway while open
+	removed, err = cache.Collect(7*24*time.Hour, 350)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed, "the least recently used go first")
+	require.False(t, cache.HasThumbnail("old", "large"))
+	require.True(t, cache.HasThumbnail("recent", "small"))
+	require.True(t, cache.HasThumbnail("open", "medium"))
+
+	stats, err := cache.Stats()
+	require.NoError(t, err)
+	require.Equal(t, ThumbnailCacheStats{Files: 2, Bytes: 300}, stats)
+}
+
+func TestUT_FS_ThumbnailCache_ReadMarksUsed(t *testing.T) {
+	cache := NewThumbnailCache(t.TempDir())
+	insertAgedThumbnail(t, cache, "a", "small", 100, 2*time.Hour)
+	insertAgedThumbnail(t, cache, "b", "small", 100, time.Hour)
+
+	require.Len(t, cache.Get("a", "small"), 100)
+	removed, err := cache.Collect(0, 100)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.True(t, cache.HasThumbnail("a", "small"))
+	require.False(t, cache.HasThumbnail("b", "small"))
+}
+
+func TestUT_FS_ThumbnailCache_InvalidatedWhenCTagChanges(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	fs.thumbnails = NewThumbnailCache(t.TempDir())
+	parent := NewInodeDriveItem(&graph.DriveItem{ID: "parent", Name: "Photos", Folder: &graph.Folder{}})
+	registerHydratedEntry(t, fs, parent)
+	photo := NewInodeDriveItem(&graph.DriveItem{
+		ID: "photo", Name: "beach.jpg", ETag: "e1", CTag: "c1", Size: 6,
+		Parent: &graph.DriveItemParent{ID: "parent"}, File: &graph.File{},
+	})
+	registerHydratedEntry(t, fs, photo)
+	fs.InsertChild(parent.ID(), photo)
+
+	previewKey := previewCacheKey("e1")
+	for _, key := range []string{"small", "large", previewKey} {
+		require.NoError(t, fs.thumbnails.Insert("photo", key, []byte("png")))
+	}
+	require.NoError(t, fs.thumbnails.Insert("photo2", "small", []byte("png")))
+
+	delta := func(etag, ctag string) *graph.DriveItem {
+		return &graph.DriveItem{
+			ID: "photo", Name: "beach.jpg", ETag: etag, CTag: ctag, Size: 6,
+			Parent: &graph.DriveItemParent{ID: "parent"}, File: &graph.File{},
+		}
+	}
+	require.NoError(t, fs.applyDelta(delta("e2", "c1")))
+	require.True(t, fs.thumbnails.HasThumbnail("photo", "small"), "a metadata change keeps thumbnails")
+
+	require.NoError(t, fs.applyDelta(delta("e3", "c2")))
+	for _, key := range []string{"small", "large", previewKey} {
+		require.False(t, fs.thumbnails.HasThumbnail("photo", key), key)
+	}
+	require.True(t, fs.thumbnails.HasThumbnail("photo2", "small"), "other items keep theirs")
+
+	stats, err := fs.GetQuickStats()
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.ThumbnailCount)
+	require.Equal(t, int64(3), stats.ThumbnailSize)
+}
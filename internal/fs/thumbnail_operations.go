@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/auriora/onemount/internal/errors"
 	"github.com/auriora/onemount/internal/graph"
@@ -254,7 +255,43 @@ func (f *Filesystem) DeleteThumbnail(path string, size string) error {
 
 // CleanupThumbnailCache cleans up the thumbnail cache
 func (f *Filesystem) CleanupThumbnailCache() (int, error) {
-	return f.thumbnails.CleanupCache(f.cacheExpirationDays)
+	return f.thumbnails.CleanupCache(f.cacheExpiration())
+}
+
+// DefaultThumbnailCacheMB is the size the thumbnail cache, previews
+// included, is kept under unless configured otherwise.
+const DefaultThumbnailCacheMB = 256
+
+// SetThumbnailCacheLimit sets the size the thumbnail cache is kept under by
+// the cache cleanup; 0 or less removes the limit.
+func (f *Filesystem) SetThumbnailCacheLimit(bytes int64) {
+	f.thumbnailLimit.Store(max(bytes, 0))
+}
+
+// collectThumbnails removes the thumbnails not used within the cache
+// expiration, then the least recently used ones above the size limit. The
+// cache cleanup runs it after the content cache.
+func (f *Filesystem) collectThumbnails() (int, error) {
+	if f.thumbnails == nil {
+		return 0, nil
+	}
+	maxAge := time.Duration(f.cacheExpiration()) * 24 * time.Hour
+	count, err := f.thumbnails.Collect(maxAge, f.thumbnailLimit.Load())
+	if count > 0 {
+		logging.Info().Int("removedThumbnails", count).Msg("Thumbnail cache cleanup completed")
+	}
+	return count, err
+}
+
+// invalidateThumbnails drops the cached thumbnails and previews of an item
+// whose content changed remotely, as told by its cTag.
+func (f *Filesystem) invalidateThumbnails(id string) {
+	if f.thumbnails == nil {
+		return
+	}
+	if err := f.thumbnails.Invalidate(id); err != nil {
+		logging.Warn().Err(err).Str("id", id).Msg("Failed to invalidate cached thumbnails")
+	}
 }
 
 // getInodeFromPath gets an inode from a path
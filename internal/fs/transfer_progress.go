@@ -0,0 +1,136 @@
+package fs
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// progressEmitInterval is the minimum time between two progress signals for the
+// same item. Completion (done == total) is always emitted immediately.
+const progressEmitInterval = 500 * time.Millisecond
+
+// TransferProgress describes how far a hydration or upload has progressed.
+type TransferProgress struct {
+	Status     FileStatus // StatusDownloading or StatusSyncing
+	BytesDone  uint64
+	BytesTotal uint64
+	Updated    time.Time
+}
+
+// Fraction returns the completed fraction in the range [0, 1]. A transfer with
+// an unknown total reports 0 until it completes.
+func (p TransferProgress) Fraction() float64 {
+	if p.BytesTotal == 0 {
+		return 0
+	}
+	if p.BytesDone >= p.BytesTotal {
+		return 1
+	}
+	return float64(p.BytesDone) / float64(p.BytesTotal)
+}
+
+// progressTracker keeps the latest progress per item and decides when a new
+// sample is worth emitting so large transfers don't flood the session bus.
+type progressTracker struct {
+	mu       sync.Mutex
+	items    map[string]TransferProgress
+	lastEmit map[string]time.Time
+	interval time.Duration
+}
+
+func newProgressTracker(interval time.Duration) *progressTracker {
+	return &progressTracker{
+		items:    make(map[string]TransferProgress),
+		lastEmit: make(map[string]time.Time),
+		interval: interval,
+	}
+}
+
+// update records a progress sample and reports whether it should be emitted.
+func (t *progressTracker) update(id string, p TransferProgress) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.items[id] = p
+	complete := p.BytesTotal > 0 && p.BytesDone >= p.BytesTotal
+	if !complete && p.Updated.Sub(t.lastEmit[id]) < t.interval {
+		return false
+	}
+	t.lastEmit[id] = p.Updated
+	return true
+}
+
+// get returns the latest progress recorded for an item.
+func (t *progressTracker) get(id string) (TransferProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.items[id]
+	return p, ok
+}
+
+// clear drops all progress state for an item once its transfer has finished.
+func (t *progressTracker) clear(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.items, id)
+	delete(t.lastEmit, id)
+}
+
+// progressWriter counts bytes written through it and reports the running total.
+type progressWriter struct {
+	w        io.Writer
+	written  uint64
+	onUpdate func(done uint64)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.written += uint64(n)
+	if pw.onUpdate != nil && n > 0 {
+		pw.onUpdate(pw.written)
+	}
+	return n, err
+}
+
+// reportTransferProgress records progress for an in-flight download or upload
+// and emits a throttled FileProgressChanged D-Bus signal.
+func (f *Filesystem) reportTransferProgress(id string, status FileStatus, done, total uint64) {
+	if f == nil || f.transferProgress == nil || id == "" {
+		return
+	}
+	p := TransferProgress{
+		Status:     status,
+		BytesDone:  done,
+		BytesTotal: total,
+		Updated:    time.Now(),
+	}
+	if !f.transferProgress.update(id, p) {
+		return
+	}
+	if f.dbusServer == nil {
+		return
+	}
+	inode := f.GetID(id)
+	if inode == nil {
+		return
+	}
+	f.dbusServer.SendFileProgressUpdate(inode.Path(), status.String(), p.Fraction(), done, total)
+}
+
+// clearTransferProgress forgets progress for an item once its transfer ends.
+func (f *Filesystem) clearTransferProgress(id string) {
+	if f == nil || f.transferProgress == nil {
+		return
+	}
+	f.transferProgress.clear(id)
+}
+
+// GetTransferProgress returns the latest known progress for an in-flight
+// download or upload.
+func (f *Filesystem) GetTransferProgress(id string) (TransferProgress, bool) {
+	if f == nil || f.transferProgress == nil {
+		return TransferProgress{}, false
+	}
+	return f.transferProgress.get(id)
+}
@@ -0,0 +1,62 @@
+package fs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_TransferProgress_Fraction(t *testing.T) {
+	require.Zero(t, TransferProgress{BytesDone: 10}.Fraction())
+	require.InDelta(t, 0.25, TransferProgress{BytesDone: 1, BytesTotal: 4}.Fraction(), 1e-9)
+	require.Equal(t, 1.0, TransferProgress{BytesDone: 8, BytesTotal: 4}.Fraction())
+}
+
+func TestUT_FS_TransferProgress_Throttle(t *testing.T) {
+	tracker := newProgressTracker(time.Second)
+	start := time.Now()
+
+	require.True(t, tracker.update("a", TransferProgress{BytesDone: 1, BytesTotal: 10, Updated: start}))
+	require.False(t, tracker.update("a", TransferProgress{BytesDone: 2, BytesTotal: 10, Updated: start.Add(100 * time.Millisecond)}))
+	require.True(t, tracker.update("b", TransferProgress{BytesDone: 1, BytesTotal: 10, Updated: start.Add(100 * time.Millisecond)}))
+	require.True(t, tracker.update("a", TransferProgress{BytesDone: 3, BytesTotal: 10, Updated: start.Add(time.Second)}))
+
+	// Completion is never throttled.
+	require.True(t, tracker.update("a", TransferProgress{BytesDone: 10, BytesTotal: 10, Updated: start.Add(time.Second + time.Millisecond)}))
+
+	p, ok := tracker.get("a")
+	require.True(t, ok)
+	require.Equal(t, uint64(10), p.BytesDone)
+
+	tracker.clear("a")
+	_, ok = tracker.get("a")
+	require.False(t, ok)
+}
+
+func TestUT_FS_TransferProgress_WriterCountsBytes(t *testing.T) {
+	var buf bytes.Buffer
+	var reported []uint64
+	pw := &progressWriter{w: &buf, onUpdate: func(done uint64) { reported = append(reported, done) }}
+
+	_, err := pw.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = pw.Write([]byte(" world"))
+	require.NoError(t, err)
+
+	require.Equal(t, "hello world", buf.String())
+	require.Equal(t, []uint64{5, 11}, reported)
+}
+
+func TestUT_FS_TransferProgress_UploadSessionHandler(t *testing.T) {
+	session := &UploadSession{ID: "upload", Size: 2048}
+	var gotDone, gotTotal uint64
+	session.setProgressHandler(func(done, total uint64) {
+		gotDone, gotTotal = done, total
+	})
+
+	session.updateProgress(1, 1024)
+	require.Equal(t, uint64(1024), gotDone)
+	require.Equal(t, uint64(2048), gotTotal)
+}
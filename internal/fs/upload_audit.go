@@ -0,0 +1,242 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// An upload is done once OneDrive accepts it, and nothing checks afterwards
+// that what OneDrive stored is what was written locally. An upload audit
+// samples files uploaded recently, fetches their metadata from OneDrive and
+// compares the remote size and hash with the cached content, as an end-to-end
+// check that the upload pipeline does not corrupt data. Files changed locally
+// or on OneDrive since the upload, or no longer cached, are skipped. A
+// divergence is logged as an error, reported in the activity feed and shown as
+// an error status on the file; nothing is uploaded or downloaded to repair it.
+// Uploads OneDrive received but whose size or hash could not be confirmed
+// after the last retry are reported as mismatches too, until the file is
+// uploaded again.
+// Audits run on demand (onemount audit-uploads) and, when configured, every
+// uploadAuditInterval hours.
+
+const (
+	// uploadAuditHistory is the number of recent uploads audits sample from.
+	uploadAuditHistory = 256
+	// DefaultUploadAuditSample is the number of uploads an audit checks unless
+	// asked for another number.
+	DefaultUploadAuditSample = 20
+)
+
+// ActivityUploadMismatch reports an uploaded file whose remote copy differs
+// from the local content.
+const ActivityUploadMismatch = "upload-mismatch"
+
+// ActivityUploadUnconfirmed reports an upload OneDrive received but whose
+// size or hash did not match the local content.
+const ActivityUploadUnconfirmed = "upload-unconfirmed"
+
+// auditedUpload is an upload audits can sample.
+type auditedUpload struct {
+	id   string
+	etag string // eTag OneDrive returned for the upload
+}
+
+// uploadAudit remembers recent uploads. The zero value is ready to use.
+type uploadAudit struct {
+	mu          sync.Mutex
+	recent      []auditedUpload   // oldest first
+	unconfirmed map[string]string // uploads that failed verification, by ID
+}
+
+// UploadMismatch is an uploaded file whose remote copy differs from the local
+// content.
+type UploadMismatch struct {
+	ID      string
+	Path    string
+	Problem string
+}
+
+// UploadAuditReport is the result of an upload audit.
+type UploadAuditReport struct {
+	Checked    int // files compared with OneDrive
+	Skipped    int // sampled files changed since the upload or not cached
+	Mismatches []UploadMismatch
+	Errors     []string // files that could not be fetched from OneDrive
+}
+
+// noteUploaded remembers a completed upload for later audits.
+func (f *Filesystem) noteUploaded(id, etag string) {
+	a := &f.uploadAudit
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.unconfirmed, id)
+	for i, upload := range a.recent {
+		if upload.id == id {
+			a.recent = append(a.recent[:i], a.recent[i+1:]...)
+			break
+		}
+	}
+	a.recent = append(a.recent, auditedUpload{id: id, etag: etag})
+	if len(a.recent) > uploadAuditHistory {
+		a.recent = a.recent[len(a.recent)-uploadAuditHistory:]
+	}
+}
+
+// noteUnconfirmed remembers an upload that failed verification for later
+// audits and reports it in the activity feed.
+func (f *Filesystem) noteUnconfirmed(id string, err error) {
+	a := &f.uploadAudit
+	a.mu.Lock()
+	if a.unconfirmed == nil {
+		a.unconfirmed = make(map[string]string)
+	}
+	a.unconfirmed[id] = err.Error()
+	a.mu.Unlock()
+	f.emitActivity(ActivityUploadUnconfirmed, id, err.Error())
+}
+
+// unconfirmedUploads returns the uploads that failed verification.
+func (a *uploadAudit) unconfirmedUploads() map[string]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return maps.Clone(a.unconfirmed)
+}
+
+// sampleUploads returns up to n recent uploads picked at random.
+func (a *uploadAudit) sampleUploads(n int) []auditedUpload {
+	a.mu.Lock()
+	sample := append([]auditedUpload(nil), a.recent...)
+	a.mu.Unlock()
+	if n > 0 && len(sample) > n {
+		rand.Shuffle(len(sample), func(i, j int) { sample[i], sample[j] = sample[j], sample[i] })
+		sample = sample[:n]
+	}
+	return sample
+}
+
+// AuditUploads compares up to sample recently uploaded files with their copy
+// on OneDrive. A sample of 0 or less checks DefaultUploadAuditSample files.
+func (f *Filesystem) AuditUploads(ctx context.Context, sample int) (UploadAuditReport, error) {
+	return f.auditUploadsWith(ctx, sample, graphItemRemote{ctx: ctx, auth: f.auth})
+}
+
+func (f *Filesystem) auditUploadsWith(ctx context.Context, sample int, remote itemRemote) (UploadAuditReport, error) {
+	var report UploadAuditReport
+	if f.IsOffline() {
+		return report, errors.NewNetworkError("cannot audit uploads while offline", nil)
+	}
+	if sample <= 0 {
+		sample = DefaultUploadAuditSample
+	}
+
+	for id, problem := range f.uploadAudit.unconfirmedUploads() {
+		mismatch := UploadMismatch{ID: id, Problem: problem}
+		if inode := f.GetID(id); inode != nil {
+			mismatch.Path = inode.Path()
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+
+	for _, upload := range f.uploadAudit.sampleUploads(sample) {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		problem, checked, err := f.auditUpload(upload, remote)
+		switch {
+		case err != nil:
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", upload.id, err))
+		case !checked:
+			report.Skipped++
+		default:
+			report.Checked++
+		}
+		if problem == "" {
+			continue
+		}
+
+		mismatch := UploadMismatch{ID: upload.id, Problem: problem}
+		if inode := f.GetID(upload.id); inode != nil {
+			mismatch.Path = inode.Path()
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+		logging.Error().Str("id", upload.id).Str("path", mismatch.Path).Str("problem", problem).
+			Msg("Uploaded file differs from the local content")
+		f.MarkFileError(upload.id, errors.New("upload audit: "+problem))
+		f.emitActivity(ActivityUploadMismatch, upload.id, problem)
+	}
+	logging.Info().Int("checked", report.Checked).Int("skipped", report.Skipped).
+		Int("mismatches", len(report.Mismatches)).Int("errors", len(report.Errors)).
+		Msg("Upload audit finished")
+	return report, nil
+}
+
+// auditUpload compares one upload with OneDrive. It returns a description of
+// the divergence, if any, and whether the file could be compared at all.
+func (f *Filesystem) auditUpload(upload auditedUpload, remote itemRemote) (string, bool, error) {
+	inode := f.GetID(upload.id)
+	if inode == nil || inode.HasChanges() || !f.content.HasContent(upload.id) {
+		return "", false, nil
+	}
+	item, err := remote.GetItem(upload.id)
+	if err != nil {
+		return "", false, err
+	}
+	if item.File == nil || (upload.etag != "" && item.ETag != upload.etag) {
+		// Replaced on OneDrive since; the delta loop handles that.
+		return "", false, nil
+	}
+
+	fd, err := f.content.Open(upload.id)
+	if err != nil {
+		return "", false, err
+	}
+	st, err := fd.Stat()
+	if err != nil {
+		return "", false, err
+	}
+	if uint64(st.Size()) != item.Size {
+		return fmt.Sprintf("OneDrive has %d bytes, the local copy %d", item.Size, st.Size()), true, nil
+	}
+	caps := f.Capabilities()
+	if caps.HasVerifiableHash(item) && !caps.VerifyContent(item, io.NewSectionReader(fd, 0, st.Size())) {
+		return "the hash on OneDrive does not match the local content", true, nil
+	}
+	return "", true, nil
+}
+
+// StartUploadAudits audits sample recent uploads every interval until the
+// filesystem stops.
+func (f *Filesystem) StartUploadAudits(interval time.Duration, sample int) {
+	if interval <= 0 {
+		return
+	}
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if f.IsOffline() {
+					continue
+				}
+				if _, err := f.AuditUploads(f.ctx, sample); err != nil {
+					logging.Warn().Err(err).Msg("Upload audit failed")
+				}
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
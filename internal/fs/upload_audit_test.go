@@ -0,0 +1,163 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/stretchr/testify/require"
+)
+
+func newUploadAuditTestFile(t *testing.T, content string) (*Filesystem, *Inode) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+	parent := NewInodeDriveItem(&graph.DriveItem{ID: "parent", Name: "docs", Folder: &graph.Folder{}})
+	registerHydratedEntry(t, fs, parent)
+	file := NewInodeDriveItem(&graph.DriveItem{
+		ID:     "report",
+		Name:   "report.txt",
+		ETag:   "etag-1",
+		Size:   uint64(len(content)),
+		Parent: &graph.DriveItemParent{ID: "parent"},
+		File:   &graph.File{},
+	})
+	registerHydratedEntry(t, fs, file)
+	require.NoError(t, fs.content.Insert(file.ID(), []byte(content)))
+	fs.noteUploaded(file.ID(), "etag-1")
+	return fs, file
+}
+
+func remoteCopy(etag, content string) *fakeRemote {
+	data := []byte(content)
+	return &fakeRemote{item: &graph.DriveItem{
+		ID:   "report",
+		Name: "report.txt",
+		ETag: etag,
+		Size: uint64(len(data)),
+		File: &graph.File{Hashes: graph.Hashes{QuickXorHash: graph.QuickXORHash(&data)}},
+	}}
+}
+
+func TestUT_FS_UploadAudit_MatchingUploadPasses(t *testing.T) {
+	fs, _ := newUploadAuditTestFile(t, "quarterly numbers")
+
+	report, err := fs.auditUploadsWith(context.Background(), 0, remoteCopy("etag-1", "quarterly numbers"))
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Checked)
+	require.Empty(t, report.Mismatches)
+}
+
+func TestUT_FS_UploadAudit_ReportsDivergence(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+
+	report, err := fs.auditUploadsWith(context.Background(), 0, remoteCopy("etag-1", "quarterly NUMBERS"))
+	require.NoError(t, err)
+	require.Len(t, report.Mismatches, 1)
+	require.Equal(t, file.ID(), report.Mismatches[0].ID)
+	require.Contains(t, report.Mismatches[0].Problem, "hash")
+	require.Equal(t, StatusError, fs.GetFileStatus(file.ID()).Status)
+
+	report, err = fs.auditUploadsWith(context.Background(), 0, remoteCopy("etag-1", "truncated"))
+	require.NoError(t, err)
+	require.Len(t, report.Mismatches, 1)
+	require.Contains(t, report.Mismatches[0].Problem, "bytes")
+}
+
+func TestUT_FS_UploadAudit_SkipsFilesChangedSinceUpload(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+
+	report, err := fs.auditUploadsWith(context.Background(), 0, remoteCopy("etag-2", "edited on the web"))
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Skipped, "a newer remote version is not a corrupted upload")
+	require.Empty(t, report.Mismatches)
+
+	file.mu.Lock()
+	file.hasChanges = true
+	file.mu.Unlock()
+	report, err = fs.auditUploadsWith(context.Background(), 0, remoteCopy("etag-1", "something else"))
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Skipped, "local edits since the upload are not compared")
+	require.Empty(t, report.Mismatches)
+}
+
+func TestUT_FS_UploadAudit_KeepsRecentHistory(t *testing.T) {
+	fs := &Filesystem{}
+	for i := 0; i < uploadAuditHistory+10; i++ {
+		fs.noteUploaded(fmt.Sprintf("file-%d", i), "")
+	}
+	fs.noteUploaded("again", "etag-1")
+	fs.noteUploaded("again", "etag-2")
+
+	require.Len(t, fs.uploadAudit.recent, uploadAuditHistory)
+	last := fs.uploadAudit.recent[len(fs.uploadAudit.recent)-1]
+	require.Equal(t, auditedUpload{id: "again", etag: "etag-2"}, last)
+	require.Len(t, fs.uploadAudit.sampleUploads(5), 5)
+}
+
+type uploadTransport func(*http.Request) (*http.Response, error)
+
+func (f uploadTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestUT_FS_UploadAudit_UnconfirmedUploadIsVerifyingThenReported(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+	data := []byte("quarterly numbers")
+	session, err := NewUploadSession(file, &data)
+	require.NoError(t, err)
+
+	// OneDrive accepts the bytes but reports another hash for them
+	stored := []byte("quarterly NUMBERS")
+	graph.SetHTTPClient(&http.Client{Transport: uploadTransport(func(request *http.Request) (*http.Response, error) {
+		body, _ := json.Marshal(graph.DriveItem{
+			ID:   "report",
+			Size: uint64(len(stored)),
+			File: &graph.File{Hashes: graph.Hashes{QuickXorHash: graph.QuickXORHash(&stored)}},
+		})
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{},
+			Body: io.NopCloser(bytes.NewReader(body)), Request: request}, nil
+	})})
+	defer graph.SetHTTPClient(nil)
+
+	var statesWhileVerifying []int
+	session.setVerifyingHandler(func() {
+		statesWhileVerifying = append(statesWhileVerifying, session.getState())
+	})
+	auth := &graph.Auth{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	err = session.UploadWithContext(context.Background(), auth, nil)
+	require.ErrorContains(t, err, "upload not confirmed by OneDrive")
+	require.Equal(t, []int{uploadVerifying}, statesWhileVerifying)
+	require.Equal(t, uploadErrored, session.getState())
+	require.True(t, session.wasUnconfirmed())
+
+	fs.noteUnconfirmed(file.ID(), err)
+	report, err := fs.auditUploadsWith(context.Background(), 0, remoteCopy("etag-2", "quarterly NUMBERS"))
+	require.NoError(t, err)
+	require.Len(t, report.Mismatches, 1)
+	require.Equal(t, "/report.txt", report.Mismatches[0].Path)
+	require.Contains(t, report.Mismatches[0].Problem, "checksum")
+
+	fs.noteUploaded(file.ID(), "etag-3")
+	report, err = fs.auditUploadsWith(context.Background(), 0, remoteCopy("etag-3", "quarterly numbers"))
+	require.NoError(t, err)
+	require.Empty(t, report.Mismatches, "a later upload clears it")
+}
+
+func TestUT_FS_UploadAudit_VerifyingStatus(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+	session := &UploadSession{ID: file.ID(), OldID: file.ID(), state: uploadVerifying}
+	fs.uploads = &UploadManager{sessions: map[string]*UploadSession{file.ID(): session}}
+
+	status := fs.determineFileStatus(file.ID())
+	require.Equal(t, StatusVerifying, status.Status)
+	require.Equal(t, "Verifying", status.Status.String())
+	stats, err := fs.GetQuickStats()
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.UploadsVerifying)
+}
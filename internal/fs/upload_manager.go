@@ -36,6 +36,9 @@ const (
 	UploadCompletedState
 	// UploadErrored indicates the upload failed
 	UploadErroredState
+	// UploadVerifyingState indicates OneDrive received the content and the
+	// upload is being checked against what it stored
+	UploadVerifyingState
 )
 
 // UploadPriority defines the priority level for uploads
@@ -114,6 +117,9 @@ type UploadManager struct {
 	sessionPriorities          map[string]UploadPriority // Track priority of each session
 	pendingHighPriorityUploads map[string]bool           // Track uploads queued but not yet processed by uploadLoop
 	pendingLowPriorityUploads  map[string]bool           // Track uploads queued but not yet processed by uploadLoop
+	revisions                  map[string]UploadPriority // Edits made after an upload took its content, uploaded next
+	urgent                     map[string]bool           // Uploads started without waiting for a free upload slot
+	wake                       chan struct{}             // Starts queued uploads before the next tick
 	inFlight                   uint8                     // number of sessions in flight
 	auth                       *graph.Auth
 	fs                         FilesystemInterface
@@ -130,6 +136,8 @@ type UploadManager struct {
 	shutdownCancel  context.CancelFunc
 	gracefulTimeout time.Duration
 	shutdownFlag    atomic.Bool
+
+	health *workerPool
 }
 
 func (u *UploadManager) filesystem() (*Filesystem, bool) {
@@ -149,6 +157,32 @@ func (u *UploadManager) tryIncrementInFlight() bool {
 	return true
 }
 
+// takeUrgent starts an upload requested with UploadNow even when the maximum
+// number of uploads is in flight.
+func (u *UploadManager) takeUrgent(id string) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if !u.urgent[id] {
+		return false
+	}
+	delete(u.urgent, id)
+	u.inFlight++
+	return true
+}
+
+// urgentQueued reports whether an upload requested with UploadNow has not
+// reached the sessions map yet.
+func (u *UploadManager) urgentQueued() bool {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	for id := range u.urgent {
+		if u.pendingHighPriorityUploads[id] {
+			return true
+		}
+	}
+	return false
+}
+
 func (u *UploadManager) decrementInFlight() {
 	u.mutex.Lock()
 	if u.inFlight > 0 {
@@ -179,6 +213,9 @@ func NewUploadManager(duration time.Duration, db *bolt.DB, fs FilesystemInterfac
 		sessionPriorities:          make(map[string]UploadPriority),
 		pendingHighPriorityUploads: make(map[string]bool),
 		pendingLowPriorityUploads:  make(map[string]bool),
+		revisions:                  make(map[string]UploadPriority),
+		urgent:                     make(map[string]bool),
+		wake:                       make(chan struct{}, 1),
 		auth:                       auth,
 		db:                         db,
 		fs:                         fs,
@@ -191,6 +228,7 @@ func NewUploadManager(duration time.Duration, db *bolt.DB, fs FilesystemInterfac
 		shutdownCancel:  cancel,
 		gracefulTimeout: gracefulTimeout, // Use configured timeout for large uploads to complete
 	}
+	manager.health = newWorkerPool(poolUpload, manager.waitingUploads)
 	db.View(func(tx *bolt.Tx) error {
 		// Add any incomplete sessions from disk - any sessions here were never
 		// finished. The most likely cause of this is that the user shut off
@@ -215,6 +253,7 @@ func NewUploadManager(duration time.Duration, db *bolt.DB, fs FilesystemInterfac
 			return nil
 		})
 	})
+	manager.pruneUploadSnapshots()
 
 	// Set up signal handling for graceful shutdown
 	signal.Notify(manager.signalChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
@@ -227,6 +266,23 @@ func NewUploadManager(duration time.Duration, db *bolt.DB, fs FilesystemInterfac
 	return &manager
 }
 
+// waitingUploads returns the number of uploads queued or waiting to start,
+// or -1 while the sessions are locked, so a hung upload loop cannot hang the
+// worker watchdog as well.
+func (u *UploadManager) waitingUploads() int {
+	waiting := len(u.highPriorityQueue) + len(u.lowPriorityQueue)
+	if !u.mutex.TryRLock() {
+		return -1
+	}
+	for _, session := range u.sessions {
+		if session.getState() == uploadNotStarted {
+			waiting++
+		}
+	}
+	u.mutex.RUnlock()
+	return waiting
+}
+
 // uploadLoop manages the deduplication and tracking of uploads.
 //
 // This method runs in a separate goroutine and processes uploads from the queues.
@@ -239,7 +295,11 @@ func (u *UploadManager) uploadLoop(duration time.Duration) {
 	ticker := time.NewTicker(duration)
 	defer ticker.Stop()
 
+	loopID := u.health.add(nil)
+	defer u.health.remove(loopID)
+
 	for {
+		u.health.beat(loopID)
 		select {
 		case session := <-u.highPriorityQueue: // high priority sessions
 			// deduplicate sessions for the same item
@@ -299,7 +359,15 @@ func (u *UploadManager) uploadLoop(duration time.Duration) {
 		case cancelID := <-u.deletionQueue: // remove uploads for deleted items
 			u.finishUpload(cancelID)
 
+		case <-u.wake: // an upload was requested with UploadNow
+			ticker.Reset(time.Millisecond)
+
 		case <-ticker.C: // periodically start uploads, or remove them if done/failed
+			if u.urgentQueued() {
+				ticker.Reset(time.Millisecond)
+			} else {
+				ticker.Reset(duration)
+			}
 			u.mutex.RLock()
 			sessionsCopy := make(map[string]*UploadSession)
 			prioritiesCopy := make(map[string]UploadPriority)
@@ -338,23 +406,51 @@ func (u *UploadManager) uploadLoop(duration time.Duration) {
 				session := s.session
 				switch session.getState() {
 				case uploadNotStarted:
+					if fsImpl, ok := u.filesystem(); ok && (fsImpl.Suspended() || fsImpl.ArchiveMode()) {
+						continue // started again after resume, never in an archive mount
+					}
 					// max active upload sessions are capped at this limit for faster
 					// uploads of individual files and also to prevent possible server-
 					// side throttling that can cause errors.
-					if u.tryIncrementInFlight() {
+					if u.tryIncrementInFlight() || u.takeUrgent(id) {
 						// Update status to syncing
 						u.fs.SetFileStatus(id, FileStatusInfo{
 							Status:    StatusSyncing,
 							Timestamp: time.Now(),
 						})
+						if fsImpl, ok := u.filesystem(); ok {
+							var accounted uint64
+							session.setProgressHandler(func(done, total uint64) {
+								if done > accounted {
+									fsImpl.recordTransfer(done-accounted, 0)
+									accounted = done
+								}
+								fsImpl.reportTransferProgress(id, StatusSyncing, done, total)
+								u.health.progress()
+							})
+							session.setVerifyingHandler(func() {
+								fsImpl.SetFileStatus(id, FileStatusInfo{
+									Status:    StatusVerifying,
+									Timestamp: time.Now(),
+								})
+							})
+							session.setChunkSizer(fsImpl.transferChunks(chunkUpload))
+						}
 						go func(s *UploadSession) {
+							workerID := u.health.add(nil)
+							defer u.health.remove(workerID)
+							u.health.begin(workerID, "upload "+s.ID)
 							s.UploadWithContext(u.shutdownContext, u.auth, u.db)
+							u.health.end(workerID)
 						}(session)
 					}
 
 				case uploadErrored:
 					// Decrement inFlight since the upload goroutine has completed
 					u.decrementInFlight()
+					if fsImpl, ok := u.filesystem(); ok {
+						fsImpl.clearTransferProgress(id)
+					}
 
 					session.retries++
 					session.RecoveryAttempts++
@@ -390,6 +486,7 @@ func (u *UploadManager) uploadLoop(duration time.Duration) {
 						logging.Error().
 							Str("id", session.ID).
 							Str("name", session.Name).
+							Str(logging.FieldCorrelationID, session.correlationID()).
 							Err(session).
 							Int("retries", session.retries).
 							Int("recoveryAttempts", session.RecoveryAttempts).
@@ -401,6 +498,9 @@ func (u *UploadManager) uploadLoop(duration time.Duration) {
 
 						// Update file status to error so user knows upload failed
 						u.fs.MarkFileError(session.ID, session.error)
+						if fsImpl, ok := u.filesystem(); ok && session.wasUnconfirmed() {
+							fsImpl.noteUnconfirmed(session.ID, session.error)
+						}
 
 						// Log that file remains accessible locally
 						logging.Info().
@@ -414,6 +514,7 @@ func (u *UploadManager) uploadLoop(duration time.Duration) {
 						logging.Warn().
 							Str("id", session.ID).
 							Str("name", session.Name).
+							Str(logging.FieldCorrelationID, session.correlationID()).
 							Err(session).
 							Int("retries", session.retries).
 							Msg("Upload session failed, will retry from beginning.")
@@ -429,6 +530,9 @@ func (u *UploadManager) uploadLoop(duration time.Duration) {
 				case uploadComplete:
 					// Decrement inFlight since the upload goroutine has completed
 					u.decrementInFlight()
+					if fsImpl, ok := u.filesystem(); ok {
+						fsImpl.clearTransferProgress(id)
+					}
 
 					logging.Info().
 						Str("id", session.ID).
@@ -451,28 +555,44 @@ func (u *UploadManager) uploadLoop(duration time.Duration) {
 
 					// inode will exist at the new ID now, but we check if inode
 					// is nil to see if the item has been deleted since upload start
+					superseded := u.supersededUpload(session)
 					if inode := u.fs.GetID(session.ID); inode != nil {
 						inode.mu.Lock()
 						inode.DriveItem.ETag = session.ETag
 
-						// Use the size from the remote DriveItem
-						inode.DriveItem.Size = session.Size
+						// Use the size from the remote DriveItem, unless the
+						// file changed while uploading
+						if !superseded {
+							inode.DriveItem.Size = session.Size
+						}
 
 						inode.mu.Unlock()
 
 						// Update status to local (synced)
+						status := StatusLocal
+						if superseded {
+							status = StatusLocalModified
+						}
 						u.fs.SetFileStatus(session.ID, FileStatusInfo{
-							Status:    StatusLocal,
+							Status:    status,
 							Timestamp: time.Now(),
 						})
 
 						// Update file status attributes
 						u.fs.UpdateFileStatus(inode)
+
+						if fsImpl, ok := u.filesystem(); ok {
+							fsImpl.noteUploaded(session.ID, session.ETag)
+							// Reported here, where every upload ends, not only
+							// those waited for
+							fsImpl.emitActivity(ActivityUploaded, session.ID, "")
+						}
 					}
 
 					// the old ID is the one that was used to add it to the queue.
 					// cleanup the session.
 					u.finishUpload(session.OldID)
+					u.uploadRevision(session)
 				}
 			}
 
@@ -529,7 +649,7 @@ func (u *UploadManager) persistActiveUploads() {
 	defer u.mutex.RUnlock()
 
 	for id, session := range u.sessions {
-		if session.getState() == uploadStarted {
+		if session.inFlight() {
 			logging.Info().
 				Str("id", id).
 				Str("name", session.Name).
@@ -559,7 +679,7 @@ func (u *UploadManager) hasActiveUploads() bool {
 	defer u.mutex.RUnlock()
 
 	for _, session := range u.sessions {
-		if session.getState() == uploadStarted {
+		if session.inFlight() {
 			return true
 		}
 	}
@@ -592,7 +712,7 @@ func (u *UploadManager) logActiveUploads() {
 
 	activeCount := 0
 	for _, session := range u.sessions {
-		if session.getState() == uploadStarted {
+		if session.inFlight() {
 			activeCount++
 			progress := float64(session.BytesUploaded) / float64(session.Size) * 100
 			logging.Info().
@@ -630,12 +750,42 @@ func (u *UploadManager) QueueUpload(inode *Inode) (*UploadSession, error) {
 // queued but not yet processed.
 //
 // For large files (>= 100MB), this method uses streaming from disk to reduce memory usage.
+// The upload streams a snapshot of the content, see upload_snapshot.go. When
+// the item already has an upload session, edits since its content was taken
+// are recorded as the next revision instead.
 func (u *UploadManager) QueueUploadWithPriority(inode *Inode, priority UploadPriority) (*UploadSession, error) {
 	// Get the file size to determine upload strategy
 	inode.mu.RLock()
 	fileSize := inode.DriveItem.Size
+	id := inode.DriveItem.ID
+	var localHash string
+	if inode.DriveItem.File != nil {
+		localHash = inode.DriveItem.File.Hashes.QuickXorHash
+	}
 	inode.mu.RUnlock()
 
+	// Check if there's already an upload session for this ID
+	if existingSession, exists := u.GetSession(id); exists {
+		if localHash != "" && localHash != existingSession.QuickXORHash {
+			u.noteRevision(id, priority)
+		}
+		if fsImpl, ok := u.filesystem(); ok {
+			fsImpl.persistMetadataEntry(id, inode)
+			fsImpl.markDirtyLocalState(id)
+			fsImpl.transitionItemState(id, metadata.ItemStateDirtyLocal,
+				metadata.WithUploadEvent(),
+				metadata.WithWorker("upload-queue:"+id))
+		}
+		// If the existing session has lower priority than the requested priority,
+		// update its priority
+		u.mutex.Lock()
+		if u.sessionPriorities[id] < priority {
+			u.sessionPriorities[id] = priority
+		}
+		u.mutex.Unlock()
+		return existingSession, nil
+	}
+
 	const largeFileThreshold = 100 * 1024 * 1024 // 100MB
 
 	var session *UploadSession
@@ -643,8 +793,18 @@ func (u *UploadManager) QueueUploadWithPriority(inode *Inode, priority UploadPri
 
 	if fileSize >= largeFileThreshold {
 		// Use streaming upload for large files to save memory
-		contentPath := u.fs.GetInodeContentPath(inode)
-		session, err = NewUploadSessionWithPath(inode, contentPath)
+		if fsImpl, ok := u.filesystem(); ok {
+			snapshot, size, hash, snapErr := fsImpl.snapshotUploadContent(inode)
+			if snapErr != nil {
+				return nil, snapErr
+			}
+			session, err = newStreamingUploadSession(inode, snapshot, size, hash)
+			if err != nil {
+				_ = os.Remove(snapshot)
+			}
+		} else {
+			session, err = NewUploadSessionWithPath(inode, u.fs.GetInodeContentPath(inode))
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -670,27 +830,6 @@ func (u *UploadManager) QueueUploadWithPriority(inode *Inode, priority UploadPri
 			metadata.WithWorker("upload-queue:"+session.ID))
 	}
 
-	// Check if there's already an upload session for this ID
-	u.mutex.RLock()
-	existingSession, exists := u.sessions[session.ID]
-	existingPriority := PriorityLow
-	if exists {
-		existingPriority, _ = u.sessionPriorities[session.ID]
-	}
-	u.mutex.RUnlock()
-
-	if exists {
-		// If the existing session has lower priority than the requested priority,
-		// update its priority
-		if existingPriority < priority {
-			u.mutex.Lock()
-			u.sessionPriorities[session.ID] = priority
-			u.mutex.Unlock()
-		}
-		// Return the existing session
-		return existingSession, nil
-	}
-
 	if u.fs.IsOffline() {
 		// If offline, store the session for later but don't start upload
 		contents, _ := json.Marshal(session)
@@ -733,10 +872,12 @@ func (u *UploadManager) QueueUploadWithPriority(inode *Inode, priority UploadPri
 
 	select {
 	case targetQueue <- session:
+		u.health.enqueued()
 		logging.Info().
 			Str("id", session.ID).
 			Str("name", session.Name).
 			Str("priority", priorityToString(priority)).
+			Str(logging.FieldCorrelationID, session.correlationID()).
 			Msg("File queued for upload")
 		return session, nil
 	default:
@@ -751,6 +892,31 @@ func (u *UploadManager) QueueUploadWithPriority(inode *Inode, priority UploadPri
 	}
 }
 
+// UploadNow queues the upload of inode ahead of all other uploads and starts
+// it right away, even when the maximum number of uploads is in flight.
+func (u *UploadManager) UploadNow(inode *Inode) (*UploadSession, error) {
+	id := inode.ID()
+	u.mutex.Lock()
+	if u.urgent == nil {
+		u.urgent = make(map[string]bool)
+	}
+	u.urgent[id] = true
+	u.mutex.Unlock()
+
+	session, err := u.QueueUploadWithPriority(inode, PriorityHigh)
+	if err != nil {
+		u.mutex.Lock()
+		delete(u.urgent, id)
+		u.mutex.Unlock()
+		return nil, err
+	}
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+	return session, nil
+}
+
 // priorityToString converts an UploadPriority to a string for logging
 func priorityToString(priority UploadPriority) string {
 	if priority == PriorityHigh {
@@ -777,6 +943,7 @@ func (u *UploadManager) finishUpload(id string) {
 
 	if session, exists := u.sessions[id]; exists {
 		session.cancel(u.auth)
+		releaseUploadSnapshot(session)
 	}
 	u.db.Batch(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(bucketUploads); b != nil {
@@ -788,6 +955,7 @@ func (u *UploadManager) finishUpload(id string) {
 	// not here in finishUpload, to avoid double-decrementing
 	delete(u.sessions, id)
 	delete(u.sessionPriorities, id) // Also remove from sessionPriorities map
+	delete(u.urgent, id)
 
 	// Also remove from pending maps if present
 	delete(u.pendingHighPriorityUploads, id)
@@ -819,6 +987,8 @@ func (u *UploadManager) GetUploadStatus(id string) (UploadState, error) {
 		return UploadCompletedState, nil
 	case uploadErrored:
 		return UploadErroredState, nil
+	case uploadVerifying:
+		return UploadVerifyingState, nil
 	default:
 		return 0, errors.New("unknown upload state")
 	}
@@ -894,12 +1064,18 @@ func (u *UploadManager) WaitForUpload(id string) error {
 		state := session.getState()
 		switch state {
 		case uploadComplete:
+			// Edits made while uploading are uploaded next, the file stays
+			// modified until then
+			superseded := u.supersededUpload(session)
+
 			// Update the file status to Local immediately when the upload completes
 			// This ensures the status is updated without waiting for the uploadLoop
-			u.fs.SetFileStatus(id, FileStatusInfo{
-				Status:    StatusLocal,
-				Timestamp: time.Now(),
-			})
+			if !superseded {
+				u.fs.SetFileStatus(id, FileStatusInfo{
+					Status:    StatusLocal,
+					Timestamp: time.Now(),
+				})
+			}
 
 			// If the ID changed during upload, update the inode
 			if session.OldID != session.ID {
@@ -919,9 +1095,11 @@ func (u *UploadManager) WaitForUpload(id string) error {
 				inode.DriveItem.ETag = session.ETag
 
 				// Use the size from the remote DriveItem
-				inode.DriveItem.Size = session.Size
+				if !superseded {
+					inode.DriveItem.Size = session.Size
+				}
 				inode.mu.Unlock()
-				if fsImpl, ok := u.filesystem(); ok {
+				if fsImpl, ok := u.filesystem(); ok && !superseded {
 					fsImpl.markCleanLocalState(session.ID)
 				}
 
@@ -934,6 +1112,9 @@ func (u *UploadManager) WaitForUpload(id string) error {
 			}
 
 			if fsImpl, ok := u.filesystem(); ok {
+				if superseded {
+					return nil
+				}
 				opts := []metadata.TransitionOption{
 					metadata.WithUploadEvent(),
 					metadata.WithWorker("upload:" + session.ID),
@@ -953,9 +1134,9 @@ func (u *UploadManager) WaitForUpload(id string) error {
 			if fsImpl, ok := u.filesystem(); ok {
 				if session.error != nil {
 					fsImpl.transitionItemState(session.ID, metadata.ItemStateError,
-						metadata.WithUploadEvent(),
-						metadata.WithWorker("upload:"+session.ID),
-						metadata.WithTransitionError(session.error, false))
+						append(errorTransition(session.error),
+							metadata.WithUploadEvent(),
+							metadata.WithWorker("upload:"+session.ID))...)
 				} else {
 					fsImpl.transitionItemState(session.ID, metadata.ItemStateError,
 						metadata.WithUploadEvent(),
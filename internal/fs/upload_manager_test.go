@@ -385,6 +385,40 @@ func TestIT_FS_Upload_ManagerHydratesMetadataOnCompletion(t *testing.T) {
 	}
 }
 
+func TestUT_FS_Upload_ManagerReportsBackgroundUploadsInActivityFeed(t *testing.T) {
+	fs, um, db := newUploadManagerTestEnv(t)
+	defer db.Close()
+
+	inode := NewInode("background-file.txt", fuse.S_IFREG|0644, nil)
+	fs.metadata.Store(inode.ID(), inode)
+	um.sessions[inode.ID()] = &UploadSession{ID: inode.ID(), OldID: inode.ID(), state: uploadComplete}
+
+	um.workerWg.Add(1)
+	go um.uploadLoop(10 * time.Millisecond)
+	defer func() {
+		close(um.stopChan)
+		um.workerWg.Wait()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		um.mutex.RLock()
+		pending := len(um.sessions)
+		um.mutex.RUnlock()
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the upload loop did not finish the completed session")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	events := fs.RecentEvents(10)
+	if len(events) != 1 || events[0].Type != ActivityUploaded || events[0].ID != inode.ID() {
+		t.Fatalf("expected one uploaded event for an upload nobody waited for, got %+v", events)
+	}
+}
+
 func TestIT_FS_Upload_ManagerSetsErrorStateOnFailure(t *testing.T) {
 	fs, um, db := newUploadManagerTestEnv(t)
 	defer db.Close()
@@ -456,6 +490,7 @@ func newUploadManagerTestEnv(t *testing.T) (*Filesystem, *UploadManager, *bolt.D
 		sessionPriorities:          make(map[string]UploadPriority),
 		pendingHighPriorityUploads: make(map[string]bool),
 		pendingLowPriorityUploads:  make(map[string]bool),
+		revisions:                  make(map[string]UploadPriority),
 		auth:                       &graph.Auth{},
 		fs:                         fs,
 		db:                         db,
@@ -11,7 +11,6 @@ import (
 	"net/url"
 	"os"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -35,6 +34,9 @@ const (
 	uploadStarted
 	uploadComplete
 	uploadErrored
+	// uploadVerifying follows uploadStarted once OneDrive has all the bytes,
+	// until the size and hash it reports are checked against the upload
+	uploadVerifying
 )
 
 // UploadSession contains a snapshot of the file we're uploading. We have to
@@ -57,7 +59,10 @@ type UploadSession struct {
 	ContentPath        string    `json:"contentPath,omitempty"` // Used for large files (>=100MB) to stream from disk
 	QuickXORHash       string    `json:"quickxorhash,omitempty"`
 	ModTime            time.Time `json:"modTime,omitempty"`
-	retries            int
+	// CorrelationID ties the log entries and Graph requests of the upload
+	// together (see logging.WithCorrelationID)
+	CorrelationID string `json:"correlationId,omitempty"`
+	retries       int
 
 	// Recovery and progress tracking fields
 	LastSuccessfulChunk int       `json:"lastSuccessfulChunk"`
@@ -72,6 +77,11 @@ type UploadSession struct {
 	ETag      string `json:"eTag,omitempty"`
 	state     int
 	error     // embedded error tracks errors that killed an upload
+
+	onProgress  func(bytesUploaded, size uint64) // optional progress observer, never persisted
+	onVerifying func()                           // optional observer of uploadVerifying, never persisted
+	unconfirmed bool                             // the last attempt failed in uploadVerifying
+	chunks      graph.ChunkSizer                 // chunk size policy, uploadChunkSize when nil; never persisted
 }
 
 // MarshalJSON implements a custom JSON marshaler to avoid race conditions
@@ -93,6 +103,7 @@ func (u *UploadSession) MarshalJSON() ([]byte, error) {
 		ContentPath        string    `json:"contentPath,omitempty"`
 		QuickXORHash       string    `json:"quickxorhash,omitempty"`
 		ModTime            time.Time `json:"modTime,omitempty"`
+		CorrelationID      string    `json:"correlationId,omitempty"`
 
 		// Recovery and progress tracking fields
 		LastSuccessfulChunk int       `json:"lastSuccessfulChunk"`
@@ -118,6 +129,7 @@ func (u *UploadSession) MarshalJSON() ([]byte, error) {
 		ContentPath:         u.ContentPath,
 		QuickXORHash:        u.QuickXORHash,
 		ModTime:             u.ModTime,
+		CorrelationID:       u.CorrelationID,
 		LastSuccessfulChunk: u.LastSuccessfulChunk,
 		TotalChunks:         u.TotalChunks,
 		BytesUploaded:       u.BytesUploaded,
@@ -129,6 +141,17 @@ func (u *UploadSession) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// correlationID returns the correlation ID of the upload, assigning one to
+// sessions that have none yet.
+func (u *UploadSession) correlationID() string {
+	u.Lock()
+	defer u.Unlock()
+	if u.CorrelationID == "" {
+		u.CorrelationID = logging.NewCorrelationID()
+	}
+	return u.CorrelationID
+}
+
 // UploadSessionPost is the initial post used to create an upload session
 type UploadSessionPost struct {
 	Name             string `json:"name,omitempty"`
@@ -147,13 +170,85 @@ func (u *UploadSession) getState() int {
 	return u.state
 }
 
+// inFlight returns whether the upload goroutine is running: sending bytes or
+// verifying them.
+func (u *UploadSession) inFlight() bool {
+	state := u.getState()
+	return state == uploadStarted || state == uploadVerifying
+}
+
 // updateProgress updates the upload progress and persists it
 func (u *UploadSession) updateProgress(chunkIndex int, bytesUploaded uint64) {
 	u.Lock()
-	defer u.Unlock()
 	u.LastSuccessfulChunk = chunkIndex
 	u.BytesUploaded = bytesUploaded
 	u.LastProgressTime = time.Now()
+	onProgress, size := u.onProgress, u.Size
+	u.Unlock()
+
+	if onProgress != nil {
+		onProgress(bytesUploaded, size)
+	}
+}
+
+// setChunkSizer sets how the sizes of upload session chunks are chosen.
+func (u *UploadSession) setChunkSizer(chunks graph.ChunkSizer) {
+	u.Lock()
+	defer u.Unlock()
+	u.chunks = chunks
+}
+
+// chunkSizer returns the chunk size policy of the session.
+func (u *UploadSession) chunkSizer() graph.ChunkSizer {
+	u.Lock()
+	defer u.Unlock()
+	if u.chunks == nil {
+		return graph.FixedChunkSize(uploadChunkSize)
+	}
+	return u.chunks
+}
+
+// setProgressHandler registers a callback invoked after each progress update.
+func (u *UploadSession) setProgressHandler(handler func(bytesUploaded, size uint64)) {
+	u.Lock()
+	defer u.Unlock()
+	u.onProgress = handler
+}
+
+// setVerifyingHandler registers a callback invoked when all bytes are sent
+// and the upload is being verified.
+func (u *UploadSession) setVerifyingHandler(handler func()) {
+	u.Lock()
+	defer u.Unlock()
+	u.onVerifying = handler
+}
+
+// startVerifying moves the upload to uploadVerifying.
+func (u *UploadSession) startVerifying() {
+	u.Lock()
+	u.state = uploadVerifying
+	onVerifying := u.onVerifying
+	u.Unlock()
+	if onVerifying != nil {
+		onVerifying()
+	}
+}
+
+// verificationFailed fails an upload OneDrive received but did not confirm,
+// so its error tells it apart from one whose bytes were never sent.
+func (u *UploadSession) verificationFailed(err error) error {
+	u.Lock()
+	u.unconfirmed = true
+	u.Unlock()
+	return u.setState(uploadErrored, errors.Wrap(err, "upload not confirmed by OneDrive"))
+}
+
+// wasUnconfirmed returns whether the last attempt sent all bytes but failed
+// verification.
+func (u *UploadSession) wasUnconfirmed() bool {
+	u.Lock()
+	defer u.Unlock()
+	return u.unconfirmed
 }
 
 // persistProgress saves the current upload progress to disk for recovery
@@ -187,13 +282,18 @@ func (u *UploadSession) canResumeUpload() bool {
 	return u.CanResume && u.LastSuccessfulChunk >= 0 && u.UploadURL != ""
 }
 
-// getResumeOffset returns the byte offset from which to resume the upload
+// getResumeOffset returns the byte offset from which to resume the upload.
+// Chunk sizes vary, so the uploaded byte count is used when it is known;
+// sessions persisted without one used fixed uploadChunkSize chunks.
 func (u *UploadSession) getResumeOffset() uint64 {
 	u.Lock()
 	defer u.Unlock()
 	if u.LastSuccessfulChunk < 0 {
 		return 0
 	}
+	if u.BytesUploaded > 0 {
+		return u.BytesUploaded
+	}
 	return uint64(u.LastSuccessfulChunk+1) * uploadChunkSize
 }
 
@@ -294,7 +394,19 @@ func NewUploadSessionWithPath(inode *Inode, contentPath string) (*UploadSession,
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to stat content file")
 	}
+	size := uint64(fileInfo.Size())
+
+	// Reuse the hash computed while the file was written when it covers the
+	// whole file, otherwise hash the file as a stream.
+	inode.mu.RLock()
+	writtenHash, _ := inode.writtenHashLocked(size)
+	inode.mu.RUnlock()
+	return newStreamingUploadSession(inode, contentPath, size, writtenHash)
+}
 
+// newStreamingUploadSession creates an upload session streaming size bytes
+// from contentPath. An empty hash is computed from the file.
+func newStreamingUploadSession(inode *Inode, contentPath string, size uint64, hash string) (*UploadSession, error) {
 	// create a generic session for all files
 	inode.mu.RLock()
 
@@ -314,6 +426,7 @@ func NewUploadSessionWithPath(inode *Inode, contentPath string) (*UploadSession,
 		Name:        inode.DriveItem.Name,
 		ContentPath: contentPath,
 		ModTime:     modTime,
+		Size:        size,
 
 		// Initialize recovery fields
 		LastSuccessfulChunk: -1,
@@ -325,21 +438,16 @@ func NewUploadSessionWithPath(inode *Inode, contentPath string) (*UploadSession,
 	}
 	inode.mu.RUnlock()
 
-	// Use the file size from disk
-	session.Size = uint64(fileInfo.Size())
-
-	// Calculate hash by reading the file
-	file, err := os.Open(contentPath)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to open content file for hashing")
-	}
-	defer file.Close()
-
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to read content file for hashing")
+	if hash != "" {
+		session.QuickXORHash = hash
+	} else {
+		file, err := os.Open(contentPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open content file for hashing")
+		}
+		session.QuickXORHash = graph.QuickXORHashStream(file)
+		file.Close()
 	}
-	session.QuickXORHash = graph.QuickXORHash(&data)
 
 	logging.Info().
 		Str("id", session.ID).
@@ -371,29 +479,30 @@ func (u *UploadSession) cancel(auth *graph.Auth) {
 // to make things this way because the internal Put func doesn't work all that
 // well when we need to add custom headers. Will return without an error if
 // irrespective of HTTP status (errors are reserved for stuff that prevented
-// the HTTP request at all).
+// the HTTP request at all). Also returns the request-id the server gave the
+// chunk request, if any.
 //
 // This method supports both in-memory (Data []byte) and streaming (ContentPath) uploads.
-func (u *UploadSession) uploadChunk(auth *graph.Auth, offset uint64) ([]byte, int, error) {
+func (u *UploadSession) uploadChunk(ctx context.Context, auth *graph.Auth, offset, chunkSize uint64) ([]byte, int, string, error) {
 	u.Lock()
 	uploadURL := u.UploadURL
 	if uploadURL == "" {
 		u.Unlock()
-		return nil, -1, errors.NewValidationError("UploadSession UploadURL cannot be empty", nil)
+		return nil, -1, "", errors.NewValidationError("UploadSession UploadURL cannot be empty", nil)
 	}
 	contentPath := u.ContentPath
 	hasData := u.Data != nil && len(u.Data) > 0
 	u.Unlock()
 
 	// how much of the file are we going to upload?
-	end := offset + uploadChunkSize
+	end := offset + chunkSize
 	var reqChunkSize uint64
 	if end > u.Size {
 		end = u.Size
 		reqChunkSize = end - offset + 1
 	}
 	if offset > u.Size {
-		return nil, -1, errors.NewValidationError("offset cannot be larger than DriveItem size", nil)
+		return nil, -1, "", errors.NewValidationError("offset cannot be larger than DriveItem size", nil)
 	}
 
 	auth.Refresh(nil) // nil context will use context.Background() internally
@@ -407,24 +516,24 @@ func (u *UploadSession) uploadChunk(auth *graph.Auth, offset uint64) ([]byte, in
 		// Stream from disk for large files
 		file, err := os.Open(contentPath)
 		if err != nil {
-			return nil, -1, errors.Wrap(err, "failed to open content file for upload")
+			return nil, -1, "", errors.Wrap(err, "failed to open content file for upload")
 		}
 		defer file.Close()
 
 		// Seek to the offset
 		if _, err := file.Seek(int64(offset), 0); err != nil {
-			return nil, -1, errors.Wrap(err, "failed to seek in content file")
+			return nil, -1, "", errors.Wrap(err, "failed to seek in content file")
 		}
 
 		// Read only the chunk we need
 		chunkData := make([]byte, end-offset)
 		n, err := io.ReadFull(file, chunkData)
 		if err != nil && err != io.ErrUnexpectedEOF {
-			return nil, -1, errors.Wrap(err, "failed to read chunk from content file")
+			return nil, -1, "", errors.Wrap(err, "failed to read chunk from content file")
 		}
 		chunkReader = bytes.NewReader(chunkData[:n])
 	} else {
-		return nil, -1, errors.NewValidationError("upload session has neither Data nor ContentPath", nil)
+		return nil, -1, "", errors.NewValidationError("upload session has neither Data nor ContentPath", nil)
 	}
 
 	// Use the configured HTTP client (which may be a mock client for testing)
@@ -439,15 +548,26 @@ func (u *UploadSession) uploadChunk(auth *graph.Auth, offset uint64) ([]byte, in
 	frags := fmt.Sprintf("bytes %d-%d/%d", offset, end-1, u.Size)
 	logging.Info().Str("id", u.ID).Msg("Uploading " + frags)
 	request.Header.Add("Content-Range", frags)
+	graph.SetClientRequestID(ctx, request)
 
+	graph.ObserveRequest(auth, request.Method, uploadURL)
 	resp, err := client.Do(request)
 	if err != nil {
 		// this is a serious error, not simply one with a non-200 return code
-		return nil, -1, err
+		return nil, -1, "", err
 	}
 	defer resp.Body.Close()
 	response, _ := io.ReadAll(resp.Body)
-	return response, resp.StatusCode, nil
+	return response, resp.StatusCode, graph.ServerRequestID(resp), nil
+}
+
+// chunkError is the error a chunk upload is judged by: the request error, or
+// the server failing it.
+func chunkError(err error, status int) error {
+	if err == nil && status >= 500 {
+		return fmt.Errorf("HTTP %d", status)
+	}
+	return err
 }
 
 // Upload copies the file's contents to the server. Should only be called as a
@@ -459,7 +579,16 @@ func (u *UploadSession) Upload(auth *graph.Auth) error {
 
 // UploadWithContext uploads with context support and optional database for persistence
 func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth, db *bolt.DB) error {
-	logging.Info().Str("id", u.ID).Str("name", u.Name).Msg("Uploading file.")
+	correlationID := u.correlationID()
+	ctx = logging.WithCorrelationID(ctx, correlationID)
+	logging.Info().
+		Str("id", u.ID).
+		Str("name", u.Name).
+		Str(logging.FieldCorrelationID, correlationID).
+		Msg("Uploading file.")
+	u.Lock()
+	u.unconfirmed = false
+	u.Unlock()
 	u.setState(uploadStarted, nil)
 
 	// Check for context cancellation before starting upload
@@ -527,7 +656,7 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 					Msg("Small file upload cancelled by context")
 				return u.setState(uploadErrored, errors.New("upload cancelled by context"))
 			}
-			if strings.Contains(err.Error(), "resourceModified") {
+			if errors.Code(err) == "resourceModified" {
 				// retry the request after a second, likely the server is having issues
 				time.Sleep(time.Second)
 
@@ -592,7 +721,7 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 					LastModifiedDateTime: u.ModTime,
 				},
 			})
-			resp, err := graph.Post(uploadPath, auth, bytes.NewReader(sessionPostData))
+			resp, err := graph.PostWithContext(ctx, uploadPath, auth, bytes.NewReader(sessionPostData))
 			if err != nil {
 				return u.setState(uploadErrored, errors.Wrap(err, "failed to create upload session"))
 			}
@@ -616,16 +745,20 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 
 		// api upload session created successfully, now do actual content upload
 		var status int
+		var serverRequestID string
 		var err error
-		nchunks := int(math.Ceil(float64(u.Size) / float64(uploadChunkSize)))
+		chunks := u.chunkSizer()
+		nchunks := int(math.Ceil(float64(u.Size) / float64(chunks.NextChunkSize())))
 
-		// Start from the next chunk after the last successful one
-		startChunk := 0
+		// Start after the last successful chunk
+		var offset uint64
+		i := 0
 		if u.canResumeUpload() {
-			startChunk = u.LastSuccessfulChunk + 1
+			offset = u.getResumeOffset()
+			i = u.LastSuccessfulChunk + 1
 		}
 
-		for i := startChunk; i < nchunks; i++ {
+		for ; offset < u.Size; i++ {
 			// Check for context cancellation before each chunk
 			select {
 			case <-ctx.Done():
@@ -645,8 +778,15 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 				// Continue with upload
 			}
 
-			// Attempt chunk upload with retry logic for both errors and 5xx status codes
-			resp, status, err = u.uploadChunk(auth, uint64(i)*uploadChunkSize)
+			// Attempt chunk upload with retry logic for both errors and 5xx status codes.
+			// The chunk size is chosen once per chunk so retries resend the same range.
+			chunkSize := chunks.NextChunkSize()
+			if remaining := u.Size - offset; chunkSize > remaining {
+				chunkSize = remaining
+			}
+			began := time.Now()
+			resp, status, serverRequestID, err = u.uploadChunk(ctx, auth, offset, chunkSize)
+			chunks.ObserveChunk(chunkSize, time.Since(began), chunkError(err, status))
 
 			// Retry both errors and server-side failures (5xx) with exponential back-off strategy
 			// Will not exit this loop unless it receives a non-5xx status or exceeds max retries
@@ -676,6 +816,7 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 						Str("name", u.Name).
 						Int("chunk", i).
 						Int("nchunks", nchunks).
+						Str(logging.FieldCorrelationID, correlationID).
 						Int("retryAttempt", retryAttempt).
 						Int("maxRetries", maxChunkRetries).
 						Err(err).
@@ -687,13 +828,17 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 						Int("chunk", i).
 						Int("nchunks", nchunks).
 						Int("status", status).
+						Str(logging.FieldCorrelationID, correlationID).
+						Str(logging.FieldServerRequestID, serverRequestID).
 						Int("retryAttempt", retryAttempt).
 						Int("maxRetries", maxChunkRetries).
 						Msgf("The OneDrive server is having issues, retrying chunk upload in %ds.", backoff)
 				}
 
 				time.Sleep(time.Duration(backoff) * time.Second)
-				resp, status, err = u.uploadChunk(auth, uint64(i)*uploadChunkSize)
+				began = time.Now()
+				resp, status, serverRequestID, err = u.uploadChunk(ctx, auth, offset, chunkSize)
+				chunks.ObserveChunk(chunkSize, time.Since(began), chunkError(err, status))
 			}
 
 			// If we still have an error after all retries, fail the upload
@@ -703,10 +848,8 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 
 			// Update progress after successful chunk upload
 			if status < 400 {
-				bytesUploaded := uint64(i+1) * uploadChunkSize
-				if bytesUploaded > u.Size {
-					bytesUploaded = u.Size
-				}
+				offset += chunkSize
+				bytesUploaded := offset
 				u.updateProgress(i, bytesUploaded)
 
 				// Persist progress every 10 chunks or for large files
@@ -729,13 +872,15 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 
 			// handle client-side errors
 			if status >= 400 {
-				return u.setState(uploadErrored, errors.NewOperationError(fmt.Sprintf("error uploading chunk - HTTP %d: %s", status, string(resp)), nil))
+				return u.setState(uploadErrored, errors.Wrap(graph.ResponseError(status, resp,
+					graph.RequestIDs(correlationID, serverRequestID)), "error uploading chunk"))
 			}
 		}
 	}
 
 	// server has indicated that the upload was successful - now we check to verify the
 	// checksum is what it's supposed to be.
+	u.startVerifying()
 	remote := graph.DriveItem{}
 	if err := json.Unmarshal(resp, &remote); err != nil {
 		if len(resp) == 0 {
@@ -750,11 +895,10 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 			if err == nil {
 				remote = *remotePtr
 			} else {
-				return u.setState(uploadErrored,
-					errors.Wrap(err, "failed to get item post-upload"))
+				return u.verificationFailed(errors.Wrap(err, "failed to get item post-upload"))
 			}
 		} else {
-			return u.setState(uploadErrored,
+			return u.verificationFailed(
 				errors.Wrap(err, fmt.Sprintf("could not unmarshal response: %s", string(resp))),
 			)
 		}
@@ -762,9 +906,9 @@ func (u *UploadSession) UploadWithContext(ctx context.Context, auth *graph.Auth,
 	if remote.File == nil && remote.Size != u.Size {
 		// if we are absolutely pounding the microsoft API, a remote item may sometimes
 		// come back without checksums, so we check the size of the uploaded item instead.
-		return u.setState(uploadErrored, errors.NewValidationError("size mismatch when remote checksums did not exist", nil))
+		return u.verificationFailed(errors.NewValidationError("size mismatch when remote checksums did not exist", ErrChecksumMismatch))
 	} else if !remote.VerifyChecksum(u.QuickXORHash) {
-		return u.setState(uploadErrored, errors.NewValidationError("remote checksum did not match", nil))
+		return u.verificationFailed(errors.NewValidationError("remote checksum did not match", ErrChecksumMismatch))
 	}
 	// update the UploadSession's ID, ETag, and Size in the event that we exchange a local for a remote ID
 	u.Lock()
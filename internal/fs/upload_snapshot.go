@@ -0,0 +1,192 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Large files are uploaded by streaming their cached content, which the
+// application can keep writing to while the upload runs, so the chunks could
+// come from different versions of the file. Instead the upload streams a
+// snapshot of the content taken when it is queued: a reflink where the cache
+// filesystem supports it, a copy otherwise. Edits made while an upload runs
+// are not lost to it either. They are recorded as the next revision, the item
+// stays DIRTY_LOCAL when the upload completes, and the new content is
+// uploaded after it. Every uploaded version is thus a version the file had.
+
+// uploadSnapshotDir is the directory beside the content cache holding the
+// snapshots of uploads in progress.
+const uploadSnapshotDir = "upload-snapshots"
+
+// ficlone is the FICLONE ioctl, sharing the extents of one file with another
+// on filesystems with reflinks such as btrfs and XFS.
+const ficlone = 0x40049409
+
+// uploadSnapshotsPath returns the directory holding upload snapshots.
+func (f *Filesystem) uploadSnapshotsPath() string {
+	return filepath.Join(filepath.Dir(f.content.directory), uploadSnapshotDir)
+}
+
+// snapshotUploadContent snapshots the cached content of inode for an upload
+// and returns the path of the snapshot, its size and its QuickXorHash when
+// known from the writes.
+func (f *Filesystem) snapshotUploadContent(inode *Inode) (string, uint64, string, error) {
+	dir := f.uploadSnapshotsPath()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, "", errors.Wrap(err, "failed to create upload snapshot directory")
+	}
+
+	// Writes hold the inode lock, so the content does not change while copied
+	inode.mu.Lock()
+	defer inode.mu.Unlock()
+	if status := f.flushWritesLocked(inode.nodeID); status != fuse.OK {
+		return "", 0, "", errors.New("failed to write buffered data to the cache before the upload snapshot")
+	}
+	src, err := os.Open(f.content.contentPath(inode.DriveItem.ID))
+	if err != nil {
+		return "", 0, "", errors.Wrap(err, "failed to open content for upload snapshot")
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp(dir, inode.DriveItem.ID+".*")
+	if err != nil {
+		return "", 0, "", errors.Wrap(err, "failed to create upload snapshot")
+	}
+	if err := cloneFile(dst, src); err != nil {
+		dst.Close()
+		_ = os.Remove(dst.Name())
+		return "", 0, "", errors.Wrap(err, "failed to snapshot content for upload")
+	}
+	info, err := dst.Stat()
+	if err == nil {
+		err = dst.Close()
+	} else {
+		dst.Close()
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return "", 0, "", err
+	}
+	size := uint64(info.Size())
+	hash, _ := inode.writtenHashLocked(size)
+	return dst.Name(), size, hash, nil
+}
+
+// cloneFile gives dst the content of src, as a reflink when the filesystem
+// supports one and as a copy otherwise.
+func cloneFile(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno == 0 {
+		return nil
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return dst.Sync()
+}
+
+// isUploadSnapshot reports whether path is an upload snapshot.
+func isUploadSnapshot(path string) bool {
+	return path != "" && filepath.Base(filepath.Dir(path)) == uploadSnapshotDir
+}
+
+// releaseUploadSnapshot removes the snapshot streamed by session, if any.
+func releaseUploadSnapshot(session *UploadSession) {
+	if !isUploadSnapshot(session.ContentPath) {
+		return
+	}
+	if err := os.Remove(session.ContentPath); err != nil && !os.IsNotExist(err) {
+		logging.Warn().Err(err).Str("id", session.ID).Str("path", session.ContentPath).
+			Msg("Could not remove upload snapshot")
+	}
+}
+
+// pruneUploadSnapshots removes the snapshots no restored upload session
+// streams from, such as those of uploads dropped before they started.
+func (u *UploadManager) pruneUploadSnapshots() {
+	fsImpl, ok := u.filesystem()
+	if !ok || fsImpl.content == nil {
+		return
+	}
+	entries, err := os.ReadDir(fsImpl.uploadSnapshotsPath())
+	if err != nil {
+		return
+	}
+	inUse := map[string]bool{}
+	for _, session := range u.sessions {
+		inUse[filepath.Base(session.ContentPath)] = true
+	}
+	for _, entry := range entries {
+		if inUse[entry.Name()] {
+			continue
+		}
+		_ = os.Remove(filepath.Join(fsImpl.uploadSnapshotsPath(), entry.Name()))
+	}
+}
+
+// noteRevision records edits to the item with the given ID made after the
+// content of its queued or running upload was taken. They are uploaded with
+// the given priority once that upload completes.
+func (u *UploadManager) noteRevision(id string, priority UploadPriority) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if current, ok := u.revisions[id]; !ok || current < priority {
+		u.revisions[id] = priority
+	}
+}
+
+// takeRevision returns and forgets the revision recorded for the item.
+func (u *UploadManager) takeRevision(id string) (UploadPriority, bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	priority, ok := u.revisions[id]
+	delete(u.revisions, id)
+	return priority, ok
+}
+
+// supersededUpload reports whether the item of the completed session has
+// edits newer than the uploaded content, recorded or already queued.
+func (u *UploadManager) supersededUpload(session *UploadSession) bool {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	for _, id := range []string{session.OldID, session.ID} {
+		if _, ok := u.revisions[id]; ok {
+			return true
+		}
+		if other, ok := u.sessions[id]; ok && other != session {
+			return true
+		}
+		if u.pendingHighPriorityUploads[id] || u.pendingLowPriorityUploads[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadRevision queues the revision recorded while session was uploading.
+func (u *UploadManager) uploadRevision(session *UploadSession) {
+	priority, ok := u.takeRevision(session.OldID)
+	if !ok {
+		return
+	}
+	inode := u.fs.GetID(session.ID)
+	if inode == nil {
+		return
+	}
+	if fsImpl, ok := u.filesystem(); ok && fsImpl.holdUpload(inode) {
+		logging.Info().Str("id", session.ID).Str("name", session.Name).
+			Msg("File changed while uploading, the new revision waits for its upload hold")
+		return
+	}
+	logging.Info().Str("id", session.ID).Str("name", session.Name).
+		Msg("File changed while uploading, uploading the new revision")
+	if _, err := u.QueueUploadWithPriority(inode, priority); err != nil {
+		logging.Error().Err(err).Str("id", session.ID).Msg("Could not queue the next revision for upload")
+		u.fs.MarkFileError(session.ID, err)
+	}
+}
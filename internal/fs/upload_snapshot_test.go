@@ -0,0 +1,100 @@
+package fs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/metadata"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_UploadSnapshot_KeepsContentOfQueueTime(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "version one")
+
+	path, size, _, err := fs.snapshotUploadContent(file)
+	require.NoError(t, err)
+	require.True(t, isUploadSnapshot(path))
+	require.Equal(t, uint64(len("version one")), size)
+
+	require.NoError(t, fs.content.Insert(file.ID(), []byte("version two, longer")))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "version one", string(data), "writes after the snapshot do not reach the upload")
+
+	session, err := newStreamingUploadSession(file, path, size, "")
+	require.NoError(t, err)
+	v1 := []byte("version one")
+	require.Equal(t, graph.QuickXORHash(&v1), session.QuickXORHash, "the hash covers the snapshot")
+
+	releaseUploadSnapshot(session)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+	releaseUploadSnapshot(&UploadSession{ContentPath: fs.content.contentPath(file.ID())})
+	require.True(t, fs.content.HasContent(file.ID()), "only snapshots are released")
+}
+
+func TestUT_FS_UploadSnapshot_IncludesBufferedWrites(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "version one")
+	writeAt(t, fs, file, 7, file.Size(), ", appended")
+	require.Equal(t, "version one", string(fs.content.Get(file.ID())), "the write is buffered")
+
+	path, size, _, err := fs.snapshotUploadContent(file)
+	require.NoError(t, err)
+	defer os.Remove(path)
+	require.Equal(t, uint64(len("version one, appended")), size)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "version one, appended", string(data))
+}
+
+func TestUT_FS_UploadSnapshot_EditsDuringUploadAreNextRevision(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "version one")
+	fs.uploads.fs = fs
+	fs.uploads.db = fs.db
+	fs.uploads.lowPriorityQueue = make(chan *UploadSession, 1)
+	v1, v2 := []byte("version one"), []byte("version two")
+
+	running := &UploadSession{ID: file.ID(), OldID: file.ID(), QuickXORHash: graph.QuickXORHash(&v1)}
+	fs.uploads.sessions[file.ID()] = running
+	file.DriveItem.File.Hashes.QuickXorHash = graph.QuickXORHash(&v1)
+
+	session, err := fs.uploads.QueueUpload(file)
+	require.NoError(t, err)
+	require.Same(t, running, session)
+	require.False(t, fs.uploads.supersededUpload(running), "flushing unchanged content uploads nothing new")
+
+	require.NoError(t, fs.content.Insert(file.ID(), v2))
+	file.DriveItem.File.Hashes.QuickXorHash = graph.QuickXORHash(&v2)
+	_, err = fs.uploads.QueueUpload(file)
+	require.NoError(t, err)
+	require.True(t, fs.uploads.supersededUpload(running))
+
+	fs.uploads.finishUpload(file.ID())
+	fs.uploads.uploadRevision(running)
+	next := <-fs.uploads.lowPriorityQueue
+	require.NotSame(t, running, next)
+	require.Equal(t, "version two", string(next.Data), "the next revision has the new content")
+	require.True(t, fs.uploads.supersededUpload(running), "the queued revision keeps the item dirty")
+
+	entry, err := fs.GetMetadataEntry(file.ID())
+	require.NoError(t, err)
+	require.Equal(t, metadata.ItemStateDirtyLocal, entry.State)
+}
+
+func TestUT_FS_UploadSnapshot_NextRevisionRespectsUploadHolds(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "version one")
+	fs.uploads.fs = fs
+	fs.uploads.db = fs.db
+	fs.uploads.lowPriorityQueue = make(chan *UploadSession, 1)
+	running := &UploadSession{ID: file.ID(), OldID: file.ID()}
+	fs.uploads.sessions[file.ID()] = running
+	fs.uploads.revisions[file.ID()] = PriorityLow
+
+	fs.SetMeteredUploadThreshold(1)
+	fs.pollMetered(func() (bool, error) { return true, nil })
+	fs.uploads.finishUpload(file.ID())
+	fs.uploads.uploadRevision(running)
+	require.Empty(t, fs.uploads.lowPriorityQueue, "the next revision waits for an unmetered connection")
+	require.Equal(t, DeferredMetered, fs.UploadDeferral(file.ID()))
+}
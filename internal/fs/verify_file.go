@@ -0,0 +1,228 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Reads are served from the cache once a file is downloaded, so a cached copy
+// that went bad on disk is never noticed. Verifying a file downloads it again
+// beside the cache and compares the two byte for byte. The cached copy is
+// left alone when they match and replaced by the download when they do not.
+// Verification runs as a JobCacheVerify job, through "onemount verify-file
+// <path>", or by setting the user.onemount.verify xattr and reading it back
+// for the result:
+//
+//	setfattr -n user.onemount.verify -v 1 file && getfattr -n user.onemount.verify file
+//
+// The xattr is not listed, so copying xattrs does not start downloads.
+
+const xattrVerify = "user.onemount.verify"
+
+// ActivityCacheMismatch reports a cached file that differed from OneDrive and
+// was replaced by the content on OneDrive.
+const ActivityCacheMismatch = "cache-mismatch"
+
+var (
+	// ErrVerifyNotCached is returned when verifying a file without cached
+	// content.
+	ErrVerifyNotCached = errors.New("the file is not downloaded, there is nothing to verify")
+	// ErrVerifyLocalChanges is returned when verifying a file with local
+	// changes that are not uploaded yet.
+	ErrVerifyLocalChanges = errors.New("the file has local changes that are not uploaded yet")
+)
+
+// FileVerification is the result of verifying a cached file.
+type FileVerification struct {
+	ID       string
+	Path     string
+	Match    bool
+	Problem  string // how the cached copy differed
+	Repaired bool   // the cached copy was replaced by the content on OneDrive
+}
+
+// String returns the value of the user.onemount.verify xattr for v.
+func (v FileVerification) String() string {
+	switch {
+	case v.Match:
+		return "match"
+	case v.Repaired:
+		return "repaired: " + v.Problem
+	default:
+		return "mismatch: " + v.Problem
+	}
+}
+
+// VerifyFile downloads the file at path again and compares it with its
+// cached copy.
+func (f *Filesystem) VerifyFile(ctx context.Context, path string) (FileVerification, error) {
+	id := f.GetIDByPath(path)
+	if id == "" {
+		return FileVerification{}, errors.NewNotFoundError("path not found: "+path, nil)
+	}
+	return f.verifyFileWith(ctx, id, graphItemRemote{ctx: ctx, auth: f.auth})
+}
+
+// verifyFileWith verifies the file with the given ID as a JobCacheVerify
+// job.
+func (f *Filesystem) verifyFileWith(ctx context.Context, id string, remote itemRemote) (FileVerification, error) {
+	result := FileVerification{ID: id}
+	inode := f.GetID(id)
+	if inode == nil {
+		return result, errors.NewNotFoundError("item not found", nil)
+	}
+	result.Path = inode.Path()
+	err := f.runJob(ctx, JobCacheVerify, result.Path, func(ctx context.Context, job *Job) error {
+		size := inode.Size()
+		job.AddTotal(1, size)
+		var err error
+		if result, err = f.verifyCachedFile(ctx, inode, result, remote); err == nil {
+			job.Advance(1, size)
+		}
+		return err
+	})
+	return result, err
+}
+
+func (f *Filesystem) verifyCachedFile(ctx context.Context, inode *Inode, result FileVerification, remote itemRemote) (FileVerification, error) {
+	id := result.ID
+	switch {
+	case inode.IsDir():
+		return result, errors.NewValidationError("not a file: "+result.Path, nil)
+	case isLocalID(id):
+		return result, ErrVerifyLocalChanges
+	case f.IsOffline():
+		return result, errors.NewNetworkError("cannot verify files while offline", nil)
+	case inode.HasChanges():
+		return result, ErrVerifyLocalChanges
+	case !f.content.HasContent(id):
+		return result, ErrVerifyNotCached
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.content.directory), ".verify-*")
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if err := remote.Download(id, tmp); err != nil {
+		return result, errors.Wrap(err, "failed to download the file")
+	}
+
+	cached, err := f.content.Open(id)
+	if err != nil {
+		return result, err
+	}
+	cachedSize, cachedSum, err := hashContent(cached)
+	if err != nil {
+		return result, err
+	}
+	remoteSize, remoteSum, err := hashContent(tmp)
+	if err != nil {
+		return result, err
+	}
+	switch {
+	case cachedSize != remoteSize:
+		result.Problem = fmt.Sprintf("OneDrive has %d bytes, the cached copy %d", remoteSize, cachedSize)
+	case !bytes.Equal(cachedSum, remoteSum):
+		result.Problem = "the cached copy differs from the content on OneDrive"
+	default:
+		result.Match = true
+		logging.Info().Str("id", id).Str("path", result.Path).Msg("Cached copy matches OneDrive")
+		return result, nil
+	}
+
+	logging.Warn().Str("id", id).Str("path", result.Path).Str("problem", result.Problem).
+		Msg("Cached copy differs from OneDrive, replacing it")
+	f.emitActivity(ActivityCacheMismatch, id, result.Problem)
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return result, err
+	}
+	item, itemErr := remote.GetItem(id)
+
+	// Writes hold the inode lock, so none gets in between the last check and
+	// the swap
+	inode.mu.Lock()
+	if inode.hasChanges {
+		inode.mu.Unlock()
+		// Written to while downloading; the upload replaces the remote copy.
+		return result, nil
+	}
+	if err := f.content.Delete(id); err != nil {
+		inode.mu.Unlock()
+		return result, err
+	}
+	if _, err := f.content.InsertStream(id, tmp); err != nil {
+		_ = f.content.Delete(id)
+		inode.mu.Unlock()
+		f.markContentEvicted(id)
+		return result, errors.Wrap(err, "failed to replace the cached copy")
+	}
+	if itemErr == nil {
+		inode.DriveItem = *item
+	}
+	inode.mu.Unlock()
+	if itemErr == nil {
+		f.persistMetadataEntry(id, inode)
+	}
+	result.Repaired = true
+	return result, nil
+}
+
+// hashContent returns the size and SHA-256 of the content of fd, read from
+// its start.
+func hashContent(fd *os.File) (int64, []byte, error) {
+	sum := sha256.New()
+	n, err := io.Copy(sum, io.NewSectionReader(fd, 0, 1<<62))
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, sum.Sum(nil), nil
+}
+
+// verifyXAttr verifies the file with the given ID for a write to the
+// user.onemount.verify xattr and keeps the result for reading it back.
+func (f *Filesystem) verifyXAttr(id string) fuse.Status {
+	ctx := f.jobContext()
+	result, err := f.verifyFileWith(ctx, id, graphItemRemote{ctx: ctx, auth: f.auth})
+	if err != nil {
+		f.verifications.Store(id, "failed: "+err.Error())
+	} else {
+		f.verifications.Store(id, result.String())
+	}
+	switch {
+	case err == nil:
+		return fuse.OK
+	case errors.Is(err, ErrVerifyNotCached), errors.Is(err, ErrVerifyLocalChanges),
+		errors.IsValidationError(err):
+		return fuse.EINVAL
+	case errors.IsNetworkError(err):
+		return fuse.Status(syscall.EAGAIN)
+	default:
+		return fuse.EIO
+	}
+}
+
+// verificationXAttr returns the result of the last verification of the file
+// with the given ID, or nil.
+func (f *Filesystem) verificationXAttr(id string) []byte {
+	if result, ok := f.verifications.Load(id); ok {
+		return []byte(result.(string))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// remoteContent is a remote copy of the upload audit test file serving
+// content.
+func remoteContent(content string) *fakeRemote {
+	remote := remoteCopy("etag-1", content)
+	remote.content = content
+	return remote
+}
+
+func TestUT_FS_VerifyFile_MatchLeavesCacheAlone(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+	before, err := os.Stat(fs.content.contentPath(file.ID()))
+	require.NoError(t, err)
+
+	result, err := fs.verifyFileWith(context.Background(), file.ID(), remoteContent("quarterly numbers"))
+	require.NoError(t, err)
+	require.True(t, result.Match)
+	require.False(t, result.Repaired)
+	require.Equal(t, "match", result.String())
+	jobs := fs.Jobs()
+	require.Len(t, jobs, 1)
+	require.Equal(t, JobCacheVerify, jobs[0].Kind)
+	require.Equal(t, JobCompleted, jobs[0].State)
+	require.Equal(t, uint64(1), jobs[0].Done)
+
+	after, err := os.Stat(fs.content.contentPath(file.ID()))
+	require.NoError(t, err)
+	require.Equal(t, before.ModTime(), after.ModTime(), "the cached copy is not rewritten")
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(fs.content.directory), ".verify-*"))
+	require.Empty(t, leftovers, "the download is removed")
+}
+
+func TestUT_FS_VerifyFile_MismatchReplacesCachedCopy(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+
+	result, err := fs.verifyFileWith(context.Background(), file.ID(), remoteContent("quarterly NUMBERS"))
+	require.NoError(t, err)
+	require.False(t, result.Match)
+	require.True(t, result.Repaired)
+	require.Contains(t, result.Problem, "differs")
+	require.Equal(t, "quarterly NUMBERS", string(fs.content.Get(file.ID())))
+
+	result, err = fs.verifyFileWith(context.Background(), file.ID(), remoteContent("short"))
+	require.NoError(t, err)
+	require.Contains(t, result.Problem, "bytes")
+	require.Equal(t, "short", string(fs.content.Get(file.ID())))
+	require.Equal(t, "repaired: "+result.Problem, result.String())
+}
+
+func TestUT_FS_VerifyFile_RefusesWhatCannotBeCompared(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+
+	failing := remoteContent("quarterly numbers")
+	failing.err = errors.New("connection reset")
+	_, err := fs.verifyFileWith(context.Background(), file.ID(), failing)
+	require.Error(t, err)
+	require.Equal(t, "quarterly numbers", string(fs.content.Get(file.ID())), "a failed download changes nothing")
+
+	file.mu.Lock()
+	file.hasChanges = true
+	file.mu.Unlock()
+	_, err = fs.verifyFileWith(context.Background(), file.ID(), remoteContent("other"))
+	require.ErrorIs(t, err, ErrVerifyLocalChanges)
+	require.Equal(t, "quarterly numbers", string(fs.content.Get(file.ID())))
+
+	file.mu.Lock()
+	file.hasChanges = false
+	file.mu.Unlock()
+	require.NoError(t, fs.content.Delete(file.ID()))
+	_, err = fs.verifyFileWith(context.Background(), file.ID(), remoteContent("other"))
+	require.ErrorIs(t, err, ErrVerifyNotCached)
+}
+
+// writtenWhileDownloading is a remote whose downloads are overtaken by a
+// local write to the file.
+type writtenWhileDownloading struct {
+	*fakeRemote
+	fs   *Filesystem
+	file *Inode
+}
+
+func (r writtenWhileDownloading) Download(id string, w io.Writer) error {
+	if err := r.fakeRemote.Download(id, w); err != nil {
+		return err
+	}
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+	fd, err := r.fs.content.Open(id)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.WriteAt([]byte("Q"), 0); err != nil {
+		return err
+	}
+	r.file.hasChanges = true
+	return nil
+}
+
+func TestUT_FS_VerifyFile_KeepsWritesMadeWhileDownloading(t *testing.T) {
+	fs, file := newUploadAuditTestFile(t, "quarterly numbers")
+	remote := writtenWhileDownloading{fakeRemote: remoteContent("quarterly NUMBERS"), fs: fs, file: file}
+
+	result, err := fs.verifyFileWith(context.Background(), file.ID(), remote)
+	require.NoError(t, err)
+	require.False(t, result.Repaired)
+	require.Equal(t, "Quarterly numbers", string(fs.content.Get(file.ID())), "the write is not replaced")
+}
@@ -0,0 +1,380 @@
+package fs
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// The hydration, metadata and upload worker pools report what their workers
+// do: each worker beats a heartbeat while it waits for work, marks when it
+// starts and finishes a task, and each pool remembers when items entered its
+// queue. The worker watchdog turns a silent hang into an incident: when a
+// pool has work queued but nothing finished for the stall timeout, it logs
+// the pool's workers with their current tasks, dumps every goroutine's stack
+// once, and, when enabled, replaces the workers stuck in a task. A stuck
+// worker that eventually returns exits instead of taking more work.
+
+// DefaultWorkerStallTimeout is how long a pool may have queued work without
+// finishing anything before it is reported stalled.
+const DefaultWorkerStallTimeout = 10 * time.Minute
+
+const (
+	workerWatchdogInterval = 30 * time.Second
+	workerStackDumpLimit   = 8 << 20
+)
+
+// Worker pool names.
+const (
+	poolHydration = "hydration"
+	poolMetadata  = "metadata"
+	poolUpload    = "upload"
+)
+
+// poolWorker is what a pool knows about one worker.
+type poolWorker struct {
+	heartbeat atomic.Int64 // unix nanoseconds
+	busySince time.Time
+	task      string
+	retired   bool
+	respawn   func() // starts a replacement worker, nil when it cannot be replaced
+}
+
+// workerPool instruments one pool of workers. A nil pool records nothing, so
+// managers built without one in tests keep working.
+type workerPool struct {
+	name  string
+	depth func() int // current number of queued items, negative when unknown
+
+	mu           sync.Mutex
+	workers      map[int]*poolWorker
+	nextID       int
+	queued       []time.Time // enqueue times, oldest first
+	lastProgress time.Time
+	completed    uint64
+	stalled      bool
+	restarts     int
+}
+
+func newWorkerPool(name string, depth func() int) *workerPool {
+	return &workerPool{
+		name:         name,
+		depth:        depth,
+		workers:      make(map[int]*poolWorker),
+		lastProgress: time.Now(),
+	}
+}
+
+// add registers a worker and returns its ID. respawn is called to start a
+// replacement when the worker is stuck and the pool is restarted.
+func (p *workerPool) add(respawn func()) int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextID
+	p.nextID++
+	w := &poolWorker{respawn: respawn}
+	w.heartbeat.Store(time.Now().UnixNano())
+	p.workers[id] = w
+	return id
+}
+
+// remove forgets a worker that exited.
+func (p *workerPool) remove(id int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	delete(p.workers, id)
+	p.mu.Unlock()
+}
+
+// beat records that the worker is alive. It is cheap enough for polling loops.
+func (p *workerPool) beat(id int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	w := p.workers[id]
+	p.mu.Unlock()
+	if w != nil {
+		w.heartbeat.Store(time.Now().UnixNano())
+	}
+}
+
+// begin records that the worker started task.
+func (p *workerPool) begin(id int, task string) {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w := p.workers[id]; w != nil {
+		w.heartbeat.Store(now.UnixNano())
+		w.busySince = now
+		w.task = task
+	}
+}
+
+// end records that the worker finished its task. It reports false when the
+// worker was replaced while it was stuck and must exit.
+func (p *workerPool) end(id int) bool {
+	if p == nil {
+		return true
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastProgress = now
+	p.completed++
+	w := p.workers[id]
+	if w == nil {
+		return true
+	}
+	w.heartbeat.Store(now.UnixNano())
+	w.busySince = time.Time{}
+	w.task = ""
+	if w.retired {
+		delete(p.workers, id)
+		return false
+	}
+	return true
+}
+
+// progress records progress not tied to finishing a task, such as bytes of a
+// long upload.
+func (p *workerPool) progress() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.lastProgress = time.Now()
+	p.mu.Unlock()
+}
+
+// enqueued records that an item entered the queue.
+func (p *workerPool) enqueued() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.queued = append(p.queued, time.Now())
+	p.trimQueued()
+	p.mu.Unlock()
+}
+
+// trimQueued drops the enqueue times of items already taken off the queue.
+// Queues are first in, first out, so those are the oldest. p.mu must be held.
+func (p *workerPool) trimQueued() int {
+	depth := -1
+	if p.depth != nil {
+		depth = p.depth()
+	}
+	if depth < 0 {
+		depth = len(p.queued)
+	}
+	if extra := len(p.queued) - depth; extra > 0 {
+		p.queued = append(p.queued[:0], p.queued[extra:]...)
+	}
+	return depth
+}
+
+// WorkerStats describes one worker of a pool.
+type WorkerStats struct {
+	ID        int           `json:"id"`
+	Heartbeat time.Time     `json:"heartbeat"`
+	Task      string        `json:"task,omitempty"`
+	BusyFor   time.Duration `json:"busy_for,omitempty"`
+	Retired   bool          `json:"retired,omitempty"`
+}
+
+// WorkerPoolStats describes a worker pool and its queue.
+type WorkerPoolStats struct {
+	Name          string        `json:"name"`
+	Workers       []WorkerStats `json:"workers"`
+	QueueDepth    int           `json:"queue_depth"`
+	OldestQueued  time.Duration `json:"oldest_queued"`
+	SinceProgress time.Duration `json:"since_progress"`
+	Completed     uint64        `json:"completed"`
+	Stalled       bool          `json:"stalled"`
+	Restarts      int           `json:"restarts"`
+}
+
+func (p *workerPool) snapshot(now time.Time) WorkerPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := WorkerPoolStats{
+		Name:          p.name,
+		Workers:       make([]WorkerStats, 0, len(p.workers)),
+		QueueDepth:    p.trimQueued(),
+		SinceProgress: now.Sub(p.lastProgress),
+		Completed:     p.completed,
+		Stalled:       p.stalled,
+		Restarts:      p.restarts,
+	}
+	if stats.QueueDepth > 0 && len(p.queued) > 0 {
+		stats.OldestQueued = now.Sub(p.queued[0])
+	}
+	for id, w := range p.workers {
+		worker := WorkerStats{
+			ID:        id,
+			Heartbeat: time.Unix(0, w.heartbeat.Load()),
+			Task:      w.task,
+			Retired:   w.retired,
+		}
+		if !w.busySince.IsZero() {
+			worker.BusyFor = now.Sub(w.busySince)
+		}
+		stats.Workers = append(stats.Workers, worker)
+	}
+	sort.Slice(stats.Workers, func(i, j int) bool { return stats.Workers[i].ID < stats.Workers[j].ID })
+	return stats
+}
+
+// check updates whether the pool is stalled: items have waited longer than
+// timeout and nothing finished for as long. It reports whether a new stall
+// began, along with the pool's state.
+func (p *workerPool) check(now time.Time, timeout time.Duration) (bool, WorkerPoolStats) {
+	stats := p.snapshot(now)
+	stalled := stats.QueueDepth > 0 && stats.OldestQueued > timeout && stats.SinceProgress > timeout
+	p.mu.Lock()
+	began := stalled && !p.stalled
+	p.stalled = stalled
+	p.mu.Unlock()
+	stats.Stalled = stalled
+	return began, stats
+}
+
+// restart replaces the workers busy with one task for longer than timeout and
+// reports how many it replaced.
+func (p *workerPool) restart(now time.Time, timeout time.Duration) int {
+	p.mu.Lock()
+	var respawns []func()
+	for _, w := range p.workers {
+		if w.retired || w.respawn == nil || w.busySince.IsZero() || now.Sub(w.busySince) <= timeout {
+			continue
+		}
+		w.retired = true
+		respawns = append(respawns, w.respawn)
+	}
+	if len(respawns) > 0 {
+		p.restarts++
+	}
+	p.mu.Unlock()
+	for _, respawn := range respawns {
+		respawn()
+	}
+	return len(respawns)
+}
+
+// workerPools returns the instrumented pools that are running.
+func (f *Filesystem) workerPools() []*workerPool {
+	var pools []*workerPool
+	if f.downloads != nil && f.downloads.health != nil {
+		pools = append(pools, f.downloads.health)
+	}
+	if f.metadataRequestManager != nil && f.metadataRequestManager.health != nil {
+		pools = append(pools, f.metadataRequestManager.health)
+	}
+	if f.uploads != nil && f.uploads.health != nil {
+		pools = append(pools, f.uploads.health)
+	}
+	return pools
+}
+
+// WorkerPoolStats returns the state of the worker pools.
+func (f *Filesystem) WorkerPoolStats() []WorkerPoolStats {
+	now := time.Now()
+	pools := f.workerPools()
+	stats := make([]WorkerPoolStats, 0, len(pools))
+	for _, pool := range pools {
+		stats = append(stats, pool.snapshot(now))
+	}
+	return stats
+}
+
+// StartWorkerWatchdog checks the worker pools for stalls every half minute.
+// A pool is stalled when queued work waited longer than timeout and nothing
+// finished for as long; restart replaces its stuck workers. Pools are not
+// checked while offline or suspended, when queued work is expected to wait.
+func (f *Filesystem) StartWorkerWatchdog(timeout time.Duration, restart bool) {
+	if timeout <= 0 {
+		timeout = DefaultWorkerStallTimeout
+	}
+	interval := workerWatchdogInterval
+	if timeout < interval {
+		interval = timeout
+	}
+	f.Wg.Add(1)
+	go func() {
+		defer f.Wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-ticker.C:
+				f.checkWorkerPools(time.Now(), timeout, restart)
+			}
+		}
+	}()
+}
+
+// checkWorkerPools reports newly stalled pools and restarts them when asked.
+func (f *Filesystem) checkWorkerPools(now time.Time, timeout time.Duration, restart bool) {
+	if f.IsOffline() || f.Suspended() {
+		return
+	}
+	dumped := false
+	for _, pool := range f.workerPools() {
+		began, stats := pool.check(now, timeout)
+		if !stats.Stalled {
+			continue
+		}
+		if began {
+			event := logging.Error().
+				Str("pool", stats.Name).
+				Int("queueDepth", stats.QueueDepth).
+				Dur("oldestQueued", stats.OldestQueued).
+				Dur("sinceProgress", stats.SinceProgress)
+			for _, w := range stats.Workers {
+				if w.Task != "" {
+					event = event.Str(fmt.Sprintf("worker%d", w.ID), fmt.Sprintf("%s (busy %s)", w.Task, w.BusyFor.Round(time.Second)))
+				}
+			}
+			event.Msg("Worker pool stalled")
+			f.emitActivity(ActivityStall, "", fmt.Sprintf("%s workers made no progress for %s with %d queued",
+				stats.Name, stats.SinceProgress.Round(time.Second), stats.QueueDepth))
+			if !dumped {
+				logging.Error().Str("goroutines", goroutineStacks()).Msg("Goroutine stacks of the stalled mount")
+				dumped = true
+			}
+		}
+		if restart {
+			if n := pool.restart(now, timeout); n > 0 {
+				logging.Warn().Str("pool", stats.Name).Int("workers", n).Msg("Replaced stuck workers")
+			}
+		}
+	}
+}
+
+// goroutineStacks returns the stacks of all goroutines.
+func goroutineStacks() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= workerStackDumpLimit {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,109 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_WorkerHealth_StallNeedsQueuedWorkAndNoProgress(t *testing.T) {
+	queue := make(chan string, 4)
+	pool := newWorkerPool(poolHydration, func() int { return len(queue) })
+	worker := pool.add(nil)
+	timeout := time.Minute
+
+	pool.begin(worker, "download a")
+	queue <- "b"
+	pool.enqueued()
+	pool.queued[0] = time.Now().Add(-2 * timeout)
+	pool.lastProgress = time.Now().Add(-2 * timeout)
+
+	began, stats := pool.check(time.Now(), timeout)
+	require.True(t, began)
+	require.True(t, stats.Stalled)
+	require.Equal(t, 1, stats.QueueDepth)
+	require.Greater(t, stats.OldestQueued, timeout)
+	require.Equal(t, "download a", stats.Workers[0].Task)
+
+	began, stats = pool.check(time.Now(), timeout)
+	require.False(t, began, "a stall is reported once")
+	require.True(t, stats.Stalled)
+
+	pool.end(worker)
+	_, stats = pool.check(time.Now(), timeout)
+	require.False(t, stats.Stalled, "finishing a task is progress")
+
+	<-queue
+	_, stats = pool.check(time.Now().Add(2*timeout), timeout)
+	require.False(t, stats.Stalled, "an idle pool with an empty queue is not stalled")
+	require.Zero(t, stats.QueueDepth)
+}
+
+func TestUT_FS_WorkerHealth_RecentlyQueuedWorkIsNotStalled(t *testing.T) {
+	queue := make(chan string, 4)
+	pool := newWorkerPool(poolMetadata, func() int { return len(queue) })
+	pool.lastProgress = time.Now().Add(-time.Hour)
+
+	queue <- "a"
+	pool.enqueued()
+	_, stats := pool.check(time.Now(), time.Minute)
+	require.False(t, stats.Stalled, "work queued after a quiet hour has not waited yet")
+}
+
+func TestUT_FS_WorkerHealth_RestartReplacesOnlyStuckWorkers(t *testing.T) {
+	pool := newWorkerPool(poolHydration, nil)
+	respawned := 0
+	stuck := pool.add(func() { respawned++ })
+	idle := pool.add(func() { respawned++ })
+	pool.begin(stuck, "download a")
+	timeout := time.Minute
+
+	require.Equal(t, 1, pool.restart(time.Now().Add(2*timeout), timeout))
+	require.Equal(t, 1, respawned)
+	require.Zero(t, pool.restart(time.Now().Add(2*timeout), timeout), "a worker is replaced once")
+
+	require.False(t, pool.end(stuck), "a replaced worker exits when its task returns")
+	require.True(t, pool.end(idle))
+	stats := pool.snapshot(time.Now())
+	require.Len(t, stats.Workers, 1)
+	require.Equal(t, 1, stats.Restarts)
+}
+
+func TestUT_FS_WorkerHealth_WatchdogReportsStalledPool(t *testing.T) {
+	fs := newTestFilesystemWithMetadata(t)
+	queue := make(chan string, 4)
+	fs.downloads = &DownloadManager{queue: queue, health: newWorkerPool(poolHydration, func() int { return len(queue) })}
+	respawned := 0
+	worker := fs.downloads.health.add(func() { respawned++ })
+	fs.downloads.health.begin(worker, "download a")
+	queue <- "b"
+	fs.downloads.health.enqueued()
+
+	later := time.Now().Add(time.Hour)
+	fs.checkWorkerPools(later, time.Minute, false)
+	events := fs.RecentEvents(0)
+	require.Len(t, events, 1)
+	require.Equal(t, ActivityStall, events[0].Type)
+	require.Zero(t, respawned, "restarts are off")
+
+	fs.checkWorkerPools(later, time.Minute, true)
+	require.Len(t, fs.RecentEvents(0), 1, "an ongoing stall is not reported again")
+	require.Equal(t, 1, respawned)
+
+	stats := fs.WorkerPoolStats()
+	require.Len(t, stats, 1)
+	require.Equal(t, poolHydration, stats[0].Name)
+	require.Equal(t, 1, stats[0].Restarts)
+}
+
+func TestUT_FS_WorkerHealth_NilPoolRecordsNothing(t *testing.T) {
+	var pool *workerPool
+	id := pool.add(nil)
+	pool.beat(id)
+	pool.begin(id, "task")
+	pool.enqueued()
+	pool.progress()
+	require.True(t, pool.end(id))
+	pool.remove(id)
+}
@@ -0,0 +1,72 @@
+package fs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func newWriteBufferTestFile(t *testing.T) (*Filesystem, *Inode) {
+	t.Helper()
+	fs := newTestFilesystemWithMetadata(t)
+	file := NewInodeDriveItem(&graph.DriveItem{ID: "log", Name: "app.log", File: &graph.File{}})
+	registerHydratedEntry(t, fs, file)
+	require.NoError(t, fs.content.Insert(file.ID(), nil))
+	return fs, file
+}
+
+func writeAt(t *testing.T, fs *Filesystem, file *Inode, fh, offset uint64, data string) {
+	t.Helper()
+	in := &fuse.WriteIn{InHeader: fuse.InHeader{NodeId: file.NodeID()}, Fh: fh, Offset: offset}
+	n, status := fs.Write(nil, in, []byte(data))
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, uint32(len(data)), n)
+}
+
+func TestUT_FS_WriteBuffer_CoalescesSequentialWrites(t *testing.T) {
+	fs, file := newWriteBufferTestFile(t)
+	var want bytes.Buffer
+	for i := 0; i < 100; i++ {
+		line := "line of log output\n"
+		writeAt(t, fs, file, 7, uint64(want.Len()), line)
+		want.WriteString(line)
+	}
+	require.Empty(t, fs.content.Get(file.ID()), "small sequential writes are buffered")
+	require.Equal(t, uint64(want.Len()), file.Size(), "the size includes buffered writes")
+
+	_, status := fs.Read(nil, &fuse.ReadIn{InHeader: fuse.InHeader{NodeId: file.NodeID()}, Fh: 7, Size: 16}, make([]byte, 16))
+	require.Equal(t, fuse.OK, status)
+	require.Equal(t, want.Bytes(), fs.content.Get(file.ID()), "reads see buffered writes")
+	require.Equal(t, WriteCoalescingStats{CoalescedWrites: 100, Flushes: 1}, fs.WriteCoalescingStats())
+}
+
+func TestUT_FS_WriteBuffer_FlushesBeforeOtherWrites(t *testing.T) {
+	fs, file := newWriteBufferTestFile(t)
+	writeAt(t, fs, file, 7, 0, "hello world")
+	writeAt(t, fs, file, 7, 0, "J") // not sequential
+	require.Equal(t, "hello world", string(fs.content.Get(file.ID())))
+	writeAt(t, fs, file, 8, 1, "ELLO") // another handle
+	require.Equal(t, "Jello world", string(fs.content.Get(file.ID())))
+	writeAt(t, fs, file, 8, 5, string(make([]byte, writeBufferMaxWrite+1))) // too large to buffer
+	require.Len(t, fs.content.Get(file.ID()), 5+writeBufferMaxWrite+1)
+	require.Equal(t, "JELLO", string(fs.content.Get(file.ID())[:5]))
+
+	writeAt(t, fs, file, 7, uint64(file.Size()), "tail")
+	require.Eventually(t, func() bool {
+		data := fs.content.Get(file.ID())
+		return bytes.HasSuffix(data, []byte("tail"))
+	}, 3*writeBufferFlushDelay, 50*time.Millisecond, "buffered writes are flushed after a delay")
+}
+
+func TestUT_FS_WriteBuffer_DeleteDiscardsPendingWrites(t *testing.T) {
+	fs, file := newWriteBufferTestFile(t)
+	writeAt(t, fs, file, 7, 0, "draft")
+	fs.DeleteID(file.ID())
+	<-fs.uploads.deletionQueue // no upload manager loop drains it
+	require.Zero(t, fs.writeBuffers.pendingEnd(file.NodeID()))
+	require.Zero(t, fs.WriteCoalescingStats().Flushes)
+}
@@ -0,0 +1,75 @@
+package fs
+
+import (
+	"encoding/base64"
+	"hash"
+	"io"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/quickxorhash"
+)
+
+// Uploads need the QuickXorHash of the whole file, and re-reading a multi-GB
+// file on fsync and again when the upload session is created delays the
+// upload by as long as reading the file twice. Files are usually written
+// front to back, so the hash is computed while the data is written instead:
+// writeHasher follows writes that append to the file, starting from an empty
+// file. Any other write, a truncate to a size other than the hashed length,
+// or new content from a download drops the running hash, and the file is
+// hashed from disk as before.
+
+// writeHasher is the QuickXorHash of the first length bytes of a file, built
+// from the writes that produced them.
+type writeHasher struct {
+	hash   hash.Hash
+	length uint64
+}
+
+// noteWriteLocked updates the running hash for a write of data at offset to a
+// file that was size bytes long before the write. Callers hold i.mu.
+func (i *Inode) noteWriteLocked(offset, size uint64, data []byte) {
+	if offset == 0 && size == 0 {
+		i.writeHash = &writeHasher{hash: quickxorhash.New()}
+	}
+	if i.writeHash == nil || offset != i.writeHash.length || size != i.writeHash.length {
+		i.writeHash = nil
+		return
+	}
+	_, _ = i.writeHash.hash.Write(data)
+	i.writeHash.length += uint64(len(data))
+}
+
+// noteTruncateLocked updates the running hash after the file was truncated or
+// extended to size. Callers hold i.mu.
+func (i *Inode) noteTruncateLocked(size uint64) {
+	switch {
+	case size == 0:
+		i.writeHash = &writeHasher{hash: quickxorhash.New()}
+	case i.writeHash != nil && size != i.writeHash.length:
+		i.writeHash = nil
+	}
+}
+
+// resetWriteHashLocked drops the running hash after the content was replaced.
+// Callers hold i.mu.
+func (i *Inode) resetWriteHashLocked() {
+	i.writeHash = nil
+}
+
+// writtenHashLocked returns the QuickXorHash of a file of the given size when
+// the running hash covers all of it. Callers hold i.mu.
+func (i *Inode) writtenHashLocked(size uint64) (string, bool) {
+	if i.writeHash == nil || i.writeHash.length != size {
+		return "", false
+	}
+	return base64.StdEncoding.EncodeToString(i.writeHash.hash.Sum(nil)), true
+}
+
+// contentHashLocked returns the QuickXorHash of the file's cached content fd
+// of the given size, from the running hash when possible. Callers hold i.mu.
+func (i *Inode) contentHashLocked(fd io.ReadSeeker, size uint64) string {
+	if sum, ok := i.writtenHashLocked(size); ok {
+		return sum
+	}
+	return graph.QuickXORHashStream(fd)
+}
@@ -0,0 +1,81 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_FS_WriteHash_SequentialWritesMatchKnownVectors(t *testing.T) {
+	vectors := []struct {
+		in, out string
+	}{
+		{"", "AAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+		{"Sg==", "SgAAAAAAAAAAAAAAAQAAAAAAAAA="},
+		{"tbQ=", "taAFAAAAAAAAAAAAAgAAAAAAAAA="},
+		{"0pZP", "0rDEEwAAAAAAAAAAAwAAAAAAAAA="},
+	}
+	for _, vector := range vectors {
+		data, err := base64.StdEncoding.DecodeString(vector.in)
+		require.NoError(t, err)
+
+		inode := NewInode("file", fuse.S_IFREG|0644, nil)
+		inode.noteTruncateLocked(0)
+		for offset := range data {
+			inode.noteWriteLocked(uint64(offset), uint64(offset), data[offset:offset+1])
+		}
+		sum, ok := inode.writtenHashLocked(uint64(len(data)))
+		require.True(t, ok, vector.in)
+		require.Equal(t, vector.out, sum, vector.in)
+	}
+}
+
+func TestUT_FS_WriteHash_FallsBackOnNonSequentialWrites(t *testing.T) {
+	data := bytes.Repeat([]byte("onemount"), 10000)
+	expected := graph.QuickXORHash(&data)
+
+	inode := NewInode("file", fuse.S_IFREG|0644, nil)
+	for offset := 0; offset < len(data); offset += 4096 {
+		end := offset + 4096
+		if end > len(data) {
+			end = len(data)
+		}
+		inode.noteWriteLocked(uint64(offset), uint64(offset), data[offset:end])
+	}
+	sum, ok := inode.writtenHashLocked(uint64(len(data)))
+	require.True(t, ok)
+	require.Equal(t, expected, sum)
+	_, ok = inode.writtenHashLocked(uint64(len(data)) - 1)
+	require.False(t, ok, "a size mismatch is never trusted")
+
+	inode.noteWriteLocked(10, uint64(len(data)), []byte("x"))
+	_, ok = inode.writtenHashLocked(uint64(len(data)))
+	require.False(t, ok, "overwrites drop the running hash")
+	inode.noteWriteLocked(uint64(len(data)), uint64(len(data)), []byte("x"))
+	_, ok = inode.writtenHashLocked(uint64(len(data)) + 1)
+	require.False(t, ok, "appends do not revive a dropped hash")
+
+	inode.noteTruncateLocked(0)
+	inode.noteWriteLocked(0, 0, data[:100])
+	inode.noteTruncateLocked(100)
+	_, ok = inode.writtenHashLocked(100)
+	require.True(t, ok, "truncating to the hashed length keeps the hash")
+	inode.noteTruncateLocked(50)
+	_, ok = inode.writtenHashLocked(50)
+	require.False(t, ok)
+
+	inode.noteTruncateLocked(0)
+	inode.noteWriteLocked(0, 0, data[:100])
+	inode.resetWriteHashLocked()
+	_, ok = inode.writtenHashLocked(100)
+	require.False(t, ok, "downloaded content drops the hash")
+
+	inode.noteWriteLocked(0, 0, data[:10])
+	inode.noteWriteLocked(20, 10, data[20:30])
+	require.Equal(t, graph.QuickXORHash(&data), inode.contentHashLocked(bytes.NewReader(data), uint64(len(data))),
+		"a sparse write falls back to hashing the content")
+}
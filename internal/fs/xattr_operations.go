@@ -1,10 +1,12 @@
 package fs
 
 import (
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/auriora/onemount/internal/logging"
+	"github.com/auriora/onemount/internal/metadata"
 	"github.com/hanwen/go-fuse/v2/fuse"
 )
 
@@ -29,9 +31,39 @@ import (
 // The FUSE layer provides xattr operations that read from/write to the in-memory map,
 // allowing file managers and tools to query file status via standard xattr interfaces.
 
+// xattrWebURL exposes the item's OneDrive web view link. It is derived from the
+// item metadata rather than stored in inode.xattrs so it follows delta updates.
+const xattrWebURL = "user.onemount.weburl"
+
+// xattrPackage exposes the package type (e.g. "oneNote") of package items.
+const xattrPackage = "user.onemount.package"
+
+// xattrNamesLocked returns the names of all attributes visible on the inode,
+// including derived ones. The caller must hold inode.mu.
+func xattrNamesLocked(inode *Inode) []string {
+	names := make([]string, 0, len(inode.xattrs)+1)
+	for name := range inode.xattrs {
+		names = append(names, name)
+	}
+	if _, stored := inode.xattrs[xattrWebURL]; !stored && inode.DriveItem.WebURL != "" {
+		names = append(names, xattrWebURL)
+	}
+	if _, stored := inode.xattrs[xattrPackage]; !stored && inode.DriveItem.IsPackage() {
+		names = append(names, xattrPackage)
+	}
+	if inode.DriveItem.Description != "" {
+		names = append(names, xattrDescription)
+	}
+	if inode.mode&fuse.S_IFDIR != 0 || (inode.mode == 0 && inode.DriveItem.IsDir()) {
+		names = append(names, xattrItemCount)
+	}
+	return names
+}
+
 // GetXAttr retrieves the value of an extended attribute.
 func (f *Filesystem) GetXAttr(_ <-chan struct{}, header *fuse.InHeader, name string, buf []byte) (uint32, fuse.Status) {
 	methodName, startTime := logging.LogMethodEntry("GetXAttr", header.NodeId, name, len(buf))
+	name = f.canonicalXAttrName(name)
 
 	inode := f.GetNodeID(header.NodeId)
 	if inode == nil {
@@ -50,10 +82,56 @@ func (f *Filesystem) GetXAttr(_ <-chan struct{}, header *fuse.InHeader, name str
 	// Get a logger with the context
 	logger := ctx.Logger()
 
+	// The pin mode lives in the metadata entry and the root's ignore rules
+	// with the sync tree scope, not in inode.xattrs.
+	var policyValue []byte
+	if name == xattrPin {
+		if mode := f.PinMode(id); mode != metadata.PinModeUnset {
+			policyValue = []byte(strings.ToLower(string(mode)))
+		}
+	}
+	if name == xattrIgnore && id == f.root {
+		if rules := f.IgnoreRules(); len(rules) > 0 {
+			policyValue = []byte(strings.Join(rules, "\n"))
+		}
+	}
+
+	// The effective overlay policy is inherited from the folders above.
+	if name == xattrEffectiveOverlay {
+		if policy, _, err := f.EffectiveOverlayPolicy(id); err == nil {
+			policyValue = []byte(policy)
+		}
+	}
+
+	// Folder item counts are derived from the children.
+	var itemCount []byte
+	if name == xattrItemCount && inode.IsDir() {
+		itemCount = f.itemCountXAttr(id)
+	}
+
 	inode.mu.RLock()
 	defer inode.mu.RUnlock()
 
 	value, exists := inode.xattrs[name]
+	if !exists && policyValue != nil {
+		value, exists = policyValue, true
+	}
+	if !exists && itemCount != nil {
+		value, exists = itemCount, true
+	}
+	if !exists && name == xattrWebURL && inode.DriveItem.WebURL != "" {
+		value, exists = []byte(inode.DriveItem.WebURL), true
+	}
+	if !exists && name == xattrPackage && inode.DriveItem.IsPackage() {
+		value, exists = []byte(packageType(&inode.DriveItem)), true
+	}
+	if !exists && name == xattrVerify {
+		value = f.verificationXAttr(id)
+		exists = value != nil
+	}
+	if !exists && name == xattrDescription && inode.DriveItem.Description != "" {
+		value, exists = []byte(inode.DriveItem.Description), true
+	}
 	if !exists {
 		logger.Debug().Msg("Xattr not found")
 		logging.LogMethodExit(methodName, time.Since(startTime), uint32(0), fuse.Status(syscall.ENODATA))
@@ -86,6 +164,7 @@ func (f *Filesystem) GetXAttr(_ <-chan struct{}, header *fuse.InHeader, name str
 // SetXAttr sets the value of an extended attribute.
 func (f *Filesystem) SetXAttr(_ <-chan struct{}, in *fuse.SetXAttrIn, name string, value []byte) fuse.Status {
 	methodName, startTime := logging.LogMethodEntry("SetXAttr", in.NodeId, name, len(value))
+	name = f.canonicalXAttrName(name)
 
 	inode := f.GetNodeID(in.NodeId)
 	if inode == nil {
@@ -105,6 +184,33 @@ func (f *Filesystem) SetXAttr(_ <-chan struct{}, in *fuse.SetXAttrIn, name strin
 	// Get a logger with the context
 	logger := ctx.Logger()
 
+	if name == xattrFrozen {
+		frozen, err := parseFrozenValue(value)
+		if err != nil {
+			logger.Debug().Err(err).Msg("Rejected frozen flag value")
+			logging.LogMethodExit(methodName, time.Since(startTime), fuse.EINVAL)
+			return fuse.EINVAL
+		}
+		status := f.applyFrozenXAttr(inode, frozen)
+		logging.LogMethodExit(methodName, time.Since(startTime), status)
+		return status
+	}
+	if status, handled := f.applyPolicyXAttr(inode, name, value); handled {
+		logger.Debug().Str("status", status.String()).Msg("Applied policy xattr")
+		logging.LogMethodExit(methodName, time.Since(startTime), status)
+		return status
+	}
+	if name == xattrVerify {
+		status := f.verifyXAttr(id)
+		logging.LogMethodExit(methodName, time.Since(startTime), status)
+		return status
+	}
+	if name == xattrDescription {
+		status := descriptionXAttrStatus(f.SetDescription(id, string(value)), id)
+		logging.LogMethodExit(methodName, time.Since(startTime), status)
+		return status
+	}
+
 	inode.mu.Lock()
 	defer inode.mu.Unlock()
 
@@ -143,12 +249,18 @@ func (f *Filesystem) ListXAttr(_ <-chan struct{}, header *fuse.InHeader, buf []b
 	// Get a logger with the context
 	logger := ctx.Logger()
 
+	compat := f.OnedriverCompat()
 	inode.mu.RLock()
 	defer inode.mu.RUnlock()
 
+	names := xattrNamesLocked(inode)
+	if compat {
+		names = withLegacyXAttrNames(names)
+	}
+
 	// Calculate total size needed for all attribute names
 	var totalSize uint32
-	for name := range inode.xattrs {
+	for _, name := range names {
 		// +1 for null terminator
 		totalSize += uint32(len(name) + 1)
 	}
@@ -170,7 +282,7 @@ func (f *Filesystem) ListXAttr(_ <-chan struct{}, header *fuse.InHeader, buf []b
 
 	// Build the list of attribute names
 	var offset int
-	for name := range inode.xattrs {
+	for _, name := range names {
 		nameBytes := []byte(name)
 		// Ensure we don't exceed buffer bounds
 		if offset+len(nameBytes)+1 <= len(buf) {
@@ -186,7 +298,7 @@ func (f *Filesystem) ListXAttr(_ <-chan struct{}, header *fuse.InHeader, buf []b
 	}
 
 	logger.Debug().
-		Int("count", len(inode.xattrs)).
+		Int("count", len(names)).
 		Msg("Listed xattrs")
 
 	logging.LogMethodExit(methodName, time.Since(startTime), totalSize, fuse.OK)
@@ -196,6 +308,7 @@ func (f *Filesystem) ListXAttr(_ <-chan struct{}, header *fuse.InHeader, buf []b
 // RemoveXAttr removes an extended attribute.
 func (f *Filesystem) RemoveXAttr(_ <-chan struct{}, header *fuse.InHeader, name string) fuse.Status {
 	methodName, startTime := logging.LogMethodEntry("RemoveXAttr", header.NodeId, name)
+	name = f.canonicalXAttrName(name)
 
 	inode := f.GetNodeID(header.NodeId)
 	if inode == nil {
@@ -214,6 +327,24 @@ func (f *Filesystem) RemoveXAttr(_ <-chan struct{}, header *fuse.InHeader, name
 	// Get a logger with the context
 	logger := ctx.Logger()
 
+	if name == xattrFrozen && f.IsFrozen(id) {
+		status := f.applyFrozenXAttr(inode, false)
+		logging.LogMethodExit(methodName, time.Since(startTime), status)
+		return status
+	}
+	if status, handled := f.removePolicyXAttr(inode, name); handled {
+		logging.LogMethodExit(methodName, time.Since(startTime), status)
+		return status
+	}
+	if name == xattrDescription {
+		status := fuse.Status(syscall.ENODATA)
+		if f.Description(id) != "" {
+			status = descriptionXAttrStatus(f.SetDescription(id, ""), id)
+		}
+		logging.LogMethodExit(methodName, time.Since(startTime), status)
+		return status
+	}
+
 	inode.mu.Lock()
 	defer inode.mu.Unlock()
 
@@ -28,6 +28,7 @@ type Folder struct {
 // Hashes represents integrity hashes for a file.
 type Hashes struct {
 	SHA1Hash     string `json:"sha1Hash,omitempty"`
+	SHA256Hash   string `json:"sha256Hash,omitempty"`
 	QuickXorHash string `json:"quickXorHash,omitempty"`
 }
 
@@ -36,11 +37,30 @@ type File struct {
 	Hashes Hashes `json:"hashes,omitempty"`
 }
 
+// Package represents a bundle of items OneDrive treats as a single unit,
+// such as a OneNote notebook.
+type Package struct {
+	Type string `json:"type,omitempty"`
+}
+
 // Deleted represents a deleted item.
 type Deleted struct {
 	State string `json:"state,omitempty"`
 }
 
+// Identity represents a user, device or application.
+type Identity struct {
+	ID          string `json:"id,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// IdentitySet represents who performed an action on an item.
+type IdentitySet struct {
+	User        *Identity `json:"user,omitempty"`
+	Device      *Identity `json:"device,omitempty"`
+	Application *Identity `json:"application,omitempty"`
+}
+
 // DriveItem represents an item in a drive.
 type DriveItem struct {
 	ID               string           `json:"id,omitempty"`
@@ -50,9 +70,14 @@ type DriveItem struct {
 	Parent           *DriveItemParent `json:"parentReference,omitempty"`
 	Folder           *Folder          `json:"folder,omitempty"`
 	File             *File            `json:"file,omitempty"`
+	Package          *Package         `json:"package,omitempty"`
 	Deleted          *Deleted         `json:"deleted,omitempty"`
 	ConflictBehavior string           `json:"@microsoft.graph.conflictBehavior,omitempty"`
 	ETag             string           `json:"eTag,omitempty"`
+	CTag             string           `json:"cTag,omitempty"`
+	WebURL           string           `json:"webUrl,omitempty"`
+	Description      string           `json:"description,omitempty"`
+	LastModifiedBy   *IdentitySet     `json:"lastModifiedBy,omitempty"`
 }
 
 // IsDir returns if the DriveItem represents a directory or not.
@@ -60,6 +85,26 @@ func (d *DriveItem) IsDir() bool {
 	return d.Folder != nil
 }
 
+// IsPackage returns if the DriveItem is a package such as a OneNote notebook.
+// Packages have neither a file nor a folder facet.
+func (d *DriveItem) IsPackage() bool {
+	return d.Package != nil
+}
+
+// ModifiedByName returns the display name of whoever last modified the item,
+// or an empty string if it is unknown.
+func (d *DriveItem) ModifiedByName() string {
+	if d.LastModifiedBy == nil {
+		return ""
+	}
+	for _, identity := range []*Identity{d.LastModifiedBy.User, d.LastModifiedBy.Device, d.LastModifiedBy.Application} {
+		if identity != nil && identity.DisplayName != "" {
+			return identity.DisplayName
+		}
+	}
+	return ""
+}
+
 // ModTimeUnix returns the modification time as a unix uint64 time.
 func (d *DriveItem) ModTimeUnix() uint64 {
 	if d.ModTime == nil {
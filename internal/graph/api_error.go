@@ -0,0 +1,53 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/auriora/onemount/internal/errors"
+)
+
+// apiError returns the typed error for a failed Graph response, so callers
+// can test it with errors.Is against errors.ErrNotFound, errors.ErrConflict
+// and errors.ErrQuotaExceeded instead of matching its message. The Graph
+// error code is kept in the error's Code.
+func apiError(status int, code, errorMsg string) error {
+	var apiErr *errors.TypedError
+
+	switch {
+	case status == 404 || code == "itemNotFound":
+		apiErr = errors.NewNotFoundError(errorMsg, nil).(*errors.TypedError)
+	case status == 401 || status == 403:
+		apiErr = errors.NewAuthError(errorMsg, nil).(*errors.TypedError)
+	case status == 409 || status == 412:
+		// nameAlreadyExists, resourceModified and the like
+		apiErr = errors.NewConflictError(errorMsg, nil).(*errors.TypedError)
+	case status == 507 || code == "quotaLimitReached":
+		apiErr = errors.NewQuotaExceededError(errorMsg, nil).(*errors.TypedError)
+	case status == 400:
+		apiErr = errors.NewValidationError(errorMsg, nil).(*errors.TypedError)
+	case status == 429:
+		// Create a resource busy error for rate limiting
+		apiErr = errors.NewResourceBusyError(errorMsg, nil).(*errors.TypedError)
+	case status >= 500:
+		apiErr = errors.NewOperationError(errorMsg, nil).(*errors.TypedError)
+	default:
+		apiErr = &errors.TypedError{Message: fmt.Sprintf("HTTP %d - %s", status, errorMsg)}
+	}
+	apiErr.StatusCode = status
+	apiErr.Code = code
+	return apiErr
+}
+
+// ResponseError returns the typed error for a failed response to a request
+// made without Request, such as an upload session chunk. body is the
+// response body, requestIDs the IDs formatted by RequestIDs.
+func ResponseError(status int, body []byte, requestIDs string) error {
+	var graphErr graphError
+	if err := json.Unmarshal(body, &graphErr); err != nil || graphErr.Error.Code == "" {
+		return apiError(status, "", fmt.Sprintf("HTTP %d: %s%s", status, strings.TrimSpace(string(body)), requestIDs))
+	}
+	return apiError(status, graphErr.Error.Code, fmt.Sprintf("%s: %s%s",
+		graphErr.Error.Code, graphErr.Error.Message, requestIDs))
+}
@@ -2,6 +2,9 @@ package graph
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -89,3 +92,83 @@ func TestUT_GR_AUTH_03_01_TokenRefresh_ValidToken_SkipsRefresh(t *testing.T) {
 	updatedAuth := mockAuth.GetAuth()
 	assert.NotNil(t, updatedAuth, "Should be able to get auth")
 }
+
+// TestUT_GR_AUTH_04_01_TokenPreRefresh_RenewsBeforeExpiry tests that tokens are
+// refreshed ahead of expiry and that the background schedule backs off
+func TestUT_GR_AUTH_04_01_TokenPreRefresh_RenewsBeforeExpiry(t *testing.T) {
+	refreshes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"fresh-token","refresh_token":"next-refresh-token","expires_in":3600}`))
+	}))
+	defer server.Close()
+	SetHTTPClient(server.Client())
+	t.Cleanup(func() { SetHTTPClient(nil) })
+
+	auth := &Auth{
+		AccessToken:  "expiring-token",
+		RefreshToken: "valid-refresh-token",
+		ExpiresAt:    time.Now().Add(2 * time.Minute).Unix(),
+		AuthConfig:   AuthConfig{ClientID: "test-client-id", TokenURL: server.URL},
+		Path:         filepath.Join(t.TempDir(), "auth_tokens.json"),
+	}
+
+	// Plain refreshes leave a token that has not expired yet alone.
+	assert.NoError(t, auth.Refresh(context.Background()))
+	assert.Equal(t, 0, refreshes)
+
+	assert.NoError(t, auth.RefreshBefore(context.Background(), preRefreshLead))
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, "fresh-token", auth.AccessToken)
+	assert.Greater(t, auth.ExpiresAt, time.Now().Add(50*time.Minute).Unix())
+
+	assert.NoError(t, auth.RefreshBefore(context.Background(), preRefreshLead))
+	assert.Equal(t, 1, refreshes, "a fresh token is not refreshed again")
+
+	now := time.Now()
+	assert.Equal(t, 54*time.Minute, nextPreRefresh(now.Add(time.Hour), now, time.Minute))
+	assert.Equal(t, time.Duration(0), nextPreRefresh(now.Add(time.Minute), now, 0))
+	assert.Equal(t, preRefreshMinBackoff, nextPreRefreshBackoff(0))
+	assert.Equal(t, 2*preRefreshMinBackoff, nextPreRefreshBackoff(preRefreshMinBackoff))
+	assert.Equal(t, preRefreshMaxBackoff, nextPreRefreshBackoff(preRefreshMaxBackoff))
+}
+
+// TestUT_GR_AUTH_05_01_TokenPreRefresh_SharedAuthRefreshedOnce tests that
+// mounts sharing an Auth run one background refresh, handed over when the
+// mount running it stops
+func TestUT_GR_AUTH_05_01_TokenPreRefresh_SharedAuthRefreshedOnce(t *testing.T) {
+	auth := &Auth{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	running := func() chan struct{} {
+		preRefreshes.Lock()
+		defer preRefreshes.Unlock()
+		return preRefreshes.running[auth]
+	}
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	firstDone := make(chan struct{})
+	go func() {
+		RunTokenPreRefresh(firstCtx, auth)
+		close(firstDone)
+	}()
+	assert.Eventually(t, func() bool { return running() != nil }, time.Second, time.Millisecond)
+	first := running()
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	secondDone := make(chan struct{})
+	go func() {
+		RunTokenPreRefresh(secondCtx, auth)
+		close(secondDone)
+	}()
+
+	stopFirst()
+	<-firstDone
+	assert.Eventually(t, func() bool {
+		current := running()
+		return current != nil && current != first
+	}, time.Second, time.Millisecond, "the second mount takes the refresh over")
+
+	stopSecond()
+	<-secondDone
+	assert.Nil(t, running())
+}
@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/auriora/onemount/internal/errors"
+)
+
+// MaxBatchRequests is the number of requests Graph accepts in one JSON batch.
+const MaxBatchRequests = 20
+
+// batchRequest is a request in a JSON batch.
+type batchRequest struct {
+	ID     string `json:"id"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// batchResponse is the response to a request in a JSON batch.
+type batchResponse struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+}
+
+// ItemsExist asks OneDrive in a single JSON batch whether the items with the
+// given IDs still exist. Items OneDrive did not answer for, because the
+// request was throttled or failed, are left out of the result.
+func ItemsExist(ctx context.Context, ids []string, auth *Auth) (map[string]bool, error) {
+	if len(ids) == 0 {
+		return map[string]bool{}, nil
+	}
+	body, err := existenceBatch(ids, auth)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := PostWithContext(ctx, "/$batch", auth, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return parseExistenceBatch(resp, ids)
+}
+
+// existenceBatch builds a JSON batch reading only the ID of every item.
+func existenceBatch(ids []string, auth *Auth) ([]byte, error) {
+	if len(ids) > MaxBatchRequests {
+		return nil, fmt.Errorf("cannot batch %d requests, the limit is %d", len(ids), MaxBatchRequests)
+	}
+	requests := make([]batchRequest, len(ids))
+	for i, id := range ids {
+		requests[i] = batchRequest{
+			ID:     strconv.Itoa(i),
+			Method: http.MethodGet,
+			URL:    auth.scopeResource(IDPath(id)) + "?$select=id",
+		}
+	}
+	return json.Marshal(map[string][]batchRequest{"requests": requests})
+}
+
+// parseExistenceBatch reads the answers to a batch built by existenceBatch.
+func parseExistenceBatch(body []byte, ids []string) (map[string]bool, error) {
+	var batch struct {
+		Responses []batchResponse `json:"responses"`
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, errors.Wrap(err, "could not parse batch response")
+	}
+	exists := make(map[string]bool, len(ids))
+	for _, resp := range batch.Responses {
+		i, err := strconv.Atoi(resp.ID)
+		if err != nil || i < 0 || i >= len(ids) {
+			continue
+		}
+		switch {
+		case resp.Status >= 200 && resp.Status < 300:
+			exists[ids[i]] = true
+		case resp.Status == http.StatusNotFound || resp.Status == http.StatusGone:
+			exists[ids[i]] = false
+		}
+	}
+	return exists, nil
+}
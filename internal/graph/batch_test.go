@@ -0,0 +1,39 @@
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_Graph_Batch_ExistenceRequestsAreScoped(t *testing.T) {
+	auth := &Auth{}
+	auth.SetDriveScope("b!drive", "FOLDER")
+	body, err := existenceBatch([]string{"A", "B"}, auth)
+	require.NoError(t, err)
+
+	var batch struct {
+		Requests []batchRequest `json:"requests"`
+	}
+	require.NoError(t, json.Unmarshal(body, &batch))
+	require.Equal(t, []batchRequest{
+		{ID: "0", Method: "GET", URL: "/drives/b%21drive/items/A?$select=id"},
+		{ID: "1", Method: "GET", URL: "/drives/b%21drive/items/B?$select=id"},
+	}, batch.Requests)
+
+	_, err = existenceBatch(make([]string, MaxBatchRequests+1), auth)
+	require.Error(t, err)
+}
+
+func TestUT_Graph_Batch_ParsesExistence(t *testing.T) {
+	body := []byte(`{"responses":[
+		{"id":"2","status":429},
+		{"id":"0","status":200,"body":{"id":"A"}},
+		{"id":"1","status":404,"body":{"error":{"code":"itemNotFound"}}},
+		{"id":"9","status":200}
+	]}`)
+	exists, err := parseExistenceBatch(body, []string{"A", "B", "C"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"A": true, "B": false}, exists, "throttled items are left out")
+}
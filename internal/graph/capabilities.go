@@ -0,0 +1,204 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Drive types reported by the API, beyond DriveTypePersonal.
+const (
+	DriveTypeBusiness        = "business"
+	DriveTypeDocumentLibrary = "documentLibrary"
+)
+
+// Hash facets a drive may report for files.
+const (
+	HashQuickXor = "quickXorHash"
+	HashSHA1     = "sha1Hash"
+	HashSHA256   = "sha256Hash"
+)
+
+// Capabilities records which Graph features the signed-in account supports.
+// Consumer (personal) and business drives differ in the hash facets they
+// report, whether quotas include file counts and whether delta accepts
+// token=latest, so callers consult this instead of assuming one account type.
+type Capabilities struct {
+	DriveType string
+	// HashTypes lists the hash facets seen on files, strongest first.
+	HashTypes []string
+	// DeltaLatestToken is true when delta accepts token=latest, which skips
+	// the initial enumeration of the whole drive.
+	DeltaLatestToken bool
+	// QuotaFileCount is true when the drive quota reports fileCount.
+	QuotaFileCount bool
+	// QuotaTotal is true when the drive quota reports a total size.
+	QuotaTotal bool
+	// Probed is false when these are assumed defaults rather than detected.
+	Probed     bool
+	DetectedAt time.Time
+}
+
+// DefaultCapabilities returns the assumed capabilities for a drive type, used
+// until (or when) detection is not possible.
+func DefaultCapabilities(driveType string) Capabilities {
+	caps := Capabilities{
+		DriveType:        driveType,
+		HashTypes:        []string{HashQuickXor},
+		DeltaLatestToken: true,
+		QuotaTotal:       true,
+	}
+	switch driveType {
+	case DriveTypePersonal:
+		caps.HashTypes = []string{HashQuickXor, HashSHA256, HashSHA1}
+	case DriveTypeBusiness, DriveTypeDocumentLibrary:
+		caps.QuotaFileCount = true
+	}
+	return caps
+}
+
+// Personal reports whether the account is a consumer OneDrive.
+func (c Capabilities) Personal() bool {
+	return c.DriveType == DriveTypePersonal
+}
+
+// SupportsHash reports whether the drive reports the given hash facet.
+func (c Capabilities) SupportsHash(hashType string) bool {
+	for _, h := range c.HashTypes {
+		if h == hashType {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyContent reports whether content matches the item's remote hash. The
+// strongest hash facet present on the item and supported by the drive is used;
+// items without a usable hash never match.
+func (c Capabilities) VerifyContent(item *DriveItem, content io.ReadSeeker) bool {
+	if item == nil || item.File == nil {
+		return false
+	}
+	hashes := item.File.Hashes
+	switch {
+	case hashes.QuickXorHash != "" && c.SupportsHash(HashQuickXor):
+		return item.VerifyChecksum(QuickXORHashStream(content))
+	case hashes.SHA256Hash != "" && c.SupportsHash(HashSHA256):
+		return strings.EqualFold(hashes.SHA256Hash, SHA256HashStream(content))
+	case hashes.SHA1Hash != "" && c.SupportsHash(HashSHA1):
+		return strings.EqualFold(hashes.SHA1Hash, SHA1HashStream(content))
+	}
+	return false
+}
+
+// HasVerifiableHash reports whether VerifyContent can check the item.
+func (c Capabilities) HasVerifiableHash(item *DriveItem) bool {
+	if item == nil || item.File == nil {
+		return false
+	}
+	hashes := item.File.Hashes
+	return (hashes.QuickXorHash != "" && c.SupportsHash(HashQuickXor)) ||
+		(hashes.SHA256Hash != "" && c.SupportsHash(HashSHA256)) ||
+		(hashes.SHA1Hash != "" && c.SupportsHash(HashSHA1))
+}
+
+// capabilityGetter issues a GET against the Graph API.
+type capabilityGetter func(ctx context.Context, resource string) ([]byte, error)
+
+// DetectCapabilities probes the account's drive to find which features it
+// supports. Individual probes that fail fall back to the defaults for the
+// drive type; an error is only returned when the drive itself is unreachable.
+func DetectCapabilities(ctx context.Context, auth *Auth) (Capabilities, error) {
+	return detectCapabilities(ctx, func(ctx context.Context, resource string) ([]byte, error) {
+		return GetWithContext(ctx, resource, auth)
+	})
+}
+
+func detectCapabilities(ctx context.Context, get capabilityGetter) (Capabilities, error) {
+	body, err := get(ctx, "/me/drive")
+	if err != nil {
+		return DefaultCapabilities(""), err
+	}
+	var drive struct {
+		DriveType string                 `json:"driveType"`
+		Quota     map[string]interface{} `json:"quota"`
+	}
+	if err := json.Unmarshal(body, &drive); err != nil {
+		return DefaultCapabilities(""), errors.Wrap(err, "failed to parse drive")
+	}
+
+	caps := DefaultCapabilities(drive.DriveType)
+	caps.Probed = true
+	caps.DetectedAt = time.Now()
+	_, caps.QuotaFileCount = drive.Quota["fileCount"]
+	total, _ := drive.Quota["total"].(float64)
+	caps.QuotaTotal = total > 0
+
+	if _, err := get(ctx, "/me/drive/root/delta?token=latest"); err != nil {
+		if errors.IsValidationError(err) {
+			caps.DeltaLatestToken = false
+		} else {
+			logging.Debug().Err(err).Msg("Delta token probe failed, assuming token=latest is supported")
+		}
+	}
+
+	if hashTypes, ok := probeHashTypes(ctx, get); ok {
+		caps.HashTypes = hashTypes
+	}
+
+	logging.Info().
+		Str("driveType", caps.DriveType).
+		Strs("hashTypes", caps.HashTypes).
+		Bool("deltaLatestToken", caps.DeltaLatestToken).
+		Bool("quotaFileCount", caps.QuotaFileCount).
+		Bool("quotaTotal", caps.QuotaTotal).
+		Msg("Detected Graph capabilities")
+	return caps, nil
+}
+
+// probeHashTypes samples files in the drive root and reports which hash
+// facets the drive returns. ok is false when no file could be sampled.
+func probeHashTypes(ctx context.Context, get capabilityGetter) ([]string, bool) {
+	body, err := get(ctx, "/me/drive/root/children?$top=25&$select=id,file")
+	if err != nil {
+		logging.Debug().Err(err).Msg("Hash facet probe failed, using defaults")
+		return nil, false
+	}
+	var page struct {
+		Value []DriveItem `json:"value"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, false
+	}
+
+	seen := map[string]bool{}
+	sampled := false
+	for _, item := range page.Value {
+		if item.File == nil {
+			continue
+		}
+		sampled = true
+		seen[HashQuickXor] = seen[HashQuickXor] || item.File.Hashes.QuickXorHash != ""
+		seen[HashSHA256] = seen[HashSHA256] || item.File.Hashes.SHA256Hash != ""
+		seen[HashSHA1] = seen[HashSHA1] || item.File.Hashes.SHA1Hash != ""
+	}
+	if !sampled {
+		return nil, false
+	}
+
+	hashTypes := make([]string, 0, 3)
+	for _, h := range []string{HashQuickXor, HashSHA256, HashSHA1} {
+		if seen[h] {
+			hashTypes = append(hashTypes, h)
+		}
+	}
+	if len(hashTypes) == 0 {
+		return nil, false
+	}
+	return hashTypes, true
+}
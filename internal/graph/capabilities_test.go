@@ -0,0 +1,90 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCapabilityGetter serves canned responses keyed by resource path,
+// ignoring the query string.
+func fakeCapabilityGetter(responses map[string]string, failures map[string]error) capabilityGetter {
+	return func(_ context.Context, resource string) ([]byte, error) {
+		path, _, _ := strings.Cut(resource, "?")
+		if err, ok := failures[path]; ok {
+			return nil, err
+		}
+		if body, ok := responses[path]; ok {
+			return []byte(body), nil
+		}
+		return nil, fmt.Errorf("unexpected resource %s", resource)
+	}
+}
+
+func TestUT_Graph_Capabilities_DetectsPersonalDrive(t *testing.T) {
+	get := fakeCapabilityGetter(map[string]string{
+		"/me/drive/root/delta":    `{"value":[]}`,
+		"/me/drive/root/children": `{"value":[{"id":"a","file":{"hashes":{"sha1Hash":"AA","sha256Hash":"BB"}}},{"id":"b","folder":{}}]}`,
+		"/me/drive":               `{"driveType":"personal","quota":{"total":1024,"remaining":512}}`,
+	}, map[string]error{
+		"/me/drive/root/delta": errors.NewValidationError("HTTP 400 - invalidRequest: token not supported", nil),
+	})
+
+	caps, err := detectCapabilities(context.Background(), get)
+	require.NoError(t, err)
+	require.True(t, caps.Probed)
+	require.True(t, caps.Personal())
+	require.False(t, caps.DeltaLatestToken, "a rejected token=latest should fall back to full delta")
+	require.False(t, caps.QuotaFileCount)
+	require.True(t, caps.QuotaTotal)
+	require.Equal(t, []string{HashSHA256, HashSHA1}, caps.HashTypes)
+	require.False(t, caps.SupportsHash(HashQuickXor))
+}
+
+func TestUT_Graph_Capabilities_FailedProbesKeepDefaults(t *testing.T) {
+	get := fakeCapabilityGetter(map[string]string{
+		"/me/drive": `{"driveType":"business","quota":{"total":0,"fileCount":12}}`,
+	}, map[string]error{
+		"/me/drive/root/delta":    errors.NewOperationError("HTTP 503 - serviceUnavailable", nil),
+		"/me/drive/root/children": errors.NewOperationError("HTTP 503 - serviceUnavailable", nil),
+	})
+
+	caps, err := detectCapabilities(context.Background(), get)
+	require.NoError(t, err)
+	require.Equal(t, DriveTypeBusiness, caps.DriveType)
+	require.True(t, caps.DeltaLatestToken, "transient failures must not disable token=latest")
+	require.True(t, caps.QuotaFileCount)
+	require.False(t, caps.QuotaTotal)
+	require.Equal(t, DefaultCapabilities(DriveTypeBusiness).HashTypes, caps.HashTypes)
+
+	_, err = detectCapabilities(context.Background(), fakeCapabilityGetter(nil, map[string]error{
+		"/me/drive": errors.NewNetworkError("offline", nil),
+	}))
+	require.Error(t, err)
+}
+
+func TestUT_Graph_Capabilities_VerifyContentUsesAvailableHash(t *testing.T) {
+	content := []byte("hello capabilities")
+	reader := bytes.NewReader(content)
+	sha1 := SHA1HashStream(reader)
+	quickXor := QuickXORHashStream(reader)
+
+	caps := DefaultCapabilities(DriveTypePersonal)
+	item := &DriveItem{File: &File{Hashes: Hashes{SHA1Hash: strings.ToLower(sha1)}}}
+	require.True(t, caps.HasVerifiableHash(item))
+	require.True(t, caps.VerifyContent(item, reader), "sha1 should be used when quickXorHash is absent")
+
+	item.File.Hashes.QuickXorHash = quickXor
+	item.File.Hashes.SHA1Hash = "stale"
+	require.True(t, caps.VerifyContent(item, reader), "quickXorHash takes precedence")
+
+	business := DefaultCapabilities(DriveTypeBusiness)
+	sha1Only := &DriveItem{File: &File{Hashes: Hashes{SHA1Hash: sha1}}}
+	require.False(t, business.HasVerifiableHash(sha1Only))
+	require.False(t, business.VerifyContent(sha1Only, reader))
+}
@@ -0,0 +1,283 @@
+package graph
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	goerrors "errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// ConnectivityFailure classifies why a connectivity probe could not reach
+// any endpoint.
+type ConnectivityFailure string
+
+const (
+	// ConnectivityOK means at least one endpoint answered.
+	ConnectivityOK ConnectivityFailure = ""
+	// ConnectivityDNS means no endpoint host name could be resolved.
+	ConnectivityDNS ConnectivityFailure = "dns"
+	// ConnectivityUnreachable means hosts resolved but no route or listener
+	// could be reached on any address family.
+	ConnectivityUnreachable ConnectivityFailure = "unreachable"
+	// ConnectivityTimeout means the probe ran out of time.
+	ConnectivityTimeout ConnectivityFailure = "timeout"
+	// ConnectivityTLS means a connection was made but the TLS handshake
+	// failed, typically because of an intercepting proxy or captive portal.
+	ConnectivityTLS ConnectivityFailure = "tls"
+	// ConnectivityUnknown covers any other failure.
+	ConnectivityUnknown ConnectivityFailure = "unknown"
+)
+
+// Dual-stack dialing settings shared by the probe and the API client. Go's
+// dialer races IPv6 and IPv4 addresses (RFC 6555 "happy eyeballs"), starting
+// the fallback family after connectFallbackDelay, so an IPv6-only network or
+// a broken IPv6 route costs at most that delay instead of a full timeout.
+const (
+	connectTimeout       = 15 * time.Second
+	connectFallbackDelay = 300 * time.Millisecond
+)
+
+// DefaultConnectivityEndpoints are probed concurrently. Any HTTP response,
+// even an error status, proves the network path works. The login endpoint is
+// included so split-DNS or filtered networks that only block one host are not
+// mistaken for being offline.
+var DefaultConnectivityEndpoints = []string{
+	GraphURL + "/$metadata",
+	"https://login.microsoftonline.com/common/v2.0/.well-known/openid-configuration",
+}
+
+// ConnectivityResult describes the outcome of a connectivity probe.
+type ConnectivityResult struct {
+	Reachable  bool
+	Endpoint   string              // endpoint that answered first
+	RemoteAddr string              // address the successful connection used
+	StatusCode int                 // HTTP status returned by Endpoint
+	Failure    ConnectivityFailure // classification when not Reachable
+	Err        error               // most informative error when not Reachable
+	Latency    time.Duration
+	CheckedAt  time.Time
+}
+
+// IPv6 reports whether the successful connection used IPv6.
+func (r ConnectivityResult) IPv6() bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() == nil
+}
+
+// ConnectivityProber checks whether Microsoft's endpoints are reachable.
+type ConnectivityProber struct {
+	Endpoints []string
+	Timeout   time.Duration
+	client    *http.Client
+}
+
+// NewConnectivityProber creates a prober for the default endpoints.
+func NewConnectivityProber(timeout time.Duration) *ConnectivityProber {
+	return &ConnectivityProber{
+		Endpoints: DefaultConnectivityEndpoints,
+		Timeout:   timeout,
+		client: &http.Client{
+			Transport: newDualStackTransport(),
+			// A redirect (e.g. to a captive portal) still proves the path up to
+			// the first hop; don't follow it.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Probe races all endpoints and returns as soon as one answers. When every
+// endpoint fails, the result carries the most specific failure seen.
+func (p *ConnectivityProber) Probe(ctx context.Context) ConnectivityResult {
+	start := time.Now()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan ConnectivityResult, len(p.Endpoints))
+	var wg sync.WaitGroup
+	for _, endpoint := range p.Endpoints {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+			results <- p.probeEndpoint(ctx, endpoint)
+		}(endpoint)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	final := ConnectivityResult{Failure: ConnectivityUnknown}
+	for result := range results {
+		if result.Reachable {
+			final = result
+			cancel()
+			break
+		}
+		if failureRank(result.Failure) > failureRank(final.Failure) || final.Err == nil {
+			final = result
+		}
+	}
+	if len(p.Endpoints) == 0 {
+		final.Err = goerrors.New("no connectivity endpoints configured")
+	}
+	final.Latency = time.Since(start)
+	final.CheckedAt = time.Now()
+
+	recordConnectivityResult(final)
+	if final.Reachable {
+		logging.Debug().
+			Str("endpoint", final.Endpoint).
+			Str("remoteAddr", final.RemoteAddr).
+			Bool("ipv6", final.IPv6()).
+			Dur("latency", final.Latency).
+			Msg("Connectivity probe succeeded")
+	} else {
+		logging.Debug().
+			Err(final.Err).
+			Str("failure", string(final.Failure)).
+			Msg("Connectivity probe failed")
+	}
+	return final
+}
+
+func (p *ConnectivityProber) probeEndpoint(ctx context.Context, endpoint string) ConnectivityResult {
+	result := ConnectivityResult{Endpoint: endpoint}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if addr := info.Conn.RemoteAddr(); addr != nil {
+				result.RemoteAddr = addr.String()
+			}
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodHead, endpoint, nil)
+	if err != nil {
+		result.Err = err
+		result.Failure = ConnectivityUnknown
+		return result
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		result.Err = err
+		result.Failure = ClassifyConnectivityError(err)
+		return result
+	}
+	_ = resp.Body.Close()
+
+	result.Reachable = true
+	result.StatusCode = resp.StatusCode
+	return result
+}
+
+// failureRank orders failures from least to most informative so the probe
+// reports, for example, a TLS interception over a generic timeout.
+func failureRank(f ConnectivityFailure) int {
+	switch f {
+	case ConnectivityTLS:
+		return 4
+	case ConnectivityUnreachable:
+		return 3
+	case ConnectivityDNS:
+		return 2
+	case ConnectivityTimeout:
+		return 1
+	}
+	return 0
+}
+
+// ClassifyConnectivityError maps a transport error to a ConnectivityFailure.
+func ClassifyConnectivityError(err error) ConnectivityFailure {
+	if err == nil {
+		return ConnectivityOK
+	}
+
+	var dnsErr *net.DNSError
+	if goerrors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ConnectivityTimeout
+		}
+		return ConnectivityDNS
+	}
+
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	if goerrors.As(err, &certErr) || goerrors.As(err, &unknownAuthority) ||
+		goerrors.As(err, &hostnameErr) || goerrors.As(err, &recordErr) {
+		return ConnectivityTLS
+	}
+
+	if goerrors.Is(err, context.DeadlineExceeded) {
+		return ConnectivityTimeout
+	}
+	var netErr net.Error
+	if goerrors.As(err, &netErr) && netErr.Timeout() {
+		return ConnectivityTimeout
+	}
+
+	if goerrors.Is(err, syscall.ECONNREFUSED) || goerrors.Is(err, syscall.ENETUNREACH) ||
+		goerrors.Is(err, syscall.EHOSTUNREACH) || goerrors.Is(err, syscall.ENETDOWN) {
+		return ConnectivityUnreachable
+	}
+	var opErr *net.OpError
+	if goerrors.As(err, &opErr) && opErr.Op == "dial" {
+		return ConnectivityUnreachable
+	}
+	return ConnectivityUnknown
+}
+
+// newDualStackTransport builds a transport that honours proxy settings from
+// the environment and dials IPv6 and IPv4 addresses in parallel.
+func newDualStackTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:       connectTimeout,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: connectFallbackDelay,
+	}
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: connectTimeout,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+var (
+	lastConnectivityResult   ConnectivityResult
+	lastConnectivityResultMu sync.RWMutex
+)
+
+func recordConnectivityResult(result ConnectivityResult) {
+	lastConnectivityResultMu.Lock()
+	lastConnectivityResult = result
+	lastConnectivityResultMu.Unlock()
+}
+
+// LastConnectivityResult returns the most recent probe result, if any.
+func LastConnectivityResult() (ConnectivityResult, bool) {
+	lastConnectivityResultMu.RLock()
+	defer lastConnectivityResultMu.RUnlock()
+	return lastConnectivityResult, !lastConnectivityResult.CheckedAt.IsZero()
+}
@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// closedEndpoint returns a URL for a local port with no listener.
+func closedEndpoint(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	return "http://" + addr + "/"
+}
+
+func TestUT_Graph_ConnectivityProbe_AnyEndpointSucceeds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	prober := NewConnectivityProber(5 * time.Second)
+	prober.Endpoints = []string{closedEndpoint(t), server.URL}
+
+	result := prober.Probe(context.Background())
+	require.True(t, result.Reachable)
+	require.Equal(t, server.URL, result.Endpoint)
+	require.Equal(t, http.StatusUnauthorized, result.StatusCode)
+	require.False(t, result.IPv6())
+
+	last, ok := LastConnectivityResult()
+	require.True(t, ok)
+	require.True(t, last.Reachable)
+}
+
+func TestUT_Graph_ConnectivityProbe_AllEndpointsFail(t *testing.T) {
+	prober := NewConnectivityProber(5 * time.Second)
+	prober.Endpoints = []string{closedEndpoint(t), closedEndpoint(t)}
+
+	result := prober.Probe(context.Background())
+	require.False(t, result.Reachable)
+	require.Equal(t, ConnectivityUnreachable, result.Failure)
+	require.Error(t, result.Err)
+}
+
+func TestUT_Graph_ConnectivityChecker_ReusesProber(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	checker := NewNetworkConnectivityChecker()
+	checker.prober.Endpoints = []string{server.URL}
+	for i := 0; i < 3; i++ {
+		require.True(t, checker.ForceCheck())
+	}
+	require.Equal(t, int32(1), conns.Load(), "checks share the prober's idle connection")
+}
+
+func TestUT_Graph_ConnectivityProbe_ClassifiesErrors(t *testing.T) {
+	dnsErr := &net.DNSError{Err: "no such host", Name: "graph.microsoft.com", IsNotFound: true}
+	require.Equal(t, ConnectivityDNS, ClassifyConnectivityError(fmt.Errorf("get: %w", dnsErr)))
+	require.Equal(t, ConnectivityTimeout, ClassifyConnectivityError(&net.DNSError{Err: "timeout", IsTimeout: true}))
+	require.Equal(t, ConnectivityTimeout, ClassifyConnectivityError(context.DeadlineExceeded))
+
+	unreachable := &net.OpError{Op: "dial", Net: "tcp6", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}
+	require.Equal(t, ConnectivityUnreachable, ClassifyConnectivityError(unreachable))
+
+	require.Equal(t, ConnectivityOK, ClassifyConnectivityError(nil))
+	require.Equal(t, ConnectivityUnknown, ClassifyConnectivityError(fmt.Errorf("something odd")))
+}
+
+func TestUT_Graph_ConnectivityProbe_IPv6Detection(t *testing.T) {
+	require.True(t, ConnectivityResult{RemoteAddr: "[2603:1030::1]:443"}.IPv6())
+	require.False(t, ConnectivityResult{RemoteAddr: "20.190.160.1:443"}.IPv6())
+	require.False(t, ConnectivityResult{}.IPv6())
+}
@@ -0,0 +1,125 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/auriora/onemount/internal/errors"
+)
+
+// OneDrive copies items on the server: a copy request returns right away
+// with the URL of a monitor that reports how far the copy got. The copy may
+// go to another drive the account can write to, such as a shared library,
+// but not to a drive of another account.
+
+// Copy states reported by a copy monitor. Other states mean the copy is
+// still running.
+const (
+	CopyCompleted = "completed"
+	CopyFailed    = "failed"
+)
+
+// CopyStatus is the progress of a copy as reported by its monitor.
+type CopyStatus struct {
+	Status             string  `json:"status"`
+	PercentageComplete float64 `json:"percentageComplete"`
+	ResourceID         string  `json:"resourceId,omitempty"`
+	Error              *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// CopyItem asks OneDrive to copy the item itemID as name into the folder
+// parentID of the drive driveID. It returns the URL of the copy's monitor.
+func CopyItem(ctx context.Context, itemID, driveID, parentID, name string, auth *Auth) (string, error) {
+	if auth == nil || auth.AccessToken == "" {
+		return "", errors.NewAuthError("cannot make a request with empty auth", nil)
+	}
+	if GetOperationalOffline() {
+		return "", errors.NewNetworkError("operational offline mode is enabled", nil)
+	}
+	if err := auth.Refresh(ctx); err != nil {
+		return "", err
+	}
+	payload, _ := json.Marshal(struct {
+		Parent DriveItemParent `json:"parentReference"`
+		Name   string          `json:"name"`
+	}{Parent: DriveItemParent{DriveID: driveID, ID: parentID}, Name: name})
+
+	resource := auth.scopeResource("/me/drive/items/" + url.PathEscape(itemID) + "/copy")
+	req, err := http.NewRequestWithContext(ctx, "POST", GraphURL+resource, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("Authorization", "bearer "+auth.AccessToken)
+	req.Header.Add("Content-Type", "application/json")
+	SetClientRequestID(ctx, req)
+
+	ObserveRequest(auth, req.Method, req.URL.String())
+	resp, err := getHTTPClient().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", errors.NewNetworkError("network request failed", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return "", ResponseError(resp.StatusCode, body,
+			RequestIDs(req.Header.Get(ClientRequestIDHeader), ServerRequestID(resp)))
+	}
+	monitor := resp.Header.Get("Location")
+	if monitor == "" {
+		return "", errors.New("OneDrive accepted the copy of " + itemID + " without a monitor URL")
+	}
+	return monitor, nil
+}
+
+// GetCopyStatus asks the monitor of a copy how far it got. Monitor URLs are
+// pre-authenticated and need no token.
+func GetCopyStatus(ctx context.Context, monitor string) (CopyStatus, error) {
+	var status CopyStatus
+	req, err := http.NewRequestWithContext(ctx, "GET", monitor, nil)
+	if err != nil {
+		return status, fmt.Errorf("failed to create request: %w", err)
+	}
+	SetClientRequestID(ctx, req)
+
+	client := getHTTPClient()
+	if c, ok := client.(*http.Client); ok {
+		// a finished copy redirects to the new item, which needs a token
+		noRedirect := *c
+		noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		client = &noRedirect
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return status, ctx.Err()
+		}
+		return status, errors.NewNetworkError("network request failed", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusSeeOther:
+		status.Status = CopyCompleted
+		return status, nil
+	case resp.StatusCode >= 400:
+		return status, ResponseError(resp.StatusCode, body,
+			RequestIDs(req.Header.Get(ClientRequestIDHeader), ServerRequestID(resp)))
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return status, errors.Wrap(err, "could not parse copy status")
+	}
+	return status, nil
+}
@@ -0,0 +1,73 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_Graph_Copy_StartsServerCopyAndFollowsMonitor(t *testing.T) {
+	const monitor = "https://api.onedrive.com/monitor/4A3407B5"
+	var body map[string]interface{}
+	polls := 0
+	SetHTTPClient(&http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		switch {
+		case request.URL.String() == GraphURL+"/me/drive/items/SRC/copy":
+			require.Equal(t, "POST", request.Method)
+			require.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+			header.Set("Location", monitor)
+			return &http.Response{StatusCode: http.StatusAccepted, Header: header, Body: io.NopCloser(strings.NewReader("")), Request: request}, nil
+		case request.URL.String() == monitor:
+			require.Empty(t, request.Header.Get("Authorization"), "monitors are pre-authenticated")
+			polls++
+			if polls == 1 {
+				return &http.Response{StatusCode: http.StatusAccepted, Header: header, Request: request,
+					Body: io.NopCloser(strings.NewReader(`{"status":"inProgress","percentageComplete":40}`))}, nil
+			}
+			header.Set("Location", GraphURL+"/drives/other/items/NEW")
+			return &http.Response{StatusCode: http.StatusSeeOther, Header: header, Body: io.NopCloser(strings.NewReader("")), Request: request}, nil
+		}
+		t.Fatalf("unexpected request %s", request.URL)
+		return nil, nil
+	})})
+	defer SetHTTPClient(nil)
+	auth := &Auth{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	got, err := CopyItem(context.Background(), "SRC", "other", "FOLDER", "report.docx", auth)
+	require.NoError(t, err)
+	require.Equal(t, monitor, got)
+	require.Equal(t, map[string]interface{}{
+		"name":            "report.docx",
+		"parentReference": map[string]interface{}{"driveId": "other", "id": "FOLDER"},
+	}, body)
+
+	status, err := GetCopyStatus(context.Background(), monitor)
+	require.NoError(t, err)
+	require.Equal(t, "inProgress", status.Status)
+	require.Equal(t, 40.0, status.PercentageComplete)
+	status, err = GetCopyStatus(context.Background(), monitor)
+	require.NoError(t, err)
+	require.Equal(t, CopyCompleted, status.Status, "the redirect to the new item is not followed")
+}
+
+func TestUT_Graph_Copy_ReportsRefusedCopies(t *testing.T) {
+	SetHTTPClient(&http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{}, Request: request,
+			Body: io.NopCloser(strings.NewReader(`{"error":{"code":"accessDenied","message":"Access denied"}}`))}, nil
+	})})
+	defer SetHTTPClient(nil)
+	auth := &Auth{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	_, err := CopyItem(context.Background(), "SRC", "other", "FOLDER", "a.txt", auth)
+	require.Error(t, err)
+	require.True(t, errors.IsAuthError(err))
+	require.Equal(t, "accessDenied", errors.Code(err))
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Every request to Graph carries the correlation ID of the operation it is
+// made for (see logging.WithCorrelationID) as its client-request-id, and
+// Graph answers with a request-id of its own. Both are logged, and included
+// in the errors of failed requests, so that a failure reported by a user can
+// be looked up in Microsoft's diagnostics.
+const (
+	ClientRequestIDHeader = "client-request-id"
+	serverRequestIDHeader = "request-id"
+)
+
+// SetClientRequestID sets the client-request-id of a request to the
+// correlation ID carried by ctx, or to a new one, and returns it. Requests
+// made outside this package, such as upload session chunks, call it directly.
+func SetClientRequestID(ctx context.Context, request *http.Request) string {
+	_, id := logging.EnsureCorrelationID(ctx)
+	request.Header.Set(ClientRequestIDHeader, id)
+	request.Header.Set("return-client-request-id", "true")
+	return id
+}
+
+// ServerRequestID returns the request-id Graph assigned to a response, or ""
+// when it gave none.
+func ServerRequestID(response *http.Response) string {
+	if response == nil {
+		return ""
+	}
+	return response.Header.Get(serverRequestIDHeader)
+}
+
+// RequestIDs formats the IDs of a failed request for its error message.
+func RequestIDs(clientRequestID, serverRequestID string) string {
+	switch {
+	case clientRequestID == "" && serverRequestID == "":
+		return ""
+	case serverRequestID == "":
+		return fmt.Sprintf(" (client-request-id %s)", clientRequestID)
+	case clientRequestID == "":
+		return fmt.Sprintf(" (request-id %s)", serverRequestID)
+	}
+	return fmt.Sprintf(" (client-request-id %s, request-id %s)", clientRequestID, serverRequestID)
+}
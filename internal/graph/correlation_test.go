@@ -0,0 +1,50 @@
+package graph
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestUT_Graph_Correlation_ClientRequestIDSentAndReported(t *testing.T) {
+	var sent []string
+	SetHTTPClient(&http.Client{Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		sent = append(sent, request.Header.Get(ClientRequestIDHeader))
+		header := http.Header{}
+		header.Set("request-id", "server-42")
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader(`{"error":{"code":"itemNotFound","message":"Item not found"}}`)),
+			Request:    request,
+		}, nil
+	})})
+	defer SetHTTPClient(nil)
+	auth := &Auth{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	ctx := logging.WithCorrelationID(context.Background(), "op-1")
+	_, err := RequestWithContext(ctx, "/me/drive/items/missing", auth, "GET", nil)
+	require.Error(t, err)
+	require.Equal(t, []string{"op-1"}, sent)
+	require.Contains(t, err.Error(), "itemNotFound: Item not found")
+	require.Contains(t, err.Error(), "client-request-id op-1")
+	require.Contains(t, err.Error(), "request-id server-42")
+
+	// Requests outside of an operation get an ID of their own
+	_, err = RequestWithContext(context.Background(), "/me/drive/items/missing", auth, "GET", nil)
+	require.Error(t, err)
+	require.Len(t, sent, 2)
+	require.Len(t, sent[1], 36, "a UUID")
+}
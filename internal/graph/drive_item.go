@@ -2,6 +2,7 @@ package graph
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -25,12 +26,21 @@ type DriveItem = api.DriveItem
 type DriveItemParent = api.DriveItemParent
 type Folder = api.Folder
 type File = api.File
+type Package = api.Package
 type Hashes = api.Hashes
 type Deleted = api.Deleted
+type Identity = api.Identity
+type IdentitySet = api.IdentitySet
 
 // getItem is the internal method used to lookup items
 func getItem(path string, auth *Auth) (*DriveItem, error) {
-	body, err := Get(path, auth)
+	return getItemWithContext(context.Background(), path, auth)
+}
+
+// getItemWithContext is getItem for requests made as part of the operation
+// of ctx.
+func getItemWithContext(ctx context.Context, path string, auth *Auth) (*DriveItem, error) {
+	body, err := RequestWithContext(ctx, path, auth, "GET", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +65,12 @@ func GetItem(id string, auth *Auth) (*DriveItem, error) {
 	return getItem(IDPath(id), auth)
 }
 
+// GetItemWithContext is GetItem for requests made as part of the operation of
+// ctx.
+func GetItemWithContext(ctx context.Context, id string, auth *Auth) (*DriveItem, error) {
+	return getItemWithContext(ctx, IDPath(id), auth)
+}
+
 // GetItemChild fetches the named child of an item.
 func GetItemChild(id string, name string, auth *Auth) (*DriveItem, error) {
 	return getItem(
@@ -94,17 +110,55 @@ func GetItemContent(id string, auth *Auth) ([]byte, uint64, error) {
 //
 // Download URLs expire after approximately 1 hour and must be refreshed via the API.
 func GetItemContentStream(id string, auth *Auth, output io.Writer) (uint64, error) {
+	return GetItemContentStreamWithContext(context.Background(), id, auth, output)
+}
+
+// GetItemContentStreamWithContext is GetItemContentStream for requests made
+// as part of the operation of ctx.
+func GetItemContentStreamWithContext(ctx context.Context, id string, auth *Auth, output io.Writer) (uint64, error) {
+	return GetItemContentStreamChunkedWithContext(ctx, id, auth, output, FixedChunkSize(defaultDownloadChunkSize))
+}
+
+// defaultDownloadChunkSize is the size of the ranged requests of
+// GetItemContentStream.
+const defaultDownloadChunkSize = 10 * 1024 * 1024
+
+// ChunkSizer chooses the size of each ranged request of a transfer and is
+// told how each one went, so that it can adapt the size to the connection.
+type ChunkSizer interface {
+	NextChunkSize() uint64
+	ObserveChunk(size uint64, elapsed time.Duration, err error)
+}
+
+// FixedChunkSize is a ChunkSizer that always uses the same size.
+type FixedChunkSize uint64
+
+// NextChunkSize returns the fixed size.
+func (c FixedChunkSize) NextChunkSize() uint64 { return uint64(c) }
+
+// ObserveChunk ignores the result.
+func (FixedChunkSize) ObserveChunk(uint64, time.Duration, error) {}
+
+// GetItemContentStreamChunked is GetItemContentStream with the size of each
+// ranged request chosen by chunks. Items no larger than the first chunk are
+// downloaded in one request.
+func GetItemContentStreamChunked(id string, auth *Auth, output io.Writer, chunks ChunkSizer) (uint64, error) {
+	return GetItemContentStreamChunkedWithContext(context.Background(), id, auth, output, chunks)
+}
+
+// GetItemContentStreamChunkedWithContext is GetItemContentStreamChunked with
+// its requests made as part of the operation of ctx.
+func GetItemContentStreamChunkedWithContext(ctx context.Context, id string, auth *Auth, output io.Writer, chunks ChunkSizer) (uint64, error) {
 	// determine the size of the item
-	item, err := GetItem(id, auth)
+	item, err := getItemWithContext(ctx, IDPath(id), auth)
 	if err != nil {
 		return 0, err
 	}
 
-	const downloadChunkSize = 10 * 1024 * 1024
 	downloadURL := fmt.Sprintf("/me/drive/items/%s/content", id)
-	if item.Size <= downloadChunkSize {
+	if item.Size <= chunks.NextChunkSize() {
 		// simple one-shot download
-		content, err := Get(downloadURL, auth)
+		content, err := RequestWithContext(ctx, downloadURL, auth, "GET", nil)
 		if err != nil {
 			return 0, err
 		}
@@ -114,17 +168,22 @@ func GetItemContentStream(id string, auth *Auth, output io.Writer) (uint64, erro
 
 	// multipart download
 	var n uint64
-	for i := 0; i < int(item.Size/downloadChunkSize)+1; i++ {
-		start := i * downloadChunkSize
-		end := start + downloadChunkSize - 1
+	for n < item.Size {
+		start := n
+		end := start + chunks.NextChunkSize() - 1
+		if end >= item.Size {
+			end = item.Size - 1
+		}
 		logging.Info().
 			Str("id", item.ID).
 			Str("name", item.Name).
 			Msgf("Downloading bytes %d-%d/%d.", start, end, item.Size)
-		content, err := Get(downloadURL, auth, Header{
+		began := time.Now()
+		content, err := RequestWithContext(ctx, downloadURL, auth, "GET", nil, Header{
 			key:   "Range",
 			value: fmt.Sprintf("bytes=%d-%d", start, end),
 		})
+		chunks.ObserveChunk(uint64(len(content)), time.Since(began), err)
 		if err != nil {
 			return n, err
 		}
@@ -133,6 +192,9 @@ func GetItemContentStream(id string, auth *Auth, output io.Writer) (uint64, erro
 		if err != nil {
 			return n, err
 		}
+		if written == 0 {
+			break
+		}
 	}
 	logging.Info().
 		Str("id", item.ID).
@@ -142,20 +204,52 @@ func GetItemContentStream(id string, auth *Auth, output io.Writer) (uint64, erro
 	return n, nil
 }
 
+// GetDownloadURL returns the pre-authenticated URL OneDrive hands out for
+// downloading the content of a file without a token. Anyone with the URL can
+// download the file until it expires, after about an hour.
+func GetDownloadURL(ctx context.Context, id string, auth *Auth) (string, error) {
+	body, err := RequestWithContext(ctx, IDPath(id)+"?select=id,@microsoft.graph.downloadUrl", auth, "GET", nil)
+	if err != nil {
+		return "", err
+	}
+	var item struct {
+		DownloadURL string `json:"@microsoft.graph.downloadUrl"`
+	}
+	if err := json.Unmarshal(body, &item); err != nil {
+		return "", err
+	}
+	if item.DownloadURL == "" {
+		return "", fmt.Errorf("OneDrive has no download URL for item %s", id)
+	}
+	return item.DownloadURL, nil
+}
+
 // Remove removes a directory or file by ID
 func Remove(id string, auth *Auth) error {
-	return Delete("/me/drive/items/"+id, auth)
+	return RemoveWithContext(context.Background(), id, auth)
+}
+
+// RemoveWithContext is Remove for requests made as part of the operation of
+// ctx.
+func RemoveWithContext(ctx context.Context, id string, auth *Auth) error {
+	return DeleteWithContext(ctx, "/me/drive/items/"+id, auth)
 }
 
 // Mkdir creates a directory on the server at the specified parent ID.
 func Mkdir(name string, parentID string, auth *Auth) (*DriveItem, error) {
+	return MkdirWithContext(context.Background(), name, parentID, auth)
+}
+
+// MkdirWithContext is Mkdir for requests made as part of the operation of
+// ctx.
+func MkdirWithContext(ctx context.Context, name string, parentID string, auth *Auth) (*DriveItem, error) {
 	// create a new folder on the server
 	newFolderPost := DriveItem{
 		Name:   name,
 		Folder: &Folder{},
 	}
 	bytePayload, _ := json.Marshal(newFolderPost)
-	resp, err := Post(childrenPathID(parentID), auth, bytes.NewReader(bytePayload))
+	resp, err := PostWithContext(ctx, childrenPathID(parentID), auth, bytes.NewReader(bytePayload))
 	if err != nil {
 		return nil, err
 	}
@@ -166,6 +260,12 @@ func Mkdir(name string, parentID string, auth *Auth) (*DriveItem, error) {
 // Rename moves and/or renames an item on the server. The itemName and parentID
 // arguments correspond to the *new* basename or id of the parent.
 func Rename(itemID string, itemName string, parentID string, auth *Auth) error {
+	return RenameWithContext(context.Background(), itemID, itemName, parentID, auth)
+}
+
+// RenameWithContext is Rename for requests made as part of the operation of
+// ctx.
+func RenameWithContext(ctx context.Context, itemID string, itemName string, parentID string, auth *Auth) error {
 	// start creating patch content for server
 	// mutex does not need to be initialized since it is never used locally
 	patchContent := DriveItem{
@@ -181,8 +281,8 @@ func Rename(itemID string, itemName string, parentID string, auth *Auth) error {
 	jsonPatch, _ := json.Marshal(patchContent)
 
 	// First attempt
-	_, err := Patch("/me/drive/items/"+itemID, auth, bytes.NewReader(jsonPatch))
-	if err != nil {
+	_, err := PatchWithContext(ctx, "/me/drive/items/"+itemID, auth, bytes.NewReader(jsonPatch))
+	if err != nil && ctx.Err() == nil {
 		// If there's an error, log it and retry with a delay
 		logging.Warn().Err(err).
 			Str("itemID", itemID).
@@ -191,10 +291,14 @@ func Rename(itemID string, itemName string, parentID string, auth *Auth) error {
 			Msg("Error during rename operation, retrying after delay")
 
 		// Wait a second before retrying
-		time.Sleep(time.Second)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
 
 		// Create a new reader for the retry since the previous one was consumed
-		_, err = Patch("/me/drive/items/"+itemID, auth, bytes.NewReader(jsonPatch))
+		_, err = PatchWithContext(ctx, "/me/drive/items/"+itemID, auth, bytes.NewReader(jsonPatch))
 
 		// If still failing after retry, log a more detailed error
 		if err != nil {
@@ -209,11 +313,20 @@ func Rename(itemID string, itemName string, parentID string, auth *Auth) error {
 	return err
 }
 
+// SetDescription changes the description of an item on the server. An empty
+// description removes it.
+func SetDescription(itemID string, description string, auth *Auth) error {
+	// DriveItem omits an empty description, which would leave it unchanged
+	jsonPatch, _ := json.Marshal(map[string]string{"description": description})
+	_, err := Patch("/me/drive/items/"+itemID, auth, bytes.NewReader(jsonPatch))
+	return err
+}
+
 // only used for parsing
 type driveChildren = api.DriveChildren
 
 // this is the internal method that actually fetches an item's children
-func getItemChildren(pollURL string, auth *Auth) ([]*DriveItem, error) {
+func getItemChildren(ctx context.Context, pollURL string, auth *Auth) ([]*DriveItem, error) {
 	logging.Debug().Str("pollURL", pollURL).Msg("Starting getItemChildren")
 	fetched := make([]*DriveItem, 0)
 	pageCount := 0
@@ -223,7 +336,7 @@ func getItemChildren(pollURL string, auth *Auth) ([]*DriveItem, error) {
 		logging.Debug().Str("pollURL", pollURL).Int("pageCount", pageCount).Msg("Fetching page of children")
 
 		logging.Debug().Str("pollURL", pollURL).Int("pageCount", pageCount).Msg("About to call Get for children page")
-		body, err := Get(pollURL, auth)
+		body, err := RequestWithContext(ctx, pollURL, auth, "GET", nil)
 		logging.Debug().Str("pollURL", pollURL).Int("pageCount", pageCount).Err(err).Msg("Returned from Get for children page")
 
 		if err != nil {
@@ -252,10 +365,22 @@ func getItemChildren(pollURL string, auth *Auth) ([]*DriveItem, error) {
 
 // GetItemChildren fetches all children of an item denoted by ID.
 func GetItemChildren(id string, auth *Auth) ([]*DriveItem, error) {
-	return getItemChildren(childrenPathID(id), auth)
+	return GetItemChildrenWithContext(context.Background(), id, auth)
+}
+
+// GetItemChildrenWithContext is GetItemChildren for requests made as part of
+// the operation of ctx.
+func GetItemChildrenWithContext(ctx context.Context, id string, auth *Auth) ([]*DriveItem, error) {
+	return getItemChildren(ctx, childrenPathID(id), auth)
 }
 
 // GetItemChildrenPath fetches all children of an item denoted by path.
 func GetItemChildrenPath(path string, auth *Auth) ([]*DriveItem, error) {
-	return getItemChildren(childrenPath(path), auth)
+	return GetItemChildrenPathWithContext(context.Background(), path, auth)
+}
+
+// GetItemChildrenPathWithContext is GetItemChildrenPath for requests made as
+// part of the operation of ctx.
+func GetItemChildrenPathWithContext(ctx context.Context, path string, auth *Auth) ([]*DriveItem, error) {
+	return getItemChildren(ctx, childrenPath(path), auth)
 }
@@ -1,12 +1,16 @@
 package graph
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/auriora/onemount/internal/graph/api"
 	"github.com/auriora/onemount/internal/graph/mock"
 	"github.com/auriora/onemount/internal/testutil/framework"
+	"github.com/stretchr/testify/require"
 )
 
 // TestUT_GR_07_01_GraphAPI_VariousPaths_ReturnsCorrectItems tests retrieving items from the Microsoft Graph API.
@@ -138,3 +142,14 @@ func TestUT_GR_07_01_GraphAPI_VariousPaths_ReturnsCorrectItems(t *testing.T) {
 		}
 	})
 }
+
+func TestUT_GR_DriveItem_RenameWithContext_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	auth := &Auth{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	start := time.Now()
+	err := RenameWithContext(ctx, "item", "new.txt", "parent", auth)
+	require.True(t, errors.Is(err, context.Canceled), "got %v", err)
+	require.Less(t, time.Since(start), time.Second, "a cancelled rename is not retried")
+}
@@ -350,3 +350,38 @@ func TestUT_GR_ERR_07_05_SSLTLSCertificateError_TLSVersionMismatch_ReturnsNetwor
 	assert.True(t, errors.IsNetworkError(err))
 	assert.Contains(t, err.Error(), "TLS version not supported")
 }
+
+// TestUT_GR_ERR_08_01_ResponseError_GraphErrors_MatchSentinels tests that failed
+// responses match the sentinel errors and keep the Graph error code
+func TestUT_GR_ERR_08_01_ResponseError_GraphErrors_MatchSentinels(t *testing.T) {
+	tests := []struct {
+		status   int
+		code     string
+		sentinel error
+	}{
+		{http.StatusNotFound, "itemNotFound", errors.ErrNotFound},
+		{http.StatusConflict, "nameAlreadyExists", errors.ErrConflict},
+		{http.StatusPreconditionFailed, "resourceModified", errors.ErrConflict},
+		{http.StatusInsufficientStorage, "quotaLimitReached", errors.ErrQuotaExceeded},
+		{http.StatusForbidden, "quotaLimitReached", nil},
+		{http.StatusLocked, "resourceLocked", nil},
+	}
+	sentinels := []error{errors.ErrNotFound, errors.ErrConflict, errors.ErrQuotaExceeded, errors.ErrOffline}
+
+	for _, test := range tests {
+		body := `{"error":{"code":"` + test.code + `","message":"request failed"}}`
+		err := errors.Wrap(ResponseError(test.status, []byte(body), RequestIDs("client-id", "")), "upload")
+
+		for _, sentinel := range sentinels {
+			assert.Equal(t, sentinel == test.sentinel, errors.Is(err, sentinel), "HTTP %d %s against %v", test.status, test.code, sentinel)
+		}
+		assert.Equal(t, test.code, errors.Code(err))
+		assert.Contains(t, err.Error(), "client-request-id client-id")
+		assert.False(t, IsOffline(err), "a failed response means OneDrive was reached")
+	}
+
+	err := ResponseError(http.StatusInsufficientStorage, []byte("Insufficient Storage"), "")
+	assert.True(t, errors.Is(err, errors.ErrQuotaExceeded))
+	assert.Equal(t, "", errors.Code(err))
+	assert.Contains(t, err.Error(), "Insufficient Storage")
+}
@@ -140,6 +140,7 @@ func Request(resource string, auth *Auth, method string, content io.Reader, head
 // executeRequest executes an HTTP request and processes the response
 func executeRequest(ctx context.Context, request *http.Request, auth *Auth, logCtx logging.LogContext) ([]byte, error) {
 	logging.LogDebugWithContext(logCtx, "About to execute HTTP request")
+	ObserveRequest(auth, request.Method, request.URL.String())
 	response, err := httpClient.Do(request)
 	if err != nil {
 		// Check if the error was due to context cancellation
@@ -154,8 +155,12 @@ func executeRequest(ctx context.Context, request *http.Request, auth *Auth, logC
 		return nil, networkErr
 	}
 
-	// Update log context with status code
+	// Update log context with status code and the ID Graph gave the request
 	logCtx = logCtx.With("status_code", response.StatusCode)
+	serverRequestID := response.Header.Get(serverRequestIDHeader)
+	if serverRequestID != "" {
+		logCtx = logCtx.With(logging.FieldServerRequestID, serverRequestID)
+	}
 	logging.LogDebugWithContext(logCtx, "Network request completed")
 
 	logging.LogDebugWithContext(logCtx, "Starting to read response body")
@@ -226,28 +231,17 @@ func executeRequest(ctx context.Context, request *http.Request, auth *Auth, logC
 		logCtx = logCtx.With("error_code", err.Error.Code).With("error_message", err.Error.Message)
 		logging.LogErrorWithContext(nil, logCtx, "Request failed with API error")
 
-		// Create appropriate error type based on status code
-		errorMsg := fmt.Sprintf("%s: %s", err.Error.Code, err.Error.Message)
-		var apiErr error
-
-		switch {
-		case response.StatusCode == 404:
-			apiErr = errors.NewNotFoundError(errorMsg, nil)
-		case response.StatusCode == 401 || response.StatusCode == 403:
-			apiErr = errors.NewAuthError(errorMsg, nil)
-		case response.StatusCode == 400:
-			apiErr = errors.NewValidationError(errorMsg, nil)
-		case response.StatusCode == 429:
-			// Create a resource busy error for rate limiting
-			apiErr = errors.NewResourceBusyError(errorMsg, nil)
+		apiErr := apiError(response.StatusCode, err.Error.Code, fmt.Sprintf("%s: %s%s", err.Error.Code, err.Error.Message,
+			RequestIDs(request.Header.Get(ClientRequestIDHeader), serverRequestID)))
+		if response.StatusCode == 429 {
 			// Extract retry-after header if present
-			if retryAfter := response.Header.Get("Retry-After"); retryAfter != "" {
+			retryAfter := response.Header.Get("Retry-After")
+			if retryAfter != "" {
 				logging.LogInfoWithContext(logCtx, "Rate limit detected with Retry-After header: "+retryAfter)
 			}
-		case response.StatusCode >= 500:
-			apiErr = errors.NewOperationError(errorMsg, nil)
-		default:
-			apiErr = errors.New(fmt.Sprintf("HTTP %d - %s", response.StatusCode, errorMsg))
+			observeThrottle(auth, request.URL.String(), retryAfter)
+		} else if response.StatusCode >= 500 && response.StatusCode != 507 {
+			observeServerError(auth, request.URL.String(), response.StatusCode)
 		}
 
 		logging.LogErrorWithContext(apiErr, logCtx, "Returning API error")
@@ -261,11 +255,16 @@ func executeRequest(ctx context.Context, request *http.Request, auth *Auth, logC
 // RequestWithContextAndCallback performs an authenticated request to Microsoft Graph with context
 // and calls the provided callback when the request completes
 func RequestWithContextAndCallback(ctx context.Context, resource string, auth *Auth, method string, content io.Reader, callback func([]byte, error), headers ...Header) {
+	// Requests made outside of a logical operation are correlated on their
+	// own, including their retries and a later requeue
+	ctx, correlationID := logging.EnsureCorrelationID(ctx)
+
 	// Create a log context for this request
 	logCtx := logging.NewLogContext("graph_request").
 		WithMethod("RequestWithContextAndCallback").
 		WithPath(resource).
-		With("http_method", method)
+		With("http_method", method).
+		With(logging.FieldCorrelationID, correlationID)
 
 	// Check if we're in operational offline mode
 	isMockClientMutex.RLock()
@@ -294,8 +293,10 @@ func RequestWithContextAndCallback(ctx context.Context, resource string, auth *A
 	logging.LogDebugWithContext(logCtx, "Auth refresh completed")
 
 	logging.LogDebugWithContext(logCtx, "Using HTTP client")
+	resource = auth.scopeResource(resource)
 	request, _ := http.NewRequestWithContext(ctx, method, GraphURL+resource, content)
 	request.Header.Add("Authorization", "bearer "+auth.AccessToken)
+	SetClientRequestID(ctx, request)
 	switch method { // request type-specific code here
 	case "PATCH":
 		request.Header.Add("If-Match", "*")
@@ -466,9 +467,6 @@ func Post(resource string, auth *Auth, content io.Reader, headers ...Header) ([]
 }
 
 // PostWithContext is a convenience wrapper around RequestWithContext
-// This function is intentionally kept for API completeness and potential future use.
-// It is currently unused but maintained for API consistency.
-// nolint:unused,deadcode
 func PostWithContext(ctx context.Context, resource string, auth *Auth, content io.Reader, headers ...Header) ([]byte, error) {
 	data, err := RequestWithContext(ctx, resource, auth, "POST", content, headers...)
 	if err == nil {
@@ -713,6 +711,7 @@ type NetworkConnectivityChecker struct {
 	lastCheckTime   time.Time
 	lastCheckResult bool
 	checkInterval   time.Duration
+	prober          *ConnectivityProber // reused so checks share idle connections
 	mutex           sync.RWMutex
 }
 
@@ -720,6 +719,7 @@ type NetworkConnectivityChecker struct {
 func NewNetworkConnectivityChecker() *NetworkConnectivityChecker {
 	return &NetworkConnectivityChecker{
 		checkInterval: 30 * time.Second, // Check every 30 seconds
+		prober:        NewConnectivityProber(10 * time.Second),
 	}
 }
 
@@ -734,6 +734,13 @@ func (ncc *NetworkConnectivityChecker) IsConnected() bool {
 		return ncc.lastCheckResult
 	}
 
+	// Reuse a recent probe made elsewhere (e.g. the pre-mount check)
+	if result, ok := LastConnectivityResult(); ok && time.Since(result.CheckedAt) < ncc.checkInterval {
+		ncc.lastCheckTime = result.CheckedAt
+		ncc.lastCheckResult = result.Reachable
+		return result.Reachable
+	}
+
 	// Perform actual connectivity check
 	connected := ncc.performConnectivityCheck()
 	ncc.lastCheckTime = time.Now()
@@ -744,23 +751,15 @@ func (ncc *NetworkConnectivityChecker) IsConnected() bool {
 
 // performConnectivityCheck performs the actual network connectivity test
 func (ncc *NetworkConnectivityChecker) performConnectivityCheck() bool {
-	// Try to make a simple HTTP request to Microsoft Graph
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	// Use a lightweight endpoint that doesn't require authentication
-	resp, err := client.Get("https://graph.microsoft.com/v1.0/$metadata")
-	if err != nil {
-		logging.Debug().Err(err).Msg("Network connectivity check failed")
-		return false
-	}
-	defer resp.Body.Close()
-
-	// Consider any response (even errors) as connectivity
-	connected := resp.StatusCode > 0
-	logging.Debug().Bool("connected", connected).Int("statusCode", resp.StatusCode).Msg("Network connectivity check completed")
-	return connected
+	// Probe several endpoints over both address families so IPv6-only or
+	// split-DNS networks are not mistaken for being offline
+	result := ncc.prober.Probe(context.Background())
+	logging.Debug().
+		Bool("connected", result.Reachable).
+		Str("failure", string(result.Failure)).
+		Int("statusCode", result.StatusCode).
+		Msg("Network connectivity check completed")
+	return result.Reachable
 }
 
 // ForceCheck forces an immediate connectivity check, bypassing the cache
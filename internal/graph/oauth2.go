@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/auriora/onemount/internal/logging"
@@ -136,6 +137,7 @@ type Auth struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	Path         string // auth tokens remember their Path for use by Refresh()
+	scope        driveScope
 }
 
 // AuthError is an authentication error from the Microsoft API. Generally we don't see
@@ -224,7 +226,9 @@ func (a *Auth) handleFailedRefresh(ctx context.Context, resp *http.Response, bod
 			logging.Error().Err(err).Msg("Failed to reauthenticate. Using existing tokens.")
 			return fmt.Errorf("failed to refresh token: reauthentication failed: %w", err)
 		}
+		scope := a.scope
 		*a = *newAuth
+		a.scope = scope
 	} else {
 		err := a.ToFile(a.Path)
 		if err != nil {
@@ -239,11 +243,23 @@ func (a *Auth) handleFailedRefresh(ctx context.Context, resp *http.Response, bod
 // Returns an error if the refresh failed and couldn't be recovered.
 // If ctx is nil, context.Background() will be used.
 func (a *Auth) Refresh(ctx context.Context) error {
+	return a.RefreshBefore(ctx, 0)
+}
+
+// RefreshBefore refreshes the auth tokens if they expire within margin.
+// Concurrent refreshes are serialized so the tokens are only renewed once.
+// If ctx is nil, context.Background() will be used.
+func (a *Auth) RefreshBefore(ctx context.Context, margin time.Duration) error {
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	if !a.expiresWithin(margin) {
+		return nil
+	}
+	refreshM.Lock()
+	defer refreshM.Unlock()
 
-	if a.ExpiresAt <= time.Now().Unix() {
+	if a.expiresWithin(margin) {
 		oldTime := a.ExpiresAt
 		postData := a.createRefreshTokenRequest()
 
@@ -294,6 +310,14 @@ func (a *Auth) Refresh(ctx context.Context) error {
 	return nil
 }
 
+// refreshM serializes token refreshes.
+var refreshM sync.Mutex
+
+// expiresWithin reports whether the access token expires within margin.
+func (a *Auth) expiresWithin(margin time.Duration) bool {
+	return a.ExpiresAt-int64(margin/time.Second) <= time.Now().Unix()
+}
+
 // Get the appropriate authentication URL for the Graph OAuth2 challenge.
 func getAuthURL(a AuthConfig) string {
 	return a.CodeURL +
@@ -0,0 +1,163 @@
+package graph
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Observers are installed per Auth, so that each mount of a process only
+// hears of the requests made with its own tokens. Mounts sharing an Auth,
+// like the mounts of one account in a multi-mount process, all hear of the
+// requests of that account.
+
+// authObservers holds the observers installed for each Auth.
+type authObservers[T any] struct {
+	mu     sync.RWMutex
+	next   int
+	byAuth map[*Auth]map[int]T
+}
+
+// add installs observer for the requests made with auth and returns the
+// function removing it.
+func (o *authObservers[T]) add(auth *Auth, observer T) func() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.byAuth == nil {
+		o.byAuth = make(map[*Auth]map[int]T)
+	}
+	if o.byAuth[auth] == nil {
+		o.byAuth[auth] = make(map[int]T)
+	}
+	o.next++
+	key := o.next
+	o.byAuth[auth][key] = observer
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.byAuth[auth], key)
+		if len(o.byAuth[auth]) == 0 {
+			delete(o.byAuth, auth)
+		}
+	}
+}
+
+// each calls fn with every observer installed for auth.
+func (o *authObservers[T]) each(auth *Auth, fn func(T)) {
+	o.mu.RLock()
+	observers := make([]T, 0, len(o.byAuth[auth]))
+	for _, observer := range o.byAuth[auth] {
+		observers = append(observers, observer)
+	}
+	o.mu.RUnlock()
+	for _, observer := range observers {
+		fn(observer)
+	}
+}
+
+// RequestObserver is notified of every HTTP request sent on behalf of the
+// account, with the request method and a normalized endpoint name (see
+// EndpointName). Observers must be cheap; they run on the request path.
+type RequestObserver func(method, endpoint string)
+
+var requestObservers authObservers[RequestObserver]
+
+// AddRequestObserver installs an observer used for API call accounting of
+// the requests made with auth. It returns the function removing it.
+func AddRequestObserver(auth *Auth, observer RequestObserver) func() {
+	return requestObservers.add(auth, observer)
+}
+
+// ObserveRequest reports a request made with auth to its observers.
+// Requests made outside this package (e.g. upload session chunks) call it
+// directly.
+func ObserveRequest(auth *Auth, method, rawURL string) {
+	requestObservers.each(auth, func(observer RequestObserver) {
+		observer(method, EndpointName(rawURL))
+	})
+}
+
+// ThrottleObserver is notified when a request is rejected with 429 Too Many
+// Requests, with the normalized endpoint name and the Retry-After header
+// value (empty when absent).
+type ThrottleObserver func(endpoint, retryAfter string)
+
+var throttleObservers authObservers[ThrottleObserver]
+
+// AddThrottleObserver installs an observer notified of throttled requests
+// made with auth. It returns the function removing it.
+func AddThrottleObserver(auth *Auth, observer ThrottleObserver) func() {
+	return throttleObservers.add(auth, observer)
+}
+
+// observeThrottle reports a throttled request made with auth to its
+// observers.
+func observeThrottle(auth *Auth, rawURL, retryAfter string) {
+	throttleObservers.each(auth, func(observer ThrottleObserver) {
+		observer(EndpointName(rawURL), retryAfter)
+	})
+}
+
+// ServerErrorObserver is notified when OneDrive answers a request with a
+// server error (5xx other than 507 Insufficient Storage), with the normalized
+// endpoint name and the status code.
+type ServerErrorObserver func(endpoint string, status int)
+
+var serverErrorObservers authObservers[ServerErrorObserver]
+
+// AddServerErrorObserver installs an observer notified of server errors
+// answering requests made with auth. It returns the function removing it.
+func AddServerErrorObserver(auth *Auth, observer ServerErrorObserver) func() {
+	return serverErrorObservers.add(auth, observer)
+}
+
+// observeServerError reports a server error to the observers of auth.
+func observeServerError(auth *Auth, rawURL string, status int) {
+	serverErrorObservers.each(auth, func(observer ServerErrorObserver) {
+		observer(EndpointName(rawURL), status)
+	})
+}
+
+// pathAddressRegex matches path-based addressing such as "root:/a/b.txt:".
+var pathAddressRegex = regexp.MustCompile(`:/[^:]*(:|$)`)
+
+// idSegmentParents are path segments that are followed by an identifier.
+var idSegmentParents = map[string]bool{
+	"items":         true,
+	"drives":        true,
+	"permissions":   true,
+	"subscriptions": true,
+	"thumbnails":    true,
+	"users":         true,
+}
+
+// EndpointName collapses a request URL into a stable endpoint name by
+// dropping the host, API version and query and replacing item IDs and paths
+// with placeholders, e.g. "/me/drive/items/{id}/children". Requests to
+// pre-authenticated upload URLs outside the Graph API are reported as
+// "uploadSession".
+func EndpointName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "unknown"
+	}
+	p := u.Path
+	if u.Host != "" && !strings.HasPrefix(rawURL, GraphURL) {
+		return "uploadSession"
+	}
+	p = strings.TrimPrefix(p, "/v1.0")
+	p = pathAddressRegex.ReplaceAllString(p, ":{path}:")
+
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		id, suffix, _ := strings.Cut(segments[i], ":")
+		if idSegmentParents[segments[i-1]] && id != "" && id != "root" {
+			segments[i] = "{id}"
+			if suffix != "" {
+				segments[i] += ":" + suffix
+			}
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
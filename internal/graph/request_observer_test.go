@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_Graph_RequestObserver_EndpointName(t *testing.T) {
+	cases := map[string]string{
+		GraphURL + "/me/drive":                                            "/me/drive",
+		GraphURL + "/me/drive/items/ABC123/children?$top=200":             "/me/drive/items/{id}/children",
+		GraphURL + "/me/drive/root:/Documents/report.docx:/content":       "/me/drive/root:{path}:/content",
+		GraphURL + "/me/drive/items/ABC123:/new.txt:/createUploadSession": "/me/drive/items/{id}:{path}:/createUploadSession",
+		GraphURL + "/me/drive/root/delta?token=latest":                    "/me/drive/root/delta",
+		GraphURL + "/drives/b!xyz/items/ABC123":                           "/drives/{id}/items/{id}",
+		"https://contoso-my.sharepoint.com/upload/session?x=1":            "uploadSession",
+	}
+	for rawURL, want := range cases {
+		require.Equal(t, want, EndpointName(rawURL), rawURL)
+	}
+}
+
+func TestUT_Graph_RequestObserver_Notified(t *testing.T) {
+	var method, endpoint string
+	auth, other := &Auth{}, &Auth{}
+	remove := AddRequestObserver(auth, func(m, e string) { method, endpoint = m, e })
+
+	ObserveRequest(other, "GET", GraphURL+"/me/drive/items/42")
+	require.Empty(t, method, "requests with other tokens go to their own observers")
+	ObserveRequest(auth, "GET", GraphURL+"/me/drive/items/42")
+	require.Equal(t, "GET", method)
+	require.Equal(t, "/me/drive/items/{id}", endpoint)
+
+	remove()
+	ObserveRequest(auth, "PUT", GraphURL+"/me/drive/items/42")
+	require.Equal(t, "GET", method, "a removed observer is not notified")
+}
@@ -0,0 +1,150 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Many sync failures come from incidents on Microsoft's side rather than from
+// the client. CheckServiceHealth tells them apart: accounts whose token grants
+// ServiceHealth.Read.All (work accounts whose administrator consented to it)
+// read the open Microsoft 365 service health issues for OneDrive and
+// SharePoint; other accounts, including every personal account, send a
+// lightweight probe of their drive, which a degraded service answers with a
+// server error.
+
+// Sources of a ServiceHealth.
+const (
+	ServiceHealthIssues = "service-health" // Microsoft 365 service health issues
+	ServiceHealthProbe  = "probe"          // a request for the drive
+)
+
+// serviceHealthScope is the permission needed to read service health issues.
+const serviceHealthScope = "ServiceHealth.Read.All"
+
+// serviceHealthServices are the Microsoft 365 services that OneDrive depends
+// on, as named by service health issues.
+var serviceHealthServices = map[string]bool{
+	"OneDrive for Business": true,
+	"SharePoint Online":     true,
+}
+
+// ServiceIncident is an open Microsoft 365 service health issue affecting
+// OneDrive.
+type ServiceIncident struct {
+	ID             string    `json:"id"`
+	Service        string    `json:"service"`
+	Title          string    `json:"title"`
+	Classification string    `json:"classification"` // incident or advisory
+	Status         string    `json:"status"`         // e.g. serviceDegradation, investigating
+	StartDateTime  time.Time `json:"startDateTime"`
+}
+
+// ServiceHealth is the result of a check of the OneDrive service.
+type ServiceHealth struct {
+	Degraded  bool
+	Source    string
+	Detail    string            // what the check found, for display
+	Incidents []ServiceIncident // open issues, read from service health only
+	CheckedAt time.Time
+}
+
+// CheckServiceHealth checks whether the OneDrive service of the account is
+// degraded. An error means the check itself could not reach Microsoft.
+func CheckServiceHealth(ctx context.Context, auth *Auth) (ServiceHealth, error) {
+	return checkServiceHealth(ctx, tokenHasScope(auth.AccessToken, serviceHealthScope),
+		func(ctx context.Context, resource string) ([]byte, error) {
+			// Not GetWithContext: a cached answer says nothing about the service now
+			return RequestWithContext(ctx, resource, auth, "GET", nil)
+		})
+}
+
+func checkServiceHealth(ctx context.Context, readIssues bool, get capabilityGetter) (ServiceHealth, error) {
+	if readIssues {
+		health, err := readServiceIssues(ctx, get)
+		if err == nil {
+			return health, nil
+		}
+		if !errors.IsAuthError(err) && !errors.IsValidationError(err) && !errors.IsNotFoundError(err) {
+			return ServiceHealth{}, err
+		}
+		logging.Debug().Err(err).Msg("Service health issues cannot be read, probing the drive instead")
+	}
+
+	health := ServiceHealth{Source: ServiceHealthProbe, CheckedAt: time.Now()}
+	_, err := get(ctx, "/me/drive?$select=id")
+	switch {
+	case err == nil:
+		health.Detail = "OneDrive answers normally"
+	case errors.IsOperationError(err):
+		health.Degraded = true
+		health.Detail = "OneDrive answers with server errors: " + err.Error()
+	default:
+		return ServiceHealth{}, err
+	}
+	return health, nil
+}
+
+// readServiceIssues reads the open service health issues affecting OneDrive;
+// only incidents, not advisories, make the service degraded.
+func readServiceIssues(ctx context.Context, get capabilityGetter) (ServiceHealth, error) {
+	body, err := get(ctx, "/admin/serviceAnnouncement/issues?$filter=isResolved%20eq%20false")
+	if err != nil {
+		return ServiceHealth{}, err
+	}
+	var page struct {
+		Value []ServiceIncident `json:"value"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return ServiceHealth{}, errors.Wrap(err, "failed to parse service health issues")
+	}
+
+	health := ServiceHealth{Source: ServiceHealthIssues, CheckedAt: time.Now(), Detail: "no open incidents"}
+	var titles []string
+	for _, issue := range page.Value {
+		if !serviceHealthServices[issue.Service] {
+			continue
+		}
+		health.Incidents = append(health.Incidents, issue)
+		if issue.Classification == "incident" {
+			health.Degraded = true
+			titles = append(titles, issue.ID+": "+issue.Title)
+		}
+	}
+	if health.Degraded {
+		health.Detail = strings.Join(titles, "; ")
+	}
+	return health, nil
+}
+
+// tokenHasScope reports whether the access token grants scope. Work account
+// tokens are JWTs listing their scopes in the scp claim; personal account
+// tokens cannot be read and grant none of the scopes checked here.
+func tokenHasScope(token, scope string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return false
+	}
+	var claims struct {
+		Scopes string `json:"scp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return false
+	}
+	for _, granted := range strings.Fields(claims.Scopes) {
+		if strings.EqualFold(granted, scope) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_Graph_ServiceHealth_ReadsIncidents(t *testing.T) {
+	get := fakeCapabilityGetter(map[string]string{
+		"/admin/serviceAnnouncement/issues": `{"value":[
+			{"id":"EX1","service":"Exchange Online","title":"Mail delayed","classification":"incident"},
+			{"id":"OD2","service":"OneDrive for Business","title":"Sync is slow","classification":"advisory"},
+			{"id":"SP3","service":"SharePoint Online","title":"Users cannot upload files","classification":"incident","status":"serviceDegradation"}
+		]}`,
+	}, nil)
+
+	health, err := checkServiceHealth(context.Background(), true, get)
+	require.NoError(t, err)
+	require.True(t, health.Degraded)
+	require.Equal(t, ServiceHealthIssues, health.Source)
+	require.Len(t, health.Incidents, 2, "issues of other services are left out")
+	require.Equal(t, "SP3: Users cannot upload files", health.Detail, "advisories do not degrade the service")
+}
+
+func TestUT_Graph_ServiceHealth_ProbesWithoutPermission(t *testing.T) {
+	unavailable := errors.NewOperationError("HTTP 503 - serviceUnavailable", nil)
+	get := fakeCapabilityGetter(nil, map[string]error{
+		"/admin/serviceAnnouncement/issues": errors.NewAuthError("HTTP 403 - Forbidden", nil),
+		"/me/drive":                         unavailable,
+	})
+	health, err := checkServiceHealth(context.Background(), true, get)
+	require.NoError(t, err)
+	require.True(t, health.Degraded, "a server error on the probe means the service is degraded")
+	require.Equal(t, ServiceHealthProbe, health.Source)
+
+	get = fakeCapabilityGetter(map[string]string{"/me/drive": `{"id":"drive"}`}, nil)
+	health, err = checkServiceHealth(context.Background(), false, get)
+	require.NoError(t, err)
+	require.False(t, health.Degraded)
+
+	get = fakeCapabilityGetter(nil, map[string]error{"/me/drive": errors.NewNetworkError("no route to host", nil)})
+	_, err = checkServiceHealth(context.Background(), false, get)
+	require.Error(t, err, "an unreachable service is not known to be degraded")
+}
+
+func TestUT_Graph_ServiceHealth_TokenScopes(t *testing.T) {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"scp":"Files.ReadWrite.All ServiceHealth.Read.All User.Read"}`))
+	require.True(t, tokenHasScope("header."+claims+".signature", serviceHealthScope))
+	require.False(t, tokenHasScope("header."+claims+".signature", "Sites.FullControl.All"))
+	require.False(t, tokenHasScope("EwBwA8l6BAAU-opaque-personal-token", serviceHealthScope))
+}
@@ -3,7 +3,6 @@ package graph
 import (
 	"github.com/auriora/onemount/internal/logging"
 	"net/http"
-	"time"
 )
 
 var defaultHTTPClient HTTPClient
@@ -11,12 +10,9 @@ var defaultHTTPClient HTTPClient
 // getSharedHTTPClient returns the shared HTTP client with connection pooling
 func getSharedHTTPClient() HTTPClient {
 	clientOnce.Do(func() {
-		// Create a custom transport with connection pooling settings
-		transport := &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 20,
-			IdleConnTimeout:     90 * time.Second,
-		}
+		// Create a custom transport with connection pooling settings that
+		// dials IPv6 and IPv4 in parallel and honours proxy settings
+		transport := newDualStackTransport()
 
 		// Create the shared client with the custom transport and timeout
 		defaultHTTPClient = &http.Client{
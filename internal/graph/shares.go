@@ -0,0 +1,92 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/auriora/onemount/internal/errors"
+)
+
+// A sharing link can point into another user's drive. The shares API resolves
+// it to the shared item and the drive holding it, and an Auth can then be
+// scoped to that item: every /me/drive resource requested with it is
+// rewritten to the other drive, with /me/drive/root standing for the shared
+// item.
+
+// driveScope is the shared item an Auth is scoped to. The zero value leaves
+// resources unchanged.
+type driveScope struct {
+	base string // "/drives/{drive-id}", empty when unscoped
+	root string // "/drives/{drive-id}/items/{item-id}"
+}
+
+// SharedItem is the target of a sharing link.
+type SharedItem struct {
+	DriveID string
+	Item    *DriveItem
+}
+
+// EncodeShareURL turns a sharing link into the share ID the shares API
+// expects: "u!" followed by the unpadded base64url encoding of the link.
+func EncodeShareURL(link string) string {
+	return "u!" + base64.RawURLEncoding.EncodeToString([]byte(strings.TrimSpace(link)))
+}
+
+// ResolveShareURL looks up the item a sharing link points to.
+func ResolveShareURL(ctx context.Context, link string, auth *Auth) (*SharedItem, error) {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, errors.NewValidationError("not a sharing link: "+link, err)
+	}
+	body, err := GetWithContext(ctx, "/shares/"+EncodeShareURL(link)+"/driveItem", auth)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not resolve sharing link")
+	}
+	item := &DriveItem{}
+	if err := json.Unmarshal(body, item); err != nil {
+		return nil, errors.Wrap(err, "could not parse shared item")
+	}
+	if item.Parent == nil || item.Parent.DriveID == "" {
+		return nil, errors.New("shared item " + item.ID + " has no drive")
+	}
+	return &SharedItem{DriveID: item.Parent.DriveID, Item: item}, nil
+}
+
+// SetDriveScope scopes all later requests made with the Auth to the item
+// itemID of the drive driveID, as if it were the root of the user's own
+// drive. Empty IDs remove the scope. Set it before the Auth is shared with a
+// filesystem; the scope is not synchronized.
+func (a *Auth) SetDriveScope(driveID, itemID string) {
+	if driveID == "" || itemID == "" {
+		a.scope = driveScope{}
+		return
+	}
+	base := "/drives/" + url.PathEscape(driveID)
+	a.scope = driveScope{base: base, root: base + "/items/" + url.PathEscape(itemID)}
+}
+
+// DriveScoped reports whether requests made with the Auth are scoped to a
+// shared item.
+func (a *Auth) DriveScoped() bool {
+	return a != nil && a.scope.base != ""
+}
+
+// scopeResource rewrites a /me/drive resource to the scoped drive.
+func (a *Auth) scopeResource(resource string) string {
+	if !a.DriveScoped() || !strings.HasPrefix(resource, "/me/drive") {
+		return resource
+	}
+	base, root := a.scope.base, a.scope.root
+	rest := strings.TrimPrefix(resource, "/me/drive")
+	if rest == "/root" || strings.HasPrefix(rest, "/root/") || strings.HasPrefix(rest, "/root:") ||
+		strings.HasPrefix(rest, "/root?") {
+		return root + strings.TrimPrefix(rest, "/root")
+	}
+	if rest == "" || rest[0] == '/' || rest[0] == '?' {
+		return base + rest
+	}
+	return resource
+}
@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUT_Graph_Shares_EncodeShareURL(t *testing.T) {
+	require.Equal(t, "u!aHR0cHM6Ly9vbmVkcml2ZS5saXZlLmNvbS9yZWRpcj9yZXNpZD0xMjM0",
+		EncodeShareURL("https://onedrive.live.com/redir?resid=1234"))
+	require.NotContains(t, EncodeShareURL("https://1drv.ms/f/s!AbC?e=x"), "=")
+}
+
+func TestUT_Graph_Shares_ScopeRewritesDriveResources(t *testing.T) {
+	auth := &Auth{}
+	auth.SetDriveScope("b!drive", "FOLDER")
+	require.True(t, auth.DriveScoped())
+	require.False(t, (&Auth{}).DriveScoped(), "the scope belongs to one Auth")
+
+	cases := map[string]string{
+		"/me/drive":                              "/drives/b%21drive",
+		"/me/drive/root":                         "/drives/b%21drive/items/FOLDER",
+		"/me/drive/root/delta?token=latest":      "/drives/b%21drive/items/FOLDER/delta?token=latest",
+		"/me/drive/root:/a%2Fb.txt":              "/drives/b%21drive/items/FOLDER:/a%2Fb.txt",
+		"/me/drive/items/ABC/children":           "/drives/b%21drive/items/ABC/children",
+		"/me/drive/items/ABC/thumbnails/0/c/raw": "/drives/b%21drive/items/ABC/thumbnails/0/c/raw",
+		"/me":                                    "/me",
+		"/me/drives":                             "/me/drives",
+		"/shares/u!abc/driveItem":                "/shares/u!abc/driveItem",
+	}
+	for resource, want := range cases {
+		require.Equal(t, want, auth.scopeResource(resource), resource)
+	}
+
+	auth.SetDriveScope("", "")
+	require.False(t, auth.DriveScoped())
+	require.Equal(t, "/me/drive/root", auth.scopeResource("/me/drive/root"))
+}
+
+func TestUT_Graph_Shares_ResolveRejectsNonLinks(t *testing.T) {
+	_, err := ResolveShareURL(context.Background(), "not a link", &Auth{AccessToken: "token"})
+	require.Error(t, err)
+}
@@ -69,13 +69,14 @@ func GetThumbnailContentWithContext(ctx context.Context, itemID string, size str
 	endpoint := fmt.Sprintf("/me/drive/items/%s/thumbnails/0/%s/content", itemID, size)
 
 	// Make the request
-	req, err := http.NewRequestWithContext(ctx, "GET", GraphURL+endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", GraphURL+auth.scopeResource(endpoint), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add authorization header
 	req.Header.Add("Authorization", "Bearer "+auth.AccessToken)
+	SetClientRequestID(ctx, req)
 
 	// Send the request
 	client := getHTTPClient()
@@ -92,7 +93,8 @@ func GetThumbnailContentWithContext(ctx context.Context, itemID string, size str
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to download thumbnail: %s", resp.Status)
+		return nil, fmt.Errorf("failed to download thumbnail: %s%s", resp.Status,
+			RequestIDs(req.Header.Get(ClientRequestIDHeader), ServerRequestID(resp)))
 	}
 
 	// Read the response body
@@ -114,6 +116,7 @@ func downloadThumbnail(ctx context.Context, url string, auth *Auth) ([]byte, err
 
 	// Add authorization header
 	req.Header.Add("Authorization", "Bearer "+auth.AccessToken)
+	SetClientRequestID(ctx, req)
 
 	// Send the request
 	client := getHTTPClient()
@@ -130,7 +133,8 @@ func downloadThumbnail(ctx context.Context, url string, auth *Auth) ([]byte, err
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to download thumbnail: %s", resp.Status)
+		return nil, fmt.Errorf("failed to download thumbnail: %s%s", resp.Status,
+			RequestIDs(req.Header.Get(ClientRequestIDHeader), ServerRequestID(resp)))
 	}
 
 	// Read the response body
@@ -153,13 +157,14 @@ func GetThumbnailContentStreamWithContext(ctx context.Context, itemID string, si
 	endpoint := fmt.Sprintf("/me/drive/items/%s/thumbnails/0/%s/content", itemID, size)
 
 	// Create a new request
-	req, err := http.NewRequestWithContext(ctx, "GET", GraphURL+endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", GraphURL+auth.scopeResource(endpoint), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add authorization header
 	req.Header.Add("Authorization", "Bearer "+auth.AccessToken)
+	SetClientRequestID(ctx, req)
 
 	// Send the request
 	client := getHTTPClient()
@@ -176,7 +181,8 @@ func GetThumbnailContentStreamWithContext(ctx context.Context, itemID string, si
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download thumbnail: %s", resp.Status)
+		return fmt.Errorf("failed to download thumbnail: %s%s", resp.Status,
+			RequestIDs(req.Header.Get(ClientRequestIDHeader), ServerRequestID(resp)))
 	}
 
 	// Copy the response body to the output writer
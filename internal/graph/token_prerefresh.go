@@ -0,0 +1,120 @@
+package graph
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/auriora/onemount/internal/logging"
+)
+
+// Requests refresh expired tokens themselves, which stalls the first request
+// after expiry for a full round trip to the token endpoint. RunTokenPreRefresh
+// renews the tokens in the background a few minutes before they expire
+// instead. A random jitter spreads the refreshes of several mounts, and
+// failures (e.g. while offline) are retried with exponential backoff until
+// the tokens are renewed. Mounts of one process that share an Auth share its
+// background refresh too.
+const (
+	preRefreshLead       = 5 * time.Minute
+	preRefreshJitter     = time.Minute
+	preRefreshMinBackoff = 15 * time.Second
+	preRefreshMaxBackoff = 5 * time.Minute
+)
+
+// nextPreRefresh returns how long to wait before refreshing tokens expiring
+// at expiresAt, given a jitter in [0, preRefreshJitter).
+func nextPreRefresh(expiresAt, now time.Time, jitter time.Duration) time.Duration {
+	wait := expiresAt.Sub(now) - preRefreshLead - jitter
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// nextPreRefreshBackoff doubles the retry delay after a failed refresh, up to
+// preRefreshMaxBackoff.
+func nextPreRefreshBackoff(backoff time.Duration) time.Duration {
+	if backoff < preRefreshMinBackoff {
+		return preRefreshMinBackoff
+	}
+	backoff *= 2
+	if backoff > preRefreshMaxBackoff {
+		return preRefreshMaxBackoff
+	}
+	return backoff
+}
+
+// preRefreshes holds, for each Auth refreshed in the background, a channel
+// closed when the caller of RunTokenPreRefresh refreshing it returns.
+var preRefreshes = struct {
+	sync.Mutex
+	running map[*Auth]chan struct{}
+}{running: make(map[*Auth]chan struct{})}
+
+// RunTokenPreRefresh keeps auth refreshed ahead of expiry until ctx is
+// cancelled. Only one call refreshes an Auth at a time: the others wait and
+// take over when it returns while their ctx is still live.
+func RunTokenPreRefresh(ctx context.Context, auth *Auth) {
+	if auth == nil {
+		return
+	}
+	for {
+		preRefreshes.Lock()
+		running, ok := preRefreshes.running[auth]
+		if !ok {
+			done := make(chan struct{})
+			preRefreshes.running[auth] = done
+			preRefreshes.Unlock()
+			runTokenPreRefresh(ctx, auth)
+			preRefreshes.Lock()
+			delete(preRefreshes.running, auth)
+			close(done)
+			preRefreshes.Unlock()
+			return
+		}
+		preRefreshes.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-running:
+		}
+	}
+}
+
+// runTokenPreRefresh refreshes auth ahead of expiry until ctx is cancelled.
+func runTokenPreRefresh(ctx context.Context, auth *Auth) {
+	var backoff time.Duration
+	for {
+		wait := nextPreRefresh(time.Unix(auth.ExpiresAt, 0), time.Now(),
+			time.Duration(rand.Int63n(int64(preRefreshJitter))))
+		if backoff > 0 {
+			wait = backoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		err := auth.RefreshBefore(ctx, preRefreshLead+preRefreshJitter)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			backoff = nextPreRefreshBackoff(backoff)
+			logging.Warn().Err(err).Dur("retryIn", backoff).Msg("Background token refresh failed")
+		case auth.expiresWithin(preRefreshLead):
+			// tokens issued with a very short lifetime; don't spin
+			backoff = nextPreRefreshBackoff(backoff)
+		default:
+			backoff = 0
+			logging.Debug().
+				Time("expiresAt", time.Unix(auth.ExpiresAt, 0)).
+				Msg("Refreshed auth tokens ahead of expiry")
+		}
+	}
+}
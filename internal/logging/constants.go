@@ -58,6 +58,10 @@ const (
 	FieldSource      = "source"       // Source of the error
 	FieldTarget      = "target"       // Target of the operation
 
+	// Correlation with Microsoft's diagnostics
+	FieldCorrelationID   = "correlation_id"    // Sent to Graph as client-request-id
+	FieldServerRequestID = "server_request_id" // request-id Graph assigned to a request
+
 	// Phase values
 	PhaseEntry = "entry" // Method entry
 	PhaseExit  = "exit"  // Method exit
@@ -0,0 +1,59 @@
+// Package logging provides standardized logging utilities for the OneMount project.
+// This file provides correlation IDs for logical operations.
+//
+// A correlation ID is generated once per logical operation, such as the
+// download or upload of a file, and carried in its context.Context through
+// the FUSE handler, the transfer queue and every Graph request made for it.
+// Graph requests send it as the client-request-id header, which Microsoft
+// records with its own request-id, so a correlation ID from a user's log can
+// be matched with Microsoft-side diagnostics.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+type correlationKey struct{}
+
+// NewCorrelationID returns a random UUID, the format Graph expects in the
+// client-request-id header.
+func NewCorrelationID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// Not unique, but still a valid ID
+		return GenerateRequestID()
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation ID id.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or "" when there
+// is none.
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// EnsureCorrelationID returns ctx and its correlation ID, adding a new one
+// when ctx carries none.
+func EnsureCorrelationID(ctx context.Context) (context.Context, string) {
+	if id := CorrelationID(ctx); id != "" {
+		return ctx, id
+	}
+	id := NewCorrelationID()
+	return WithCorrelationID(ctx, id), id
+}
@@ -0,0 +1,177 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore keeps an index of the children of every directory next to the
+// entries bucket, keyed by parent ID, name and ID. A bolt cursor over it
+// lists a directory in name order a page at a time, so a folder with hundreds
+// of thousands of items never has to be read whole.
+
+// indexSeparator separates the parts of a children index key. Neither IDs
+// nor names contain it.
+const indexSeparator = 0
+
+// ChildLister is implemented by stores that list the children of a directory
+// in name order.
+type ChildLister interface {
+	// ListChildren returns up to limit children of parentID that sort after
+	// the cursor after, "" for the first page, and the cursor of the last
+	// child returned. Fewer than limit children mean the listing is done.
+	ListChildren(ctx context.Context, parentID, after string, limit int) ([]*Entry, string, error)
+}
+
+// ChildrenIndexBucket returns the name of the children index kept for the
+// entries bucket. Code writing entries without the store can delete it, so
+// the next store opened on the bucket builds it again.
+func ChildrenIndexBucket(bucket []byte) []byte {
+	return append(append([]byte(nil), bucket...), "_children"...)
+}
+
+// indexFields are the parts of an entry the children index depends on.
+type indexFields struct {
+	ID       string    `json:"id"`
+	ParentID string    `json:"parent_id,omitempty"`
+	Name     string    `json:"name"`
+	State    ItemState `json:"item_state"`
+}
+
+// indexKey returns the children index key of the entry stored under key, or
+// nil when the entry is not listed in its parent: deleted entries, the root
+// and copies stored under another key.
+func indexKey(key []byte, fields *indexFields) []byte {
+	if fields.ParentID == "" || fields.State == ItemStateDeleted || fields.ID != string(key) {
+		return nil
+	}
+	return childKey(fields.ParentID, fields.Name, fields.ID)
+}
+
+func childKey(parentID, name, id string) []byte {
+	key := make([]byte, 0, len(parentID)+len(name)+len(id)+2)
+	key = append(key, parentID...)
+	key = append(key, indexSeparator)
+	key = append(key, name...)
+	key = append(key, indexSeparator)
+	return append(key, id...)
+}
+
+func childPrefix(parentID string) []byte {
+	return append([]byte(parentID), indexSeparator)
+}
+
+// PutTx writes the encoded entry data under key in tx and keeps the children
+// index current. Save and Update use it; code writing many entries in one
+// transaction calls it instead of putting them in the bucket itself.
+func (s *BoltStore) PutTx(tx *bolt.Tx, key string, data []byte) error {
+	b := tx.Bucket(s.bucket)
+	if b == nil {
+		return fmt.Errorf("metadata: bucket %q missing", string(s.bucket))
+	}
+	index, err := tx.CreateBucketIfNotExists(s.childrenBucket())
+	if err != nil {
+		return err
+	}
+	var oldKey, newKey []byte
+	if old := b.Get([]byte(key)); len(old) > 0 {
+		var fields indexFields
+		if json.Unmarshal(old, &fields) == nil {
+			oldKey = indexKey([]byte(key), &fields)
+		}
+	}
+	var fields indexFields
+	if json.Unmarshal(data, &fields) == nil {
+		newKey = indexKey([]byte(key), &fields)
+	}
+	if err := b.Put([]byte(key), data); err != nil {
+		return err
+	}
+	if oldKey != nil && !bytes.Equal(oldKey, newKey) {
+		if err := index.Delete(oldKey); err != nil {
+			return err
+		}
+	}
+	if newKey != nil {
+		return index.Put(newKey, nil)
+	}
+	return nil
+}
+
+// ListChildren implements ChildLister. Index keys whose entry moved or was
+// deleted without the store are skipped.
+func (s *BoltStore) ListChildren(_ context.Context, parentID, after string, limit int) ([]*Entry, string, error) {
+	var children []*Entry
+	cursor := after
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return fmt.Errorf("metadata: bucket %q missing", string(s.bucket))
+		}
+		index := tx.Bucket(s.childrenBucket())
+		if index == nil {
+			return nil
+		}
+		prefix := childPrefix(parentID)
+		c := index.Cursor()
+		k, _ := c.Seek(append(prefix, after...))
+		if after != "" && k != nil && string(k[len(prefix):]) == after {
+			k, _ = c.Next()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix) && len(children) < limit; k, _ = c.Next() {
+			cursor = string(k[len(prefix):])
+			sep := bytes.LastIndexByte(k, indexSeparator)
+			raw := b.Get(k[sep+1:])
+			if len(raw) == 0 {
+				continue
+			}
+			var entry Entry
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				continue
+			}
+			fields := indexFields{ID: entry.ID, ParentID: entry.ParentID, Name: entry.Name, State: entry.State}
+			if !bytes.Equal(indexKey(k[sep+1:], &fields), k) {
+				continue
+			}
+			children = append(children, &entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, after, err
+	}
+	return children, cursor, nil
+}
+
+func (s *BoltStore) childrenBucket() []byte {
+	return ChildrenIndexBucket(s.bucket)
+}
+
+// buildChildrenIndex indexes every entry of the bucket when the index is
+// missing, e.g. for a database written before the index existed.
+func (s *BoltStore) buildChildrenIndex() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil || tx.Bucket(s.childrenBucket()) != nil {
+			return nil
+		}
+		index, err := tx.CreateBucket(s.childrenBucket())
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var fields indexFields
+			if json.Unmarshal(v, &fields) != nil {
+				return nil
+			}
+			if key := indexKey(k, &fields); key != nil {
+				return index.Put(key, nil)
+			}
+			return nil
+		})
+	})
+}
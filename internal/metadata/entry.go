@@ -7,11 +7,15 @@ import (
 
 // OperationError captures context about the last failure for hydration/upload.
 type OperationError struct {
-	Message    string    `json:"message"`
-	Temporary  bool      `json:"temporary,omitempty"`
-	OccurredAt time.Time `json:"occurred_at"`
+	Message    string     `json:"message"`
+	Class      ErrorClass `json:"class,omitempty"`
+	Temporary  bool       `json:"temporary,omitempty"`
+	OccurredAt time.Time  `json:"occurred_at"`
 }
 
+// MaxErrorHistory is the number of recent errors kept in Entry.ErrorHistory.
+const MaxErrorHistory = 8
+
 // HydrationState records information about the most recent hydration attempt.
 type HydrationState struct {
 	WorkerID    string          `json:"worker_id,omitempty"`
@@ -22,10 +26,11 @@ type HydrationState struct {
 
 // UploadState records context for uploads in flight or pending retries.
 type UploadState struct {
-	SessionID   string          `json:"session_id,omitempty"`
-	StartedAt   *time.Time      `json:"started_at,omitempty"`
-	CompletedAt *time.Time      `json:"completed_at,omitempty"`
-	LastError   *OperationError `json:"last_error,omitempty"`
+	SessionID      string          `json:"session_id,omitempty"`
+	StartedAt      *time.Time      `json:"started_at,omitempty"`
+	CompletedAt    *time.Time      `json:"completed_at,omitempty"`
+	LastError      *OperationError `json:"last_error,omitempty"`
+	DeferredReason string          `json:"deferred_reason,omitempty"` // why a pending upload is waiting, e.g. DeferredMetered
 }
 
 // PinState indicates the policy governing hydration/eviction decisions.
@@ -44,14 +49,19 @@ type Entry struct {
 	ItemType      ItemKind          `json:"item_type"`
 	State         ItemState         `json:"item_state"`
 	OverlayPolicy OverlayPolicy     `json:"overlay_policy"`
+	OverlaySet    bool              `json:"overlay_set,omitempty"` // policy set on this entry, inherited below it
 	Virtual       bool              `json:"is_virtual,omitempty"`
 	Size          uint64            `json:"size,omitempty"`
 	ETag          string            `json:"etag,omitempty"`
 	CTag          string            `json:"ctag,omitempty"`
 	ContentHash   string            `json:"content_hash,omitempty"`
+	WebURL        string            `json:"web_url,omitempty"`
+	Description   string            `json:"description,omitempty"`
+	PackageType   string            `json:"package_type,omitempty"`
 	LastModified  *time.Time        `json:"last_modified,omitempty"`
 	LastHydrated  *time.Time        `json:"last_hydrated,omitempty"`
 	LastUploaded  *time.Time        `json:"last_uploaded,omitempty"`
+	LastAccessed  *time.Time        `json:"last_accessed,omitempty"` // recorded at most once per access time interval
 	CreatedAt     time.Time         `json:"created_at"`
 	UpdatedAt     time.Time         `json:"updated_at"`
 	Children      []string          `json:"children,omitempty"`
@@ -63,6 +73,21 @@ type Entry struct {
 	Upload        UploadState       `json:"upload"`
 	Pin           PinState          `json:"pin"`
 	LastError     *OperationError   `json:"last_error,omitempty"`
+	// ErrorHistory holds the most recent errors, oldest first and at most
+	// MaxErrorHistory of them. Attempts counts the failed attempts since the
+	// item last hydrated or uploaded successfully.
+	ErrorHistory []OperationError `json:"error_history,omitempty"`
+	Attempts     int              `json:"attempts,omitempty"`
+	// ConflictPeer is the ID of the other item of a conflict pair: the
+	// conflict copy for the original item and the original for the copy.
+	ConflictPeer string `json:"conflict_peer,omitempty"`
+	// ConflictDevice names the computer whose version OneDrive saved as this
+	// conflict copy, for copies OneDrive made itself.
+	ConflictDevice string `json:"conflict_device,omitempty"`
+	// Ino is the inode number strict POSIX mode reports for the item. It is
+	// derived from the first ID of the item and kept when the upload of a
+	// local item gives it its OneDrive ID.
+	Ino uint64 `json:"ino,omitempty"`
 }
 
 // Validate ensures the entry is internally consistent before persistence.
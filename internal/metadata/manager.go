@@ -2,13 +2,15 @@ package metadata
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
+
+	"github.com/auriora/onemount/internal/errors"
 )
 
 // ErrInvalidTransition indicates an unsupported state change was requested.
-var ErrInvalidTransition = errors.New("metadata: invalid state transition")
+// It also matches errors.ErrInvalidTransition.
+var ErrInvalidTransition = errors.NewKind("metadata: invalid state transition", errors.ErrInvalidTransition)
 
 // StateManager coordinates validated metadata state transitions.
 type StateManager struct {
@@ -85,6 +87,7 @@ type transitionConfig struct {
 	workerID        string
 	err             error
 	errTemporary    bool
+	errClass        ErrorClass
 	force           bool
 	hydrationEvent  bool
 	uploadEvent     bool
@@ -125,6 +128,13 @@ func WithTransitionError(err error, temporary bool) TransitionOption {
 	}
 }
 
+// WithErrorClass classifies the error recorded by an ERROR transition.
+func WithErrorClass(class ErrorClass) TransitionOption {
+	return func(cfg *transitionConfig) {
+		cfg.errClass = class
+	}
+}
+
 // WithETag updates the entry's ETag when the transition succeeds.
 func WithETag(etag string) TransitionOption {
 	return func(cfg *transitionConfig) {
@@ -238,6 +248,9 @@ func (m *StateManager) applyTransition(entry *Entry, to ItemState, cfg transitio
 		entry.State = ItemStateHydrated
 		entry.LastHydrated = &now
 		entry.LastError = nil
+		if cfg.hydrationEvent || cfg.uploadEvent {
+			entry.Attempts = 0
+		}
 		if cfg.hydrationEvent {
 			entry.Hydration.CompletedAt = &now
 			entry.Hydration.WorkerID = cfg.workerID
@@ -274,11 +287,21 @@ func (m *StateManager) applyTransition(entry *Entry, to ItemState, cfg transitio
 		if cfg.err != nil {
 			errMsg = cfg.err.Error()
 		}
+		class := cfg.errClass
+		if class == "" {
+			class = ErrorClassOther
+		}
 		entry.LastError = &OperationError{
 			Message:    errMsg,
+			Class:      class,
 			Temporary:  cfg.errTemporary,
 			OccurredAt: now,
 		}
+		entry.ErrorHistory = append(entry.ErrorHistory, *entry.LastError)
+		if extra := len(entry.ErrorHistory) - MaxErrorHistory; extra > 0 {
+			entry.ErrorHistory = append([]OperationError(nil), entry.ErrorHistory[extra:]...)
+		}
+		entry.Attempts++
 		if cfg.hydrationEvent {
 			entry.Hydration.Error = entry.LastError
 			entry.Hydration.CompletedAt = &now
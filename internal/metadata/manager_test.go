@@ -123,6 +123,49 @@ func TestUT_Metadata_StateManagerErrorTransition(t *testing.T) {
 	}
 }
 
+func TestUT_Metadata_StateManagerErrorHistory(t *testing.T) {
+	store := newMemoryStore()
+	entry := &Entry{ID: "id-4", Name: "file.txt", State: ItemStateHydrating}
+	if err := store.Save(context.Background(), entry); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	manager, err := NewStateManager(store)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < MaxErrorHistory+2; i++ {
+		if _, err := manager.Transition(ctx, "id-4", ItemStateError,
+			WithHydrationEvent(),
+			WithTransitionError(fmt.Errorf("failure %d", i), true),
+			WithErrorClass(ErrorClassThrottle),
+		); err != nil {
+			t.Fatalf("transition to error: %v", err)
+		}
+		if _, err := manager.Transition(ctx, "id-4", ItemStateHydrating); err != nil {
+			t.Fatalf("retry: %v", err)
+		}
+	}
+	current, _ := store.Get(ctx, "id-4")
+	if len(current.ErrorHistory) != MaxErrorHistory {
+		t.Fatalf("expected %d errors kept, got %d", MaxErrorHistory, len(current.ErrorHistory))
+	}
+	if first := current.ErrorHistory[0]; first.Message != "failure 2" || first.Class != ErrorClassThrottle {
+		t.Fatalf("expected the oldest errors dropped, got %+v", first)
+	}
+	if current.Attempts != MaxErrorHistory+2 {
+		t.Fatalf("expected %d attempts, got %d", MaxErrorHistory+2, current.Attempts)
+	}
+
+	if _, err := manager.Transition(ctx, "id-4", ItemStateHydrated, WithHydrationEvent()); err != nil {
+		t.Fatalf("hydrate: %v", err)
+	}
+	current, _ = store.Get(ctx, "id-4")
+	if current.Attempts != 0 || len(current.ErrorHistory) != MaxErrorHistory {
+		t.Fatalf("expected attempts reset and history kept, got %d attempts and %d errors", current.Attempts, len(current.ErrorHistory))
+	}
+}
+
 func TestUT_Metadata_StateManagerTransitionTable(t *testing.T) {
 	type step struct {
 		from    ItemState
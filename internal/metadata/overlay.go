@@ -0,0 +1,35 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+)
+
+// overlayDepthLimit bounds the walk up the tree, so a parent cycle in a
+// damaged store cannot loop forever.
+const overlayDepthLimit = 512
+
+// EffectiveOverlayPolicy returns the overlay policy that applies to the entry
+// with the given ID: the one set on the entry itself, otherwise the one set on
+// its nearest ancestor, otherwise fallback. It also returns the ID of the
+// entry the policy was set on, empty for the fallback. Resolution reads one
+// entry per level and stops at the first policy set, so it costs at most the
+// depth of the entry in the tree.
+func EffectiveOverlayPolicy(ctx context.Context, store Store, id string, fallback OverlayPolicy) (OverlayPolicy, string, error) {
+	for depth := 0; id != "" && depth < overlayDepthLimit; depth++ {
+		entry, err := store.Get(ctx, id)
+		if err != nil {
+			if depth > 0 && errors.Is(err, ErrNotFound) {
+				// An ancestor outside the store, such as a shared folder's
+				// parent, ends the walk
+				break
+			}
+			return "", "", err
+		}
+		if entry.OverlaySet && entry.OverlayPolicy != "" {
+			return entry.OverlayPolicy, entry.ID, nil
+		}
+		id = entry.ParentID
+	}
+	return fallback, "", nil
+}
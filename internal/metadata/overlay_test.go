@@ -0,0 +1,69 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUT_Metadata_EffectiveOverlayPolicyInheritsFromAncestors(t *testing.T) {
+	store := newMemoryStore()
+	ctx := context.Background()
+	seed := []*Entry{
+		{ID: "root", Name: "root", OverlayPolicy: OverlayPolicyRemoteWins},
+		{ID: "projects", Name: "Projects", ParentID: "root", OverlayPolicy: OverlayPolicyMerged, OverlaySet: true},
+		{ID: "drafts", Name: "Drafts", ParentID: "projects", OverlayPolicy: OverlayPolicyRemoteWins},
+		{ID: "notes", Name: "notes.txt", ParentID: "drafts", OverlayPolicy: OverlayPolicyRemoteWins},
+		{ID: "mine", Name: "mine.txt", ParentID: "drafts", OverlayPolicy: OverlayPolicyLocalWins, OverlaySet: true},
+		{ID: "other", Name: "other.txt", ParentID: "root", OverlayPolicy: OverlayPolicyRemoteWins},
+	}
+	for _, entry := range seed {
+		entry.State = ItemStateHydrated
+		if err := store.Save(ctx, entry); err != nil {
+			t.Fatalf("seed %s: %v", entry.ID, err)
+		}
+	}
+
+	cases := []struct {
+		id     string
+		policy OverlayPolicy
+		source string
+	}{
+		{"notes", OverlayPolicyMerged, "projects"},
+		{"drafts", OverlayPolicyMerged, "projects"},
+		{"projects", OverlayPolicyMerged, "projects"},
+		{"mine", OverlayPolicyLocalWins, "mine"},
+		{"other", OverlayPolicyRemoteWins, ""},
+	}
+	for _, tc := range cases {
+		policy, source, err := EffectiveOverlayPolicy(ctx, store, tc.id, OverlayPolicyRemoteWins)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.id, err)
+		}
+		if policy != tc.policy || source != tc.source {
+			t.Fatalf("%s: expected %s from %q, got %s from %q", tc.id, tc.policy, tc.source, policy, source)
+		}
+	}
+
+	if _, _, err := EffectiveOverlayPolicy(ctx, store, "missing", OverlayPolicyRemoteWins); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing entry, got %v", err)
+	}
+}
+
+func TestUT_Metadata_EffectiveOverlayPolicyStopsOnParentCycles(t *testing.T) {
+	store := newMemoryStore()
+	ctx := context.Background()
+	for _, entry := range []*Entry{
+		{ID: "a", Name: "a", ParentID: "b", OverlayPolicy: OverlayPolicyRemoteWins},
+		{ID: "b", Name: "b", ParentID: "a", OverlayPolicy: OverlayPolicyRemoteWins},
+	} {
+		entry.State = ItemStateHydrated
+		if err := store.Save(ctx, entry); err != nil {
+			t.Fatalf("seed %s: %v", entry.ID, err)
+		}
+	}
+	policy, _, err := EffectiveOverlayPolicy(ctx, store, "a", OverlayPolicyMerged)
+	if err != nil || policy != OverlayPolicyMerged {
+		t.Fatalf("expected the fallback, got %s, %v", policy, err)
+	}
+}
@@ -109,3 +109,21 @@ func (p PinMode) Validate() error {
 	}
 	return fmt.Errorf("invalid pin mode %q", p)
 }
+
+// ErrorClass groups operation errors by what a retry needs to succeed.
+type ErrorClass string
+
+const (
+	// ErrorClassNetwork is a connection failure or a server error
+	ErrorClassNetwork ErrorClass = "network"
+	// ErrorClassThrottle is a request OneDrive rejected as too many
+	ErrorClassThrottle ErrorClass = "throttle"
+	// ErrorClassPermission is a request refused for the account
+	ErrorClassPermission ErrorClass = "permission"
+	// ErrorClassConflict is a change that clashes with the remote item
+	ErrorClassConflict ErrorClass = "conflict"
+	// ErrorClassIntegrity is content that failed verification
+	ErrorClassIntegrity ErrorClass = "integrity"
+	// ErrorClassOther is any other error
+	ErrorClassOther ErrorClass = "other"
+)
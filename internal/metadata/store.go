@@ -3,15 +3,16 @@ package metadata
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"time"
 
+	"github.com/auriora/onemount/internal/errors"
 	bolt "go.etcd.io/bbolt"
 )
 
-// ErrNotFound indicates the requested metadata entry was not present in the store.
-var ErrNotFound = errors.New("metadata: entry not found")
+// ErrNotFound indicates the requested metadata entry was not present in the
+// store. It also matches errors.ErrNotFound.
+var ErrNotFound = errors.NewKind("metadata: entry not found", errors.ErrNotFound)
 
 // Store defines the persistence contract required by the state manager.
 type Store interface {
@@ -70,6 +71,9 @@ func NewBoltStore(db *bolt.DB, bucket []byte, opts ...BoltStoreOption) (*BoltSto
 	for _, opt := range opts {
 		opt(store)
 	}
+	if err := store.buildChildrenIndex(); err != nil {
+		return nil, fmt.Errorf("metadata: build children index: %w", err)
+	}
 	return store, nil
 }
 
@@ -115,11 +119,7 @@ func (s *BoltStore) Save(_ context.Context, entry *Entry) error {
 		return err
 	}
 	return s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(s.bucket)
-		if b == nil {
-			return fmt.Errorf("metadata: bucket %q missing", string(s.bucket))
-		}
-		return b.Put([]byte(entry.ID), data)
+		return s.PutTx(tx, entry.ID, data)
 	})
 }
 
@@ -150,7 +150,7 @@ func (s *BoltStore) Update(_ context.Context, id string, fn func(*Entry) error)
 		if err != nil {
 			return err
 		}
-		if err := b.Put([]byte(entry.ID), data); err != nil {
+		if err := s.PutTx(tx, entry.ID, data); err != nil {
 			return err
 		}
 		result = &entry
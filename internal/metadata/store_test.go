@@ -3,6 +3,7 @@ package metadata
 import (
 	"context"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,3 +91,83 @@ func TestUT_Metadata_BoltStoreUpdate(t *testing.T) {
 		t.Fatalf("expected hydrated state, got %s", updated.State)
 	}
 }
+
+func TestUT_Metadata_BoltStoreListChildrenPagesInNameOrder(t *testing.T) {
+	dir := t.TempDir()
+	db, err := bolt.Open(filepath.Join(dir, "metadata.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("open bolt: %v", err)
+	}
+	defer db.Close()
+	bucket := []byte("metadata_v2")
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	}); err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	store, err := NewBoltStore(db, bucket)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	ctx := context.Background()
+	for _, e := range []*Entry{
+		{ID: "c", Name: "charlie.txt", ParentID: "dir", State: ItemStateGhost},
+		{ID: "a", Name: "alpha.txt", ParentID: "dir", State: ItemStateGhost},
+		{ID: "b", Name: "bravo.txt", ParentID: "dir", State: ItemStateGhost},
+		{ID: "d", Name: "delta.txt", ParentID: "other", State: ItemStateGhost},
+		{ID: "dir", Name: "dir", State: ItemStateHydrated},
+	} {
+		if err := store.Save(ctx, e); err != nil {
+			t.Fatalf("save %s: %v", e.ID, err)
+		}
+	}
+
+	names := func(after string, limit int) ([]string, string) {
+		t.Helper()
+		entries, cursor, err := store.ListChildren(ctx, "dir", after, limit)
+		if err != nil {
+			t.Fatalf("list children: %v", err)
+		}
+		var listed []string
+		for _, e := range entries {
+			listed = append(listed, e.Name)
+		}
+		return listed, cursor
+	}
+
+	page, cursor := names("", 2)
+	if len(page) != 2 || page[0] != "alpha.txt" || page[1] != "bravo.txt" {
+		t.Fatalf("unexpected first page %v", page)
+	}
+	if page, _ = names(cursor, 2); len(page) != 1 || page[0] != "charlie.txt" {
+		t.Fatalf("unexpected second page %v", page)
+	}
+
+	// renamed, moved in and deleted entries follow in the index
+	if _, err := store.Update(ctx, "a", func(e *Entry) error { e.Name = "zulu.txt"; return nil }); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if _, err := store.Update(ctx, "d", func(e *Entry) error { e.ParentID = "dir"; return nil }); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if _, err := store.Update(ctx, "b", func(e *Entry) error { e.State = ItemStateDeleted; return nil }); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if page, _ = names("", 10); strings.Join(page, ",") != "charlie.txt,delta.txt,zulu.txt" {
+		t.Fatalf("unexpected listing after changes %v", page)
+	}
+
+	// a database without the index gets it built when the store is opened
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(ChildrenIndexBucket(bucket))
+	}); err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+	if store, err = NewBoltStore(db, bucket); err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	if page, _ = names("", 10); strings.Join(page, ",") != "charlie.txt,delta.txt,zulu.txt" {
+		t.Fatalf("unexpected listing after rebuilding the index %v", page)
+	}
+}
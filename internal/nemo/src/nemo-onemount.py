@@ -45,6 +45,9 @@ class OneMountExtension(GObject.GObject, Nemo.InfoProvider, MenuProviderBase):
         # Get list of OneMount mount points
         self.onemount_mounts = self._get_onemount_mounts() or []
 
+        # Running "Make available offline" jobs by folder path
+        self.offline_jobs = {}
+
     def _discover_dbus_service_name(self):
         """Discover the D-Bus service name from the service name file"""
         service_name_file = '/tmp/onemount-dbus-service-name'
@@ -174,7 +177,21 @@ class OneMountExtension(GObject.GObject, Nemo.InfoProvider, MenuProviderBase):
             )
             # Pass the paths to the handler via functools.partial
             item.connect('activate', partial(self._action_refresh_emblems_for_paths, paths=paths))
-            return [item]
+            items = [item]
+
+            if len(paths) == 1:
+                web_item = Nemo.MenuItem(
+                    name='OneMount::OpenInOneDriveWeb',
+                    label='OneMount: Open in OneDrive web',
+                    tip='Open this item in the OneDrive web interface',
+                    icon='web-browser'
+                )
+                web_item.connect('activate', partial(self._action_open_web_url, path=paths[0]))
+                items.append(web_item)
+
+                if files[0].is_directory():
+                    items.append(self._offline_menu_item(paths[0]))
+            return items
         except Exception as e:
             # Be defensive: any errors should not break Nemo
             print(f"Error building file items: {e}")
@@ -210,6 +227,112 @@ class OneMountExtension(GObject.GObject, Nemo.InfoProvider, MenuProviderBase):
             except Exception as e:
                 print(f"Error refreshing emblem for {p}: {e}")
 
+    def _action_open_web_url(self, menu, path: str):
+        """Open the OneDrive web view of the item in the default browser."""
+        url = self._get_web_url(path)
+        if not url:
+            print(f"No OneDrive web URL known for {path}")
+            return
+        try:
+            Gio.AppInfo.launch_default_for_uri(url, None)
+        except Exception as e:
+            print(f"Error opening web URL for {path}: {e}")
+
+    def _get_web_url(self, path):
+        """Get the OneDrive web URL via D-Bus or extended attributes as fallback"""
+        if self.dbus_proxy is not None:
+            try:
+                get_url = self.dbus_proxy.get_dbus_method(
+                    'GetWebURL',
+                    'org.onemount.FileStatus'
+                )
+                url = str(get_url(path))
+                if url:
+                    return url
+            except Exception:
+                # Older daemons do not export GetWebURL; fall back to xattrs
+                pass
+
+        try:
+            return os.getxattr(path, "user.onemount.weburl").decode('utf-8')
+        except Exception:
+            return ""
+
+    def _offline_menu_item(self, path: str):
+        """Build the "Make available offline" item, or its cancel counterpart
+        while a job for the folder is running."""
+        if path in self.offline_jobs:
+            item = Nemo.MenuItem(
+                name='OneMount::CancelAvailableOffline',
+                label='OneMount: Cancel making available offline',
+                tip='Stop downloading this folder; it stays pinned',
+                icon='process-stop'
+            )
+            item.connect('activate', partial(self._action_cancel_offline, path=path))
+            return item
+        item = Nemo.MenuItem(
+            name='OneMount::MakeAvailableOffline',
+            label='OneMount: Make available offline',
+            tip='Pin this folder and download everything in it now',
+            icon='folder-download'
+        )
+        item.connect('activate', partial(self._action_make_available_offline, path=path))
+        return item
+
+    def _mount_relative_path(self, path: str) -> str:
+        """Return path relative to the OneMount mount containing it, as used
+        by the D-Bus job methods."""
+        for mount in getattr(self, 'onemount_mounts', None) or []:
+            mount_normalized = mount.rstrip('/')
+            if path == mount_normalized:
+                return '/'
+            if path.startswith(mount_normalized + '/'):
+                return path[len(mount_normalized):]
+        return path
+
+    def _action_make_available_offline(self, menu, path: str):
+        """Start a job pinning and hydrating the folder and follow its progress."""
+        if self.dbus_proxy is None:
+            print(f"Cannot make {path} available offline: OneMount is not reachable over D-Bus")
+            return
+        try:
+            start = self.dbus_proxy.get_dbus_method('MakeAvailableOffline', 'org.onemount.FileStatus')
+            job = str(start(self._mount_relative_path(path)))
+        except Exception as e:
+            print(f"Error making {path} available offline: {e}")
+            return
+        self.offline_jobs[path] = job
+        GLib.timeout_add_seconds(1, self._poll_offline_job, path, job)
+
+    def _poll_offline_job(self, path: str, job: str):
+        """Report the progress of an offline job; returns False once it finished."""
+        try:
+            get_job = self.dbus_proxy.get_dbus_method('GetJob', 'org.onemount.FileStatus')
+            info = get_job(job)
+            state, message = info[3], info[10]
+        except Exception as e:
+            print(f"Error reading offline job {job} for {path}: {e}")
+            self.offline_jobs.pop(path, None)
+            return False
+        if str(state) == 'running':
+            return True
+        self.offline_jobs.pop(path, None)
+        if str(state) == 'failed':
+            print(f"Making {path} available offline failed: {message}")
+        self._action_refresh_emblems_for_paths(None, [path])
+        return False
+
+    def _action_cancel_offline(self, menu, path: str):
+        """Cancel the running offline job of the folder."""
+        job = self.offline_jobs.get(path)
+        if not job or self.dbus_proxy is None:
+            return
+        try:
+            cancel = self.dbus_proxy.get_dbus_method('CancelJob', 'org.onemount.FileStatus')
+            cancel(job)
+        except Exception as e:
+            print(f"Error cancelling offline job for {path}: {e}")
+
     def _action_refresh_folder(self, menu, folder_path: str):
         """Refresh the folder itself (simple, non-recursive for safety)."""
         try:
@@ -246,7 +369,7 @@ class OneMountExtension(GObject.GObject, Nemo.InfoProvider, MenuProviderBase):
                         info.add_emblem("emblem-default")
                     elif status == "LocalModified":
                         info.add_emblem("emblem-synchronizing-locally-modified")
-                    elif status == "Syncing":
+                    elif status == "Syncing" or status == "Verifying":
                         info.add_emblem("emblem-synchronizing")
                     elif status == "Downloading":
                         info.add_emblem("emblem-downloads")
@@ -77,6 +77,11 @@ class _File:
         mock_file.get_location.return_value.get_path.return_value = path
         return mock_file
 setattr(gio_mod, 'File', _File)
+class _AppInfo:
+    @staticmethod
+    def launch_default_for_uri(uri, context):
+        return True
+setattr(gio_mod, 'AppInfo', _AppInfo)
 
 # GLib module
 glib_mod = types.ModuleType('GLib')
@@ -79,3 +79,60 @@ def test_activate_refresh_emblems_triggers_invalidate(mock_proc_mounts):
         mock_new_for_path.assert_called_once_with(path)
         mock_invalidate.assert_called_once()
 
+
+
+@pytest.mark.unit
+def test_open_in_onedrive_web_uses_dbus_url(mock_proc_mounts):
+    with patch('dbus.mainloop.glib.DBusGMainLoop'), patch('dbus.SessionBus'), \
+         patch('gi.repository.Gio.AppInfo.launch_default_for_uri') as mock_launch:
+        ext = nemo_onemount.OneMountExtension()
+        ext.onemount_mounts = [mock_proc_mounts]
+        ext.dbus_proxy = Mock()
+        ext.dbus_proxy.get_dbus_method.return_value = Mock(return_value="https://onedrive.live.com/item")
+
+        mock_file = Mock()
+        mock_loc = Mock()
+        mock_loc.get_path.return_value = f"{mock_proc_mounts}/file.txt"
+        mock_file.get_location.return_value = mock_loc
+
+        items = ext.get_file_items(None, [mock_file])
+        web_items = [i for i in items if 'OneDrive web' in i.label]
+        assert len(web_items) == 1
+        web_items[0].activate_for_test()
+
+        mock_launch.assert_called_once_with("https://onedrive.live.com/item", None)
+
+
+@pytest.mark.unit
+def test_make_available_offline_starts_and_follows_job(mock_proc_mounts):
+    with patch('dbus.mainloop.glib.DBusGMainLoop'), patch('dbus.SessionBus'), \
+         patch('gi.repository.GLib.timeout_add_seconds', create=True) as mock_timeout, \
+         patch('gi.repository.Nemo.FileInfo.invalidate_extension_info'):
+        ext = nemo_onemount.OneMountExtension()
+        ext.onemount_mounts = [mock_proc_mounts]
+        start = Mock(return_value="hydration-1")
+        get_job = Mock(return_value=("hydration-1", "hydration", "/Photos", "completed", "", 3, 0, 3, 2048, 2048, ""))
+        methods = {'MakeAvailableOffline': start, 'GetJob': get_job}
+        ext.dbus_proxy = Mock()
+        ext.dbus_proxy.get_dbus_method.side_effect = lambda name, iface: methods[name]
+
+        folder = f"{mock_proc_mounts}/Photos"
+        mock_file = Mock()
+        mock_file.get_location.return_value.get_path.return_value = folder
+        mock_file.is_directory.return_value = True
+
+        items = ext.get_file_items(None, [mock_file])
+        offline_items = [i for i in items if 'available offline' in i.label]
+        assert len(offline_items) == 1
+        offline_items[0].activate_for_test()
+
+        start.assert_called_once_with("/Photos")
+        assert ext.offline_jobs == {folder: "hydration-1"}
+        mock_timeout.assert_called_once()
+
+        # While the job runs the menu offers to cancel it
+        items = ext.get_file_items(None, [mock_file])
+        assert any('Cancel' in i.label for i in items)
+
+        assert ext._poll_offline_job(folder, "hydration-1") is False
+        assert ext.offline_jobs == {}
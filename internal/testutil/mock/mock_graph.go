@@ -102,6 +102,7 @@ func (r *BasicMockRecorder) VerifyCall(method string, times int) bool {
 // - Records method calls for verification in tests
 // - Simulates network conditions like latency and packet loss
 // - Simulates error conditions like random errors and API throttling
+// - Plays scripted failure sequences per method and item (see Script and CorruptDownload)
 // - Thread-safe for use in concurrent tests
 // - Supports pagination for large collections
 //
@@ -125,6 +126,10 @@ type MockGraphProvider struct {
 	// Configuration for mock behavior
 	config MockConfig
 
+	// Scripted failures by method and key, and pending download corruptions by item ID
+	scenarios   map[string]*scenario
+	corruptions map[string]int
+
 	// Mutex for thread safety
 	mu sync.Mutex
 }
@@ -202,6 +207,8 @@ func (m *MockGraphProvider) Reset() error {
 	m.recorder = NewBasicMockRecorder()
 	m.config = MockConfig{}
 	m.networkConditions = NetworkConditions{}
+	m.scenarios = nil
+	m.corruptions = nil
 	return nil
 }
 
@@ -416,8 +423,8 @@ func (m *MockGraphProvider) RequestWithContext(ctx context.Context, resource str
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("RequestWithContext", resource); err != nil {
 		return nil, err
 	}
 
@@ -437,8 +444,8 @@ func (m *MockGraphProvider) Get(resource string, headers ...api.Header) ([]byte,
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("Get", resource); err != nil {
 		return nil, err
 	}
 
@@ -458,8 +465,8 @@ func (m *MockGraphProvider) GetWithContext(ctx context.Context, resource string,
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("GetWithContext", resource); err != nil {
 		return nil, err
 	}
 
@@ -479,8 +486,8 @@ func (m *MockGraphProvider) GetItem(id string) (*api.DriveItem, error) {
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("GetItem", id); err != nil {
 		return nil, err
 	}
 
@@ -500,8 +507,8 @@ func (m *MockGraphProvider) GetItemChildren(id string) ([]*api.DriveItem, error)
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("GetItemChildren", id); err != nil {
 		return nil, err
 	}
 
@@ -521,8 +528,8 @@ func (m *MockGraphProvider) GetItemChildrenPath(path string) ([]*api.DriveItem,
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("GetItemChildrenPath", path); err != nil {
 		return nil, err
 	}
 
@@ -542,8 +549,8 @@ func (m *MockGraphProvider) GetItemPath(path string) (*api.DriveItem, error) {
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("GetItemPath", path); err != nil {
 		return nil, err
 	}
 
@@ -563,13 +570,16 @@ func (m *MockGraphProvider) GetItemContent(id string) ([]byte, uint64, error) {
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("GetItemContent", id); err != nil {
 		return nil, 0, err
 	}
 
 	// Call the underlying client
 	result, size, err := m.Client.GetItemContent(id)
+	if err == nil && m.takeCorruption(id) {
+		result = corrupted(result)
+	}
 
 	// Record the result
 	m.recorder.RecordCallWithResult("GetItemContent", result, err, id)
@@ -584,12 +594,15 @@ func (m *MockGraphProvider) GetItemContentStream(id string, output io.Writer) (u
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("GetItemContentStream", id); err != nil {
 		return 0, err
 	}
 
 	// Call the underlying client
+	if m.takeCorruption(id) {
+		output = corruptingWriter{w: output}
+	}
 	size, err := m.Client.GetItemContentStream(id, output)
 
 	// Record the result
@@ -605,8 +618,8 @@ func (m *MockGraphProvider) Patch(resource string, content io.Reader, headers ..
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("Patch", resource); err != nil {
 		return nil, err
 	}
 
@@ -626,8 +639,8 @@ func (m *MockGraphProvider) Post(resource string, content io.Reader, headers ...
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("Post", resource); err != nil {
 		return nil, err
 	}
 
@@ -647,8 +660,8 @@ func (m *MockGraphProvider) Put(resource string, content io.Reader, headers ...a
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("Put", resource); err != nil {
 		return nil, err
 	}
 
@@ -668,8 +681,8 @@ func (m *MockGraphProvider) Delete(resource string, headers ...api.Header) error
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("Delete", resource); err != nil {
 		return err
 	}
 
@@ -689,8 +702,8 @@ func (m *MockGraphProvider) Mkdir(name string, parentID string) (*api.DriveItem,
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("Mkdir", parentID); err != nil {
 		return nil, err
 	}
 
@@ -710,8 +723,8 @@ func (m *MockGraphProvider) Rename(itemID string, itemName string, parentID stri
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("Rename", itemID); err != nil {
 		return err
 	}
 
@@ -731,8 +744,8 @@ func (m *MockGraphProvider) Remove(id string) error {
 	// Simulate network conditions
 	m.SimulateNetworkDelay()
 
-	// Simulate network errors
-	if err := m.SimulateNetworkError(); err != nil {
+	// Simulate scripted and random network errors
+	if err := m.simulateFailure("Remove", id); err != nil {
 		return err
 	}
 
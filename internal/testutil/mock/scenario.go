@@ -0,0 +1,211 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+)
+
+// FaultKind identifies a failure injected by a scripted scenario.
+type FaultKind int
+
+const (
+	// FaultNone lets the call through to the mock client.
+	FaultNone FaultKind = iota
+	// FaultTimeout fails the call like a request that timed out.
+	FaultTimeout
+	// FaultThrottle fails the call like an HTTP 429 response.
+	FaultThrottle
+	// FaultServerError fails the call like an HTTP 5xx response.
+	FaultServerError
+	// FaultError fails the call with a caller-provided error.
+	FaultError
+)
+
+// Fault is one step of a scripted scenario.
+type Fault struct {
+	Kind       FaultKind
+	RetryAfter time.Duration // Retry-After of a FaultThrottle step
+	StatusCode int           // status of a FaultServerError step; defaults to 503
+	Err        error         // error returned by a FaultError step
+}
+
+// Succeed lets the call through.
+func Succeed() Fault { return Fault{Kind: FaultNone} }
+
+// Timeout fails the call as if the request timed out.
+func Timeout() Fault { return Fault{Kind: FaultTimeout} }
+
+// Throttled fails the call as if Graph answered 429 with the given Retry-After.
+func Throttled(retryAfter time.Duration) Fault {
+	return Fault{Kind: FaultThrottle, RetryAfter: retryAfter}
+}
+
+// ServerError fails the call as if Graph answered with statusCode.
+func ServerError(statusCode int) Fault {
+	return Fault{Kind: FaultServerError, StatusCode: statusCode}
+}
+
+// Fail fails the call with err.
+func Fail(err error) Fault { return Fault{Kind: FaultError, Err: err} }
+
+// ThrottleError carries the Retry-After of a scripted 429. It is wrapped in a
+// resource busy error, the type the graph package returns for 429 responses,
+// so retry classification behaves as it does against the real API.
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("HTTP %d, Retry-After %s", http.StatusTooManyRequests, e.RetryAfter)
+}
+
+// RetryAfterOf returns the Retry-After of a scripted throttling error.
+func RetryAfterOf(err error) (time.Duration, bool) {
+	var throttled *ThrottleError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter, true
+	}
+	return 0, false
+}
+
+// err returns the error the faulted call fails with, or nil for FaultNone.
+func (f Fault) err(method string) error {
+	switch f.Kind {
+	case FaultTimeout:
+		return errors.NewNetworkError("simulated timeout in "+method, context.DeadlineExceeded)
+	case FaultThrottle:
+		return errors.NewResourceBusyError("simulated throttling in "+method, &ThrottleError{RetryAfter: f.RetryAfter})
+	case FaultServerError:
+		status := f.StatusCode
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		return errors.NewOperationError(fmt.Sprintf("simulated HTTP %d in %s", status, method), nil)
+	case FaultError:
+		return f.Err
+	}
+	return nil
+}
+
+// scenario is the remaining steps scripted for one method and key.
+type scenario struct {
+	steps []Fault
+}
+
+func scenarioKey(method, key string) string {
+	return method + "\x00" + key
+}
+
+// Script queues steps for calls to method (e.g. "GetItemChildren") whose
+// first argument, usually an item ID or path, equals key; an empty key
+// matches any call to method. Each call consumes one step in order. Calls
+// after the last step behave normally. Scripting a method again appends to
+// its remaining steps.
+//
+//	provider.Script("GetItemChildren", "folder-id",
+//	    mock.Timeout(), mock.Throttled(5*time.Second), mock.Succeed())
+func (m *MockGraphProvider) Script(method, key string, steps ...Fault) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.scenarios == nil {
+		m.scenarios = make(map[string]*scenario)
+	}
+	k := scenarioKey(method, key)
+	s, ok := m.scenarios[k]
+	if !ok {
+		s = &scenario{}
+		m.scenarios[k] = s
+	}
+	s.steps = append(s.steps, steps...)
+}
+
+// CorruptDownload corrupts the content returned by the next times downloads
+// of item id. The corrupted content has the original length, so only hash
+// verification can detect it.
+func (m *MockGraphProvider) CorruptDownload(id string, times int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.corruptions == nil {
+		m.corruptions = make(map[string]int)
+	}
+	m.corruptions[id] += times
+}
+
+// PendingFaults returns how many scripted steps and download corruptions have
+// not been consumed yet, so tests can assert a scenario played out fully.
+func (m *MockGraphProvider) PendingFaults() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := 0
+	for _, s := range m.scenarios {
+		pending += len(s.steps)
+	}
+	for _, n := range m.corruptions {
+		pending += n
+	}
+	return pending
+}
+
+// nextFault consumes the next scripted step for the call. Steps scripted for
+// the exact key take precedence over steps scripted for any key.
+func (m *MockGraphProvider) nextFault(method, key string) Fault {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range []string{scenarioKey(method, key), scenarioKey(method, "")} {
+		if s, ok := m.scenarios[k]; ok && len(s.steps) > 0 {
+			step := s.steps[0]
+			s.steps = s.steps[1:]
+			return step
+		}
+	}
+	return Succeed()
+}
+
+// takeCorruption reports whether the current download of id is corrupted.
+func (m *MockGraphProvider) takeCorruption(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.corruptions[id] <= 0 {
+		return false
+	}
+	m.corruptions[id]--
+	return true
+}
+
+// simulateFailure returns the error of the next scripted step for the call,
+// falling back to the random failures configured through MockConfig.
+func (m *MockGraphProvider) simulateFailure(method, key string) error {
+	if err := m.nextFault(method, key).err(method); err != nil {
+		return err
+	}
+	return m.SimulateNetworkError()
+}
+
+// corrupted returns a copy of content with every bit flipped. The mock
+// client hands out its stored response bodies, so they are never modified.
+func corrupted(content []byte) []byte {
+	buf := make([]byte, len(content))
+	for i, b := range content {
+		buf[i] = b ^ 0xFF
+	}
+	return buf
+}
+
+// corruptingWriter corrupts everything written through it.
+type corruptingWriter struct {
+	w io.Writer
+}
+
+func (c corruptingWriter) Write(p []byte) (int, error) {
+	return c.w.Write(corrupted(p))
+}
@@ -0,0 +1,91 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/auriora/onemount/internal/errors"
+	"github.com/auriora/onemount/internal/graph"
+	"github.com/auriora/onemount/internal/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUT_MG_03_01_MockGraphProvider_ScriptedFaults_PlaysStepsInOrder tests that scripted failures are played in order and retried.
+//
+//	Test Case ID    UT-MG-03-01
+//	Title           Mock Graph Provider Scripted Failure Sequence
+//	Description     Tests that a scripted timeout, 429 and success sequence drives the retry middleware
+//	Preconditions   None
+//	Steps           1. Script GetItemChildren to time out, then throttle, then succeed
+//	                2. List the children through retry.Do
+//	                3. Verify each failure was classified as retryable and the Retry-After was reported
+//	Expected Result The call succeeds on the third attempt and the scenario is fully consumed
+func TestUT_MG_03_01_MockGraphProvider_ScriptedFaults_PlaysStepsInOrder(t *testing.T) {
+	provider := NewMockGraphProvider()
+	provider.AddMockItems("/me/drive/items/folder/children", []*graph.DriveItem{{ID: "child", Name: "child"}})
+	provider.Script("GetItemChildren", "folder", Timeout(), Throttled(5*time.Second), Succeed())
+	provider.Script("GetItemChildren", "other", ServerError(0))
+
+	config := retry.DefaultConfig()
+	config.InitialDelay = time.Millisecond
+	config.MaxDelay = time.Millisecond
+
+	var failures []error
+	var children []*graph.DriveItem
+	err := retry.Do(context.Background(), func() error {
+		var err error
+		children, err = provider.GetItemChildren("folder")
+		if err != nil {
+			failures = append(failures, err)
+		}
+		return err
+	}, config)
+	require.NoError(t, err)
+	require.Len(t, children, 1)
+
+	require.Len(t, failures, 2)
+	assert.True(t, errors.IsNetworkError(failures[0]), "a timeout fails like a network error")
+	assert.True(t, errors.IsResourceBusyError(failures[1]), "a 429 fails like a resource busy error")
+	retryAfter, ok := RetryAfterOf(failures[1])
+	require.True(t, ok)
+	assert.Equal(t, 5*time.Second, retryAfter)
+
+	assert.Equal(t, 1, provider.PendingFaults(), "steps for other keys are untouched")
+	_, err = provider.GetItemChildren("other")
+	assert.True(t, errors.IsOperationError(err))
+	assert.Zero(t, provider.PendingFaults())
+	_, err = provider.GetItemChildren("other")
+	assert.NoError(t, err, "calls after the script behave normally")
+}
+
+// TestUT_MG_03_02_MockGraphProvider_CorruptDownload_CorruptsOnlyScriptedDownloads tests per-item download corruption.
+//
+//	Test Case ID    UT-MG-03-02
+//	Title           Mock Graph Provider Download Corruption
+//	Description     Tests that downloads of an item are corrupted the scripted number of times
+//	Preconditions   None
+//	Steps           1. Mark one download of an item as corrupted
+//	                2. Download the item twice, once as a stream and once in full
+//	                3. Verify only the first download was corrupted and has the original length
+//	Expected Result The hash of the corrupted download does not match; the second download is intact
+func TestUT_MG_03_02_MockGraphProvider_CorruptDownload_CorruptsOnlyScriptedDownloads(t *testing.T) {
+	provider := NewMockGraphProvider()
+	content := []byte("file content")
+	provider.AddMockResponse("/me/drive/items/file/content", content, 200, nil)
+	provider.CorruptDownload("file", 1)
+
+	var streamed bytes.Buffer
+	size, err := provider.GetItemContentStream("file", &streamed)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(len(content)), size)
+	assert.Len(t, streamed.Bytes(), len(content))
+	assert.NotEqual(t, graph.QuickXORHash(&content), graph.QuickXORHashStream(bytes.NewReader(streamed.Bytes())))
+
+	downloaded, _, err := provider.GetItemContent("file")
+	require.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+	assert.Zero(t, provider.PendingFaults())
+}
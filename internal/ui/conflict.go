@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits beyond which ConflictPreview gives up; the diff is quadratic in the
+// number of lines.
+const (
+	maxPreviewBytes = 256 * 1024
+	maxPreviewLines = 2000
+)
+
+// IsText reports whether content looks like text that can be previewed.
+func IsText(content []byte) bool {
+	return utf8.Valid(content) && !bytes.ContainsRune(content, 0)
+}
+
+// ConflictPreview returns a line diff from the local to the remote version of
+// a text file. Lines only in the local version start with "- ", lines only in
+// the remote version with "+ " and unchanged lines with two spaces. It
+// returns false when either version is binary or too large to compare.
+func ConflictPreview(local, remote []byte) (string, bool) {
+	if len(local) > maxPreviewBytes || len(remote) > maxPreviewBytes ||
+		!IsText(local) || !IsText(remote) {
+		return "", false
+	}
+	a, b := splitLines(local), splitLines(remote)
+	if len(a) > maxPreviewLines || len(b) > maxPreviewLines {
+		return "", false
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+	return out.String(), true
+}
+
+func splitLines(content []byte) []string {
+	text := strings.TrimSuffix(string(content), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
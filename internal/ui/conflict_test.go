@@ -0,0 +1,37 @@
+package ui
+
+import (
+	"testing"
+)
+
+// TestUT_UI_04_01_ConflictPreview_TextVersions_ShowsLineDiff tests the diff preview of conflicting text files.
+//
+//	Test Case ID    UT-UI-04-01
+//	Title           Conflict Diff Preview
+//	Description     Tests that conflicting text versions are compared line by line
+//	Preconditions   None
+//	Steps           1. Call ConflictPreview with two text versions
+//	                2. Call ConflictPreview with binary content
+//	Expected Result Text versions produce a line diff, binary content produces no preview
+//	Notes: This test verifies the preview shown by the launcher's conflict dialog.
+func TestUT_UI_04_01_ConflictPreview_TextVersions_ShowsLineDiff(t *testing.T) {
+	local := []byte("title\nlocal line\nshared\n")
+	remote := []byte("title\nshared\nremote line\n")
+
+	preview, ok := ConflictPreview(local, remote)
+	if !ok {
+		t.Fatalf("Expected a preview for text files")
+	}
+	expected := "  title\n- local line\n  shared\n+ remote line\n"
+	if preview != expected {
+		t.Errorf("ConflictPreview() = %q, expected %q", preview, expected)
+	}
+
+	if preview, ok := ConflictPreview(local, local); !ok || preview != "  title\n  local line\n  shared\n" {
+		t.Errorf("Identical versions should only list unchanged lines, got %q", preview)
+	}
+
+	if _, ok := ConflictPreview(local, []byte{0x89, 'P', 'N', 'G', 0}); ok {
+		t.Errorf("Expected no preview for binary content")
+	}
+}
@@ -0,0 +1,134 @@
+package ui
+
+import (
+	"encoding/json"
+	"sort"
+	"syscall"
+
+	"github.com/auriora/onemount/internal/fs"
+	dbus "github.com/godbus/dbus/v5"
+)
+
+// The launcher's status window summarizes the health of every mount: how much
+// is cached, what is waiting to upload, conflicts, which mounts are offline,
+// how full each account's drive is and whether its OneDrive service is
+// degraded. Running mounts are asked for their statistics over D-Bus; the
+// quota is read from the mount's statfs, which reports the drive's quota.
+
+// MountStatus is what is known about one mount for the status window.
+type MountStatus struct {
+	Mountpoint string
+	Account    string
+	Running    bool
+	Stats      *fs.Stats // nil when the mount is stopped or did not answer
+	QuotaTotal uint64
+	QuotaUsed  uint64
+	Err        error
+}
+
+// AccountUsage is the quota of one account across its mounts.
+type AccountUsage struct {
+	Account    string
+	Mounts     int
+	QuotaTotal uint64
+	QuotaUsed  uint64
+	// ServiceDegraded is set when a mount of the account found the OneDrive
+	// service degraded
+	ServiceDegraded bool
+}
+
+// StatusSummary adds up the status of all mounts.
+type StatusSummary struct {
+	Mounts         int
+	Running        int
+	Offline        int
+	Unreachable    int // running mounts whose statistics could not be read
+	CachedBytes    int64
+	PendingUploads int
+	Conflicts      int
+	Degraded       int // accounts whose OneDrive service is degraded
+	Accounts       []AccountUsage
+}
+
+// SummarizeMounts adds up the status of the given mounts. Mounts of the same
+// account share its drive, so their quota is counted once.
+func SummarizeMounts(mounts []MountStatus) StatusSummary {
+	summary := StatusSummary{Mounts: len(mounts)}
+	accounts := make(map[string]*AccountUsage)
+	for _, mount := range mounts {
+		if mount.Running {
+			summary.Running++
+		}
+		if stats := mount.Stats; stats != nil {
+			summary.CachedBytes += stats.ContentSize
+			summary.PendingUploads += PendingUploads(stats)
+			summary.Conflicts += stats.StatusConflict
+			if stats.IsOffline {
+				summary.Offline++
+			}
+		} else if mount.Running {
+			summary.Unreachable++
+		}
+
+		usage, ok := accounts[mount.Account]
+		if !ok {
+			usage = &AccountUsage{Account: mount.Account}
+			accounts[mount.Account] = usage
+		}
+		usage.Mounts++
+		if mount.QuotaTotal > usage.QuotaTotal {
+			usage.QuotaTotal = mount.QuotaTotal
+		}
+		if mount.QuotaUsed > usage.QuotaUsed {
+			usage.QuotaUsed = mount.QuotaUsed
+		}
+		if mount.Stats != nil && mount.Stats.ServiceHealth.Degraded {
+			usage.ServiceDegraded = true
+		}
+	}
+	for _, usage := range accounts {
+		if usage.ServiceDegraded {
+			summary.Degraded++
+		}
+		summary.Accounts = append(summary.Accounts, *usage)
+	}
+	sort.Slice(summary.Accounts, func(i, j int) bool {
+		return summary.Accounts[i].Account < summary.Accounts[j].Account
+	})
+	return summary
+}
+
+// PendingUploads is the number of uploads of a mount that have not completed,
+// including those deferred.
+func PendingUploads(stats *fs.Stats) int {
+	pending := stats.UploadsNotStarted + stats.UploadsInProgress + stats.UploadsVerifying + stats.UploadsErrored
+	for _, count := range stats.UploadsDeferred {
+		pending += count
+	}
+	return pending
+}
+
+// LoadMountStats asks the running mount at mountpoint for its statistics.
+func LoadMountStats(conn *dbus.Conn, mountpoint string) (*fs.Stats, error) {
+	var data string
+	obj := conn.Object(fs.DBusServiceNameForMount(mountpoint), fs.DBusObjectPath)
+	if err := obj.Call(fs.DBusInterface+".GetStats", 0).Store(&data); err != nil {
+		return nil, err
+	}
+	var stats fs.Stats
+	if err := json.Unmarshal([]byte(data), &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// MountQuota returns the size of the drive mounted at mountpoint and how much
+// of it is used.
+func MountQuota(mountpoint string) (total, used uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(mountpoint, &st); err != nil {
+		return 0, 0, err
+	}
+	bsize := uint64(st.Bsize)
+	return st.Blocks * bsize, (st.Blocks - st.Bfree) * bsize, nil
+}
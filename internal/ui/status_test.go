@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/auriora/onemount/internal/fs"
+	"github.com/auriora/onemount/internal/graph"
+)
+
+// TestUT_UI_05_01_SummarizeMounts_SeveralMounts_AddsUpTotals tests the totals of the launcher's status window.
+//
+//	Test Case ID    UT-UI-05-01
+//	Title           Multi-Mount Status Summary
+//	Description     Tests that the statistics of several mounts are added up and quota is counted once per account
+//	Preconditions   None
+//	Steps           1. Call SummarizeMounts with two mounts of one account, one of another and a stopped mount
+//	                2. Check the totals and the per-account quota
+//	Expected Result Bytes, pending uploads, conflicts, offline mounts and degraded accounts are summed; shared quota is not
+//	Notes: This test verifies the summary shown by the launcher's status window.
+func TestUT_UI_05_01_SummarizeMounts_SeveralMounts_AddsUpTotals(t *testing.T) {
+	mounts := []MountStatus{
+		{
+			Mountpoint: "/home/user/OneDrive",
+			Account:    "user@example.com",
+			Running:    true,
+			Stats: &fs.Stats{
+				ContentSize:       1000,
+				UploadsNotStarted: 1,
+				UploadsInProgress: 2,
+				UploadsCompleted:  5,
+				UploadsDeferred:   map[string]int{fs.DeferredMetered: 3},
+				StatusConflict:    1,
+			},
+			QuotaTotal: 100,
+			QuotaUsed:  40,
+		},
+		{
+			Mountpoint: "/home/user/Work",
+			Account:    "user@example.com",
+			Running:    true,
+			Stats: &fs.Stats{ContentSize: 500, UploadsErrored: 1, IsOffline: true,
+				ServiceHealth: graph.ServiceHealth{Degraded: true}},
+			QuotaTotal: 100,
+			QuotaUsed:  40,
+		},
+		{
+			Mountpoint: "/home/user/Shared",
+			Account:    "other@example.com",
+			Running:    true,
+			QuotaTotal: 50,
+			QuotaUsed:  10,
+		},
+		{
+			Mountpoint: "/home/user/Old",
+			Account:    "other@example.com",
+		},
+	}
+
+	summary := SummarizeMounts(mounts)
+	if summary.Mounts != 4 || summary.Running != 3 || summary.Offline != 1 || summary.Unreachable != 1 {
+		t.Errorf("Unexpected mount counts: %+v", summary)
+	}
+	if summary.CachedBytes != 1500 {
+		t.Errorf("CachedBytes = %d, expected 1500", summary.CachedBytes)
+	}
+	if summary.PendingUploads != 7 {
+		t.Errorf("PendingUploads = %d, expected 7", summary.PendingUploads)
+	}
+	if summary.Conflicts != 1 {
+		t.Errorf("Conflicts = %d, expected 1", summary.Conflicts)
+	}
+	if summary.Degraded != 1 {
+		t.Errorf("Degraded = %d, expected 1", summary.Degraded)
+	}
+
+	expected := []AccountUsage{
+		{Account: "other@example.com", Mounts: 2, QuotaTotal: 50, QuotaUsed: 10},
+		{Account: "user@example.com", Mounts: 2, QuotaTotal: 100, QuotaUsed: 40, ServiceDegraded: true},
+	}
+	if len(summary.Accounts) != len(expected) {
+		t.Fatalf("Accounts = %+v, expected %+v", summary.Accounts, expected)
+	}
+	for i := range expected {
+		if summary.Accounts[i] != expected[i] {
+			t.Errorf("Accounts[%d] = %+v, expected %+v", i, summary.Accounts[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package systemd
+
+import (
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// A mount run by onemount@.service (Type=notify) tells systemd how it is
+// doing through the notification socket: READY=1 once it serves requests,
+// STATUS= with what it is syncing, shown by "systemctl status", and
+// RELOADING=1 while it reads its configuration again. Outside systemd
+// NOTIFY_SOCKET is unset and the notifications do nothing.
+
+// Notify sends the given assignments, e.g. "READY=1", to the service manager
+// in one message. It reports false when not run by systemd.
+func Notify(assignments ...string) (bool, error) {
+	return daemon.SdNotify(false, strings.Join(assignments, "\n"))
+}
+
+// NotifyReady reports that startup finished, with status as the first
+// STATUS line.
+func NotifyReady(status string) (bool, error) {
+	return Notify(daemon.SdNotifyReady, statusAssignment(status))
+}
+
+// NotifyStatus updates the STATUS line shown by "systemctl status".
+func NotifyStatus(status string) (bool, error) {
+	return Notify(statusAssignment(status))
+}
+
+// NotifyReloading reports that the configuration is being reloaded. The
+// reload ends with NotifyReady.
+func NotifyReloading() (bool, error) {
+	return Notify(daemon.SdNotifyReloading, statusAssignment("Reloading configuration"))
+}
+
+// NotifyStopping reports that the mount is shutting down.
+func NotifyStopping() (bool, error) {
+	return Notify(daemon.SdNotifyStopping, statusAssignment("Unmounting"))
+}
+
+// statusAssignment makes a STATUS assignment of status, which must fit on
+// one line.
+func statusAssignment(status string) string {
+	return "STATUS=" + strings.ReplaceAll(status, "\n", " ")
+}
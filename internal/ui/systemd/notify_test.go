@@ -0,0 +1,57 @@
+package systemd
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// TestUT_UI_04_02_Notify_ReadyWithStatus_SendsOneMessage tests the notifications of the service manager.
+//
+//	Test Case ID    UT-UI-04-02
+//	Title           Service Manager Notifications
+//	Description     Tests that readiness and status reach the notification socket
+//	Preconditions   None
+//	Steps           1. Listen on a notification socket named by NOTIFY_SOCKET
+//	                2. Call NotifyReady and NotifyReloading
+//	                3. Read the messages from the socket
+//	Expected Result Each call sends one message with all its assignments and a one-line status
+//	Notes: This test verifies what "systemctl status" shows for a mount.
+func TestUT_UI_04_02_Notify_ReadyWithStatus_SendsOneMessage(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Could not listen on the notification socket: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	receive := func() string {
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Could not read a notification: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	sent, err := NotifyReady("Online: uploading 1 file\nand more")
+	if err != nil || !sent {
+		t.Fatalf("NotifyReady = %v, %v", sent, err)
+	}
+	if msg := receive(); msg != "READY=1\nSTATUS=Online: uploading 1 file and more" {
+		t.Errorf("Unexpected notification %q", msg)
+	}
+
+	if _, err := NotifyReloading(); err != nil {
+		t.Fatalf("NotifyReloading failed: %v", err)
+	}
+	if msg := receive(); msg != "RELOADING=1\nSTATUS=Reloading configuration" {
+		t.Errorf("Unexpected notification %q", msg)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := NotifyStatus("Online, up to date"); sent || err != nil {
+		t.Errorf("Outside systemd NotifyStatus = %v, %v, expected nothing sent", sent, err)
+	}
+}